@@ -0,0 +1,70 @@
+// Package bench contains fixtures for benchmarking the hot paths of llmsp:
+// a mock Sourcegraph backend and generated source files of realistic sizes.
+// It also summarizes the latencies of requests to a real instance, for
+// llmsp bench.
+//
+// Run the benchmarks with:
+//
+//	go test -run '^$' -bench . -benchmem ./bench ./providers
+package bench
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+// FileSizes are the file sizes, in lines, that benchmarks run against.
+var FileSizes = []int{100, 1000, 10000}
+
+// Completion is the completion returned by the mock backend.
+const Completion = "if err != nil {\n\t\treturn err\n\t}\n```"
+
+// GoFile generates a Go source file of roughly the given number of lines.
+// The output only depends on lines, so benchmarks are reproducible.
+func GoFile(lines int) string {
+	var b strings.Builder
+	b.WriteString("package bench\n\nimport (\n\t\"errors\"\n\t\"fmt\"\n)\n\n")
+	for i := 0; strings.Count(b.String(), "\n") < lines; i++ {
+		fmt.Fprintf(&b, `// Handler%[1]d handles request number %[1]d and returns an error if the
+// request is invalid.
+func Handler%[1]d(id int, name string) (string, error) {
+	if id < 0 {
+		return "", errors.New("invalid id")
+	}
+	result := fmt.Sprintf("%%d: %%s", id, name)
+	for i := 0; i < id%%10; i++ {
+		result += "."
+	}
+	return result, nil
+}
+
+`, i)
+	}
+	return b.String()
+}
+
+// NewMockServer returns a server that mimics the Sourcegraph completions
+// endpoints, always responding with Completion.
+func NewMockServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.api/graphql", func(w http.ResponseWriter, r *http.Request) {
+		var response struct {
+			Data struct {
+				Completions string `json:"completions"`
+			} `json:"data"`
+		}
+		response.Data.Completions = Completion
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(response)
+	})
+	mux.HandleFunc("/.api/completions/stream", func(w http.ResponseWriter, r *http.Request) {
+		data, _ := json.Marshal(map[string]string{"completion": Completion})
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "event: completion\ndata: %s\n\nevent: done\ndata: {}\n\n", data)
+	})
+
+	return httptest.NewServer(mux)
+}
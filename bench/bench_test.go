@@ -0,0 +1,88 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/pjlast/llmsp/claude"
+	"github.com/pjlast/llmsp/internal/documents"
+	"github.com/pjlast/llmsp/internal/tokenizer"
+	"github.com/pjlast/llmsp/providers"
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/go-lsp"
+)
+
+func TestGoFile(t *testing.T) {
+	for _, size := range FileSizes {
+		file := GoFile(size)
+		if lines := strings.Count(file, "\n"); lines < size {
+			t.Errorf("GoFile(%d) has %d lines", size, lines)
+		}
+		if file != GoFile(size) {
+			t.Errorf("GoFile(%d) is not deterministic", size)
+		}
+	}
+}
+
+// BenchmarkCompletion measures the latency of a completion request against
+// the mock backend, including prompt assembly.
+func BenchmarkCompletion(b *testing.B) {
+	server := NewMockServer()
+	defer server.Close()
+
+	for _, size := range FileSizes {
+		b.Run(fmt.Sprintf("lines=%d", size), func(b *testing.B) {
+			uri := lsp.DocumentURI("file:///bench/handlers.go")
+			file := GoFile(size)
+			l := &providers.SourcegraphLLM{
+				Documents:    documents.FromMap(types.MemoryFileMap{uri: file}),
+				ClaudeClient: claude.NewClient(server.URL, "", nil),
+			}
+			params := types.CompletionParams{
+				TextDocumentPositionParams: lsp.TextDocumentPositionParams{
+					TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+					Position:     lsp.Position{Line: size / 2},
+				},
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := l.GetCompletions(context.Background(), params); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkTruncate measures the cost of truncating files to the size of
+// the current file context.
+func BenchmarkTruncate(b *testing.B) {
+	for _, size := range FileSizes {
+		file := GoFile(size)
+		b.Run(fmt.Sprintf("lines=%d", size), func(b *testing.B) {
+			b.SetBytes(int64(len(file)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				tokenizer.Truncate(file, 1000)
+			}
+		})
+	}
+}
+
+// BenchmarkCount measures the cost of counting the tokens of a file.
+func BenchmarkCount(b *testing.B) {
+	for _, size := range FileSizes {
+		file := GoFile(size)
+		b.Run(fmt.Sprintf("lines=%d", size), func(b *testing.B) {
+			b.SetBytes(int64(len(file)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				tokenizer.Count(file)
+			}
+		})
+	}
+}
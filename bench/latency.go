@@ -0,0 +1,110 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// Sample is the outcome of a single request.
+type Sample struct {
+	Duration time.Duration
+	// TokensSent and TokensReceived are the lengths of the prompt and of
+	// the response
+	TokensSent, TokensReceived int
+	Err                        error
+}
+
+// Request sends the i-th request of a run and returns the lengths of its
+// prompt and response, in tokens.
+type Request func(ctx context.Context, i int) (sent, received int, err error)
+
+// Measure sends n requests one after the other, as an editor does while
+// the user types, and returns their samples.
+func Measure(ctx context.Context, n int, request Request) []Sample {
+	samples := make([]Sample, n)
+	for i := range samples {
+		start := time.Now()
+		sent, received, err := request(ctx, i)
+		samples[i] = Sample{Duration: time.Since(start), TokensSent: sent, TokensReceived: received, Err: err}
+	}
+	return samples
+}
+
+// Stats summarize the samples of a kind of request.
+type Stats struct {
+	Name             string
+	Requests, Errors int
+	// P50 and P95 are percentiles of the latency of successful requests
+	P50, P95 time.Duration
+	// TokensSent and TokensReceived are totals over successful requests
+	TokensSent, TokensReceived int
+	// LastErr is the error of the last failed request, if any
+	LastErr error
+}
+
+// ErrorRate returns the fraction of requests that failed.
+func (s Stats) ErrorRate() float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+	return float64(s.Errors) / float64(s.Requests)
+}
+
+// Summarize returns the stats of the samples.
+func Summarize(name string, samples []Sample) Stats {
+	stats := Stats{Name: name, Requests: len(samples)}
+	var durations []time.Duration
+	for _, sample := range samples {
+		if sample.Err != nil {
+			stats.Errors++
+			stats.LastErr = sample.Err
+			continue
+		}
+		durations = append(durations, sample.Duration)
+		stats.TokensSent += sample.TokensSent
+		stats.TokensReceived += sample.TokensReceived
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	stats.P50 = percentile(durations, 50)
+	stats.P95 = percentile(durations, 95)
+	return stats
+}
+
+// percentile returns the p-th percentile of sorted durations, with the
+// nearest-rank method, or 0 if there are none.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// WriteReport writes the stats as a table, followed by the last error of
+// each kind of request.
+func WriteReport(w io.Writer, stats []Stats) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "REQUEST\tCOUNT\tERRORS\tP50\tP95\tTOKENS SENT\tTOKENS RECEIVED")
+	for _, s := range stats {
+		fmt.Fprintf(tw, "%s\t%d\t%d (%.0f%%)\t%s\t%s\t%d\t%d\n", s.Name, s.Requests, s.Errors, 100*s.ErrorRate(),
+			s.P50.Round(time.Millisecond), s.P95.Round(time.Millisecond), s.TokensSent, s.TokensReceived)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, s := range stats {
+		if s.LastErr != nil {
+			if _, err := fmt.Fprintf(w, "%s: %v\n", s.Name, s.LastErr); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
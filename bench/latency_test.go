@@ -0,0 +1,70 @@
+package bench
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMeasure(t *testing.T) {
+	samples := Measure(context.Background(), 5, func(ctx context.Context, i int) (int, int, error) {
+		time.Sleep(time.Duration(i) * time.Millisecond)
+		if i == 2 {
+			return 0, 0, errors.New("rate limited")
+		}
+		return i, 2 * i, nil
+	})
+
+	if len(samples) != 5 {
+		t.Fatalf("got %d samples, want 5", len(samples))
+	}
+	if samples[2].Err == nil || samples[3].TokensSent != 3 || samples[3].TokensReceived != 6 {
+		t.Errorf("samples aren't in the order of the requests: %+v", samples)
+	}
+	if samples[4].Duration < 4*time.Millisecond {
+		t.Errorf("the last request took %s, want at least 4ms", samples[4].Duration)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	var samples []Sample
+	for i := 1; i <= 20; i++ {
+		samples = append(samples, Sample{Duration: time.Duration(i) * time.Millisecond, TokensSent: 10, TokensReceived: 1})
+	}
+	samples = append(samples, Sample{Duration: time.Hour, Err: errors.New("timeout")})
+
+	stats := Summarize("completion", samples)
+	if stats.Requests != 21 || stats.Errors != 1 {
+		t.Errorf("got %d requests and %d errors, want 21 and 1", stats.Requests, stats.Errors)
+	}
+	// Failed requests don't count in latencies
+	if stats.P50 != 10*time.Millisecond || stats.P95 != 19*time.Millisecond {
+		t.Errorf("p50 == %s and p95 == %s, want 10ms and 19ms", stats.P50, stats.P95)
+	}
+	if stats.TokensSent != 200 || stats.TokensReceived != 20 {
+		t.Errorf("got %d tokens sent and %d received, want 200 and 20", stats.TokensSent, stats.TokensReceived)
+	}
+
+	if empty := Summarize("chat", nil); empty.P50 != 0 || empty.ErrorRate() != 0 {
+		t.Errorf("Summarize(nil) == %+v, want zero stats", empty)
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	var out bytes.Buffer
+	err := WriteReport(&out, []Stats{
+		{Name: "completion", Requests: 4, Errors: 1, P50: 120 * time.Millisecond, P95: 300 * time.Millisecond, TokensSent: 900, TokensReceived: 60, LastErr: errors.New("rate limited")},
+		{Name: "chat", Requests: 2, P50: time.Second, P95: 2 * time.Second},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"P95", "completion  4", "1 (25%)", "120ms", "300ms", "900", "chat", "0 (0%)", "completion: rate limited\n"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("report %q doesn't contain %q", out.String(), want)
+		}
+	}
+}
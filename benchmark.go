@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pjlast/llmsp/bench"
+	"github.com/pjlast/llmsp/claude"
+	"github.com/pjlast/llmsp/internal/config"
+	"github.com/pjlast/llmsp/internal/documents"
+	"github.com/pjlast/llmsp/internal/position"
+	"github.com/pjlast/llmsp/internal/tasks"
+	"github.com/pjlast/llmsp/internal/tokenizer"
+	"github.com/pjlast/llmsp/providers"
+	"github.com/pjlast/llmsp/types"
+	golsp "github.com/sourcegraph/go-lsp"
+)
+
+// benchFileLines is the size of the file completions and chat requests are
+// about.
+const benchFileLines = 1000
+
+// runBench sends completion and chat requests to the instance configured
+// by the flags and config files, and prints a report of their latencies. It
+// returns the exit code.
+func runBench(url, token string, args []string) int {
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	completions := flags.Int("completions", 20, "number of completion requests")
+	chats := flags.Int("chats", 5, "number of chat requests")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	ctx := context.Background()
+	root, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	settings, err := benchSettings(url, root)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	uri := golsp.DocumentURI("file://" + root + "/bench/handlers.go")
+	file := bench.GoFile(benchFileLines)
+	store := documents.NewStore()
+	store.Open(uri, file, 1)
+	group := tasks.NewGroup()
+	defer group.Close(time.Second)
+	provider := &providers.SourcegraphLLM{
+		Documents:     store,
+		WorkspaceRoot: "file://" + root,
+		Tasks:         group,
+		AccessToken:   token,
+	}
+	if err := provider.Initialize(ctx, settings); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := provider.SetSampling(settings.Sampling); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	// Requests are sent one at a time, so the last prompt is the one of the
+	// request being measured
+	var sent int
+	preparePrompt := provider.ClaudeClient.OnPrompt
+	provider.ClaudeClient.OnPrompt = func(ctx context.Context, params *claude.CompletionParameters) {
+		preparePrompt(ctx, params)
+		sent = 0
+		for _, message := range params.Messages {
+			sent += tokenizer.Count(message.Text)
+		}
+	}
+
+	// Completions are requested at the end of statements, and explanations
+	// of function signatures, spread over the file
+	var statements, signatures []int
+	for i, line := range strings.Split(file, "\n") {
+		switch {
+		case strings.HasPrefix(line, "\tresult := "):
+			statements = append(statements, i)
+		case strings.HasPrefix(line, "func "):
+			signatures = append(signatures, i)
+		}
+	}
+	complete := func(ctx context.Context, i int) (int, int, error) {
+		line := statements[i*len(statements) / *completions]
+		items, err := provider.GetCompletions(ctx, types.CompletionParams{
+			TextDocumentPositionParams: golsp.TextDocumentPositionParams{
+				TextDocument: golsp.TextDocumentIdentifier{URI: uri},
+				Position:     position.LineEnd(file, line),
+			},
+		})
+		var received int
+		for _, item := range items {
+			received += tokenizer.Count(item.TextEdit.NewText)
+		}
+		return sent, received, err
+	}
+	chat := func(ctx context.Context, i int) (int, int, error) {
+		line := signatures[i*len(signatures) / *chats]
+		text := strings.Split(file, "\n")[line]
+		explanation, err := provider.Hover(ctx, uri, "", text)
+		return sent, tokenizer.Count(explanation), err
+	}
+
+	report := []bench.Stats{
+		bench.Summarize("completion", bench.Measure(ctx, *completions, complete)),
+		bench.Summarize("chat", bench.Measure(ctx, *chats, chat)),
+	}
+	if err := bench.WriteReport(os.Stdout, report); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// benchSettings merges the config files of the user and of the workspace
+// rooted at root with the URL flag, as the server does. Telemetry is turned
+// off, benchmarks aren't usage.
+func benchSettings(url, root string) (types.LLMSPSettings, error) {
+	var flags json.RawMessage
+	if url != "" {
+		flags, _ = json.Marshal(map[string]any{"sourcegraph": map[string]string{"url": url}})
+	}
+	user, err := config.Load(config.UserPath())
+	if err != nil {
+		return types.LLMSPSettings{}, err
+	}
+	workspace, err := config.Load(config.WorkspacePath(root))
+	if err != nil {
+		return types.LLMSPSettings{}, err
+	}
+	settings, err := config.Merge(flags, user, workspace)
+	if err != nil {
+		return types.LLMSPSettings{}, err
+	}
+	if settings.Sourcegraph == nil {
+		settings.Sourcegraph = &types.SourcegraphSettings{}
+	}
+	settings.Sourcegraph.Telemetry = providers.TelemetryOff
+	return settings, nil
+}
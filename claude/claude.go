@@ -1,13 +1,15 @@
 package claude
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
+
+	"github.com/pjlast/llmsp/sourcegraph/graphql"
 )
 
 type Speaker string
@@ -20,6 +22,28 @@ const (
 type Message struct {
 	Speaker Speaker `json:"speaker"`
 	Text    string  `json:"text"`
+	// Source describes where the text of context messages comes from, it
+	// isn't sent
+	Source *Source `json:"-"`
+	// Pinned messages are kept when the history of prompts is trimmed, it
+	// isn't sent
+	Pinned bool `json:"-"`
+}
+
+// Source describes the context included in a message, so that the context
+// of prompts can be reported.
+type Source struct {
+	// Kind is the kind of context, e.g. "file" or "embeddings"
+	Kind string
+	// File is the file, directory or repository the context comes from, if
+	// any
+	File string
+	// Repo is the repository of the file, for embeddings results, if known
+	Repo string
+	// StartLine and EndLine are the lines of the file included in the
+	// message. Lines start at 1, they are 0 if the message doesn't contain
+	// a range of the file.
+	StartLine, EndLine int
 }
 
 type CompletionParameters struct {
@@ -28,23 +52,52 @@ type CompletionParameters struct {
 	MaxTokensToSample int       `json:"maxTokensToSample"`
 	TopK              int       `json:"topK"`
 	TopP              int       `json:"topP"`
+	// Model is the model to use. If empty, the Sourcegraph instance's default
+	// model is used.
+	Model string `json:"model,omitempty"`
+	// StopSequences end the completion where the model generates one of
+	// them, the stop sequence itself isn't part of the completion
+	StopSequences []string `json:"stopSequences,omitempty"`
 }
 
 type Client struct {
-	URL        string
-	authToken  string
-	httpClient *http.Client
+	URL string
+	// Timeout bounds each request, there is no timeout if it is 0. Streamed
+	// completions are only bounded until the response starts.
+	Timeout time.Duration
+	// GraphQL sends the requests of the client, and authorizes streamed
+	// completions
+	GraphQL *graphql.Client
+	// OnPrompt, if set, is called with the context and parameters of every
+	// completion before it is requested, and may change the parameters
+	OnPrompt func(ctx context.Context, params *CompletionParameters)
+	// Trace, if set, is called once every completion is complete or has
+	// failed
+	Trace func(Trace)
 }
 
-func NewClient(url string, authToken string, httpClient *http.Client) *Client {
-	if httpClient == nil {
-		httpClient = http.DefaultClient
+// Trace describes a completion request.
+type Trace struct {
+	Params *CompletionParameters
+	// Completion is the completion received, without the prompt text
+	Completion string
+	// Duration is the time until the completion was complete, streamed
+	// completions included
+	Duration time.Duration
+	Err      error
+}
+
+// trace calls Trace, if it is set, for the completion requested at start.
+func (c *Client) trace(params *CompletionParameters, completion string, start time.Time, err error) {
+	if c.Trace != nil {
+		c.Trace(Trace{Params: params, Completion: completion, Duration: time.Since(start), Err: err})
 	}
+}
 
+func NewClient(url string, authToken string, httpClient *http.Client) *Client {
 	return &Client{
-		URL:        url,
-		httpClient: httpClient,
-		authToken:  authToken,
+		URL:     url,
+		GraphQL: graphql.NewClient(url, authToken, httpClient),
 	}
 }
 
@@ -67,11 +120,6 @@ type completionInput struct {
 	Messages []message `json:"messages"`
 }
 
-type GraphQLQuery[T any] struct {
-	Query     string `json:"query"`
-	Variables T      `json:"variables"`
-}
-
 const getCompletionsQuery = `query GetCompletions($messages: [Message!]!, $temperature: Float!, $maxTokensToSample: Int!, $topK: Int!, $topP: Int!) {
   completions(input: {
     messages: $messages,
@@ -82,54 +130,50 @@ const getCompletionsQuery = `query GetCompletions($messages: [Message!]!, $tempe
   })
 }`
 
-type completions struct {
-	Data struct {
-		Completions string
-	}
-	Errors []struct {
-		Message   string
-		Locations []struct {
-			Line   int
-			Column int
-		}
-	}
+const getCompletionsWithModelQuery = `query GetCompletions($messages: [Message!]!, $temperature: Float!, $maxTokensToSample: Int!, $topK: Int!, $topP: Int!, $model: String) {
+  completions(input: {
+    messages: $messages,
+    temperature: $temperature,
+    maxTokensToSample: $maxTokensToSample,
+    topK: $topK,
+    topP: $topP,
+    model: $model
+  })
+}`
+
+// CloseIdleConnections closes the idle connections of the HTTP client.
+func (c *Client) CloseIdleConnections() {
+	c.GraphQL.CloseIdleConnections()
 }
 
 func (c *Client) GetCompletion(ctx context.Context, params *CompletionParameters, includePromptText bool) (string, error) {
-	completionsPath, err := url.JoinPath(c.URL, "/.api/graphql")
-	if err != nil {
-		return "", err
+	query := getCompletionsQuery
+	if params.Model != "" {
+		query = getCompletionsWithModelQuery
 	}
 
-	q := GraphQLQuery[CompletionParameters]{
-		Query:     getCompletionsQuery,
-		Variables: *params,
-	}
-
-	body, err := json.Marshal(q)
-	if err != nil {
-		return "", err
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
 	}
-
-	req, err := http.NewRequestWithContext(ctx, "POST", completionsPath, bytes.NewBuffer(body))
-	if err != nil {
-		return "", err
+	if c.OnPrompt != nil {
+		c.OnPrompt(ctx, params)
 	}
-	req.Header.Add("Content-Type", "application/json; charset=utf-8")
-	req.Header.Add("Authorization", "token "+c.authToken)
-
-	resp, err := c.httpClient.Do(req)
+	// The GraphQL API doesn't take stop sequences, they are applied to the
+	// completion instead
+	variables := *params
+	variables.StopSequences = nil
+	start := time.Now()
+	data, err := graphql.Do[struct{ Completions string }](ctx, c.GraphQL, query, variables)
 	if err != nil {
+		err = apiError(err)
+		c.trace(params, "", start, err)
 		return "", err
 	}
 
-	var completion completions
-	if err := json.NewDecoder(resp.Body).Decode(&completion); err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	completionText := completion.Data.Completions
+	completionText := truncateAtStop(data.Completions, params.StopSequences)
+	c.trace(params, completionText, start, nil)
 	if includePromptText {
 		completionText = params.Messages[len(params.Messages)-1].Text + completionText
 	}
@@ -137,13 +181,31 @@ func (c *Client) GetCompletion(ctx context.Context, params *CompletionParameters
 	return completionText, nil
 }
 
-func (c *Client) StreamCompletion(ctx context.Context, params *CompletionParameters, includePromptText bool) (chan string, error) {
-	retChan := make(chan string)
+// truncateAtStop returns the completion up to the first of the stop
+// sequences.
+func truncateAtStop(completion string, stopSequences []string) string {
+	for _, stop := range stopSequences {
+		if stop == "" {
+			continue
+		}
+		if i := strings.Index(completion, stop); i != -1 {
+			completion = completion[:i]
+		}
+	}
+	return completion
+}
+
+// StreamCompletion starts streaming a completion. The stream must be closed
+// once the completion has been read. Canceling ctx stops the stream.
+func (c *Client) StreamCompletion(ctx context.Context, params *CompletionParameters, includePromptText bool) (*Stream, error) {
 	completionsPath, err := url.JoinPath(c.URL, "/.api/completions/stream")
 	if err != nil {
 		return nil, err
 	}
 
+	if c.OnPrompt != nil {
+		c.OnPrompt(ctx, params)
+	}
 	for i, m := range params.Messages {
 		params.Messages[i].Speaker = Speaker(strings.ToLower(string(m.Speaker)))
 	}
@@ -152,50 +214,46 @@ func (c *Client) StreamCompletion(ctx context.Context, params *CompletionParamet
 		return nil, err
 	}
 
+	// The timeout only applies until the response starts, the stream itself
+	// is canceled along with ctx
+	ctx, cancel := context.WithCancel(ctx)
+	if c.Timeout > 0 {
+		timer := time.AfterFunc(c.Timeout, cancel)
+		defer timer.Stop()
+	}
 	req, err := http.NewRequestWithContext(ctx, "POST", completionsPath, bytes.NewBuffer(reqBody))
 	if err != nil {
+		cancel()
 		return nil, err
 	}
 	req.Header.Add("Content-Type", "application/json; charset=utf-8")
-	req.Header.Add("Authorization", "token "+c.authToken)
+	c.GraphQL.Authorize(req)
 
-	resp, err := c.httpClient.Do(req)
+	start := time.Now()
+	resp, err := c.GraphQL.HTTPClient().Do(req)
 	if err != nil {
+		cancel()
+		c.trace(params, "", start, err)
 		return nil, err
 	}
-
-	go func() {
-		var completion struct {
-			Completion string
-		}
-
-		reader := bufio.NewReader(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		defer cancel()
 		defer resp.Body.Close()
+		err := readAPIError(resp)
+		c.trace(params, "", start, err)
+		return nil, err
+	}
 
-		for {
-			line, err := reader.ReadSlice('\n')
-			if err != nil {
-				close(retChan)
-				break
-			}
-
-			if strings.HasPrefix(string(line), "event") {
-				if strings.Contains(string(line), "done") {
-					close(retChan)
-					break
-				}
-			} else {
-				if strings.HasPrefix(string(line), "data: ") {
-					json.Unmarshal([]byte(strings.TrimPrefix(string(line), "data: ")), &completion)
-					if includePromptText {
-						retChan <- strings.TrimSuffix(params.Messages[len(params.Messages)-1].Text+completion.Completion, "\n```")
-					} else {
-						retChan <- strings.TrimSuffix(completion.Completion, "\n```")
-					}
-				}
-			}
-		}
-	}()
-
-	return retChan, nil
+	var prefix string
+	if includePromptText {
+		prefix = params.Messages[len(params.Messages)-1].Text
+	}
+	stream := newStream(ctx, resp.Body, cancel, prefix)
+	if c.Trace != nil {
+		go func() {
+			<-stream.done
+			c.trace(params, strings.TrimPrefix(stream.last, prefix), start, stream.err)
+		}()
+	}
+	return stream, nil
 }
@@ -0,0 +1,163 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/.api/completions/stream" {
+			// Start the response right away, the stream is slower than the
+			// timeout
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			time.Sleep(50 * time.Millisecond)
+			w.Write([]byte("data: {\"completion\": \"Hello\"}\n\nevent: done\n"))
+			return
+		}
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := NewClient(server.URL, "", server.Client())
+	client.Timeout = 10 * time.Millisecond
+	params := DefaultCompletionParameters([]Message{{Speaker: Human, Text: "Hi"}})
+
+	if _, err := client.GetCompletion(context.Background(), params, false); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, want a timeout", err)
+	}
+
+	stream, err := client.StreamCompletion(context.Background(), params, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	var completion string
+	for completion = range stream.C {
+	}
+	if completion != "Hello" {
+		t.Errorf("got completion %q, want the stream to outlast the timeout", completion)
+	}
+}
+
+func TestOnPrompt(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		w.Write([]byte(`{"data": {"completions": "Hello"}}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "", server.Client())
+	var prompts int
+	client.OnPrompt = func(ctx context.Context, params *CompletionParameters) { prompts++ }
+	params := DefaultCompletionParameters([]Message{{Speaker: Human, Text: "Hi", Source: &Source{Kind: "file", File: "secret.go"}}})
+
+	if _, err := client.GetCompletion(context.Background(), params, false); err != nil {
+		t.Fatal(err)
+	}
+	if prompts != 1 {
+		t.Errorf("OnPrompt was called %d times, want once", prompts)
+	}
+	if strings.Contains(body, "secret.go") {
+		t.Errorf("request %s contains the source of a message, want it left out", body)
+	}
+}
+
+func TestStopSequences(t *testing.T) {
+	var graphQLBody, streamBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		if r.URL.Path == "/.api/completions/stream" {
+			streamBody = string(data)
+			w.Write([]byte("data: {\"completion\": \"x := 1\"}\n\nevent: done\n"))
+			return
+		}
+		graphQLBody = string(data)
+		w.Write([]byte(`{"data": {"completions": "x := 1\ny := 2\n` + "```" + `"}}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "", server.Client())
+	params := DefaultCompletionParameters([]Message{{Speaker: Human, Text: "Hi"}})
+	params.StopSequences = []string{"\n```", "\n"}
+
+	completion, err := client.GetCompletion(context.Background(), params, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if completion != "x := 1" {
+		t.Errorf("got completion %q, want it to end before the first stop sequence", completion)
+	}
+	if strings.Contains(graphQLBody, "stopSequences") {
+		t.Errorf("GraphQL request %s has stop sequences, which the API doesn't take", graphQLBody)
+	}
+
+	stream, err := client.StreamCompletion(context.Background(), params, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	for range stream.C {
+	}
+	if !strings.Contains(streamBody, `"stopSequences":["\n`) {
+		t.Errorf("stream request %s has no stop sequences", streamBody)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	fail := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		if r.URL.Path == "/.api/completions/stream" {
+			w.Write([]byte("data: {\"completion\": \"x\"}\n\ndata: {\"completion\": \"x := 1\"}\n\nevent: done\n"))
+			return
+		}
+		w.Write([]byte(`{"data": {"completions": "y := 2"}}`))
+	}))
+	defer server.Close()
+
+	traces := make(chan Trace, 1)
+	client := NewClient(server.URL, "", server.Client())
+	client.Trace = func(trace Trace) { traces <- trace }
+	params := DefaultCompletionParameters([]Message{{Speaker: Human, Text: "Hi"}, {Speaker: Assistant, Text: "> "}})
+
+	if _, err := client.GetCompletion(context.Background(), params, true); err != nil {
+		t.Fatal(err)
+	}
+	if trace := <-traces; trace.Completion != "y := 2" || trace.Params != params || trace.Err != nil {
+		t.Errorf("completion trace == %+v, want the completion without the prompt", trace)
+	}
+
+	stream, err := client.StreamCompletion(context.Background(), params, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range stream.C {
+	}
+	stream.Close()
+	if trace := <-traces; trace.Completion != "x := 1" || trace.Err != nil {
+		t.Errorf("stream trace == %+v, want the whole completion", trace)
+	}
+
+	fail = true
+	if _, err := client.GetCompletion(context.Background(), params, false); err == nil {
+		t.Fatal("failed completion returned no error")
+	}
+	if trace := <-traces; trace.Err == nil {
+		t.Errorf("failed completion trace == %+v, want its error", trace)
+	}
+}
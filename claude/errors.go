@@ -0,0 +1,141 @@
+package claude
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pjlast/llmsp/sourcegraph/graphql"
+)
+
+var (
+	// ErrRateLimited is returned when the rate limit or quota of the
+	// completions API has been exceeded.
+	ErrRateLimited = errors.New("rate limit exceeded")
+	// ErrUnauthorized is returned when the access token is missing, invalid
+	// or doesn't have access to Cody.
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrContextTooLong is returned when the prompt exceeds the context window
+	// of the model.
+	ErrContextTooLong = errors.New("prompt is too long")
+)
+
+// APIError is an error returned by the completions API. Use errors.Is with
+// ErrRateLimited, ErrUnauthorized or ErrContextTooLong to check its kind.
+type APIError struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+	// Message is the error message returned by the API.
+	Message string
+	// RetryAfter is how long to wait before retrying, if the API said so.
+	RetryAfter time.Duration
+
+	kind error
+}
+
+func (e *APIError) Error() string {
+	if e.kind != nil {
+		return fmt.Sprintf("completions API: %v: %s", e.kind, e.Message)
+	}
+	return fmt.Sprintf("completions API: %s", e.Message)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.kind
+}
+
+// newAPIError creates an APIError, determining its kind from the status code
+// and message.
+func newAPIError(statusCode int, message string, header http.Header) *APIError {
+	message = strings.TrimSpace(message)
+	if message == "" {
+		message = http.StatusText(statusCode)
+	}
+	err := &APIError{
+		StatusCode: statusCode,
+		Message:    message,
+		kind:       errorKind(statusCode, message),
+	}
+	if seconds, convErr := strconv.Atoi(header.Get("Retry-After")); convErr == nil {
+		err.RetryAfter = time.Duration(seconds) * time.Second
+	}
+
+	return err
+}
+
+// errorKind classifies an error response.
+func errorKind(statusCode int, message string) error {
+	switch statusCode {
+	case http.StatusTooManyRequests:
+		return ErrRateLimited
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrUnauthorized
+	case http.StatusRequestEntityTooLarge:
+		return ErrContextTooLong
+	}
+
+	lower := strings.ToLower(message)
+	switch {
+	case strings.Contains(lower, "rate limit") || strings.Contains(lower, "quota"):
+		return ErrRateLimited
+	case strings.Contains(lower, "unauthorized") || strings.Contains(lower, "not authenticated") || strings.Contains(lower, "access token"):
+		return ErrUnauthorized
+	case strings.Contains(lower, "too long") || strings.Contains(lower, "too many tokens") || strings.Contains(lower, "context window"):
+		return ErrContextTooLong
+	}
+
+	return nil
+}
+
+// maxErrorBodySize is the maximum size of an error response body that is read.
+const maxErrorBodySize = 64 * 1024
+
+// readAPIError reads the error from an unsuccessful response.
+func readAPIError(resp *http.Response) *APIError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	return newAPIError(resp.StatusCode, errorMessage(body), resp.Header)
+}
+
+// apiError converts an error of the GraphQL API into an APIError. Other
+// errors, such as network errors, are returned as they are.
+func apiError(err error) error {
+	var statusErr *graphql.StatusError
+	if errors.As(err, &statusErr) {
+		return newAPIError(statusErr.StatusCode, errorMessage(statusErr.Body), statusErr.Header)
+	}
+	var graphQLErr *graphql.GraphQLError
+	if errors.As(err, &graphQLErr) {
+		return newAPIError(http.StatusOK, strings.Join(graphQLErr.Messages, "; "), nil)
+	}
+	return err
+}
+
+// errorMessage returns the message of an error response body. Both JSON
+// bodies, as returned by the GraphQL and completions APIs, and plain text
+// bodies are supported.
+func errorMessage(body []byte) string {
+	var jsonBody struct {
+		Error  string `json:"error"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	message := string(body)
+	if err := json.Unmarshal(body, &jsonBody); err == nil {
+		if jsonBody.Error != "" {
+			message = jsonBody.Error
+		} else if len(jsonBody.Errors) > 0 {
+			messages := make([]string, len(jsonBody.Errors))
+			for i, e := range jsonBody.Errors {
+				messages[i] = e.Message
+			}
+			message = strings.Join(messages, "; ")
+		}
+	}
+	return message
+}
@@ -0,0 +1,60 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGetCompletionErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		header  map[string]string
+		body    string
+		want    error
+		message string
+	}{
+		{"rate limited", http.StatusTooManyRequests, map[string]string{"Retry-After": "30"}, `{"error": "you have exceeded the rate limit"}`, ErrRateLimited, "you have exceeded the rate limit"},
+		{"unauthorized", http.StatusUnauthorized, nil, "Invalid access token.", ErrUnauthorized, "Invalid access token."},
+		{"graphql quota", http.StatusOK, nil, `{"data": null, "errors": [{"message": "completions quota exceeded"}]}`, ErrRateLimited, "completions quota exceeded"},
+		{"context too long", http.StatusBadRequest, nil, `{"errors": [{"message": "prompt is too long: 120000 tokens"}]}`, ErrContextTooLong, "prompt is too long: 120000 tokens"},
+		{"other", http.StatusInternalServerError, nil, "", nil, "Internal Server Error"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for k, v := range test.header {
+					w.Header().Set(k, v)
+				}
+				w.WriteHeader(test.status)
+				w.Write([]byte(test.body))
+			}))
+			defer server.Close()
+
+			client := NewClient(server.URL, "token", nil)
+			_, err := client.GetCompletion(context.Background(), DefaultCompletionParameters([]Message{{Speaker: Human, Text: "hi"}}), false)
+
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("expected an APIError, got %v", err)
+			}
+			if test.want != nil && !errors.Is(err, test.want) {
+				t.Errorf("expected %v, got %v", test.want, err)
+			}
+			if test.want == nil && errors.Unwrap(err) != nil {
+				t.Errorf("expected an unclassified error, got %v", err)
+			}
+			if apiErr.Message != test.message {
+				t.Errorf("Message == %q, want %q", apiErr.Message, test.message)
+			}
+			if test.header["Retry-After"] != "" && apiErr.RetryAfter != 30*time.Second {
+				t.Errorf("RetryAfter == %s, want 30s", apiErr.RetryAfter)
+			}
+		})
+	}
+}
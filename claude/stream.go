@@ -0,0 +1,117 @@
+package claude
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// Stream is a streamed completion. Read the completion from C until it is
+// closed, then check Err. Close the stream when done with it, which stops
+// the request if it is still running.
+//
+// Sending on C never blocks: if the reader falls behind, it skips to the
+// latest completion, which contains everything received so far.
+type Stream struct {
+	// C receives the completion received so far whenever it grows. It is
+	// closed when the completion is complete, or the stream fails or is
+	// closed.
+	C <-chan string
+
+	c      chan string
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+	// last is the last completion sent, it may be read once done is closed
+	last string
+}
+
+// newStream returns a stream reading the server-sent events of body, which
+// is closed once the stream ends or ctx is done. cancel is called on Close.
+func newStream(ctx context.Context, body io.ReadCloser, cancel context.CancelFunc, prefix string) *Stream {
+	c := make(chan string, 1)
+	s := &Stream{C: c, c: c, cancel: cancel, done: make(chan struct{})}
+
+	// Closing the body interrupts the read in progress
+	go func() {
+		select {
+		case <-ctx.Done():
+			body.Close()
+		case <-s.done:
+		}
+	}()
+
+	go func() {
+		defer cancel()
+		defer close(s.done)
+		defer close(s.c)
+		defer body.Close()
+
+		var completion struct {
+			Completion string
+		}
+		reader := bufio.NewReader(body)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				if ctx.Err() != nil {
+					s.err = ctx.Err()
+				} else if err != io.EOF {
+					s.err = err
+				}
+				return
+			}
+
+			if strings.HasPrefix(line, "event") {
+				if strings.Contains(line, "done") {
+					return
+				}
+			} else if strings.HasPrefix(line, "data: ") {
+				if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &completion); err != nil {
+					continue
+				}
+				s.send(strings.TrimSuffix(prefix+completion.Completion, "\n```"))
+			}
+		}
+	}()
+
+	return s
+}
+
+// CompletedStream returns a stream sending a complete completion at once,
+// for completions that weren't streamed.
+func CompletedStream(completion string) *Stream {
+	c := make(chan string, 1)
+	s := &Stream{C: c, c: c, cancel: func() {}, done: make(chan struct{})}
+	c <- completion
+	close(c)
+	close(s.done)
+	return s
+}
+
+// send replaces the completion waiting to be read, if any, with completion.
+// Only the goroutine reading the response sends.
+func (s *Stream) send(completion string) {
+	s.last = completion
+	select {
+	case <-s.c:
+	default:
+	}
+	s.c <- completion
+}
+
+// Err returns the error that ended the stream, if any. It must be called
+// after C is closed.
+func (s *Stream) Err() error {
+	<-s.done
+	return s.err
+}
+
+// Close stops the request and waits for the response to be closed. It is
+// safe to call Close more than once, and after the stream has ended.
+func (s *Stream) Close() {
+	s.cancel()
+	<-s.done
+}
@@ -0,0 +1,86 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// eventSource writes the server-sent events of a completion growing by one
+// word at a time, and blocks until it is closed once the words run out.
+func eventSource(words int) io.ReadCloser {
+	r, w := io.Pipe()
+	go func() {
+		var completion string
+		for i := 0; i < words; i++ {
+			completion += fmt.Sprintf("word%d ", i)
+			if _, err := fmt.Fprintf(w, "event: completion\ndata: {\"completion\": %q}\n\n", completion); err != nil {
+				return
+			}
+		}
+	}()
+	return r
+}
+
+func TestStreamCloseWithoutReading(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := newStream(ctx, eventSource(100), cancel, "")
+
+	closed := make(chan struct{})
+	go func() {
+		stream.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close blocked on a stream that isn't read")
+	}
+	if err := stream.Err(); !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want context.Canceled", err)
+	}
+}
+
+func TestStreamContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	streamCtx, streamCancel := context.WithCancel(ctx)
+	stream := newStream(streamCtx, eventSource(3), streamCancel, "")
+	defer stream.Close()
+
+	// The source blocks after the third word, until the context is canceled
+	for completion := range stream.C {
+		if completion == "word0 word1 word2 " {
+			cancel()
+		}
+	}
+	if err := stream.Err(); !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want context.Canceled", err)
+	}
+}
+
+func TestStreamSkipsToLatest(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	body := io.NopCloser(strings.NewReader("data: {\"completion\": \"a\"}\n" +
+		"data: {\"completion\": \"ab\"}\n" +
+		"data: {\"completion\": \"abc\"}\n" +
+		"event: done\n"))
+	stream := newStream(ctx, body, cancel, "> ")
+	defer stream.Close()
+
+	// Nothing is read until the stream has ended
+	if err := stream.Err(); err != nil {
+		t.Fatal(err)
+	}
+	var completions []string
+	for completion := range stream.C {
+		completions = append(completions, completion)
+	}
+	if len(completions) != 1 || completions[0] != "> abc" {
+		t.Errorf("got %q, want only the latest completion", completions)
+	}
+}
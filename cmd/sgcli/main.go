@@ -1,29 +1,252 @@
+// Command sgcli sends single requests to a Sourcegraph instance, to debug the
+// connection to the instance and the prompts of completions without an
+// editor.
+//
+// Usage:
+//
+//	sgcli [-url url] [-token token] <command> [flags]
+//
+// The commands are:
+//
+//	repo-id <name>
+//		print the ID of a repository
+//	embeddings -repo name -query q [-code N] [-text M]
+//		search the embeddings of a repository
+//	complete -file f -line n [-character c] [-prompt]
+//		complete a line of a file, optionally printing the prompt
+//
+// The URL and token default to $SRC_ENDPOINT and $SRC_ACCESS_TOKEN.
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/pjlast/llmsp/claude"
+	"github.com/pjlast/llmsp/internal/documents"
+	"github.com/pjlast/llmsp/internal/position"
+	"github.com/pjlast/llmsp/internal/secrets"
+	"github.com/pjlast/llmsp/internal/tasks"
+	"github.com/pjlast/llmsp/providers"
 	"github.com/pjlast/llmsp/sourcegraph/embeddings"
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/go-lsp"
 )
 
+// envEndpoint is the environment variable the URL of the instance is read
+// from, as in src-cli.
+const envEndpoint = "SRC_ENDPOINT"
+
+// errUsage is returned for invalid command lines, after the usage was
+// printed.
+var errUsage = errors.New("invalid usage")
+
+const usage = `Usage: sgcli [-url url] [-token token] <command> [flags]
+
+Commands:
+  repo-id <name>         print the ID of a repository
+  embeddings             search the embeddings of a repository
+  complete               complete a line of a file, as on autocompletion
+
+Run sgcli <command> -h for the flags of a command.
+
+Flags:
+`
+
 func main() {
-	srcToken := os.Getenv("SRC_TOKEN")
-	srcURL := os.Getenv("SRC_URL")
+	if err := run(context.Background(), os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		if !errors.Is(err, errUsage) {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(1)
+	}
+}
+
+// run runs the command line args, writing results to stdout and usage
+// messages to stderr.
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("sgcli", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	url := flags.String("url", os.Getenv(envEndpoint), "Sourcegraph instance URL (defaults to $"+envEndpoint+")")
+	token := flags.String("token", os.Getenv(secrets.EnvAccessToken), "Sourcegraph access token (defaults to $"+secrets.EnvAccessToken+")")
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errUsage
+	}
+	if *url == "" {
+		*url = "https://sourcegraph.com"
+	}
 
-	buf, err := ioutil.ReadFile("main.go")
+	command, args := flags.Arg(0), flags.Args()[1:]
+	switch command {
+	case "repo-id":
+		return repoID(ctx, embeddings.NewClient(*url, *token, nil), args, stdout, stderr)
+	case "embeddings":
+		return searchEmbeddings(ctx, embeddings.NewClient(*url, *token, nil), args, stdout, stderr)
+	case "complete":
+		return complete(ctx, *url, *token, args, stdout, stderr)
+	}
+	fmt.Fprintf(stderr, "unknown command %q\n", command)
+	flags.Usage()
+	return errUsage
+}
+
+// repoID prints the ID of the repository named by the only argument.
+func repoID(ctx context.Context, client *embeddings.Client, args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("repo-id", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() { fmt.Fprintln(stderr, "Usage: sgcli repo-id <name>") }
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errUsage
+	}
+
+	id, err := client.GetRepoID(ctx, flags.Arg(0))
 	if err != nil {
-		fmt.Println(err)
-		return
+		return err
+	}
+	fmt.Fprintln(stdout, id)
+	return nil
+}
+
+// searchEmbeddings prints the code and text results of an embeddings search.
+func searchEmbeddings(ctx context.Context, client *embeddings.Client, args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("embeddings", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	repo := flags.String("repo", "", "name of the repository to search, e.g. github.com/sourcegraph/sourcegraph")
+	query := flags.String("query", "", "search query")
+	code := flags.Int("code", 8, "number of code results")
+	text := flags.Int("text", 2, "number of text results")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if *repo == "" || *query == "" {
+		fmt.Fprintln(stderr, "-repo and -query are required")
+		flags.PrintDefaults()
+		return errUsage
 	}
 
-	cli := embeddings.NewClient(srcURL, srcToken, nil)
-	embeddingResults, err := cli.GetEmbeddings("UmVwb3NpdG9yeTozOTk=", string(buf), 8, 2)
+	id, err := client.GetRepoID(ctx, *repo)
+	if err != nil {
+		return err
+	}
+	results, err := client.GetEmbeddings(ctx, id, *query, *code, *text)
 	if err != nil {
-		fmt.Println(err)
-		return
+		return err
+	}
+	printResults(stdout, "Code results", results.CodeResults)
+	printResults(stdout, "Text results", results.TextResults)
+	return nil
+}
+
+// printResults prints embeddings results under a title, each one with its
+// file and lines followed by its content.
+func printResults(w io.Writer, title string, results []embeddings.EmbeddingsResult) {
+	fmt.Fprintf(w, "%s (%d):\n", title, len(results))
+	for _, result := range results {
+		fmt.Fprintf(w, "\n%s:%d-%d\n%s\n", result.FileName, result.StartLine, result.EndLine, strings.TrimRight(result.Content, "\n"))
+	}
+	fmt.Fprintln(w)
+}
+
+// complete prints the completion of a line of a file, as requested by
+// editors while typing, and optionally the prompt of the completion.
+func complete(ctx context.Context, url, token string, args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("complete", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	file := flags.String("file", "", "file to complete")
+	line := flags.Int("line", 0, "line to complete, starting at 1")
+	character := flags.Int("character", -1, "character of the line the cursor is on, starting at 0 (defaults to the end of the line)")
+	prompt := flags.Bool("prompt", false, "print the prompt sent to the instance")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if *file == "" || *line < 1 {
+		fmt.Fprintln(stderr, "-file and -line are required")
+		flags.PrintDefaults()
+		return errUsage
+	}
+
+	path, err := filepath.Abs(*file)
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	uri := lsp.DocumentURI("file://" + path)
+	store := documents.NewStore()
+	store.Open(uri, string(content), 1)
+	doc, _ := store.Get(uri)
+	if *line > doc.LineCount() {
+		return fmt.Errorf("%s has %d lines", *file, doc.LineCount())
+	}
+	pos := lsp.Position{Line: *line - 1, Character: *character}
+	if *character < 0 {
+		pos = position.LineEnd(doc.Text, pos.Line)
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	// Background tasks, such as indexing the working directory, are
+	// canceled once the completion is printed
+	group := tasks.NewGroup()
+	defer group.Close(time.Second)
+	provider := &providers.SourcegraphLLM{
+		Documents:     store,
+		WorkspaceRoot: "file://" + cwd,
+		Tasks:         group,
+	}
+	err = provider.Initialize(ctx, types.LLMSPSettings{Sourcegraph: &types.SourcegraphSettings{
+		URL:         url,
+		AccessToken: token,
+		Telemetry:   providers.TelemetryOff,
+	}})
+	if err != nil {
+		return err
+	}
+	if *prompt {
+		preparePrompt := provider.ClaudeClient.OnPrompt
+		provider.ClaudeClient.OnPrompt = func(ctx context.Context, params *claude.CompletionParameters) {
+			preparePrompt(ctx, params)
+			for _, message := range params.Messages {
+				fmt.Fprintf(stdout, "%s: %s\n\n", message.Speaker, message.Text)
+			}
+			fmt.Fprintln(stdout, "---")
+		}
 	}
 
-	fmt.Println("RESULTS", embeddingResults)
+	items, err := provider.GetCompletions(ctx, types.CompletionParams{
+		TextDocumentPositionParams: lsp.TextDocumentPositionParams{
+			TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+			Position:     pos,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		fmt.Fprintln(stdout, item.TextEdit.NewText)
+	}
+	return nil
 }
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pjlast/llmsp/internal/sgtest"
+)
+
+func TestRun(t *testing.T) {
+	// Keep the history of the user out of the test
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	file := filepath.Join(t.TempDir(), "add.go")
+	if err := os.WriteFile(file, []byte("package add\n\nfunc add(a, b int) int {\n\treturn\n}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	instance := sgtest.NewInstance(t, "return a + b")
+
+	tests := []struct {
+		name string
+		args []string
+		want []string
+		err  string
+	}{
+		{"repo-id", []string{"repo-id", sgtest.Repository}, []string{sgtest.RepositoryID + "\n"}, ""},
+		{"unknown repository", []string{"repo-id", "github.com/unknown/unknown"}, nil, "not found"},
+		{"embeddings", []string{"embeddings", "-repo", sgtest.Repository, "-query", "main"}, []string{"Code results (1):", "main.go:1-3\nfunc main() {}\n", "Text results (0):"}, ""},
+		{"complete", []string{"complete", "-file", file, "-line", "4"}, []string{"return a + b\n"}, ""},
+		{"complete with prompt", []string{"complete", "-file", file, "-line", "4", "-prompt"}, []string{"HUMAN: ", "---\n", "return a + b\n"}, ""},
+	}
+	for _, test := range tests {
+		var stdout, stderr bytes.Buffer
+		err := run(context.Background(), append([]string{"-url", instance.URL, "-token", "token"}, test.args...), &stdout, &stderr)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		for _, want := range test.want {
+			if !strings.Contains(stdout.String(), want) {
+				t.Errorf("%s: output %q doesn't contain %q", test.name, stdout.String(), want)
+			}
+		}
+	}
+}
+
+func TestRunUsage(t *testing.T) {
+	tests := [][]string{
+		nil,
+		{"unknown"},
+		{"repo-id"},
+		{"embeddings", "-repo", sgtest.Repository},
+		{"complete", "-file", "main.go"},
+	}
+	for _, args := range tests {
+		var stdout, stderr bytes.Buffer
+		if err := run(context.Background(), args, &stdout, &stderr); !errors.Is(err, errUsage) {
+			t.Errorf("run(%q) returned %v, want a usage error", args, err)
+		}
+		if stderr.Len() == 0 {
+			t.Errorf("run(%q) printed no usage", args)
+		}
+	}
+}
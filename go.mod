@@ -3,8 +3,11 @@ module github.com/pjlast/llmsp
 go 1.20
 
 require (
+	github.com/go-enry/go-enry/v2 v2.9.6
 	github.com/sourcegraph/go-lsp v0.0.0-20200429204803-219e11d77f5d
 	github.com/sourcegraph/jsonrpc2 v0.2.0
 )
 
-require github.com/google/uuid v1.3.0 // indirect
+require github.com/google/uuid v1.3.0
+
+require github.com/go-enry/go-oniguruma v1.2.1 // indirect
@@ -0,0 +1,185 @@
+// Package config loads the settings of the server from config files.
+//
+// Config files have the same schema as the "llmsp" section of the settings
+// sent by the editor. There is a file per user and one per workspace, and
+// settings are merged field by field, so that e.g. the access token can be
+// kept in the user's config file while the editor configures the rest.
+//
+// Workspace config files come with the repositories they are in, so unless
+// the user trusts the workspace they may only set the settings that can't be
+// used to run commands or to send the access token elsewhere, see Restrict.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pjlast/llmsp/types"
+)
+
+// WorkspaceFile is the name of the config file in the root of a workspace.
+const WorkspaceFile = ".llmsp.json"
+
+// UserPath returns the path of the user's config file, e.g.
+// ~/.config/llmsp/config.json on Linux. It returns "" if the user's config
+// directory is unknown.
+func UserPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "llmsp", "config.json")
+}
+
+// WorkspacePath returns the path of the config file of the workspace rooted
+// at root.
+func WorkspacePath(root string) string {
+	return filepath.Join(root, WorkspaceFile)
+}
+
+// workspaceSettings are the settings an untrusted workspace config file may
+// set. A key maps to true if all of its settings are allowed, or to the
+// allowed settings of its object. The URL of the instance, the token and the
+// commands and keychain entries providing it, the proxy and TLS settings,
+// hooks, logging and the Go integration are left out: they could run
+// commands, write files or send the token to another host.
+var workspaceSettings = map[string]any{
+	"prompts":  true,
+	"sampling": true,
+	"sourcegraph": map[string]any{
+		"chatModel":           true,
+		"completionModel":     true,
+		"editModel":           true,
+		"chatMaxTokens":       true,
+		"completionMaxTokens": true,
+		"editMaxTokens":       true,
+		"timeouts":            true,
+		"contextIgnore":       true,
+		"contextTokens":       true,
+		"contextLinesAbove":   true,
+		"contextLinesBelow":   true,
+		"previewEdits":        true,
+	},
+}
+
+// Restrict returns the settings of an untrusted workspace config file that it
+// may set, along with the names of the settings it drops, e.g.
+// "sourcegraph.url".
+func Restrict(layer json.RawMessage) (json.RawMessage, []string, error) {
+	if len(layer) == 0 {
+		return layer, nil, nil
+	}
+	var value any
+	if err := json.Unmarshal(layer, &value); err != nil {
+		return nil, nil, err
+	}
+	object, ok := value.(map[string]any)
+	if !ok {
+		return nil, nil, nil
+	}
+	var dropped []string
+	restrict(object, workspaceSettings, "", &dropped)
+	sort.Strings(dropped)
+	data, err := json.Marshal(object)
+	return data, dropped, err
+}
+
+// restrict deletes the keys of object that aren't allowed, appending their
+// names to dropped.
+func restrict(object map[string]any, allowed map[string]any, prefix string, dropped *[]string) {
+	for key, value := range object {
+		switch allow := allowed[key].(type) {
+		case bool:
+			continue
+		case map[string]any:
+			if child, ok := value.(map[string]any); ok {
+				restrict(child, allow, prefix+key+".", dropped)
+				continue
+			}
+		}
+		delete(object, key)
+		*dropped = append(*dropped, prefix+key)
+	}
+}
+
+// Trusted reports whether the workspace rooted at root is one of the trusted
+// workspaces, whose config files may set any setting.
+func Trusted(trusted []string, root string) bool {
+	for _, path := range trusted {
+		if path != "" && filepath.Clean(path) == filepath.Clean(root) {
+			return true
+		}
+	}
+	return false
+}
+
+// Load reads a config file. A file that doesn't exist is empty.
+func Load(path string) (json.RawMessage, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var settings map[string]any
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return data, nil
+}
+
+// Merge merges settings in order of increasing precedence and decodes the
+// result. Objects are merged field by field, any other value replaces the
+// previous one. Empty and null settings are skipped.
+func Merge(layers ...json.RawMessage) (types.LLMSPSettings, error) {
+	var merged any
+	for _, layer := range layers {
+		if len(layer) == 0 {
+			continue
+		}
+		var value any
+		if err := json.Unmarshal(layer, &value); err != nil {
+			return types.LLMSPSettings{}, err
+		}
+		if value != nil {
+			merged = merge(merged, value)
+		}
+	}
+
+	var settings types.LLMSPSettings
+	if merged == nil {
+		return settings, nil
+	}
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return settings, err
+	}
+	err = json.Unmarshal(data, &settings)
+	return settings, err
+}
+
+func merge(base, override any) any {
+	baseObject, ok := base.(map[string]any)
+	if !ok {
+		return override
+	}
+	overrideObject, ok := override.(map[string]any)
+	if !ok {
+		return override
+	}
+	for key, value := range overrideObject {
+		if value == nil {
+			continue
+		}
+		baseObject[key] = merge(baseObject[key], value)
+	}
+	return baseObject
+}
@@ -0,0 +1,148 @@
+// Package diagnostics tracks the diagnostics llmsp publishes, such as
+// suggestions and annotations of terminal output.
+//
+// Clients replace all diagnostics of a document whenever diagnostics are
+// published for it, so a Manager keeps the diagnostics of every owner, the
+// command that produced them, and always publishes all of them together. This
+// lets owners replace or clear their diagnostics without clobbering those of
+// other owners, and lets the server clear stale diagnostics when documents
+// change.
+package diagnostics
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/sourcegraph/go-lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// Manager tracks the published diagnostics per document and owner. The zero
+// value is ready to use, and a nil *Manager publishes diagnostics without
+// tracking them.
+type Manager struct {
+	mu        sync.Mutex
+	published map[lsp.DocumentURI]map[string][]lsp.Diagnostic
+}
+
+// NewManager returns a manager that hasn't published anything yet.
+func NewManager() *Manager {
+	return &Manager{}
+}
+
+// Publish replaces the diagnostics of owner for the document and publishes
+// the diagnostics of all owners. Nothing is sent if the diagnostics didn't
+// change, e.g. while a response is streamed.
+func (m *Manager) Publish(ctx context.Context, conn jsonrpc2.JSONRPC2, uri lsp.DocumentURI, owner string, diagnostics []lsp.Diagnostic) error {
+	if m == nil {
+		return notify(ctx, conn, uri, diagnostics)
+	}
+
+	m.mu.Lock()
+	owners := m.published[uri]
+	if reflect.DeepEqual(owners[owner], diagnostics) || (len(owners[owner]) == 0 && len(diagnostics) == 0) {
+		m.mu.Unlock()
+		return nil
+	}
+	if m.published == nil {
+		m.published = make(map[lsp.DocumentURI]map[string][]lsp.Diagnostic)
+	}
+	if owners == nil {
+		owners = make(map[string][]lsp.Diagnostic)
+		m.published[uri] = owners
+	}
+	if len(diagnostics) == 0 {
+		delete(owners, owner)
+		if len(owners) == 0 {
+			delete(m.published, uri)
+		}
+	} else {
+		owners[owner] = append([]lsp.Diagnostic(nil), diagnostics...)
+	}
+	all := m.all(uri)
+	m.mu.Unlock()
+
+	return notify(ctx, conn, uri, all)
+}
+
+// Clear clears the diagnostics of all owners for the document, if there are
+// any.
+func (m *Manager) Clear(ctx context.Context, conn jsonrpc2.JSONRPC2, uri lsp.DocumentURI) error {
+	if m == nil {
+		return nil
+	}
+
+	m.mu.Lock()
+	_, ok := m.published[uri]
+	delete(m.published, uri)
+	m.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return notify(ctx, conn, uri, nil)
+}
+
+// ClearOwner clears the diagnostics of owner for all documents.
+func (m *Manager) ClearOwner(ctx context.Context, conn jsonrpc2.JSONRPC2, owner string) error {
+	if m == nil {
+		return nil
+	}
+
+	m.mu.Lock()
+	var uris []lsp.DocumentURI
+	for uri, owners := range m.published {
+		if _, ok := owners[owner]; ok {
+			uris = append(uris, uri)
+		}
+	}
+	m.mu.Unlock()
+
+	sort.Slice(uris, func(i, j int) bool { return uris[i] < uris[j] })
+	for _, uri := range uris {
+		if err := m.Publish(ctx, conn, uri, owner, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Published returns the diagnostics of all owners for the document.
+func (m *Manager) Published(uri lsp.DocumentURI) []lsp.Diagnostic {
+	if m == nil {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.all(uri)
+}
+
+// all returns the diagnostics of all owners for the document, ordered by
+// owner. m.mu must be held.
+func (m *Manager) all(uri lsp.DocumentURI) []lsp.Diagnostic {
+	owners := make([]string, 0, len(m.published[uri]))
+	for owner := range m.published[uri] {
+		owners = append(owners, owner)
+	}
+	sort.Strings(owners)
+
+	var all []lsp.Diagnostic
+	for _, owner := range owners {
+		all = append(all, m.published[uri][owner]...)
+	}
+	return all
+}
+
+// notify publishes the diagnostics of the document. An empty list clears
+// them.
+func notify(ctx context.Context, conn jsonrpc2.JSONRPC2, uri lsp.DocumentURI, diagnostics []lsp.Diagnostic) error {
+	if diagnostics == nil {
+		diagnostics = []lsp.Diagnostic{}
+	}
+	return conn.Notify(ctx, "textDocument/publishDiagnostics", lsp.PublishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: diagnostics,
+	})
+}
@@ -0,0 +1,79 @@
+package diagnostics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sourcegraph/go-lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// recorder records the diagnostics published to it.
+type recorder struct {
+	jsonrpc2.JSONRPC2
+	published []lsp.PublishDiagnosticsParams
+}
+
+func (r *recorder) Notify(_ context.Context, method string, params any, _ ...jsonrpc2.CallOption) error {
+	r.published = append(r.published, params.(lsp.PublishDiagnosticsParams))
+	return nil
+}
+
+// messages returns the messages of the diagnostics published last.
+func (r *recorder) messages() []string {
+	var messages []string
+	for _, diagnostic := range r.published[len(r.published)-1].Diagnostics {
+		messages = append(messages, diagnostic.Message)
+	}
+	return messages
+}
+
+func diagnostic(message string) lsp.Diagnostic {
+	return lsp.Diagnostic{Message: message}
+}
+
+func TestManager(t *testing.T) {
+	ctx := context.Background()
+	conn := &recorder{}
+	m := NewManager()
+	const uri = lsp.DocumentURI("file:///main.go")
+
+	m.Publish(ctx, conn, uri, "suggest", []lsp.Diagnostic{diagnostic("a")})
+	m.Publish(ctx, conn, uri, "suggest", []lsp.Diagnostic{diagnostic("a")})
+	if len(conn.published) != 1 {
+		t.Errorf("got %d notifications, want unchanged diagnostics to be published once", len(conn.published))
+	}
+
+	m.Publish(ctx, conn, uri, "output", []lsp.Diagnostic{diagnostic("b")})
+	if got := conn.messages(); len(got) != 2 || got[0] != "b" || got[1] != "a" {
+		t.Errorf("got %q, want the diagnostics of both owners", got)
+	}
+
+	m.ClearOwner(ctx, conn, "suggest")
+	if got := conn.messages(); len(got) != 1 || got[0] != "b" {
+		t.Errorf("got %q, want the diagnostics of the other owner", got)
+	}
+
+	m.Clear(ctx, conn, uri)
+	if got := conn.messages(); len(got) != 0 || conn.published[len(conn.published)-1].Diagnostics == nil {
+		t.Errorf("got %q, want an empty list", got)
+	}
+	notifications := len(conn.published)
+	m.Clear(ctx, conn, uri)
+	m.Clear(ctx, conn, "file:///other.go")
+	if len(conn.published) != notifications {
+		t.Error("got notifications clearing documents without diagnostics")
+	}
+}
+
+func TestNilManager(t *testing.T) {
+	conn := &recorder{}
+	var m *Manager
+	m.Publish(context.Background(), conn, "file:///main.go", "suggest", []lsp.Diagnostic{diagnostic("a")})
+	if len(conn.published) != 1 {
+		t.Error("a nil manager should publish diagnostics")
+	}
+	if err := m.Clear(context.Background(), conn, "file:///main.go"); err != nil || m.Published("file:///main.go") != nil {
+		t.Error("a nil manager should track nothing")
+	}
+}
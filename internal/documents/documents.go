@@ -0,0 +1,320 @@
+// Package documents stores the documents opened by the client.
+//
+// The store is shared by the server, which applies the changes sent by the
+// client, and the provider, which reads documents while handling requests
+// concurrently. Reads return immutable snapshots, and every document has its
+// own lock, so changes to one document never wait for another.
+package documents
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/go-lsp"
+)
+
+var (
+	// ErrNotOpen is returned for documents the client hasn't opened.
+	ErrNotOpen = errors.New("document is not open")
+	// ErrLineOutOfRange is returned for lines outside of a document.
+	ErrLineOutOfRange = errors.New("line out of range")
+)
+
+// Document is a snapshot of a document.
+type Document struct {
+	URI     lsp.DocumentURI
+	Text    string
+	Version int
+	// Saved is set if the text is the saved contents of the document
+	Saved bool
+	// Touched is when the document was last opened or changed
+	Touched time.Time
+	// lineStarts contains the byte offset of the start of every line
+	lineStarts []int
+}
+
+func newDocument(uri lsp.DocumentURI, text string, version int) Document {
+	lineStarts := []int{0}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+	return Document{URI: uri, Text: text, Version: version, Touched: time.Now(), lineStarts: lineStarts}
+}
+
+// LineCount returns the number of lines in the document. A document ending
+// with a newline has an empty last line.
+func (d Document) LineCount() int {
+	if d.lineStarts == nil {
+		return 1
+	}
+	return len(d.lineStarts)
+}
+
+// Line returns line n without its line ending, or "" if there is no such
+// line.
+func (d Document) Line(n int) string {
+	if d.lineStarts == nil || n < 0 || n >= len(d.lineStarts) {
+		return ""
+	}
+	end := len(d.Text)
+	if n+1 < len(d.lineStarts) {
+		end = d.lineStarts[n+1] - 1
+	}
+	return strings.TrimSuffix(d.Text[d.lineStarts[n]:end], "\r")
+}
+
+// Lines returns lines start through end of the document, joined by newlines.
+// An end past the last line is clamped to it, as editors may send ranges
+// ending after the end of the document. It returns an error wrapping
+// ErrLineOutOfRange if start isn't a line of the document or end precedes
+// it.
+func (d Document) Lines(start, end int) (string, error) {
+	last := d.LineCount() - 1
+	if start < 0 || start > last || end < start {
+		return "", fmt.Errorf("%w: lines %d to %d of %s, which has %d lines", ErrLineOutOfRange, start+1, end+1, d.URI, last+1)
+	}
+	if end > last {
+		end = last
+	}
+	to := len(d.Text)
+	if end < last {
+		to = d.lineStarts[end+1] - 1
+	}
+	return d.Text[d.LineOffset(start):to], nil
+}
+
+// LineOffset returns the byte offset of the start of line n, clamped to the
+// bounds of the document.
+func (d Document) LineOffset(n int) int {
+	switch {
+	case d.lineStarts == nil || n < 0:
+		return 0
+	case n >= len(d.lineStarts):
+		return len(d.Text)
+	}
+	return d.lineStarts[n]
+}
+
+// maxHistory is the number of previous versions kept for every document.
+const maxHistory = 16
+
+// entry holds a document and the lock serializing changes to it.
+type entry struct {
+	mu  sync.Mutex
+	doc Document
+	// history contains the last snapshot of previous versions of the
+	// document, oldest first
+	history []Document
+	// edits are the recent edits of the document, oldest first
+	edits []Edit
+}
+
+// set replaces the document, keeping the previous snapshot if its version
+// changes.
+func (e *entry) set(doc Document) {
+	if doc.Version != e.doc.Version {
+		e.history = append(e.history, e.doc)
+		if len(e.history) > maxHistory {
+			e.history = e.history[len(e.history)-maxHistory:]
+		}
+	}
+	e.doc = doc
+}
+
+// Store is a concurrency-safe collection of documents.
+type Store struct {
+	mu      sync.RWMutex
+	entries map[lsp.DocumentURI]*entry
+}
+
+// NewStore returns an empty store.
+func NewStore() *Store {
+	return &Store{entries: make(map[lsp.DocumentURI]*entry)}
+}
+
+// FromMap returns a store containing the given documents at version 0.
+func FromMap(files types.MemoryFileMap) *Store {
+	s := NewStore()
+	for uri, text := range files {
+		s.Open(uri, text, 0)
+	}
+	return s
+}
+
+// entry returns the entry of the document, creating it if create is set.
+func (s *Store) entry(uri lsp.DocumentURI, create bool) *entry {
+	s.mu.RLock()
+	e, ok := s.entries[uri]
+	s.mu.RUnlock()
+	if ok || !create {
+		return e
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[uri]; ok {
+		return e
+	}
+	e = &entry{doc: newDocument(uri, "", 0)}
+	s.entries[uri] = e
+	return e
+}
+
+// Open sets the text and version of a document, adding it if necessary.
+// Opened documents are assumed to be saved.
+func (s *Store) Open(uri lsp.DocumentURI, text string, version int) {
+	e := s.entry(uri, true)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	doc := newDocument(uri, text, version)
+	doc.Saved = true
+	e.set(doc)
+}
+
+// Change replaces the text of a document with the result of apply, and sets
+// its version. Changes to the same document are serialized. If apply fails,
+// the document is left unchanged, otherwise it is no longer considered saved
+// and the change is recorded in its recent edits.
+func (s *Store) Change(uri lsp.DocumentURI, version int, apply func(text string) (string, error)) error {
+	e := s.entry(uri, true)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	text, err := apply(e.doc.Text)
+	if err != nil {
+		return err
+	}
+	e.record(e.doc.Text, text)
+	e.set(newDocument(uri, text, version))
+	return nil
+}
+
+// Edit is like Change, but keeps the version of the document.
+func (s *Store) Edit(uri lsp.DocumentURI, apply func(text string) (string, error)) error {
+	e := s.entry(uri, true)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	text, err := apply(e.doc.Text)
+	if err != nil {
+		return err
+	}
+	e.record(e.doc.Text, text)
+	e.doc = newDocument(uri, text, e.doc.Version)
+	return nil
+}
+
+// Save marks the current text of an open document as saved.
+func (s *Store) Save(uri lsp.DocumentURI) {
+	e := s.entry(uri, false)
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.doc.Saved = true
+}
+
+// Close removes a document.
+func (s *Store) Close(uri lsp.DocumentURI) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, uri)
+}
+
+// Get returns a snapshot of a document.
+func (s *Store) Get(uri lsp.DocumentURI) (Document, bool) {
+	if s == nil {
+		return Document{}, false
+	}
+	e := s.entry(uri, false)
+	if e == nil {
+		return Document{}, false
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.doc, true
+}
+
+// Snapshot returns the snapshot of the given version of a document, if it
+// is the current version or one of the last few versions.
+func (s *Store) Snapshot(uri lsp.DocumentURI, version int) (Document, bool) {
+	if s == nil {
+		return Document{}, false
+	}
+	e := s.entry(uri, false)
+	if e == nil {
+		return Document{}, false
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.doc.Version == version {
+		return e.doc, true
+	}
+	for i := len(e.history) - 1; i >= 0; i-- {
+		if e.history[i].Version == version {
+			return e.history[i], true
+		}
+	}
+	return Document{}, false
+}
+
+// Versions returns the current version of every document.
+func (s *Store) Versions() map[lsp.DocumentURI]int {
+	versions := make(map[lsp.DocumentURI]int)
+	for _, doc := range s.All() {
+		versions[doc.URI] = doc.Version
+	}
+	return versions
+}
+
+// Text returns the text of a document, or "" if it isn't open.
+func (s *Store) Text(uri lsp.DocumentURI) string {
+	doc, _ := s.Get(uri)
+	return doc.Text
+}
+
+// Lookup returns a snapshot of a document, or an error wrapping ErrNotOpen
+// if it isn't open.
+func (s *Store) Lookup(uri lsp.DocumentURI) (Document, error) {
+	doc, ok := s.Get(uri)
+	if !ok {
+		return Document{}, fmt.Errorf("%w: %s", ErrNotOpen, uri)
+	}
+	return doc, nil
+}
+
+// Version returns the version of a document, or 0 if it isn't open.
+func (s *Store) Version(uri lsp.DocumentURI) int {
+	doc, _ := s.Get(uri)
+	return doc.Version
+}
+
+// All returns snapshots of all documents, sorted by URI.
+func (s *Store) All() []Document {
+	if s == nil {
+		return nil
+	}
+	s.mu.RLock()
+	entries := make([]*entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		entries = append(entries, e)
+	}
+	s.mu.RUnlock()
+
+	docs := make([]Document, 0, len(entries))
+	for _, e := range entries {
+		e.mu.Lock()
+		docs = append(docs, e.doc)
+		e.mu.Unlock()
+	}
+	sort.Slice(docs, func(i, j int) bool {
+		return docs[i].URI < docs[j].URI
+	})
+	return docs
+}
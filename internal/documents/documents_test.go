@@ -0,0 +1,162 @@
+package documents
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/sourcegraph/go-lsp"
+)
+
+func TestDocumentLines(t *testing.T) {
+	doc := newDocument("file:///a.go", "package a\r\n\nfunc A() {}\n", 1)
+	if got := doc.LineCount(); got != 4 {
+		t.Errorf("LineCount() == %d, want 4", got)
+	}
+	tests := []struct {
+		line   int
+		want   string
+		offset int
+	}{
+		{0, "package a", 0},
+		{1, "", 11},
+		{2, "func A() {}", 12},
+		{3, "", 24},
+		{4, "", 24},
+		{-1, "", 0},
+	}
+	for _, test := range tests {
+		if got := doc.Line(test.line); got != test.want {
+			t.Errorf("Line(%d) == %q, want %q", test.line, got, test.want)
+		}
+		if got := doc.LineOffset(test.line); got != test.offset {
+			t.Errorf("LineOffset(%d) == %d, want %d", test.line, got, test.offset)
+		}
+	}
+
+	var empty Document
+	if empty.LineCount() != 1 || empty.Line(0) != "" {
+		t.Errorf("zero Document has %d lines, want a single empty line", empty.LineCount())
+	}
+}
+
+func TestDocumentLinesRange(t *testing.T) {
+	doc := newDocument("file:///a.go", "package a\n\nfunc A() {}\n", 1)
+	for _, test := range []struct {
+		start, end int
+		want       string
+	}{
+		{0, 0, "package a"},
+		{0, 2, "package a\n\nfunc A() {}"},
+		{2, 3, "func A() {}\n"},
+		// Ends past the end of the document are clamped
+		{2, 100, "func A() {}\n"},
+	} {
+		got, err := doc.Lines(test.start, test.end)
+		if err != nil || got != test.want {
+			t.Errorf("Lines(%d, %d) == %q, %v, want %q", test.start, test.end, got, err, test.want)
+		}
+	}
+
+	for _, lines := range [][2]int{{4, 4}, {-1, 0}, {2, 1}} {
+		if _, err := doc.Lines(lines[0], lines[1]); !errors.Is(err, ErrLineOutOfRange) {
+			t.Errorf("Lines(%d, %d) returned %v, want ErrLineOutOfRange", lines[0], lines[1], err)
+		}
+	}
+}
+
+func TestStore(t *testing.T) {
+	uri := lsp.DocumentURI("file:///a.go")
+	s := NewStore()
+	if _, ok := s.Get(uri); ok {
+		t.Fatal("Get() found a document in an empty store")
+	}
+
+	s.Open(uri, "one", 1)
+	if err := s.Change(uri, 2, func(text string) (string, error) { return text + " two", nil }); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Change(uri, 3, func(string) (string, error) { return "", errors.New("invalid change") }); err == nil {
+		t.Error("Change() with a failing change succeeded, want an error")
+	}
+	if doc, _ := s.Get(uri); doc.Text != "one two" || doc.Version != 2 {
+		t.Errorf("Get() == (%q, %d), want (%q, 2)", doc.Text, doc.Version, "one two")
+	}
+
+	if err := s.Edit(uri, func(text string) (string, error) { return text + " three", nil }); err != nil {
+		t.Fatal(err)
+	}
+	if s.Text(uri) != "one two three" || s.Version(uri) != 2 {
+		t.Errorf("document is (%q, %d), want (%q, 2)", s.Text(uri), s.Version(uri), "one two three")
+	}
+
+	s.Open("file:///0.go", "", 0)
+	if all := s.All(); len(all) != 2 || all[0].URI != "file:///0.go" {
+		t.Errorf("All() == %+v, want both documents sorted by URI", all)
+	}
+	s.Close(uri)
+	if _, ok := s.Get(uri); ok {
+		t.Error("Get() found a closed document")
+	}
+	if _, err := s.Lookup(uri); !errors.Is(err, ErrNotOpen) {
+		t.Errorf("Lookup() of a closed document returned %v, want ErrNotOpen", err)
+	}
+
+	var nilStore *Store
+	if nilStore.Text(uri) != "" || len(nilStore.All()) != 0 {
+		t.Error("nil store isn't empty")
+	}
+}
+
+func TestStoreConcurrentChanges(t *testing.T) {
+	s := NewStore()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		uri := lsp.DocumentURI(fmt.Sprintf("file:///%d.go", i))
+		for j := 0; j < 50; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_ = s.Edit(uri, func(text string) (string, error) { return text + "x", nil })
+				s.All()
+			}()
+		}
+	}
+	wg.Wait()
+
+	for _, doc := range s.All() {
+		if len(doc.Text) != 50 {
+			t.Errorf("%s has %d changes, want 50", doc.URI, len(doc.Text))
+		}
+	}
+}
+
+func TestStoreSnapshot(t *testing.T) {
+	uri := lsp.DocumentURI("file:///a.go")
+	s := NewStore()
+	s.Open(uri, "v1", 1)
+	for version := 2; version <= maxHistory+2; version++ {
+		text := fmt.Sprintf("v%d", version)
+		_ = s.Change(uri, version, func(string) (string, error) { return text, nil })
+	}
+
+	tests := []struct {
+		version int
+		want    string
+		ok      bool
+	}{
+		{maxHistory + 2, fmt.Sprintf("v%d", maxHistory+2), true},
+		{2, "v2", true},
+		{1, "", false},
+	}
+	for _, test := range tests {
+		doc, ok := s.Snapshot(uri, test.version)
+		if doc.Text != test.want || ok != test.ok {
+			t.Errorf("Snapshot(%d) == (%q, %v), want (%q, %v)", test.version, doc.Text, ok, test.want, test.ok)
+		}
+	}
+	if versions := s.Versions(); versions[uri] != maxHistory+2 {
+		t.Errorf("Versions() == %v, want %s at version %d", versions, uri, maxHistory+2)
+	}
+}
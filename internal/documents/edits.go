@@ -0,0 +1,107 @@
+package documents
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sourcegraph/go-lsp"
+)
+
+// maxEdits is the number of recent edits kept for every document.
+const maxEdits = 8
+
+// Edit is a change made to a document, as the lines it replaced and the
+// lines replacing them.
+type Edit struct {
+	URI lsp.DocumentURI
+	// Line is the first changed line in the edited document
+	Line int
+	// Removed and Added are the replaced and the new lines
+	Removed, Added []string
+	// Time is when the document was last changed by the edit
+	Time time.Time
+}
+
+// diffEdit returns the edit turning before into after, the lines between
+// their common prefix and suffix, and false if they are the same.
+func diffEdit(uri lsp.DocumentURI, before, after string) (Edit, bool) {
+	if before == after {
+		return Edit{}, false
+	}
+	a, b := strings.Split(before, "\n"), strings.Split(after, "\n")
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	return Edit{
+		URI:     uri,
+		Line:    prefix,
+		Removed: a[prefix : len(a)-suffix],
+		Added:   b[prefix : len(b)-suffix],
+		Time:    time.Now(),
+	}, true
+}
+
+// record adds the edit turning before into after to the recent edits.
+// Edits within the lines added by the previous edit, such as typing on the
+// same line, are merged into it, and edits undoing the previous one remove
+// it.
+func (e *entry) record(before, after string) {
+	edit, ok := diffEdit(e.doc.URI, before, after)
+	if !ok {
+		return
+	}
+
+	if n := len(e.edits); n > 0 {
+		last := e.edits[n-1]
+		if edit.Line >= last.Line && edit.Line+len(edit.Removed) <= last.Line+len(last.Added) {
+			lines := strings.Split(after, "\n")
+			end := last.Line + len(last.Added) + len(edit.Added) - len(edit.Removed)
+			last.Added = append([]string(nil), lines[last.Line:end]...)
+			last.Time = edit.Time
+			if strings.Join(last.Added, "\n") == strings.Join(last.Removed, "\n") {
+				e.edits = e.edits[:n-1]
+			} else {
+				e.edits[n-1] = last
+			}
+			return
+		}
+	}
+
+	e.edits = append(e.edits, edit)
+	if len(e.edits) > maxEdits {
+		e.edits = e.edits[len(e.edits)-maxEdits:]
+	}
+}
+
+// RecentEdits returns the recent edits of all documents, oldest first.
+func (s *Store) RecentEdits() []Edit {
+	if s == nil {
+		return nil
+	}
+	s.mu.RLock()
+	entries := make([]*entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		entries = append(entries, e)
+	}
+	s.mu.RUnlock()
+
+	var edits []Edit
+	for _, e := range entries {
+		e.mu.Lock()
+		edits = append(edits, e.edits...)
+		e.mu.Unlock()
+	}
+	sort.SliceStable(edits, func(i, j int) bool {
+		if !edits[i].Time.Equal(edits[j].Time) {
+			return edits[i].Time.Before(edits[j].Time)
+		}
+		return edits[i].URI < edits[j].URI
+	})
+	return edits
+}
@@ -0,0 +1,70 @@
+package documents
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sourcegraph/go-lsp"
+)
+
+func TestDiffEdit(t *testing.T) {
+	tests := []struct {
+		before, after  string
+		line           int
+		removed, added []string
+	}{
+		{"a\nb\nc", "a\nB\nc", 1, []string{"b"}, []string{"B"}},
+		{"a\nc", "a\nb\nc", 1, []string{}, []string{"b"}},
+		{"a\nb\nc", "a\nc", 1, []string{"b"}, []string{}},
+		{"a", "a\nb", 1, []string{}, []string{"b"}},
+		{"", "a", 0, []string{""}, []string{"a"}},
+	}
+	for _, test := range tests {
+		edit, ok := diffEdit("file:///a.go", test.before, test.after)
+		if !ok || edit.Line != test.line || !reflect.DeepEqual(edit.Removed, test.removed) || !reflect.DeepEqual(edit.Added, test.added) {
+			t.Errorf("diffEdit(%q, %q) == (line %d, %q, %q, %v), want (line %d, %q, %q, true)",
+				test.before, test.after, edit.Line, edit.Removed, edit.Added, ok, test.line, test.removed, test.added)
+		}
+	}
+	if _, ok := diffEdit("file:///a.go", "a", "a"); ok {
+		t.Error("diffEdit() found an edit between identical texts")
+	}
+}
+
+func TestRecentEdits(t *testing.T) {
+	a, b := lsp.DocumentURI("file:///a.go"), lsp.DocumentURI("file:///b.go")
+	s := NewStore()
+	s.Open(a, "package a\n\nfunc A() {}\n", 1)
+	s.Open(b, "package b\n", 1)
+
+	set := func(uri lsp.DocumentURI, text string) {
+		if err := s.Change(uri, s.Version(uri)+1, func(string) (string, error) { return text, nil }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Typing on a line is a single edit
+	set(a, "package a\n\nfunc A() { r }\n")
+	set(a, "package a\n\nfunc A() { return }\n")
+	set(b, "package b\n\nvar B = 1\n")
+	// Undoing an edit forgets it
+	set(b, "package b\n\nvar B = 2\n")
+	set(b, "package b\n\nvar B = 1\n")
+
+	var got []string
+	for _, edit := range s.RecentEdits() {
+		got = append(got, string(edit.URI)+":"+strings.Join(edit.Removed, "|")+">"+strings.Join(edit.Added, "|"))
+	}
+	want := []string{
+		"file:///a.go:func A() {}>func A() { return }",
+		"file:///b.go:>var B = 1|",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("RecentEdits() == %q, want %q", got, want)
+	}
+
+	s.Close(a)
+	if edits := s.RecentEdits(); len(edits) != 1 || edits[0].URI != b {
+		t.Errorf("RecentEdits() after closing %s == %+v, want only the edit of %s", a, edits, b)
+	}
+}
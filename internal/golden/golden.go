@@ -0,0 +1,52 @@
+// Package golden compares the output of tests, such as the prompts sent for
+// a request, with the expected output checked in as golden files.
+//
+// With LLMSP_UPDATE_GOLDEN=1, the golden files are rewritten with the output
+// instead, so that changes to the output can be reviewed in the diff.
+package golden
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// EnvUpdate is the environment variable that rewrites the golden files.
+const EnvUpdate = "LLMSP_UPDATE_GOLDEN"
+
+// Assert fails the test if got differs from the golden file
+// testdata/<name>.golden.
+func Assert(t testing.TB, name string, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if os.Getenv(EnvUpdate) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading golden file: %v (write it with %s=1)", err, EnvUpdate)
+	}
+	if want := string(data); got != want {
+		t.Errorf("output differs from %s at line %d (update it with %s=1)\ngot:\n%s\nwant:\n%s", path, firstDifference(got, want), EnvUpdate, got, want)
+	}
+}
+
+// firstDifference returns the number of the first line, starting at 1, that
+// differs between a and b.
+func firstDifference(a, b string) int {
+	linesA, linesB := strings.Split(a, "\n"), strings.Split(b, "\n")
+	for i := range linesA {
+		if i >= len(linesB) || linesA[i] != linesB[i] {
+			return i + 1
+		}
+	}
+	return len(linesA) + 1
+}
@@ -0,0 +1,24 @@
+package golden
+
+import "testing"
+
+func TestAssert(t *testing.T) {
+	Assert(t, "hello", "HUMAN:\nhello\n")
+}
+
+func TestFirstDifference(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"a\nb\nc", "a\nx\nc", 2},
+		{"a\nb", "a\nb\nc", 3},
+		{"a\nb\nc", "a\nb", 3},
+		{"a", "b", 1},
+	}
+	for _, test := range tests {
+		if got := firstDifference(test.a, test.b); got != test.want {
+			t.Errorf("firstDifference(%q, %q) == %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+// Package headless runs the commands of the server without an editor, for
+// scripts, git hooks and CI jobs.
+//
+// A request names a command, a file and a range, as an editor would on a
+// code action. The server is run in-process and driven over JSON-RPC, so that
+// the command goes through the same settings, hooks and provider as in an
+// editor. Edits are previewed rather than applied: the result holds the new
+// text of the changed files and a unified diff of the changes, and the files
+// on disk are left alone.
+package headless
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/go-lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// Formats of the output.
+const (
+	FormatJSON = "json"
+	FormatDiff = "diff"
+)
+
+// Request is a command to run, as read from stdin by llmsp exec.
+type Request struct {
+	// Command is the name of the command, e.g. docstring or cody.test
+	Command string `json:"command"`
+	// File is the path of the file the command runs on, relative to the
+	// working directory
+	File string `json:"file"`
+	// Range is the part of the file the command runs on, with lines
+	// starting at 0 as in LSP
+	Range lsp.Range `json:"range"`
+	// Instruction is the instruction of the commands that take one, such as
+	// cody.edit, or the target language of cody.translate
+	Instruction string `json:"instruction,omitempty"`
+	// Format is the format of the output, json or diff. It defaults to json.
+	Format string `json:"format,omitempty"`
+}
+
+// Result is the outcome of a command.
+type Result struct {
+	Command string `json:"command"`
+	// Documents are the files changed by the command, with their new text
+	// and a diff of the changes, relative to the root
+	Documents []types.ProposedDocument `json:"documents"`
+	// Edit is the workspace edit of the command. It is only set when the
+	// settings turn the preview of edits off, in which case Documents is
+	// empty.
+	Edit json.RawMessage `json:"edit,omitempty"`
+}
+
+// Diff returns the diffs of the changed files, one after the other.
+func (r *Result) Diff() string {
+	var diff strings.Builder
+	for _, doc := range r.Documents {
+		diff.WriteString(doc.Diff)
+	}
+	return diff.String()
+}
+
+// Write writes the result to w in the format.
+func (r *Result) Write(w io.Writer, format string) error {
+	switch format {
+	case "", FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	case FormatDiff:
+		_, err := io.WriteString(w, r.Diff())
+		return err
+	}
+	return fmt.Errorf("unknown format %q, want json or diff", format)
+}
+
+// ReadRequest decodes and checks a request.
+func ReadRequest(r io.Reader) (Request, error) {
+	var req Request
+	if err := json.NewDecoder(r).Decode(&req); err != nil {
+		return Request{}, fmt.Errorf("invalid request: %w", err)
+	}
+	if req.Command == "" || req.File == "" {
+		return Request{}, errors.New("invalid request: command and file are required")
+	}
+	if req.Format != "" && req.Format != FormatJSON && req.Format != FormatDiff {
+		return Request{}, fmt.Errorf("invalid request: unknown format %q, want json or diff", req.Format)
+	}
+	if _, err := arguments(req, "file:///"); err != nil {
+		return Request{}, fmt.Errorf("invalid request: %w", err)
+	}
+	return req, nil
+}
+
+// arguments returns the arguments of the command of the request, as code
+// actions pass them, for the file at uri.
+func arguments(req Request, uri lsp.DocumentURI) ([]any, error) {
+	start, end := req.Range.Start.Line, req.Range.End.Line
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("invalid range: lines %d to %d", start, end)
+	}
+	switch req.Command {
+	case "docstring", "todos", "answer", "cody.test":
+		return []any{uri, start, end}, nil
+	case "cody.fix", "cody.translate":
+		if req.Instruction == "" {
+			return nil, fmt.Errorf("%s requires an instruction", req.Command)
+		}
+		return []any{uri, start, end, req.Instruction}, nil
+	case "cody":
+		if req.Instruction == "" {
+			return nil, fmt.Errorf("%s requires an instruction", req.Command)
+		}
+		// Replace the lines with code only
+		return []any{uri, start, end, req.Instruction, true, true}, nil
+	case "cody.edit":
+		if req.Instruction == "" {
+			return nil, fmt.Errorf("%s requires an instruction", req.Command)
+		}
+		return []any{uri, req.Range, req.Instruction}, nil
+	case "cody.completeFunction":
+		return []any{uri, start}, nil
+	}
+	return nil, fmt.Errorf("unsupported command %q", req.Command)
+}
+
+// client answers the requests the server sends while running a command.
+type client struct {
+	// log receives the messages the server shows to the user
+	log io.Writer
+
+	mu sync.Mutex
+	// edit is the last edit the server asked to apply
+	edit json.RawMessage
+}
+
+func (c *client) handle(_ context.Context, _ *jsonrpc2.Conn, req *jsonrpc2.Request) (any, error) {
+	switch req.Method {
+	case "workspace/applyEdit":
+		var params struct {
+			Edit json.RawMessage `json:"edit"`
+		}
+		if req.Params != nil {
+			if err := json.Unmarshal(*req.Params, &params); err != nil {
+				return nil, err
+			}
+		}
+		c.mu.Lock()
+		c.edit = params.Edit
+		c.mu.Unlock()
+		// Nothing is written to disk, the edit is part of the result
+		return map[string]bool{"applied": true}, nil
+	case "workspace/configuration":
+		return []any{}, nil
+	case "window/showMessage":
+		var params lsp.ShowMessageParams
+		if req.Params != nil && json.Unmarshal(*req.Params, &params) == nil && c.log != nil {
+			fmt.Fprintln(c.log, params.Message)
+		}
+	}
+	return nil, nil
+}
+
+// Run runs the command of the request on the server, such as the one
+// returned by lsp.NewServer, for the workspace rooted at root, an absolute
+// path. The Sourcegraph settings are sent as the editor's, they may be nil.
+// Messages the server shows to the user are written to log.
+func Run(ctx context.Context, server jsonrpc2.Handler, root string, req Request, sourcegraph map[string]any, log io.Writer) (*Result, error) {
+	path := req.File
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	uri := lsp.DocumentURI("file://" + filepath.ToSlash(path))
+	args, err := arguments(req, uri)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &client{log: log}
+	a, b := net.Pipe()
+	serverConn := jsonrpc2.NewConn(ctx, jsonrpc2.NewBufferedStream(a, jsonrpc2.VSCodeObjectCodec{}), server)
+	defer serverConn.Close()
+	conn := jsonrpc2.NewConn(ctx, jsonrpc2.NewBufferedStream(b, jsonrpc2.VSCodeObjectCodec{}), jsonrpc2.HandlerWithError(c.handle))
+	defer conn.Close()
+
+	rootURI := "file://" + filepath.ToSlash(root)
+	if err := conn.Call(ctx, "initialize", map[string]any{"rootUri": rootURI, "capabilities": map[string]any{}}, nil); err != nil {
+		return nil, err
+	}
+	// The configuration is sent as a request so that the server is
+	// configured before the document is opened. The config files still
+	// apply, the workspace's one can turn the preview off.
+	settings := map[string]any{"previewEdits": true}
+	for key, value := range sourcegraph {
+		settings[key] = value
+	}
+	params := map[string]any{"settings": map[string]any{"llmsp": map[string]any{"sourcegraph": settings}}}
+	if err := conn.Call(ctx, "workspace/didChangeConfiguration", params, nil); err != nil {
+		return nil, err
+	}
+	err = conn.Notify(ctx, "textDocument/didOpen", lsp.DidOpenTextDocumentParams{
+		TextDocument: lsp.TextDocumentItem{URI: uri, Version: 1, Text: string(text)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var res json.RawMessage
+	if err := conn.Call(ctx, "workspace/executeCommand", map[string]any{"command": req.Command, "arguments": args}, &res); err != nil {
+		return nil, err
+	}
+	result := &Result{Command: req.Command, Documents: []types.ProposedDocument{}}
+	var proposal types.EditProposalParams
+	if len(res) > 0 && string(res) != "null" {
+		if err := json.Unmarshal(res, &proposal); err != nil {
+			return nil, err
+		}
+	}
+	// Diffs name files by their absolute path, which is meaningless to git
+	prefix := strings.TrimPrefix(filepath.ToSlash(root), "/") + "/"
+	for _, doc := range proposal.Documents {
+		doc.Diff = strings.ReplaceAll(doc.Diff, "--- a/"+prefix, "--- a/")
+		doc.Diff = strings.ReplaceAll(doc.Diff, "+++ b/"+prefix, "+++ b/")
+		result.Documents = append(result.Documents, doc)
+	}
+	c.mu.Lock()
+	result.Edit = c.edit
+	c.mu.Unlock()
+	return result, nil
+}
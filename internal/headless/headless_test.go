@@ -0,0 +1,146 @@
+package headless_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pjlast/llmsp/internal/headless"
+	"github.com/pjlast/llmsp/internal/sgtest"
+	"github.com/pjlast/llmsp/lsp"
+	golsp "github.com/sourcegraph/go-lsp"
+)
+
+// workspace returns the root of a workspace holding src/add.go and a config
+// file with the settings.
+func workspace(t *testing.T, settings map[string]any) string {
+	t.Helper()
+	// Keep the config files and history of the user out of the test
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+	t.Setenv("XDG_DATA_HOME", filepath.Join(dir, "data"))
+
+	root := filepath.Join(dir, "workspace")
+	if err := os.MkdirAll(filepath.Join(root, "src"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "src", "add.go"), []byte("package add\n\nfunc add(a, b int) int {\n}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sourcegraph := map[string]any{"telemetry": "off", "uidFile": filepath.Join(dir, "uid")}
+	for key, value := range settings {
+		sourcegraph[key] = value
+	}
+	data, _ := json.Marshal(map[string]any{"sourcegraph": sourcegraph})
+	if err := os.WriteFile(filepath.Join(root, ".llmsp.json"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+// settings are the Sourcegraph settings of the instance.
+func settings(instance *httptest.Server) map[string]any {
+	return map[string]any{"url": instance.URL}
+}
+
+var implementAdd = headless.Request{
+	Command:     "cody",
+	File:        "src/add.go",
+	Range:       golsp.Range{Start: golsp.Position{Line: 2}, End: golsp.Position{Line: 3}},
+	Instruction: "Implement add",
+}
+
+func TestRun(t *testing.T) {
+	instance := sgtest.NewInstance(t, "func add(a, b int) int {\n\treturn a + b\n}\n```")
+	root := workspace(t, nil)
+	result, err := headless.Run(context.Background(), lsp.NewServer("", "token"), root, implementAdd, settings(instance), io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Documents) != 1 {
+		t.Fatalf("got %d documents, want add.go", len(result.Documents))
+	}
+	doc := result.Documents[0]
+	if want := "package add\n\nfunc add(a, b int) int {\n\treturn a + b\n}\n"; doc.NewText != want {
+		t.Errorf("new text == %q, want %q", doc.NewText, want)
+	}
+	// Diffs are relative to the root, as git's
+	if !strings.HasPrefix(doc.Diff, "--- a/src/add.go\n+++ b/src/add.go\n") || !strings.Contains(doc.Diff, "+\treturn a + b\n") {
+		t.Errorf("diff == %q, want the new line in src/add.go", doc.Diff)
+	}
+	if result.Edit != nil {
+		t.Errorf("edit == %s, want none as it is previewed", result.Edit)
+	}
+
+	// The file itself isn't changed
+	if data, _ := os.ReadFile(filepath.Join(root, "src", "add.go")); strings.Contains(string(data), "return") {
+		t.Errorf("src/add.go was changed to %q", data)
+	}
+
+	var out bytes.Buffer
+	if err := result.Write(&out, headless.FormatDiff); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != doc.Diff {
+		t.Errorf("diff output == %q, want %q", out.String(), doc.Diff)
+	}
+}
+
+func TestRunWithoutPreview(t *testing.T) {
+	instance := sgtest.NewInstance(t, "func add(a, b int) int {\n\treturn a + b\n}\n```")
+	// The workspace's config file takes precedence
+	root := workspace(t, map[string]any{"previewEdits": false})
+
+	result, err := headless.Run(context.Background(), lsp.NewServer("", "token"), root, implementAdd, settings(instance), io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Documents) != 0 {
+		t.Errorf("got %d documents, want none without a preview", len(result.Documents))
+	}
+	if !strings.Contains(string(result.Edit), `return a + b`) {
+		t.Errorf("edit == %s, want the implementation", result.Edit)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	instance := sgtest.NewInstance(t, "")
+	root := workspace(t, nil)
+
+	missing := implementAdd
+	missing.File = "src/missing.go"
+	if _, err := headless.Run(context.Background(), lsp.NewServer("", "token"), root, missing, settings(instance), io.Discard); err == nil {
+		t.Error("running a command on a missing file succeeded")
+	}
+}
+
+func TestReadRequest(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{`{"command": "docstring", "file": "main.go", "range": {"start": {"line": 1, "character": 0}, "end": {"line": 4, "character": 0}}}`, ""},
+		{`{"command": "cody.edit", "file": "main.go", "instruction": "Use a loop", "format": "diff"}`, ""},
+		{`{"command": "docstring"`, "invalid request"},
+		{`{"command": "docstring"}`, "command and file are required"},
+		{`{"command": "docstring", "file": "main.go", "format": "xml"}`, "unknown format"},
+		{`{"command": "cody.translate", "file": "main.go"}`, "requires an instruction"},
+		{`{"command": "cody.chat/new", "file": "main.go"}`, "unsupported command"},
+		{`{"command": "docstring", "file": "main.go", "range": {"start": {"line": 4, "character": 0}, "end": {"line": 1, "character": 0}}}`, "invalid range"},
+	}
+	for _, test := range tests {
+		_, err := headless.ReadRequest(strings.NewReader(test.input))
+		if test.err == "" && err != nil {
+			t.Errorf("ReadRequest(%s) returned %v", test.input, err)
+		}
+		if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("ReadRequest(%s) returned %v, want %q", test.input, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+// Package i18n translates the messages shown to users, such as progress
+// titles, status messages and errors, into the locale of the editor.
+//
+// Messages are looked up by key in a catalog per language. Locales are
+// matched on their language only, so "de-CH" uses the German catalog, and
+// messages missing from a catalog fall back to English.
+package i18n
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Key identifies a message in the catalog.
+type Key string
+
+// Message keys.
+const (
+	CompletionTitle    Key = "completion.title"
+	CompletionBegin    Key = "completion.begin"
+	CompletionEnd      Key = "completion.end"
+	CommandTitle       Key = "command.title"
+	CommandBegin       Key = "command.begin"
+	CommandEnd         Key = "command.end"
+	Initialized        Key = "initialized"
+	NotInitialized     Key = "error.notInitialized"
+	RateLimited        Key = "error.rateLimited"
+	RateLimitedRetryIn Key = "error.rateLimited.retryIn"
+	RateLimitedWait    Key = "error.rateLimited.wait"
+	Unauthorized       Key = "error.unauthorized"
+	ContextTooLong     Key = "error.contextTooLong"
+	// ConnectionFailed takes the URL of the instance and the error
+	ConnectionFailed Key = "error.connectionFailed"
+	Planning         Key = "plan.planning"
+	PlanStep         Key = "plan.step"
+	Verifying        Key = "plan.verifying"
+	// The unsupported feature messages take the first version supporting the
+	// feature and the version of the instance
+	EmbeddingsUnsupported Key = "feature.embeddings.unsupported"
+	StreamingUnsupported  Key = "feature.streaming.unsupported"
+	ModelsUnsupported     Key = "feature.models.unsupported"
+)
+
+// defaultLanguage is the language used for unknown locales.
+const defaultLanguage = "en"
+
+// catalogs maps languages to their messages. Messages are format strings
+// taking the arguments passed to Localizer.T.
+var catalogs = map[string]map[Key]string{
+	"en": {
+		CompletionTitle:       "Completion",
+		CompletionBegin:       "Fetching completion...",
+		CompletionEnd:         "Completion fetched",
+		CommandTitle:          "Code actions",
+		CommandBegin:          "Computing code actions...",
+		CommandEnd:            "Code actions computed",
+		Initialized:           "LLMSP initialized!",
+		NotInitialized:        "server has not yet been initialized",
+		RateLimited:           "Cody: the Sourcegraph rate limit or quota for completions has been reached.",
+		RateLimitedRetryIn:    "Try again in %s.",
+		RateLimitedWait:       "Wait a moment before trying again, or ask your Sourcegraph admin to raise the limit.",
+		Unauthorized:          "Cody: Sourcegraph rejected the access token. Check the llmsp.sourcegraph.accessToken setting and make sure Cody is enabled for your account.",
+		ContextTooLong:        "Cody: the prompt was too long for the model. Select a smaller range, close some files, or configure a model with a larger context window.",
+		ConnectionFailed:      "Cody: could not connect to Sourcegraph at %s (%v). Check the llmsp.sourcegraph.url setting.",
+		Planning:              "Planning...",
+		PlanStep:              "Step %d/%d: %s",
+		Verifying:             "Verifying...",
+		EmbeddingsUnsupported: "Cody: embeddings search requires Sourcegraph %s or later, but the instance runs %s. Context is taken from a local index of the workspace instead.",
+		StreamingUnsupported:  "Cody: streaming responses requires Sourcegraph %s or later, but the instance runs %s. Responses are shown once they are complete.",
+		ModelsUnsupported:     "Cody: choosing models requires Sourcegraph %s or later, but the instance runs %s. The default model of the instance is used instead.",
+	},
+	"de": {
+		CompletionTitle:       "Vervollständigung",
+		CompletionBegin:       "Vervollständigung wird abgerufen...",
+		CompletionEnd:         "Vervollständigung abgerufen",
+		CommandTitle:          "Codeaktionen",
+		CommandBegin:          "Codeaktionen werden berechnet...",
+		CommandEnd:            "Codeaktionen berechnet",
+		Initialized:           "LLMSP initialisiert!",
+		NotInitialized:        "der Server wurde noch nicht initialisiert",
+		RateLimited:           "Cody: Das Sourcegraph-Limit oder -Kontingent für Vervollständigungen wurde erreicht.",
+		RateLimitedRetryIn:    "Versuche es in %s erneut.",
+		RateLimitedWait:       "Warte einen Moment, bevor du es erneut versuchst, oder bitte deinen Sourcegraph-Admin, das Limit zu erhöhen.",
+		Unauthorized:          "Cody: Sourcegraph hat das Zugriffstoken abgelehnt. Prüfe die Einstellung llmsp.sourcegraph.accessToken und stelle sicher, dass Cody für dein Konto aktiviert ist.",
+		ContextTooLong:        "Cody: Der Prompt war zu lang für das Modell. Wähle einen kleineren Bereich, schließe einige Dateien oder konfiguriere ein Modell mit einem größeren Kontextfenster.",
+		ConnectionFailed:      "Cody: Keine Verbindung zu Sourcegraph unter %s (%v). Prüfe die Einstellung llmsp.sourcegraph.url.",
+		Planning:              "Planung...",
+		PlanStep:              "Schritt %d/%d: %s",
+		Verifying:             "Überprüfung...",
+		EmbeddingsUnsupported: "Cody: Die Embeddings-Suche erfordert Sourcegraph %s oder neuer, die Instanz läuft aber mit %s. Der Kontext wird stattdessen aus einem lokalen Index des Arbeitsbereichs genommen.",
+		StreamingUnsupported:  "Cody: Gestreamte Antworten erfordern Sourcegraph %s oder neuer, die Instanz läuft aber mit %s. Antworten werden angezeigt, sobald sie vollständig sind.",
+		ModelsUnsupported:     "Cody: Die Modellauswahl erfordert Sourcegraph %s oder neuer, die Instanz läuft aber mit %s. Stattdessen wird das Standardmodell der Instanz verwendet.",
+	},
+	"es": {
+		CompletionTitle:       "Autocompletado",
+		CompletionBegin:       "Obteniendo autocompletado...",
+		CompletionEnd:         "Autocompletado obtenido",
+		CommandTitle:          "Acciones de código",
+		CommandBegin:          "Calculando acciones de código...",
+		CommandEnd:            "Acciones de código calculadas",
+		Initialized:           "¡LLMSP inicializado!",
+		NotInitialized:        "el servidor aún no se ha inicializado",
+		RateLimited:           "Cody: se alcanzó el límite o la cuota de Sourcegraph para autocompletados.",
+		RateLimitedRetryIn:    "Inténtalo de nuevo en %s.",
+		RateLimitedWait:       "Espera un momento antes de volver a intentarlo o pide a tu administrador de Sourcegraph que aumente el límite.",
+		Unauthorized:          "Cody: Sourcegraph rechazó el token de acceso. Revisa la configuración llmsp.sourcegraph.accessToken y asegúrate de que Cody esté habilitado para tu cuenta.",
+		ContextTooLong:        "Cody: el prompt era demasiado largo para el modelo. Selecciona un rango más pequeño, cierra algunos archivos o configura un modelo con una ventana de contexto más grande.",
+		ConnectionFailed:      "Cody: no se pudo conectar con Sourcegraph en %s (%v). Revisa la configuración llmsp.sourcegraph.url.",
+		Planning:              "Planificando...",
+		PlanStep:              "Paso %d/%d: %s",
+		Verifying:             "Verificando...",
+		EmbeddingsUnsupported: "Cody: la búsqueda de embeddings requiere Sourcegraph %s o posterior, pero la instancia ejecuta %s. El contexto se toma de un índice local del espacio de trabajo.",
+		StreamingUnsupported:  "Cody: las respuestas en streaming requieren Sourcegraph %s o posterior, pero la instancia ejecuta %s. Las respuestas se muestran cuando están completas.",
+		ModelsUnsupported:     "Cody: elegir modelos requiere Sourcegraph %s o posterior, pero la instancia ejecuta %s. Se usa el modelo predeterminado de la instancia.",
+	},
+	"fr": {
+		CompletionTitle:       "Complétion",
+		CompletionBegin:       "Récupération de la complétion...",
+		CompletionEnd:         "Complétion récupérée",
+		CommandTitle:          "Actions de code",
+		CommandBegin:          "Calcul des actions de code...",
+		CommandEnd:            "Actions de code calculées",
+		Initialized:           "LLMSP initialisé !",
+		NotInitialized:        "le serveur n'a pas encore été initialisé",
+		RateLimited:           "Cody : la limite ou le quota Sourcegraph pour les complétions a été atteint.",
+		RateLimitedRetryIn:    "Réessayez dans %s.",
+		RateLimitedWait:       "Patientez un instant avant de réessayer, ou demandez à votre administrateur Sourcegraph d'augmenter la limite.",
+		Unauthorized:          "Cody : Sourcegraph a refusé le jeton d'accès. Vérifiez le paramètre llmsp.sourcegraph.accessToken et assurez-vous que Cody est activé pour votre compte.",
+		ContextTooLong:        "Cody : le prompt était trop long pour le modèle. Sélectionnez une plage plus petite, fermez des fichiers ou configurez un modèle avec une fenêtre de contexte plus grande.",
+		ConnectionFailed:      "Cody : impossible de se connecter à Sourcegraph sur %s (%v). Vérifiez le paramètre llmsp.sourcegraph.url.",
+		Planning:              "Planification...",
+		PlanStep:              "Étape %d/%d : %s",
+		Verifying:             "Vérification...",
+		EmbeddingsUnsupported: "Cody : la recherche par embeddings nécessite Sourcegraph %s ou ultérieur, mais l'instance exécute %s. Le contexte provient d'un index local de l'espace de travail.",
+		StreamingUnsupported:  "Cody : les réponses en streaming nécessitent Sourcegraph %s ou ultérieur, mais l'instance exécute %s. Les réponses s'affichent une fois complètes.",
+		ModelsUnsupported:     "Cody : le choix des modèles nécessite Sourcegraph %s ou ultérieur, mais l'instance exécute %s. Le modèle par défaut de l'instance est utilisé.",
+	},
+	"ja": {
+		CompletionTitle:       "補完",
+		CompletionBegin:       "補完を取得しています...",
+		CompletionEnd:         "補完を取得しました",
+		CommandTitle:          "コードアクション",
+		CommandBegin:          "コードアクションを計算しています...",
+		CommandEnd:            "コードアクションを計算しました",
+		Initialized:           "LLMSP を初期化しました！",
+		NotInitialized:        "サーバーはまだ初期化されていません",
+		RateLimited:           "Cody: Sourcegraph の補完のレート制限またはクォータに達しました。",
+		RateLimitedRetryIn:    "%s 後に再試行してください。",
+		RateLimitedWait:       "しばらく待ってから再試行するか、Sourcegraph の管理者に制限の引き上げを依頼してください。",
+		Unauthorized:          "Cody: Sourcegraph がアクセストークンを拒否しました。llmsp.sourcegraph.accessToken の設定を確認し、アカウントで Cody が有効になっていることを確認してください。",
+		ContextTooLong:        "Cody: プロンプトがモデルには長すぎます。範囲を小さくするか、ファイルをいくつか閉じるか、より大きなコンテキストウィンドウを持つモデルを設定してください。",
+		ConnectionFailed:      "Cody: %s の Sourcegraph に接続できませんでした (%v)。llmsp.sourcegraph.url の設定を確認してください。",
+		Planning:              "計画しています...",
+		PlanStep:              "ステップ %d/%d: %s",
+		Verifying:             "検証しています...",
+		EmbeddingsUnsupported: "Cody: 埋め込み検索には Sourcegraph %s 以降が必要ですが、インスタンスは %s です。代わりにワークスペースのローカルインデックスからコンテキストを取得します。",
+		StreamingUnsupported:  "Cody: ストリーミング応答には Sourcegraph %s 以降が必要ですが、インスタンスは %s です。応答は完了してから表示されます。",
+		ModelsUnsupported:     "Cody: モデルの選択には Sourcegraph %s 以降が必要ですが、インスタンスは %s です。代わりにインスタンスのデフォルトモデルを使用します。",
+	},
+}
+
+// Localizer translates messages into a single language. The zero value
+// translates into English.
+type Localizer struct {
+	language string
+}
+
+// New returns a Localizer for the given locale, such as "de" or "pt-BR",
+// falling back to English for unsupported locales.
+func New(locale string) Localizer {
+	language := strings.ToLower(locale)
+	if i := strings.IndexAny(language, "-_"); i != -1 {
+		language = language[:i]
+	}
+	if _, ok := catalogs[language]; !ok {
+		language = defaultLanguage
+	}
+	return Localizer{language: language}
+}
+
+// Language returns the language messages are translated into.
+func (l Localizer) Language() string {
+	if l.language == "" {
+		return defaultLanguage
+	}
+	return l.language
+}
+
+// T returns the message for key, formatted with args.
+func (l Localizer) T(key Key, args ...any) string {
+	message, ok := catalogs[l.Language()][key]
+	if !ok {
+		message, ok = catalogs[defaultLanguage][key]
+	}
+	if !ok {
+		return string(key)
+	}
+	if len(args) == 0 {
+		return message
+	}
+	return fmt.Sprintf(message, args...)
+}
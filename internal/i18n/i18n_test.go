@@ -0,0 +1,46 @@
+package i18n
+
+import "testing"
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		locale string
+		want   string
+	}{
+		{"", "en"},
+		{"en-US", "en"},
+		{"de", "de"},
+		{"de-CH", "de"},
+		{"fr_CA", "fr"},
+		{"JA", "ja"},
+		{"pt-BR", "en"},
+	}
+
+	for _, test := range tests {
+		if got := New(test.locale).Language(); got != test.want {
+			t.Errorf("New(%q).Language() == %q, want %q", test.locale, got, test.want)
+		}
+	}
+}
+
+func TestT(t *testing.T) {
+	if got, want := New("de").T(PlanStep, 1, 3, "Tests schreiben"), "Schritt 1/3: Tests schreiben"; got != want {
+		t.Errorf("T() == %q, want %q", got, want)
+	}
+	if got, want := (Localizer{}).T(CompletionTitle), "Completion"; got != want {
+		t.Errorf("T() == %q, want %q", got, want)
+	}
+	if got, want := New("en").T("unknown"), "unknown"; got != want {
+		t.Errorf("T() == %q, want %q", got, want)
+	}
+}
+
+func TestCatalogsComplete(t *testing.T) {
+	for language, catalog := range catalogs {
+		for key := range catalogs[defaultLanguage] {
+			if _, ok := catalog[key]; !ok {
+				t.Errorf("catalog %q is missing %q", language, key)
+			}
+		}
+	}
+}
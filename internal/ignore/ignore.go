@@ -0,0 +1,149 @@
+// Package ignore matches file paths against exclusion rules, which keep files
+// such as secrets, vendored code and generated files out of prompts.
+//
+// Rules are written like the patterns of .gitignore files: * matches within a
+// path segment, ** matches any number of segments, a pattern ending in / only
+// matches directories, and a pattern containing a / elsewhere is anchored to
+// the root. Patterns starting with ! re-include paths excluded by earlier
+// patterns, the last matching pattern wins. A pattern matching a directory
+// matches everything in it.
+package ignore
+
+import (
+	"regexp"
+	"strings"
+)
+
+// FileName is the name of the files listing the rules of a workspace folder.
+const FileName = ".codyignore"
+
+// Rules is a list of exclusion rules. A nil *Rules matches nothing.
+type Rules struct {
+	rules []rule
+}
+
+type rule struct {
+	// re matches the paths the pattern applies to, its only group is the
+	// part of the path below the matched directory
+	re *regexp.Regexp
+	// negate re-includes matching paths
+	negate bool
+	// dirOnly only matches directories and their contents
+	dirOnly bool
+}
+
+// Parse returns the patterns of a rules file, one per line. Blank lines and
+// comments starting with # are skipped.
+func Parse(text string) []string {
+	var patterns []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns
+}
+
+// New compiles the patterns into rules. It returns nil if there are no
+// patterns.
+func New(patterns []string) *Rules {
+	var rules []rule
+	for _, pattern := range patterns {
+		if r, ok := compile(strings.TrimSpace(pattern)); ok {
+			rules = append(rules, r)
+		}
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+	return &Rules{rules: rules}
+}
+
+// compile returns the rule of a pattern, or false if it matches nothing.
+func compile(pattern string) (rule, bool) {
+	var r rule
+	if strings.HasPrefix(pattern, "!") {
+		r.negate = true
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		r.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	if pattern == "" {
+		return r, false
+	}
+
+	var sb strings.Builder
+	sb.WriteString("^")
+	if !anchored {
+		sb.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			sb.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			sb.WriteString(".*")
+			i++
+		case c == '*':
+			sb.WriteString("[^/]*")
+		case c == '?':
+			sb.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				sb.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + class + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			sb.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("(/.*)?$")
+
+	re, err := regexp.Compile(sb.String())
+	if err != nil {
+		return r, false
+	}
+	r.re = re
+	return r, true
+}
+
+// Match reports whether the path, relative to the root of the rules and
+// separated by slashes, is excluded. isDir tells whether the path is a
+// directory.
+func (r *Rules) Match(path string, isDir bool) bool {
+	if r == nil {
+		return false
+	}
+	path = strings.Trim(path, "/")
+	ignored := false
+	for _, rule := range r.rules {
+		m := rule.re.FindStringSubmatch(path)
+		if m == nil {
+			continue
+		}
+		// Files only match directory patterns if they are below the
+		// directory
+		if rule.dirOnly && !isDir && m[1] == "" {
+			continue
+		}
+		ignored = !rule.negate
+	}
+	return ignored
+}
@@ -0,0 +1,57 @@
+package ignore
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	got := Parse("# secrets\n.env\n\n  *.pem  \n#generated\ngen/\n")
+	want := []string{".env", "*.pem", "gen/"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse() == %q, want %q", got, want)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	for _, test := range []struct {
+		patterns []string
+		path     string
+		isDir    bool
+		want     bool
+	}{
+		{[]string{".env"}, ".env", false, true},
+		{[]string{".env"}, "config/.env", false, true},
+		{[]string{".env"}, ".envrc", false, false},
+		{[]string{"*.pem"}, "certs/server.pem", false, true},
+		{[]string{"*.pem"}, "certs/server.pem.go", false, false},
+		{[]string{"secret?.txt"}, "secret1.txt", false, true},
+		{[]string{"secret[0-9].txt"}, "secretx.txt", false, false},
+		{[]string{"secret[!0-9].txt"}, "secretx.txt", false, true},
+		// Directories match everything in them
+		{[]string{"vendor"}, "vendor/github.com/x/x.go", false, true},
+		{[]string{"third_party"}, "lib/third_party/a.c", false, true},
+		// Patterns ending in / only match directories
+		{[]string{"gen/"}, "gen", false, false},
+		{[]string{"gen/"}, "gen", true, true},
+		{[]string{"gen/"}, "api/gen/types.go", false, true},
+		// Patterns containing a / are anchored
+		{[]string{"/build"}, "build/out.js", false, true},
+		{[]string{"/build"}, "web/build/out.js", false, false},
+		{[]string{"internal/testdata"}, "internal/testdata/a.json", false, true},
+		{[]string{"internal/testdata"}, "x/internal/testdata/a.json", false, false},
+		{[]string{"**/testdata"}, "x/internal/testdata/a.json", false, true},
+		{[]string{"docs/**/*.gen.md"}, "docs/a/b/api.gen.md", false, true},
+		{[]string{"docs/**/*.gen.md"}, "docs/api.gen.md", false, true},
+		{[]string{"logs/**"}, "logs/2024/app.log", false, true},
+		// The last matching pattern wins
+		{[]string{"*.json", "!package.json"}, "web/package.json", false, false},
+		{[]string{"*.json", "!package.json"}, "web/data.json", false, true},
+		{[]string{"!package.json", "*.json"}, "package.json", false, true},
+		{nil, "main.go", false, false},
+	} {
+		if got := New(test.patterns).Match(test.path, test.isDir); got != test.want {
+			t.Errorf("New(%q).Match(%q, %v) == %v, want %v", test.patterns, test.path, test.isDir, got, test.want)
+		}
+	}
+}
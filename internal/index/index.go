@@ -0,0 +1,280 @@
+// Package index is a local keyword index of the files in a workspace.
+//
+// It is used to find context for prompts when a repository has no embeddings
+// on Sourcegraph. Files are split into chunks of consecutive lines, and chunks
+// are ranked against a query with BM25, treating the parts of camelCase and
+// snake_case identifiers as terms of their own so that a query for "user id"
+// finds getUserID.
+package index
+
+import (
+	"bytes"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// chunkLines is the number of lines in a chunk.
+	chunkLines = 40
+	// maxFiles is the maximum number of files indexed per root.
+	maxFiles = 5000
+	// maxFileBytes is the size above which files are not indexed, as they are
+	// most likely generated.
+	maxFileBytes = 512 * 1024
+
+	// k1 and b are the BM25 term frequency saturation and length
+	// normalization parameters.
+	k1 = 1.2
+	b  = 0.75
+)
+
+// Chunk is a range of lines of an indexed file.
+type Chunk struct {
+	// FileName is the path of the file, relative to the indexed root
+	FileName  string
+	StartLine int
+	EndLine   int
+	Content   string
+}
+
+// chunk is an indexed chunk.
+type chunk struct {
+	Chunk
+	// terms maps the terms of the chunk to their frequency
+	terms map[string]int
+	// length is the number of terms in the chunk
+	length int
+}
+
+// Index ranks chunks of files against keyword queries. It is safe for
+// concurrent use.
+type Index struct {
+	mu     sync.RWMutex
+	chunks []chunk
+	// docFreq maps terms to the number of chunks they occur in
+	docFreq map[string]int
+	// totalLength is the sum of the lengths of all chunks
+	totalLength int
+}
+
+// New creates an empty index.
+func New() *Index {
+	return &Index{docFreq: make(map[string]int)}
+}
+
+// Build indexes the text files in the given root directories. Hidden
+// directories and dependency directories are skipped, as well as the files
+// and directories skip reports, if it isn't nil.
+func Build(roots []string, skip func(path string, isDir bool) bool) *Index {
+	ix := New()
+	for _, root := range roots {
+		indexed := 0
+		_ = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() {
+				if path != root && (strings.HasPrefix(d.Name(), ".") || d.Name() == "node_modules" || d.Name() == "vendor" || (skip != nil && skip(path, true))) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() || (skip != nil && skip(path, false)) {
+				return nil
+			}
+			if info, err := d.Info(); err != nil || info.Size() > maxFileBytes {
+				return nil
+			}
+			data, err := os.ReadFile(path)
+			if err != nil || !isText(data) {
+				return nil
+			}
+			name, err := filepath.Rel(root, path)
+			if err != nil {
+				name = path
+			}
+			ix.Add(filepath.ToSlash(name), string(data))
+			indexed++
+			if indexed >= maxFiles {
+				return filepath.SkipAll
+			}
+			return nil
+		})
+	}
+	return ix
+}
+
+// isText reports whether data looks like the contents of a text file.
+func isText(data []byte) bool {
+	head := data
+	if len(head) > 8000 {
+		head = head[:8000]
+	}
+	return bytes.IndexByte(head, 0) == -1 && utf8.Valid(data)
+}
+
+// Add indexes the contents of a file, replacing the chunks previously
+// indexed for it.
+func (ix *Index) Add(name, contents string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.remove(name)
+	lines := strings.Split(contents, "\n")
+	for start := 0; start < len(lines); start += chunkLines {
+		end := start + chunkLines
+		if end > len(lines) {
+			end = len(lines)
+		}
+		content := strings.Join(lines[start:end], "\n")
+		terms := Terms(content)
+		if len(terms) == 0 {
+			continue
+		}
+
+		c := chunk{
+			Chunk:  Chunk{FileName: name, StartLine: start, EndLine: end - 1, Content: content},
+			terms:  make(map[string]int),
+			length: len(terms),
+		}
+		for _, term := range terms {
+			c.terms[term]++
+		}
+		for term := range c.terms {
+			ix.docFreq[term]++
+		}
+		ix.totalLength += c.length
+		ix.chunks = append(ix.chunks, c)
+	}
+}
+
+// remove removes the chunks of the file from the index. The caller must hold
+// the write lock.
+func (ix *Index) remove(name string) {
+	kept := ix.chunks[:0]
+	for _, c := range ix.chunks {
+		if c.FileName != name {
+			kept = append(kept, c)
+			continue
+		}
+		for term := range c.terms {
+			if ix.docFreq[term]--; ix.docFreq[term] == 0 {
+				delete(ix.docFreq, term)
+			}
+		}
+		ix.totalLength -= c.length
+	}
+	ix.chunks = kept
+}
+
+// Len returns the number of indexed chunks.
+func (ix *Index) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return len(ix.chunks)
+}
+
+// Search returns up to n chunks matching the query, most relevant first.
+// Chunks that share no terms with the query are never returned.
+func (ix *Index) Search(query string, n int) []Chunk {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	if len(ix.chunks) == 0 || n <= 0 {
+		return nil
+	}
+
+	queryTerms := make(map[string]bool)
+	for _, term := range Terms(query) {
+		queryTerms[term] = true
+	}
+
+	total := float64(len(ix.chunks))
+	avgLength := float64(ix.totalLength) / total
+	type scored struct {
+		index int
+		score float64
+	}
+	var results []scored
+	for i, c := range ix.chunks {
+		var score float64
+		for term := range queryTerms {
+			freq := float64(c.terms[term])
+			if freq == 0 {
+				continue
+			}
+			df := float64(ix.docFreq[term])
+			idf := math.Log(1 + (total-df+0.5)/(df+0.5))
+			score += idf * freq * (k1 + 1) / (freq + k1*(1-b+b*float64(c.length)/avgLength))
+		}
+		if score > 0 {
+			results = append(results, scored{i, score})
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].score > results[j].score
+	})
+	if len(results) > n {
+		results = results[:n]
+	}
+
+	chunks := make([]Chunk, len(results))
+	for i, result := range results {
+		chunks[i] = ix.chunks[result.index].Chunk
+	}
+	return chunks
+}
+
+// Terms splits text into lower case search terms. Identifiers are indexed
+// both as a whole and split into their camelCase and snake_case parts.
+func Terms(text string) []string {
+	var terms []string
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+	for _, word := range words {
+		parts := splitIdentifier(word)
+		if len(parts) != 1 {
+			if whole := strings.ToLower(strings.Trim(word, "_")); len(whole) > 1 {
+				terms = append(terms, whole)
+			}
+		}
+		for _, part := range parts {
+			if len(part) > 1 {
+				terms = append(terms, strings.ToLower(part))
+			}
+		}
+	}
+	return terms
+}
+
+// splitIdentifier splits an identifier into its camelCase and snake_case
+// parts, keeping acronyms together, e.g. "parseHTTPRequest_v2" becomes
+// "parse", "HTTP", "Request" and "v2".
+func splitIdentifier(word string) []string {
+	var parts []string
+	for _, snake := range strings.Split(word, "_") {
+		runes := []rune(snake)
+		start := 0
+		for i := 1; i < len(runes); i++ {
+			lowerToUpper := unicode.IsLower(runes[i-1]) && unicode.IsUpper(runes[i])
+			acronymEnd := unicode.IsUpper(runes[i-1]) && unicode.IsUpper(runes[i]) && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if lowerToUpper || acronymEnd {
+				parts = append(parts, string(runes[start:i]))
+				start = i
+			}
+		}
+		if start < len(runes) {
+			parts = append(parts, string(runes[start:]))
+		}
+	}
+	return parts
+}
@@ -0,0 +1,74 @@
+package index
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTerms(t *testing.T) {
+	got := Terms("func parseHTTPRequest_v2(userID int) // x")
+	want := []string{"func", "parsehttprequest_v2", "parse", "http", "request", "v2", "userid", "user", "id", "int"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Terms() == %v, want %v", got, want)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	ix := New()
+	ix.Add("auth/token.go", "package auth\n\nfunc ValidateToken(token string) error {\n\treturn nil\n}")
+	ix.Add("user/user.go", "package user\n\nfunc GetUserID(name string) int {\n\treturn 0\n}")
+	ix.Add("README.md", "# Project\n\nThis project validates things.")
+
+	results := ix.Search("where is the user id looked up", 5)
+	if len(results) != 1 || results[0].FileName != "user/user.go" {
+		t.Fatalf("Search() == %+v, want user/user.go", results)
+	}
+	if results[0].StartLine != 0 || results[0].EndLine != 4 {
+		t.Errorf("got lines %d-%d, want 0-4", results[0].StartLine, results[0].EndLine)
+	}
+
+	if results := ix.Search("zebra quantum", 5); len(results) != 0 {
+		t.Errorf("Search() == %+v, want no results", results)
+	}
+
+	// Re-adding a file replaces its chunks
+	ix.Add("user/user.go", "package user")
+	if results := ix.Search("user id", 5); len(results) != 1 || results[0].Content != "package user" {
+		t.Errorf("Search() == %+v, want the updated chunk", results)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"main.go":                  "package main\n\nfunc handleRequest() {}",
+		"node_modules/dep/dep.js":  "function handleRequest() {}",
+		".git/HEAD":                "ref: refs/heads/handleRequest",
+		"testdata/image.png":       "\x89PNG\x00handleRequest",
+		"internal/server/serve.go": "package server\n\n// handleRequest handles requests\nfunc serve() {}",
+		"generated/api.go":         "package api\n\nfunc handleRequest() {}",
+	}
+	for name, contents := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	skipGenerated := func(path string, isDir bool) bool {
+		return isDir && filepath.Base(path) == "generated"
+	}
+	ix := Build([]string{root}, skipGenerated)
+	var got []string
+	for _, result := range ix.Search("handle request", 10) {
+		got = append(got, result.FileName)
+	}
+	if want := []string{"main.go", "internal/server/serve.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Search() == %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,274 @@
+// Package language detects the programming language of files and knows how
+// comments are written in each language.
+//
+// Detection uses github.com/go-enry/go-enry, the Go port of GitHub's
+// Linguist: well-known file names are matched first, then the interpreter
+// named in a shebang line, and finally extensions. Extensions shared by
+// several languages, like .h, are disambiguated by enry's content
+// heuristics, falling back to the language the extension is most commonly
+// used for. Language names are those of enry, except for TypeScript React,
+// which enry calls TSX.
+package language
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/go-enry/go-enry/v2"
+	"github.com/go-enry/go-enry/v2/data"
+)
+
+// Comment describes how comments are written in a language.
+type Comment struct {
+	// Line starts a comment running to the end of the line, it is empty
+	// for languages that only have block comments
+	Line string
+	// BlockStart and BlockEnd delimit block comments, they are empty for
+	// languages without block comments
+	BlockStart, BlockEnd string
+}
+
+// Prefix returns the string that starts a comment: the line comment token, or
+// the start of a block comment in languages without line comments.
+func (c Comment) Prefix() string {
+	if c.Line != "" {
+		return c.Line
+	}
+	return c.BlockStart
+}
+
+// preferred maps extensions shared by several languages to the language
+// they are most commonly used for, which is detected when the content of a
+// file doesn't tell.
+var preferred = map[string]string{
+	".cfg":  "INI",
+	".cs":   "C#",
+	".d":    "D",
+	".ex":   "Elixir",
+	".fs":   "F#",
+	".h":    "C",
+	".hh":   "C++",
+	".html": "HTML",
+	".json": "JSON",
+	".lisp": "Common Lisp",
+	".m":    "Objective-C",
+	".md":   "Markdown",
+	".ml":   "OCaml",
+	".mm":   "Objective-C++",
+	".php":  "PHP",
+	".pl":   "Perl",
+	".pm":   "Perl",
+	".r":    "R",
+	".rs":   "Rust",
+	".scm":  "Scheme",
+	".sql":  "SQL",
+	".star": "Starlark",
+	".ts":   "TypeScript",
+	".tsx":  "TSX",
+	".txt":  "Text",
+	".yaml": "YAML",
+	".yml":  "YAML",
+}
+
+// renamed maps enry's names of languages to the names used by llmsp.
+var renamed = map[string]string{
+	"TSX": "TypeScript React",
+}
+
+// maxHeuristicBytes is the length of the start of a file that content
+// heuristics look at.
+const maxHeuristicBytes = 16 << 10
+
+// comments maps languages to their comment style.
+var comments = map[string]Comment{
+	"Go":                 {"//", "/*", "*/"},
+	"Go Module":          {"//", "", ""},
+	"Python":             {"#", "", ""},
+	"JavaScript":         {"//", "/*", "*/"},
+	"TypeScript":         {"//", "/*", "*/"},
+	"TypeScript React":   {"//", "/*", "*/"},
+	"Java":               {"//", "/*", "*/"},
+	"Kotlin":             {"//", "/*", "*/"},
+	"Scala":              {"//", "/*", "*/"},
+	"Groovy":             {"//", "/*", "*/"},
+	"Gradle":             {"//", "/*", "*/"},
+	"Clojure":            {";", "", ""},
+	"C":                  {"//", "/*", "*/"},
+	"C++":                {"//", "/*", "*/"},
+	"Objective-C":        {"//", "/*", "*/"},
+	"Objective-C++":      {"//", "/*", "*/"},
+	"C#":                 {"//", "/*", "*/"},
+	"F#":                 {"//", "(*", "*)"},
+	"Visual Basic .NET":  {"'", "", ""},
+	"Swift":              {"//", "/*", "*/"},
+	"Rust":               {"//", "/*", "*/"},
+	"Zig":                {"//", "", ""},
+	"Nim":                {"#", "#[", "]#"},
+	"D":                  {"//", "/*", "*/"},
+	"Dart":               {"//", "/*", "*/"},
+	"Lua":                {"--", "--[[", "]]"},
+	"Ruby":               {"#", "=begin", "=end"},
+	"HTML+ERB":           {"", "<%#", "%>"},
+	"PHP":                {"#", "/*", "*/"},
+	"Perl":               {"#", "", ""},
+	"R":                  {"#", "", ""},
+	"Julia":              {"#", "#=", "=#"},
+	"Haskell":            {"--", "{-", "-}"},
+	"Literate Haskell":   {"--", "{-", "-}"},
+	"Elm":                {"--", "{-", "-}"},
+	"OCaml":              {"", "(*", "*)"},
+	"Elixir":             {"#", "", ""},
+	"Erlang":             {"%", "", ""},
+	"Common Lisp":        {";", "#|", "|#"},
+	"Emacs Lisp":         {";", "", ""},
+	"Scheme":             {";", "#|", "|#"},
+	"Racket":             {";", "#|", "|#"},
+	"Shell":              {"#", "", ""},
+	"fish":               {"#", "", ""},
+	"PowerShell":         {"#", "<#", "#>"},
+	"Batchfile":          {"REM", "", ""},
+	"Vim Script":         {"\"", "", ""},
+	"SQL":                {"--", "/*", "*/"},
+	"GraphQL":            {"#", "", ""},
+	"Protocol Buffer":    {"//", "/*", "*/"},
+	"Thrift":             {"//", "/*", "*/"},
+	"HCL":                {"#", "/*", "*/"},
+	"Nix":                {"#", "/*", "*/"},
+	"Starlark":           {"#", "", ""},
+	"CMake":              {"#", "#[[", "]]"},
+	"Makefile":           {"#", "", ""},
+	"Dockerfile":         {"#", "", ""},
+	"YAML":               {"#", "", ""},
+	"TOML":               {"#", "", ""},
+	"INI":                {";", "", ""},
+	"JSON with Comments": {"//", "/*", "*/"},
+	"XML":                {"", "<!--", "-->"},
+	"HTML":               {"", "<!--", "-->"},
+	"Vue":                {"", "<!--", "-->"},
+	"Svelte":             {"", "<!--", "-->"},
+	"CSS":                {"", "/*", "*/"},
+	"SCSS":               {"//", "/*", "*/"},
+	"Sass":               {"//", "/*", "*/"},
+	"Less":               {"//", "/*", "*/"},
+	"Markdown":           {"", "<!--", "-->"},
+	"reStructuredText":   {"..", "", ""},
+	"TeX":                {"%", "", ""},
+	"Ignore List":        {"#", "", ""},
+	"EditorConfig":       {"#", "", ""},
+}
+
+// defaultComment is the comment style assumed for unknown languages.
+var defaultComment = Comment{"//", "/*", "*/"}
+
+// rename returns the name llmsp uses for a language detected by enry.
+func rename(language string) string {
+	if name, ok := renamed[language]; ok {
+		return name
+	}
+	return language
+}
+
+// choose returns the language of a file among the candidates enry detected.
+// Several candidates are narrowed down by enry's content heuristics, and
+// then by the preferred language of the extension.
+func choose(filename, content string, candidates []string) string {
+	switch len(candidates) {
+	case 0:
+		return ""
+	case 1:
+		return rename(candidates[0])
+	}
+
+	if content != "" {
+		if len(content) > maxHeuristicBytes {
+			content = content[:maxHeuristicBytes]
+		}
+		if languages := enry.GetLanguagesByContent(filename, []byte(content), candidates); len(languages) == 1 {
+			return rename(languages[0])
+		}
+	}
+	if language, ok := preferred[strings.ToLower(path.Ext(filename))]; ok {
+		for _, candidate := range candidates {
+			if candidate == language {
+				return rename(language)
+			}
+		}
+	}
+	sorted := append([]string(nil), candidates...)
+	sort.Strings(sorted)
+	return rename(sorted[0])
+}
+
+// ByFilename returns the language of a file from its name, or "" if the name
+// doesn't tell.
+func ByFilename(filename string) string {
+	if candidates := enry.GetLanguagesByFilename(filename, nil, nil); len(candidates) > 0 {
+		return choose(filename, "", candidates)
+	}
+	return choose(filename, "", enry.GetLanguagesByExtension(filename, nil, nil))
+}
+
+// ByShebang returns the language of the interpreter named in the shebang line
+// of content, or "" if there is none.
+func ByShebang(content string) string {
+	return choose("", "", enry.GetLanguagesByShebang("", []byte(content), nil))
+}
+
+// Detect returns the language of a file from its name and content. It
+// returns "" if the language can't be detected.
+func Detect(filename, content string) string {
+	if candidates := enry.GetLanguagesByFilename(filename, nil, nil); len(candidates) > 0 {
+		return choose(filename, content, candidates)
+	}
+	if language := ByShebang(content); language != "" {
+		return language
+	}
+	return choose(filename, content, enry.GetLanguagesByExtension(filename, nil, nil))
+}
+
+// CommentStyle returns the comment style of the language. Unknown languages
+// are assumed to use C style comments.
+func CommentStyle(language string) Comment {
+	if comment, ok := comments[language]; ok {
+		return comment
+	}
+	return defaultComment
+}
+
+// ByName returns the language with the given name or alias, ignoring case,
+// or the language of the given extension or interpreter. For example
+// "python", "py", ".py" and "python3" are all Python. It returns "" for
+// unknown names.
+func ByName(name string) string {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return ""
+	}
+	for _, language := range renamed {
+		if strings.EqualFold(language, name) {
+			return language
+		}
+	}
+	if language, ok := enry.GetLanguageByAlias(name); ok {
+		return rename(language)
+	}
+	if language := choose("", "", enry.GetLanguagesByExtension("file."+strings.TrimPrefix(name, "."), nil, nil)); language != "" {
+		return language
+	}
+	return choose("", "", data.LanguagesByInterpreter[strings.ToLower(name)])
+}
+
+// Extension returns the primary extension of files of the language, e.g.
+// ".py" for Python. It returns "" for unknown languages.
+func Extension(language string) string {
+	for name, renamed := range renamed {
+		if renamed == language {
+			language = name
+		}
+	}
+	if extensions := enry.GetLanguageExtensions(language); len(extensions) > 0 {
+		return extensions[0]
+	}
+	return ""
+}
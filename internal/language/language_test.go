@@ -0,0 +1,93 @@
+package language
+
+import "testing"
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		filename string
+		content  string
+		want     string
+	}{
+		{"main.go", "", "Go"},
+		{"lib.RS", "", "Rust"},
+		{"/src/Dockerfile", "", "Dockerfile"},
+		{"CMakeLists.txt", "", "CMake"},
+		{"notes.txt", "", "Text"},
+		{"deploy", "#!/bin/bash\nset -e\n", "Shell"},
+		{"tool", "#!/usr/bin/env -S python3.11 -u\n", "Python"},
+		{"server", "#!/usr/bin/env node\n", "JavaScript"},
+		{"data", "#!/usr/bin/env unknown\n", ""},
+		{"data", "no shebang", ""},
+		// Extensions of several languages
+		{"main.rs", "", "Rust"},
+		{"config.yml", "", "YAML"},
+		{"widget.h", "", "C"},
+		{"widget.h", "#include <string>\n\nnamespace ui {\nclass Widget {};\n}\n", "C++"},
+		{"App.tsx", "", "TypeScript React"},
+	}
+	for _, test := range tests {
+		if got := Detect(test.filename, test.content); got != test.want {
+			t.Errorf("Detect(%q, %q) == %q, want %q", test.filename, test.content, got, test.want)
+		}
+	}
+}
+
+func TestCommentStyle(t *testing.T) {
+	tests := []struct {
+		language string
+		want     string
+	}{
+		{"Go", "//"},
+		{"Shell", "#"},
+		{"Haskell", "--"},
+		{"SQL", "--"},
+		{"HTML", "<!--"},
+		{"OCaml", "(*"},
+		{"Unknown", "//"},
+	}
+	for _, test := range tests {
+		if got := CommentStyle(test.language).Prefix(); got != test.want {
+			t.Errorf("CommentStyle(%q).Prefix() == %q, want %q", test.language, got, test.want)
+		}
+	}
+
+	// The preferred languages of extensions have a comment style
+	for _, language := range preferred {
+		if _, ok := comments[rename(language)]; !ok && language != "JSON" && language != "Text" {
+			t.Errorf("no comment style for %s", language)
+		}
+	}
+}
+
+func TestByName(t *testing.T) {
+	for name, want := range map[string]string{
+		"Python":           "Python",
+		"typescript":       "TypeScript",
+		"c++":              "C++",
+		"rs":               "Rust",
+		".JS":              "JavaScript",
+		"python3":          "Python",
+		"golang":           "Go",
+		"TypeScript React": "TypeScript React",
+		"klingon":          "",
+	} {
+		if got := ByName(name); got != want {
+			t.Errorf("ByName(%q) == %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestExtension(t *testing.T) {
+	for language, want := range map[string]string{
+		"Python":           ".py",
+		"JavaScript":       ".js",
+		"C":                ".c",
+		"Go":               ".go",
+		"TypeScript React": ".tsx",
+		"Unknown":          "",
+	} {
+		if got := Extension(language); got != want {
+			t.Errorf("Extension(%q) == %q, want %q", language, got, want)
+		}
+	}
+}
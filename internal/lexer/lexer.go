@@ -0,0 +1,166 @@
+// Package lexer tells whether a position in source code is in a comment or a
+// string literal.
+//
+// It isn't a real tokenizer: the text before the position is scanned for the
+// comment markers of the language, as known by the language package, and for
+// its string delimiters. Things like heredocs, regular expression literals
+// and string interpolation aren't recognized, so the answer is a guess, good
+// enough to decide whether to ask for a completion.
+package lexer
+
+import (
+	"strings"
+
+	"github.com/pjlast/llmsp/internal/language"
+)
+
+// Kind is the kind of text at a position.
+type Kind int
+
+const (
+	// Code is anything that isn't a comment or a string
+	Code Kind = iota
+	// Comment is a line or block comment, including its markers
+	Comment
+	// String is a string or character literal, after its opening delimiter
+	String
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Comment:
+		return "comment"
+	case String:
+		return "string"
+	}
+	return "code"
+}
+
+// quote describes a kind of string literal.
+type quote struct {
+	// delim opens and closes the string
+	delim string
+	// raw is set for strings without backslash escapes
+	raw bool
+	// multiline is set for strings that may span lines, other strings end
+	// at the end of the line if they aren't closed
+	multiline bool
+}
+
+var (
+	doubleQuote = quote{delim: `"`}
+	singleQuote = quote{delim: `'`}
+)
+
+// defaultQuotes are the string delimiters of languages not in quotes.
+var defaultQuotes = []quote{doubleQuote, singleQuote}
+
+// quotes maps languages to their string delimiters. Longer delimiters come
+// first, as they start with the shorter ones. Languages where ' isn't always
+// a delimiter, such as Rust lifetimes or Haskell primes, only have ".
+var quotes = map[string][]quote{
+	"Go":                {{delim: "`", raw: true, multiline: true}, doubleQuote, singleQuote},
+	"Python":            {{delim: `"""`, multiline: true}, {delim: `'''`, multiline: true}, doubleQuote, singleQuote},
+	"JavaScript":        {{delim: "`", multiline: true}, doubleQuote, singleQuote},
+	"TypeScript":        {{delim: "`", multiline: true}, doubleQuote, singleQuote},
+	"TypeScript React":  {{delim: "`", multiline: true}, doubleQuote, singleQuote},
+	"Java":              {{delim: `"""`, multiline: true}, doubleQuote, singleQuote},
+	"Kotlin":            {{delim: `"""`, raw: true, multiline: true}, doubleQuote, singleQuote},
+	"Scala":             {{delim: `"""`, raw: true, multiline: true}, doubleQuote, singleQuote},
+	"Swift":             {{delim: `"""`, multiline: true}, doubleQuote},
+	"Rust":              {{delim: `"`, multiline: true}},
+	"Shell":             {{delim: `'`, raw: true, multiline: true}, {delim: `"`, multiline: true}},
+	"fish":              {{delim: `'`, multiline: true}, {delim: `"`, multiline: true}},
+	"Haskell":           {doubleQuote},
+	"Elm":               {{delim: `"""`, multiline: true}, doubleQuote},
+	"OCaml":             {doubleQuote},
+	"F#":                {{delim: `"""`, raw: true, multiline: true}, doubleQuote},
+	"Clojure":           {{delim: `"`, multiline: true}},
+	"Common Lisp":       {{delim: `"`, multiline: true}},
+	"Emacs Lisp":        {{delim: `"`, multiline: true}},
+	"Scheme":            {{delim: `"`, multiline: true}},
+	"Racket":            {{delim: `"`, multiline: true}},
+	"Visual Basic .NET": {{delim: `"`, raw: true}},
+	"Vim Script":        {{delim: `'`, raw: true}},
+	"SQL":               {{delim: `'`, raw: true, multiline: true}},
+	"Markdown":          nil,
+	"reStructuredText":  nil,
+	"TeX":               nil,
+}
+
+// At returns the kind of text at offset, a byte offset in text, which is
+// source code in the language, as named by the language package. Unknown
+// languages get C style comments and both kinds of quotes.
+func At(lang, text string, offset int) Kind {
+	if offset > len(text) {
+		offset = len(text)
+	}
+	comment := language.CommentStyle(lang)
+	delims, ok := quotes[lang]
+	if !ok {
+		delims = defaultQuotes
+	}
+
+	for i := 0; i < offset; {
+		rest := text[i:]
+		// Block comments first, in Lua they start with a line comment
+		if comment.BlockStart != "" && strings.HasPrefix(rest, comment.BlockStart) {
+			n := strings.Index(rest[len(comment.BlockStart):], comment.BlockEnd)
+			if n < 0 {
+				return Comment
+			}
+			i += len(comment.BlockStart) + n + len(comment.BlockEnd)
+			if offset < i {
+				return Comment
+			}
+			continue
+		}
+		if comment.Line != "" && strings.HasPrefix(rest, comment.Line) {
+			n := strings.IndexByte(rest, '\n')
+			if n < 0 || i+n >= offset {
+				return Comment
+			}
+			i += n
+			continue
+		}
+		if q, ok := quoteAt(delims, rest); ok {
+			end, closed := q.end(text, i+len(q.delim))
+			if offset < end || (!closed && offset == end) {
+				return String
+			}
+			i = end
+			continue
+		}
+		i++
+	}
+	return Code
+}
+
+// quoteAt returns the string delimiter s starts with.
+func quoteAt(delims []quote, s string) (quote, bool) {
+	for _, q := range delims {
+		if strings.HasPrefix(s, q.delim) {
+			return q, true
+		}
+	}
+	return quote{}, false
+}
+
+// end returns the offset after the string starting at start, the offset
+// after its opening delimiter, and whether it is closed. Strings that aren't
+// closed end at the end of the line, or of the text for multiline strings.
+func (q quote) end(text string, start int) (int, bool) {
+	for i := start; i < len(text); {
+		switch {
+		case !q.raw && text[i] == '\\':
+			i += 2
+		case strings.HasPrefix(text[i:], q.delim):
+			return i + len(q.delim), true
+		case text[i] == '\n' && !q.multiline:
+			return i, false
+		default:
+			i++
+		}
+	}
+	return len(text), false
+}
@@ -0,0 +1,60 @@
+package lexer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAt(t *testing.T) {
+	// | marks the offset
+	tests := []struct {
+		lang string
+		text string
+		want Kind
+	}{
+		{"Go", "func main() {\n\t|\n}", Code},
+		{"Go", "// Package main |\npackage main", Comment},
+		{"Go", "// comment\n|", Code},
+		{"Go", "x := 1 // one|", Comment},
+		{"Go", "/* a\n b| */", Comment},
+		{"Go", "/* a */|", Code},
+		{"Go", "/* unterminated\n|", Comment},
+		{"Go", `s := "a // b|"`, String},
+		{"Go", `s := "a \" b|"`, String},
+		{"Go", `s := "a"|`, Code},
+		{"Go", `s := "|`, String},
+		{"Go", "s := \"unterminated\nx|", Code},
+		{"Go", "s := `raw\n|`", String},
+		{"Go", "s := `raw \\`|", Code},
+		{"Go", "r := '\"'|", Code},
+		{"Go", `s := "/* not a comment"|`, Code},
+		{"Python", "# comment|", Comment},
+		{"Python", "x = 1  # |\ny = 2", Comment},
+		{"Python", "s = \"\"\"doc\n|\"\"\"", String},
+		{"Python", "s = '''doc'''|", Code},
+		{"Python", "s = '#'|", Code},
+		{"Rust", "fn f<'a>(s: &'a str) {|", Code},
+		{"Rust", `let s = "it's|";`, String},
+		{"Shell", `echo 'no \ escape' |`, Code},
+		{"Lua", "--[[ block\n|]]", Comment},
+		{"Lua", "--[[ block ]] x|", Code},
+		{"Lua", "-- line|", Comment},
+		{"HTML", "<p>|</p>", Code},
+		{"HTML", "<!-- |", Comment},
+		{"Vim Script", `" comment|`, Comment},
+		{"", "/* unknown languages have C comments| */", Comment},
+	}
+	for _, test := range tests {
+		offset := strings.Index(test.text, "|")
+		text := strings.Replace(test.text, "|", "", 1)
+		if got := At(test.lang, text, offset); got != test.want {
+			t.Errorf("At(%q, %q) == %s, want %s", test.lang, test.text, got, test.want)
+		}
+	}
+}
+
+func TestAtOutOfRange(t *testing.T) {
+	if got := At("Go", "// comment", 100); got != Comment {
+		t.Errorf("At() past the end == %s, want the kind at the end", got)
+	}
+}
@@ -0,0 +1,192 @@
+// Package logging is a small leveled, structured logger.
+//
+// Every entry has a level, a message and key-value fields, and is written as
+// a single line:
+//
+//	2023-06-01T12:00:00.000Z INFO request handled method=initialize duration=12ms
+//
+// Entries can additionally be mirrored to a function, which the server uses
+// to forward them to the client as window/logMessage notifications.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log entry.
+type Level int
+
+// Log levels, from least to most severe.
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("LEVEL(%d)", int(l))
+}
+
+// ParseLevel parses a level name such as "debug" or "WARN".
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q", name)
+}
+
+// Logger writes entries at or above its level to its output and mirror. The
+// zero value discards all entries.
+type Logger struct {
+	mu     sync.Mutex
+	level  Level
+	out    io.Writer
+	mirror func(Level, string)
+	// redact removes secrets from entries
+	redact func(string) string
+	// now returns the current time, it is replaced in tests
+	now func() time.Time
+}
+
+// New returns a logger writing entries at or above level to out.
+func New(out io.Writer, level Level) *Logger {
+	return &Logger{out: out, level: level}
+}
+
+// SetLevel sets the minimum level of entries that are logged.
+func (l *Logger) SetLevel(level Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.level = level
+}
+
+// Level returns the minimum level of entries that are logged.
+func (l *Logger) Level() Level {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.level
+}
+
+// SetOutput sets the writer entries are written to. A nil writer discards
+// them. The previous output is returned, so that it can be closed.
+func (l *Logger) SetOutput(out io.Writer) io.Writer {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	previous := l.out
+	l.out = out
+	return previous
+}
+
+// SetMirror sets a function every logged entry is passed to, in addition to
+// being written to the output. A nil function disables mirroring.
+func (l *Logger) SetMirror(mirror func(Level, string)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.mirror = mirror
+}
+
+// SetRedactor sets a function that removes secrets from entries before they
+// are written or mirrored. A nil function logs entries as they are.
+func (l *Logger) SetRedactor(redact func(string) string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.redact = redact
+}
+
+// Debug logs a message at debug level. fields are alternating keys and
+// values.
+func (l *Logger) Debug(msg string, fields ...any) { l.Log(LevelDebug, msg, fields...) }
+
+// Info logs a message at info level.
+func (l *Logger) Info(msg string, fields ...any) { l.Log(LevelInfo, msg, fields...) }
+
+// Warn logs a message at warn level.
+func (l *Logger) Warn(msg string, fields ...any) { l.Log(LevelWarn, msg, fields...) }
+
+// Error logs a message at error level.
+func (l *Logger) Error(msg string, fields ...any) { l.Log(LevelError, msg, fields...) }
+
+// Log logs a message at the given level. fields are alternating keys and
+// values.
+func (l *Logger) Log(level Level, msg string, fields ...any) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	if level < l.level || (l.out == nil && l.mirror == nil) {
+		l.mu.Unlock()
+		return
+	}
+	now := time.Now
+	if l.now != nil {
+		now = l.now
+	}
+	entry := msg + formatFields(fields)
+	if l.redact != nil {
+		entry = l.redact(entry)
+	}
+	if l.out != nil {
+		fmt.Fprintf(l.out, "%s %s %s\n", now().UTC().Format("2006-01-02T15:04:05.000Z07:00"), level, entry)
+	}
+	mirror := l.mirror
+	l.mu.Unlock()
+
+	// The mirror is called without holding the lock, so that it may log
+	if mirror != nil {
+		mirror(level, entry)
+	}
+}
+
+// formatFields formats key-value pairs as " key=value key=value". Values
+// containing spaces or quotes are quoted, and a trailing key without a value
+// is logged with the value "MISSING".
+func formatFields(fields []any) string {
+	var b strings.Builder
+	for i := 0; i < len(fields); i += 2 {
+		var value any = "MISSING"
+		if i+1 < len(fields) {
+			value = fields[i+1]
+		}
+		fmt.Fprintf(&b, " %v=%s", fields[i], formatValue(value))
+	}
+	return b.String()
+}
+
+func formatValue(value any) string {
+	var s string
+	switch value := value.(type) {
+	case error:
+		s = value.Error()
+	case time.Duration:
+		s = value.Round(time.Millisecond).String()
+	default:
+		s = fmt.Sprint(value)
+	}
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		return fmt.Sprintf("%q", s)
+	}
+	return s
+}
@@ -0,0 +1,103 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogger(t *testing.T) {
+	var out bytes.Buffer
+	logger := New(&out, LevelInfo)
+	logger.now = func() time.Time { return time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC) }
+
+	var mirrored []string
+	logger.SetMirror(func(level Level, entry string) {
+		mirrored = append(mirrored, level.String()+" "+entry)
+	})
+
+	logger.Debug("hidden")
+	logger.Info("request handled", "method", "initialize", "duration", 12*time.Millisecond)
+	logger.Error("failed", "err", errors.New("no such file"), "dangling")
+
+	want := "2023-06-01T12:00:00.000Z INFO request handled method=initialize duration=12ms\n" +
+		"2023-06-01T12:00:00.000Z ERROR failed err=\"no such file\" dangling=MISSING\n"
+	if got := out.String(); got != want {
+		t.Errorf("logged %q, want %q", got, want)
+	}
+	if len(mirrored) != 2 || mirrored[0] != "INFO request handled method=initialize duration=12ms" {
+		t.Errorf("mirrored %q, want the two entries at or above info", mirrored)
+	}
+
+	out.Reset()
+	logger.SetLevel(LevelDebug)
+	logger.Debug("shown")
+	if !strings.Contains(out.String(), "DEBUG shown") {
+		t.Errorf("logged %q after SetLevel(LevelDebug), want the debug entry", out.String())
+	}
+}
+
+func TestRedactor(t *testing.T) {
+	var out bytes.Buffer
+	logger := New(&out, LevelInfo)
+	var mirrored string
+	logger.SetMirror(func(_ Level, entry string) { mirrored = entry })
+	logger.SetRedactor(func(entry string) string { return strings.ReplaceAll(entry, "sgp_secret", "[REDACTED]") })
+
+	logger.Info("authenticating", "token", "sgp_secret")
+	if strings.Contains(out.String(), "sgp_secret") || mirrored != "authenticating token=[REDACTED]" {
+		t.Errorf("logged %q and mirrored %q, want the token redacted", out.String(), mirrored)
+	}
+}
+
+func TestZeroLogger(t *testing.T) {
+	var logger Logger
+	logger.Error("discarded")
+
+	var nilLogger *Logger
+	nilLogger.Error("discarded")
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := map[string]Level{"debug": LevelDebug, "INFO": LevelInfo, "warning": LevelWarn, "error": LevelError}
+	for name, want := range tests {
+		if got, err := ParseLevel(name); err != nil || got != want {
+			t.Errorf("ParseLevel(%q) == (%v, %v), want %v", name, got, err, want)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("ParseLevel(\"verbose\") succeeded, want an error")
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "llmsp.log")
+	f, err := OpenRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for file, want := range map[string]string{path: "fourth\n", path + ".1": "third\n", path + ".2": "second\n"} {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want {
+			t.Errorf("%s contains %q, want %q", filepath.Base(file), data, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("%s.3 exists, want at most 2 backups", filepath.Base(path))
+	}
+}
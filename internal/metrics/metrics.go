@@ -0,0 +1,371 @@
+// Package metrics counts what the server does, such as requests, LLM
+// latencies and tokens, and exposes the counts in the Prometheus text format
+// and as JSON.
+//
+// Only counters and histograms are supported, which is all the server
+// needs. Metrics are registered by name, registering a name again returns
+// the existing metric, so that the servers of socket mode share them. All
+// methods are safe to call on nil registries and metrics, which do nothing.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Default is the registry of the process.
+var Default = NewRegistry()
+
+// DefaultBuckets are the upper bounds of the buckets of latency
+// histograms, in seconds.
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// CacheLookups returns the counter of lookups in the caches of the server
+// and of the provider, by cache and result, hit or miss.
+func CacheLookups(r *Registry) *Counter {
+	return r.Counter("llmsp_cache_lookups_total", "Cache lookups by cache and result.", "cache", "result")
+}
+
+// HitOrMiss returns the result label of a cache lookup.
+func HitOrMiss(hit bool) string {
+	if hit {
+		return "hit"
+	}
+	return "miss"
+}
+
+// Registry holds metrics.
+type Registry struct {
+	mu      sync.Mutex
+	metrics map[string]metric
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]metric)}
+}
+
+// metric is a counter or a histogram.
+type metric interface {
+	family() Family
+}
+
+// register returns the metric registered with the name, or registers the
+// one returned by create.
+func (r *Registry) register(name string, create func() metric) metric {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if m, ok := r.metrics[name]; ok {
+		return m
+	}
+	m := create()
+	r.metrics[name] = m
+	return m
+}
+
+// Counter returns the counter with the name, registering it with its help
+// text and label names if needed.
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	if r == nil {
+		return nil
+	}
+	m := r.register(name, func() metric {
+		return &Counter{desc: desc{name, help, labels}, values: make(map[string]float64)}
+	})
+	c, ok := m.(*Counter)
+	if !ok {
+		panic(fmt.Sprintf("metrics: %s is already registered as a histogram", name))
+	}
+	return c
+}
+
+// Histogram returns the histogram with the name, registering it with its
+// help text, bucket upper bounds and label names if needed.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if r == nil {
+		return nil
+	}
+	m := r.register(name, func() metric {
+		return &Histogram{desc: desc{name, help, labels}, buckets: buckets, series: make(map[string]*histogramSeries)}
+	})
+	h, ok := m.(*Histogram)
+	if !ok {
+		panic(fmt.Sprintf("metrics: %s is already registered as a counter", name))
+	}
+	return h
+}
+
+// Snapshot returns the current values of the metrics, sorted by name.
+func (r *Registry) Snapshot() []Family {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	metrics := make([]metric, 0, len(r.metrics))
+	for _, m := range r.metrics {
+		metrics = append(metrics, m)
+	}
+	r.mu.Unlock()
+
+	families := make([]Family, 0, len(metrics))
+	for _, m := range metrics {
+		families = append(families, m.family())
+	}
+	sort.Slice(families, func(i, j int) bool { return families[i].Name < families[j].Name })
+	return families
+}
+
+// WriteText writes the metrics in the Prometheus text exposition format.
+func (r *Registry) WriteText(w io.Writer) error {
+	var b strings.Builder
+	for _, f := range r.Snapshot() {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", f.Name, f.Help, f.Name, f.Type)
+		for _, s := range f.Series {
+			if f.Type == TypeCounter {
+				fmt.Fprintf(&b, "%s%s %s\n", f.Name, labelText(s.Labels, "", ""), formatFloat(s.Value))
+				continue
+			}
+			for _, bucket := range s.Buckets {
+				fmt.Fprintf(&b, "%s_bucket%s %d\n", f.Name, labelText(s.Labels, "le", formatFloat(bucket.UpperBound)), bucket.Count)
+			}
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", f.Name, labelText(s.Labels, "le", "+Inf"), s.Count)
+			fmt.Fprintf(&b, "%s_sum%s %s\n", f.Name, labelText(s.Labels, "", ""), formatFloat(s.Sum))
+			fmt.Fprintf(&b, "%s_count%s %d\n", f.Name, labelText(s.Labels, "", ""), s.Count)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Handler returns an HTTP handler serving the metrics in the Prometheus
+// text exposition format.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = r.WriteText(w)
+	})
+}
+
+// Types of metrics.
+const (
+	TypeCounter   = "counter"
+	TypeHistogram = "histogram"
+)
+
+// Family is a metric and the values of its series, the result of the
+// llmsp/metrics request.
+type Family struct {
+	Name   string   `json:"name"`
+	Help   string   `json:"help"`
+	Type   string   `json:"type"`
+	Series []Series `json:"series"`
+}
+
+// Series is the value of a metric for a combination of label values.
+type Series struct {
+	Labels map[string]string `json:"labels,omitempty"`
+	// Value is the value of counters
+	Value float64 `json:"value,omitempty"`
+	// Count, Sum and Buckets are the number and sum of the observations of
+	// histograms, and the number of observations in each bucket, which
+	// includes the observations of the previous ones
+	Count   uint64   `json:"count,omitempty"`
+	Sum     float64  `json:"sum,omitempty"`
+	Buckets []Bucket `json:"buckets,omitempty"`
+}
+
+// Bucket counts the observations of a histogram up to its upper bound.
+type Bucket struct {
+	UpperBound float64 `json:"le"`
+	Count      uint64  `json:"count"`
+}
+
+// desc describes a metric.
+type desc struct {
+	name, help string
+	labels     []string
+}
+
+// key returns the key of the series with the label values. Missing values
+// are empty, extra values are ignored.
+func (d desc) key(values []string) string {
+	padded := make([]string, len(d.labels))
+	copy(padded, values)
+	return strings.Join(padded, "\x00")
+}
+
+// labelMap returns the labels of the series with the key.
+func (d desc) labelMap(key string) map[string]string {
+	if len(d.labels) == 0 {
+		return nil
+	}
+	values := strings.Split(key, "\x00")
+	labels := make(map[string]string, len(d.labels))
+	for i, name := range d.labels {
+		labels[name] = values[i]
+	}
+	return labels
+}
+
+// Counter is a value that only goes up, for each combination of label
+// values.
+type Counter struct {
+	desc
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// Inc adds 1 to the series with the label values.
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds v to the series with the label values.
+func (c *Counter) Add(v float64, values ...string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[c.key(values)] += v
+}
+
+// Value returns the value of the series with the label values.
+func (c *Counter) Value(values ...string) float64 {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[c.key(values)]
+}
+
+func (c *Counter) family() Family {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f := Family{Name: c.name, Help: c.help, Type: TypeCounter, Series: []Series{}}
+	for _, key := range sortedKeys(c.values) {
+		f.Series = append(f.Series, Series{Labels: c.labelMap(key), Value: c.values[key]})
+	}
+	return f
+}
+
+// Histogram counts observations, such as latencies, in buckets, for each
+// combination of label values.
+type Histogram struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	// counts are the number of observations in each bucket, excluding the
+	// previous ones
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Observe adds an observation to the series with the label values.
+func (h *Histogram) Observe(v float64, values ...string) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := h.key(values)
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	s.count++
+	s.sum += v
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+}
+
+// Count returns the number of observations of the series with the label
+// values.
+func (h *Histogram) Count(values ...string) uint64 {
+	if h == nil {
+		return 0
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s, ok := h.series[h.key(values)]; ok {
+		return s.count
+	}
+	return 0
+}
+
+func (h *Histogram) family() Family {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	f := Family{Name: h.name, Help: h.help, Type: TypeHistogram, Series: []Series{}}
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := h.series[key]
+		series := Series{Labels: h.labelMap(key), Count: s.count, Sum: s.sum}
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			series.Buckets = append(series.Buckets, Bucket{UpperBound: bound, Count: cumulative})
+		}
+		f.Series = append(f.Series, series)
+	}
+	return f
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// labelText formats labels, and an extra label if name isn't empty, as
+// {name="value",...}, or returns "" without labels.
+func labelText(labels map[string]string, name, value string) string {
+	var pairs []string
+	for _, label := range sortedLabels(labels) {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", label, strconv.Quote(labels[label])))
+	}
+	if name != "" {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", name, value))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func sortedLabels(labels map[string]string) []string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+	requests := r.Counter("llmsp_requests_total", "Requests handled.", "method")
+	requests.Inc("textDocument/completion")
+	requests.Inc("textDocument/completion")
+	requests.Add(3, "textDocument/hover")
+	latency := r.Histogram("llmsp_llm_request_duration_seconds", "LLM latency.", []float64{0.1, 1}, "model")
+	latency.Observe(0.05, "claude-2")
+	latency.Observe(0.5, "claude-2")
+	latency.Observe(2, "claude-2")
+
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP llmsp_llm_request_duration_seconds LLM latency.
+# TYPE llmsp_llm_request_duration_seconds histogram
+llmsp_llm_request_duration_seconds_bucket{model="claude-2",le="0.1"} 1
+llmsp_llm_request_duration_seconds_bucket{model="claude-2",le="1"} 2
+llmsp_llm_request_duration_seconds_bucket{model="claude-2",le="+Inf"} 3
+llmsp_llm_request_duration_seconds_sum{model="claude-2"} 2.55
+llmsp_llm_request_duration_seconds_count{model="claude-2"} 3
+# HELP llmsp_requests_total Requests handled.
+# TYPE llmsp_requests_total counter
+llmsp_requests_total{method="textDocument/completion"} 2
+llmsp_requests_total{method="textDocument/hover"} 3
+`
+	if b.String() != want {
+		t.Errorf("WriteText() ==\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestRegisterTwice(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("llmsp_errors_total", "Errors.", "method").Inc("shutdown")
+	// The servers of socket mode share their metrics
+	if got := r.Counter("llmsp_errors_total", "Errors.", "method").Value("shutdown"); got != 1 {
+		t.Errorf("counter registered again == %v, want 1", got)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a counter as a histogram didn't panic")
+		}
+	}()
+	r.Histogram("llmsp_errors_total", "Errors.", DefaultBuckets)
+}
+
+func TestNil(t *testing.T) {
+	var r *Registry
+	c := r.Counter("c", "")
+	c.Inc()
+	h := r.Histogram("h", "", DefaultBuckets)
+	h.Observe(1)
+	if c.Value() != 0 || h.Count() != 0 || r.Snapshot() != nil {
+		t.Error("nil metrics counted something")
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("llmsp_cache_lookups_total", "Cache lookups.", "cache", "result").Inc("hover", "hit")
+	r.Histogram("llmsp_request_duration_seconds", "Latency.", []float64{1}).Observe(0.5)
+
+	data, err := json.Marshal(r.Snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"name":"llmsp_cache_lookups_total","help":"Cache lookups.","type":"counter","series":[{"labels":{"cache":"hover","result":"hit"},"value":1}]},` +
+		`{"name":"llmsp_request_duration_seconds","help":"Latency.","type":"histogram","series":[{"count":1,"sum":0.5,"buckets":[{"le":1,"count":1}]}]}]`
+	if string(data) != want {
+		t.Errorf("Snapshot() ==\n%s\nwant\n%s", data, want)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("llmsp_requests_total", "Requests handled.", "method").Inc("initialize")
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("content type == %q, want text/plain", ct)
+	}
+	if !strings.Contains(rec.Body.String(), `llmsp_requests_total{method="initialize"} 1`) {
+		t.Errorf("body == %q, want the request counter", rec.Body.String())
+	}
+}
@@ -0,0 +1,92 @@
+// Package position converts between LSP positions and byte offsets.
+//
+// LSP positions count the characters of a line in UTF-16 code units, while
+// Go strings are indexed by bytes. The two only agree for ASCII text: a
+// character like é is one code unit but two bytes, and an emoji is two code
+// units but four bytes. Every position sent to or received from the client
+// goes through this package.
+package position
+
+import (
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/sourcegraph/go-lsp"
+)
+
+// Len returns the length of s in UTF-16 code units.
+func Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+// Offset returns the byte offset of pos in text. Positions past the end of a
+// line are clamped to the end of that line, and positions past the end of
+// the text to the end of the text. A position in the middle of a surrogate
+// pair is moved to the end of the pair.
+func Offset(text string, pos lsp.Position) int {
+	offset := 0
+	for line := 0; line < pos.Line; line++ {
+		i := strings.IndexByte(text[offset:], '\n')
+		if i == -1 {
+			return len(text)
+		}
+		offset += i + 1
+	}
+
+	for units := 0; units < pos.Character && offset < len(text); {
+		r, size := utf8.DecodeRuneInString(text[offset:])
+		if r == '\n' {
+			break
+		}
+		units += utf16.RuneLen(r)
+		offset += size
+	}
+	return offset
+}
+
+// Of returns the position of the byte offset in text. Offsets in the middle
+// of a rune are moved to its start.
+func Of(text string, offset int) lsp.Position {
+	if offset > len(text) {
+		offset = len(text)
+	}
+	for offset > 0 && offset < len(text) && !utf8.RuneStart(text[offset]) {
+		offset--
+	}
+	before := text[:offset]
+	lineStart := strings.LastIndexByte(before, '\n') + 1
+	return lsp.Position{
+		Line:      strings.Count(before, "\n"),
+		Character: Len(before[lineStart:]),
+	}
+}
+
+// End returns the position of the end of text.
+func End(text string) lsp.Position {
+	return Of(text, len(text))
+}
+
+// LineEnd returns the position of the end of the line of text, or of the
+// end of text if it has fewer lines.
+func LineEnd(text string, line int) lsp.Position {
+	lines := strings.Split(text, "\n")
+	if line >= len(lines) {
+		return End(text)
+	}
+	return lsp.Position{Line: line, Character: Len(lines[line])}
+}
+
+// After returns the position following text when it is inserted at start.
+func After(start lsp.Position, text string) lsp.Position {
+	end := End(text)
+	if end.Line == 0 {
+		end.Character += start.Character
+	}
+	end.Line += start.Line
+	return end
+}
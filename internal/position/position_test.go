@@ -0,0 +1,73 @@
+package position
+
+import (
+	"testing"
+
+	"github.com/sourcegraph/go-lsp"
+)
+
+const text = "// Grüße\nx := \"😀😀\"\nfunc 你好() {}"
+
+func TestLen(t *testing.T) {
+	for s, want := range map[string]int{
+		"":           0,
+		"abc":        3,
+		"Grüße":      5,
+		"😀":          2,
+		"你好()":       4,
+		"x := \"😀\"": 9,
+	} {
+		if got := Len(s); got != want {
+			t.Errorf("Len(%q) == %d, want %d", s, got, want)
+		}
+	}
+}
+
+func TestOffsetAndOf(t *testing.T) {
+	for _, test := range []struct {
+		pos    lsp.Position
+		offset int
+	}{
+		{lsp.Position{Line: 0, Character: 0}, 0},
+		{lsp.Position{Line: 0, Character: 6}, 7},   // after "// Grü"
+		{lsp.Position{Line: 0, Character: 8}, 10},  // end of the line
+		{lsp.Position{Line: 1, Character: 6}, 17},  // before the first emoji
+		{lsp.Position{Line: 1, Character: 8}, 21},  // between the emojis
+		{lsp.Position{Line: 1, Character: 11}, 26}, // end of the line
+		{lsp.Position{Line: 2, Character: 7}, 38},  // after "func 你好"
+	} {
+		if got := Offset(text, test.pos); got != test.offset {
+			t.Errorf("Offset(%+v) == %d, want %d", test.pos, got, test.offset)
+		}
+		if got := Of(text, test.offset); got != test.pos {
+			t.Errorf("Of(%d) == %+v, want %+v", test.offset, got, test.pos)
+		}
+	}
+
+	// Positions are clamped to the line and the text
+	if got := Offset(text, lsp.Position{Line: 0, Character: 100}); got != 10 {
+		t.Errorf("Offset() past the end of the line == %d, want 10", got)
+	}
+	if got := Offset(text, lsp.Position{Line: 10}); got != len(text) {
+		t.Errorf("Offset() past the end of the text == %d, want %d", got, len(text))
+	}
+	// Offsets within a rune are moved to its start
+	if got := Of(text, 18); got != (lsp.Position{Line: 1, Character: 6}) {
+		t.Errorf("Of() within an emoji == %+v, want 1:6", got)
+	}
+}
+
+func TestEnds(t *testing.T) {
+	if got, want := End(text), (lsp.Position{Line: 2, Character: 12}); got != want {
+		t.Errorf("End() == %+v, want %+v", got, want)
+	}
+	if got, want := LineEnd(text, 1), (lsp.Position{Line: 1, Character: 11}); got != want {
+		t.Errorf("LineEnd(1) == %+v, want %+v", got, want)
+	}
+	if got, want := After(lsp.Position{Line: 3, Character: 2}, "😀"), (lsp.Position{Line: 3, Character: 4}); got != want {
+		t.Errorf("After() on one line == %+v, want %+v", got, want)
+	}
+	if got, want := After(lsp.Position{Line: 3, Character: 2}, "a\nü"), (lsp.Position{Line: 4, Character: 1}); got != want {
+		t.Errorf("After() across lines == %+v, want %+v", got, want)
+	}
+}
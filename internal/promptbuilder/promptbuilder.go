@@ -0,0 +1,236 @@
+// Package promptbuilder assembles prompts from sections of messages that
+// share the token budget of a model.
+//
+// Sections are placed in the prompt in the order they are added, but the
+// budget is handed out by priority, so that e.g. the question always fits
+// and the interaction history gets what's left. A section that doesn't fit
+// in its part of the budget is trimmed: messages are dropped and the last one
+// kept is truncated, so the prompt never exceeds the budget.
+package promptbuilder
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pjlast/llmsp/claude"
+	"github.com/pjlast/llmsp/internal/tokenizer"
+)
+
+// Budget tracks the tokens spent on a prompt.
+type Budget struct {
+	limit int
+	used  int
+}
+
+// NewBudget returns a budget of limit tokens.
+func NewBudget(limit int) *Budget {
+	if limit < 0 {
+		limit = 0
+	}
+	return &Budget{limit: limit}
+}
+
+// Limit returns the size of the budget.
+func (b *Budget) Limit() int {
+	return b.limit
+}
+
+// Used returns the number of tokens spent.
+func (b *Budget) Used() int {
+	return b.used
+}
+
+// Remaining returns the number of tokens that can still be spent.
+func (b *Budget) Remaining() int {
+	return b.limit - b.used
+}
+
+// Spend spends tokens. It reports false and spends nothing if they don't
+// fit in the remaining budget.
+func (b *Budget) Spend(tokens int) bool {
+	if tokens > b.Remaining() {
+		return false
+	}
+	b.used += tokens
+	return true
+}
+
+// Trim tells which messages of a section are kept if it doesn't fit.
+type Trim int
+
+const (
+	// KeepLast keeps the last messages, like the most recent interactions,
+	// truncating the start of the first one kept. Messages by the assistant
+	// at the start of what is kept are dropped, as the context must start
+	// with a message by the human.
+	KeepLast Trim = iota
+	// KeepFirst keeps the first messages, like the instructions of the
+	// preamble, truncating the end of the last one kept.
+	KeepFirst
+)
+
+// Section is a part of a prompt.
+type Section struct {
+	// Name identifies the section
+	Name     string
+	Messages []claude.Message
+	// Priority orders the allocation of the budget, sections with a higher
+	// priority are allocated first. Sections of equal priority are
+	// allocated in the order they were added.
+	Priority int
+	// Max is the most tokens the section may take, there is no limit
+	// besides the budget if it is 0
+	Max int
+	// Share is the fraction of the budget left when the section is
+	// allocated that it may take, all of it if it is 0
+	Share float64
+	Trim  Trim
+}
+
+// Builder builds a prompt out of sections.
+type Builder struct {
+	budget   *Budget
+	sections []Section
+}
+
+// New returns a builder of prompts spending the budget.
+func New(budget *Budget) *Builder {
+	return &Builder{budget: budget}
+}
+
+// Add appends a section to the prompt.
+func (b *Builder) Add(section Section) {
+	b.sections = append(b.sections, section)
+}
+
+// Build returns the messages of the sections, in the order they were added,
+// each trimmed to its part of the budget. The tokens of the prompt are spent
+// from the budget.
+func (b *Builder) Build() []claude.Message {
+	order := make([]int, len(b.sections))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return b.sections[order[i]].Priority > b.sections[order[j]].Priority
+	})
+
+	fitted := make([][]claude.Message, len(b.sections))
+	for _, i := range order {
+		section := b.sections[i]
+		limit := b.budget.Remaining()
+		if section.Share > 0 {
+			limit = int(float64(limit) * section.Share)
+		}
+		if section.Max > 0 && section.Max < limit {
+			limit = section.Max
+		}
+		messages, tokens := fit(section.Messages, limit, section.Trim)
+		b.budget.Spend(tokens)
+		fitted[i] = messages
+	}
+
+	var messages []claude.Message
+	for _, section := range fitted {
+		messages = append(messages, section...)
+	}
+	return messages
+}
+
+// fit returns the messages that fit in limit tokens, and their length.
+func fit(messages []claude.Message, limit int, trim Trim) ([]claude.Message, int) {
+	if trim == KeepFirst {
+		return fitFirst(messages, limit)
+	}
+	return fitLast(messages, limit)
+}
+
+// fitLast keeps the last messages that fit in limit tokens.
+func fitLast(messages []claude.Message, limit int) ([]claude.Message, int) {
+	var kept []claude.Message
+	tokens := 0
+	for i := len(messages) - 1; i >= 0; i-- {
+		message := messages[i]
+		text, n := truncate(message.Text, limit-tokens, true)
+		if text == "" && message.Text != "" {
+			break
+		}
+		tokens += n
+		if text != message.Text {
+			message.Text = text
+			message.Source = trimSource(message.Source, text, true)
+			kept = append(kept, message)
+			break
+		}
+		kept = append(kept, message)
+	}
+	// Reverse the messages back into their order
+	for i, j := 0, len(kept)-1; i < j; i, j = i+1, j-1 {
+		kept[i], kept[j] = kept[j], kept[i]
+	}
+
+	for len(kept) > 0 && kept[0].Speaker != claude.Human {
+		tokens -= tokenizer.Count(kept[0].Text)
+		kept = kept[1:]
+	}
+	return kept, tokens
+}
+
+// fitFirst keeps the first messages that fit in limit tokens.
+func fitFirst(messages []claude.Message, limit int) ([]claude.Message, int) {
+	var kept []claude.Message
+	tokens := 0
+	for _, message := range messages {
+		text, n := truncate(message.Text, limit-tokens, false)
+		if text == "" && message.Text != "" {
+			break
+		}
+		tokens += n
+		if text != message.Text {
+			message.Text = text
+			message.Source = trimSource(message.Source, text, false)
+			kept = append(kept, message)
+			break
+		}
+		kept = append(kept, message)
+	}
+	return kept, tokens
+}
+
+// truncate returns the longest suffix of text, if keepEnd is set, or prefix
+// otherwise, that is at most maxTokens long, and its length.
+func truncate(text string, maxTokens int, keepEnd bool) (string, int) {
+	for limit := maxTokens; limit > 0; limit-- {
+		var truncated string
+		if keepEnd {
+			truncated, _ = tokenizer.TruncateStart(text, limit)
+		} else {
+			truncated, _ = tokenizer.Truncate(text, limit)
+		}
+		// The truncated text is counted on its own, as the tokens at the
+		// cut may be split differently
+		if n := tokenizer.Count(truncated); n <= maxTokens {
+			return truncated, n
+		}
+	}
+	return "", 0
+}
+
+// trimSource returns the source of a message whose text was truncated,
+// which only contains the last lines of its range if keepEnd is set, or the
+// first lines otherwise.
+func trimSource(source *claude.Source, truncated string, keepEnd bool) *claude.Source {
+	if source == nil || source.StartLine == 0 {
+		return source
+	}
+	trimmed := *source
+	lines := strings.Count(truncated, "\n")
+	if keepEnd {
+		if start := source.EndLine - lines; start > trimmed.StartLine {
+			trimmed.StartLine = start
+		}
+	} else if end := source.StartLine + lines; end < trimmed.EndLine {
+		trimmed.EndLine = end
+	}
+	return &trimmed
+}
@@ -0,0 +1,159 @@
+package promptbuilder
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pjlast/llmsp/claude"
+	"github.com/pjlast/llmsp/internal/tokenizer"
+)
+
+func TestBudget(t *testing.T) {
+	b := NewBudget(10)
+	if !b.Spend(4) || b.Remaining() != 6 || b.Used() != 4 {
+		t.Errorf("after spending 4 tokens, got %d remaining and %d used, want 6 and 4", b.Remaining(), b.Used())
+	}
+	if b.Spend(7) || b.Remaining() != 6 {
+		t.Errorf("spending more than remains succeeded, got %d remaining", b.Remaining())
+	}
+}
+
+// pair returns the messages adding text to the context.
+func pair(text string) []claude.Message {
+	return []claude.Message{{Speaker: claude.Human, Text: text}, {Speaker: claude.Assistant, Text: "Ok."}}
+}
+
+func texts(messages []claude.Message) []string {
+	var texts []string
+	for _, message := range messages {
+		texts = append(texts, message.Text)
+	}
+	return texts
+}
+
+func TestBuildOrdersByPriority(t *testing.T) {
+	b := New(NewBudget(9))
+	b.Add(Section{Name: "history", Messages: append(pair("one two three"), pair("four five six")...)})
+	b.Add(Section{Name: "input", Messages: []claude.Message{{Speaker: claude.Human, Text: "what is seven"}}, Priority: 1})
+
+	// The input is allocated first but placed last, the history gets what's
+	// left, its most recent messages first
+	got := texts(b.Build())
+	want := []string{"four five six", "Ok.", "what is seven"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Build() == %q, want %q", got, want)
+	}
+}
+
+func TestBuildLimits(t *testing.T) {
+	b := New(NewBudget(100))
+	b.Add(Section{Name: "file", Messages: pair(strings.Repeat("x ", 50)), Max: 10})
+	b.Add(Section{Name: "embeddings", Messages: pair(strings.Repeat("y ", 100)), Share: 0.5})
+	messages := b.Build()
+
+	var file, embeddings int
+	for _, message := range messages {
+		switch {
+		case strings.HasPrefix(message.Text, "x") || strings.HasPrefix(message.Text, " x"):
+			file += tokenizer.Count(message.Text)
+		case strings.Contains(message.Text, "y"):
+			embeddings += tokenizer.Count(message.Text)
+		}
+	}
+	if file == 0 || file > 10 {
+		t.Errorf("the file takes %d tokens, want at most 10", file)
+	}
+	if embeddings == 0 || embeddings > 45 {
+		t.Errorf("the embeddings take %d tokens, want at most half of the remaining 90", embeddings)
+	}
+}
+
+func TestKeepFirst(t *testing.T) {
+	b := New(NewBudget(8))
+	b.Add(Section{Name: "preamble", Messages: append(pair("You are Cody."), pair("Here are my recent edits")...), Trim: KeepFirst})
+	got := texts(b.Build())
+	if len(got) < 2 || got[0] != "You are Cody." || got[1] != "Ok." {
+		t.Errorf("Build() == %q, want the start of the preamble", got)
+	}
+}
+
+func TestTrimSource(t *testing.T) {
+	// Truncating the start of a message drops the first lines of its range
+	source := &claude.Source{Kind: "file", File: "a.go", StartLine: 1, EndLine: 10}
+	if trimmed := trimSource(source, "8\n9\n10", true); trimmed.StartLine != 8 || trimmed.EndLine != 10 {
+		t.Errorf("trimSource() == %+v, want lines 8 to 10", trimmed)
+	}
+	// Truncating the end drops the last lines
+	if trimmed := trimSource(source, "1\n2", false); trimmed.StartLine != 1 || trimmed.EndLine != 2 {
+		t.Errorf("trimSource() == %+v, want lines 1 to 2", trimmed)
+	}
+	if trimmed := trimSource(&claude.Source{Kind: "git"}, "diff", true); trimmed.StartLine != 0 {
+		t.Errorf("trimSource() without lines == %+v, want no lines", trimmed)
+	}
+}
+
+var words = []string{"func", "main", "(", ")", "{", "}", "\n", "\t", "return", "userID", "42", "// comment", "ünïcode", "    ", "x"}
+
+// randomText returns text of up to n random words.
+func randomText(r *rand.Rand, n int) string {
+	var sb strings.Builder
+	for i := r.Intn(n + 1); i > 0; i-- {
+		sb.WriteString(words[r.Intn(len(words))])
+		if r.Intn(3) == 0 {
+			sb.WriteString(" ")
+		}
+	}
+	return sb.String()
+}
+
+// TestBuildProperties builds random prompts and checks that they never
+// exceed the budget, that sections never exceed their limits, and that the
+// context kept from the end of a section starts with a human message.
+func TestBuildProperties(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for run := 0; run < 500; run++ {
+		limit := r.Intn(300)
+		budget := NewBudget(limit)
+		b := New(budget)
+
+		var sections []Section
+		for i := r.Intn(6); i > 0; i-- {
+			section := Section{Priority: r.Intn(3), Trim: Trim(r.Intn(2))}
+			for j := r.Intn(5); j > 0; j-- {
+				section.Messages = append(section.Messages, pair(randomText(r, 80))...)
+			}
+			if r.Intn(3) == 0 {
+				section.Max = r.Intn(100)
+			}
+			if r.Intn(3) == 0 {
+				section.Share = r.Float64()
+			}
+			sections = append(sections, section)
+			b.Add(section)
+		}
+
+		messages := b.Build()
+		total := 0
+		for _, message := range messages {
+			total += tokenizer.Count(message.Text)
+		}
+		if total > limit {
+			t.Fatalf("run %d: the prompt has %d tokens, more than the limit of %d", run, total, limit)
+		}
+		if total != budget.Used() {
+			t.Fatalf("run %d: the prompt has %d tokens, but %d were spent", run, total, budget.Used())
+		}
+
+		for _, section := range sections {
+			messages, tokens := fit(section.Messages, section.Max, section.Trim)
+			if section.Max > 0 && tokens > section.Max {
+				t.Fatalf("run %d: a section of %d tokens exceeds its maximum of %d", run, tokens, section.Max)
+			}
+			if section.Trim == KeepLast && len(messages) > 0 && messages[0].Speaker != claude.Human {
+				t.Fatalf("run %d: a trimmed section starts with %q", run, messages[0].Speaker)
+			}
+		}
+	}
+}
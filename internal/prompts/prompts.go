@@ -0,0 +1,189 @@
+// Package prompts contains the templates of the prompts sent to the LLM.
+//
+// Prompts are Go text/template templates rendered with a Data value. Every
+// template has a default, and users can override templates by name, e.g. to
+// adapt prompts to the conventions of their team.
+package prompts
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// Names of the templates.
+const (
+	// Preamble introduces the assistant at the start of every conversation.
+	Preamble = "preamble"
+	// Docstring asks for the doc comment of Code.
+	Docstring = "docstring"
+	// TODOs asks to implement the TODO comments in Code.
+	TODOs = "todos"
+	// Answer asks to answer Question in comments starting with
+	// CommentPrefix.
+	Answer = "answer"
+	// Suggest asks for improvements to the numbered lines of Code in
+	// Filename, as a JSON array.
+	Suggest = "suggest"
+	// Explain asks to explain Code in Filename.
+	Explain = "explain"
+	// Ask asks to answer Question about the code base of RepoName, if known,
+	// from the numbered snippets before it, citing them by number.
+	Ask = "ask"
+)
+
+var defaults = map[string]string{
+	Preamble: `I am Cody, an AI-powered coding assistant developed by Sourcegraph. I operate inside a Language Server Protocol implementation. My task is to help programmers with programming tasks in all programming languages.
+I have access to your currently open files in the editor.
+I will generate suggestions as concisely and clearly as possible.
+I only suggest something if I am certain about my answer.
+{{- if .RepoName}}
+I have knowledge about the {{.RepoName}} repository and can answer questions about it.
+{{- end}}`,
+	Docstring: `Generate a doc string explaining the use of the following {{.Language}} function:
+{{.Code}}
+
+Don't include the function in your output.`,
+	TODOs: `The following {{.Language}} code contains TODO instructions. Produce code that will implement the TODO. Don't say anything else.
+Here is the code snippet:
+{{.Code}}`,
+	Answer: "Answer this question. Prepend each line with `{{.CommentPrefix}}` since you are in a code editor.\n\n{{.Question}}",
+	Suggest: `Suggest improvements to following lines of code in the file '{{.Filename}}':
+{{.Code}}
+
+Answer with a JSON array of suggestions and nothing else, in the format:
+[{"line": {first line number}, "endLine": {last line number}, "severity": "error" | "warning" | "info" | "hint", "confidence": {number between 0 and 1}, "message": "{suggestion}"}]`,
+	Explain: "Explain what the following {{.Language}} code from {{.Filename}} does:\n```\n{{.Code}}\n```",
+	Ask: `Answer the following question about the {{if .RepoName}}{{.RepoName}} {{end}}code base, using the numbered snippets above. Cite the snippets your answer is based on by their number in square brackets, e.g. [1], and say so if they don't answer the question.
+
+{{.Question}}`,
+}
+
+// Data is what templates are rendered with. Templates only use the fields
+// described for them.
+type Data struct {
+	// RepoName is the name of the repository of the workspace, if known
+	RepoName string
+	// Filename is the name of the current file
+	Filename string
+	// Language is the language of the current file
+	Language string
+	// Code is the code the prompt is about
+	Code string
+	// Question is the question asked by the user
+	Question string
+	// CommentPrefix starts comments in the language of the current file
+	CommentPrefix string
+}
+
+// Registry holds the templates in use. A nil Registry uses the defaults.
+type Registry struct {
+	mu        sync.RWMutex
+	templates map[string]*template.Template
+}
+
+var defaultTemplates = mustParse(defaults)
+
+// New returns a registry with the default templates.
+func New() *Registry {
+	return &Registry{templates: defaultTemplates}
+}
+
+// Names returns the names of all templates, sorted.
+func Names() []string {
+	names := make([]string, 0, len(defaults))
+	for name := range defaults {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Default returns the text of the default template with the given name.
+func Default(name string) string {
+	return defaults[name]
+}
+
+// Override replaces the templates of the registry with the defaults,
+// overridden by the given templates. If any template is unknown or invalid,
+// the registry is left unchanged and an error is returned.
+func (r *Registry) Override(overrides map[string]string) error {
+	templates := make(map[string]*template.Template, len(defaultTemplates))
+	for name, tmpl := range defaultTemplates {
+		templates[name] = tmpl
+	}
+	for name, text := range overrides {
+		if _, ok := defaults[name]; !ok {
+			return fmt.Errorf("unknown prompt template %q, known templates are %s", name, strings.Join(Names(), ", "))
+		}
+		tmpl, err := template.New(name).Parse(text)
+		if err != nil {
+			return err
+		}
+		// Catch references to fields that don't exist up front
+		if err := tmpl.Execute(io.Discard, Data{}); err != nil {
+			return err
+		}
+		templates[name] = tmpl
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.templates = templates
+	return nil
+}
+
+// Render renders the named template. If an overridden template fails, the
+// default template is rendered instead, and the error is returned along with
+// it.
+func (r *Registry) Render(name string, data Data) (string, error) {
+	tmpl := defaultTemplates[name]
+	if r != nil {
+		r.mu.RLock()
+		if t, ok := r.templates[name]; ok {
+			tmpl = t
+		}
+		r.mu.RUnlock()
+	}
+	if tmpl == nil {
+		return "", fmt.Errorf("unknown prompt template %q", name)
+	}
+
+	var out strings.Builder
+	err := tmpl.Execute(&out, data)
+	if err == nil || tmpl == defaultTemplates[name] {
+		return out.String(), err
+	}
+	out.Reset()
+	if fallbackErr := defaultTemplates[name].Execute(&out, data); fallbackErr != nil {
+		return "", fallbackErr
+	}
+	return out.String(), err
+}
+
+// LoadFile reads template overrides from a JSON file mapping template names to
+// templates.
+func LoadFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var overrides map[string]string
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return overrides, nil
+}
+
+func mustParse(texts map[string]string) map[string]*template.Template {
+	templates := make(map[string]*template.Template, len(texts))
+	for name, text := range texts {
+		templates[name] = template.Must(template.New(name).Parse(text))
+	}
+	return templates
+}
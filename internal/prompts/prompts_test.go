@@ -0,0 +1,93 @@
+package prompts
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name string
+		data Data
+		want string
+	}{
+		{Answer, Data{CommentPrefix: "#", Question: "Why?"}, "Answer this question. Prepend each line with `#` since you are in a code editor.\n\nWhy?"},
+		{Explain, Data{Language: "Go", Filename: "main.go", Code: "func main() {}"}, "Explain what the following Go code from main.go does:\n```\nfunc main() {}\n```"},
+		{Ask, Data{RepoName: "github.com/a/app", Question: "Where is auth handled?"}, "Answer the following question about the github.com/a/app code base, using the numbered snippets above. Cite the snippets your answer is based on by their number in square brackets, e.g. [1], and say so if they don't answer the question.\n\nWhere is auth handled?"},
+		{TODOs, Data{Language: "Go", Code: "// TODO"}, "The following Go code contains TODO instructions. Produce code that will implement the TODO. Don't say anything else.\nHere is the code snippet:\n// TODO"},
+	}
+	var r *Registry
+	for _, test := range tests {
+		if got, err := r.Render(test.name, test.data); err != nil || got != test.want {
+			t.Errorf("Render(%q) == %q, %v, want %q", test.name, got, err, test.want)
+		}
+	}
+}
+
+func TestRenderPreamble(t *testing.T) {
+	r := New()
+	without, _ := r.Render(Preamble, Data{})
+	with, _ := r.Render(Preamble, Data{RepoName: "github.com/pjlast/llmsp"})
+	if want := without + "\nI have knowledge about the github.com/pjlast/llmsp repository and can answer questions about it."; with != want {
+		t.Errorf("Render(Preamble) == %q, want %q", with, want)
+	}
+}
+
+func TestOverride(t *testing.T) {
+	r := New()
+	if err := r.Override(map[string]string{Docstring: "Document {{.Code}} in {{.Language}}"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := r.Render(Docstring, Data{Language: "Go", Code: "f"}); got != "Document f in Go" {
+		t.Errorf("Render(Docstring) == %q, want the override", got)
+	}
+
+	invalid := []map[string]string{
+		{"unknown": "text"},
+		{Docstring: "{{.Code"},
+		{Docstring: "{{.Missing}}"},
+		{Answer: "ok", Suggest: "{{end}}"},
+	}
+	for _, overrides := range invalid {
+		if err := r.Override(overrides); err == nil {
+			t.Errorf("Override(%v) succeeded, want an error", overrides)
+		}
+	}
+	// Failed overrides leave the registry unchanged
+	if got, _ := r.Render(Docstring, Data{Language: "Go", Code: "f"}); got != "Document f in Go" {
+		t.Errorf("Render(Docstring) == %q, want the override", got)
+	}
+	if got, _ := r.Render(Answer, Data{}); got == "ok" {
+		t.Errorf("Render(Answer) == %q, want the default", got)
+	}
+
+	// Overriding again resets the templates that aren't overridden
+	if err := r.Override(nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := r.Render(Docstring, Data{}); got == "Document  in " {
+		t.Errorf("Render(Docstring) == %q, want the default", got)
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prompts.json")
+	if err := os.WriteFile(path, []byte(`{"suggest": "Review {{.Filename}}"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	overrides, err := LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := overrides[Suggest]; got != "Review {{.Filename}}" {
+		t.Errorf("LoadFile() read %q, want %q", got, "Review {{.Filename}}")
+	}
+
+	if err := os.WriteFile(path, []byte(`not json`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadFile(path); err == nil {
+		t.Error("LoadFile() of invalid JSON succeeded, want an error")
+	}
+}
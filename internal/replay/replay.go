@@ -0,0 +1,252 @@
+// Package replay records the HTTP interactions with a Sourcegraph instance
+// and replays them, so that the requests the server sends and its handling of
+// the responses can be tested without a live instance.
+//
+// Interactions are stored in cassettes, JSON files that are checked in next
+// to the tests. Tests replay them by default; with LLMSP_RECORD=1 the
+// requests are sent to the instance at SRC_ENDPOINT, authenticated with
+// SRC_ACCESS_TOKEN, and the cassettes are rewritten with the responses.
+// Request headers, which include the access token, are never recorded.
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/pjlast/llmsp/internal/secrets"
+)
+
+// EnvRecord is the environment variable that switches tests to recording.
+const EnvRecord = "LLMSP_RECORD"
+
+// EnvEndpoint is the environment variable with the URL of the instance
+// requests are recorded from.
+const EnvEndpoint = "SRC_ENDPOINT"
+
+// replayURL is the URL of the instance when replaying, requests are matched
+// regardless of their host.
+const replayURL = "https://sourcegraph.test"
+
+// Mode tells whether interactions are replayed or recorded.
+type Mode int
+
+const (
+	// Replay serves the responses of the cassette, requests that weren't
+	// recorded are errors
+	Replay Mode = iota
+	// Record sends requests to the instance and records them
+	Record
+)
+
+// ModeFromEnv returns Record if EnvRecord is set, and Replay otherwise.
+func ModeFromEnv() Mode {
+	if os.Getenv(EnvRecord) != "" {
+		return Record
+	}
+	return Replay
+}
+
+// Request is a recorded request.
+type Request struct {
+	Method string `json:"method"`
+	// URL is the path and query of the request, without the instance
+	URL  string `json:"url"`
+	Body string `json:"body,omitempty"`
+}
+
+// Response is a recorded response.
+type Response struct {
+	StatusCode  int    `json:"statusCode"`
+	ContentType string `json:"contentType,omitempty"`
+	Body        string `json:"body"`
+}
+
+// Interaction is a request and its response.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// ErrNotRecorded is returned by the transport when replaying a request that
+// isn't in the cassette.
+var ErrNotRecorded = errors.New("request not recorded")
+
+// Transport is an http.RoundTripper replaying or recording the interactions
+// of a cassette.
+type Transport struct {
+	mode Mode
+	path string
+	// next sends the requests when recording
+	next http.RoundTripper
+
+	mu           sync.Mutex
+	interactions []Interaction
+	// replayed marks the interactions that were served, so that identical
+	// requests get their responses in the order they were recorded
+	replayed []bool
+}
+
+// Open opens the cassette at path. When replaying, the cassette must exist.
+// When recording, requests are sent with next, or http.DefaultTransport if
+// it is nil, and the cassette is only written by Save.
+func Open(path string, mode Mode, next http.RoundTripper) (*Transport, error) {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	t := &Transport{mode: mode, path: path, next: next}
+	if mode == Record {
+		return t, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading cassette: %w (record it with %s=1)", err, EnvRecord)
+	}
+	if err := json.Unmarshal(data, &t.interactions); err != nil {
+		return nil, fmt.Errorf("parsing cassette %s: %w", path, err)
+	}
+	t.replayed = make([]bool, len(t.interactions))
+	return t, nil
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	recorded := Request{Method: req.Method, URL: req.URL.RequestURI()}
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		recorded.Body = string(body)
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	if t.mode == Record {
+		return t.record(req, recorded)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, interaction := range t.interactions {
+		if !t.replayed[i] && interaction.Request == recorded {
+			t.replayed[i] = true
+			return interaction.Response.http(req), nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s %s in %s (record it again with %s=1)", ErrNotRecorded, recorded.Method, recorded.URL, t.path, EnvRecord)
+}
+
+// record sends the request and records its response.
+func (t *Transport) record(req *http.Request, recorded Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	// Streamed responses are read to the end, and replayed all at once
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	response := Response{
+		StatusCode:  resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Body:        string(body),
+	}
+	t.mu.Lock()
+	t.interactions = append(t.interactions, Interaction{Request: recorded, Response: response})
+	t.replayed = append(t.replayed, true)
+	t.mu.Unlock()
+	return response.http(req), nil
+}
+
+// http returns the recorded response as a response to req.
+func (r Response) http(req *http.Request) *http.Response {
+	header := make(http.Header)
+	if r.ContentType != "" {
+		header.Set("Content-Type", r.ContentType)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.StatusCode, http.StatusText(r.StatusCode)),
+		StatusCode:    r.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader([]byte(r.Body))),
+		ContentLength: int64(len(r.Body)),
+		Request:       req,
+	}
+}
+
+// Unused returns the recorded interactions that weren't replayed.
+func (t *Transport) Unused() []Interaction {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var unused []Interaction
+	for i, interaction := range t.interactions {
+		if !t.replayed[i] {
+			unused = append(unused, interaction)
+		}
+	}
+	return unused
+}
+
+// Save writes the recorded interactions to the cassette. It does nothing
+// when replaying.
+func (t *Transport) Save() error {
+	if t.mode != Record {
+		return nil
+	}
+	t.mu.Lock()
+	data, err := json.MarshalIndent(t.interactions, "", "  ")
+	t.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(t.path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(t.path, append(data, '\n'), 0o644)
+}
+
+// Client returns the URL, access token and HTTP client of the instance to
+// test against, with the interactions of the cassette testdata/<name>.json.
+// When recording, the instance is the one at SRC_ENDPOINT and the cassette
+// is saved once the test is done. When replaying, the test fails if not every
+// recorded interaction was replayed.
+func Client(t testing.TB, name string) (url, token string, client *http.Client) {
+	t.Helper()
+	mode := ModeFromEnv()
+	transport, err := Open(filepath.Join("testdata", name+".json"), mode, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := transport.Save(); err != nil {
+			t.Errorf("saving cassette: %v", err)
+		}
+		if unused := transport.Unused(); len(unused) > 0 {
+			t.Errorf("%d recorded requests weren't sent, the first is %s %s", len(unused), unused[0].Request.Method, unused[0].Request.URL)
+		}
+	})
+
+	url, token = replayURL, ""
+	if mode == Record {
+		url, token = os.Getenv(EnvEndpoint), os.Getenv(secrets.EnvAccessToken)
+		if url == "" {
+			t.Fatalf("recording requires %s and %s", EnvEndpoint, secrets.EnvAccessToken)
+		}
+	}
+	return url, token, &http.Client{Transport: transport}
+}
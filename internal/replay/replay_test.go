@@ -0,0 +1,91 @@
+package replay
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func send(t *testing.T, client *http.Client, url, body string) (int, string, error) {
+	t.Helper()
+	req, err := http.NewRequest("POST", url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "token secret")
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(data), err
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, r.URL.Path+" "+string(body)+" "+strings.Repeat("!", calls))
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "testdata", "cassette.json")
+	recorder, err := Open(path, Record, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: recorder}
+	for _, body := range []string{"one", "two", "one"} {
+		if _, _, err := send(t, client, server.URL+"/.api/graphql?Search", body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := recorder.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); strings.Contains(string(data), "secret") {
+		t.Error("the cassette contains the access token")
+	}
+
+	player, err := Open(path, Replay, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client = &http.Client{Transport: player}
+	// Requests are matched regardless of the host, and identical requests
+	// are answered in the order they were recorded
+	for _, test := range []struct{ body, want string }{
+		{"one", "/.api/graphql one !"},
+		{"one", "/.api/graphql one !!!"},
+		{"two", "/.api/graphql two !!"},
+	} {
+		status, got, err := send(t, client, "https://example.com/.api/graphql?Search", test.body)
+		if err != nil || status != http.StatusOK || got != test.want {
+			t.Errorf("replaying %q returned (%d, %q, %v), want (200, %q, nil)", test.body, status, got, err, test.want)
+		}
+	}
+	if calls != 3 {
+		t.Errorf("the server got %d requests, want the 3 recorded ones", calls)
+	}
+	if unused := player.Unused(); len(unused) != 0 {
+		t.Errorf("%d interactions weren't replayed", len(unused))
+	}
+
+	if _, _, err := send(t, client, "https://example.com/.api/graphql?Search", "one"); !errors.Is(err, ErrNotRecorded) {
+		t.Errorf("replaying a request once more returned %v, want %v", err, ErrNotRecorded)
+	}
+}
+
+func TestOpenMissingCassette(t *testing.T) {
+	if _, err := Open(filepath.Join(t.TempDir(), "missing.json"), Replay, nil); err == nil || !strings.Contains(err.Error(), EnvRecord) {
+		t.Errorf("opening a missing cassette returned %v, want an error explaining how to record it", err)
+	}
+}
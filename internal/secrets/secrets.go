@@ -0,0 +1,207 @@
+// Package secrets looks up the Sourcegraph access token and keeps it out of
+// logs and traces.
+//
+// Besides being set in plain text, the token can be read from the output of a
+// command, like a password manager, or from the keychain of the OS. Every
+// token that is looked up is remembered, so that Redact can remove it from
+// any text that is logged.
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EnvAccessToken is the environment variable the access token is read from if
+// it isn't configured otherwise.
+const EnvAccessToken = "SRC_ACCESS_TOKEN"
+
+// DefaultKeychainService is the keychain service the token is stored under by
+// default.
+const DefaultKeychainService = "llmsp"
+
+// Redacted replaces secrets in redacted text.
+const Redacted = "[REDACTED]"
+
+// commandTimeout is how long token commands may run.
+const commandTimeout = 10 * time.Second
+
+// Source describes where the token is looked up. The first one that is set is
+// used.
+type Source struct {
+	// Token is the token itself
+	Token string
+	// Command is a shell command printing the token on its first line
+	Command string
+	// KeychainService and KeychainAccount name the keychain item holding the
+	// token, it is only looked up if KeychainService is set
+	KeychainService string
+	KeychainAccount string
+}
+
+// Lookup returns the token of the source, or "" if the source is empty. The
+// token is registered to be redacted.
+func Lookup(ctx context.Context, source Source) (string, error) {
+	var token string
+	var err error
+	switch {
+	case source.Token != "":
+		token = source.Token
+	case source.Command != "":
+		token, err = fromCommand(ctx, source.Command)
+	case source.KeychainService != "":
+		token, err = fromKeychain(ctx, source.KeychainService, source.KeychainAccount)
+	}
+	if err != nil {
+		return "", err
+	}
+	Register(token)
+	return token, nil
+}
+
+// fromCommand runs a shell command and returns the first line of its output.
+func fromCommand(ctx context.Context, command string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	token, err := output(cmd)
+	if err != nil {
+		return "", fmt.Errorf("token command %q: %w", command, err)
+	}
+	return token, nil
+}
+
+// fromKeychain reads a password from the keychain of the OS: the login
+// keychain on macOS and the Secret Service, e.g. GNOME Keyring or KWallet,
+// elsewhere.
+func fromKeychain(ctx context.Context, service, account string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		args := []string{"find-generic-password", "-s", service, "-w"}
+		if account != "" {
+			args = append(args, "-a", account)
+		}
+		cmd = exec.CommandContext(ctx, "security", args...)
+	case "windows":
+		return "", errors.New("reading the token from the keychain isn't supported on Windows, use a token command instead")
+	default:
+		args := []string{"lookup", "service", service}
+		if account != "" {
+			args = append(args, "account", account)
+		}
+		cmd = exec.CommandContext(ctx, "secret-tool", args...)
+	}
+	token, err := output(cmd)
+	if err != nil {
+		return "", fmt.Errorf("keychain item %q: %w", service, err)
+	}
+	return token, nil
+}
+
+// output runs the command and returns the first line of its output. It is an
+// error if the line is empty.
+func output(cmd *exec.Cmd) (string, error) {
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", fmt.Errorf("%w: %s", err, message)
+		}
+		return "", err
+	}
+	line, _, _ := strings.Cut(string(out), "\n")
+	if line = strings.TrimSpace(line); line == "" {
+		return "", errors.New("no token printed")
+	}
+	return line, nil
+}
+
+var (
+	mu      sync.RWMutex
+	secrets = make(map[string]bool)
+)
+
+// Register registers a secret to be redacted.
+func Register(secret string) {
+	if secret == "" {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	secrets[secret] = true
+}
+
+// Redact replaces the registered secrets in text.
+func Redact(text string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	for secret := range secrets {
+		text = strings.ReplaceAll(text, secret, Redacted)
+	}
+	return text
+}
+
+// secretFields are the names of JSON fields holding secrets, in lower case.
+var secretFields = map[string]bool{
+	"accesstoken": true,
+	"token":       true,
+	"password":    true,
+}
+
+// RedactJSON replaces the values of fields holding secrets, like accessToken,
+// in a JSON document. Documents without such fields, or that aren't valid
+// JSON, are returned unchanged.
+func RedactJSON(data json.RawMessage) json.RawMessage {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil || !redactValue(value) {
+		return data
+	}
+	redacted, err := json.Marshal(value)
+	if err != nil {
+		return data
+	}
+	return redacted
+}
+
+// redactValue replaces the secret fields of a decoded JSON value in place,
+// and reports whether there were any.
+func redactValue(value any) bool {
+	redacted := false
+	switch value := value.(type) {
+	case map[string]any:
+		for key, field := range value {
+			if s, ok := field.(string); ok && s != "" && secretFields[strings.ToLower(key)] {
+				value[key] = Redacted
+				redacted = true
+			} else if redactValue(field) {
+				redacted = true
+			}
+		}
+	case []any:
+		for _, element := range value {
+			if redactValue(element) {
+				redacted = true
+			}
+		}
+	}
+	return redacted
+}
@@ -0,0 +1,55 @@
+package secrets
+
+import (
+	"context"
+	"runtime"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("token commands are run with sh")
+	}
+	ctx := context.Background()
+
+	tests := []struct {
+		source Source
+		want   string
+	}{
+		{Source{}, ""},
+		{Source{Token: "sgp_plain", Command: "echo sgp_command"}, "sgp_plain"},
+		{Source{Command: "printf 'sgp_command\\nsecond line\\n'", KeychainService: "llmsp"}, "sgp_command"},
+	}
+	for _, test := range tests {
+		if got, err := Lookup(ctx, test.source); err != nil || got != test.want {
+			t.Errorf("Lookup(%+v) == %q, %v, want %q", test.source, got, err, test.want)
+		}
+	}
+
+	for _, command := range []string{"exit 1", "true"} {
+		if _, err := Lookup(ctx, Source{Command: command}); err == nil {
+			t.Errorf("Lookup() with command %q succeeded, want an error", command)
+		}
+	}
+
+	if got := Redact("token=sgp_command"); got != "token="+Redacted {
+		t.Errorf("Redact() == %q, want the looked up token redacted", got)
+	}
+}
+
+func TestRedactJSON(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+	}{
+		{`{"settings":{"llmsp":{"sourcegraph":{"url":"u","accessToken":"sgp_x"}}}}`, `{"settings":{"llmsp":{"sourcegraph":{"accessToken":"[REDACTED]","url":"u"}}}}`},
+		{`[{"token":"t"},{"token":""}]`, `[{"token":"[REDACTED]"},{"token":""}]`},
+		{`{"tokenCommand": "pass show sourcegraph"}`, `{"tokenCommand": "pass show sourcegraph"}`},
+		{`not json`, `not json`},
+	}
+	for _, test := range tests {
+		if got := string(RedactJSON([]byte(test.data))); got != test.want {
+			t.Errorf("RedactJSON(%s) == %s, want %s", test.data, got, test.want)
+		}
+	}
+}
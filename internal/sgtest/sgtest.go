@@ -0,0 +1,63 @@
+// Package sgtest provides a fake Sourcegraph instance for end-to-end tests
+// of the server and command line tools.
+//
+// The instance answers the GraphQL queries the clients send with canned
+// responses, so that tests can run a whole request without recording a
+// cassette, see package replay for tests of the requests themselves.
+package sgtest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Repository is the only repository the instance knows.
+const Repository = "github.com/sourcegraph/sourcegraph"
+
+// RepositoryID is the GraphQL ID of Repository.
+const RepositoryID = "UmVwb3NpdG9yeTox"
+
+// NewInstance returns a Sourcegraph instance serving Handler. The instance
+// is closed when the test ends.
+func NewInstance(t testing.TB, completion string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(Handler(completion))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// Handler returns the handler of an instance knowing Repository, with a
+// single embeddings result for it, and answering every completion with
+// completion. Tests can wrap it to fail some requests.
+func Handler(completion string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.Contains(string(body), "query RepoID"):
+			if strings.Contains(string(body), `"name":"`+Repository+`"`) {
+				io.WriteString(w, `{"data": {"repository": {"id": "`+RepositoryID+`"}}}`)
+			} else {
+				io.WriteString(w, `{"data": {"repository": null}}`)
+			}
+		case strings.Contains(string(body), "query EmbeddingsSearch"):
+			io.WriteString(w, `{"data": {"embeddingsSearch": {
+				"codeResults": [{"fileName": "main.go", "startLine": 1, "endLine": 3, "content": "func main() {}\n"}],
+				"textResults": []
+			}}}`)
+		case strings.Contains(string(body), "query CurrentUser"):
+			io.WriteString(w, `{"data": {"currentUser": {"username": "test"}}}`)
+		case strings.Contains(string(body), "query SiteProductVersion"):
+			io.WriteString(w, `{"data": {"site": {"productVersion": "5.1.0"}}}`)
+		case strings.Contains(string(body), "query GetCompletions"):
+			data, _ := json.Marshal(map[string]any{"data": map[string]string{"completions": completion}})
+			w.Write(data)
+		default:
+			io.WriteString(w, `{"data": {}}`)
+		}
+	})
+}
@@ -0,0 +1,33 @@
+package sgtest
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestNewInstance(t *testing.T) {
+	instance := NewInstance(t, "return a + b")
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`{"query": "query GetCompletions"}`, `"completions":"return a + b"`},
+		{`{"query": "query RepoID", "variables": {"name":"` + Repository + `"}}`, RepositoryID},
+		{`{"query": "query RepoID", "variables": {"name":"github.com/unknown/unknown"}}`, `"repository": null`},
+		{`{"query": "query Unknown"}`, `{"data": {}}`},
+	}
+	for _, test := range tests {
+		res, err := http.Post(instance.URL+"/.api/graphql", "application/json", strings.NewReader(test.query))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		if !strings.Contains(string(body), test.want) {
+			t.Errorf("response to %s == %s, want it to contain %s", test.query, body, test.want)
+		}
+	}
+}
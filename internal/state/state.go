@@ -0,0 +1,131 @@
+// Package state manages versioned state files stored on disk.
+//
+// Every state file is a JSON object with a "version" field. When a file
+// written by an older version of llmsp is loaded, the registered migrations
+// are applied in order to bring it up to date, after backing up the original
+// file. Files that can't be parsed or that were written by a newer version of
+// llmsp are never overwritten.
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrNewerVersion is returned when a state file was written by a newer
+// version of llmsp than the one running.
+var ErrNewerVersion = errors.New("state file was written by a newer version of llmsp")
+
+// Migration upgrades state from version From to version From+1.
+type Migration struct {
+	From int
+	// Migrate transforms the decoded JSON object of the state file. The
+	// version field is updated automatically.
+	Migrate func(map[string]any) error
+}
+
+// Load reads the state file at path into v, migrating it to version if it
+// was written by an older version. Migrated files are written back to disk,
+// and the original file is kept with a ".v<version>.bak" suffix.
+//
+// If the file does not exist, an error satisfying errors.Is(err,
+// os.ErrNotExist) is returned. Files that fail to parse are moved aside with a
+// ".corrupt" suffix instead of being discarded.
+func Load(path string, version int, migrations []Migration, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		_ = os.Rename(path, path+".corrupt")
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	fileVersion := 0
+	if n, ok := raw["version"].(float64); ok {
+		fileVersion = int(n)
+	}
+	if fileVersion > version {
+		return fmt.Errorf("%s has version %d, want %d: %w", path, fileVersion, version, ErrNewerVersion)
+	}
+
+	if fileVersion < version {
+		if err := migrate(raw, fileVersion, version, migrations); err != nil {
+			return fmt.Errorf("migrating %s: %w", path, err)
+		}
+		if err := os.WriteFile(fmt.Sprintf("%s.v%d.bak", path, fileVersion), data, 0o600); err != nil {
+			return err
+		}
+		if data, err = json.MarshalIndent(raw, "", "  "); err != nil {
+			return err
+		}
+		if err := writeFile(path, data); err != nil {
+			return err
+		}
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// migrate applies the migrations needed to bring raw from version from to
+// version to.
+func migrate(raw map[string]any, from, to int, migrations []Migration) error {
+	for current := from; current < to; current++ {
+		var migration *Migration
+		for i := range migrations {
+			if migrations[i].From == current {
+				migration = &migrations[i]
+				break
+			}
+		}
+		if migration == nil {
+			return fmt.Errorf("no migration from version %d", current)
+		}
+		if err := migration.Migrate(raw); err != nil {
+			return fmt.Errorf("version %d: %w", current, err)
+		}
+		raw["version"] = current + 1
+	}
+
+	return nil
+}
+
+// Save writes v to the state file at path. v is expected to marshal into a
+// JSON object containing its version.
+func Save(path string, v any) error {
+	data, err := Marshal(v)
+	if err != nil {
+		return err
+	}
+	return Write(path, data)
+}
+
+// Marshal encodes v as the contents of a state file, so that it can be
+// written with Write once the state it was taken from is unlocked.
+func Marshal(v any) ([]byte, error) {
+	return json.MarshalIndent(v, "", "  ")
+}
+
+// Write writes the contents of a state file returned by Marshal to path.
+func Write(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	return writeFile(path, data)
+}
+
+// writeFile writes to a temporary file first so that a crash can't leave
+// behind a truncated state file.
+func writeFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,79 @@
+package state
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type testState struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+}
+
+func TestLoadMigrates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte(`{"title": "old"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	migrations := []Migration{
+		{From: 0, Migrate: func(raw map[string]any) error {
+			raw["name"] = raw["title"]
+			delete(raw, "title")
+			return nil
+		}},
+		{From: 1, Migrate: func(raw map[string]any) error {
+			raw["name"] = raw["name"].(string) + "!"
+			return nil
+		}},
+	}
+
+	var s testState
+	if err := Load(path, 2, migrations, &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Version != 2 || s.Name != "old!" {
+		t.Errorf("unexpected state %+v", s)
+	}
+	if _, err := os.Stat(path + ".v0.bak"); err != nil {
+		t.Errorf("expected a backup of the original file: %v", err)
+	}
+
+	// The migrated file should have been written back to disk
+	var reloaded testState
+	if err := Load(path, 2, nil, &reloaded); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded != s {
+		t.Errorf("reloaded state %+v, want %+v", reloaded, s)
+	}
+}
+
+func TestLoadNewerVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := Save(path, testState{Version: 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	var s testState
+	if err := Load(path, 2, nil, &s); !errors.Is(err, ErrNewerVersion) {
+		t.Errorf("got error %v, want ErrNewerVersion", err)
+	}
+}
+
+func TestLoadCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte(`{"version": `), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var s testState
+	if err := Load(path, 1, nil, &s); err == nil {
+		t.Error("expected an error")
+	}
+	if _, err := os.Stat(path + ".corrupt"); err != nil {
+		t.Errorf("expected the corrupt file to be kept: %v", err)
+	}
+}
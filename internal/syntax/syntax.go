@@ -0,0 +1,192 @@
+// Package syntax extracts context for prompts from the syntax tree of source
+// files: the declaration enclosing a position, and the signatures of the
+// symbols a piece of code refers to.
+//
+// Only Go is supported, using go/parser. Files in other languages aren't
+// parsed, and callers fall back to line based heuristics for them.
+package syntax
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+)
+
+// maxSignatureLines is the number of lines of a type declaration included in
+// its signature.
+const maxSignatureLines = 20
+
+// Symbol is a top level declaration.
+type Symbol struct {
+	// Name is the name of the symbol, methods are named Type.Method
+	Name string
+	// Signature is the declaration with its doc comment, but without the
+	// body of functions
+	Signature string
+	// Line is the line of the declaration, StartLine and EndLine are the
+	// first and last line of the declaration including its doc comment. Lines
+	// start at 0.
+	Line, StartLine, EndLine int
+	// Func is set for functions and methods, and unset for types
+	Func bool
+}
+
+// File is a parsed source file.
+type File struct {
+	src     string
+	fset    *token.FileSet
+	file    *ast.File
+	symbols []Symbol
+}
+
+// ParseGo parses Go source code. Code with syntax errors is parsed as far as
+// possible, an error is only returned if nothing could be parsed.
+func ParseGo(src string) (*File, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if file == nil {
+		return nil, err
+	}
+
+	f := &File{src: src, fset: fset, file: file}
+	f.symbols = f.collectSymbols()
+	return f, nil
+}
+
+// Symbols returns the functions, methods and types declared in the file, in
+// order.
+func (f *File) Symbols() []Symbol {
+	return f.symbols
+}
+
+// Enclosing returns the symbol whose declaration contains the line.
+func (f *File) Enclosing(line int) (Symbol, bool) {
+	for _, symbol := range f.symbols {
+		if symbol.StartLine <= line && line <= symbol.EndLine {
+			return symbol, true
+		}
+	}
+	return Symbol{}, false
+}
+
+// References returns the names referred to between startLine and endLine,
+// inclusive, in order of first use. Selected names, like Name in x.Name, are
+// included too.
+func (f *File) References(startLine, endLine int) []string {
+	var names []string
+	seen := make(map[string]bool)
+	ast.Inspect(f.file, func(n ast.Node) bool {
+		if n == nil {
+			return false
+		}
+		if f.line(n.End()) < startLine || f.line(n.Pos()) > endLine {
+			return false
+		}
+		if ident, ok := n.(*ast.Ident); ok && ident.Name != "_" && !seen[ident.Name] {
+			seen[ident.Name] = true
+			names = append(names, ident.Name)
+		}
+		return true
+	})
+	return names
+}
+
+// Lookup returns the symbols with the given name. Methods are found by their
+// name alone as well.
+func (f *File) Lookup(name string) []Symbol {
+	var symbols []Symbol
+	for _, symbol := range f.symbols {
+		if symbol.Name == name || strings.HasSuffix(symbol.Name, "."+name) {
+			symbols = append(symbols, symbol)
+		}
+	}
+	return symbols
+}
+
+// collectSymbols returns the top level functions and types of the file.
+func (f *File) collectSymbols() []Symbol {
+	var symbols []Symbol
+	for _, decl := range f.file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			name := decl.Name.Name
+			if decl.Recv != nil && len(decl.Recv.List) > 0 {
+				name = receiverType(decl.Recv.List[0].Type) + "." + name
+			}
+			end := decl.End()
+			if decl.Body != nil {
+				end = decl.Body.Lbrace
+			}
+			symbol := f.symbol(name, "", decl.Doc, decl.Pos(), end, decl.End())
+			symbol.Func = true
+			symbols = append(symbols, symbol)
+
+		case *ast.GenDecl:
+			if decl.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range decl.Specs {
+				spec := spec.(*ast.TypeSpec)
+				prefix, doc, pos, end := "", decl.Doc, decl.Pos(), decl.End()
+				if decl.Lparen.IsValid() {
+					// Types declared in a group are declared on their own
+					prefix, doc, pos, end = "type ", spec.Doc, spec.Pos(), spec.End()
+				}
+				symbols = append(symbols, f.symbol(spec.Name.Name, prefix, doc, pos, end, end))
+			}
+		}
+	}
+	return symbols
+}
+
+// symbol returns the symbol declared from pos to end, whose signature ends at
+// signatureEnd and is preceded by prefix.
+func (f *File) symbol(name, prefix string, doc *ast.CommentGroup, pos, signatureEnd, end token.Pos) Symbol {
+	start := pos
+	signature := prefix + strings.TrimSpace(f.src[f.offset(pos):f.offset(signatureEnd)])
+	if lines := strings.Split(signature, "\n"); len(lines) > maxSignatureLines {
+		signature = strings.Join(lines[:maxSignatureLines], "\n") + "\n\t// ..."
+	}
+	if doc != nil {
+		start = doc.Pos()
+		signature = strings.TrimSpace(f.src[f.offset(doc.Pos()):f.offset(doc.End())]) + "\n" + signature
+	}
+
+	return Symbol{
+		Name:      name,
+		Signature: signature,
+		Line:      f.line(pos),
+		StartLine: f.line(start),
+		EndLine:   f.line(end),
+	}
+}
+
+// line returns the 0-based line of pos.
+func (f *File) line(pos token.Pos) int {
+	return f.fset.Position(pos).Line - 1
+}
+
+// offset returns the byte offset of pos, clamped to the source.
+func (f *File) offset(pos token.Pos) int {
+	offset := f.fset.Position(pos).Offset
+	if offset > len(f.src) {
+		return len(f.src)
+	}
+	return offset
+}
+
+// receiverType returns the name of the type of a method receiver.
+func receiverType(expr ast.Expr) string {
+	switch expr := expr.(type) {
+	case *ast.StarExpr:
+		return receiverType(expr.X)
+	case *ast.IndexExpr:
+		return receiverType(expr.X)
+	case *ast.IndexListExpr:
+		return receiverType(expr.X)
+	case *ast.Ident:
+		return expr.Name
+	}
+	return ""
+}
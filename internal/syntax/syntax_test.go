@@ -0,0 +1,99 @@
+package syntax
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testFile = `package store
+
+// Store keeps users.
+type Store struct {
+	users map[string]User
+}
+
+type (
+	// User is a user.
+	User struct{ Name string }
+	ID   int
+)
+
+// Get returns a user.
+func (s *Store) Get(name string) (User, bool) {
+	user, ok := s.users[name]
+	return user, ok
+}
+
+func validate(u User) error {
+	return nil
+}
+`
+
+func TestSymbols(t *testing.T) {
+	f, err := ParseGo(testFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Symbol{
+		{Name: "Store", Signature: "// Store keeps users.\ntype Store struct {\n\tusers map[string]User\n}", Line: 3, StartLine: 2, EndLine: 5},
+		{Name: "User", Signature: "// User is a user.\ntype User struct{ Name string }", Line: 9, StartLine: 8, EndLine: 9},
+		{Name: "ID", Signature: "type ID   int", Line: 10, StartLine: 10, EndLine: 10},
+		{Name: "Store.Get", Signature: "// Get returns a user.\nfunc (s *Store) Get(name string) (User, bool)", Line: 14, StartLine: 13, EndLine: 17, Func: true},
+		{Name: "validate", Signature: "func validate(u User) error", Line: 19, StartLine: 19, EndLine: 21, Func: true},
+	}
+	if got := f.Symbols(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Symbols() == %+v, want %+v", got, want)
+	}
+}
+
+func TestEnclosing(t *testing.T) {
+	f, err := ParseGo(testFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		line int
+		want string
+		ok   bool
+	}{
+		{15, "Store.Get", true},
+		{13, "Store.Get", true},
+		{20, "validate", true},
+		{4, "Store", true},
+		{18, "", false},
+		{0, "", false},
+	}
+	for _, test := range tests {
+		symbol, ok := f.Enclosing(test.line)
+		if symbol.Name != test.want || ok != test.ok {
+			t.Errorf("Enclosing(%d) == (%q, %v), want (%q, %v)", test.line, symbol.Name, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestReferences(t *testing.T) {
+	f, err := ParseGo(testFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"user", "ok", "s", "users", "name"}
+	if got := f.References(15, 16); !reflect.DeepEqual(got, want) {
+		t.Errorf("References(15, 16) == %q, want %q", got, want)
+	}
+	if got := f.Lookup("Get"); len(got) != 1 || got[0].Name != "Store.Get" {
+		t.Errorf("Lookup(%q) == %+v, want Store.Get", "Get", got)
+	}
+}
+
+func TestParseGoWithErrors(t *testing.T) {
+	f, err := ParseGo("package main\n\nfunc main() {\n\tif {\n}\n")
+	if err != nil {
+		t.Fatalf("ParseGo() error == %v, want a partial file", err)
+	}
+	if _, ok := f.Enclosing(3); !ok {
+		t.Error("Enclosing() found no function in a file with syntax errors")
+	}
+}
@@ -0,0 +1,133 @@
+// Package tasks tracks the goroutines llmsp runs in the background, such as
+// workspace hooks, telemetry and indexing.
+//
+// Every task has a name and a start time, so that the running tasks can be
+// listed when debugging operations that seem stuck, and every task's context
+// is cancelled when its group is closed. A task that panics is recovered, so
+// that a failing hook can't bring the server down.
+package tasks
+
+import (
+	"context"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Info describes a running task.
+type Info struct {
+	ID      int64     `json:"id"`
+	Name    string    `json:"name"`
+	Started time.Time `json:"started"`
+	// Elapsed is how long the task has been running, e.g. "1.5s"
+	Elapsed string `json:"elapsed"`
+}
+
+// Group is a group of background tasks. A nil *Group runs tasks without
+// tracking them.
+type Group struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	nextID  int64
+	running map[int64]Info
+
+	// Logf, if set, logs the panics of tasks
+	Logf func(format string, args ...any)
+}
+
+// NewGroup creates a new, empty group.
+func NewGroup() *Group {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Group{
+		ctx:     ctx,
+		cancel:  cancel,
+		running: make(map[int64]Info),
+	}
+}
+
+// Go runs fn in a new goroutine. The context passed to fn is cancelled when
+// the group is closed.
+func (g *Group) Go(name string, fn func(ctx context.Context)) {
+	if g == nil {
+		go func() {
+			defer g.recover(name)
+			fn(context.Background())
+		}()
+		return
+	}
+
+	g.mu.Lock()
+	g.nextID++
+	id := g.nextID
+	g.running[id] = Info{ID: id, Name: name, Started: time.Now()}
+	g.mu.Unlock()
+
+	g.wg.Add(1)
+	go func() {
+		defer func() {
+			g.mu.Lock()
+			delete(g.running, id)
+			g.mu.Unlock()
+			g.wg.Done()
+		}()
+		defer g.recover(name)
+		fn(g.ctx)
+	}()
+}
+
+// recover recovers a panicking task, logging the panic.
+func (g *Group) recover(name string) {
+	err := recover()
+	if err == nil {
+		return
+	}
+	if g != nil && g.Logf != nil {
+		g.Logf("panic in task %s: %v\n%s", name, err, debug.Stack())
+	}
+}
+
+// List returns the running tasks, oldest first.
+func (g *Group) List() []Info {
+	if g == nil {
+		return []Info{}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	infos := make([]Info, 0, len(g.running))
+	for _, info := range g.running {
+		info.Elapsed = time.Since(info.Started).Round(time.Millisecond).String()
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ID < infos[j].ID
+	})
+	return infos
+}
+
+// Close cancels the contexts of all tasks and waits up to timeout for them
+// to return. It reports whether all tasks returned in time.
+func (g *Group) Close(timeout time.Duration) bool {
+	if g == nil {
+		return true
+	}
+
+	g.cancel()
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
@@ -0,0 +1,78 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGroup(t *testing.T) {
+	g := NewGroup()
+
+	release := make(chan struct{})
+	g.Go("first", func(ctx context.Context) { <-release })
+	g.Go("second", func(ctx context.Context) { <-ctx.Done() })
+
+	running := g.List()
+	if len(running) != 2 || running[0].Name != "first" || running[1].Name != "second" {
+		t.Fatalf("List() == %+v, want first and second", running)
+	}
+
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(g.List()) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("List() == %+v after the first task returned", g.List())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if !g.Close(5 * time.Second) {
+		t.Error("Close() did not cancel the second task")
+	}
+	if running := g.List(); len(running) != 0 {
+		t.Errorf("List() == %+v after Close(), want no tasks", running)
+	}
+}
+
+func TestCloseTimeout(t *testing.T) {
+	g := NewGroup()
+	release := make(chan struct{})
+	defer close(release)
+	g.Go("stuck", func(ctx context.Context) { <-release })
+
+	if g.Close(10 * time.Millisecond) {
+		t.Error("Close() reported a stuck task as returned")
+	}
+}
+
+func TestNilGroup(t *testing.T) {
+	var g *Group
+	done := make(chan struct{})
+	g.Go("untracked", func(ctx context.Context) { close(done) })
+	<-done
+	if running := g.List(); len(running) != 0 {
+		t.Errorf("List() == %+v, want no tasks", running)
+	}
+}
+
+func TestPanic(t *testing.T) {
+	g := NewGroup()
+	logged := make(chan string, 1)
+	g.Logf = func(format string, args ...any) {
+		logged <- fmt.Sprintf(format, args...)
+	}
+
+	g.Go("hook", func(ctx context.Context) {
+		var arguments []any
+		_ = arguments[1].(float64)
+	})
+	if message := <-logged; !strings.Contains(message, "panic in task hook") {
+		t.Errorf("logged %q, want the panicking task", message)
+	}
+	if !g.Close(5 * time.Second) {
+		t.Error("Close() did not return after the task panicked")
+	}
+}
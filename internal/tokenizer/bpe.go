@@ -0,0 +1,90 @@
+package tokenizer
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	_ "embed"
+	"encoding/base64"
+	"strconv"
+	"sync"
+)
+
+// cl100kBase is the cl100k_base vocabulary of tiktoken
+// (github.com/openai/tiktoken, MIT licensed), gzipped. Every line holds a
+// base64 encoded token and its rank, the order in which byte pair encoding
+// merges it.
+//
+//go:embed cl100k_base.tiktoken.gz
+var cl100kBase []byte
+
+var (
+	ranksOnce sync.Once
+	ranks     map[string]int
+)
+
+// loadRanks decodes the vocabulary the first time it is needed. It panics if
+// the embedded file is corrupt, which the tests catch.
+func loadRanks() map[string]int {
+	ranksOnce.Do(func() {
+		r, err := gzip.NewReader(bytes.NewReader(cl100kBase))
+		if err != nil {
+			panic("tokenizer: reading vocabulary: " + err.Error())
+		}
+		ranks = make(map[string]int, 100256)
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			token, rank, ok := bytes.Cut(scanner.Bytes(), []byte(" "))
+			if !ok {
+				continue
+			}
+			decoded, err := base64.StdEncoding.DecodeString(string(token))
+			if err != nil {
+				panic("tokenizer: decoding vocabulary: " + err.Error())
+			}
+			n, err := strconv.Atoi(string(rank))
+			if err != nil {
+				panic("tokenizer: decoding vocabulary: " + err.Error())
+			}
+			ranks[string(decoded)] = n
+		}
+		if err := scanner.Err(); err != nil {
+			panic("tokenizer: reading vocabulary: " + err.Error())
+		}
+	})
+	return ranks
+}
+
+// encode calls fn with the end offset of every token of the pre-token
+// text[start:end], merging its bytes in the order of their ranks, until fn
+// returns false. It reports whether fn always returned true.
+func encode(ranks map[string]int, text string, start, end int, fn func(end int) bool) bool {
+	if _, ok := ranks[text[start:end]]; ok {
+		return fn(end)
+	}
+
+	// parts holds the start of every part, followed by end
+	parts := make([]int, 0, end-start+1)
+	for i := start; i <= end; i++ {
+		parts = append(parts, i)
+	}
+	for len(parts) > 2 {
+		best, bestRank := -1, 0
+		for i := 0; i+2 < len(parts); i++ {
+			if rank, ok := ranks[text[parts[i]:parts[i+2]]]; ok && (best < 0 || rank < bestRank) {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		parts = append(parts[:best+1], parts[best+2:]...)
+	}
+
+	for _, partEnd := range parts[1:] {
+		if !fn(partEnd) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,213 @@
+// Package tokenizer counts and truncates text in LLM tokens.
+//
+// The default tokenizer is the byte pair encoding of tiktoken's cl100k_base
+// vocabulary, which ships with the package: text is split with the cl100k
+// pre-tokenization pattern, so tokens never span word, number or
+// punctuation boundaries, and the bytes of every piece are merged into the
+// tokens of the vocabulary. The vocabulary is loaded the first time text is
+// tokenized. Claude's tokenizer isn't public, so counts are close to, rather
+// than exactly, what the API counts.
+package tokenizer
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Tokenizer splits text into tokens.
+type Tokenizer interface {
+	// Boundaries returns the byte offsets at which the tokens of text end, in
+	// increasing order. The last offset is len(text).
+	Boundaries(text string) []int
+}
+
+// bpe is the default, cl100k_base BPE tokenizer.
+type bpe struct{}
+
+// Default is the tokenizer used by the package level functions.
+var Default Tokenizer = bpe{}
+
+func (bpe) Boundaries(text string) []int {
+	var boundaries []int
+	scan(text, func(end int) bool {
+		boundaries = append(boundaries, end)
+		return true
+	})
+	return boundaries
+}
+
+// scan calls fn with the end offset of every token of text, until fn returns
+// false. Tokens are bytes, so they may end in the middle of a rune.
+func scan(text string, fn func(end int) bool) {
+	ranks := loadRanks()
+	for start := 0; start < len(text); {
+		end := preTokenEnd(text, start)
+		if !encode(ranks, text, start, end, fn) {
+			return
+		}
+		start = end
+	}
+}
+
+// preTokenEnd returns the end of the pre-token starting at start. Pre-tokens
+// follow the cl100k pattern:
+//
+//	'(s|t|re|ve|m|ll|d) | [^\r\n\pL\pN]?\pL+ | \pN{1,3} | ?[^\s\pL\pN]+[\r\n]* | \s*[\r\n]+ | \s+(?!\S) | \s+
+func preTokenEnd(text string, start int) int {
+	r, size := utf8.DecodeRuneInString(text[start:])
+
+	if r == '\'' {
+		rest := strings.ToLower(text[start+1 : minInt(start+3, len(text))])
+		for _, suffix := range []string{"re", "ve", "ll", "s", "t", "m", "d"} {
+			if strings.HasPrefix(rest, suffix) {
+				return start + 1 + len(suffix)
+			}
+		}
+	}
+
+	if unicode.IsLetter(r) {
+		return skip(text, start, unicode.IsLetter)
+	}
+	if r != '\r' && r != '\n' && !unicode.IsNumber(r) && start+size < len(text) {
+		if next, _ := utf8.DecodeRuneInString(text[start+size:]); unicode.IsLetter(next) {
+			return skip(text, start+size, unicode.IsLetter)
+		}
+	}
+
+	if unicode.IsNumber(r) {
+		end := start
+		for i := 0; i < 3 && end < len(text); i++ {
+			r, size := utf8.DecodeRuneInString(text[end:])
+			if !unicode.IsNumber(r) {
+				break
+			}
+			end += size
+		}
+		return end
+	}
+
+	symbolStart := start
+	if r == ' ' {
+		symbolStart += size
+	}
+	if symbolEnd := skip(text, symbolStart, isSymbol); symbolEnd > symbolStart {
+		return skip(text, symbolEnd, isNewline)
+	}
+
+	// Whitespace: runs containing a newline end after their last newline,
+	// other runs followed by text leave their last rune to it.
+	end := skip(text, start, unicode.IsSpace)
+	for i := end; i > start; {
+		r, size := utf8.DecodeLastRuneInString(text[:i])
+		if isNewline(r) {
+			return i
+		}
+		i -= size
+	}
+	if _, size := utf8.DecodeLastRuneInString(text[:end]); end < len(text) && end-size > start {
+		return end - size
+	}
+	return end
+}
+
+// skip returns the offset of the first rune at or after start for which
+// match returns false.
+func skip(text string, start int, match func(rune) bool) int {
+	for start < len(text) {
+		r, size := utf8.DecodeRuneInString(text[start:])
+		if !match(r) {
+			break
+		}
+		start += size
+	}
+	return start
+}
+
+func isSymbol(r rune) bool {
+	return !unicode.IsSpace(r) && !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
+
+func isNewline(r rune) bool {
+	return r == '\r' || r == '\n'
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Count returns the number of tokens in text.
+func Count(text string) int {
+	if _, ok := Default.(bpe); !ok {
+		return len(Default.Boundaries(text))
+	}
+	n := 0
+	scan(text, func(int) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+// Truncate returns the longest prefix of text that is at most maxTokens
+// tokens long, along with its length in tokens. The text is never cut in the
+// middle of a rune, even by tokenizers whose tokens are bytes.
+func Truncate(text string, maxTokens int) (string, int) {
+	if maxTokens <= 0 {
+		return "", 0
+	}
+	if _, ok := Default.(bpe); !ok {
+		boundaries := Default.Boundaries(text)
+		if len(boundaries) <= maxTokens {
+			return text, len(boundaries)
+		}
+		return text[:runeStartBefore(text, boundaries[maxTokens-1])], maxTokens
+	}
+
+	// Only the tokens up to the limit need to be scanned.
+	n, prefix := 0, 0
+	scan(text, func(end int) bool {
+		n++
+		prefix = end
+		return n < maxTokens
+	})
+	if prefix == len(text) {
+		return text, n
+	}
+	return text[:runeStartBefore(text, prefix)], n
+}
+
+// TruncateStart returns the longest suffix of text that is at most maxTokens
+// tokens long, along with its length in tokens. Like Truncate, it never cuts
+// a rune.
+func TruncateStart(text string, maxTokens int) (string, int) {
+	if maxTokens <= 0 {
+		return "", 0
+	}
+	boundaries := Default.Boundaries(text)
+	if len(boundaries) <= maxTokens {
+		return text, len(boundaries)
+	}
+	return text[runeStartAfter(text, boundaries[len(boundaries)-maxTokens-1]):], maxTokens
+}
+
+// runeStartBefore returns the start of the rune containing the byte at
+// offset i, or i if it is the end of text. Cutting text there drops a rune
+// that would otherwise be split.
+func runeStartBefore(text string, i int) int {
+	for i > 0 && i < len(text) && !utf8.RuneStart(text[i]) {
+		i--
+	}
+	return i
+}
+
+// runeStartAfter returns the start of the first rune at or after offset i.
+func runeStartAfter(text string, i int) int {
+	for i < len(text) && !utf8.RuneStart(text[i]) {
+		i++
+	}
+	return i
+}
@@ -0,0 +1,158 @@
+package tokenizer
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestCount(t *testing.T) {
+	// The counts of tiktoken's cl100k_base encoding
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"hello", 1},
+		{"hello world", 2},
+		{"func main() {", 4},
+		{"12345", 2},
+		{"\t\treturn nil", 3},
+		{"    if err != nil {\n        return err\n    }", 12},
+		{"internationalization", 2},
+		{"a   b", 3},
+		{"// Grüße, 世界! 🎉 naïve café", 15},
+	}
+
+	for _, test := range tests {
+		if got := Count(test.text); got != test.want {
+			t.Errorf("Count(%q) == %d, want %d", test.text, got, test.want)
+		}
+	}
+}
+
+func TestBoundariesCoverText(t *testing.T) {
+	text := "package main\n\nimport \"fmt\"\n\n// Grüße, 世界!\nfunc main() {\n\tfmt.Println(internationalization)\n}\n"
+	boundaries := Default.Boundaries(text)
+	prev := 0
+	for _, b := range boundaries {
+		if b <= prev {
+			t.Fatalf("boundaries are not increasing: %v", boundaries)
+		}
+		prev = b
+	}
+	if prev != len(text) {
+		t.Errorf("last boundary is %d, want %d", prev, len(text))
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	text := strings.Repeat("word ", 10)
+
+	got, n := Truncate(text, 3)
+	if got != "word word word" || n != 3 {
+		t.Errorf("Truncate() == %q, %d, want %q, 3", got, n, "word word word")
+	}
+	got, n = TruncateStart(text, 3)
+	if got != " word word " || n != 3 {
+		t.Errorf("TruncateStart() == %q, %d, want %q, 3", got, n, " word word ")
+	}
+	if got, n := Truncate(text, 100); got != text || n != Count(text) {
+		t.Errorf("Truncate() == %q, %d, want the whole text", got, n)
+	}
+}
+
+// byteTokenizer makes every byte a token, cutting runes apart.
+type byteTokenizer struct{}
+
+func (byteTokenizer) Boundaries(text string) []int {
+	boundaries := make([]int, len(text))
+	for i := range boundaries {
+		boundaries[i] = i + 1
+	}
+	return boundaries
+}
+
+func TestTruncateMultibyte(t *testing.T) {
+	defer func() { Default = bpe{} }()
+	text := "// Grüße, 世界! 🎉 naïve café\nfunc 你好() string { return \"𝔘𝔫𝔦𝔠𝔬𝔡𝔢\" }"
+
+	for _, tokenizer := range []Tokenizer{bpe{}, byteTokenizer{}} {
+		Default = tokenizer
+		for maxTokens := 1; maxTokens <= len(text); maxTokens++ {
+			prefix, n := Truncate(text, maxTokens)
+			if !utf8.ValidString(prefix) || !strings.HasPrefix(text, prefix) || n > maxTokens {
+				t.Errorf("%T: Truncate(%d) == %q, %d, want a valid prefix of at most %[2]d tokens", tokenizer, maxTokens, prefix, n)
+			}
+			suffix, n := TruncateStart(text, maxTokens)
+			if !utf8.ValidString(suffix) || !strings.HasSuffix(text, suffix) || n > maxTokens {
+				t.Errorf("%T: TruncateStart(%d) == %q, %d, want a valid suffix of at most %[2]d tokens", tokenizer, maxTokens, suffix, n)
+			}
+		}
+	}
+
+	// Multibyte runes are cut out whole
+	Default = byteTokenizer{}
+	if got, _ := Truncate("aé", 2); got != "a" {
+		t.Errorf("Truncate(\"aé\", 2) == %q, want \"a\"", got)
+	}
+	if got, _ := TruncateStart("éa", 2); got != "a" {
+		t.Errorf("TruncateStart(\"éa\", 2) == %q, want \"a\"", got)
+	}
+}
+
+// cl100k is the pre-tokenization pattern the scanner implements, without the
+// negative lookahead that Go's regexp package doesn't support. It only
+// matters for runs of whitespace followed by text, see
+// TestPreTokenEndWhitespace.
+var cl100k = regexp.MustCompile(`(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\pL\pN]?\pL+|\pN{1,3}| ?[^\s\pL\pN]+[\r\n]*|\s*[\r\n]+|\s+`)
+
+func TestPreTokenEndMatchesPattern(t *testing.T) {
+	texts := []string{
+		"package main\n\nimport \"fmt\"\n",
+		"func (s *server) Handle(ctx context.Context) error {\n\treturn nil\n}\n",
+		" \n\n\tx := 12345 // it's done\r\n",
+		"// Grüße, 世界! Don't stop___ \"quoted\"...\n\n\n",
+		"a\n  \n b  ",
+	}
+
+	for _, text := range texts {
+		var want, got []int
+		for _, loc := range cl100k.FindAllStringIndex(text, -1) {
+			want = append(want, loc[1])
+		}
+		for start := 0; start < len(text); {
+			start = preTokenEnd(text, start)
+			got = append(got, start)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("pre-tokens of %q end at %v, want %v", text, got, want)
+		}
+	}
+}
+
+func TestPreTokenEndWhitespace(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"a   b", []string{"a", "  ", " b"}},
+		{"\t\treturn", []string{"\t", "\treturn"}},
+		{"x  := 1", []string{"x", " ", " :=", " ", "1"}},
+		{"a\n    b", []string{"a", "\n", "   ", " b"}},
+		{"a   ", []string{"a", "   "}},
+	}
+	for _, test := range tests {
+		var got []string
+		for start := 0; start < len(test.text); {
+			end := preTokenEnd(test.text, start)
+			got = append(got, test.text[start:end])
+			start = end
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("pre-tokens of %q == %q, want %q", test.text, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package lsp
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sourcegraph/go-lsp"
+)
+
+const (
+	// defaultQuietPeriod is how long a document needs to go without changes
+	// before it is considered stable again.
+	defaultQuietPeriod = 500 * time.Millisecond
+	// churnThreshold is the number of content changes received in rapid
+	// succession after which a document is considered to be churning.
+	churnThreshold = 20
+)
+
+// churnState tracks the recent changes made to a single document.
+type churnState struct {
+	// lastChange is the time the last change was received
+	lastChange time.Time
+	// burst is the number of content changes received without a quiet period
+	burst int
+	// pending contains the content changes that have been received while the
+	// document was churning, but have not yet been applied
+	pending []lsp.TextDocumentContentChangeEvent
+	// version is the version of the document once the pending changes are
+	// applied
+	version int
+	// flush applies the pending changes once the document is stable again
+	flush *time.Timer
+}
+
+// churnTracker detects documents that are changing faster than is worth
+// reacting to, such as during a global search-and-replace or formatter run.
+// While a document is churning its changes are queued up rather than applied
+// one by one, and work like autocompletion is skipped.
+type churnTracker struct {
+	mu          sync.Mutex
+	quietPeriod time.Duration
+	docs        map[lsp.DocumentURI]*churnState
+}
+
+func newChurnTracker() *churnTracker {
+	return &churnTracker{
+		quietPeriod: defaultQuietPeriod,
+		docs:        make(map[lsp.DocumentURI]*churnState),
+	}
+}
+
+// SetQuietPeriod sets how long a document needs to go without changes before
+// it is considered stable.
+func (c *churnTracker) SetQuietPeriod(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.quietPeriod = d
+}
+
+// Record records a change to the document containing the given content
+// changes and bringing it to version. If the document is churning, the
+// changes are queued, onStable is scheduled to run once the document is
+// stable again and Record returns true. Otherwise the caller is expected to
+// apply the changes immediately.
+func (c *churnTracker) Record(uri lsp.DocumentURI, version int, changes []lsp.TextDocumentContentChangeEvent, onStable func()) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	state, ok := c.docs[uri]
+	if !ok {
+		state = &churnState{}
+		c.docs[uri] = state
+	}
+
+	now := time.Now()
+	if now.Sub(state.lastChange) < c.quietPeriod {
+		state.burst += len(changes)
+	} else {
+		state.burst = len(changes)
+	}
+	state.lastChange = now
+
+	if state.burst < churnThreshold && len(state.pending) == 0 {
+		return false
+	}
+
+	state.pending = coalesceChanges(append(state.pending, changes...))
+	state.version = version
+	if state.flush != nil {
+		state.flush.Stop()
+	}
+	state.flush = time.AfterFunc(c.quietPeriod, onStable)
+
+	return true
+}
+
+// Churning reports whether the document is currently churning.
+func (c *churnTracker) Churning(uri lsp.DocumentURI) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	state, ok := c.docs[uri]
+	return ok && state.burst >= churnThreshold && time.Since(state.lastChange) < c.quietPeriod
+}
+
+// pendingChanges are the queued changes of a document.
+type pendingChanges struct {
+	changes []lsp.TextDocumentContentChangeEvent
+	// version is the version of the document once the changes are applied
+	version int
+}
+
+// TakePending removes and returns all queued changes, by document.
+func (c *churnTracker) TakePending() map[lsp.DocumentURI]pendingChanges {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pending := make(map[lsp.DocumentURI]pendingChanges)
+	for uri, state := range c.docs {
+		if len(state.pending) > 0 {
+			pending[uri] = pendingChanges{changes: state.pending, version: state.version}
+			state.pending = nil
+		}
+		if state.flush != nil {
+			state.flush.Stop()
+			state.flush = nil
+		}
+	}
+
+	return pending
+}
+
+// Forget stops tracking the document.
+func (c *churnTracker) Forget(uri lsp.DocumentURI) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if state, ok := c.docs[uri]; ok && state.flush != nil {
+		state.flush.Stop()
+	}
+	delete(c.docs, uri)
+}
+
+// coalesceChanges drops all changes preceding the last full document change,
+// as they are overwritten by it anyway.
+func coalesceChanges(changes []lsp.TextDocumentContentChangeEvent) []lsp.TextDocumentContentChangeEvent {
+	for i := len(changes) - 1; i > 0; i-- {
+		if changes[i].Range == nil {
+			return changes[i:]
+		}
+	}
+	return changes
+}
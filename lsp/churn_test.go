@@ -0,0 +1,59 @@
+package lsp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/go-lsp"
+)
+
+func TestChurnTracker(t *testing.T) {
+	c := newChurnTracker()
+	c.SetQuietPeriod(50 * time.Millisecond)
+	uri := lsp.DocumentURI("file:///main.go")
+	change := []lsp.TextDocumentContentChangeEvent{{Range: &lsp.Range{}, Text: "x"}}
+
+	stable := make(chan struct{}, 1)
+	onStable := func() { stable <- struct{}{} }
+
+	queued := 0
+	for i := 0; i < churnThreshold+5; i++ {
+		if c.Record(uri, i+1, change, onStable) {
+			queued++
+		}
+	}
+	if want := 6; queued != want {
+		t.Errorf("queued %d changes, want %d", queued, want)
+	}
+	if !c.Churning(uri) {
+		t.Error("expected document to be churning")
+	}
+
+	select {
+	case <-stable:
+	case <-time.After(time.Second):
+		t.Fatal("document never became stable")
+	}
+	if c.Churning(uri) {
+		t.Error("expected document to be stable")
+	}
+	pending := c.TakePending()[uri]
+	if len(pending.changes) != queued {
+		t.Errorf("got %d pending changes, want %d", len(pending.changes), queued)
+	}
+	if want := churnThreshold + 5; pending.version != want {
+		t.Errorf("got pending version %d, want %d", pending.version, want)
+	}
+}
+
+func TestCoalesceChanges(t *testing.T) {
+	changes := []lsp.TextDocumentContentChangeEvent{
+		{Range: &lsp.Range{}, Text: "a"},
+		{Text: "full"},
+		{Range: &lsp.Range{}, Text: "b"},
+	}
+	got := coalesceChanges(changes)
+	if len(got) != 2 || got[0].Text != "full" {
+		t.Errorf("coalesceChanges() == %+v", got)
+	}
+}
@@ -0,0 +1,69 @@
+package lsp
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pjlast/llmsp/internal/config"
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// rawConfigurationParams are the parameters of a
+// workspace/didChangeConfiguration notification, with the settings kept
+// encoded so that they can be merged with the config files.
+type rawConfigurationParams struct {
+	Settings struct {
+		LLMSP json.RawMessage `json:"llmsp"`
+	} `json:"settings"`
+}
+
+// settings merges the settings sent by the editor with the config files and
+// the command line flags. From highest to lowest precedence: the workspace's
+// config file, the editor, the user's config file and the flags. Unless the
+// workspace is trusted, its config file may only set the settings allowed by
+// config.Restrict. The access token passed on the command line is used as a
+// fallback by the provider. req may be nil at startup, before the editor has
+// sent its settings.
+func (s *server) settings(req *jsonrpc2.Request) (types.LLMSPSettings, error) {
+	var flags json.RawMessage
+	if s.URL != "" {
+		flags, _ = json.Marshal(map[string]any{"sourcegraph": map[string]string{"url": s.URL}})
+	}
+	user, err := config.Load(config.UserPath())
+	if err != nil {
+		return types.LLMSPSettings{}, err
+	}
+	var params rawConfigurationParams
+	if req != nil && req.Params != nil {
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return types.LLMSPSettings{}, err
+		}
+	}
+	root := strings.TrimPrefix(string(s.RootURI), "file://")
+	if root == "" {
+		return config.Merge(flags, user, params.Settings.LLMSP)
+	}
+
+	path := config.WorkspacePath(root)
+	workspace, err := config.Load(path)
+	if err != nil {
+		return types.LLMSPSettings{}, err
+	}
+	// Whether the workspace is trusted can't be up to its own config file
+	trusted, err := config.Merge(flags, user, params.Settings.LLMSP)
+	if err != nil {
+		return types.LLMSPSettings{}, err
+	}
+	if !config.Trusted(trusted.TrustedWorkspaces, root) {
+		var dropped []string
+		if workspace, dropped, err = config.Restrict(workspace); err != nil {
+			return types.LLMSPSettings{}, err
+		}
+		if len(dropped) > 0 {
+			s.Logger.Warn("ignoring settings of an untrusted workspace config file", "path", path, "settings", strings.Join(dropped, ", "))
+		}
+	}
+
+	return config.Merge(flags, user, params.Settings.LLMSP, workspace)
+}
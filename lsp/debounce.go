@@ -0,0 +1,69 @@
+package lsp
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// defaultCompletionDelay is how long a completion request waits for newer
+// requests before it is computed.
+const defaultCompletionDelay = 100 * time.Millisecond
+
+// debouncer coalesces bursts of requests, such as the completion requests
+// sent on every keystroke, into the last one. Every request supersedes the
+// request before it: a superseded request that is still waiting gives up,
+// and one that is already being computed has its context cancelled.
+type debouncer struct {
+	mu    sync.Mutex
+	delay time.Duration
+	// cancel cancels the context of the most recent request
+	cancel context.CancelFunc
+}
+
+func newDebouncer(delay time.Duration) *debouncer {
+	return &debouncer{delay: delay}
+}
+
+// SetDelay sets how long requests wait for newer requests.
+func (d *debouncer) SetDelay(delay time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.delay = delay
+}
+
+// Wait registers a new request and waits for the delay to pass without a
+// newer request arriving. It returns a context for computing the request,
+// which is cancelled once a newer request arrives, and false if the request
+// was superseded or cancelled while waiting. The returned cancel function
+// must always be called.
+func (d *debouncer) Wait(ctx context.Context) (context.Context, context.CancelFunc, bool) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	d.mu.Lock()
+	if d.cancel != nil {
+		d.cancel()
+	}
+	d.cancel = cancel
+	delay := d.delay
+	d.mu.Unlock()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return ctx, cancel, ctx.Err() == nil
+	case <-ctx.Done():
+		return ctx, cancel, false
+	}
+}
+
+// Cancel cancels the most recent request, e.g. because the document it was
+// made for is about to change.
+func (d *debouncer) Cancel() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.cancel != nil {
+		d.cancel()
+	}
+}
@@ -0,0 +1,51 @@
+package lsp
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDebouncerLastWriterWins(t *testing.T) {
+	d := newDebouncer(50 * time.Millisecond)
+
+	results := make(chan bool, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			_, cancel, ok := d.Wait(context.Background())
+			defer cancel()
+			results <- ok
+		}()
+		// Make sure the requests arrive in order
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	var computed int
+	for i := 0; i < 3; i++ {
+		if <-results {
+			computed++
+		}
+	}
+	if computed != 1 {
+		t.Errorf("computed %d requests, want 1", computed)
+	}
+}
+
+func TestDebouncerCancelsInFlight(t *testing.T) {
+	d := newDebouncer(time.Millisecond)
+
+	ctx, cancel, ok := d.Wait(context.Background())
+	defer cancel()
+	if !ok {
+		t.Fatal("request was superseded")
+	}
+
+	// A newer request cancels the one being computed
+	_, cancelNewer, _ := d.Wait(context.Background())
+	defer cancelNewer()
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("request was not cancelled")
+	}
+}
@@ -0,0 +1,45 @@
+package lsp
+
+import (
+	"fmt"
+
+	"github.com/pjlast/llmsp/internal/position"
+	"github.com/sourcegraph/go-lsp"
+)
+
+// applyContentChanges applies the given content changes to text in order and
+// returns the resulting text. Changes without a range replace the entire
+// document.
+func applyContentChanges(text string, changes []lsp.TextDocumentContentChangeEvent) (string, error) {
+	for _, change := range changes {
+		if change.Range == nil {
+			text = change.Text
+			continue
+		}
+
+		start, err := offsetAt(text, change.Range.Start)
+		if err != nil {
+			return "", err
+		}
+		end, err := offsetAt(text, change.Range.End)
+		if err != nil {
+			return "", err
+		}
+		if end < start {
+			return "", fmt.Errorf("invalid range: end %d precedes start %d", end, start)
+		}
+
+		text = text[:start] + change.Text + text[end:]
+	}
+
+	return text, nil
+}
+
+// offsetAt converts an LSP position into a byte offset into text, see
+// position.Offset. Negative positions are invalid.
+func offsetAt(text string, pos lsp.Position) (int, error) {
+	if pos.Line < 0 || pos.Character < 0 {
+		return 0, fmt.Errorf("invalid position %d:%d", pos.Line, pos.Character)
+	}
+	return position.Offset(text, pos), nil
+}
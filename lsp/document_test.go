@@ -0,0 +1,159 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/sourcegraph/go-lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func TestApplyContentChanges(t *testing.T) {
+	rng := func(sl, sc, el, ec int) *lsp.Range {
+		return &lsp.Range{
+			Start: lsp.Position{Line: sl, Character: sc},
+			End:   lsp.Position{Line: el, Character: ec},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		text    string
+		changes []lsp.TextDocumentContentChangeEvent
+		want    string
+	}{
+		{
+			name:    "full replacement",
+			text:    "foo",
+			changes: []lsp.TextDocumentContentChangeEvent{{Text: "bar"}},
+			want:    "bar",
+		},
+		{
+			name:    "insert",
+			text:    "package main\n\nfunc main() {}\n",
+			changes: []lsp.TextDocumentContentChangeEvent{{Range: rng(2, 13, 2, 13), Text: "\n\tprintln()\n"}},
+			want:    "package main\n\nfunc main() {\n\tprintln()\n}\n",
+		},
+		{
+			name:    "delete across lines",
+			text:    "a\nb\nc\n",
+			changes: []lsp.TextDocumentContentChangeEvent{{Range: rng(0, 1, 2, 0), Text: ""}},
+			want:    "ac\n",
+		},
+		{
+			name: "sequential changes",
+			text: "hello world",
+			changes: []lsp.TextDocumentContentChangeEvent{
+				{Range: rng(0, 0, 0, 5), Text: "goodbye"},
+				{Range: rng(0, 8, 0, 13), Text: "moon"},
+			},
+			want: "goodbye moon",
+		},
+		{
+			name:    "utf-16 surrogate pairs",
+			text:    "x := \"😀😀\"",
+			changes: []lsp.TextDocumentContentChangeEvent{{Range: rng(0, 8, 0, 10), Text: "!"}},
+			want:    "x := \"😀!\"",
+		},
+		{
+			name:    "character past end of line",
+			text:    "ab\ncd",
+			changes: []lsp.TextDocumentContentChangeEvent{{Range: rng(0, 10, 0, 10), Text: "!"}},
+			want:    "ab!\ncd",
+		},
+		{
+			name:    "append at end of document",
+			text:    "ab",
+			changes: []lsp.TextDocumentContentChangeEvent{{Range: rng(1, 0, 1, 0), Text: "\ncd"}},
+			want:    "ab\ncd",
+		},
+	}
+
+	for _, test := range tests {
+		got, err := applyContentChanges(test.text, test.changes)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: applyContentChanges() == %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestDocumentLifecycle(t *testing.T) {
+	ctx := context.Background()
+	uri := lsp.DocumentURI("file:///main.go")
+	s := NewServer("", "")
+	item := lsp.TextDocumentItem{URI: uri, Version: 1, Text: "package main\n"}
+	if _, err := s.textDocumentDidOpen(ctx, nil, nil, lsp.DidOpenTextDocumentParams{TextDocument: item}); err != nil {
+		t.Fatal(err)
+	}
+	change := lsp.DidChangeTextDocumentParams{
+		TextDocument:   lsp.VersionedTextDocumentIdentifier{TextDocumentIdentifier: lsp.TextDocumentIdentifier{URI: uri}, Version: 2},
+		ContentChanges: []lsp.TextDocumentContentChangeEvent{{Text: "package lib\n"}},
+	}
+	if _, err := s.textDocumentDidChange(ctx, nil, nil, change); err != nil {
+		t.Fatal(err)
+	}
+	if doc, _ := s.Documents.Get(uri); doc.Saved {
+		t.Error("changed document is saved, want unsaved")
+	}
+
+	if _, err := s.textDocumentDidSave(ctx, nil, nil, lsp.DidSaveTextDocumentParams{TextDocument: lsp.TextDocumentIdentifier{URI: uri}}); err != nil {
+		t.Fatal(err)
+	}
+	if doc, _ := s.Documents.Get(uri); !doc.Saved || doc.Text != "package lib\n" {
+		t.Errorf("saved document is (%q, saved %v), want (%q, saved true)", doc.Text, doc.Saved, "package lib\n")
+	}
+
+	if _, err := s.textDocumentDidClose(ctx, nil, nil, lsp.DidCloseTextDocumentParams{TextDocument: lsp.TextDocumentIdentifier{URI: uri}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Documents.Get(uri); ok {
+		t.Error("closed document is still stored")
+	}
+}
+
+func TestHandleDocumentChangesInOrder(t *testing.T) {
+	s := NewServer("", "")
+	uri := lsp.DocumentURI("file:///main.go")
+	notify := func(method string, params any) {
+		raw, err := json.Marshal(params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		message := json.RawMessage(raw)
+		s.Handle(context.Background(), nil, &jsonrpc2.Request{Method: method, Params: &message, Notif: true})
+	}
+
+	notify("textDocument/didOpen", lsp.DidOpenTextDocumentParams{TextDocument: lsp.TextDocumentItem{URI: uri}})
+	for i := 0; i < 100; i++ {
+		notify("textDocument/didChange", lsp.DidChangeTextDocumentParams{
+			TextDocument: lsp.VersionedTextDocumentIdentifier{TextDocumentIdentifier: lsp.TextDocumentIdentifier{URI: uri}, Version: i + 1},
+			ContentChanges: []lsp.TextDocumentContentChangeEvent{{
+				Range: &lsp.Range{Start: lsp.Position{Character: i}, End: lsp.Position{Character: i}},
+				Text:  string(rune('a' + i%26)),
+			}},
+		})
+	}
+
+	var want strings.Builder
+	for i := 0; i < 100; i++ {
+		want.WriteRune(rune('a' + i%26))
+	}
+	// Changes to a churning document are queued until the next request,
+	// and so are their versions
+	if version := s.Documents.Version(uri); version != churnThreshold-1 {
+		t.Errorf("version of the churning document == %d, want %d, the version of its text", version, churnThreshold-1)
+	}
+	s.flushPendingChanges()
+	if got := s.Documents.Text(uri); got != want.String() {
+		t.Errorf("document == %q, want %q", got, want.String())
+	}
+	if version := s.Documents.Version(uri); version != 100 {
+		t.Errorf("version == %d, want 100", version)
+	}
+}
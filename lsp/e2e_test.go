@@ -0,0 +1,295 @@
+package lsp_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pjlast/llmsp/internal/sgtest"
+	"github.com/pjlast/llmsp/lsp"
+	"github.com/pjlast/llmsp/lsp/lsptest"
+	"github.com/pjlast/llmsp/types"
+	golsp "github.com/sourcegraph/go-lsp"
+)
+
+// start starts a server configured for the instance and with the
+// Sourcegraph settings, and initializes it with the client capabilities.
+func start(t *testing.T, instance *httptest.Server, capabilities, settings map[string]any) (*lsptest.Client, types.InitializeResult) {
+	t.Helper()
+	ctx := context.Background()
+	// Keep the config files and history of the user out of the test
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+	t.Setenv("XDG_DATA_HOME", filepath.Join(dir, "data"))
+
+	client := lsptest.NewClient(t, lsp.NewServer("", ""))
+	result, err := client.Initialize(ctx, map[string]any{
+		"rootUri":      "file://" + dir,
+		"capabilities": capabilities,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sourcegraph := map[string]any{
+		"url":             instance.URL,
+		"accessToken":     "token",
+		"telemetry":       "off",
+		"uidFile":         filepath.Join(dir, "uid"),
+		"autoComplete":    "always",
+		"completionDelay": 1,
+	}
+	for key, value := range settings {
+		sourcegraph[key] = value
+	}
+	if err := client.Configure(ctx, map[string]any{"sourcegraph": sourcegraph}); err != nil {
+		t.Fatal(err)
+	}
+	return client, result
+}
+
+func TestE2ECapabilities(t *testing.T) {
+	ctx := context.Background()
+	instance := sgtest.NewInstance(t, "")
+	diagnostic := types.Diagnostic{Message: "undefined: x"}
+	params := types.CodeActionParams{
+		TextDocument: golsp.TextDocumentIdentifier{URI: "file:///main.go"},
+		Context:      types.CodeActionContext{Diagnostics: []types.Diagnostic{diagnostic}, Only: []string{"cody.fix"}},
+	}
+
+	// Clients that resolve edits get the fix without its command, the
+	// others get the command
+	for _, resolve := range []bool{true, false} {
+		capabilities := map[string]any{}
+		if resolve {
+			capabilities["textDocument"] = map[string]any{
+				"codeAction": map[string]any{"resolveSupport": map[string]any{"properties": []string{"edit"}}},
+			}
+		}
+		client, result := start(t, instance, capabilities, nil)
+
+		sync := result.Capabilities.TextDocumentSync
+		if sync == nil || sync.Options == nil || sync.Options.Change != golsp.TDSKIncremental {
+			t.Errorf("text document sync == %+v, want incremental changes", sync)
+		}
+		if commands := result.Capabilities.ExecuteCommandProvider; commands == nil || !contains(commands.Commands, "cody.translate") {
+			t.Errorf("commands == %+v, want cody.translate among them", commands)
+		}
+
+		var actions []types.CodeAction
+		if err := client.Call(ctx, "textDocument/codeAction", params, &actions); err != nil {
+			t.Fatal(err)
+		}
+		if len(actions) != 1 {
+			t.Fatalf("got %d code actions, want the fix", len(actions))
+		}
+		if resolve && (actions[0].Command != nil || actions[0].Data == nil) {
+			t.Errorf("got fix %+v, want data to resolve and no command", actions[0])
+		}
+		if !resolve && (actions[0].Command == nil || actions[0].Data != nil) {
+			t.Errorf("got fix %+v, want a command and no data", actions[0])
+		}
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func TestE2ECommandProgressAndEdit(t *testing.T) {
+	ctx := context.Background()
+	instance := sgtest.NewInstance(t, "func add(a, b int) int {\n\treturn a + b\n}\n```")
+	client, _ := start(t, instance, nil, nil)
+
+	uri := golsp.DocumentURI("file:///src/add.go")
+	if err := client.DidOpen(ctx, uri, "package add\n\nfunc add(a, b int) int {\n}\n"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ExecuteCommand(ctx, "cody", string(uri), 2, 3, "Implement add", true, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// The command reports its progress on the token it creates
+	creates, err := client.Wait("window/workDoneProgress/create", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var create types.WorkDoneProgressCreateParams
+	client.Decode(creates[len(creates)-1], &create)
+	progress, err := client.Wait("$/progress", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kinds []string
+	for _, message := range progress {
+		var report struct {
+			Token string
+			Value struct{ Kind string }
+		}
+		client.Decode(message, &report)
+		if report.Token == create.Token {
+			kinds = append(kinds, report.Value.Kind)
+		}
+	}
+	if len(kinds) < 2 || kinds[0] != "begin" || kinds[len(kinds)-1] != "end" {
+		t.Errorf("progress on the command's token == %q, want it to begin and end", kinds)
+	}
+
+	// The edit replaces the lines of the open version of the document
+	edits, err := client.Wait("workspace/applyEdit", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var edit struct {
+		Edit struct {
+			DocumentChanges []struct {
+				TextDocument golsp.VersionedTextDocumentIdentifier
+				Edits        []golsp.TextEdit
+			}
+		}
+	}
+	client.Decode(edits[0], &edit)
+	if len(edit.Edit.DocumentChanges) != 1 || len(edit.Edit.DocumentChanges[0].Edits) != 1 {
+		t.Fatalf("got edit %+v, want one change of one document", edit.Edit)
+	}
+	change := edit.Edit.DocumentChanges[0]
+	if change.TextDocument.URI != uri || change.TextDocument.Version != 1 {
+		t.Errorf("edit of %+v, want version 1 of %s", change.TextDocument, uri)
+	}
+	wantRange := golsp.Range{Start: golsp.Position{Line: 2}, End: golsp.Position{Line: 3, Character: 1}}
+	if got := change.Edits[0]; got.Range != wantRange || got.NewText != "func add(a, b int) int {\n\treturn a + b\n}" {
+		t.Errorf("got text edit %+v, want the implementation over %+v", got, wantRange)
+	}
+}
+
+func TestE2ECompletion(t *testing.T) {
+	ctx := context.Background()
+	instance := sgtest.NewInstance(t, "return a + b")
+	client, _ := start(t, instance, nil, nil)
+
+	uri := golsp.DocumentURI("file:///src/add.go")
+	if err := client.DidOpen(ctx, uri, "package add\n\nfunc add(a, b int) int {\n\t\n}\n"); err != nil {
+		t.Fatal(err)
+	}
+	list, err := client.Completion(ctx, uri, golsp.Position{Line: 3, Character: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list == nil || len(list.Items) == 0 {
+		t.Fatalf("got completions %+v, want the completion of the instance", list)
+	}
+	if !strings.Contains(list.Items[0].InsertText+list.Items[0].Label, "return a + b") {
+		t.Errorf("got completion %+v, want it to contain the completion of the instance", list.Items[0])
+	}
+}
+
+func TestE2EManualCompletion(t *testing.T) {
+	ctx := context.Background()
+	instance := sgtest.NewInstance(t, "Println()")
+	client, result := start(t, instance, nil, map[string]any{"completionTrigger": "manual"})
+	if got := result.Capabilities.CompletionProvider.TriggerCharacters; len(got) == 0 {
+		t.Error("no trigger characters announced")
+	}
+
+	uri := golsp.DocumentURI("file:///src/main.go")
+	if err := client.DidOpen(ctx, uri, "package main\n\nfunc main() {\n\tfmt.\n\tfmt.Pr\n}\n"); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		pos  golsp.Position
+		kind golsp.CompletionTriggerKind
+		want bool
+	}{
+		{golsp.Position{Line: 4, Character: 7}, 3, false},
+		{golsp.Position{Line: 3, Character: 5}, golsp.CTKTriggerCharacter, true},
+		{golsp.Position{Line: 4, Character: 7}, golsp.CTKInvoked, true},
+	}
+	for _, test := range tests {
+		var list types.CompletionList
+		params := types.CompletionParams{
+			TextDocumentPositionParams: golsp.TextDocumentPositionParams{TextDocument: golsp.TextDocumentIdentifier{URI: uri}, Position: test.pos},
+			Context:                    golsp.CompletionContext{TriggerKind: test.kind},
+		}
+		if err := client.Call(ctx, "textDocument/completion", params, &list); err != nil {
+			t.Fatal(err)
+		}
+		if got := len(list.Items) > 0; got != test.want {
+			t.Errorf("completion triggered by %d at %+v returned %d items, want items: %v", test.kind, test.pos, len(list.Items), test.want)
+		}
+	}
+}
+
+func TestE2EInvalidSampling(t *testing.T) {
+	ctx := context.Background()
+	instance := sgtest.NewInstance(t, "")
+	client, _ := start(t, instance, nil, nil)
+
+	before := len(client.Received("window/logMessage"))
+	if err := client.Configure(ctx, map[string]any{
+		"sampling": map[string]any{"chat": map[string]any{"temperature": 3}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// The error comes before the message that the configuration was applied
+	messages, err := client.Wait("window/logMessage", before+2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logged golsp.LogMessageParams
+	client.Decode(messages[before], &logged)
+	if logged.Type != golsp.MTError || !strings.Contains(logged.Message, "temperature 3 is not between 0 and 1") {
+		t.Errorf("logged %+v, want an error about the temperature", logged)
+	}
+}
+
+func TestE2ECompletionRateLimited(t *testing.T) {
+	ctx := context.Background()
+	handler := sgtest.Handler("Println()")
+	instance := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), "query GetCompletions") {
+			http.Error(w, `{"error": "you have exceeded the rate limit"}`, http.StatusTooManyRequests)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(instance.Close)
+	client, _ := start(t, instance, nil, nil)
+
+	uri := golsp.DocumentURI("file:///src/main.go")
+	if err := client.DidOpen(ctx, uri, "package main\n\nfunc main() {\n\tfmt.Pr\n}\n"); err != nil {
+		t.Fatal(err)
+	}
+	var list types.CompletionList
+	params := types.CompletionParams{
+		TextDocumentPositionParams: golsp.TextDocumentPositionParams{TextDocument: golsp.TextDocumentIdentifier{URI: uri}, Position: golsp.Position{Line: 3, Character: 7}},
+		Context:                    golsp.CompletionContext{TriggerKind: golsp.CTKInvoked},
+	}
+	if err := client.Call(ctx, "textDocument/completion", params, &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Items) != 0 {
+		t.Errorf("got %d completions, want none", len(list.Items))
+	}
+
+	// The completion is empty, but the user is told why
+	messages, err := client.Wait("window/showMessage", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var shown golsp.ShowMessageParams
+	client.Decode(messages[0], &shown)
+	if shown.Type != golsp.MTWarning {
+		t.Errorf("showed %+v, want a rate limit warning", shown)
+	}
+}
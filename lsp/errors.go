@@ -0,0 +1,99 @@
+package lsp
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/pjlast/llmsp/claude"
+	"github.com/pjlast/llmsp/internal/documents"
+	"github.com/pjlast/llmsp/internal/i18n"
+	"github.com/sourcegraph/go-lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// apiErrorInterval is the minimum time between two messages about the same
+// kind of API error, so that failing completions don't flood the editor.
+const apiErrorInterval = time.Minute
+
+// apiErrorKinds are the API errors that are shown to the user.
+var apiErrorKinds = []error{claude.ErrRateLimited, claude.ErrUnauthorized, claude.ErrContextTooLong}
+
+// apiErrorMessage returns an actionable explanation of a completions API
+// error in the language of messages, along with its kind. It returns false
+// for other errors.
+func apiErrorMessage(messages i18n.Localizer, err error) (string, error, bool) {
+	var kind error
+	for _, k := range apiErrorKinds {
+		if errors.Is(err, k) {
+			kind = k
+			break
+		}
+	}
+	if kind == nil {
+		return "", nil, false
+	}
+
+	var apiErr *claude.APIError
+	errors.As(err, &apiErr)
+
+	switch kind {
+	case claude.ErrRateLimited:
+		message := messages.T(i18n.RateLimited)
+		if apiErr != nil && apiErr.RetryAfter > 0 {
+			message += " " + messages.T(i18n.RateLimitedRetryIn, apiErr.RetryAfter)
+		} else {
+			message += " " + messages.T(i18n.RateLimitedWait)
+		}
+		return message, kind, true
+	case claude.ErrUnauthorized:
+		return messages.T(i18n.Unauthorized), kind, true
+	default:
+		return messages.T(i18n.ContextTooLong), kind, true
+	}
+}
+
+// showAPIError shows a message to the user if err is a completions API error
+// that they can act on.
+func (s *server) showAPIError(ctx context.Context, conn *jsonrpc2.Conn, err error) {
+	message, kind, ok := apiErrorMessage(s.messages, err)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	if time.Since(s.apiErrorsShown[kind]) < apiErrorInterval {
+		s.mu.Unlock()
+		return
+	}
+	s.apiErrorsShown[kind] = time.Now()
+	s.mu.Unlock()
+
+	mt := lsp.MTError
+	if kind == claude.ErrRateLimited {
+		mt = lsp.MTWarning
+	}
+	conn.Notify(ctx, "window/showMessage", lsp.ShowMessageParams{Type: mt, Message: message})
+}
+
+// surfaceAPIErrors is middleware that shows completions API errors returned
+// by the handler to the user.
+func surfaceAPIErrors[T any](s *server, handler LSPHandler[T]) LSPHandler[T] {
+	return func(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, params T) (any, error) {
+		res, err := handler(ctx, conn, req, params)
+		if err != nil {
+			s.showAPIError(ctx, conn, err)
+		}
+
+		return res, err
+	}
+}
+
+// requestError returns the error to respond to a request with. Requests on
+// documents that aren't open, or on lines they don't have, are invalid.
+func requestError(err error) error {
+	if errors.Is(err, documents.ErrNotOpen) || errors.Is(err, documents.ErrLineOutOfRange) {
+		return &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams, Message: err.Error()}
+	}
+	return err
+}
@@ -0,0 +1,52 @@
+package lsp
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/pjlast/llmsp/claude"
+	"github.com/pjlast/llmsp/internal/documents"
+	"github.com/pjlast/llmsp/internal/i18n"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func TestAPIErrorMessage(t *testing.T) {
+	tests := []struct {
+		err  error
+		want error
+	}{
+		{fmt.Errorf("completion failed: %w", claude.ErrRateLimited), claude.ErrRateLimited},
+		{claude.ErrUnauthorized, claude.ErrUnauthorized},
+		{claude.ErrContextTooLong, claude.ErrContextTooLong},
+		{errors.New("connection refused"), nil},
+	}
+
+	for _, test := range tests {
+		message, kind, ok := apiErrorMessage(i18n.Localizer{}, test.err)
+		if ok != (test.want != nil) || kind != test.want {
+			t.Errorf("apiErrorMessage(%v) == %v, %v, want %v", test.err, kind, ok, test.want)
+		}
+		if ok && message == "" {
+			t.Errorf("apiErrorMessage(%v) returned an empty message", test.err)
+		}
+	}
+}
+
+func TestRequestError(t *testing.T) {
+	for _, err := range []error{
+		fmt.Errorf("explain: %w", documents.ErrNotOpen),
+		fmt.Errorf("%w: line 12", documents.ErrLineOutOfRange),
+	} {
+		var rpcErr *jsonrpc2.Error
+		if !errors.As(requestError(err), &rpcErr) || rpcErr.Code != jsonrpc2.CodeInvalidParams {
+			t.Errorf("requestError(%v) == %v, want an invalid params error", err, requestError(err))
+		}
+	}
+	if err := errors.New("connection refused"); requestError(err) != err {
+		t.Errorf("requestError() changed an unrelated error")
+	}
+	if requestError(nil) != nil {
+		t.Errorf("requestError(nil) != nil")
+	}
+}
@@ -0,0 +1,114 @@
+package lsp
+
+import (
+	"context"
+	"path"
+	"strings"
+
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/go-lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// matchesHook reports whether the hook should run for an event on uri.
+func matchesHook(hook types.Hook, event string, uri lsp.DocumentURI) bool {
+	if hook.Event != event || hook.Command == "" {
+		return false
+	}
+	if hook.Pattern == "" {
+		return true
+	}
+
+	filename := strings.TrimPrefix(string(uri), "file://")
+	if ok, _ := path.Match(hook.Pattern, filename); ok {
+		return true
+	}
+	ok, _ := path.Match(hook.Pattern, path.Base(filename))
+	return ok
+}
+
+// hookArguments replaces the placeholders in the hook's arguments.
+func hookArguments(hook types.Hook, uri lsp.DocumentURI, contents string) []any {
+	lastLine := strings.Count(contents, "\n")
+	arguments := make([]any, len(hook.Arguments))
+	for i, argument := range hook.Arguments {
+		switch argument {
+		case "${uri}":
+			arguments[i] = string(uri)
+		case "${firstLine}":
+			arguments[i] = float64(0)
+		case "${lastLine}":
+			arguments[i] = float64(lastLine)
+		default:
+			arguments[i] = argument
+		}
+	}
+
+	return arguments
+}
+
+// runHooks runs all hooks registered for the event as background tasks. The
+// results are sent to the client as cody/hookResult notifications.
+func (s *server) runHooks(conn *jsonrpc2.Conn, event string, uri lsp.DocumentURI) {
+	s.mu.Lock()
+	initialized, provider := s.initialized, s.Provider
+	hooks := s.Hooks
+	contents := s.Documents.Text(uri)
+	s.mu.Unlock()
+	if !initialized {
+		return
+	}
+
+	for _, hook := range hooks {
+		if !matchesHook(hook, event, uri) {
+			continue
+		}
+
+		hook := hook
+		s.tasks.Go("hook "+event+" "+hook.Command, func(ctx context.Context) {
+			params := types.HookResultParams{
+				Event:   event,
+				Command: hook.Command,
+				URI:     uri,
+			}
+			result, err := provider.ExecuteCommand(ctx, types.ExecuteCommandParams{
+				Command:   hook.Command,
+				Arguments: hookArguments(hook, uri, contents),
+			}, conn)
+			if err != nil {
+				params.Error = err.Error()
+			}
+			params.Result = result
+			conn.Notify(ctx, "cody/hookResult", params)
+		})
+	}
+}
+
+// textDocumentDidSave marks the document as saved, re-indexes it and runs
+// the didSave hooks.
+func (s *server) textDocumentDidSave(ctx context.Context, conn *jsonrpc2.Conn, _ *jsonrpc2.Request, params lsp.DidSaveTextDocumentParams) (any, error) {
+	// The saved text includes the changes queued up while churning
+	s.flushPendingChanges()
+	s.Documents.Save(params.TextDocument.URI)
+	if provider := s.provider(); provider != nil {
+		provider.DocumentSaved(params.TextDocument.URI)
+	}
+	s.runHooks(conn, "didSave", params.TextDocument.URI)
+
+	return nil, nil
+}
+
+func (s *server) workspaceDidCreateFiles(ctx context.Context, conn *jsonrpc2.Conn, _ *jsonrpc2.Request, params types.CreateFilesParams) (any, error) {
+	for _, file := range params.Files {
+		s.runHooks(conn, "didCreateFiles", file.URI)
+	}
+
+	return nil, nil
+}
+
+// codyEvent handles custom events sent by the client, such as "preCommit".
+func (s *server) codyEvent(ctx context.Context, conn *jsonrpc2.Conn, _ *jsonrpc2.Request, params types.WorkspaceEventParams) (any, error) {
+	s.runHooks(conn, params.Event, params.URI)
+
+	return nil, nil
+}
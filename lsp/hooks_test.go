@@ -0,0 +1,40 @@
+package lsp
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/go-lsp"
+)
+
+func TestMatchesHook(t *testing.T) {
+	uri := lsp.DocumentURI("file:///home/user/project/main.go")
+	tests := []struct {
+		hook  types.Hook
+		event string
+		want  bool
+	}{
+		{types.Hook{Event: "didSave", Command: "suggest"}, "didSave", true},
+		{types.Hook{Event: "didSave", Command: "suggest"}, "didOpen", false},
+		{types.Hook{Event: "didSave", Command: "suggest", Pattern: "*.go"}, "didSave", true},
+		{types.Hook{Event: "didSave", Command: "suggest", Pattern: "*.py"}, "didSave", false},
+		{types.Hook{Event: "didSave", Command: "suggest", Pattern: "/home/user/*/main.go"}, "didSave", true},
+		{types.Hook{Event: "didSave"}, "didSave", false},
+	}
+
+	for _, test := range tests {
+		if got := matchesHook(test.hook, test.event, uri); got != test.want {
+			t.Errorf("matchesHook(%+v, %q) == %v, want %v", test.hook, test.event, got, test.want)
+		}
+	}
+}
+
+func TestHookArguments(t *testing.T) {
+	hook := types.Hook{Arguments: []any{"${uri}", "${firstLine}", "${lastLine}", true}}
+	got := hookArguments(hook, "file:///main.go", "package main\n\nfunc main() {}")
+	want := []any{"file:///main.go", float64(0), float64(2), true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("hookArguments() == %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,150 @@
+package lsp
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pjlast/llmsp/internal/metrics"
+	"github.com/pjlast/llmsp/internal/position"
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/go-lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// hoverKey identifies a hover by the document version and the range of the
+// symbol that is hovered over, so hovering anywhere on the same symbol hits
+// the cache.
+type hoverKey struct {
+	uri     lsp.DocumentURI
+	version int
+	rng     lsp.Range
+}
+
+// hoverCache caches hover explanations. Only the explanations for the latest
+// version of each document are kept.
+type hoverCache struct {
+	mu      sync.Mutex
+	entries map[hoverKey]*types.Hover
+}
+
+func newHoverCache() *hoverCache {
+	return &hoverCache{entries: make(map[hoverKey]*types.Hover)}
+}
+
+// Get returns the cached hover for key, if any.
+func (c *hoverCache) Get(key hoverKey) (*types.Hover, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	hover, ok := c.entries[key]
+	return hover, ok
+}
+
+// Put caches the hover for key, dropping the hovers of older versions of the
+// document.
+func (c *hoverCache) Put(key hoverKey, hover *types.Hover) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k := range c.entries {
+		if k.uri == key.uri && k.version != key.version {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = hover
+}
+
+// Clear drops all cached hovers.
+func (c *hoverCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[hoverKey]*types.Hover)
+}
+
+// symbolAt returns the identifier at pos along with its range. If there is no
+// identifier at pos, the returned symbol is empty and the range covers the
+// whole line.
+func symbolAt(text string, pos lsp.Position) (string, string, lsp.Range) {
+	lineStart, _ := offsetAt(text, lsp.Position{Line: pos.Line})
+	line := text[lineStart:]
+	if i := strings.IndexByte(line, '\n'); i != -1 {
+		line = line[:i]
+	}
+	lineRange := lsp.Range{
+		Start: lsp.Position{Line: pos.Line},
+		End:   lsp.Position{Line: pos.Line, Character: position.Len(line)},
+	}
+	offset, _ := offsetAt(text, pos)
+	offset -= lineStart
+	if offset < 0 || offset > len(line) {
+		return "", line, lineRange
+	}
+
+	start := offset
+	for start > 0 {
+		r, size := utf8.DecodeLastRuneInString(line[:start])
+		if !isIdentifierRune(r) {
+			break
+		}
+		start -= size
+	}
+	end := offset
+	for end < len(line) {
+		r, size := utf8.DecodeRuneInString(line[end:])
+		if !isIdentifierRune(r) {
+			break
+		}
+		end += size
+	}
+	if start == end {
+		return "", line, lineRange
+	}
+
+	return line[start:end], line, lsp.Range{
+		Start: lsp.Position{Line: pos.Line, Character: position.Len(line[:start])},
+		End:   lsp.Position{Line: pos.Line, Character: position.Len(line[:end])},
+	}
+}
+
+func isIdentifierRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func (s *server) textDocumentHover(ctx context.Context, conn *jsonrpc2.Conn, _ *jsonrpc2.Request, params lsp.TextDocumentPositionParams) (any, error) {
+	doc, ok := s.Documents.Get(params.TextDocument.URI)
+	if !ok {
+		return nil, nil
+	}
+	text, version := doc.Text, doc.Version
+
+	symbol, line, rng := symbolAt(text, params.Position)
+	if strings.TrimSpace(line) == "" {
+		return nil, nil
+	}
+	key := hoverKey{uri: params.TextDocument.URI, version: version, rng: rng}
+	hover, ok := s.hovers.Get(key)
+	metrics.CacheLookups(s.Metrics).Inc("hover", metrics.HitOrMiss(ok))
+	if ok {
+		return hover, nil
+	}
+
+	end := s.status.Begin(conn, types.StatusFetchingHover)
+	explanation, err := s.provider().Hover(ctx, params.TextDocument.URI, symbol, line)
+	end(err)
+	if err != nil {
+		return nil, err
+	}
+	hover = &types.Hover{
+		Contents: types.MarkupContent{
+			Kind:  "markdown",
+			Value: explanation,
+		},
+		Range: &rng,
+	}
+	s.hovers.Put(key, hover)
+
+	return hover, nil
+}
@@ -0,0 +1,44 @@
+package lsp
+
+import (
+	"testing"
+
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/go-lsp"
+)
+
+func TestSymbolAt(t *testing.T) {
+	text := "package main\n\nfunc main() {\n\tfmt.Println(\"héllo\", wörld)\n}"
+	tests := []struct {
+		pos        lsp.Position
+		wantSymbol string
+		wantRange  lsp.Range
+	}{
+		{lsp.Position{Line: 2, Character: 6}, "main", lsp.Range{Start: lsp.Position{Line: 2, Character: 5}, End: lsp.Position{Line: 2, Character: 9}}},
+		{lsp.Position{Line: 2, Character: 9}, "main", lsp.Range{Start: lsp.Position{Line: 2, Character: 5}, End: lsp.Position{Line: 2, Character: 9}}},
+		{lsp.Position{Line: 3, Character: 5}, "Println", lsp.Range{Start: lsp.Position{Line: 3, Character: 5}, End: lsp.Position{Line: 3, Character: 12}}},
+		{lsp.Position{Line: 3, Character: 23}, "wörld", lsp.Range{Start: lsp.Position{Line: 3, Character: 22}, End: lsp.Position{Line: 3, Character: 27}}},
+		{lsp.Position{Line: 2, Character: 12}, "", lsp.Range{Start: lsp.Position{Line: 2}, End: lsp.Position{Line: 2, Character: 13}}},
+	}
+
+	for _, test := range tests {
+		symbol, _, rng := symbolAt(text, test.pos)
+		if symbol != test.wantSymbol || rng != test.wantRange {
+			t.Errorf("symbolAt(%v) == %q, %v, want %q, %v", test.pos, symbol, rng, test.wantSymbol, test.wantRange)
+		}
+	}
+}
+
+func TestHoverCache(t *testing.T) {
+	cache := newHoverCache()
+	key := hoverKey{uri: "file:///main.go", version: 1}
+	cache.Put(key, &types.Hover{})
+	if _, ok := cache.Get(key); !ok {
+		t.Fatal("expected a cached hover")
+	}
+
+	cache.Put(hoverKey{uri: "file:///main.go", version: 2}, &types.Hover{})
+	if _, ok := cache.Get(key); ok {
+		t.Error("expected hovers for older versions to be dropped")
+	}
+}
@@ -0,0 +1,84 @@
+package lsp
+
+import (
+	"sync"
+	"time"
+)
+
+// idleTimer runs a function once no requests have been received for a while.
+type idleTimer struct {
+	mu      sync.Mutex
+	timeout time.Duration
+	timer   *time.Timer
+	onIdle  func()
+}
+
+// Start starts the timer, calling onIdle every time the server has been idle
+// for the timeout. A zero timeout disables the timer.
+func (t *idleTimer) Start(timeout time.Duration, onIdle func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+	t.timeout = timeout
+	t.onIdle = onIdle
+	if timeout > 0 {
+		t.timer = time.AfterFunc(timeout, onIdle)
+	}
+}
+
+// Touch records activity, postponing the idle callback.
+func (t *idleTimer) Touch() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.timer == nil {
+		return
+	}
+	// If the timer already fired the callback has run, and the server is
+	// active again so it can become idle again.
+	t.timer.Reset(t.timeout)
+}
+
+// Stop stops the timer.
+func (t *idleTimer) Stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+}
+
+// SetIdleTimeout makes the server release its resources once no requests
+// have been received for the timeout: caches are dropped and idle HTTP
+// connections are closed. They are rebuilt on demand once requests arrive
+// again. If exit is not nil, it is called after the resources have been
+// released, e.g. to exit the process of editors that respawn the server.
+func (s *server) SetIdleTimeout(timeout time.Duration, exit func()) {
+	s.idle.Start(timeout, func() {
+		// Requests that take longer than the timeout don't make the server idle
+		if s.router.Busy() {
+			s.idle.Touch()
+			return
+		}
+		s.quiesce()
+		if exit != nil {
+			exit()
+		}
+	})
+}
+
+// quiesce drops the caches of the server and its provider.
+func (s *server) quiesce() {
+	s.Logger.Info("idle, releasing resources")
+	s.hovers.Clear()
+
+	if provider := s.provider(); provider != nil {
+		provider.Quiesce()
+	}
+}
@@ -0,0 +1,32 @@
+package lsp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIdleTimeout(t *testing.T) {
+	s := NewServer("", "")
+	s.hovers.Put(hoverKey{uri: "file:///main.go"}, nil)
+
+	exited := make(chan time.Time, 1)
+	start := time.Now()
+	s.SetIdleTimeout(50*time.Millisecond, func() { exited <- time.Now() })
+	defer s.idle.Stop()
+
+	// Activity postpones the timeout
+	time.Sleep(30 * time.Millisecond)
+	s.idle.Touch()
+
+	select {
+	case at := <-exited:
+		if at.Sub(start) < 80*time.Millisecond {
+			t.Errorf("server went idle after %s despite activity", at.Sub(start))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not go idle")
+	}
+	if _, ok := s.hovers.Get(hoverKey{uri: "file:///main.go"}); ok {
+		t.Error("hover cache was not cleared")
+	}
+}
@@ -0,0 +1,131 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pjlast/llmsp/internal/logging"
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/go-lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// DefaultLogFile returns the path of the log file used when debugging is
+// enabled without a log file being configured.
+func DefaultLogFile() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "llmsp", "llmsp.log")
+}
+
+// SetLogFile makes the server log to a rotating log file at path. An empty
+// path stops logging to a file.
+func (s *server) SetLogFile(path string) error {
+	var file *logging.RotatingFile
+	if path != "" {
+		var err error
+		file, err = logging.OpenRotatingFile(path, logging.DefaultMaxSize, logging.DefaultMaxBackups)
+		if err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	previous := s.logFile
+	s.logFile = file
+	s.logPath = path
+	s.mu.Unlock()
+	if file != nil {
+		s.Logger.SetOutput(file)
+	} else {
+		s.Logger.SetOutput(nil)
+	}
+	// Only files opened by the server are closed, the output of sessions is
+	// shared
+	if previous != nil {
+		previous.Close()
+	}
+	return nil
+}
+
+// configureLogging applies the log settings sent by the client.
+func (s *server) configureLogging(settings *types.LogSettings) {
+	if settings == nil {
+		return
+	}
+
+	if settings.Level != "" {
+		level, err := logging.ParseLevel(settings.Level)
+		if err != nil {
+			s.Logger.Warn("ignoring log level", "err", err)
+		} else {
+			s.Logger.SetLevel(level)
+		}
+	}
+
+	s.mu.Lock()
+	changed := settings.File != "" && settings.File != s.logPath
+	s.mu.Unlock()
+	if changed {
+		if err := s.SetLogFile(settings.File); err != nil {
+			s.Logger.Error("opening log file", "path", settings.File, "err", err)
+		}
+	}
+
+	if settings.WindowLogMessage {
+		s.Logger.SetMirror(s.logMessage)
+	} else {
+		s.Logger.SetMirror(nil)
+	}
+}
+
+// logMessage sends a log entry to the client as a window/logMessage
+// notification.
+func (s *server) logMessage(level logging.Level, entry string) {
+	conn := s.conn.Load()
+	if conn == nil {
+		return
+	}
+
+	var messageType lsp.MessageType = lsp.Log
+	switch level {
+	case logging.LevelInfo:
+		messageType = lsp.Info
+	case logging.LevelWarn:
+		messageType = lsp.MTWarning
+	case logging.LevelError:
+		messageType = lsp.MTError
+	}
+	_ = conn.Notify(context.Background(), "window/logMessage", lsp.LogMessageParams{Type: messageType, Message: entry})
+}
+
+// contextUpdated reports the context of a prompt to the client in a
+// cody/contextUpdated notification.
+func (s *server) contextUpdated(report types.ContextReport) {
+	if conn := s.conn.Load(); conn != nil {
+		_ = conn.Notify(context.Background(), "cody/contextUpdated", report)
+	}
+}
+
+// logRequests is middleware that logs every handled request at debug level.
+func (s *server) logRequests(next jsonrpc2.Handler) jsonrpc2.Handler {
+	return HandlerFunc(func(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+		start := time.Now()
+		next.Handle(ctx, conn, req)
+		if req.Notif {
+			s.Logger.Debug("notification handled", "method", req.Method, "duration", time.Since(start))
+		} else {
+			s.Logger.Debug("request handled", "method", req.Method, "id", req.ID, "duration", time.Since(start))
+		}
+	})
+}
+
+// logPanic logs a panic recovered by the router or a background task.
+func (s *server) logPanic(format string, args ...any) {
+	s.Logger.Error(fmt.Sprintf(format, args...))
+}
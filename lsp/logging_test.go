@@ -0,0 +1,39 @@
+package lsp
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pjlast/llmsp/internal/logging"
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func TestConfigureLogging(t *testing.T) {
+	s := NewServer("", "")
+	path := filepath.Join(t.TempDir(), "llmsp.log")
+	s.configureLogging(&types.LogSettings{Level: "debug", File: path})
+	if got := s.Logger.Level(); got != logging.LevelDebug {
+		t.Errorf("level == %v, want %v", got, logging.LevelDebug)
+	}
+
+	handler := s.logRequests(HandlerFunc(func(context.Context, *jsonrpc2.Conn, *jsonrpc2.Request) {}))
+	handler.Handle(context.Background(), nil, &jsonrpc2.Request{Method: "textDocument/hover", ID: jsonrpc2.ID{Num: 1}})
+	s.configureLogging(&types.LogSettings{Level: "loud"})
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"DEBUG request handled method=textDocument/hover id=1", `WARN ignoring log level err="unknown log level \"loud\""`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("log file contains %q, want it to contain %q", data, want)
+		}
+	}
+	if got := s.Logger.Level(); got != logging.LevelDebug {
+		t.Errorf("level == %v after an invalid level, want %v", got, logging.LevelDebug)
+	}
+}
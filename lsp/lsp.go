@@ -5,9 +5,19 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/pjlast/llmsp/internal/diagnostics"
+	"github.com/pjlast/llmsp/internal/documents"
+	"github.com/pjlast/llmsp/internal/i18n"
+	"github.com/pjlast/llmsp/internal/logging"
+	"github.com/pjlast/llmsp/internal/metrics"
+	"github.com/pjlast/llmsp/internal/secrets"
+	"github.com/pjlast/llmsp/internal/tasks"
 	"github.com/pjlast/llmsp/providers"
 	"github.com/pjlast/llmsp/types"
 	"github.com/sourcegraph/go-lsp"
@@ -23,11 +33,18 @@ func LSPHandlerFunc[T any](fn LSPHandler[T]) HandlerFunc {
 	return jsonrpc2.HandlerWithError(
 		func(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) (any, error) {
 			var params T
-			if err := json.Unmarshal(*req.Params, &params); err != nil {
-				return nil, err
+			if req.Params != nil {
+				if err := json.Unmarshal(*req.Params, &params); err != nil {
+					return nil, err
+				}
+			}
+
+			res, err := fn(ctx, conn, req, params)
+			if errors.Is(ctx.Err(), context.Canceled) {
+				return nil, &jsonrpc2.Error{Code: CodeRequestCancelled, Message: "request cancelled"}
 			}
 
-			return fn(ctx, conn, req, params)
+			return res, requestError(err)
 		},
 	).Handle
 }
@@ -37,33 +54,82 @@ type server struct {
 	initialized bool
 	// Provider is the language provider used by the server
 	Provider LLMProvider
-	// FileMap is a map of file URIs to file contents
-	FileMap types.MemoryFileMap
+	// Documents are the documents opened by the client
+	Documents *documents.Store
 	// URL is the URL of the Sourcegraph instance
 	URL string
 	// AccessToken is the access token used to authenticate to Sourcegraph
 	AccessToken string
+	// RootURI is the root of the workspace opened by the client
+	RootURI lsp.DocumentURI
+	// WorkspaceFolders are the workspace folders opened by the client
+	WorkspaceFolders []lsp.DocumentURI
 	// AutoComplete enables or disables autocompletion
 	AutoComplete string
-	// Debug enables debug logging
-	Debug bool
-	// Trace configures tracing
-	Trace struct {
-		// Enabled enables tracing
-		Enabled bool
-		// Verbose enables verbose tracing (all message parameters will be logged)
-		Verbose bool
-	}
+	// Hooks are the commands to run on workspace events
+	Hooks []types.Hook
+	// Logger logs the server's activity
+	Logger *logging.Logger
+	// Metrics counts the requests of the server and of its provider,
+	// metrics.Default unless replaced before the server is initialized
+	Metrics *metrics.Registry
+	// Exit is called with the exit status when the client sends the exit
+	// notification. If it is nil, the connection is closed instead.
+	Exit func(code int)
+	// trace is the trace level set by the client, see traceOff,
+	// traceMessages and traceVerbose
+	trace atomic.Int32
+	// tracer sends the traces of messages to the client
+	tracer *tracer
+	// shuttingDown is set once the client has sent the shutdown request
+	shuttingDown atomic.Bool
 	// mu is a mutex used for locking
 	mu sync.Mutex
 	// router contains the registered server routes
 	router *Router
+	// hovers caches hover explanations
+	hovers *hoverCache
+	// status reports the state of the server to the client
+	status *serverStatus
+	// churn tracks documents that are changing rapidly
+	churn *churnTracker
+	// resolveEdits indicates whether the client can resolve code action edits
+	resolveEdits bool
+	// resourceOperations are the file operations the client supports in
+	// workspace edits, nil if it didn't say
+	resourceOperations []string
+	// apiErrorsShown contains when each kind of API error was last shown
+	apiErrorsShown map[error]time.Time
+	// completions coalesces completion requests
+	completions *debouncer
+	// triggers decides which completion requests are answered
+	triggers *completionTriggers
+	// idle releases resources once the server hasn't been used for a while
+	idle idleTimer
+	// messages translates user-facing messages into the client's locale
+	messages i18n.Localizer
+	// tasks are the goroutines the server and its provider run in the
+	// background
+	tasks *tasks.Group
+	// diagnostics are the diagnostics published by the provider, they are
+	// cleared when their document changes or is closed
+	diagnostics *diagnostics.Manager
+	// conn is the connection of the most recent request, log entries are
+	// mirrored to it
+	conn atomic.Pointer[jsonrpc2.Conn]
+	// logFile is the log file opened by SetLogFile, if any, and logPath its
+	// path
+	logFile *logging.RotatingFile
+	logPath string
+	// sessionToken identifies the session a reconnecting client can resume,
+	// it is empty if the server isn't managed by a SessionManager
+	sessionToken string
 }
 
 // registerHandler is a convenience function to register handlers on a server
 // and reduce the boilerplate of calling LSPHandlerFunc on every handler.
 func registerHandler[T any](s *server, method string, handler LSPHandler[T]) {
-	s.router.Register(method, LSPHandlerFunc(handler))
+	s.router.Register(method, LSPHandlerFunc(recordRequests(s, method, surfaceAPIErrors(s, handler))))
 }
 
 // NewServer creates a new server instance.
@@ -72,128 +138,343 @@ func registerHandler[T any](s *server, method string, handler LSPHandler[T]) {
 // accessToken is the OAuth access token to use for requests.
 func NewServer(url, accessToken string) *server {
 	s := &server{
-		FileMap:     make(types.MemoryFileMap),
+		Documents:   documents.NewStore(),
 		URL:         url,
 		AccessToken: accessToken,
 	}
+	s.Logger = logging.New(nil, logging.LevelInfo)
+	s.Logger.SetRedactor(secrets.Redact)
+	s.Metrics = metrics.Default
+	secrets.Register(accessToken)
 	s.router = NewRouter()
+	s.router.Use(Recover(s.logPanic), s.logRequests, s.rejectAfterShutdown)
+	s.churn = newChurnTracker()
+	s.completions = newDebouncer(defaultCompletionDelay)
+	s.triggers = newCompletionTriggers()
+	s.hovers = newHoverCache()
+	s.status = newServerStatus()
+	s.apiErrorsShown = make(map[error]time.Time)
+	s.tasks = tasks.NewGroup()
+	s.tasks.Logf = s.logPanic
+	s.diagnostics = diagnostics.NewManager()
+	s.tracer = newTracer()
 	registerHandler(s, "initialize", s.initialize)
 	registerHandler(s, "textDocument/didChange", s.textDocumentDidChange)
 	registerHandler(s, "textDocument/didOpen", s.textDocumentDidOpen)
+	registerHandler(s, "textDocument/didClose", s.textDocumentDidClose)
+	registerHandler(s, "textDocument/didSave", s.textDocumentDidSave)
 	registerHandler(s, "textDocument/codeAction", requiresInitialized(s, s.textDocumentCodeAction))
+	registerHandler(s, "codeAction/resolve", requiresInitialized(s, s.codeActionResolve))
+	registerHandler(s, "textDocument/codeLens", requiresInitialized(s, s.textDocumentCodeLens))
+	registerHandler(s, "codeLens/resolve", requiresInitialized(s, s.codeLensResolve))
+	registerHandler(s, "textDocument/hover", requiresInitialized(s, s.textDocumentHover))
 	registerHandler(s, "textDocument/completion", requiresInitialized(s, s.textDocumentCompletion))
+	registerHandler(s, "completionItem/resolve", requiresInitialized(s, s.completionItemResolve))
 	registerHandler(s, "workspace/didChangeConfiguration", s.workspaceDidChangeConfiguration)
 	registerHandler(s, "workspace/executeCommand", requiresInitialized(s, s.workspaceExecuteCommand))
+	registerHandler(s, "workspace/didCreateFiles", s.workspaceDidCreateFiles)
+	registerHandler(s, "workspace/didChangeWorkspaceFolders", s.workspaceDidChangeWorkspaceFolders)
+	registerHandler(s, "cody/event", s.codyEvent)
+	registerHandler(s, "cody/history/list", requiresInitialized(s, s.codyHistoryList))
+	registerHandler(s, "cody/history/document", requiresInitialized(s, s.codyHistoryDocument))
+	registerHandler(s, "llmsp/tasks/background", s.tasksBackground)
+	registerHandler(s, "llmsp/metrics", s.llmspMetrics)
+	registerHandler(s, "$/setTrace", s.setTrace)
+	registerHandler(s, "shutdown", s.shutdown)
+	registerHandler(s, "exit", s.exit)
 
 	return s
 }
 
 // Handle implements the jsonrpc2.Handler interface for server, passing the request to
-// the router.
+// the router. Document synchronization notifications are handled in the order
+// they are received, all other requests are handled asynchronously.
 func (s *server) Handle(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
-	s.router.Handle(ctx, conn, req)
+	s.idle.Touch()
+	s.conn.Store(conn)
+	switch req.Method {
+	case "textDocument/didOpen", "textDocument/didChange", "textDocument/didClose", "textDocument/didSave":
+		s.router.Handle(ctx, conn, req)
+	default:
+		// Make sure requests see the latest version of all documents
+		s.flushPendingChanges()
+		go s.router.Handle(ctx, conn, req)
+	}
+}
+
+// flushPendingChanges applies the changes that were queued up while documents
+// were churning, along with their versions.
+func (s *server) flushPendingChanges() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for uri, pending := range s.churn.TakePending() {
+		changes := pending.changes
+		_ = s.Documents.Change(uri, pending.version, func(text string) (string, error) {
+			return applyContentChanges(text, changes)
+		})
+	}
+}
+
+// provider returns the provider of the server, or nil if the server hasn't
+// been initialized yet.
+func (s *server) provider() LLMProvider {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.initialized {
+		return nil
+	}
+	return s.Provider
 }
 
 // requiresInitialized is middleware that checks whether or not the server has been
 // initialized. If not, it returns an error.
 func requiresInitialized[T any](s *server, handler LSPHandler[T]) LSPHandler[T] {
 	return func(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, params T) (any, error) {
-		if !s.initialized {
-			return nil, errors.New("server has not yet been initialized")
+		if s.provider() == nil {
+			return nil, errors.New(s.messages.T(i18n.NotInitialized))
 		}
 
 		return handler(ctx, conn, req, params)
 	}
 }
 
-func (s *server) initialize(_ context.Context, _ *jsonrpc2.Conn, _ *jsonrpc2.Request, params lsp.InitializeParams) (any, error) {
-	if !s.initialized && s.URL != "" && s.AccessToken != "" {
-		provider := &providers.SourcegraphLLM{
-			FileMap: s.FileMap,
+func (s *server) initialize(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, params lsp.InitializeParams) (any, error) {
+	s.RootURI = params.Root()
+	s.setTraceValue(string(params.Trace))
+	var folders types.InitializeWorkspaceFolders
+	if err := json.Unmarshal(*req.Params, &folders); err == nil {
+		s.WorkspaceFolders = nil
+		for _, folder := range folders.WorkspaceFolders {
+			s.WorkspaceFolders = append(s.WorkspaceFolders, folder.URI)
 		}
-		provider.URL = s.URL
-		provider.AccessToken = s.AccessToken
-		s.Provider = provider
-		if params.Trace == "messages" {
-			s.Trace.Enabled = true
-		} else if params.Trace == "verbose" {
-			s.Trace.Enabled = true
-			s.Trace.Verbose = true
-		} else {
-			s.Trace.Enabled = false
+	}
+	var locale types.InitializeLocale
+	if err := json.Unmarshal(*req.Params, &locale); err == nil {
+		s.messages = i18n.New(locale.Locale)
+	}
+	var clientCapabilities types.CodeActionClientCapabilities
+	if err := json.Unmarshal(*req.Params, &clientCapabilities); err == nil {
+		if resolveSupport := clientCapabilities.Capabilities.TextDocument.CodeAction.ResolveSupport; resolveSupport != nil {
+			for _, property := range resolveSupport.Properties {
+				if property == "edit" {
+					s.resolveEdits = true
+				}
+			}
+		}
+	}
+	var editCapabilities types.WorkspaceEditClientCapabilities
+	if err := json.Unmarshal(*req.Params, &editCapabilities); err == nil {
+		if workspaceEdit := editCapabilities.Capabilities.Workspace.WorkspaceEdit; workspaceEdit != nil && workspaceEdit.ResourceOperations != nil {
+			s.resourceOperations = workspaceEdit.ResourceOperations
+		}
+	}
+	// The config files are read at startup, so that servers started with a
+	// URL and a token are configured before the editor sends its settings
+	settings, err := s.settings(nil)
+	if err != nil {
+		s.Logger.Warn("reading the config files", "err", err)
+	}
+	if s.provider() == nil && s.URL != "" && s.AccessToken != "" && err == nil {
+		if err := s.configure(ctx, conn, settings); err != nil {
+			s.Logger.Warn("initializing with the command line flags", "err", err)
 		}
-		s.initialized = true
 	}
 
 	opts := lsp.TextDocumentSyncOptionsOrKind{
 		Options: &lsp.TextDocumentSyncOptions{
 			OpenClose: true,
-			WillSave:  true,
-			Change:    lsp.TDSKFull,
+			Change:    lsp.TDSKIncremental,
+			Save:      &lsp.SaveOptions{},
 		},
 	}
+	// The trigger characters can only be announced now, those of the
+	// editor's settings aren't known yet
+	if settings.Sourcegraph != nil {
+		s.triggers.Configure(settings.Sourcegraph.CompletionTrigger, settings.Sourcegraph.CompletionTriggerCharacters, settings.Sourcegraph.CompletionSkip)
+	}
 	completionOptions := types.CompletionOptions{
-		WorkDoneProgress: true,
+		ResolveProvider:   true,
+		TriggerCharacters: s.triggers.Characters(),
+		WorkDoneProgress:  true,
 	}
 	ecopts := lsp.ExecuteCommandOptions{
-		Commands: []string{"todos", "suggest", "answer", "docstring", "cody", "cody.explain", "cody.explainErrors", "cody.remember", "cody.forget", "cody.chat/history", "cody.chat/message"},
+		Commands: []string{"todos", "suggest", "answer", "docstring", "cody", "cody.edit", "cody.edit/accept", "cody.edit/reject", "cody.test", "cody.completeLine", "cody.completeFunction", "cody.plan", "cody.explain", "cody.explainSelection", "cody.translate", "cody.suggestions/clear", "cody.todos/workspace", "cody.context/last", "cody.explainErrors", "cody.explainOutput", "cody.fix", "cody.remember", "cody.forget", "cody.chat/history", "cody.memory/list", "cody.memory/delete", "cody.memory/pin", "cody.chat/message", "cody.chat/new", "cody.chat/list", "cody.chat/switch", "cody.chat/delete", "cody.chat/export", "cody.chat/abort", "cody.chat/retry", "cody.repo/ask", "cody.shell", "cody.reviewDiff", "cody.feedback", "cody.completion/accepted"},
 	}
 
 	return types.InitializeResult{
+		SessionToken: s.sessionToken,
 		Capabilities: types.ServerCapabilities{
-			TextDocumentSync:       &opts,
-			CodeActionProvider:     true,
+			TextDocumentSync: &opts,
+			HoverProvider:    true,
+			CodeActionProvider: &types.CodeActionOptions{
+				CodeActionKinds: providers.CodeActionKinds,
+				ResolveProvider: true,
+			},
+			CodeLensProvider: &lsp.CodeLensOptions{
+				ResolveProvider: true,
+			},
 			CompletionProvider:     &completionOptions,
 			ExecuteCommandProvider: &ecopts,
+			Workspace: &types.WorkspaceServerCapabilities{
+				WorkspaceFolders: &types.WorkspaceFoldersServerCapabilities{
+					Supported:           true,
+					ChangeNotifications: true,
+				},
+				FileOperations: &types.FileOperationsServerCapabilities{
+					DidCreate: &types.FileOperationRegistrationOptions{
+						Filters: []types.FileOperationFilter{{Pattern: types.FileOperationPattern{Glob: "**/*"}}},
+					},
+				},
+			},
 		},
 	}, nil
 }
 
-func (s *server) textDocumentDidChange(_ context.Context, _ *jsonrpc2.Conn, _ *jsonrpc2.Request, params lsp.DidChangeTextDocumentParams) (any, error) {
+func (s *server) textDocumentDidChange(ctx context.Context, conn *jsonrpc2.Conn, _ *jsonrpc2.Request, params lsp.DidChangeTextDocumentParams) (any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Diagnostics refer to lines that may have moved
+	s.diagnostics.Clear(ctx, conn, params.TextDocument.URI)
+
+	// While the document is churning, changes are queued up and completions
+	// are dropped until the document has been stable for the quiet period.
+	// The document keeps the version of its text until the changes are
+	// applied, so that edits computed in the meantime are never stamped with
+	// a version whose text they weren't mapped to.
+	if s.churn.Record(params.TextDocument.URI, params.TextDocument.Version, params.ContentChanges, s.flushPendingChanges) {
+		s.completions.Cancel()
+		return nil, nil
+	}
+
+	return nil, s.Documents.Change(params.TextDocument.URI, params.TextDocument.Version, func(text string) (string, error) {
+		return applyContentChanges(text, params.ContentChanges)
+	})
+}
+
+func (s *server) textDocumentDidOpen(ctx context.Context, conn *jsonrpc2.Conn, _ *jsonrpc2.Request, params lsp.DidOpenTextDocumentParams) (any, error) {
 	s.mu.Lock()
-	s.FileMap[params.TextDocument.URI] = params.ContentChanges[0].Text
+	s.churn.Forget(params.TextDocument.URI)
+	s.Documents.Open(params.TextDocument.URI, params.TextDocument.Text, params.TextDocument.Version)
 	s.mu.Unlock()
+	s.runHooks(conn, "didOpen", params.TextDocument.URI)
 
 	return nil, nil
 }
 
-func (s *server) textDocumentDidOpen(_ context.Context, _ *jsonrpc2.Conn, _ *jsonrpc2.Request, params lsp.DidOpenTextDocumentParams) (any, error) {
+// textDocumentDidClose evicts a closed document, so that it is no longer
+// used as context, and clears its diagnostics.
+func (s *server) textDocumentDidClose(ctx context.Context, conn *jsonrpc2.Conn, _ *jsonrpc2.Request, params lsp.DidCloseTextDocumentParams) (any, error) {
 	s.mu.Lock()
-	s.FileMap[params.TextDocument.URI] = params.TextDocument.Text
-	s.mu.Unlock()
+	defer s.mu.Unlock()
+	s.churn.Forget(params.TextDocument.URI)
+	s.Documents.Close(params.TextDocument.URI)
+	s.diagnostics.Clear(ctx, conn, params.TextDocument.URI)
 
 	return nil, nil
 }
 
 func (s *server) textDocumentCodeAction(_ context.Context, _ *jsonrpc2.Conn, _ *jsonrpc2.Request, params types.CodeActionParams) (any, error) {
-	commands := s.Provider.GetCodeActions(params.TextDocument.URI, params.Range)
+	actions := s.provider().GetCodeActions(params.TextDocument.URI, params.Range)
 	for _, diagnostic := range params.Context.Diagnostics {
-		commands = append(commands, lsp.Command{
-			Title:     fmt.Sprintf("Explain error: %s", diagnostic.Message),
-			Command:   "cody.explainErrors",
-			Arguments: []any{diagnostic.Message},
-		})
+		explain := types.CodeAction{
+			Title:       fmt.Sprintf("Explain error: %s", diagnostic.Message),
+			Kind:        "quickfix",
+			Diagnostics: []types.Diagnostic{diagnostic},
+			Command: &lsp.Command{
+				Title:     fmt.Sprintf("Explain error: %s", diagnostic.Message),
+				Command:   "cody.explainErrors",
+				Arguments: []any{diagnostic.Message},
+			},
+		}
+		arguments := []any{params.TextDocument.URI, diagnostic.Range.Start.Line, diagnostic.Range.End.Line, diagnostic.Message}
+		fix := types.CodeAction{
+			Title:       fmt.Sprintf("Cody: Fix this: %s", diagnostic.Message),
+			Kind:        "quickfix",
+			Diagnostics: []types.Diagnostic{diagnostic},
+			IsPreferred: true,
+			Command: &lsp.Command{
+				Title:     fmt.Sprintf("Cody: Fix this: %s", diagnostic.Message),
+				Command:   "cody.fix",
+				Arguments: arguments,
+			},
+			Data: &types.CodeActionData{
+				Command:   "cody.fix",
+				Arguments: arguments,
+			},
+		}
+		actions = append(actions, explain, fix)
 	}
-	if len(params.Context.Only) > 0 {
-		filteredCommands := []lsp.Command{}
-		for _, command := range commands {
-			for _, filteredCommand := range params.Context.Only {
-				if filteredCommand == command.Command {
-					filteredCommands = append(filteredCommands, command)
-					break
-				}
-			}
+
+	filtered := []types.CodeAction{}
+	for _, action := range actions {
+		if len(params.Context.Only) > 0 && !matchesOnly(action, params.Context.Only) {
+			continue
+		}
+		// Clients that can resolve edits get the edit lazily instead of the
+		// command, the others run the command and receive the edit through
+		// workspace/applyEdit.
+		if action.Data != nil && s.resolveEdits {
+			action.Command = nil
+		} else {
+			action.Data = nil
 		}
+		filtered = append(filtered, action)
+	}
+
+	return filtered, nil
+}
 
-		return filteredCommands, nil
+// matchesOnly reports whether the code action matches one of the requested
+// kinds. Command names are accepted as well, for backwards compatibility.
+func matchesOnly(action types.CodeAction, only []string) bool {
+	for _, kind := range only {
+		if action.Command != nil && action.Command.Command == kind {
+			return true
+		}
+		if action.Data != nil && action.Data.Command == kind {
+			return true
+		}
+		if string(action.Kind) == kind || strings.HasPrefix(string(action.Kind), kind+".") {
+			return true
+		}
 	}
-	return commands, nil
+
+	return false
+}
+
+func (s *server) codeActionResolve(ctx context.Context, _ *jsonrpc2.Conn, _ *jsonrpc2.Request, params types.CodeAction) (any, error) {
+	return s.provider().ResolveCodeAction(ctx, params)
+}
+
+func (s *server) textDocumentCodeLens(_ context.Context, _ *jsonrpc2.Conn, _ *jsonrpc2.Request, params lsp.CodeLensParams) (any, error) {
+	return s.provider().GetCodeLenses(params.TextDocument.URI), nil
+}
+
+func (s *server) codeLensResolve(_ context.Context, _ *jsonrpc2.Conn, _ *jsonrpc2.Request, params types.CodeLens) (any, error) {
+	return s.provider().ResolveCodeLens(params)
 }
 
 func (s *server) textDocumentCompletion(ctx context.Context, conn *jsonrpc2.Conn, _ *jsonrpc2.Request, params types.CompletionParams) (any, error) {
 	if s.AutoComplete == "" || s.AutoComplete == "off" {
 		return nil, nil
 	}
+	if s.churn.Churning(params.TextDocument.URI) {
+		return types.CompletionList{IsIncomplete: true, Items: []types.CompletionItem{}}, nil
+	}
+	if doc, ok := s.Documents.Get(params.TextDocument.URI); ok {
+		if !s.triggers.Triggered(params, doc.Line(params.Position.Line)) || s.triggers.Skipped(params, doc) {
+			return types.CompletionList{IsIncomplete: true, Items: []types.CompletionItem{}}, nil
+		}
+	}
+
+	// Only the last of a burst of requests is computed, the others are
+	// answered with an empty, incomplete list.
+	ctx, cancel, ok := s.completions.Wait(ctx)
+	defer cancel()
+	if !ok {
+		return types.CompletionList{IsIncomplete: true, Items: []types.CompletionItem{}}, nil
+	}
 	uuid := uuid.New().String()
 	var res any
 	conn.Call(ctx, "window/workDoneProgress/create", types.WorkDoneProgressCreateParams{
@@ -202,21 +483,26 @@ func (s *server) textDocumentCompletion(ctx context.Context, conn *jsonrpc2.Conn
 	conn.Notify(ctx, "$/progress", types.ProgressParams[types.WorkDoneProgressBegin]{
 		Token: uuid,
 		Value: types.WorkDoneProgressBegin{
-			Title:   "Completion",
+			Title:   s.messages.T(i18n.CompletionTitle),
 			Kind:    "begin",
-			Message: "Fetching completion...",
+			Message: s.messages.T(i18n.CompletionBegin),
 		},
 	})
 	defer conn.Notify(ctx, "$/progress", types.ProgressParams[types.WorkDoneProgressEnd]{
 		Token: uuid,
 		Value: types.WorkDoneProgressEnd{
-			Message: "Completion fetched",
+			Message: s.messages.T(i18n.CompletionEnd),
 			Kind:    "end",
 		},
 	})
 
-	completions, err := s.Provider.GetCompletions(ctx, params)
+	end := s.status.Begin(conn, types.StatusFetchingCompletion)
+	completions, err := s.provider().GetCompletions(ctx, params)
+	end(err)
 	if err != nil {
+		// Failed completions are just empty, but errors such as rate limits
+		// are shown to the user
+		s.showAPIError(ctx, conn, err)
 		return nil, nil
 	}
 
@@ -226,22 +512,104 @@ func (s *server) textDocumentCompletion(ctx context.Context, conn *jsonrpc2.Conn
 	}, nil
 }
 
-func (s *server) workspaceDidChangeConfiguration(ctx context.Context, conn *jsonrpc2.Conn, _ *jsonrpc2.Request, params types.DidChangeConfigurationParams) (any, error) {
-	if params.Settings.LLMSP.Sourcegraph.AutoComplete != "" {
-		s.AutoComplete = params.Settings.LLMSP.Sourcegraph.AutoComplete
+func (s *server) completionItemResolve(ctx context.Context, _ *jsonrpc2.Conn, _ *jsonrpc2.Request, params types.CompletionItem) (any, error) {
+	return s.provider().ResolveCompletion(ctx, params)
+}
+
+func (s *server) workspaceDidChangeConfiguration(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, _ types.DidChangeConfigurationParams) (any, error) {
+	settings, err := s.settings(req)
+	if err != nil {
+		return nil, err
 	}
-	if !s.initialized {
+	return nil, s.configure(ctx, conn, settings)
+}
 
-		provider := &providers.SourcegraphLLM{
-			FileMap: s.FileMap,
+// configure applies the settings, initializing the provider the first time
+// they are applied.
+func (s *server) configure(ctx context.Context, conn *jsonrpc2.Conn, settings types.LLMSPSettings) error {
+	s.configureLogging(settings.Log)
+	s.mu.Lock()
+	s.Hooks = settings.Hooks
+	s.mu.Unlock()
+	s.Logger.Debug("configuration changed", "hooks", len(settings.Hooks))
+	if sourcegraph := settings.Sourcegraph; sourcegraph != nil {
+		if sourcegraph.QuietPeriod > 0 {
+			s.churn.SetQuietPeriod(time.Duration(sourcegraph.QuietPeriod) * time.Millisecond)
+		}
+		if sourcegraph.CompletionDelay > 0 {
+			s.completions.SetDelay(time.Duration(sourcegraph.CompletionDelay) * time.Millisecond)
 		}
-		if err := provider.Initialize(params.Settings.LLMSP); err != nil {
-			return nil, err
+		if sourcegraph.AutoComplete != "" {
+			s.AutoComplete = sourcegraph.AutoComplete
 		}
-		s.Provider = provider
+		s.triggers.Configure(sourcegraph.CompletionTrigger, sourcegraph.CompletionTriggerCharacters, sourcegraph.CompletionSkip)
+	}
+	provider := s.provider()
+	if provider == nil {
+		llm := &providers.SourcegraphLLM{
+			Documents:          s.Documents,
+			WorkspaceRoot:      string(s.RootURI),
+			WorkspaceFolders:   s.WorkspaceFolders,
+			Messages:           s.messages,
+			Tasks:              s.tasks,
+			Logger:             s.Logger,
+			Metrics:            s.Metrics,
+			Diagnostics:        s.diagnostics,
+			ResourceOperations: s.resourceOperations,
+			ContextUpdated:     s.contextUpdated,
+			AccessToken:        s.AccessToken,
+		}
+		if err := llm.Initialize(ctx, settings); err != nil {
+			conn.Notify(ctx, "window/showMessage", lsp.ShowMessageParams{Type: lsp.MTError, Message: err.Error()})
+			return err
+		}
+		s.mu.Lock()
+		s.Provider = llm
 		s.initialized = true
+		s.mu.Unlock()
+		provider = llm
+		for _, message := range llm.UnsupportedFeatures() {
+			conn.Notify(ctx, "window/showMessage", lsp.ShowMessageParams{Type: lsp.MTWarning, Message: message})
+		}
+	}
+	if err := provider.SetPrompts(settings.Prompts); err != nil {
+		s.Logger.Warn("ignoring prompt templates", "err", err)
+		conn.Notify(ctx, "window/logMessage", lsp.LogMessageParams{Type: lsp.MTError, Message: fmt.Sprintf("Invalid prompt templates: %v", err)})
+	}
+	if err := provider.SetSampling(settings.Sampling); err != nil {
+		s.Logger.Warn("ignoring sampling settings", "err", err)
+		conn.Notify(ctx, "window/logMessage", lsp.LogMessageParams{Type: lsp.MTError, Message: fmt.Sprintf("Invalid sampling settings: %v", err)})
+	}
+	conn.Notify(ctx, "window/logMessage", lsp.LogMessageParams{Type: lsp.MTWarning, Message: s.messages.T(i18n.Initialized)})
+
+	return nil
+}
+
+func (s *server) workspaceDidChangeWorkspaceFolders(ctx context.Context, _ *jsonrpc2.Conn, _ *jsonrpc2.Request, params types.DidChangeWorkspaceFoldersParams) (any, error) {
+	s.mu.Lock()
+	folders := []lsp.DocumentURI{}
+	for _, folder := range s.WorkspaceFolders {
+		removed := false
+		for _, r := range params.Event.Removed {
+			if r.URI == folder {
+				removed = true
+				break
+			}
+		}
+		if !removed {
+			folders = append(folders, folder)
+		}
+	}
+	for _, folder := range params.Event.Added {
+		folders = append(folders, folder.URI)
+	}
+	s.WorkspaceFolders = folders
+	initialized, provider := s.initialized, s.Provider
+	s.mu.Unlock()
+
+	if initialized {
+		provider.SetWorkspaceFolders(ctx, folders)
 	}
-	conn.Notify(ctx, "window/logMessage", lsp.LogMessageParams{Type: lsp.MTWarning, Message: "LLMSP initialized!"})
 
 	return nil, nil
 }
@@ -255,30 +623,81 @@ func (s *server) workspaceExecuteCommand(ctx context.Context, conn *jsonrpc2.Con
 	conn.Notify(ctx, "$/progress", types.ProgressParams[types.WorkDoneProgressBegin]{
 		Token: uuid,
 		Value: types.WorkDoneProgressBegin{
-			Title:   "Code actions",
+			Title:   s.messages.T(i18n.CommandTitle),
 			Kind:    "begin",
-			Message: "Computing code actions...",
+			Message: s.messages.T(i18n.CommandBegin),
 		},
 	})
 	defer conn.Notify(ctx, "$/progress", types.ProgressParams[types.WorkDoneProgressEnd]{
 		Token: uuid,
 		Value: types.WorkDoneProgressEnd{
-			Message: "Code actions computed",
+			Message: s.messages.T(i18n.CommandEnd),
 			Kind:    "end",
 		},
 	})
+	// Let the provider report progress on our token if the client didn't supply one
+	if params.WorkDoneToken == "" {
+		params.WorkDoneToken = uuid
+	}
+
+	state := types.StatusRunningCommand
+	if chatCommands[params.Command] {
+		state = types.StatusStreamingChat
+	}
+	end := s.status.Begin(conn, state)
+	res, err := s.provider().ExecuteCommand(ctx, params, conn)
+	end(err)
+	return res, err
+}
+
+func (s *server) codyHistoryList(_ context.Context, _ *jsonrpc2.Conn, _ *jsonrpc2.Request, params types.HistoryListParams) (any, error) {
+	return s.provider().ListHistory(params.Query), nil
+}
 
-	return s.Provider.ExecuteCommand(ctx, params, conn)
+func (s *server) codyHistoryDocument(_ context.Context, _ *jsonrpc2.Conn, _ *jsonrpc2.Request, params types.HistoryDocumentParams) (any, error) {
+	return s.provider().GetHistoryDocument(params.URI)
 }
 
 // LLMProvider is the interface for Language Server Protocol providers.
 type LLMProvider interface {
 	// Initialize initializes the LLM provider with the given settings.
-	Initialize(types.LLMSPSettings) error
+	Initialize(context.Context, types.LLMSPSettings) error
 	// GetCompletions returns completion items for the given completion parameters.
 	GetCompletions(context.Context, types.CompletionParams) ([]types.CompletionItem, error)
 	// GetCodeActions returns the code actions for the given document URI and range.
-	GetCodeActions(lsp.DocumentURI, lsp.Range) []lsp.Command
+	GetCodeActions(lsp.DocumentURI, lsp.Range) []types.CodeAction
+	// ResolveCodeAction computes the edit of the given code action.
+	ResolveCodeAction(context.Context, types.CodeAction) (types.CodeAction, error)
+	// GetCodeLenses returns the code lenses of the given document URI.
+	GetCodeLenses(lsp.DocumentURI) []types.CodeLens
+	// ResolveCodeLens constructs the command of the given code lens.
+	ResolveCodeLens(types.CodeLens) (types.CodeLens, error)
+	// ResolveCompletion fills in the details of the given completion item.
+	ResolveCompletion(context.Context, types.CompletionItem) (types.CompletionItem, error)
+	// Hover returns a Markdown explanation of the symbol on the given line of
+	// the document, or of the whole line if the symbol is empty.
+	Hover(ctx context.Context, uri lsp.DocumentURI, symbol, line string) (string, error)
 	// ExecuteCommand executes the given command and returns the result.
 	ExecuteCommand(context.Context, types.ExecuteCommandParams, *jsonrpc2.Conn) (*json.RawMessage, error)
+	// SetWorkspaceFolders updates the workspace folders opened by the client.
+	SetWorkspaceFolders(context.Context, []lsp.DocumentURI)
+	// ListHistory returns the read-only history documents matching the query.
+	ListHistory(query string) []types.HistoryDocument
+	// GetHistoryDocument returns the history document with the given URI.
+	GetHistoryDocument(lsp.DocumentURI) (*types.HistoryDocument, error)
+	// DocumentSaved updates the local context with the saved contents of the
+	// document.
+	DocumentSaved(lsp.DocumentURI)
+	// SetPrompts overrides the prompt templates. Invalid settings are
+	// rejected, keeping the templates in use.
+	SetPrompts(*types.PromptSettings) error
+	// SetSampling sets the sampling parameters of the kinds of requests.
+	// Invalid settings are rejected, keeping the parameters in use.
+	SetSampling(map[string]types.SamplingSettings) error
+	// Quiesce drops caches and closes idle connections. Anything dropped is
+	// rebuilt on demand.
+	Quiesce()
+	// Flush waits for pending telemetry events to be sent, or for the
+	// context to be done.
+	Flush(context.Context)
 }
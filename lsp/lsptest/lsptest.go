@@ -0,0 +1,188 @@
+// Package lsptest provides an LSP client for end-to-end tests of the server.
+//
+// The client talks JSON-RPC to the server in-process, over a pipe, so that
+// requests go through the same router, middleware and encoding as the ones
+// of an editor. It answers the requests the server sends to the client, such
+// as workspace/applyEdit, and records them along with the notifications, so
+// that tests can check the progress reports and edits the server sends.
+package lsptest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/go-lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// DefaultTimeout is the default timeout of clients.
+const DefaultTimeout = 5 * time.Second
+
+// Message is a request or notification sent by the server to the client.
+type Message struct {
+	Method string
+	Params json.RawMessage
+	// Notif is set for notifications
+	Notif bool
+}
+
+// Client is an LSP client connected to a server.
+type Client struct {
+	conn *jsonrpc2.Conn
+	t    testing.TB
+
+	// Timeout bounds the requests of the client and the waits for messages
+	// from the server
+	Timeout time.Duration
+
+	mu       sync.Mutex
+	received []Message
+	// changed is closed and replaced when a message is received
+	changed chan struct{}
+}
+
+// NewClient connects a client to the server handler, such as the server
+// returned by lsp.NewServer. The connection is closed when the test ends.
+func NewClient(t testing.TB, server jsonrpc2.Handler) *Client {
+	t.Helper()
+	ctx := context.Background()
+
+	c := &Client{t: t, Timeout: DefaultTimeout, changed: make(chan struct{})}
+	a, b := net.Pipe()
+	serverConn := jsonrpc2.NewConn(ctx, jsonrpc2.NewBufferedStream(a, jsonrpc2.VSCodeObjectCodec{}), server)
+	c.conn = jsonrpc2.NewConn(ctx, jsonrpc2.NewBufferedStream(b, jsonrpc2.VSCodeObjectCodec{}), jsonrpc2.HandlerWithError(c.handle))
+	t.Cleanup(func() {
+		c.conn.Close()
+		serverConn.Close()
+	})
+	return c
+}
+
+// handle records a message from the server and answers it.
+func (c *Client) handle(_ context.Context, _ *jsonrpc2.Conn, req *jsonrpc2.Request) (any, error) {
+	message := Message{Method: req.Method, Notif: req.Notif}
+	if req.Params != nil {
+		message.Params = append(json.RawMessage(nil), *req.Params...)
+	}
+	c.mu.Lock()
+	c.received = append(c.received, message)
+	close(c.changed)
+	c.changed = make(chan struct{})
+	c.mu.Unlock()
+
+	switch req.Method {
+	case "workspace/applyEdit":
+		// Edits are never actually applied, the tests check their contents
+		return map[string]bool{"applied": true}, nil
+	case "workspace/configuration":
+		return []any{}, nil
+	}
+	return nil, nil
+}
+
+// Call sends a request and decodes its result into result, unless it is
+// nil.
+func (c *Client) Call(ctx context.Context, method string, params, result any) error {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+	return c.conn.Call(ctx, method, params, result)
+}
+
+// Notify sends a notification.
+func (c *Client) Notify(ctx context.Context, method string, params any) error {
+	return c.conn.Notify(ctx, method, params)
+}
+
+// Initialize sends the initialize request. params are the initialize
+// parameters, usually an lsp.InitializeParams or a map for the extensions
+// of the protocol the server reads.
+func (c *Client) Initialize(ctx context.Context, params any) (types.InitializeResult, error) {
+	var result types.InitializeResult
+	err := c.Call(ctx, "initialize", params, &result)
+	return result, err
+}
+
+// Configure sends the llmsp settings, as workspace/didChangeConfiguration
+// does. It is sent as a request rather than a notification, so that it
+// returns once the server has applied the settings.
+func (c *Client) Configure(ctx context.Context, settings any) error {
+	return c.Call(ctx, "workspace/didChangeConfiguration", map[string]any{
+		"settings": map[string]any{"llmsp": settings},
+	}, nil)
+}
+
+// DidOpen opens a document. Notifications are handled in order, the
+// document is open for the requests sent after it.
+func (c *Client) DidOpen(ctx context.Context, uri lsp.DocumentURI, text string) error {
+	return c.Notify(ctx, "textDocument/didOpen", lsp.DidOpenTextDocumentParams{
+		TextDocument: lsp.TextDocumentItem{URI: uri, Version: 1, Text: text},
+	})
+}
+
+// Completion requests the completions at pos in the document.
+func (c *Client) Completion(ctx context.Context, uri lsp.DocumentURI, pos lsp.Position) (*types.CompletionList, error) {
+	var result *types.CompletionList
+	err := c.Call(ctx, "textDocument/completion", types.CompletionParams{
+		TextDocumentPositionParams: lsp.TextDocumentPositionParams{
+			TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+			Position:     pos,
+		},
+	}, &result)
+	return result, err
+}
+
+// ExecuteCommand executes a command and returns its raw result.
+func (c *Client) ExecuteCommand(ctx context.Context, command string, arguments ...any) (json.RawMessage, error) {
+	var result json.RawMessage
+	err := c.Call(ctx, "workspace/executeCommand", types.ExecuteCommandParams{Command: command, Arguments: arguments}, &result)
+	return result, err
+}
+
+// Received returns the messages of the method received so far, or all
+// messages if method is empty.
+func (c *Client) Received(method string) []Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var messages []Message
+	for _, message := range c.received {
+		if method == "" || message.Method == method {
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
+
+// Wait waits until n messages of the method were received and returns
+// them. Messages sent while handling a request may arrive after its
+// response.
+func (c *Client) Wait(method string, n int) ([]Message, error) {
+	timeout := time.After(c.Timeout)
+	for {
+		c.mu.Lock()
+		changed := c.changed
+		c.mu.Unlock()
+		if messages := c.Received(method); len(messages) >= n {
+			return messages, nil
+		}
+		select {
+		case <-changed:
+		case <-timeout:
+			return c.Received(method), fmt.Errorf("received %d %s messages after %v, want %d", len(c.Received(method)), method, c.Timeout, n)
+		}
+	}
+}
+
+// Decode decodes the parameters of a message into v, failing the test if
+// they don't match.
+func (c *Client) Decode(message Message, v any) {
+	c.t.Helper()
+	if err := json.Unmarshal(message.Params, v); err != nil {
+		c.t.Fatalf("decoding %s: %v", message.Method, err)
+	}
+}
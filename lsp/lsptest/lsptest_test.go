@@ -0,0 +1,45 @@
+package lsptest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pjlast/llmsp/lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	router := lsp.NewRouter()
+	router.Register("ping", lsp.LSPHandlerFunc(func(ctx context.Context, conn *jsonrpc2.Conn, _ *jsonrpc2.Request, params string) (any, error) {
+		var applied struct{ Applied bool }
+		if err := conn.Call(ctx, "workspace/applyEdit", map[string]any{"edit": map[string]any{}}, &applied); err != nil || !applied.Applied {
+			t.Errorf("applying an edit returned (%+v, %v), want it applied", applied, err)
+		}
+		conn.Notify(ctx, "window/logMessage", map[string]any{"message": params})
+		return "pong", nil
+	}))
+	client := NewClient(t, jsonrpc2.AsyncHandler(router))
+
+	var res string
+	if err := client.Call(ctx, "ping", "hello", &res); err != nil || res != "pong" {
+		t.Fatalf("ping returned (%q, %v), want pong", res, err)
+	}
+	messages, err := client.Wait("window/logMessage", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logged struct{ Message string }
+	client.Decode(messages[0], &logged)
+	if logged.Message != "hello" || !messages[0].Notif {
+		t.Errorf("got %+v, want a notification logging hello", messages[0])
+	}
+	if all := client.Received(""); len(all) != 2 || all[0].Method != "workspace/applyEdit" || all[0].Notif {
+		t.Errorf("received %+v, want the applyEdit request and the notification", all)
+	}
+	client.Timeout = 10 * time.Millisecond
+	if _, err := client.Wait("window/showMessage", 1); err == nil {
+		t.Error("waiting for a message that isn't sent succeeded")
+	}
+}
@@ -0,0 +1,31 @@
+package lsp
+
+import (
+	"context"
+	"time"
+
+	"github.com/pjlast/llmsp/internal/metrics"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// recordRequests is middleware that counts the requests and notifications
+// handled, by method, along with their latency and the errors returned.
+func recordRequests[T any](s *server, method string, handler LSPHandler[T]) LSPHandler[T] {
+	return func(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request, params T) (any, error) {
+		start := time.Now()
+		res, err := handler(ctx, conn, req, params)
+		s.Metrics.Counter("llmsp_requests_total", "Requests and notifications handled by method.", "method").Inc(method)
+		s.Metrics.Histogram("llmsp_request_duration_seconds", "Latency of requests and notifications by method.", metrics.DefaultBuckets, "method").
+			Observe(time.Since(start).Seconds(), method)
+		if err != nil {
+			s.Metrics.Counter("llmsp_request_errors_total", "Requests and notifications that failed by method.", "method").Inc(method)
+		}
+		return res, err
+	}
+}
+
+// llmspMetrics returns the current values of the metrics, for editor status
+// lines.
+func (s *server) llmspMetrics(context.Context, *jsonrpc2.Conn, *jsonrpc2.Request, any) (any, error) {
+	return s.Metrics.Snapshot(), nil
+}
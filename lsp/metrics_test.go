@@ -0,0 +1,68 @@
+package lsp
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pjlast/llmsp/internal/metrics"
+	"github.com/pjlast/llmsp/lsp/lsptest"
+	"github.com/pjlast/llmsp/providers"
+	"github.com/sourcegraph/go-lsp"
+)
+
+func TestMetrics(t *testing.T) {
+	ctx := context.Background()
+	s := NewServer("", "")
+	s.Metrics = metrics.NewRegistry()
+	s.Provider = &providers.MockLLM{HoverText: "Prints a line."}
+	s.initialized = true
+	client := lsptest.NewClient(t, s)
+
+	uri := lsp.DocumentURI("file:///main.go")
+	if err := client.DidOpen(ctx, uri, "package main\n\nfunc main() {\n\tfmt.Println()\n}\n"); err != nil {
+		t.Fatal(err)
+	}
+	params := lsp.TextDocumentPositionParams{TextDocument: lsp.TextDocumentIdentifier{URI: uri}, Position: lsp.Position{Line: 3, Character: 6}}
+	for i := 0; i < 2; i++ {
+		if err := client.Call(ctx, "textDocument/hover", params, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Unknown documents fail
+	if err := client.Call(ctx, "cody/history/document", map[string]any{"uri": "file:///missing.go"}, nil); err == nil {
+		t.Error("history of a missing document returned no error")
+	}
+
+	var families []metrics.Family
+	if err := client.Call(ctx, "llmsp/metrics", nil, &families); err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[string]float64)
+	for _, family := range families {
+		for _, series := range family.Series {
+			name := family.Name
+			for _, label := range []string{"method", "cache", "result"} {
+				if value, ok := series.Labels[label]; ok {
+					name += " " + value
+				}
+			}
+			values[name] = series.Value + float64(series.Count)
+		}
+	}
+	want := map[string]float64{
+		"llmsp_requests_total textDocument/hover":           2,
+		"llmsp_requests_total textDocument/didOpen":         1,
+		"llmsp_request_duration_seconds textDocument/hover": 2,
+		"llmsp_request_errors_total cody/history/document":  1,
+		"llmsp_cache_lookups_total hover hit":               1,
+		"llmsp_cache_lookups_total hover miss":              1,
+	}
+	for name, value := range want {
+		if values[name] != value {
+			t.Errorf("%s == %v, want %v", name, values[name], value)
+		}
+	}
+	if _, ok := values["llmsp_request_errors_total textDocument/hover"]; ok {
+		t.Error("successful hovers were counted as errors")
+	}
+}
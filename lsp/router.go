@@ -2,10 +2,18 @@ package lsp
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"runtime/debug"
+	"sync"
 
 	"github.com/sourcegraph/jsonrpc2"
 )
 
+// CodeRequestCancelled is the LSP error code returned for requests that were
+// cancelled by the client.
+const CodeRequestCancelled = -32800
+
 // HandlerFunc is a function type that handles a single JSON-RPC 2.0 request.
 //
 // The handler is passed the request context, a JSON-RPC connection, and the request object. The
@@ -17,29 +25,149 @@ func (h HandlerFunc) Handle(ctx context.Context, conn *jsonrpc2.Conn, req *jsonr
 	h(ctx, conn, req)
 }
 
+// Middleware wraps a handler, e.g. to inspect or modify the requests passed
+// to it and the responses it sends.
+type Middleware func(jsonrpc2.Handler) jsonrpc2.Handler
+
 // Router handles JSON-RPC 2.0 requests and dispatches them to the appropriate handler.
+//
+// Every request is handled with its own context, which is cancelled when the
+// client sends a $/cancelRequest notification for the request's ID.
 type Router struct {
 	routes map[string]jsonrpc2.Handler
+	// middleware wraps every handler, the first middleware is the outermost
+	middleware []Middleware
+	// inFlight maps the IDs of requests currently being handled to the
+	// functions cancelling their contexts
+	inFlight map[jsonrpc2.ID]context.CancelFunc
+	mu       sync.Mutex
 }
 
 // NewRouter creates a new Router.
 func NewRouter() *Router {
 	return &Router{
-		routes: make(map[string]jsonrpc2.Handler),
+		routes:   make(map[string]jsonrpc2.Handler),
+		inFlight: make(map[jsonrpc2.ID]context.CancelFunc),
 	}
 }
 
+// cancelParams are the parameters of a $/cancelRequest notification.
+type cancelParams struct {
+	ID jsonrpc2.ID `json:"id"`
+}
+
 // Register registers a new handler for the given JSON-RPC 2.0 method.
 func (r *Router) Register(method string, handler jsonrpc2.Handler) {
 	r.routes[method] = handler
 }
 
+// Use adds middleware to the chain wrapping all handlers. Middleware added
+// first sees requests first.
+func (r *Router) Use(middleware ...Middleware) {
+	r.middleware = append(r.middleware, middleware...)
+}
+
 // Handle dispatches a JSON-RPC 2.0 request to the appropriate handler.
 // It responds with a MethodNotFound error if no handler is registered
 // for the method.
 func (r *Router) Handle(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	if req.Method == "$/cancelRequest" {
+		r.cancel(req)
+		return
+	}
+
 	if handler, ok := r.routes[req.Method]; ok {
+		if !req.Notif {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithCancel(ctx)
+			r.mu.Lock()
+			r.inFlight[req.ID] = cancel
+			r.mu.Unlock()
+			defer func() {
+				r.mu.Lock()
+				delete(r.inFlight, req.ID)
+				r.mu.Unlock()
+				cancel()
+			}()
+		}
+
+		for i := len(r.middleware) - 1; i >= 0; i-- {
+			handler = r.middleware[i](handler)
+		}
 		handler.Handle(ctx, conn, req)
 		return
 	}
 }
+
+// Recover is middleware that recovers from panics in handlers, so that a bug
+// in a single handler doesn't take down the server. The panic is logged with
+// logf, and requests are answered with an internal error.
+func Recover(logf func(format string, args ...any)) Middleware {
+	return func(next jsonrpc2.Handler) jsonrpc2.Handler {
+		return HandlerFunc(func(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+			defer func() {
+				r := recover()
+				if r == nil {
+					return
+				}
+				logf("panic handling %s: %v\n%s", req.Method, r, debug.Stack())
+				if !req.Notif {
+					_ = conn.ReplyWithError(ctx, req.ID, &jsonrpc2.Error{
+						Code:    jsonrpc2.CodeInternalError,
+						Message: fmt.Sprintf("internal error handling %s: %v", req.Method, r),
+					})
+				}
+			}()
+
+			next.Handle(ctx, conn, req)
+		})
+	}
+}
+
+// Busy reports whether any requests are being handled.
+func (r *Router) Busy() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.inFlight) > 0
+}
+
+// CancelAll cancels the contexts of all in-flight requests.
+func (r *Router) CancelAll() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, cancel := range r.inFlight {
+		cancel()
+	}
+}
+
+// CancelOthers cancels the contexts of all in-flight requests except the
+// request with the given ID.
+func (r *Router) CancelOthers(id jsonrpc2.ID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for requestID, cancel := range r.inFlight {
+		if requestID != id {
+			cancel()
+		}
+	}
+}
+
+// cancel cancels the context of the in-flight request referenced by a
+// $/cancelRequest notification. Unknown or already completed requests are
+// ignored.
+func (r *Router) cancel(req *jsonrpc2.Request) {
+	if req.Params == nil {
+		return
+	}
+	var params cancelParams
+	if err := json.Unmarshal(*req.Params, &params); err != nil {
+		return
+	}
+
+	r.mu.Lock()
+	cancel, ok := r.inFlight[params.ID]
+	r.mu.Unlock()
+	if ok {
+		cancel()
+	}
+}
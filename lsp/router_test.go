@@ -0,0 +1,110 @@
+package lsp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func TestRouterCancelRequest(t *testing.T) {
+	ctx := context.Background()
+	started := make(chan struct{})
+
+	router := NewRouter()
+	router.Register("block", LSPHandlerFunc(func(ctx context.Context, _ *jsonrpc2.Conn, _ *jsonrpc2.Request, _ any) (any, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}))
+
+	a, b := net.Pipe()
+	server := jsonrpc2.NewConn(ctx, jsonrpc2.NewBufferedStream(a, jsonrpc2.VSCodeObjectCodec{}), jsonrpc2.AsyncHandler(router))
+	defer server.Close()
+	client := jsonrpc2.NewConn(ctx, jsonrpc2.NewBufferedStream(b, jsonrpc2.VSCodeObjectCodec{}), nil)
+	defer client.Close()
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- client.Call(ctx, "block", struct{}{}, nil, jsonrpc2.PickID(jsonrpc2.ID{Num: 1}))
+	}()
+
+	<-started
+	if err := client.Notify(ctx, "$/cancelRequest", cancelParams{ID: jsonrpc2.ID{Num: 1}}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-errc:
+		var rpcErr *jsonrpc2.Error
+		if !errors.As(err, &rpcErr) || rpcErr.Code != CodeRequestCancelled {
+			t.Errorf("got error %v, want code %d", err, CodeRequestCancelled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("request was not cancelled")
+	}
+}
+
+func TestRouterRecover(t *testing.T) {
+	ctx := context.Background()
+
+	var logged []string
+	router := NewRouter()
+	router.Use(Recover(func(format string, args ...any) {
+		logged = append(logged, format)
+	}))
+	router.Register("panic", LSPHandlerFunc(func(context.Context, *jsonrpc2.Conn, *jsonrpc2.Request, any) (any, error) {
+		var s []string
+		return s[1], nil
+	}))
+	router.Register("ok", LSPHandlerFunc(func(context.Context, *jsonrpc2.Conn, *jsonrpc2.Request, any) (any, error) {
+		return "ok", nil
+	}))
+
+	a, b := net.Pipe()
+	server := jsonrpc2.NewConn(ctx, jsonrpc2.NewBufferedStream(a, jsonrpc2.VSCodeObjectCodec{}), router)
+	defer server.Close()
+	client := jsonrpc2.NewConn(ctx, jsonrpc2.NewBufferedStream(b, jsonrpc2.VSCodeObjectCodec{}), nil)
+	defer client.Close()
+
+	err := client.Call(ctx, "panic", struct{}{}, nil)
+	var rpcErr *jsonrpc2.Error
+	if !errors.As(err, &rpcErr) || rpcErr.Code != jsonrpc2.CodeInternalError {
+		t.Errorf("got error %v, want code %d", err, jsonrpc2.CodeInternalError)
+	}
+	if len(logged) != 1 {
+		t.Errorf("logged %d messages, want 1", len(logged))
+	}
+
+	var res string
+	if err := client.Call(ctx, "ok", struct{}{}, &res); err != nil || res != "ok" {
+		t.Errorf("request after panic returned (%q, %v), want (\"ok\", nil)", res, err)
+	}
+}
+
+func TestRouterMiddlewareOrder(t *testing.T) {
+	var order []string
+	middleware := func(name string) Middleware {
+		return func(next jsonrpc2.Handler) jsonrpc2.Handler {
+			return HandlerFunc(func(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+				order = append(order, name)
+				next.Handle(ctx, conn, req)
+			})
+		}
+	}
+
+	router := NewRouter()
+	router.Use(middleware("first"), middleware("second"))
+	router.Register("method", HandlerFunc(func(context.Context, *jsonrpc2.Conn, *jsonrpc2.Request) {
+		order = append(order, "handler")
+	}))
+	router.Handle(context.Background(), nil, &jsonrpc2.Request{Method: "method", Notif: true})
+
+	if got, want := strings.Join(order, ","), "first,second,handler"; got != want {
+		t.Errorf("middleware ran in order %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,138 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pjlast/llmsp/claude"
+	"github.com/pjlast/llmsp/internal/documents"
+	"github.com/pjlast/llmsp/providers"
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/go-lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+var _ LLMProvider = (*providers.MockLLM)(nil)
+
+// testClient is a client connected to a server, it answers the requests of
+// the server and records its notifications.
+type testClient struct {
+	*jsonrpc2.Conn
+
+	mu            sync.Mutex
+	notifications map[string][]json.RawMessage
+}
+
+// Notifications returns the parameters of the notifications of the method
+// received so far.
+func (c *testClient) Notifications(method string) []json.RawMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.notifications[method]
+}
+
+// serve connects a client to an initialized server answering with provider.
+func serve(t *testing.T, provider LLMProvider) *testClient {
+	t.Helper()
+	ctx := context.Background()
+
+	s := NewServer("", "")
+	s.Provider = provider
+	s.initialized = true
+
+	client := &testClient{notifications: make(map[string][]json.RawMessage)}
+	a, b := net.Pipe()
+	server := jsonrpc2.NewConn(ctx, jsonrpc2.NewBufferedStream(a, jsonrpc2.VSCodeObjectCodec{}), s)
+	t.Cleanup(func() { server.Close() })
+	client.Conn = jsonrpc2.NewConn(ctx, jsonrpc2.NewBufferedStream(b, jsonrpc2.VSCodeObjectCodec{}), jsonrpc2.HandlerWithError(
+		func(_ context.Context, _ *jsonrpc2.Conn, req *jsonrpc2.Request) (any, error) {
+			if req.Notif && req.Params != nil {
+				client.mu.Lock()
+				client.notifications[req.Method] = append(client.notifications[req.Method], *req.Params)
+				client.mu.Unlock()
+			}
+			return nil, nil
+		}))
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestServerHover(t *testing.T) {
+	ctx := context.Background()
+	provider := &providers.MockLLM{HoverText: "Prints a line."}
+	client := serve(t, provider)
+
+	uri := lsp.DocumentURI("file:///main.go")
+	if err := client.Notify(ctx, "textDocument/didOpen", lsp.DidOpenTextDocumentParams{
+		TextDocument: lsp.TextDocumentItem{URI: uri, Version: 1, Text: "package main\n\nfunc main() {\n\tfmt.Println()\n}\n"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	params := lsp.TextDocumentPositionParams{TextDocument: lsp.TextDocumentIdentifier{URI: uri}, Position: lsp.Position{Line: 3, Character: 6}}
+	for i := 0; i < 2; i++ {
+		var hover types.Hover
+		if err := client.Call(ctx, "textDocument/hover", params, &hover); err != nil {
+			t.Fatal(err)
+		}
+		if hover.Contents.Value != "Prints a line." {
+			t.Errorf("hover == %q, want the explanation of the provider", hover.Contents.Value)
+		}
+	}
+	// The second hover is cached
+	if got, want := provider.Calls(), []string{"Hover"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("provider calls == %q, want %q", got, want)
+	}
+}
+
+func TestServerExecuteCommand(t *testing.T) {
+	ctx := context.Background()
+	provider := &providers.MockLLM{CommandResults: map[string]any{"cody.chat/list": []string{"first", "second"}}}
+	client := serve(t, provider)
+
+	var res []string
+	if err := client.Call(ctx, "workspace/executeCommand", types.ExecuteCommandParams{Command: "cody.chat/list"}, &res); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(res, []string{"first", "second"}) {
+		t.Errorf("command returned %q, want the result of the provider", res)
+	}
+	if got, want := provider.Calls(), []string{"ExecuteCommand:cody.chat/list"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("provider calls == %q, want %q", got, want)
+	}
+}
+
+func TestServerCommandErrors(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		err     error
+		code    int64
+		message bool
+	}{
+		{fmt.Errorf("explain: %w", documents.ErrLineOutOfRange), jsonrpc2.CodeInvalidParams, false},
+		{claude.ErrUnauthorized, 0, true},
+	}
+	for _, test := range tests {
+		client := serve(t, &providers.MockLLM{Err: test.err})
+		err := client.Call(ctx, "workspace/executeCommand", types.ExecuteCommandParams{Command: "cody.explain"}, nil)
+
+		var rpcErr *jsonrpc2.Error
+		if !errors.As(err, &rpcErr) || rpcErr.Code != test.code {
+			t.Errorf("command failing with %v returned %v, want code %d", test.err, err, test.code)
+		}
+		// The notification may arrive after the response
+		deadline := time.Now().Add(time.Second)
+		for test.message && len(client.Notifications("window/showMessage")) == 0 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if shown := len(client.Notifications("window/showMessage")) > 0; shown != test.message {
+			t.Errorf("command failing with %v showed a message: %v, want %v", test.err, shown, test.message)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pjlast/llmsp/internal/logging"
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// DefaultGracePeriod is how long the state of a disconnected session is kept
+// around for the client to reconnect.
+const DefaultGracePeriod = 5 * time.Minute
+
+// session is a server whose state outlives the connection it was created on.
+type session struct {
+	server *server
+	// expire drops the session once the grace period has passed without the
+	// client reconnecting. It is nil while a client is connected.
+	expire *time.Timer
+}
+
+// SessionManager serves clients connecting over a socket. Every client gets a
+// session token at initialize. If the connection drops, the session's state
+// (interaction memory, caches, open documents) is kept for the grace period,
+// and a client that reconnects with the token in its initializationOptions
+// resumes the session instead of starting from scratch.
+type SessionManager struct {
+	// URL is the URL of the Sourcegraph instance
+	URL string
+	// AccessToken is the access token used to authenticate to Sourcegraph
+	AccessToken string
+	// AutoComplete enables or disables autocompletion for new sessions
+	AutoComplete string
+	// GracePeriod is how long disconnected sessions are kept
+	GracePeriod time.Duration
+	// IdleTimeout is how long sessions can be idle before they release their
+	// resources
+	IdleTimeout time.Duration
+	// LogOutput and LogLevel configure the logger of new sessions, all
+	// sessions share the output
+	LogOutput io.Writer
+	LogLevel  logging.Level
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+// NewSessionManager creates a new SessionManager.
+func NewSessionManager(url, accessToken string) *SessionManager {
+	return &SessionManager{
+		URL:         url,
+		AccessToken: accessToken,
+		GracePeriod: DefaultGracePeriod,
+		LogLevel:    logging.LevelInfo,
+		sessions:    make(map[string]*session),
+	}
+}
+
+// Serve serves a single client connection until it is closed.
+func (m *SessionManager) Serve(ctx context.Context, stream jsonrpc2.ObjectStream) {
+	h := &sessionHandler{manager: m}
+	<-jsonrpc2.NewConn(ctx, stream, h, jsonrpc2.OnRecv(h.traceRecv), jsonrpc2.OnSend(h.traceSend)).DisconnectNotify()
+	if h.token != "" {
+		m.detach(h.token)
+	}
+}
+
+// attach returns the session with the given token, or a new session if there
+// is no such session or it is already in use by another connection.
+func (m *SessionManager) attach(token string) (string, *server) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Sessions that were shut down can't be resumed
+	if sess, ok := m.sessions[token]; ok && sess.expire != nil && !sess.server.shuttingDown.Load() {
+		sess.expire.Stop()
+		sess.expire = nil
+		return token, sess.server
+	}
+
+	token = uuid.New().String()
+	s := NewServer(m.URL, m.AccessToken)
+	s.AutoComplete = m.AutoComplete
+	s.Logger.SetOutput(m.LogOutput)
+	s.Logger.SetLevel(m.LogLevel)
+	s.SetIdleTimeout(m.IdleTimeout, nil)
+	s.sessionToken = token
+	m.sessions[token] = &session{server: s}
+	return token, s
+}
+
+// detach marks the session as disconnected and schedules it to be dropped
+// once the grace period has passed.
+func (m *SessionManager) detach(token string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sess, ok := m.sessions[token]
+	if !ok {
+		return
+	}
+	// Requests of the dropped connection can't be replied to anymore
+	sess.server.router.CancelAll()
+	var expire *time.Timer
+	expire = time.AfterFunc(m.GracePeriod, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		// The session may have been resumed and detached again since
+		if m.sessions[token] == sess && sess.expire == expire {
+			delete(m.sessions, token)
+			go sess.server.Close()
+		}
+	})
+	sess.expire = expire
+}
+
+// sessionHandler binds a connection to a session on its first request, which
+// is expected to be initialize.
+type sessionHandler struct {
+	manager *SessionManager
+	mu      sync.Mutex
+	token   string
+	server  *server
+}
+
+// Handle implements the jsonrpc2.Handler interface for sessionHandler.
+func (h *sessionHandler) Handle(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	h.mu.Lock()
+	if h.server == nil {
+		h.token, h.server = h.manager.attach(resumeToken(req))
+	}
+	s := h.server
+	h.mu.Unlock()
+
+	s.Handle(ctx, conn, req)
+}
+
+// traceRecv traces messages received on the connection once it is bound to a
+// session.
+func (h *sessionHandler) traceRecv(req *jsonrpc2.Request, resp *jsonrpc2.Response) {
+	h.mu.Lock()
+	s := h.server
+	h.mu.Unlock()
+	if s != nil {
+		s.traceRecv(req, resp)
+	}
+}
+
+// traceSend traces messages sent on the connection once it is bound to a
+// session.
+func (h *sessionHandler) traceSend(req *jsonrpc2.Request, resp *jsonrpc2.Response) {
+	h.mu.Lock()
+	s := h.server
+	h.mu.Unlock()
+	if s != nil {
+		s.traceSend(req, resp)
+	}
+}
+
+// resumeToken returns the session token the client sent in the
+// initializationOptions of an initialize request, if any.
+func resumeToken(req *jsonrpc2.Request) string {
+	if req.Method != "initialize" || req.Params == nil {
+		return ""
+	}
+	var params types.InitializeSessionParams
+	if err := json.Unmarshal(*req.Params, &params); err != nil {
+		return ""
+	}
+	return params.InitializationOptions.SessionToken
+}
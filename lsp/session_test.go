@@ -0,0 +1,90 @@
+package lsp
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// connect connects a new client to the session manager and initializes it
+// with the given session token, returning the token sent back by the server.
+func connect(t *testing.T, m *SessionManager, token string) (string, *jsonrpc2.Conn) {
+	t.Helper()
+	ctx := context.Background()
+
+	a, b := net.Pipe()
+	go m.Serve(ctx, jsonrpc2.NewBufferedStream(a, jsonrpc2.VSCodeObjectCodec{}))
+	client := jsonrpc2.NewConn(ctx, jsonrpc2.NewBufferedStream(b, jsonrpc2.VSCodeObjectCodec{}), nil)
+
+	var params types.InitializeSessionParams
+	params.InitializationOptions.SessionToken = token
+	var res types.InitializeResult
+	if err := client.Call(ctx, "initialize", params, &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.SessionToken == "" {
+		t.Fatal("no session token returned")
+	}
+
+	return res.SessionToken, client
+}
+
+func TestSessionResume(t *testing.T) {
+	m := NewSessionManager("", "")
+
+	token, client := connect(t, m, "")
+	// A session can't be resumed while its client is still connected
+	if other, otherClient := connect(t, m, token); other == token {
+		t.Error("resumed a session that is still connected")
+	} else {
+		otherClient.Close()
+	}
+	client.Close()
+	<-client.DisconnectNotify()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resumed, client := connect(t, m, token)
+		client.Close()
+		if resumed == token {
+			break
+		}
+		// The server may not have noticed the disconnect yet
+		if time.Now().After(deadline) {
+			t.Fatalf("got session %q, want %q", resumed, token)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSessionExpires(t *testing.T) {
+	m := NewSessionManager("", "")
+	m.GracePeriod = time.Millisecond
+
+	token, client := connect(t, m, "")
+	client.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		m.mu.Lock()
+		_, ok := m.sessions[token]
+		m.mu.Unlock()
+		if !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("session was not dropped after the grace period")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if resumed, client := connect(t, m, token); resumed == token {
+		t.Error("resumed an expired session")
+	} else {
+		client.Close()
+	}
+}
@@ -0,0 +1,64 @@
+package lsp
+
+import (
+	"context"
+	"time"
+
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// flushTimeout is how long shutdown waits for pending telemetry events.
+const flushTimeout = 2 * time.Second
+
+// shutdown handles the shutdown request: all other requests are cancelled
+// and pending telemetry events are sent. Afterwards, every request but exit
+// is rejected.
+func (s *server) shutdown(ctx context.Context, _ *jsonrpc2.Conn, req *jsonrpc2.Request, _ any) (any, error) {
+	s.shuttingDown.Store(true)
+	s.Logger.Info("shutting down")
+	s.router.CancelOthers(req.ID)
+	s.completions.Cancel()
+
+	if provider := s.provider(); provider != nil {
+		ctx, cancel := context.WithTimeout(ctx, flushTimeout)
+		defer cancel()
+		provider.Flush(ctx)
+	}
+
+	return nil, nil
+}
+
+// exit handles the exit notification. The process exits with status 0 if
+// the server was shut down first, and 1 otherwise. Servers without an Exit
+// function close the connection instead.
+func (s *server) exit(_ context.Context, conn *jsonrpc2.Conn, _ *jsonrpc2.Request, _ any) (any, error) {
+	code := 0
+	if !s.shuttingDown.Load() {
+		code = 1
+	}
+	s.Close()
+	if s.Exit != nil {
+		s.Exit(code)
+		return nil, nil
+	}
+	conn.Close()
+	return nil, nil
+}
+
+// rejectAfterShutdown is middleware that rejects requests received after the
+// shutdown request with an InvalidRequest error, as required by the LSP
+// specification. Notifications other than exit are dropped.
+func (s *server) rejectAfterShutdown(next jsonrpc2.Handler) jsonrpc2.Handler {
+	return HandlerFunc(func(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+		if !s.shuttingDown.Load() || req.Method == "exit" {
+			next.Handle(ctx, conn, req)
+			return
+		}
+		if !req.Notif {
+			_ = conn.ReplyWithError(ctx, req.ID, &jsonrpc2.Error{
+				Code:    jsonrpc2.CodeInvalidRequest,
+				Message: "server is shutting down",
+			})
+		}
+	})
+}
@@ -0,0 +1,98 @@
+package lsp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// startServer connects a client to s over an in-memory pipe.
+func startServer(t *testing.T, s *server) *jsonrpc2.Conn {
+	t.Helper()
+	ctx := context.Background()
+	a, b := net.Pipe()
+	serverConn := jsonrpc2.NewConn(ctx, jsonrpc2.NewBufferedStream(a, jsonrpc2.VSCodeObjectCodec{}), s)
+	t.Cleanup(func() { serverConn.Close() })
+	clientConn := jsonrpc2.NewConn(ctx, jsonrpc2.NewBufferedStream(b, jsonrpc2.VSCodeObjectCodec{}), nil)
+	t.Cleanup(func() { clientConn.Close() })
+	return clientConn
+}
+
+func TestShutdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		shutdown bool
+		want     int
+	}{
+		{"shutdown then exit", true, 0},
+		{"exit without shutdown", false, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := NewServer("", "")
+			codes := make(chan int, 1)
+			s.Exit = func(code int) { codes <- code }
+			client := startServer(t, s)
+
+			if test.shutdown {
+				if err := client.Call(ctx, "shutdown", nil, nil); err != nil {
+					t.Fatal(err)
+				}
+				err := client.Call(ctx, "llmsp/tasks/background", nil, nil)
+				var rpcErr *jsonrpc2.Error
+				if !errors.As(err, &rpcErr) || rpcErr.Code != jsonrpc2.CodeInvalidRequest {
+					t.Errorf("request after shutdown returned %v, want code %d", err, jsonrpc2.CodeInvalidRequest)
+				}
+			}
+
+			if err := client.Notify(ctx, "exit", nil); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case code := <-codes:
+				if code != test.want {
+					t.Errorf("exited with status %d, want %d", code, test.want)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("server did not exit")
+			}
+		})
+	}
+}
+
+func TestShutdownCancelsRequests(t *testing.T) {
+	ctx := context.Background()
+	s := NewServer("", "")
+	started := make(chan struct{})
+	registerHandler(s, "block", func(ctx context.Context, _ *jsonrpc2.Conn, _ *jsonrpc2.Request, _ any) (any, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	client := startServer(t, s)
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- client.Call(ctx, "block", nil, nil)
+	}()
+	<-started
+	if err := client.Call(ctx, "shutdown", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-errc:
+		var rpcErr *jsonrpc2.Error
+		if !errors.As(err, &rpcErr) || rpcErr.Code != CodeRequestCancelled {
+			t.Errorf("in-flight request returned %v, want code %d", err, CodeRequestCancelled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("in-flight request was not cancelled")
+	}
+}
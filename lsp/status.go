@@ -0,0 +1,86 @@
+package lsp
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/pjlast/llmsp/claude"
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// chatCommands are the commands whose response is streamed in cody/chat
+// notifications.
+var chatCommands = map[string]bool{
+	"cody.chat/message":     true,
+	"cody.explain":          true,
+	"cody.explainSelection": true,
+	"cody.chat/retry":       true,
+	"cody.repo/ask":         true,
+}
+
+// statePriority orders the states of operations in progress, the state of
+// the server is the one of the highest priority.
+var statePriority = map[string]int{
+	types.StatusFetchingCompletion: 1,
+	types.StatusFetchingHover:      2,
+	types.StatusRunningCommand:     3,
+	types.StatusStreamingChat:      4,
+}
+
+// serverStatus tracks the operations in progress and reports the state of
+// the server in llmsp/status notifications when it changes. Once every
+// operation is done, the state is idle, unless the last one failed.
+type serverStatus struct {
+	mu     sync.Mutex
+	active map[string]int
+	last   types.StatusParams
+}
+
+func newServerStatus() *serverStatus {
+	return &serverStatus{active: make(map[string]int), last: types.StatusParams{State: types.StatusIdle}}
+}
+
+// Begin reports the start of an operation in the state. The returned
+// function reports its end, with its error if it failed.
+func (s *serverStatus) Begin(conn *jsonrpc2.Conn, state string) func(err error) {
+	s.mu.Lock()
+	s.active[state]++
+	s.update(conn, nil)
+	s.mu.Unlock()
+
+	return func(err error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.active[state]--
+		s.update(conn, err)
+	}
+}
+
+// update computes the state and notifies the client if it changed. err is
+// the error of the operation that just ended, if any, which is reported
+// until another operation begins. s.mu must be held.
+func (s *serverStatus) update(conn *jsonrpc2.Conn, err error) {
+	status := types.StatusParams{State: types.StatusIdle}
+	for state, n := range s.active {
+		status.Active += n
+		if n > 0 && statePriority[state] > statePriority[status.State] {
+			status.State = state
+		}
+	}
+	if status.Active == 0 && err != nil && !errors.Is(err, context.Canceled) {
+		switch {
+		case errors.Is(err, claude.ErrRateLimited):
+			status.State, status.Message = types.StatusRateLimited, err.Error()
+		default:
+			status.State, status.Message = types.StatusError, err.Error()
+		}
+	}
+	if status == s.last {
+		return
+	}
+	s.last = status
+	// The notification is sent even if the request was canceled
+	conn.Notify(context.Background(), "llmsp/status", status)
+}
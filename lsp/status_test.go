@@ -0,0 +1,116 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/pjlast/llmsp/claude"
+	"github.com/pjlast/llmsp/lsp/lsptest"
+	"github.com/pjlast/llmsp/providers"
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/go-lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func TestStatus(t *testing.T) {
+	ctx := context.Background()
+	s := NewServer("", "")
+	mock := &providers.MockLLM{HoverText: "Prints a line."}
+	s.Provider = mock
+	s.initialized = true
+	client := lsptest.NewClient(t, s)
+
+	uri := lsp.DocumentURI("file:///main.go")
+	if err := client.DidOpen(ctx, uri, "package main\n\nfunc main() {\n\tfmt.Println()\n\tos.Exit(1)\n}\n"); err != nil {
+		t.Fatal(err)
+	}
+	hover := func(line int) error {
+		params := lsp.TextDocumentPositionParams{TextDocument: lsp.TextDocumentIdentifier{URI: uri}, Position: lsp.Position{Line: line, Character: 2}}
+		return client.Call(ctx, "textDocument/hover", params, nil)
+	}
+
+	if err := hover(3); err != nil {
+		t.Fatal(err)
+	}
+	// Cached hovers don't fetch anything
+	if err := hover(3); err != nil {
+		t.Fatal(err)
+	}
+	mock.Err = fmt.Errorf("completion failed: %w", claude.ErrRateLimited)
+	if err := hover(4); err == nil {
+		t.Fatal("a failed hover succeeded")
+	}
+	mock.Err = nil
+	if _, err := client.ExecuteCommand(ctx, "cody.explain", string(uri), 3, 4); err != nil {
+		t.Fatal(err)
+	}
+	mock.Err = fmt.Errorf("no such file")
+	if _, err := client.ExecuteCommand(ctx, "docstring", string(uri), 2, 5); err == nil {
+		t.Fatal("a failed command succeeded")
+	}
+
+	want := []types.StatusParams{
+		{State: types.StatusFetchingHover, Active: 1},
+		{State: types.StatusIdle},
+		{State: types.StatusFetchingHover, Active: 1},
+		{State: types.StatusRateLimited, Message: "completion failed: rate limit exceeded"},
+		{State: types.StatusStreamingChat, Active: 1},
+		{State: types.StatusIdle},
+		{State: types.StatusRunningCommand, Active: 1},
+		{State: types.StatusError, Message: "no such file"},
+	}
+	messages, err := client.Wait("llmsp/status", len(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != len(want) {
+		t.Fatalf("got %d status notifications, want %d", len(messages), len(want))
+	}
+	for i, message := range messages {
+		var status types.StatusParams
+		client.Decode(message, &status)
+		if status != want[i] {
+			t.Errorf("status %d == %+v, want %+v", i, status, want[i])
+		}
+	}
+}
+
+func TestStatusPriority(t *testing.T) {
+	// The tracker notifies the client through the connection of the server,
+	// which handlers receive
+	var conn *jsonrpc2.Conn
+	client := lsptest.NewClient(t, jsonrpc2.HandlerWithError(func(_ context.Context, c *jsonrpc2.Conn, _ *jsonrpc2.Request) (any, error) {
+		conn = c
+		return nil, nil
+	}))
+	if err := client.Call(context.Background(), "connect", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	status := newServerStatus()
+
+	endCompletion := status.Begin(conn, types.StatusFetchingCompletion)
+	endChat := status.Begin(conn, types.StatusStreamingChat)
+	// The chat takes precedence until it ends
+	endCompletion(nil)
+	endChat(context.Canceled)
+
+	want := []types.StatusParams{
+		{State: types.StatusFetchingCompletion, Active: 1},
+		{State: types.StatusStreamingChat, Active: 2},
+		{State: types.StatusStreamingChat, Active: 1},
+		// Canceled operations didn't fail
+		{State: types.StatusIdle},
+	}
+	messages, err := client.Wait("llmsp/status", len(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, message := range messages {
+		var got types.StatusParams
+		client.Decode(message, &got)
+		if i < len(want) && got != want[i] {
+			t.Errorf("status %d == %+v, want %+v", i, got, want[i])
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package lsp
+
+import (
+	"context"
+	"time"
+
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// shutdownTimeout is how long Close waits for background tasks to return.
+const shutdownTimeout = 5 * time.Second
+
+// tasksBackground lists the tasks running in the background, for debugging
+// operations that seem stuck.
+func (s *server) tasksBackground(context.Context, *jsonrpc2.Conn, *jsonrpc2.Request, any) (any, error) {
+	return s.tasks.List(), nil
+}
+
+// Close stops the server once its client has gone away: requests and
+// background tasks are cancelled, and the idle timer is stopped. It waits a
+// few seconds for the background tasks to return.
+func (s *server) Close() {
+	s.idle.Stop()
+	s.router.CancelAll()
+	// Tasks that ignore their context keep running, they are still listed
+	if !s.tasks.Close(shutdownTimeout) {
+		s.Logger.Warn("background tasks still running after shutdown", "tasks", len(s.tasks.List()))
+	}
+}
@@ -0,0 +1,223 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pjlast/llmsp/internal/secrets"
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// Trace values, as sent in InitializeParams.trace and $/setTrace.
+const (
+	traceOff int32 = iota
+	traceMessages
+	traceVerbose
+)
+
+// traceQueueSize is the number of $/logTrace notifications that can be
+// waiting to be sent. Traces are dropped while the queue is full.
+const traceQueueSize = 1024
+
+// parseTrace converts a trace value into one of the trace constants. Unknown
+// values turn tracing off.
+func parseTrace(value string) int32 {
+	switch value {
+	case "messages":
+		return traceMessages
+	case "verbose":
+		return traceVerbose
+	}
+	return traceOff
+}
+
+// setTraceParams are the parameters of a $/setTrace notification.
+type setTraceParams struct {
+	Value string `json:"value"`
+}
+
+// tracer turns the messages exchanged with the client into $/logTrace
+// notifications. The notifications are sent from a background task, as
+// messages can't be sent while the connection is sending another message.
+type tracer struct {
+	once  sync.Once
+	queue chan types.LogTraceParams
+
+	mu sync.Mutex
+	// received contains the methods and arrival times of the requests
+	// received from the client, by ID
+	received map[jsonrpc2.ID]receivedRequest
+	// sent contains the methods of the requests sent to the client, by ID
+	sent map[jsonrpc2.ID]string
+}
+
+type receivedRequest struct {
+	method string
+	time   time.Time
+}
+
+func newTracer() *tracer {
+	return &tracer{
+		queue:    make(chan types.LogTraceParams, traceQueueSize),
+		received: make(map[jsonrpc2.ID]receivedRequest),
+		sent:     make(map[jsonrpc2.ID]string),
+	}
+}
+
+// ConnOpts returns the options to create the server's connections with, so
+// that the messages sent and received on them can be traced.
+func (s *server) ConnOpts() []jsonrpc2.ConnOpt {
+	return []jsonrpc2.ConnOpt{
+		jsonrpc2.OnRecv(s.traceRecv),
+		jsonrpc2.OnSend(s.traceSend),
+	}
+}
+
+// setTrace handles $/setTrace notifications.
+func (s *server) setTrace(_ context.Context, _ *jsonrpc2.Conn, _ *jsonrpc2.Request, params setTraceParams) (any, error) {
+	s.setTraceValue(params.Value)
+	return nil, nil
+}
+
+// setTraceValue changes the trace level.
+func (s *server) setTraceValue(value string) {
+	s.trace.Store(parseTrace(value))
+}
+
+// traceRecv traces a message received from the client.
+func (s *server) traceRecv(req *jsonrpc2.Request, resp *jsonrpc2.Response) {
+	level := s.trace.Load()
+	switch {
+	case req != nil && resp == nil:
+		// Requests are remembered even if tracing is off, as tracing may be
+		// turned on before they are answered
+		if !req.Notif {
+			s.tracer.mu.Lock()
+			s.tracer.received[req.ID] = receivedRequest{method: req.Method, time: time.Now()}
+			s.tracer.mu.Unlock()
+		}
+		if level == traceOff {
+			return
+		}
+		if req.Notif {
+			s.logTrace(level, fmt.Sprintf("Received notification '%s'.", req.Method), "Params", requestParams(req))
+		} else {
+			s.logTrace(level, fmt.Sprintf("Received request '%s - (%s)'.", req.Method, req.ID), "Params", requestParams(req))
+		}
+
+	case resp != nil:
+		s.tracer.mu.Lock()
+		method := s.tracer.sent[resp.ID]
+		delete(s.tracer.sent, resp.ID)
+		s.tracer.mu.Unlock()
+		if level == traceOff {
+			return
+		}
+		s.logTrace(level, fmt.Sprintf("Received response '%s - (%s)'.", method, resp.ID), "Result", responseBody(resp))
+	}
+}
+
+// traceSend traces a message sent to the client.
+func (s *server) traceSend(req *jsonrpc2.Request, resp *jsonrpc2.Response) {
+	level := s.trace.Load()
+	switch {
+	case req != nil:
+		// Tracing the traces would never end
+		if req.Method == "$/logTrace" {
+			return
+		}
+		if !req.Notif {
+			s.tracer.mu.Lock()
+			s.tracer.sent[req.ID] = req.Method
+			s.tracer.mu.Unlock()
+		}
+		if level == traceOff {
+			return
+		}
+		if req.Notif {
+			s.logTrace(level, fmt.Sprintf("Sending notification '%s'.", req.Method), "Params", requestParams(req))
+		} else {
+			s.logTrace(level, fmt.Sprintf("Sending request '%s - (%s)'.", req.Method, req.ID), "Params", requestParams(req))
+		}
+
+	case resp != nil:
+		s.tracer.mu.Lock()
+		received := s.tracer.received[resp.ID]
+		delete(s.tracer.received, resp.ID)
+		s.tracer.mu.Unlock()
+		if level == traceOff {
+			return
+		}
+		message := fmt.Sprintf("Sending response '%s - (%s)'. Processing request took %dms", received.method, resp.ID, time.Since(received.time).Milliseconds())
+		s.logTrace(level, message, "Result", responseBody(resp))
+	}
+}
+
+// requestParams returns the parameters of a request, or nil if there are
+// none.
+func requestParams(req *jsonrpc2.Request) any {
+	if req.Params == nil {
+		return nil
+	}
+	return req.Params
+}
+
+// responseBody returns the result or error of a response, or nil if there
+// is neither.
+func responseBody(resp *jsonrpc2.Response) any {
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if resp.Result == nil {
+		return nil
+	}
+	return resp.Result
+}
+
+// logTrace queues a $/logTrace notification. In verbose mode, the body of the
+// message is included under the given label.
+func (s *server) logTrace(level int32, message, label string, body any) {
+	params := types.LogTraceParams{Message: message}
+	if level == traceVerbose {
+		if _, ok := body.(*jsonrpc2.Error); ok {
+			label = "Error"
+		}
+		if raw, ok := body.(*json.RawMessage); ok {
+			// Settings carry the access token
+			redacted := secrets.RedactJSON(*raw)
+			body = &redacted
+		}
+		data, err := json.MarshalIndent(body, "", "  ")
+		if err != nil || body == nil {
+			params.Verbose = fmt.Sprintf("No %s provided.", label)
+		} else {
+			params.Verbose = secrets.Redact(fmt.Sprintf("%s: %s", label, data))
+		}
+	}
+
+	s.tracer.once.Do(func() {
+		s.tasks.Go("send traces", s.sendTraces)
+	})
+	select {
+	case s.tracer.queue <- params:
+	default:
+	}
+}
+
+// sendTraces sends queued traces to the client until ctx is cancelled.
+func (s *server) sendTraces(ctx context.Context) {
+	for {
+		select {
+		case params := <-s.tracer.queue:
+			if conn := s.conn.Load(); conn != nil {
+				_ = conn.Notify(ctx, "$/logTrace", params)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
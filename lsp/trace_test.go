@@ -0,0 +1,66 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func TestTrace(t *testing.T) {
+	ctx := context.Background()
+	s := NewServer("", "")
+	defer s.Close()
+
+	traces := make(chan types.LogTraceParams, 10)
+	client := jsonrpc2.HandlerWithError(func(_ context.Context, _ *jsonrpc2.Conn, req *jsonrpc2.Request) (any, error) {
+		if req.Method == "$/logTrace" {
+			var params types.LogTraceParams
+			if err := json.Unmarshal(*req.Params, &params); err != nil {
+				t.Error(err)
+			}
+			traces <- params
+		}
+		return nil, nil
+	})
+
+	a, b := net.Pipe()
+	serverConn := jsonrpc2.NewConn(ctx, jsonrpc2.NewBufferedStream(a, jsonrpc2.VSCodeObjectCodec{}), s, s.ConnOpts()...)
+	defer serverConn.Close()
+	clientConn := jsonrpc2.NewConn(ctx, jsonrpc2.NewBufferedStream(b, jsonrpc2.VSCodeObjectCodec{}), client)
+	defer clientConn.Close()
+
+	// Nothing is traced while tracing is off
+	if err := clientConn.Call(ctx, "llmsp/tasks/background", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := clientConn.Notify(ctx, "$/setTrace", setTraceParams{Value: "verbose"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := clientConn.Call(ctx, "llmsp/tasks/background", nil, nil, jsonrpc2.PickID(jsonrpc2.ID{Num: 7})); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"Received request 'llmsp/tasks/background - (7)'.",
+		"Sending response 'llmsp/tasks/background - (7)'.",
+	}
+	for _, prefix := range want {
+		select {
+		case trace := <-traces:
+			if !strings.HasPrefix(trace.Message, prefix) {
+				t.Errorf("got trace %q, want %q", trace.Message, prefix)
+			}
+			if trace.Verbose == "" {
+				t.Errorf("trace %q has no verbose message", trace.Message)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no trace received, want %q", prefix)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package lsp
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/pjlast/llmsp/internal/documents"
+	"github.com/pjlast/llmsp/internal/language"
+	"github.com/pjlast/llmsp/internal/lexer"
+	"github.com/pjlast/llmsp/internal/position"
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/go-lsp"
+)
+
+const (
+	// completionTriggerTyping asks the LLM for every completion request, as
+	// the editor sends them while typing
+	completionTriggerTyping = "typing"
+	// completionTriggerManual only asks the LLM for completions invoked
+	// explicitly, or after a trigger character
+	completionTriggerManual = "manual"
+)
+
+const (
+	// completionSkipComments skips completions in comments
+	completionSkipComments = "comments"
+	// completionSkipStrings skips completions in string literals
+	completionSkipStrings = "strings"
+)
+
+// ctkTriggerForIncompleteCompletions is the trigger kind of the requests
+// re-sent while typing after an incomplete completion list, which go-lsp
+// doesn't define.
+const ctkTriggerForIncompleteCompletions lsp.CompletionTriggerKind = 3
+
+// defaultTriggerCharacters are the completion trigger characters announced
+// to the editor if the settings don't have any.
+var defaultTriggerCharacters = []string{".", "("}
+
+// completionTriggers decides which completion requests are answered by the
+// LLM, depending on how the editor triggered them.
+type completionTriggers struct {
+	mu         sync.Mutex
+	manual     bool
+	characters []string
+	// skip are the kinds of text where completions aren't requested
+	skip map[lexer.Kind]bool
+}
+
+func newCompletionTriggers() *completionTriggers {
+	return &completionTriggers{characters: defaultTriggerCharacters}
+}
+
+// Configure sets the trigger mode, completionTriggerTyping if it is empty,
+// the trigger characters, the default ones if there are none, and where
+// completions are skipped. Unknown values of skip are ignored.
+func (c *completionTriggers) Configure(mode string, characters, skip []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.manual = mode == completionTriggerManual
+	c.characters = defaultTriggerCharacters
+	if len(characters) > 0 {
+		c.characters = characters
+	}
+	c.skip = make(map[lexer.Kind]bool)
+	for _, s := range skip {
+		switch s {
+		case completionSkipComments:
+			c.skip[lexer.Comment] = true
+		case completionSkipStrings:
+			c.skip[lexer.String] = true
+		}
+	}
+}
+
+// Characters returns the trigger characters.
+func (c *completionTriggers) Characters() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.characters...)
+}
+
+// Triggered reports whether the completion request must be answered by the
+// LLM. In manual mode, only requests invoked explicitly and requests right
+// after a trigger character are. The character before the cursor is checked
+// on the line, as editors only report the characters they were told about
+// when the server was initialized.
+func (c *completionTriggers) Triggered(params types.CompletionParams, line string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.manual {
+		return true
+	}
+
+	switch params.Context.TriggerKind {
+	// Editors that don't send the context don't say how completion was
+	// triggered, their requests are answered as before
+	case 0, lsp.CTKInvoked:
+		return true
+	case lsp.CTKTriggerCharacter, ctkTriggerForIncompleteCompletions:
+		before := line[:position.Offset(line, lsp.Position{Character: params.Position.Character})]
+		for _, character := range c.characters {
+			if character != "" && strings.HasSuffix(before, character) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Skipped reports whether the completion request is skipped because the
+// cursor is in a comment or string where completions aren't wanted.
+// Completions invoked explicitly are never skipped.
+func (c *completionTriggers) Skipped(params types.CompletionParams, doc documents.Document) bool {
+	c.mu.Lock()
+	skip := c.skip
+	c.mu.Unlock()
+	if len(skip) == 0 || params.Context.TriggerKind == lsp.CTKInvoked {
+		return false
+	}
+
+	lang := language.Detect(string(doc.URI), doc.Text)
+	return skip[lexer.At(lang, doc.Text, position.Offset(doc.Text, params.Position))]
+}
@@ -0,0 +1,103 @@
+package lsp
+
+import (
+	"testing"
+
+	"github.com/pjlast/llmsp/internal/documents"
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/go-lsp"
+)
+
+func completionParams(kind lsp.CompletionTriggerKind, character string, pos int) types.CompletionParams {
+	var params types.CompletionParams
+	params.Context = lsp.CompletionContext{TriggerKind: kind, TriggerCharacter: character}
+	params.Position = lsp.Position{Character: pos}
+	return params
+}
+
+func TestCompletionTriggers(t *testing.T) {
+	line := "\tfmt.Println(nöme.x"
+	tests := []struct {
+		name   string
+		params types.CompletionParams
+		want   bool
+	}{
+		{"invoked", completionParams(lsp.CTKInvoked, "", 8), true},
+		{"no context", completionParams(0, "", 8), true},
+		{"trigger character", completionParams(lsp.CTKTriggerCharacter, ".", 5), true},
+		{"other character", completionParams(lsp.CTKTriggerCharacter, "P", 6), false},
+		{"typing after a trigger", completionParams(ctkTriggerForIncompleteCompletions, "", 13), true},
+		{"typing a word", completionParams(ctkTriggerForIncompleteCompletions, "", 10), false},
+		// Positions count UTF-16 code units, not the 2 bytes of ö
+		{"after a multibyte character", completionParams(ctkTriggerForIncompleteCompletions, "", 18), true},
+	}
+
+	triggers := newCompletionTriggers()
+	for _, test := range tests {
+		if !triggers.Triggered(test.params, line) {
+			t.Errorf("%s: not triggered while typing, want every request answered", test.name)
+		}
+	}
+
+	triggers.Configure(completionTriggerManual, nil, nil)
+	for _, test := range tests {
+		if got := triggers.Triggered(test.params, line); got != test.want {
+			t.Errorf("%s: Triggered() == %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	triggers.Configure(completionTriggerManual, []string{"("}, nil)
+	if triggers.Triggered(completionParams(lsp.CTKTriggerCharacter, ".", 5), line) {
+		t.Error("triggered by a character that isn't configured")
+	}
+	if got := triggers.Characters(); len(got) != 1 || got[0] != "(" {
+		t.Errorf("Characters() == %q, want the configured ones", got)
+	}
+}
+
+func TestCompletionSkip(t *testing.T) {
+	doc := documents.Document{
+		URI:  "file:///main.go",
+		Text: "package main\n\n// Greet says hello\nfunc Greet() string {\n\treturn \"hello\"\n}\n",
+	}
+	comment := completionParams(ctkTriggerForIncompleteCompletions, "", 10)
+	comment.Position.Line = 2
+	str := completionParams(ctkTriggerForIncompleteCompletions, "", 11)
+	str.Position.Line = 4
+	code := completionParams(ctkTriggerForIncompleteCompletions, "", 7)
+	code.Position.Line = 4
+
+	triggers := newCompletionTriggers()
+	for _, params := range []types.CompletionParams{comment, str, code} {
+		if triggers.Skipped(params, doc) {
+			t.Errorf("skipped completion at %+v, want nothing skipped by default", params.Position)
+		}
+	}
+
+	triggers.Configure("", nil, []string{completionSkipComments, completionSkipStrings})
+	tests := []struct {
+		name   string
+		params types.CompletionParams
+		want   bool
+	}{
+		{"comment", comment, true},
+		{"string", str, true},
+		{"code", code, false},
+	}
+	for _, test := range tests {
+		if got := triggers.Skipped(test.params, doc); got != test.want {
+			t.Errorf("%s: Skipped() == %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	// Completions invoked explicitly are answered anywhere
+	comment.Context.TriggerKind = lsp.CTKInvoked
+	if triggers.Skipped(comment, doc) {
+		t.Error("skipped an invoked completion")
+	}
+
+	triggers.Configure("", nil, []string{completionSkipStrings})
+	if triggers.Skipped(tests[0].params, doc) {
+		t.Error("skipped a completion in a comment, want only strings skipped")
+	}
+}
@@ -4,8 +4,16 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
 	"os"
+	"time"
 
+	"github.com/pjlast/llmsp/internal/headless"
+	"github.com/pjlast/llmsp/internal/logging"
+	"github.com/pjlast/llmsp/internal/metrics"
+	"github.com/pjlast/llmsp/internal/secrets"
 	"github.com/pjlast/llmsp/lsp"
 	"github.com/sourcegraph/jsonrpc2"
 )
@@ -32,33 +40,74 @@ const (
 	urlUsage = "LLM provider URL"
 
 	tokenFlag  = "token"
-	tokenUsage = "LLM provider token"
+	tokenUsage = "LLM provider token (defaults to $SRC_ACCESS_TOKEN)"
 
 	debugFlag  = "debug"
-	debugUsage = "Debug mode"
+	debugUsage = "Debug mode, log at debug level to the log file"
+
+	logFileFlag  = "log-file"
+	logFileUsage = "Write logs to this file, rotating it once it grows large (defaults to the user cache directory in debug mode)"
 
 	stdioFlag  = "stdio"
 	stdioUsage = "Stdio mode"
 
 	autoCompleteFlag  = "auto-complete"
 	autoCompleteUsage = "Enable auto-completion (off, init, always)"
+
+	listenFlag  = "listen"
+	listenUsage = "Listen for clients on this TCP address instead of using stdio"
+
+	idleTimeoutFlag  = "idle-timeout"
+	idleTimeoutUsage = "Drop caches and close connections after being idle for this long (0 disables)"
+
+	exitOnIdleFlag  = "exit-on-idle"
+	exitOnIdleUsage = "Exit after being idle for the idle timeout, for editors that respawn the server"
+
+	gracePeriodFlag  = "grace-period"
+	gracePeriodUsage = "How long to keep the state of disconnected clients in socket mode"
+
+	metricsAddrFlag  = "metrics-addr"
+	metricsAddrUsage = "Serve Prometheus metrics on this address, e.g. localhost:9090, at /metrics"
 )
 
 func main() {
 	var (
-		url   string
-		token string
-		// debug        bool
+		url          string
+		token        string
+		debug        bool
+		logFile      string
 		autoComplete string
+		listen       string
+		gracePeriod  time.Duration
+		idleTimeout  time.Duration
+		exitOnIdle   bool
+		metricsAddr  string
 	)
 
 	flag.StringVar(&url, urlFlag, "", urlUsage)
 	flag.StringVar(&token, tokenFlag, "", tokenUsage)
-	// debug = *flag.Bool(debugFlag, false, debugUsage)
+	flag.BoolVar(&debug, debugFlag, false, debugUsage)
+	flag.StringVar(&logFile, logFileFlag, "", logFileUsage)
 	flag.StringVar(&autoComplete, autoCompleteFlag, "", autoCompleteUsage)
+	flag.StringVar(&listen, listenFlag, "", listenUsage)
+	flag.DurationVar(&gracePeriod, gracePeriodFlag, lsp.DefaultGracePeriod, gracePeriodUsage)
+	flag.DurationVar(&idleTimeout, idleTimeoutFlag, 0, idleTimeoutUsage)
+	flag.BoolVar(&exitOnIdle, exitOnIdleFlag, false, exitOnIdleUsage)
+	flag.StringVar(&metricsAddr, metricsAddrFlag, "", metricsAddrUsage)
 	_ = *flag.Bool(stdioFlag, true, stdioUsage) // Some editors pass it so we need to not error on it
 	flag.Parse()
 
+	if token == "" {
+		token = os.Getenv(secrets.EnvAccessToken)
+	}
+
+	switch flag.Arg(0) {
+	case "exec":
+		os.Exit(runExec(url, token))
+	case "bench":
+		os.Exit(runBench(url, token, flag.Args()[1:]))
+	}
+
 	if autoComplete == "" {
 		autoComplete = "off"
 	}
@@ -71,8 +120,127 @@ func main() {
 		os.Exit(1)
 	}
 
+	logLevel := logging.LevelInfo
+	if debug {
+		logLevel = logging.LevelDebug
+		if logFile == "" {
+			logFile = lsp.DefaultLogFile()
+		}
+	}
+
+	if metricsAddr != "" {
+		// Stdout may be used for the protocol, so errors go to stderr
+		if err := serveMetrics(metricsAddr); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	if listen != "" {
+		var logOutput io.Writer
+		if logFile != "" {
+			file, err := logging.OpenRotatingFile(logFile, logging.DefaultMaxSize, logging.DefaultMaxBackups)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			defer file.Close()
+			logOutput = file
+		}
+		serveSocket(listen, url, token, autoComplete, gracePeriod, idleTimeout, logOutput, logLevel)
+		return
+	}
+
 	server := lsp.NewServer(url, token)
 	server.AutoComplete = autoComplete
+	server.Logger.SetLevel(logLevel)
+	if logFile != "" {
+		// Stdout is used for the protocol, so errors go to stderr
+		if err := server.SetLogFile(logFile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+	var exit func()
+	if exitOnIdle {
+		exit = func() { os.Exit(0) }
+	}
+	server.SetIdleTimeout(idleTimeout, exit)
+	server.Exit = os.Exit
 
-	<-jsonrpc2.NewConn(context.Background(), jsonrpc2.NewBufferedStream(stdrwc{}, jsonrpc2.VSCodeObjectCodec{}), jsonrpc2.AsyncHandler(server)).DisconnectNotify()
+	<-jsonrpc2.NewConn(context.Background(), jsonrpc2.NewBufferedStream(stdrwc{}, jsonrpc2.VSCodeObjectCodec{}), server, server.ConnOpts()...).DisconnectNotify()
+	server.Close()
+}
+
+// serveMetrics serves the metrics of the process at /metrics on the given
+// address, in the background.
+func serveMetrics(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Default.Handler())
+	go http.Serve(lis, mux)
+	return nil
+}
+
+// serveSocket accepts clients on the given address. Clients that reconnect
+// within the grace period resume their previous session. Idle sessions only
+// release their resources, the server keeps running for other clients.
+func serveSocket(addr, url, token, autoComplete string, gracePeriod, idleTimeout time.Duration, logOutput io.Writer, logLevel logging.Level) {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	sessions := lsp.NewSessionManager(url, token)
+	sessions.AutoComplete = autoComplete
+	sessions.GracePeriod = gracePeriod
+	sessions.IdleTimeout = idleTimeout
+	sessions.LogOutput = logOutput
+	sessions.LogLevel = logLevel
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		go sessions.Serve(context.Background(), jsonrpc2.NewBufferedStream(conn, jsonrpc2.VSCodeObjectCodec{}))
+	}
+}
+
+// runExec runs the command read from stdin without an editor, see the
+// headless package, and writes its result to stdout. It returns the exit
+// code.
+func runExec(url, token string) int {
+	req, err := headless.ReadRequest(os.Stdin)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	root, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	// The URL is sent as a setting rather than a flag, so that the provider
+	// is set up from the settings as it is for editors
+	var settings map[string]any
+	if url != "" {
+		settings = map[string]any{"url": url}
+	}
+	server := lsp.NewServer("", token)
+	defer server.Close()
+	result, err := headless.Run(context.Background(), server, root, req, settings, os.Stderr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := result.Write(os.Stdout, req.Format); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
 }
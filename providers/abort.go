@@ -0,0 +1,68 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// errAborted is the cause of the cancellation of aborted generations.
+var errAborted = errors.New("generation aborted")
+
+// aborted reports whether ctx was canceled by cody.chat/abort, in which case
+// what was generated so far is the answer.
+func aborted(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), errAborted)
+}
+
+// generations tracks the answers being generated, so that they can be
+// aborted by their progress token or chat session.
+type generations struct {
+	mu      sync.Mutex
+	next    int
+	running map[int]generation
+}
+
+type generation struct {
+	token, session string
+	cancel         context.CancelCauseFunc
+}
+
+// start registers a generation reported on the progress token, in the chat
+// session. It returns the context of the generation, which is canceled
+// when it is aborted, and a function to call once it is done.
+func (g *generations) start(ctx context.Context, token, session string) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.running == nil {
+		g.running = make(map[int]generation)
+	}
+	id := g.next
+	g.next++
+	g.running[id] = generation{token: token, session: session, cancel: cancel}
+
+	return ctx, func() {
+		g.mu.Lock()
+		delete(g.running, id)
+		g.mu.Unlock()
+		cancel(nil)
+	}
+}
+
+// abort aborts the generations reported on the progress token or in the
+// chat session with the ID, or all of them if it is empty. It returns the
+// number of generations aborted.
+func (g *generations) abort(id string) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var n int
+	for _, gen := range g.running {
+		if id == "" || gen.token == id || gen.session == id {
+			gen.cancel(errAborted)
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,82 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pjlast/llmsp/claude"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func TestGenerationsAbort(t *testing.T) {
+	var g generations
+	chat, doneChat := g.start(context.Background(), "token-1", "session-1")
+	defer doneChat()
+	explain, doneExplain := g.start(context.Background(), "token-2", "session-1")
+	defer doneExplain()
+	other, doneOther := g.start(context.Background(), "token-3", "session-2")
+
+	if n := g.abort("token-1"); n != 1 || !aborted(chat) || explain.Err() != nil {
+		t.Errorf("aborting token-1 aborted %d generations, want only the chat", n)
+	}
+	if n := g.abort("session-1"); n != 2 || !aborted(explain) || other.Err() != nil {
+		t.Errorf("aborting session-1 aborted %d generations, want its two generations", n)
+	}
+
+	// Generations that are done can't be aborted, and aren't aborted when
+	// their context is canceled
+	doneOther()
+	if n := g.abort(""); n != 2 || aborted(other) {
+		t.Errorf("aborting everything aborted %d generations, want the two of session-1 again", n)
+	}
+}
+
+func TestAbortStreamChat(t *testing.T) {
+	canceled := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "event: completion\ndata: {\"completion\": %q}\n\n", "Use a loop")
+		w.(http.Flusher).Flush()
+		// The generation runs away until the request is canceled
+		<-r.Context().Done()
+		close(canceled)
+	}))
+	defer server.Close()
+
+	l := &SourcegraphLLM{
+		ClaudeClient: claude.NewClient(server.URL, "", server.Client()),
+		features:     featuresOf("5.0.6"),
+	}
+	ctx, done := l.generations.start(context.Background(), "token", "")
+	defer done()
+
+	// The user stops the generation once its start is reported
+	client := jsonrpc2.HandlerWithError(func(context.Context, *jsonrpc2.Conn, *jsonrpc2.Request) (any, error) {
+		l.generations.abort("token")
+		return nil, nil
+	})
+	a, b := net.Pipe()
+	serverConn := jsonrpc2.NewConn(context.Background(), jsonrpc2.NewBufferedStream(a, jsonrpc2.VSCodeObjectCodec{}), nil)
+	defer serverConn.Close()
+	clientConn := jsonrpc2.NewConn(context.Background(), jsonrpc2.NewBufferedStream(b, jsonrpc2.VSCodeObjectCodec{}), client)
+	defer clientConn.Close()
+
+	messages := []claude.Message{{Speaker: claude.Human, Text: "How do I sum a slice?"}, {Speaker: claude.Assistant}}
+	response, err := l.streamChat(ctx, serverConn, "token", messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response != "Use a loop" {
+		t.Errorf("streamChat() == %q, want the response until it was aborted", response)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Error("the completion request wasn't canceled")
+	}
+}
@@ -0,0 +1,163 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/go-lsp"
+)
+
+// maxSuggestedCompletions is the number of suggested completions remembered
+// until they are accepted.
+const maxSuggestedCompletions = 50
+
+// acceptCompletionCommand is executed by the client when a completion is
+// accepted.
+const acceptCompletionCommand = "cody.completion/accepted"
+
+// completionData is the data of completion items, which clients send back to
+// resolve them.
+type completionData struct {
+	ID string `json:"id"`
+}
+
+// suggestedCompletion is a completion that was suggested to the client.
+type suggestedCompletion struct {
+	ID       string
+	URI      lsp.DocumentURI
+	Line     int
+	Text     string
+	Accepted bool
+}
+
+// completionStats counts the completions that were suggested and accepted.
+type completionStats struct {
+	mu          sync.Mutex
+	completions []suggestedCompletion
+	suggested   int
+	accepted    int
+}
+
+// Suggest records a suggested completion and returns its ID.
+func (s *completionStats) Suggest(uri lsp.DocumentURI, line int, text string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := uuid.New().String()
+	s.completions = append(s.completions, suggestedCompletion{ID: id, URI: uri, Line: line, Text: text})
+	if len(s.completions) > maxSuggestedCompletions {
+		s.completions = s.completions[len(s.completions)-maxSuggestedCompletions:]
+	}
+	s.suggested++
+	return id
+}
+
+// Get returns the suggested completion with the given ID.
+func (s *completionStats) Get(id string) (suggestedCompletion, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, completion := range s.completions {
+		if completion.ID == id {
+			return completion, true
+		}
+	}
+	return suggestedCompletion{}, false
+}
+
+// Accept marks the completion with the given ID as accepted. Completions are
+// only counted once.
+func (s *completionStats) Accept(id string) (suggestedCompletion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, completion := range s.completions {
+		if completion.ID != id {
+			continue
+		}
+		if !completion.Accepted {
+			s.completions[i].Accepted = true
+			s.accepted++
+		}
+		return s.completions[i], nil
+	}
+	return suggestedCompletion{}, fmt.Errorf("unknown completion %q", id)
+}
+
+// Rate returns the number of suggested and accepted completions, and the
+// share of suggested completions that were accepted.
+func (s *completionStats) Rate() (int, int, float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.suggested == 0 {
+		return 0, s.accepted, 0
+	}
+	return s.suggested, s.accepted, float64(s.accepted) / float64(s.suggested)
+}
+
+// completionItem returns the completion item suggesting text on the line of
+// the document. The item is resolved lazily, see ResolveCompletion. Items are
+// filtered by the first line of the edit, which starts with the word being
+// typed, and clients without text edit support insert its text.
+func (l *SourcegraphLLM) completionItem(uri lsp.DocumentURI, line int, label string, textEdit *lsp.TextEdit) types.CompletionItem {
+	id := l.completionStats.Suggest(uri, line, textEdit.NewText)
+	if l.EventLogger != nil {
+		l.EventLogger.Log("CodyNeovimExtension:completion:suggested")
+	}
+	filterText, _, _ := strings.Cut(textEdit.NewText, "\n")
+	return types.CompletionItem{
+		Label:      label,
+		Kind:       lsp.CIKSnippet,
+		FilterText: filterText,
+		InsertText: textEdit.NewText,
+		TextEdit:   textEdit,
+		Data:       completionData{ID: id},
+		Command: &lsp.Command{
+			Title:     "Accept completion",
+			Command:   acceptCompletionCommand,
+			Arguments: []any{id},
+		},
+	}
+}
+
+// ResolveCompletion fills in the details of a completion item.
+func (l *SourcegraphLLM) ResolveCompletion(_ context.Context, item types.CompletionItem) (types.CompletionItem, error) {
+	data, err := json.Marshal(item.Data)
+	if err != nil {
+		return item, err
+	}
+	var completionData completionData
+	if err := json.Unmarshal(data, &completionData); err != nil {
+		return item, err
+	}
+	completion, ok := l.completionStats.Get(completionData.ID)
+	if !ok {
+		return item, nil
+	}
+
+	lines := strings.Count(completion.Text, "\n") + 1
+	item.Detail = "Cody, 1 line"
+	if lines > 1 {
+		item.Detail = fmt.Sprintf("Cody, %d lines", lines)
+	}
+	item.Documentation = completion.Text
+	return item, nil
+}
+
+// acceptCompletion records that a completion was accepted.
+func (l *SourcegraphLLM) acceptCompletion(id string) error {
+	if _, err := l.completionStats.Accept(id); err != nil {
+		return err
+	}
+	suggested, accepted, rate := l.completionStats.Rate()
+	if l.EventLogger != nil {
+		l.EventLogger.LogWithArgument("CodyNeovimExtension:completion:accepted", map[string]any{
+			"suggested":      suggested,
+			"accepted":       accepted,
+			"acceptanceRate": rate,
+		})
+	}
+	return nil
+}
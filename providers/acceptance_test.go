@@ -0,0 +1,47 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/go-lsp"
+)
+
+func TestCompletionAcceptance(t *testing.T) {
+	l := &SourcegraphLLM{}
+	uri := lsp.DocumentURI("file:///main.go")
+	first := l.completionItem(uri, 1, "return nil", &lsp.TextEdit{NewText: "\treturn nil"})
+	second := l.completionItem(uri, 4, "if err != nil {", &lsp.TextEdit{NewText: "\tif err != nil {\n\t\treturn err\n\t}"})
+
+	// Clients send the item back as JSON
+	data, err := json.Marshal(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var item types.CompletionItem
+	if err := json.Unmarshal(data, &item); err != nil {
+		t.Fatal(err)
+	}
+	resolved, err := l.ResolveCompletion(context.Background(), item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved.Detail != "Cody, 3 lines" || resolved.Documentation != second.TextEdit.NewText {
+		t.Errorf("ResolveCompletion() == %q, %q, want the details of the completion", resolved.Detail, resolved.Documentation)
+	}
+
+	id := first.Command.Arguments[0].(string)
+	for i := 0; i < 2; i++ {
+		if err := l.acceptCompletion(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if suggested, accepted, rate := l.completionStats.Rate(); suggested != 2 || accepted != 1 || rate != 0.5 {
+		t.Errorf("Rate() == %d, %d, %v, want 2, 1, 0.5", suggested, accepted, rate)
+	}
+	if err := l.acceptCompletion("unknown"); err == nil {
+		t.Error("acceptCompletion(\"unknown\") succeeded, want an error")
+	}
+}
@@ -0,0 +1,101 @@
+package providers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// commandArguments describes the arguments of the commands, one letter per
+// argument: "s" for a string, "n" for a number, "b" for a boolean and "o" for
+// an object such as a range. Arguments after a "?" are optional. Commands
+// that aren't listed decode their arguments themselves.
+var commandArguments = map[string]string{
+	"suggest":                "snn",
+	"docstring":              "snn",
+	"todos":                  "snn",
+	"answer":                 "snn",
+	"cody.fix":               "snns",
+	"cody.test":              "snn",
+	"cody.completeLine":      "sn?n",
+	"cody.completeFunction":  "sn?n",
+	"cody":                   "snnsbb",
+	"cody.edit":              "sos",
+	"cody.edit/accept":       "s",
+	"cody.edit/reject":       "s",
+	"cody.plan":              "snns?b",
+	"cody.explain":           "snns?b",
+	"cody.translate":         "snns",
+	"cody.suggestions/clear": "?s",
+	"cody.explainSelection":  "snn?b",
+	"cody.remember":          "snn",
+	"cody.memory/delete":     "n",
+	"cody.memory/pin":        "n?b",
+	"cody.chat/new":          "?s",
+	"cody.chat/retry":        "?s",
+	"cody.chat/abort":        "?s",
+	"cody.chat/switch":       "s",
+	"cody.chat/delete":       "s",
+	"cody.chat/export":       "?ss",
+	"cody.chat/message":      "ss",
+	"cody.repo/ask":          "s",
+	"cody.shell":             "s",
+	"cody.explainOutput":     "s?b",
+	acceptCompletionCommand:  "s",
+	"cody.feedback":          "s?ss",
+	"cody.explainErrors":     "s",
+}
+
+// argumentKinds names the kinds of arguments in errors.
+var argumentKinds = map[byte]string{
+	's': "a string",
+	'n': "a number",
+	'b': "a boolean",
+	'o': "an object",
+}
+
+// validateArguments checks the arguments of the command against
+// commandArguments, so that a command sent with missing or mistyped
+// arguments, e.g. by a hook, fails instead of crashing the server. The
+// arguments are normalized first.
+func validateArguments(command string, arguments []any) ([]any, error) {
+	spec, ok := commandArguments[command]
+	if !ok {
+		return arguments, nil
+	}
+	data, err := json.Marshal(arguments)
+	if err != nil {
+		return nil, err
+	}
+	arguments = nil
+	if err := json.Unmarshal(data, &arguments); err != nil {
+		return nil, err
+	}
+
+	required, optional, _ := strings.Cut(spec, "?")
+	if len(arguments) < len(required) {
+		return nil, fmt.Errorf("%s takes %d arguments, got %d", command, len(required), len(arguments))
+	}
+	kinds := required + optional
+	for i, argument := range arguments {
+		if i >= len(kinds) {
+			break
+		}
+		var ok bool
+		switch kinds[i] {
+		case 's':
+			_, ok = argument.(string)
+		case 'n':
+			_, ok = argument.(float64)
+		case 'b':
+			_, ok = argument.(bool)
+		case 'o':
+			_, ok = argument.(map[string]any)
+		}
+		if !ok {
+			return nil, fmt.Errorf("argument %d of %s must be %s, got %T", i+1, command, argumentKinds[kinds[i]], argument)
+		}
+	}
+
+	return arguments, nil
+}
@@ -0,0 +1,36 @@
+package providers
+
+import (
+	"testing"
+)
+
+func TestValidateArguments(t *testing.T) {
+	tests := []struct {
+		command   string
+		arguments []any
+		wantErr   bool
+	}{
+		{"cody.edit", []any{"file:///main.go"}, true},
+		{"cody.edit", []any{"file:///main.go", map[string]any{"start": map[string]any{"line": 0}}, "Rename x"}, false},
+		{"docstring", []any{"file:///main.go", 1, 3}, false},
+		{"docstring", []any{"file:///main.go", "1", 3}, true},
+		{"cody.fix", []any{"file:///main.go", 1, 3}, true},
+		{"cody.completeLine", []any{"file:///main.go", 1}, false},
+		{"cody.completeLine", []any{"file:///main.go", 1, true}, true},
+		{"cody.feedback", []any{true}, true},
+		{"cody.suggestions/clear", nil, false},
+		{"cody.todos/workspace", []any{map[string]any{"line": 1}}, false},
+	}
+	for _, test := range tests {
+		arguments, err := validateArguments(test.command, test.arguments)
+		if (err != nil) != test.wantErr {
+			t.Errorf("validateArguments(%q, %v) error == %v, want an error: %v", test.command, test.arguments, err, test.wantErr)
+			continue
+		}
+		if test.command == "docstring" && err == nil {
+			if _, ok := arguments[1].(float64); !ok {
+				t.Errorf("validateArguments(%q, %v) == %v, want normalized numbers", test.command, test.arguments, arguments)
+			}
+		}
+	}
+}
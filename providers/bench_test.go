@@ -0,0 +1,56 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/pjlast/llmsp/bench"
+	"github.com/pjlast/llmsp/claude"
+	"github.com/pjlast/llmsp/internal/documents"
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/go-lsp"
+)
+
+// BenchmarkAddContext measures prompt assembly for chat and edit requests.
+func BenchmarkAddContext(b *testing.B) {
+	for _, size := range bench.FileSizes {
+		b.Run(fmt.Sprintf("lines=%d", size), func(b *testing.B) {
+			file := bench.GoFile(size)
+			l := &SourcegraphLLM{
+				Documents: documents.FromMap(types.MemoryFileMap{"file:///bench/handlers.go": file}),
+				InteractionMemory: []claude.Message{
+					{Speaker: claude.Human, Text: "Explain Handler1"},
+					{Speaker: claude.Assistant, Text: bench.GoFile(50)},
+				},
+			}
+			input := []claude.Message{{Speaker: claude.Human, Text: "Add logging to Handler1"}}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				l.AddContext(context.Background(), editModel, input, "file:///bench/handlers.go", file)
+			}
+		})
+	}
+}
+
+// BenchmarkGetMessages measures prompt assembly for completions, which
+// include all open files.
+func BenchmarkGetMessages(b *testing.B) {
+	for _, size := range bench.FileSizes {
+		b.Run(fmt.Sprintf("lines=%d", size), func(b *testing.B) {
+			fileMap := types.MemoryFileMap{}
+			for i := 0; i < 5; i++ {
+				fileMap[lsp.DocumentURI(fmt.Sprintf("file:///bench/handlers%d.go", i))] = bench.GoFile(size)
+			}
+			l := &SourcegraphLLM{Documents: documents.FromMap(fileMap)}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				l.getMessages("file:///bench/handlers0.go", "handle request", nil)
+			}
+		})
+	}
+}
@@ -0,0 +1,244 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pjlast/llmsp/claude"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// streamChat streams the completion for messages, reporting the partial
+// response as $/progress notifications on progressToken as it arrives. It
+// returns the complete response once the stream has finished, or the
+// response so far if the generation is aborted.
+func (l *SourcegraphLLM) streamChat(ctx context.Context, conn *jsonrpc2.Conn, progressToken string, messages []claude.Message) (string, error) {
+	return l.streamChatParameters(ctx, conn, progressToken, l.completionParameters(chatModel, messages))
+}
+
+// streamChatParameters is streamChat with the parameters of the completion.
+func (l *SourcegraphLLM) streamChatParameters(ctx context.Context, conn *jsonrpc2.Conn, progressToken string, params *claude.CompletionParameters) (string, error) {
+	stream, err := l.streamCompletion(ctx, params, false)
+	if err != nil {
+		if aborted(ctx) {
+			return "", nil
+		}
+		return "", err
+	}
+	defer stream.Close()
+
+	var response string
+	for partial := range stream.C {
+		response = partial
+		reportProgress(ctx, conn, progressToken, strings.TrimSpace(partial), 0)
+	}
+	if err := stream.Err(); err != nil && !aborted(ctx) {
+		return "", err
+	}
+
+	return response, nil
+}
+
+// ChatSession is a single chat conversation with its own interaction memory.
+type ChatSession struct {
+	ID                string           `json:"id"`
+	Title             string           `json:"title"`
+	CreatedAt         time.Time        `json:"createdAt"`
+	InteractionMemory []claude.Message `json:"interactionMemory"`
+	// Pinned are the indices of the pinned messages of the interaction
+	// memory.
+	Pinned []int `json:"pinned,omitempty"`
+}
+
+// chatSessionSummary describes a chat session to the client.
+type chatSessionSummary struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	CreatedAt time.Time `json:"createdAt"`
+	Messages  int       `json:"messages"`
+	Active    bool      `json:"active"`
+}
+
+const maxSessionTitleLength = 50
+
+// syncSession stores the current interaction memory in the active session.
+// The caller must hold l.Mu.
+func (l *SourcegraphLLM) syncSession() {
+	session, ok := l.Sessions[l.ActiveSession]
+	if !ok {
+		return
+	}
+	session.InteractionMemory = l.InteractionMemory
+	session.Pinned = pinnedIndices(l.InteractionMemory)
+	if session.Title == "" {
+		for _, message := range l.InteractionMemory {
+			if message.Speaker == claude.Human {
+				session.Title = sessionTitle(message.Text)
+				break
+			}
+		}
+	}
+}
+
+// sessionTitle derives a session title from the first line of a message.
+func sessionTitle(text string) string {
+	title := strings.TrimSpace(strings.SplitN(strings.TrimSpace(text), "\n", 2)[0])
+	if runes := []rune(title); len(runes) > maxSessionTitleLength {
+		title = string(runes[:maxSessionTitleLength-3]) + "..."
+	}
+	return title
+}
+
+func (l *SourcegraphLLM) summarizeSession(session *ChatSession) chatSessionSummary {
+	return chatSessionSummary{
+		ID:        session.ID,
+		Title:     session.Title,
+		CreatedAt: session.CreatedAt,
+		Messages:  len(session.InteractionMemory),
+		Active:    session.ID == l.ActiveSession,
+	}
+}
+
+// NewSession creates a new, empty chat session and makes it the active one.
+func (l *SourcegraphLLM) NewSession(title string) chatSessionSummary {
+	l.Mu.Lock()
+	defer l.Mu.Unlock()
+
+	return l.newSession(title)
+}
+
+// newSession is NewSession without locking. The caller must hold l.Mu.
+func (l *SourcegraphLLM) newSession(title string) chatSessionSummary {
+	l.syncSession()
+	if l.Sessions == nil {
+		l.Sessions = make(map[string]*ChatSession)
+	}
+
+	session := &ChatSession{
+		ID:        uuid.New().String(),
+		Title:     title,
+		CreatedAt: time.Now(),
+	}
+	l.Sessions[session.ID] = session
+	l.ActiveSession = session.ID
+	l.InteractionMemory = nil
+
+	return l.summarizeSession(session)
+}
+
+// ListSessions returns all chat sessions, oldest first.
+func (l *SourcegraphLLM) ListSessions() []chatSessionSummary {
+	l.Mu.Lock()
+	defer l.Mu.Unlock()
+	l.syncSession()
+
+	summaries := make([]chatSessionSummary, 0, len(l.Sessions))
+	for _, session := range l.Sessions {
+		summaries = append(summaries, l.summarizeSession(session))
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].CreatedAt.Before(summaries[j].CreatedAt)
+	})
+
+	return summaries
+}
+
+// SwitchSession makes the session with the given ID the active one.
+func (l *SourcegraphLLM) SwitchSession(id string) (chatSessionSummary, error) {
+	l.Mu.Lock()
+	defer l.Mu.Unlock()
+
+	session, ok := l.Sessions[id]
+	if !ok {
+		return chatSessionSummary{}, fmt.Errorf("unknown chat session %q", id)
+	}
+	l.syncSession()
+	l.ActiveSession = session.ID
+	l.InteractionMemory = session.memory()
+
+	return l.summarizeSession(session), nil
+}
+
+// DeleteSession deletes the session with the given ID. If it is the active
+// session, the most recently created remaining session becomes active, or a
+// new session is created if none remain.
+func (l *SourcegraphLLM) DeleteSession(id string) error {
+	l.Mu.Lock()
+	defer l.Mu.Unlock()
+
+	if _, ok := l.Sessions[id]; !ok {
+		return fmt.Errorf("unknown chat session %q", id)
+	}
+	delete(l.Sessions, id)
+	if id != l.ActiveSession {
+		return nil
+	}
+
+	l.ActiveSession = ""
+	var latest *ChatSession
+	for _, session := range l.Sessions {
+		if latest == nil || session.CreatedAt.After(latest.CreatedAt) {
+			latest = session
+		}
+	}
+	if latest == nil {
+		l.newSession("")
+		return nil
+	}
+	l.ActiveSession = latest.ID
+	l.InteractionMemory = latest.memory()
+
+	return nil
+}
+
+// ExportSession renders the session with the given ID as Markdown. If id is
+// empty, the active session is exported.
+func (l *SourcegraphLLM) ExportSession(id string) (string, error) {
+	l.Mu.Lock()
+	defer l.Mu.Unlock()
+	l.syncSession()
+
+	if id == "" {
+		id = l.ActiveSession
+	}
+	session, ok := l.Sessions[id]
+	if !ok {
+		return "", fmt.Errorf("unknown chat session %q", id)
+	}
+
+	return sessionMarkdown(session), nil
+}
+
+// exportPath resolves the path a session is exported to. Relative paths are
+// relative to the first workspace folder. Since commands can be sent by
+// hooks, sessions are only exported into the workspace folders or the data
+// directory, and symbolic links are followed before checking.
+func (l *SourcegraphLLM) exportPath(path string) (string, error) {
+	roots := l.workspaceFolderPaths()
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(roots[0], path)
+	}
+	path = filepath.Clean(path)
+	if dir, err := dataDir(); err == nil {
+		roots = append(roots, dir)
+	}
+
+	// The file may not exist yet, but its directory must
+	dir, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if err != nil {
+		return "", err
+	}
+	target := filepath.Join(dir, filepath.Base(path))
+	if resolved, err := filepath.EvalSymlinks(target); err == nil {
+		target = resolved
+	}
+	if !withinAny(roots, target) {
+		return "", fmt.Errorf("cannot export to %s, which is outside the workspace folders and the data directory", path)
+	}
+	return target, nil
+}
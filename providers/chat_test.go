@@ -0,0 +1,112 @@
+package providers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pjlast/llmsp/claude"
+	"github.com/pjlast/llmsp/internal/replay"
+	"github.com/sourcegraph/go-lsp"
+)
+
+func TestChatSessions(t *testing.T) {
+	l := &SourcegraphLLM{}
+	first := l.NewSession("")
+	l.InteractionMemory = append(l.InteractionMemory,
+		claude.Message{Speaker: claude.Human, Text: "How do I reverse a slice?\nIn Go."},
+		claude.Message{Speaker: claude.Assistant, Text: "Use slices.Reverse."})
+
+	second := l.NewSession("Other")
+	if len(l.InteractionMemory) != 0 {
+		t.Fatalf("new session should start with empty memory, got %d messages", len(l.InteractionMemory))
+	}
+
+	sessions := l.ListSessions()
+	if len(sessions) != 2 {
+		t.Fatalf("got %d sessions, want 2", len(sessions))
+	}
+	if sessions[0].Title != "How do I reverse a slice?" || sessions[0].Messages != 2 || sessions[0].Active {
+		t.Errorf("unexpected first session %+v", sessions[0])
+	}
+	if sessions[1].ID != second.ID || !sessions[1].Active {
+		t.Errorf("unexpected second session %+v", sessions[1])
+	}
+
+	if _, err := l.SwitchSession(first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if len(l.InteractionMemory) != 2 {
+		t.Errorf("switching should restore memory, got %d messages", len(l.InteractionMemory))
+	}
+
+	if err := l.DeleteSession(first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if l.ActiveSession != second.ID {
+		t.Errorf("active session == %q, want %q", l.ActiveSession, second.ID)
+	}
+	if _, err := l.SwitchSession(first.ID); err == nil {
+		t.Error("expected an error switching to a deleted session")
+	}
+}
+
+func TestStreamChatReplay(t *testing.T) {
+	url, token, client := replay.Client(t, "chat_stream")
+	l := &SourcegraphLLM{
+		ClaudeClient: claude.NewClient(url, token, client),
+		features:     featuresOf("5.0.6"),
+	}
+	messages := []claude.Message{
+		{Speaker: claude.Human, Text: "How do I reverse a slice in Go?"},
+		{Speaker: claude.Assistant},
+	}
+	response, err := l.streamChat(context.Background(), nil, "", messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Use slices.Reverse from the standard library."; response != want {
+		t.Errorf("streamChat() == %q, want the last recorded event %q", response, want)
+	}
+}
+
+func TestExportPath(t *testing.T) {
+	dir := t.TempDir()
+	root, outside, data := filepath.Join(dir, "workspace"), filepath.Join(dir, "outside"), filepath.Join(dir, "data")
+	for _, d := range []string{root, outside, filepath.Join(data, "llmsp")} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("XDG_DATA_HOME", data)
+	l := &SourcegraphLLM{WorkspaceFolders: []lsp.DocumentURI{lsp.DocumentURI("file://" + root)}}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"chat.md", filepath.Join(root, "chat.md")},
+		{filepath.Join(data, "llmsp", "chat.md"), filepath.Join(data, "llmsp", "chat.md")},
+		{filepath.Join(outside, "chat.md"), ""},
+		{"../outside/chat.md", ""},
+		{"escape/chat.md", ""},
+		{filepath.Join(root, "missing", "chat.md"), ""},
+	}
+	for _, test := range tests {
+		got, err := l.exportPath(test.path)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("exportPath(%q) == %q, want an error", test.path, got)
+			}
+			continue
+		}
+		// The temporary directory may itself be behind a symbolic link
+		if want, _ := filepath.EvalSymlinks(filepath.Dir(test.want)); err != nil || got != filepath.Join(want, filepath.Base(test.want)) {
+			t.Errorf("exportPath(%q) == %q, %v, want %q", test.path, got, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pjlast/llmsp/internal/position"
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/go-lsp"
+)
+
+// Code action kinds used by the provider.
+const (
+	kindQuickFix        lsp.CodeActionKind = "quickfix"
+	kindRefactor        lsp.CodeActionKind = "refactor"
+	kindRefactorRewrite lsp.CodeActionKind = "refactor.rewrite"
+	kindSource          lsp.CodeActionKind = "source"
+)
+
+// CodeActionKinds are the code action kinds the provider can return.
+var CodeActionKinds = []lsp.CodeActionKind{kindQuickFix, kindRefactor, kindRefactorRewrite, kindSource}
+
+// newCodeAction creates a code action that runs command. If resolvable is
+// set, the action's edit can be computed up front with codeAction/resolve
+// instead of running the command.
+func newCodeAction(title string, kind lsp.CodeActionKind, command string, arguments []any, resolvable bool) types.CodeAction {
+	action := types.CodeAction{
+		Title: title,
+		Kind:  kind,
+		Command: &lsp.Command{
+			Title:     title,
+			Command:   command,
+			Arguments: arguments,
+		},
+	}
+	if resolvable {
+		action.Data = &types.CodeActionData{
+			Command:   command,
+			Arguments: arguments,
+		}
+	}
+
+	return action
+}
+
+func (l *SourcegraphLLM) GetCodeActions(doc lsp.DocumentURI, selection lsp.Range) []types.CodeAction {
+	cp := commentPrefix(l.documentLanguage(doc))
+	arguments := []any{doc, selection.Start.Line, selection.End.Line}
+	actions := []types.CodeAction{
+		newCodeAction("Provide suggestions", kindSource, "suggest", arguments, false),
+		newCodeAction("Generate docstring", kindRefactorRewrite, "docstring", arguments, true),
+		newCodeAction("Cody: Generate unit tests", kindSource, "cody.test", arguments, true),
+		newCodeAction("Cody: Explain selection", kindSource, "cody.explainSelection", arguments, false),
+		newCodeAction("Cody: Remember this", kindSource, "cody.remember", arguments, false),
+	}
+	if len(l.memorySnapshot()) > 0 {
+		actions = append(actions, newCodeAction("Cody: Forget", kindSource, "cody.forget", nil, false))
+	}
+	selected := getFileSnippet(l.Documents.Text(doc), selection.Start.Line, selection.End.Line)
+	if strings.Contains(selected, fmt.Sprintf("%s TODO", cp)) {
+		actions = append(actions, newCodeAction("Implement TODOs", kindRefactorRewrite, "todos", arguments, true))
+	}
+	if strings.Contains(selected, fmt.Sprintf("%s ASK", cp)) {
+		actions = append(actions, newCodeAction("Answer question", kindRefactorRewrite, "answer", arguments, true))
+	}
+	return actions
+}
+
+// ResolveCodeAction computes the edit of a resolvable code action.
+func (l *SourcegraphLLM) ResolveCodeAction(ctx context.Context, action types.CodeAction) (types.CodeAction, error) {
+	if action.Data == nil {
+		return action, nil
+	}
+
+	ctx, cancel := l.withTimeout(l.withSnapshot(ctx), action.Data.Command)
+	defer cancel()
+
+	edit, err := l.commandEdit(ctx, action.Data.Command, action.Data.Arguments)
+	if err != nil {
+		return action, err
+	}
+	versioned, err := l.versionEdit(*edit, snapshotVersions(ctx))
+	if err != nil {
+		return action, err
+	}
+	action.Edit = &versioned
+	action.Command = nil
+
+	return action, nil
+}
+
+// commandEdit computes the workspace edit made by an edit command.
+func (l *SourcegraphLLM) commandEdit(ctx context.Context, command string, arguments []any) (*types.WorkspaceEdit, error) {
+	arguments, err := normalizeArguments(arguments)
+	if err != nil {
+		return nil, err
+	}
+	filename := lsp.DocumentURI(arguments[0].(string))
+	startLine := int(arguments[1].(float64))
+	endLine := int(arguments[2].(float64))
+	if command == "docstring" || command == "cody.test" {
+		// Document and test whole declarations
+		startLine, endLine = l.symbolRange(filename, startLine, endLine)
+	}
+	funcSnippet, err := l.documentLines(filename, startLine, endLine)
+	if err != nil {
+		return nil, err
+	}
+	contents := l.snapshotText(ctx, filename)
+
+	var newText string
+	switch command {
+	case "docstring":
+		newText, err = l.documentFunction(ctx, string(filename), funcSnippet, startLine, endLine)
+
+	case "todos":
+		newText, err = l.implementTODOs(ctx, string(filename), contents, funcSnippet)
+
+	case "answer":
+		newText, err = l.answerQuestions(ctx, string(filename), contents, funcSnippet)
+
+	case "cody.fix":
+		newText, err = l.fixDiagnostic(ctx, string(filename), contents, startLine, endLine, arguments[3].(string))
+
+	case "cody.test":
+		edit, err := l.generateTests(ctx, filename, funcSnippet, startLine, endLine)
+		if err != nil {
+			return nil, err
+		}
+		if err := l.validateGoEdit(edit); err != nil {
+			return nil, err
+		}
+		return edit, nil
+
+	default:
+		return nil, fmt.Errorf("command %q does not produce an edit", command)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	edit := lineRangeEdit(filename, contents, startLine, endLine, newText)
+	if err := l.validateGoEdit(edit); err != nil {
+		return nil, err
+	}
+
+	return edit, nil
+}
+
+// normalizeArguments round-trips arguments through JSON, so that arguments
+// constructed by the server have the same types as those sent by a client.
+func normalizeArguments(arguments []any) ([]any, error) {
+	data, err := json.Marshal(arguments)
+	if err != nil {
+		return nil, err
+	}
+	var normalized []any
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return nil, err
+	}
+	if len(normalized) < 3 {
+		return nil, fmt.Errorf("expected a document URI, start line and end line")
+	}
+
+	return normalized, nil
+}
+
+// lineRangeEdit returns a workspace edit replacing lines startLine through
+// endLine of the document with newText.
+func lineRangeEdit(uri lsp.DocumentURI, contents string, startLine, endLine int, newText string) *types.WorkspaceEdit {
+	return &types.WorkspaceEdit{
+		DocumentChanges: []any{
+			types.TextDocumentEdit{
+				TextDocument: lsp.VersionedTextDocumentIdentifier{
+					TextDocumentIdentifier: lsp.TextDocumentIdentifier{
+						URI: uri,
+					},
+					Version: 0,
+				},
+				Edits: []lsp.TextEdit{
+					{
+						Range: lsp.Range{
+							Start: lsp.Position{
+								Line:      startLine,
+								Character: 0,
+							},
+							End: position.LineEnd(contents, endLine),
+						},
+						NewText: newText,
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,58 @@
+package providers
+
+import (
+	"testing"
+
+	"github.com/pjlast/llmsp/internal/documents"
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/go-lsp"
+)
+
+func TestGetCodeActions(t *testing.T) {
+	l := &SourcegraphLLM{
+		Documents: documents.FromMap(types.MemoryFileMap{
+			"file:///src/foo.go": "package foo\n\n// TODO: implement\nfunc Foo() {}\n",
+		}),
+	}
+	actions := l.GetCodeActions("file:///src/foo.go", lsp.Range{End: lsp.Position{Line: 3}})
+
+	resolvable := map[string]bool{}
+	for _, action := range actions {
+		if action.Command == nil {
+			t.Fatalf("code action %q has no command", action.Title)
+		}
+		if action.Kind == "" {
+			t.Errorf("code action %q has no kind", action.Title)
+		}
+		resolvable[action.Command.Command] = action.Data != nil
+	}
+
+	for command, want := range map[string]bool{"suggest": false, "docstring": true, "cody.test": true, "cody.explainSelection": false, "todos": true} {
+		got, ok := resolvable[command]
+		if !ok {
+			t.Errorf("missing code action for %q", command)
+		} else if got != want {
+			t.Errorf("code action for %q resolvable == %v, want %v", command, got, want)
+		}
+	}
+	if _, ok := resolvable["answer"]; ok {
+		t.Error("unexpected code action for \"answer\"")
+	}
+}
+
+func TestNormalizeArguments(t *testing.T) {
+	arguments, err := normalizeArguments([]any{lsp.DocumentURI("file:///foo.go"), 1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := arguments[0].(string); !ok {
+		t.Errorf("arguments[0] is %T, want string", arguments[0])
+	}
+	if _, ok := arguments[1].(float64); !ok {
+		t.Errorf("arguments[1] is %T, want float64", arguments[1])
+	}
+
+	if _, err := normalizeArguments([]any{"file:///foo.go"}); err == nil {
+		t.Error("expected an error for missing line arguments")
+	}
+}
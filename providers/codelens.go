@@ -0,0 +1,122 @@
+package providers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pjlast/llmsp/internal/documents"
+	"github.com/pjlast/llmsp/internal/position"
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/go-lsp"
+)
+
+// codeLensCommands are the commands offered above every function, in order.
+var codeLensCommands = []struct {
+	title, command string
+}{
+	{"Explain", "cody.explainSelection"},
+	{"Generate tests", "cody.test"},
+	{"Document", "docstring"},
+}
+
+// GetCodeLenses returns the code lenses of the functions of the document.
+// Their commands are only constructed when they are resolved, see
+// ResolveCodeLens.
+func (l *SourcegraphLLM) GetCodeLenses(uri lsp.DocumentURI) []types.CodeLens {
+	doc, ok := l.Documents.Get(uri)
+	if !ok {
+		return nil
+	}
+
+	lenses := []types.CodeLens{}
+	for _, line := range functionLines(doc) {
+		for _, c := range codeLensCommands {
+			lenses = append(lenses, types.CodeLens{
+				Range: lsp.Range{
+					Start: lsp.Position{Line: line},
+					End:   lsp.Position{Line: line, Character: position.Len(doc.Line(line))},
+				},
+				Data: &types.CodeLensData{Command: c.command, URI: uri, Line: line},
+			})
+		}
+	}
+	return lenses
+}
+
+// ResolveCodeLens constructs the command of a code lens, for the whole
+// function whose header is on the line of the lens.
+func (l *SourcegraphLLM) ResolveCodeLens(lens types.CodeLens) (types.CodeLens, error) {
+	if lens.Data == nil {
+		return lens, nil
+	}
+	title := ""
+	for _, c := range codeLensCommands {
+		if c.command == lens.Data.Command {
+			title = c.title
+		}
+	}
+	if title == "" {
+		return lens, fmt.Errorf("unknown code lens command %q", lens.Data.Command)
+	}
+	doc, ok := l.Documents.Get(lens.Data.URI)
+	if !ok || lens.Data.Line >= doc.LineCount() {
+		return lens, fmt.Errorf("%s: the document was closed or changed", lens.Data.URI)
+	}
+
+	start, end := lens.Data.Line, functionEnd(doc, lens.Data.Line)
+	if parseDocument(doc) != nil {
+		start, end = l.symbolRange(lens.Data.URI, start, start)
+	}
+	lens.Command = &lsp.Command{
+		Title:     title,
+		Command:   lens.Data.Command,
+		Arguments: []any{lens.Data.URI, start, end},
+	}
+	return lens, nil
+}
+
+// functionLines returns the lines of the headers of the functions of the
+// document. Functions are found with the syntax tree of the document if it is
+// known, and by their header otherwise.
+func functionLines(doc documents.Document) []int {
+	var lines []int
+	if f := parseDocument(doc); f != nil {
+		for _, symbol := range f.Symbols() {
+			if symbol.Func {
+				lines = append(lines, symbol.Line)
+			}
+		}
+		return lines
+	}
+
+	for i := 0; i < doc.LineCount(); i++ {
+		text := doc.Line(i)
+		if functionHeader.MatchString(text) && !statement.MatchString(text) {
+			lines = append(lines, i)
+		}
+	}
+	return lines
+}
+
+// functionEnd returns the last line of the function whose header is on the
+// given line: the last line before the code indented like the header, or the
+// line closing the function, like "}" or "end".
+func functionEnd(doc documents.Document, header int) int {
+	indentation := indentOf(doc.Line(header))
+	end := header
+	for i := header + 1; i < doc.LineCount(); i++ {
+		text := doc.Line(i)
+		trimmed := strings.TrimSpace(text)
+		if trimmed == "" {
+			continue
+		}
+		if indentOf(text) <= indentation {
+			if strings.HasPrefix(trimmed, "}") || strings.HasPrefix(trimmed, ")") || trimmed == "end" {
+				return i
+			}
+			return end
+		}
+		end = i
+	}
+	return end
+}
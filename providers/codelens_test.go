@@ -0,0 +1,62 @@
+package providers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pjlast/llmsp/internal/documents"
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/go-lsp"
+)
+
+func TestCodeLenses(t *testing.T) {
+	l := &SourcegraphLLM{
+		Documents: documents.FromMap(types.MemoryFileMap{
+			"file:///src/add.go": "package add\n\ntype Adder struct{}\n\n// Add adds.\nfunc (Adder) Add(a, b int) int {\n\treturn a + b\n}\n",
+			"file:///src/add.py": "import math\n\nclass Adder:\n    def add(self, a, b):\n        if a:\n            return a + b\n        return b\n\n    def sub(self, a, b):\n        return a - b\n",
+		}),
+	}
+
+	tests := []struct {
+		uri       lsp.DocumentURI
+		wantLines []int
+		// wantRange is the range of lines the commands of the first
+		// function apply to
+		wantRange []any
+	}{
+		{"file:///src/add.go", []int{5}, []any{lsp.DocumentURI("file:///src/add.go"), 5, 7}},
+		{"file:///src/add.py", []int{3, 8}, []any{lsp.DocumentURI("file:///src/add.py"), 3, 6}},
+	}
+	for _, test := range tests {
+		lenses := l.GetCodeLenses(test.uri)
+		var lines []int
+		for i, lens := range lenses {
+			if lens.Command != nil {
+				t.Errorf("%s: code lens %d has a command before it is resolved", test.uri, i)
+			}
+			if i%len(codeLensCommands) == 0 {
+				lines = append(lines, lens.Range.Start.Line)
+			}
+		}
+		if !reflect.DeepEqual(lines, test.wantLines) {
+			t.Errorf("%s: got code lenses on lines %v, want %v", test.uri, lines, test.wantLines)
+			continue
+		}
+
+		resolved, err := l.ResolveCodeLens(lenses[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resolved.Command == nil || resolved.Command.Command != "cody.test" || !reflect.DeepEqual(resolved.Command.Arguments, test.wantRange) {
+			t.Errorf("%s: got command %+v, want cody.test with %v", test.uri, resolved.Command, test.wantRange)
+		}
+	}
+}
+
+func TestResolveCodeLensClosedDocument(t *testing.T) {
+	l := &SourcegraphLLM{Documents: documents.FromMap(types.MemoryFileMap{})}
+	lens := types.CodeLens{Data: &types.CodeLensData{Command: "docstring", URI: "file:///closed.go", Line: 1}}
+	if _, err := l.ResolveCodeLens(lens); err == nil {
+		t.Error("expected an error for a closed document")
+	}
+}
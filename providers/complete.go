@@ -0,0 +1,297 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/pjlast/llmsp/claude"
+	"github.com/pjlast/llmsp/internal/position"
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/go-lsp"
+)
+
+// emptyFunction is a function without a body in a document.
+type emptyFunction struct {
+	// Header is the line the function is declared on
+	Header int
+	// End is the line the body ends before, i.e. the line of the closing
+	// brace, or the line following the body for indentation based languages
+	End int
+}
+
+// findEmptyFunction returns the empty function enclosing the given line. A
+// function is empty if its body only consists of blank lines, or of a pass
+// statement in Python.
+func findEmptyFunction(contents string, line int) (emptyFunction, bool) {
+	lines := strings.Split(contents, "\n")
+	if line < 0 || line >= len(lines) {
+		return emptyFunction{}, false
+	}
+
+	for header := line; header >= 0; header-- {
+		trimmed := strings.TrimSpace(lines[header])
+		switch {
+		case strings.HasSuffix(trimmed, "{"):
+			for end := header + 1; end < len(lines); end++ {
+				switch strings.TrimSpace(lines[end]) {
+				case "":
+					continue
+				case "}":
+					if end < line {
+						return emptyFunction{}, false
+					}
+					return emptyFunction{Header: header, End: end}, true
+				}
+				return emptyFunction{}, false
+			}
+			return emptyFunction{}, false
+
+		case strings.HasPrefix(trimmed, "def ") && strings.HasSuffix(trimmed, ":"):
+			indentation := len(lines[header]) - len(strings.TrimLeft(lines[header], " \t"))
+			end := header + 1
+			for ; end < len(lines); end++ {
+				body := strings.TrimSpace(lines[end])
+				if body != "" && len(lines[end])-len(strings.TrimLeft(lines[end], " \t")) <= indentation {
+					break
+				}
+				if body != "" && body != "pass" && body != "..." {
+					return emptyFunction{}, false
+				}
+			}
+			// Keep the blank lines separating the function from what follows
+			for end > header+1 && strings.TrimSpace(lines[end-1]) == "" {
+				end--
+			}
+			if end < line {
+				return emptyFunction{}, false
+			}
+			return emptyFunction{Header: header, End: end}, true
+
+		case header < line && trimmed != "":
+			// The body isn't empty
+			return emptyFunction{}, false
+		}
+	}
+
+	return emptyFunction{}, false
+}
+
+// trimCompletion removes what a completion repeats of the code following it:
+// trailing whitespace, and trailing lines that are the same as the lines
+// following the line of the cursor, such as closing braces or the statements
+// after the cursor. Lines are only removed if the rest of the completion
+// doesn't leave brackets open, as a completion opening a block also closes
+// it. The first line of the completion is always kept.
+func trimCompletion(completion string, following []string) string {
+	lines := strings.Split(completion, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\r")
+	}
+	var next []string
+	for _, line := range following {
+		if line = strings.TrimSpace(line); line != "" {
+			next = append(next, line)
+		}
+	}
+
+	for n := len(lines) - 1; n > 0; n-- {
+		if repeats(lines[len(lines)-n:], next) && bracketDepth(lines[:len(lines)-n]) <= 0 {
+			lines = lines[:len(lines)-n]
+			break
+		}
+	}
+	for len(lines) > 1 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// repeats reports whether the non-blank lines start the lines next, ignoring
+// indentation.
+func repeats(lines, next []string) bool {
+	i := 0
+	for _, line := range lines {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		if i >= len(next) || line != next[i] {
+			return false
+		}
+		i++
+	}
+	return i > 0
+}
+
+// bracketDepth returns the number of brackets the lines open, minus the
+// number they close.
+func bracketDepth(lines []string) int {
+	depth := 0
+	for _, line := range lines {
+		depth += strings.Count(line, "{") + strings.Count(line, "(") + strings.Count(line, "[")
+		depth -= strings.Count(line, "}") + strings.Count(line, ")") + strings.Count(line, "]")
+	}
+	return depth
+}
+
+// trimLineSuffix removes the end of the completion that is the same as the
+// start of suffix, the text following the cursor on its line, which is kept
+// after the completion when it is inserted. For example, completing
+// "fmt.Println(" before ")" with "fmt.Println(x)" inserts "fmt.Println(x".
+func trimLineSuffix(completion, suffix string) string {
+	suffix = strings.TrimSpace(suffix)
+	for n := len(suffix); n > 0; n-- {
+		if strings.HasSuffix(completion, suffix[:n]) {
+			return strings.TrimRight(completion[:len(completion)-n], " \t")
+		}
+	}
+	return completion
+}
+
+// singleLineMaxTokens is the maximum length, in tokens, of completions of a
+// single line.
+const singleLineMaxTokens = 64
+
+// completesBlock reports whether the completion at pos, a position on line,
+// may span several lines: on blank lines, and at the end of lines opening a
+// block, such as a function or an argument list.
+func completesBlock(line string, pos lsp.Position) bool {
+	offset := position.Offset(line, lsp.Position{Character: pos.Character})
+	prefix, suffix := strings.TrimSpace(line[:offset]), strings.TrimSpace(line[offset:])
+	if suffix != "" {
+		return false
+	}
+	return prefix == "" || strings.ContainsAny(prefix[len(prefix)-1:], "{([:")
+}
+
+// completionEdit returns the edit inserting the completion at pos, a position
+// on line, and the label of the completion item. The completion either
+// repeats the code typed on the line, or continues it. Its first line is
+// inserted at the cursor, without what it repeats of the line or of the text
+// following the cursor, and the other lines are indented like the line. The
+// edit replaces the word being typed, so that editors filtering items by it
+// keep the completion.
+func completionEdit(line string, pos lsp.Position, completion string) (lsp.TextEdit, string) {
+	offset := position.Offset(line, lsp.Position{Character: pos.Character})
+	prefix, suffix := line[:offset], line[offset:]
+	indentation := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+	typed := strings.TrimLeft(prefix, " \t")
+	word := prefix[len(strings.TrimRightFunc(prefix, isWordRune)):]
+
+	lines := strings.Split(completion, "\n")
+	switch first := strings.TrimLeft(lines[0], " \t"); {
+	case strings.HasPrefix(first, typed):
+		lines[0] = first[len(typed):]
+	case strings.HasPrefix(lines[0], word):
+		lines[0] = lines[0][len(word):]
+	}
+	for i := 1; i < len(lines); i++ {
+		// Blank lines aren't indented, so that they don't end with whitespace
+		if lines[i] != "" {
+			lines[i] = indentation + lines[i]
+		}
+	}
+	insert := trimLineSuffix(strings.Join(lines, "\n"), suffix)
+
+	label, _, _ := strings.Cut(typed+insert, "\n")
+	return lsp.TextEdit{
+		Range: lsp.Range{
+			Start: lsp.Position{Line: pos.Line, Character: pos.Character - position.Len(word)},
+			End:   pos,
+		},
+		NewText: word + insert,
+	}, label
+}
+
+// isWordRune reports whether r is part of identifiers.
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// completeLine completes the line at the given position of the document.
+func (l *SourcegraphLLM) completeLine(ctx context.Context, uri lsp.DocumentURI, pos lsp.Position) (*types.WorkspaceEdit, error) {
+	// Only the current line is completed
+	completion, err := l.completeCode(ctx, uri, pos.Line, false)
+	if err != nil {
+		return nil, err
+	}
+	// The position is relative to the text the command was sent for, which
+	// the user may have changed since
+	doc, _ := l.snapshotDocument(ctx, uri)
+	edit, _ := completionEdit(doc.Line(pos.Line), pos, completion)
+	l.recordCompletion(uri, pos.Line, edit.NewText)
+
+	return textEdit(uri, edit.Range, edit.NewText), nil
+}
+
+// completeFunction generates the body of the empty function enclosing the
+// given line of the document.
+func (l *SourcegraphLLM) completeFunction(ctx context.Context, uri lsp.DocumentURI, line int) (*types.WorkspaceEdit, error) {
+	contents := l.snapshotText(ctx, uri)
+	fn, ok := findEmptyFunction(contents, line)
+	if !ok {
+		return nil, fmt.Errorf("line %d is not inside an empty function", line+1)
+	}
+
+	lines := strings.Split(contents, "\n")
+	header := lines[fn.Header]
+	language := strings.ToLower(determineLanguage(string(uri)))
+	input := []claude.Message{
+		{
+			Speaker: claude.Human,
+			Text: fmt.Sprintf(`Implement the body of the following %s function. Return only the body of the function, without the function signature and without the closing brace.
+`+"```%s"+`
+%s
+`+"```", determineLanguage(string(uri)), language, header),
+		},
+		{
+			Speaker: claude.Assistant,
+			Text:    fmt.Sprintf("```%s\n", language),
+		},
+	}
+	params := l.completionParameters(completionModel, l.AddContext(ctx, completionModel, input, string(uri), contents))
+	completion, err := l.ClaudeClient.GetCompletion(ctx, params, true)
+	if err != nil {
+		return nil, err
+	}
+	body := extractCode(completion)
+	// Some models repeat the closing brace regardless
+	if bodyLines := strings.Split(body, "\n"); strings.TrimSpace(bodyLines[len(bodyLines)-1]) == "}" {
+		body = strings.Join(bodyLines[:len(bodyLines)-1], "\n")
+	}
+	l.recordCompletion(uri, fn.Header+1, body)
+
+	// The body replaces everything between the header and the end of the
+	// function
+	start, end := lsp.Position{Line: fn.Header + 1}, lsp.Position{Line: fn.End}
+	if fn.End == len(lines) {
+		// The function ends the document, so there is no line to end before
+		end = position.End(contents)
+		if fn.End == fn.Header+1 {
+			start = end
+			body = "\n" + body
+		}
+	} else {
+		body += "\n"
+	}
+	return textEdit(uri, lsp.Range{Start: start, End: end}, body), nil
+}
+
+// textEdit returns a workspace edit replacing the range of the document with
+// newText.
+func textEdit(uri lsp.DocumentURI, rng lsp.Range, newText string) *types.WorkspaceEdit {
+	return &types.WorkspaceEdit{
+		DocumentChanges: []any{
+			types.TextDocumentEdit{
+				TextDocument: lsp.VersionedTextDocumentIdentifier{
+					TextDocumentIdentifier: lsp.TextDocumentIdentifier{
+						URI: uri,
+					},
+					Version: 0,
+				},
+				Edits: []lsp.TextEdit{{Range: rng, NewText: newText}},
+			},
+		},
+	}
+}
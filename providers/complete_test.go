@@ -0,0 +1,340 @@
+package providers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pjlast/llmsp/claude"
+	"github.com/pjlast/llmsp/internal/documents"
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/go-lsp"
+)
+
+func TestFindEmptyFunction(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		line     int
+		want     emptyFunction
+		wantOK   bool
+	}{
+		{
+			name:     "go body",
+			contents: "package main\n\nfunc add(a, b int) int {\n\t\n}\n",
+			line:     3,
+			want:     emptyFunction{Header: 2, End: 4},
+			wantOK:   true,
+		},
+		{
+			name:     "go header",
+			contents: "func add(a, b int) int {\n}",
+			line:     0,
+			want:     emptyFunction{Header: 0, End: 1},
+			wantOK:   true,
+		},
+		{
+			name:     "go non-empty body",
+			contents: "func add(a, b int) int {\n\treturn a + b\n\n}",
+			line:     2,
+		},
+		{
+			name:     "python pass",
+			contents: "def add(a, b):\n    pass\n\n\ndef sub(a, b):\n    return a - b",
+			line:     1,
+			want:     emptyFunction{Header: 0, End: 2},
+			wantOK:   true,
+		},
+		{
+			name:     "python end of file",
+			contents: "def add(a, b):",
+			line:     0,
+			want:     emptyFunction{Header: 0, End: 1},
+			wantOK:   true,
+		},
+		{
+			name:     "python non-empty body",
+			contents: "def add(a, b):\n    return a + b",
+			line:     1,
+		},
+		{
+			name:     "outside a function",
+			contents: "package main\n\nvar x = 1",
+			line:     2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := findEmptyFunction(test.contents, test.line)
+			if ok != test.wantOK || got != test.want {
+				t.Errorf("findEmptyFunction() == %+v, %v, want %+v, %v", got, ok, test.want, test.wantOK)
+			}
+		})
+	}
+}
+
+func TestTrimCompletion(t *testing.T) {
+	tests := []struct {
+		name       string
+		completion string
+		following  []string
+		want       string
+	}{
+		{
+			name:       "closing brace",
+			completion: "return a + b\n}",
+			following:  []string{"}", "", "func sub() {"},
+			want:       "return a + b",
+		},
+		{
+			name:       "repeated statements",
+			completion: "x := 1\n\ty := 2\n\tz := 3",
+			following:  []string{"\ty := 2", "", "\tz := 3", "}"},
+			want:       "x := 1",
+		},
+		{
+			name:       "trailing whitespace",
+			completion: "x := 1  \n\n",
+			following:  []string{"}"},
+			want:       "x := 1",
+		},
+		{
+			name:       "new code",
+			completion: "if x {\n\treturn\n}",
+			following:  []string{"}"},
+			want:       "if x {\n\treturn\n}",
+		},
+		{
+			name:       "open call",
+			completion: "foo(\n\ta,\n)",
+			following:  []string{")"},
+			want:       "foo(\n\ta,\n)",
+		},
+		{
+			name:       "first line kept",
+			completion: "}",
+			following:  []string{"}"},
+			want:       "}",
+		},
+		{
+			name:       "end of document",
+			completion: "return a + b\n}",
+			following:  []string{""},
+			want:       "return a + b\n}",
+		},
+	}
+	for _, test := range tests {
+		if got := trimCompletion(test.completion, test.following); got != test.want {
+			t.Errorf("%s: trimCompletion() == %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestTrimLineSuffix(t *testing.T) {
+	tests := []struct {
+		completion, suffix, want string
+	}{
+		{"fmt.Println(x)", ")", "fmt.Println(x"},
+		{"fmt.Println(x)", ");", "fmt.Println(x"},
+		{"if x == nil {", " {", "if x == nil"},
+		{"fmt.Println(x)", "", "fmt.Println(x)"},
+		{"fmt.Println(x)", "// print", "fmt.Println(x)"},
+		{"return a\n}", ")", "return a\n}"},
+	}
+	for _, test := range tests {
+		if got := trimLineSuffix(test.completion, test.suffix); got != test.want {
+			t.Errorf("trimLineSuffix(%q, %q) == %q, want %q", test.completion, test.suffix, got, test.want)
+		}
+	}
+}
+
+func TestCompletionEdit(t *testing.T) {
+	tests := []struct {
+		name       string
+		line       string
+		character  int
+		completion string
+		want       lsp.TextEdit
+		wantLabel  string
+	}{
+		{
+			name:       "empty line",
+			line:       "\t",
+			character:  1,
+			completion: "return a + b",
+			want:       lsp.TextEdit{Range: completionRange(1, 1), NewText: "return a + b"},
+			wantLabel:  "return a + b",
+		},
+		{
+			name:       "repeated line",
+			line:       "\tfmt.Pr",
+			character:  7,
+			completion: "fmt.Println(x)",
+			want:       lsp.TextEdit{Range: completionRange(5, 7), NewText: "Println(x)"},
+			wantLabel:  "fmt.Println(x)",
+		},
+		{
+			name:       "continued word",
+			line:       "\tfmt.Pr",
+			character:  7,
+			completion: "Println(x)",
+			want:       lsp.TextEdit{Range: completionRange(5, 7), NewText: "Println(x)"},
+			wantLabel:  "fmt.Println(x)",
+		},
+		{
+			name:       "continued expression",
+			line:       "\treturn a",
+			character:  9,
+			completion: " + b",
+			want:       lsp.TextEdit{Range: completionRange(8, 9), NewText: "a + b"},
+			wantLabel:  "return a + b",
+		},
+		{
+			name:       "mid-line",
+			line:       "\tfmt.Println(na)",
+			character:  15,
+			completion: "fmt.Println(name)",
+			want:       lsp.TextEdit{Range: completionRange(13, 15), NewText: "name"},
+			wantLabel:  "fmt.Println(name",
+		},
+		{
+			name:       "multiple lines",
+			line:       "\tif err != nil {",
+			character:  16,
+			completion: "if err != nil {\n\treturn err\n\n}",
+			want:       lsp.TextEdit{Range: completionRange(16, 16), NewText: "\n\t\treturn err\n\n\t}"},
+			wantLabel:  "if err != nil {",
+		},
+		{
+			name:       "multibyte word",
+			line:       "\tnöm",
+			character:  4,
+			completion: "nömbre := 1",
+			want:       lsp.TextEdit{Range: completionRange(1, 4), NewText: "nömbre := 1"},
+			wantLabel:  "nömbre := 1",
+		},
+	}
+	for _, test := range tests {
+		got, label := completionEdit(test.line, lsp.Position{Line: 2, Character: test.character}, test.completion)
+		if got != test.want || label != test.wantLabel {
+			t.Errorf("%s: completionEdit() == %+v, %q, want %+v, %q", test.name, got, label, test.want, test.wantLabel)
+		}
+	}
+}
+
+// completionRange returns the range between the characters of line 2.
+func completionRange(start, end int) lsp.Range {
+	return lsp.Range{Start: lsp.Position{Line: 2, Character: start}, End: lsp.Position{Line: 2, Character: end}}
+}
+
+func TestCompletesBlock(t *testing.T) {
+	tests := []struct {
+		line      string
+		character int
+		want      bool
+	}{
+		{"\t", 1, true},
+		{"func add(a, b int) int {", 24, true},
+		{"\tfmt.Println(", 13, true},
+		{"\tfor _, x := range xs {", 10, false},
+		{"\tfmt.Pr", 7, false},
+		{"\tx := ", 6, false},
+		{"\t", 0, true},
+		{"\treturn x", 1, false},
+	}
+	for _, test := range tests {
+		if got := completesBlock(test.line, lsp.Position{Character: test.character}); got != test.want {
+			t.Errorf("completesBlock(%q, %d) == %v, want %v", test.line, test.character, got, test.want)
+		}
+	}
+}
+
+func TestCompleteCodeFence(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data": {"completions": "return a + b"}}`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		uri      lsp.DocumentURI
+		contents string
+		want     string
+	}{
+		{"file:///src/add.go", "package add\n\n", "```go\n"},
+		{"file:///src/add.py", "def add(a, b):\n    \n", "```python\n"},
+		// Scripts without an extension are detected from their shebang
+		{"file:///bin/add", "#!/usr/bin/env python3\ndef add(a, b):\n    \n", "```python\n"},
+	}
+	for _, test := range tests {
+		l := &SourcegraphLLM{
+			ClaudeClient: claude.NewClient(server.URL, "", server.Client()),
+			Documents:    documents.FromMap(types.MemoryFileMap{test.uri: test.contents}),
+		}
+		var prefill string
+		l.ClaudeClient.OnPrompt = func(ctx context.Context, params *claude.CompletionParameters) {
+			prefill = params.Messages[len(params.Messages)-1].Text
+		}
+		if _, err := l.completeCode(context.Background(), test.uri, 1, false); err != nil {
+			t.Fatal(err)
+		}
+		// The code block the answer starts must be of the document's language
+		if prefill != test.want {
+			t.Errorf("%s: the answer starts with %q, want %q", test.uri, prefill, test.want)
+		}
+	}
+}
+
+func TestCompleteLineError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "upstream unavailable", http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	uri := lsp.DocumentURI("file:///src/add.go")
+	l := &SourcegraphLLM{
+		ClaudeClient: claude.NewClient(server.URL, "", server.Client()),
+		EventLogger:  &eventLogger{},
+		Documents:    documents.FromMap(types.MemoryFileMap{uri: "package add\n\nfunc add(a, b int) int {\n\treturn\n}\n"}),
+	}
+	// A failed completion is returned as an error instead of panicking on
+	// the missing edit
+	_, err := l.ExecuteCommand(context.Background(), types.ExecuteCommandParams{
+		Command:   "cody.completeLine",
+		Arguments: []any{string(uri), 3},
+	}, nil)
+	if err == nil {
+		t.Error("expected the error of the completion request")
+	}
+}
+
+func TestCompleteLineSnapshot(t *testing.T) {
+	uri := lsp.DocumentURI("file:///src/add.go")
+	l := &SourcegraphLLM{
+		Documents: documents.FromMap(types.MemoryFileMap{uri: "package add\n\nfunc add(a, b int) int {\n\treturn\n}\n"}),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The user adds a line above the cursor while the completion is
+		// requested
+		l.Documents.Change(uri, l.Documents.Version(uri)+1, func(text string) (string, error) {
+			return "// Package add adds.\n" + text, nil
+		})
+		w.Write([]byte(`{"data": {"completions": " a + b"}}`))
+	}))
+	defer server.Close()
+	l.ClaudeClient = claude.NewClient(server.URL, "", server.Client())
+
+	ctx := l.withSnapshot(context.Background())
+	edit, err := l.completeLine(ctx, uri, lsp.Position{Line: 3, Character: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The edit is relative to the snapshot, versionEdit maps it to the
+	// current text
+	got := edit.DocumentChanges[0].(types.TextDocumentEdit).Edits[0]
+	want := lsp.TextEdit{Range: lsp.Range{Start: lsp.Position{Line: 3, Character: 1}, End: lsp.Position{Line: 3, Character: 7}}, NewText: "return a + b"}
+	if got != want {
+		t.Errorf("got edit %+v, want %+v on the return statement of the snapshot", got, want)
+	}
+}
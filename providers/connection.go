@@ -0,0 +1,30 @@
+package providers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/pjlast/llmsp/internal/i18n"
+	"github.com/pjlast/llmsp/sourcegraph/embeddings"
+	"github.com/pjlast/llmsp/sourcegraph/graphql"
+)
+
+// checkConnection validates the URL and the access token by looking up the
+// current user. The error explains what to fix in the language of the
+// client.
+func (l *SourcegraphLLM) checkConnection(ctx context.Context) error {
+	_, err := l.EmbeddingsClient.CurrentUser(ctx)
+	switch {
+	case errors.Is(err, embeddings.ErrUnauthorized):
+		return errors.New(l.Messages.T(i18n.Unauthorized))
+	case err != nil:
+		return errors.New(l.Messages.T(i18n.ConnectionFailed, l.URL, err))
+	}
+	return nil
+}
+
+// traceGraphQL logs the requests sent to the GraphQL API.
+func (l *SourcegraphLLM) traceGraphQL(trace graphql.Trace) {
+	l.Logger.Debug("graphql request", "operation", trace.Operation, "attempt", trace.Attempt,
+		"status", trace.StatusCode, "duration", trace.Duration, "err", trace.Err)
+}
@@ -0,0 +1,42 @@
+package providers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pjlast/llmsp/sourcegraph/embeddings"
+)
+
+func TestCheckConnection(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{"valid token", http.StatusOK, `{"data": {"currentUser": {"username": "alice"}}}`, ""},
+		{"invalid token", http.StatusUnauthorized, `Invalid access token.`, "rejected the access token"},
+		{"anonymous", http.StatusOK, `{"data": {"currentUser": null}}`, "rejected the access token"},
+		{"not Sourcegraph", http.StatusNotFound, `Not found`, "could not connect"},
+	}
+	for _, test := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(test.status)
+			w.Write([]byte(test.body))
+		}))
+		l := &SourcegraphLLM{URL: server.URL, EmbeddingsClient: embeddings.NewClient(server.URL, "token", server.Client())}
+
+		err := l.checkConnection(context.Background())
+		server.Close()
+		if test.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", test.name, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+			t.Errorf("%s: got error %v, want %q", test.name, err, test.wantErr)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package providers
+
+import (
+	"sort"
+
+	"github.com/pjlast/llmsp/internal/documents"
+	"github.com/pjlast/llmsp/internal/index"
+	"github.com/sourcegraph/go-lsp"
+)
+
+// defaultContextTokens is the number of tokens of open files included in
+// prompts, unless configured otherwise.
+const defaultContextTokens = 6000
+
+// minContextFileTokens is the smallest part of a file worth including when
+// the rest of the file doesn't fit the budget.
+const minContextFileTokens = 200
+
+// contextTokens returns the token budget for open files.
+func (l *SourcegraphLLM) contextTokens() int {
+	if l.ContextTokens > 0 {
+		return l.ContextTokens
+	}
+	return defaultContextTokens
+}
+
+// openFilesContext returns the open files of the subproject of filename to
+// include in a prompt about query, most relevant first, trimmed to the token
+// budget.
+func (l *SourcegraphLLM) openFilesContext(filename, query string) []documents.Document {
+	// In monorepos, only the subproject of the current file is relevant.
+	root := l.projectRoot(lsp.DocumentURI(filename))
+	var docs []documents.Document
+	for _, doc := range l.Documents.All() {
+		if inProject(root, doc.URI) && !l.ignored(string(doc.URI)) {
+			docs = append(docs, doc)
+		}
+	}
+
+	return budgetDocuments(rankDocuments(docs, lsp.DocumentURI(filename), query), l.contextTokens())
+}
+
+// rankDocuments sorts documents by their relevance to the current file and
+// query. The current file comes first, the other documents are scored by the
+// share of the query terms they contain and how recently they were changed.
+func rankDocuments(docs []documents.Document, current lsp.DocumentURI, query string) []documents.Document {
+	queryTerms := make(map[string]bool)
+	for _, term := range index.Terms(query) {
+		queryTerms[term] = true
+	}
+
+	// Rank documents by recency first, the most recently touched has rank 0
+	byRecency := append([]documents.Document(nil), docs...)
+	sort.SliceStable(byRecency, func(i, j int) bool {
+		return byRecency[i].Touched.After(byRecency[j].Touched)
+	})
+
+	scores := make(map[lsp.DocumentURI]float64, len(docs))
+	for rank, doc := range byRecency {
+		score := 1 / float64(rank+1)
+		if len(queryTerms) > 0 {
+			found := make(map[string]bool)
+			for _, term := range index.Terms(doc.Text) {
+				if queryTerms[term] {
+					found[term] = true
+				}
+			}
+			// Relevance outweighs recency
+			score += 2 * float64(len(found)) / float64(len(queryTerms))
+		}
+		scores[doc.URI] = score
+	}
+
+	sort.SliceStable(byRecency, func(i, j int) bool {
+		a, b := byRecency[i], byRecency[j]
+		if (a.URI == current) != (b.URI == current) {
+			return a.URI == current
+		}
+		return scores[a.URI] > scores[b.URI]
+	})
+	return byRecency
+}
+
+// budgetDocuments returns the documents that fit in the token budget, in
+// order. A document that doesn't fit entirely is truncated to the remaining
+// budget, and no more documents are included once the remaining budget is
+// too small to be useful.
+func budgetDocuments(docs []documents.Document, budget int) []documents.Document {
+	var kept []documents.Document
+	for _, doc := range docs {
+		if budget < minContextFileTokens {
+			break
+		}
+		tokens := getTokenLength(doc.Text)
+		if tokens > budget {
+			doc.Text, tokens = truncateText(doc.Text, budget)
+		}
+		kept = append(kept, doc)
+		budget -= tokens
+	}
+	return kept
+}
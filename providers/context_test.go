@@ -0,0 +1,59 @@
+package providers
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pjlast/llmsp/internal/documents"
+	"github.com/sourcegraph/go-lsp"
+)
+
+func TestRankDocuments(t *testing.T) {
+	now := time.Now()
+	docs := []documents.Document{
+		{URI: "file:///a.go", Text: "package a\n\nfunc retry() {}", Touched: now.Add(-time.Hour)},
+		{URI: "file:///b.go", Text: "package b", Touched: now},
+		{URI: "file:///c.go", Text: "package c", Touched: now.Add(-time.Minute)},
+		{URI: "file:///main.go", Text: "package main", Touched: now.Add(-2 * time.Hour)},
+	}
+
+	tests := []struct {
+		query string
+		want  []lsp.DocumentURI
+	}{
+		{"", []lsp.DocumentURI{"file:///main.go", "file:///b.go", "file:///c.go", "file:///a.go"}},
+		{"add a retry", []lsp.DocumentURI{"file:///main.go", "file:///a.go", "file:///b.go", "file:///c.go"}},
+	}
+	for _, test := range tests {
+		var got []lsp.DocumentURI
+		for _, doc := range rankDocuments(docs, "file:///main.go", test.query) {
+			got = append(got, doc.URI)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("rankDocuments(%q) == %v, want %v", test.query, got, test.want)
+		}
+	}
+}
+
+func TestBudgetDocuments(t *testing.T) {
+	small := strings.Repeat("word ", 100)
+	large := strings.Repeat("word ", 1000)
+	docs := []documents.Document{
+		{URI: "file:///a.go", Text: small},
+		{URI: "file:///b.go", Text: large},
+		{URI: "file:///c.go", Text: small},
+	}
+
+	got := budgetDocuments(docs, 600)
+	if len(got) != 2 {
+		t.Fatalf("budgetDocuments() kept %d documents, want 2", len(got))
+	}
+	if got[0].Text != small {
+		t.Error("budgetDocuments() truncated a document that fits")
+	}
+	if tokens := getTokenLength(got[1].Text); tokens > 600-getTokenLength(small) {
+		t.Errorf("truncated document has %d tokens, want at most %d", tokens, 600-getTokenLength(small))
+	}
+}
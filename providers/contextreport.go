@@ -0,0 +1,96 @@
+package providers
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pjlast/llmsp/claude"
+	"github.com/pjlast/llmsp/sourcegraph/embeddings"
+	"github.com/pjlast/llmsp/types"
+)
+
+// fileSource returns the source of a message containing text from the file,
+// starting at line startLine of the file. Lines start at 0.
+func fileSource(kind, file, text string, startLine int) *claude.Source {
+	return &claude.Source{
+		Kind:      kind,
+		File:      strings.TrimPrefix(file, "file://"),
+		StartLine: startLine + 1,
+		EndLine:   startLine + 1 + strings.Count(strings.TrimSuffix(text, "\n"), "\n"),
+	}
+}
+
+// embeddingsSource returns the source of a message containing an embeddings
+// result. Results of single repository searches have no repository name,
+// they are from repo.
+func embeddingsSource(result embeddings.EmbeddingsResult, repo string) *claude.Source {
+	source := fileSource("embeddings", result.FileName, result.Content, result.StartLine)
+	source.Repo = result.RepoName
+	if source.Repo == "" {
+		source.Repo = repo
+	}
+	return source
+}
+
+// contextFiles returns the ranges of the embeddings results included in the
+// messages of a prompt, in order and without duplicates.
+func contextFiles(messages []claude.Message) []types.ContextFile {
+	files := []types.ContextFile{}
+	seen := make(map[types.ContextFile]bool)
+	for _, message := range messages {
+		if message.Source == nil || message.Source.Kind != "embeddings" {
+			continue
+		}
+		file := types.ContextFile{
+			Repo:      message.Source.Repo,
+			File:      message.Source.File,
+			StartLine: message.Source.StartLine,
+			EndLine:   message.Source.EndLine,
+		}
+		if !seen[file] {
+			seen[file] = true
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// contextReport lists the context of the messages of a prompt.
+func contextReport(params *claude.CompletionParameters) types.ContextReport {
+	report := types.ContextReport{
+		Model: params.Model,
+		Time:  time.Now(),
+		Items: []types.ContextItem{},
+	}
+	for _, message := range params.Messages {
+		tokens := getTokenLength(message.Text)
+		report.Tokens += tokens
+		if message.Source == nil {
+			continue
+		}
+		report.Items = append(report.Items, types.ContextItem{
+			Kind:      message.Source.Kind,
+			File:      message.Source.File,
+			StartLine: message.Source.StartLine,
+			EndLine:   message.Source.EndLine,
+			Tokens:    tokens,
+		})
+	}
+	return report
+}
+
+// reportContext records the context of a prompt before it is sent, and
+// reports it to the client.
+func (l *SourcegraphLLM) reportContext(params *claude.CompletionParameters) {
+	report := contextReport(params)
+	l.lastContext.Store(&report)
+	if l.ContextUpdated != nil {
+		l.ContextUpdated(report)
+	}
+}
+
+// LastContext returns the context of the most recent prompt, or nil if no
+// prompt was sent yet.
+func (l *SourcegraphLLM) LastContext() *types.ContextReport {
+	return l.lastContext.Load()
+}
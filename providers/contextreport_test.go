@@ -0,0 +1,77 @@
+package providers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pjlast/llmsp/claude"
+	"github.com/pjlast/llmsp/internal/documents"
+	"github.com/pjlast/llmsp/sourcegraph/embeddings"
+	"github.com/pjlast/llmsp/types"
+)
+
+func TestFileSource(t *testing.T) {
+	source := fileSource("embeddings", "file:///src/a.go", "func A() {\n}\n", 9)
+	want := &claude.Source{Kind: "embeddings", File: "/src/a.go", StartLine: 10, EndLine: 11}
+	if !reflect.DeepEqual(source, want) {
+		t.Errorf("fileSource() == %+v, want %+v", source, want)
+	}
+}
+
+func TestContextFiles(t *testing.T) {
+	l := &SourcegraphLLM{
+		Documents: documents.FromMap(types.MemoryFileMap{
+			"file:///src/server/handler.go": "package server\n\nfunc handler() {}\n",
+		}),
+		RepoName: "github.com/a/server",
+	}
+	routes := embeddings.EmbeddingsResult{FileName: "server/routes.go", StartLine: 10, EndLine: 12, Content: "func routes() {\n\thandle(\"/\", handler)\n}"}
+	results := &embeddings.EmbeddingsSearchResult{
+		CodeResults: []embeddings.EmbeddingsResult{
+			routes,
+			{RepoName: "github.com/a/lib", FileName: "http.go", StartLine: 0, EndLine: 0, Content: "func handle() {}"},
+			routes,
+		},
+	}
+	messages := l.getMessages("file:///src/server/handler.go", "Where is handler used?", results)
+
+	// Open files aren't embeddings results
+	want := []types.ContextFile{
+		{Repo: "github.com/a/server", File: "server/routes.go", StartLine: 11, EndLine: 13},
+		{Repo: "github.com/a/lib", File: "http.go", StartLine: 1, EndLine: 1},
+	}
+	if got := contextFiles(messages); !reflect.DeepEqual(got, want) {
+		t.Errorf("contextFiles() == %+v, want %+v", got, want)
+	}
+	if got := contextFiles(nil); got == nil || len(got) != 0 {
+		t.Errorf("contextFiles(nil) == %#v, want an empty list", got)
+	}
+}
+
+func TestReportContext(t *testing.T) {
+	var reported []types.ContextReport
+	l := &SourcegraphLLM{ContextUpdated: func(report types.ContextReport) { reported = append(reported, report) }}
+	if l.LastContext() != nil {
+		t.Error("LastContext() before any prompt != nil")
+	}
+
+	l.reportContext(&claude.CompletionParameters{
+		Model: "claude",
+		Messages: []claude.Message{
+			{Speaker: claude.Human, Text: "You are Cody."},
+			{Speaker: claude.Human, Text: "package a", Source: &claude.Source{Kind: "file", File: "/src/a.go", StartLine: 1, EndLine: 1}},
+			{Speaker: claude.Assistant, Text: "Ok."},
+		},
+	})
+	last := l.LastContext()
+	if last == nil || len(reported) != 1 {
+		t.Fatalf("got last context %+v and %d reports, want a report", last, len(reported))
+	}
+	want := []types.ContextItem{{Kind: "file", File: "/src/a.go", StartLine: 1, EndLine: 1, Tokens: getTokenLength("package a")}}
+	if !reflect.DeepEqual(last.Items, want) || last.Model != "claude" {
+		t.Errorf("LastContext() == %+v, want the items %+v", last, want)
+	}
+	if last.Tokens <= want[0].Tokens {
+		t.Errorf("LastContext() has %d tokens, want the whole prompt counted", last.Tokens)
+	}
+}
@@ -0,0 +1,58 @@
+package providers
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// chatStream sends a streamed response in cody/chat notifications. By
+// default every notification holds the whole response so far. In delta
+// mode, notifications only hold the text added since the previous one, and
+// a final notification holds the whole response.
+type chatStream struct {
+	conn   *jsonrpc2.Conn
+	deltas bool
+	// sent is the response sent so far in delta mode
+	sent string
+	seq  int
+}
+
+// send sends the response received so far.
+func (s *chatStream) send(ctx context.Context, response string) {
+	if !s.deltas {
+		s.conn.Notify(ctx, "cody/chat", types.ChatMessage{Message: chatLines(response)})
+		return
+	}
+
+	delta := types.ChatDelta{Delta: strings.TrimPrefix(response, s.sent)}
+	if !strings.HasPrefix(response, s.sent) {
+		delta.Replace = true
+	} else if delta.Delta == "" {
+		return
+	}
+	s.sent = response
+	s.seq++
+	delta.Seq = s.seq
+	s.conn.Notify(ctx, "cody/chat", delta)
+}
+
+// finish sends the final notification of a delta stream.
+func (s *chatStream) finish(ctx context.Context, response string) {
+	if !s.deltas {
+		return
+	}
+	s.seq++
+	s.conn.Notify(ctx, "cody/chat", types.ChatDelta{Seq: s.seq, Done: true, Message: chatLines(response)})
+}
+
+// chatLines splits a response into lines without trailing spaces.
+func chatLines(response string) []string {
+	lines := strings.Split(strings.TrimSpace(response), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " ")
+	}
+	return lines
+}
@@ -0,0 +1,57 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func TestChatStreamDeltas(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	received := make(chan types.ChatDelta, 10)
+	client := jsonrpc2.HandlerWithError(func(_ context.Context, _ *jsonrpc2.Conn, req *jsonrpc2.Request) (any, error) {
+		var delta types.ChatDelta
+		if err := json.Unmarshal(*req.Params, &delta); err != nil {
+			t.Error(err)
+		}
+		received <- delta
+		return nil, nil
+	})
+	a, b := net.Pipe()
+	serverConn := jsonrpc2.NewConn(ctx, jsonrpc2.NewBufferedStream(a, jsonrpc2.VSCodeObjectCodec{}), nil)
+	defer serverConn.Close()
+	clientConn := jsonrpc2.NewConn(ctx, jsonrpc2.NewBufferedStream(b, jsonrpc2.VSCodeObjectCodec{}), client)
+	defer clientConn.Close()
+
+	chat := &chatStream{conn: serverConn, deltas: true}
+	chat.send(ctx, "Hello")
+	chat.send(ctx, "Hello")
+	chat.send(ctx, "Hello, world")
+	chat.send(ctx, "Hi")
+	chat.finish(ctx, "Hi there  \nBye")
+
+	want := []types.ChatDelta{
+		{Seq: 1, Delta: "Hello"},
+		{Seq: 2, Delta: ", world"},
+		{Seq: 3, Delta: "Hi", Replace: true},
+		{Seq: 4, Done: true, Message: []string{"Hi there", "Bye"}},
+	}
+	for _, w := range want {
+		select {
+		case got := <-received:
+			if !reflect.DeepEqual(got, w) {
+				t.Errorf("got %+v, want %+v", got, w)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no notification received, want %+v", w)
+		}
+	}
+}
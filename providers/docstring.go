@@ -0,0 +1,198 @@
+package providers
+
+import (
+	"context"
+	"strings"
+
+	"github.com/sourcegraph/go-lsp"
+)
+
+// docStyle describes how doc comments are written in a language.
+type docStyle struct {
+	// open starts the doc comment, answers are prefilled with it
+	open string
+	// line prefixes the lines of the comment
+	line string
+	// close ends block comments, it is empty for line comments
+	close string
+	// inBody places the comment at the start of the body of the function
+	// instead of above it, like Python docstrings
+	inBody bool
+}
+
+// docStyleOf returns the doc comment style of the language. Languages without
+// a dedicated style get line comments.
+func docStyleOf(lang string) docStyle {
+	switch lang {
+	case "Python":
+		return docStyle{open: `"""`, close: `"""`, inBody: true}
+	case "Rust":
+		return docStyle{open: "///", line: "/// "}
+	case "JavaScript", "TypeScript", "TypeScript React":
+		return docStyle{open: "/**", line: " * ", close: " */"}
+	}
+	prefix := commentPrefix(lang)
+	return docStyle{open: prefix, line: prefix + " "}
+}
+
+// documentFunction returns the function with a generated doc comment.
+func (l *SourcegraphLLM) documentFunction(ctx context.Context, filename, function string, startLine, endLine int) (string, error) {
+	style := docStyleOf(l.documentLanguage(lsp.DocumentURI(filename)))
+	answer, err := l.getDocString(ctx, filename, function, style.open, startLine, endLine)
+	if err != nil {
+		return "", err
+	}
+	return style.insert(function, style.text(answer)), nil
+}
+
+// text returns the lines of text of a doc comment, without comment markers
+// and indentation. Anything following the comment, such as a repeated
+// function, is dropped.
+func (s docStyle) text(answer string) []string {
+	answer = strings.TrimPrefix(strings.TrimSpace(answer), s.open)
+	if s.close != "" {
+		answer, _, _ = strings.Cut(answer, strings.TrimSpace(s.close))
+	}
+
+	var lines []string
+	for i, line := range strings.Split(answer, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case s.close == "":
+			// Line comments end with the first line that isn't one
+			if i > 0 && !strings.HasPrefix(trimmed, s.open) {
+				return trimBlankLines(lines)
+			}
+			line = strings.TrimPrefix(strings.TrimPrefix(trimmed, s.open), " ")
+		case strings.TrimSpace(s.line) != "":
+			line = strings.TrimPrefix(strings.TrimPrefix(trimmed, strings.TrimSpace(s.line)), " ")
+		default:
+			line = strings.TrimRight(line, " \t")
+		}
+		lines = append(lines, line)
+	}
+	lines = trimBlankLines(lines)
+	if s.line == "" && len(lines) > 1 {
+		// Keep the relative indentation of docstrings, e.g. of examples
+		lines = append(lines[:1:1], dedent(lines[1:])...)
+		lines[0] = strings.TrimSpace(lines[0])
+	}
+	return lines
+}
+
+// insert adds the doc comment with the given lines to the function, indented
+// like the function, or its body for comments placed in the body.
+func (s docStyle) insert(function string, text []string) string {
+	lines := strings.Split(function, "\n")
+	if len(text) == 0 || len(lines) == 0 {
+		return function
+	}
+
+	at, indent := 0, leadingWhitespace(lines[0])
+	if s.inBody {
+		header, ok := bodyStart(lines)
+		if !ok {
+			// Not a definition with a body on its own lines, fall back
+			// to comments above the code
+			return docStyle{open: "#", line: "# "}.insert(function, text)
+		}
+		at, indent = header+1, bodyIndent(lines, header)
+	}
+
+	var comment []string
+	switch {
+	case s.inBody && len(text) == 1:
+		comment = []string{indent + s.open + text[0] + s.close}
+	case s.inBody:
+		comment = append(comment, indent+s.open+text[0])
+		for _, line := range text[1:] {
+			comment = append(comment, strings.TrimRight(indent+line, " \t"))
+		}
+		comment = append(comment, indent+s.close)
+	default:
+		if s.close != "" {
+			comment = append(comment, indent+s.open)
+		}
+		for _, line := range text {
+			comment = append(comment, strings.TrimRight(indent+s.line+line, " \t"))
+		}
+		if s.close != "" {
+			comment = append(comment, indent+s.close)
+		}
+	}
+
+	result := append(append(append([]string{}, lines[:at]...), comment...), lines[at:]...)
+	return strings.Join(result, "\n")
+}
+
+// bodyStart returns the index of the last line of the header of a Python
+// function or class, the line ending with a colon.
+func bodyStart(lines []string) (int, bool) {
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmed, "def ") && !strings.HasPrefix(trimmed, "async def ") && !strings.HasPrefix(trimmed, "class ") {
+			continue
+		}
+		for j := i; j < len(lines); j++ {
+			code, _, _ := strings.Cut(lines[j], "#")
+			if strings.HasSuffix(strings.TrimSpace(code), ":") {
+				return j, true
+			}
+		}
+		return 0, false
+	}
+	return 0, false
+}
+
+// bodyIndent returns the indentation of the body following the header line.
+// Bodies on the same line as the header are indented one level more than
+// the header.
+func bodyIndent(lines []string, header int) string {
+	for _, line := range lines[header+1:] {
+		if strings.TrimSpace(line) != "" {
+			return leadingWhitespace(line)
+		}
+	}
+	indent := leadingWhitespace(lines[header])
+	if strings.HasPrefix(indent, "\t") {
+		return indent + "\t"
+	}
+	return indent + "    "
+}
+
+// leadingWhitespace returns the indentation of the line.
+func leadingWhitespace(line string) string {
+	return line[:indentOf(line)]
+}
+
+// dedent removes the indentation common to all non-blank lines.
+func dedent(lines []string) []string {
+	common := -1
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if indent := indentOf(line); common < 0 || indent < common {
+			common = indent
+		}
+	}
+	dedented := make([]string, len(lines))
+	for i, line := range lines {
+		if len(line) >= common && common > 0 {
+			line = line[common:]
+		}
+		dedented[i] = line
+	}
+	return dedented
+}
+
+// trimBlankLines removes the blank lines at the start and end.
+func trimBlankLines(lines []string) []string {
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
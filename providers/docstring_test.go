@@ -0,0 +1,72 @@
+package providers
+
+import "testing"
+
+func TestDocumentFunction(t *testing.T) {
+	tests := []struct {
+		name     string
+		lang     string
+		function string
+		answer   string
+		want     string
+	}{
+		{
+			name:     "go",
+			lang:     "Go",
+			function: "func add(a, b int) int {\n\treturn a + b\n}",
+			answer:   "// add returns the sum of a and b.\n//\n// It doesn't overflow.\nfunc add(a, b int) int {",
+			want:     "// add returns the sum of a and b.\n//\n// It doesn't overflow.\nfunc add(a, b int) int {\n\treturn a + b\n}",
+		},
+		{
+			name:     "nested",
+			lang:     "Go",
+			function: "\tadd := func(a, b int) int {\n\t\treturn a + b\n\t}",
+			answer:   "// add returns the sum of a and b.",
+			want:     "\t// add returns the sum of a and b.\n\tadd := func(a, b int) int {\n\t\treturn a + b\n\t}",
+		},
+		{
+			name:     "rust",
+			lang:     "Rust",
+			function: "    fn add(a: i32, b: i32) -> i32 {\n        a + b\n    }",
+			answer:   "/// Returns the sum of a and b.\n/// Panics on overflow.",
+			want:     "    /// Returns the sum of a and b.\n    /// Panics on overflow.\n    fn add(a: i32, b: i32) -> i32 {\n        a + b\n    }",
+		},
+		{
+			name:     "typescript",
+			lang:     "TypeScript",
+			function: "  add(a: number, b: number): number {\n    return a + b\n  }",
+			answer:   "/**\n * Returns the sum of a and b.\n * @param a - The first number\n */\nadd(a: number, b: number) {",
+			want:     "  /**\n   * Returns the sum of a and b.\n   * @param a - The first number\n   */\n  add(a: number, b: number): number {\n    return a + b\n  }",
+		},
+		{
+			name:     "python",
+			lang:     "Python",
+			function: "    @staticmethod\n    def add(a,\n            b):  # numbers\n        return a + b",
+			answer:   "\"\"\"Return the sum of a and b.\n\n    Example:\n        add(1, 2)\n    \"\"\"",
+			want:     "    @staticmethod\n    def add(a,\n            b):  # numbers\n        \"\"\"Return the sum of a and b.\n\n        Example:\n            add(1, 2)\n        \"\"\"\n        return a + b",
+		},
+		{
+			name:     "python one line",
+			lang:     "Python",
+			function: "def add(a, b): return a + b",
+			answer:   "\"\"\"Return the sum of a and b.\"\"\"\ndef add(a, b):",
+			want:     "# Return the sum of a and b.\ndef add(a, b): return a + b",
+		},
+		{
+			name:     "python single line docstring",
+			lang:     "Python",
+			function: "def add(a, b):\n\treturn a + b",
+			answer:   "\"\"\"Return the sum of a and b.\"\"\"",
+			want:     "def add(a, b):\n\t\"\"\"Return the sum of a and b.\"\"\"\n\treturn a + b",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			style := docStyleOf(test.lang)
+			if got := style.insert(test.function, style.text(test.answer)); got != test.want {
+				t.Errorf("got\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
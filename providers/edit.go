@@ -0,0 +1,201 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pjlast/llmsp/claude"
+	"github.com/pjlast/llmsp/internal/position"
+	"github.com/sourcegraph/go-lsp"
+)
+
+// maxDiffCells bounds the size of the table used to diff two texts. Larger
+// texts are replaced as a whole.
+const maxDiffCells = 1 << 20
+
+// rangeArgument decodes a command argument holding an lsp.Range.
+func rangeArgument(argument any) (lsp.Range, error) {
+	var rng lsp.Range
+	data, err := json.Marshal(argument)
+	if err != nil {
+		return rng, err
+	}
+	if err := json.Unmarshal(data, &rng); err != nil {
+		return rng, fmt.Errorf("invalid range argument: %w", err)
+	}
+	return rng, nil
+}
+
+// editSelection asks the LLM to rewrite the text in rng according to the
+// instruction and returns the edits turning the selection into the rewrite.
+// Text outside the selection is never touched.
+func (l *SourcegraphLLM) editSelection(ctx context.Context, uri lsp.DocumentURI, rng lsp.Range, instruction string) ([]lsp.TextEdit, error) {
+	contents := l.snapshotText(ctx, uri)
+	start, end := position.Offset(contents, rng.Start), position.Offset(contents, rng.End)
+	if end < start {
+		return nil, fmt.Errorf("invalid range: end %d:%d precedes start %d:%d", rng.End.Line, rng.End.Character, rng.Start.Line, rng.Start.Character)
+	}
+	selection := contents[start:end]
+
+	fence := fmt.Sprintf("```%s\n", strings.ToLower(determineLanguage(string(uri))))
+	input := []claude.Message{
+		{
+			Speaker: claude.Human,
+			Text: fmt.Sprintf(`Here is a file in which the selected code is enclosed in <selection> tags:
+%s<selection>%s</selection>%s
+
+Rewrite only the selected code according to the following instruction. Keep everything that doesn't need to change as it is, and respond with the rewritten selection only, without the tags and without the surrounding code.
+Instruction: %s`, contents[:start], selection, contents[end:], instruction),
+		},
+		{
+			Speaker: claude.Assistant,
+			Text:    fence,
+		},
+	}
+	params := l.completionParameters(editModel, l.AddContext(ctx, editModel, input, string(uri), contents))
+	rewritten, err := l.ClaudeClient.GetCompletion(ctx, params, true)
+	if err != nil {
+		return nil, err
+	}
+	if index := strings.Index(rewritten, "\n```"); index != -1 {
+		rewritten = rewritten[:index]
+	}
+	rewritten = strings.TrimPrefix(rewritten, fence)
+	// The code block ends with a newline whether or not the selection does
+	rewritten = strings.TrimSuffix(rewritten, "\n")
+	if strings.HasSuffix(selection, "\n") {
+		rewritten += "\n"
+	}
+
+	return diffEdits(rng.Start, selection, rewritten), nil
+}
+
+// lineChange is a block of changed lines: the lines A[From:To] of one text
+// are replaced by the lines B[BFrom:BTo] of the other.
+type lineChange struct {
+	From, To   int
+	BFrom, BTo int
+}
+
+// diffLines returns the blocks of lines that differ between a and b, based
+// on their longest common subsequence. It returns a single change if the
+// texts are too large to diff.
+func diffLines(a, b []string) []lineChange {
+	if len(a)*len(b) > maxDiffCells {
+		return []lineChange{{From: 0, To: len(a), BFrom: 0, BTo: len(b)}}
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var changes []lineChange
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		if i < len(a) && j < len(b) && a[i] == b[j] {
+			i++
+			j++
+			continue
+		}
+
+		change := lineChange{From: i, BFrom: j}
+		for i < len(a) || j < len(b) {
+			if i < len(a) && j < len(b) && a[i] == b[j] {
+				break
+			}
+			if j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]) {
+				i++
+			} else {
+				j++
+			}
+		}
+		change.To, change.BTo = i, j
+		changes = append(changes, change)
+	}
+
+	return changes
+}
+
+// diffEdits returns the edits that turn before, which starts at start in a
+// document, into after. Lines are diffed first, and the edit for every
+// changed block of lines is then narrowed down to the characters that
+// changed.
+func diffEdits(start lsp.Position, before, after string) []lsp.TextEdit {
+	if before == after {
+		return nil
+	}
+
+	a, b := splitLinesAfter(before), splitLinesAfter(after)
+	var edits []lsp.TextEdit
+	// offset is the byte offset of a[i] in before
+	offset, i := 0, 0
+	for _, change := range diffLines(a, b) {
+		offset += len(strings.Join(a[i:change.From], ""))
+		removed := strings.Join(a[change.From:change.To], "")
+		added := strings.Join(b[change.BFrom:change.BTo], "")
+		edits = append(edits, narrowEdit(start, before, offset, removed, added))
+		offset += len(removed)
+		i = change.To
+	}
+
+	return edits
+}
+
+// narrowEdit returns an edit replacing removed, found at offset in before,
+// with added, leaving out the prefix and suffix they have in common.
+func narrowEdit(start lsp.Position, before string, offset int, removed, added string) lsp.TextEdit {
+	prefix := 0
+	for prefix < len(removed) && prefix < len(added) && removed[prefix] == added[prefix] {
+		prefix++
+	}
+	// Runes that only share their first bytes, like é and è, are replaced
+	// whole
+	for prefix > 0 && ((prefix < len(removed) && !utf8.RuneStart(removed[prefix])) || (prefix < len(added) && !utf8.RuneStart(added[prefix]))) {
+		prefix--
+	}
+	suffix := 0
+	for suffix < len(removed)-prefix && suffix < len(added)-prefix &&
+		removed[len(removed)-1-suffix] == added[len(added)-1-suffix] {
+		suffix++
+	}
+	for suffix > 0 && (!utf8.RuneStart(removed[len(removed)-suffix]) || !utf8.RuneStart(added[len(added)-suffix])) {
+		suffix--
+	}
+
+	return lsp.TextEdit{
+		Range: lsp.Range{
+			Start: position.After(start, before[:offset+prefix]),
+			End:   position.After(start, before[:offset+len(removed)-suffix]),
+		},
+		NewText: added[prefix : len(added)-suffix],
+	}
+}
+
+// splitLinesAfter splits text into lines, keeping the line endings.
+func splitLinesAfter(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,88 @@
+package providers
+
+import (
+	"testing"
+
+	"github.com/sourcegraph/go-lsp"
+)
+
+func TestDiffEdits(t *testing.T) {
+	prefix := "package main\n\nfunc main() {\n\tx := "
+	suffix := "\n}\n"
+	start := lsp.Position{Line: 3, Character: 6}
+
+	tests := []struct {
+		before, after string
+		edits         int
+	}{
+		{"1", "1", 0},
+		{"1", "2", 1},
+		{"1 + 2\n\ty := 3", "1 + 2\n\ty := 4", 1},
+		{"a\nb\nc\nd\ne", "a\nB\nc\nd\nE", 2},
+		{"a\nb\nc", "a\nb\nnew\nc", 1},
+		{"a\nb\nc", "a\nc", 1},
+		{"", "inserted", 1},
+		{"removed", "", 1},
+		{"a\nb\n", "a\nb\nc\n", 1},
+		{`"café"`, `"cafè"`, 1},
+		{`"😀 ü" + 1`, `"😀 ü" + 2`, 1},
+	}
+
+	for _, test := range tests {
+		edits := diffEdits(start, test.before, test.after)
+		if len(edits) != test.edits {
+			t.Errorf("diffEdits(%q, %q) returned %d edits, want %d: %+v", test.before, test.after, len(edits), test.edits, edits)
+		}
+		got := applyTextEdits(prefix+test.before+suffix, edits)
+		if want := prefix + test.after + suffix; got != want {
+			t.Errorf("applying diffEdits(%q, %q) == %q, want %q", test.before, test.after, got, want)
+		}
+	}
+}
+
+func TestDiffEditsNarrow(t *testing.T) {
+	edits := diffEdits(lsp.Position{Line: 2, Character: 4}, "foo(bar)\nbaz", "foo(qux)\nbaz")
+	want := lsp.TextEdit{
+		Range:   lsp.Range{Start: lsp.Position{Line: 2, Character: 8}, End: lsp.Position{Line: 2, Character: 11}},
+		NewText: "qux",
+	}
+	if len(edits) != 1 || edits[0] != want {
+		t.Errorf("diffEdits() == %+v, want [%+v]", edits, want)
+	}
+}
+
+func TestDiffEditsMultibyte(t *testing.T) {
+	// The start is on a line of emoji, positions are in UTF-16 code units
+	edits := diffEdits(lsp.Position{Line: 1, Character: 4}, "f(\"é\")", "f(\"è\")")
+	want := lsp.TextEdit{
+		Range:   lsp.Range{Start: lsp.Position{Line: 1, Character: 7}, End: lsp.Position{Line: 1, Character: 8}},
+		NewText: "è",
+	}
+	if len(edits) != 1 || edits[0] != want {
+		t.Errorf("diffEdits() == %+v, want [%+v]", edits, want)
+	}
+
+	contents := "package main\n😀😀f(\"é\")\n"
+	if got, want := applyTextEdits(contents, edits), "package main\n😀😀f(\"è\")\n"; got != want {
+		t.Errorf("applyTextEdits() == %q, want %q", got, want)
+	}
+}
+
+func TestRangeArgument(t *testing.T) {
+	argument := map[string]any{
+		"start": map[string]any{"line": float64(1), "character": float64(2)},
+		"end":   map[string]any{"line": float64(3), "character": float64(4)},
+	}
+	rng, err := rangeArgument(argument)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := lsp.Range{Start: lsp.Position{Line: 1, Character: 2}, End: lsp.Position{Line: 3, Character: 4}}
+	if rng != want {
+		t.Errorf("rangeArgument() == %+v, want %+v", rng, want)
+	}
+
+	if _, err := rangeArgument("not a range"); err == nil {
+		t.Error("rangeArgument(\"not a range\") succeeded, want an error")
+	}
+}
@@ -0,0 +1,71 @@
+package providers
+
+import (
+	"fmt"
+
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/go-lsp"
+)
+
+// createFileChanges returns the document changes creating a document with
+// the given text. The document is left untouched if it exists and options
+// ignore existing documents.
+func createFileChanges(uri lsp.DocumentURI, text string, options *types.CreateFileOptions) []any {
+	return []any{
+		types.CreateFile{
+			Kind:    "create",
+			URI:     uri,
+			Options: options,
+		},
+		types.TextDocumentEdit{
+			TextDocument: lsp.VersionedTextDocumentIdentifier{
+				TextDocumentIdentifier: lsp.TextDocumentIdentifier{
+					URI: uri,
+				},
+			},
+			Edits: []lsp.TextEdit{
+				{
+					NewText: text,
+				},
+			},
+		},
+	}
+}
+
+// checkResourceOperations returns an error if the edit creates, renames or
+// deletes files and the client doesn't support it. Clients that didn't
+// announce the resource operations they support aren't checked.
+func (l *SourcegraphLLM) checkResourceOperations(edit types.WorkspaceEdit) error {
+	if l.ResourceOperations == nil {
+		return nil
+	}
+
+	for _, change := range edit.DocumentChanges {
+		var kind string
+		switch change := change.(type) {
+		case types.CreateFile:
+			kind = change.Kind
+		case types.RenameFile:
+			kind = change.Kind
+		case types.DeleteFile:
+			kind = change.Kind
+		default:
+			continue
+		}
+		if !l.supportsResourceOperation(kind) {
+			return fmt.Errorf("the editor doesn't support %s file operations in workspace edits", kind)
+		}
+	}
+	return nil
+}
+
+// supportsResourceOperation reports whether the client announced support for
+// the kind of resource operation.
+func (l *SourcegraphLLM) supportsResourceOperation(kind string) bool {
+	for _, supported := range l.ResourceOperations {
+		if supported == kind {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package providers
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/go-lsp"
+)
+
+func TestCheckResourceOperations(t *testing.T) {
+	edit := types.WorkspaceEdit{
+		DocumentChanges: append(createFileChanges("file:///a_test.go", "package a\n", nil),
+			types.DeleteFile{Kind: "delete", URI: "file:///b.go"}),
+	}
+
+	for _, test := range []struct {
+		supported []string
+		wantErr   bool
+	}{
+		{nil, false},
+		{[]string{"create", "rename", "delete"}, false},
+		{[]string{"create"}, true},
+		{[]string{}, true},
+	} {
+		l := &SourcegraphLLM{ResourceOperations: test.supported}
+		if err := l.checkResourceOperations(edit); (err != nil) != test.wantErr {
+			t.Errorf("checkResourceOperations() with %q == %v, want error: %v", test.supported, err, test.wantErr)
+		}
+	}
+}
+
+func TestWorkspaceEditUnmarshal(t *testing.T) {
+	want := types.WorkspaceEdit{
+		DocumentChanges: []any{
+			types.CreateFile{Kind: "create", URI: "file:///a.go", Options: &types.CreateFileOptions{IgnoreIfExists: true}},
+			types.TextDocumentEdit{
+				TextDocument: lsp.VersionedTextDocumentIdentifier{TextDocumentIdentifier: lsp.TextDocumentIdentifier{URI: "file:///a.go"}, Version: 2},
+				Edits:        []lsp.TextEdit{{NewText: "package a\n"}},
+			},
+			types.RenameFile{Kind: "rename", OldURI: "file:///b.go", NewURI: "file:///c.go"},
+			types.DeleteFile{Kind: "delete", URI: "file:///d.go", Options: &types.DeleteFileOptions{IgnoreIfNotExists: true}},
+		},
+	}
+	data, err := json.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got types.WorkspaceEdit
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decoded %s as %+v, want %+v", data, got, want)
+	}
+
+	if err := json.Unmarshal([]byte(`{"documentChanges": [{"kind": "move"}]}`), &got); err == nil {
+		t.Error("decoding an unknown kind of change succeeded, want an error")
+	}
+}
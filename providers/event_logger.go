@@ -1,10 +1,15 @@
 package providers
 
 import (
+	"context"
 	"encoding/json"
 	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/pjlast/llmsp/internal/tasks"
 	"github.com/pjlast/llmsp/sourcegraph/embeddings"
 )
 
@@ -21,6 +26,40 @@ type extensionDetails struct {
 
 const sourcegraphDotComURL = "https://sourcegraph.com"
 
+// Telemetry modes, as set with the telemetry setting.
+const (
+	// TelemetryOff sends no events and doesn't create the UID file
+	TelemetryOff = "off"
+	// TelemetryInstanceOnly sends events to the configured instance only
+	TelemetryInstanceOnly = "instance-only"
+	// TelemetryAll sends events to the configured instance and to
+	// sourcegraph.com
+	TelemetryAll = "all"
+)
+
+// parseTelemetry returns the telemetry mode of the setting. Events are sent
+// everywhere by default, and not at all if the setting is unknown.
+func parseTelemetry(setting string) string {
+	switch setting {
+	case "":
+		return TelemetryAll
+	case TelemetryOff, TelemetryInstanceOnly, TelemetryAll:
+		return setting
+	}
+	return TelemetryOff
+}
+
+// eventBatchDelay is how long events are collected before they are sent in a
+// single request.
+const eventBatchDelay = time.Second
+
+// telemetryV2Version is the first version of Sourcegraph supporting the
+// Telemetry V2 API.
+var telemetryV2Version = [3]int{5, 2, 0}
+
+// clientVersion is the version of llmsp reported with events.
+const clientVersion = "0.1.0"
+
 type eventLogger struct {
 	serverURL      string
 	uid            string
@@ -28,18 +67,43 @@ type eventLogger struct {
 	dotcomClient   *embeddings.Client
 	argument       string
 	publicArgument string
+	// telemetry is the telemetry mode
+	telemetry string
+	tasks     *tasks.Group
+	// pending counts the batches of events that are being sent
+	pending sync.WaitGroup
+	// flushing is signalled to send the current batch right away
+	flushing chan struct{}
+
+	mu sync.Mutex
+	// queue holds the events of the next batch
+	queue []loggedEvent
+	// v2 records whether an instance supports the Telemetry V2 API, by
+	// client
+	v2 map[*embeddings.Client]bool
+}
+
+// loggedEvent is an event waiting to be sent.
+type loggedEvent struct {
+	name     string
+	argument string
 }
 
-func NewEventLogger(serverClient *embeddings.Client, dotcomClient *embeddings.Client, serverURL string, uidFile string) *eventLogger {
+// NewEventLogger returns an event logger sending events according to the
+// telemetry mode. Unless telemetry is off, users are identified by the
+// anonymous UID stored in uidFile, which is created if it doesn't exist yet.
+func NewEventLogger(serverClient *embeddings.Client, dotcomClient *embeddings.Client, serverURL string, uidFile string, telemetry string, tasks *tasks.Group) *eventLogger {
+	if telemetry == TelemetryOff {
+		return &eventLogger{telemetry: TelemetryOff, tasks: tasks, flushing: make(chan struct{}, 1)}
+	}
+
 	newInstall := false
 	uid, err := readUidFromFile(uidFile)
 	if err != nil {
 		newInstall = true
 		uid = uuid.New().String()
-		err = ioutil.WriteFile(uidFile, []byte(uid), 0o644)
-		if err != nil {
-			panic(err)
-		}
+		// If the UID can't be stored, it is only used until the server exits
+		_ = ioutil.WriteFile(uidFile, []byte(uid), 0o644)
 	}
 
 	publicArgument, _ := json.Marshal(publicArgument{
@@ -48,15 +112,20 @@ func NewEventLogger(serverClient *embeddings.Client, dotcomClient *embeddings.Cl
 			IDE:              "Neovim",
 			IDEExtensionType: "Cody",
 		},
-		Version: "0.1.0",
+		Version: clientVersion,
 	})
 
 	eventLogger := &eventLogger{
+		serverURL:      serverURL,
 		uid:            uid,
 		serverClient:   serverClient,
 		dotcomClient:   dotcomClient,
 		argument:       string(publicArgument),
 		publicArgument: string(publicArgument),
+		telemetry:      telemetry,
+		tasks:          tasks,
+		flushing:       make(chan struct{}, 1),
+		v2:             make(map[*embeddings.Client]bool),
 	}
 	if newInstall {
 		eventLogger.Log("CodyInstalled")
@@ -74,15 +143,147 @@ func readUidFromFile(path string) (string, error) {
 }
 
 func (l *eventLogger) Log(eventName string) {
+	l.log(eventName, l.argument)
+}
+
+// LogWithArgument logs an event with an event specific argument, which is
+// sent as the private argument of the event.
+func (l *eventLogger) LogWithArgument(eventName string, argument any) {
+	data, err := json.Marshal(argument)
+	if err != nil {
+		return
+	}
+	l.log(eventName, string(data))
+}
+
+func (l *eventLogger) log(eventName, argument string) {
 	// Don't log events if the UID has not yet been generated.
-	if l.uid == "" {
+	if l.uid == "" || l.telemetry == TelemetryOff {
 		return
 	}
 
-	go func() {
-		_ = l.serverClient.LogEvent(eventName, l.uid, l.argument, l.publicArgument)
-		if l.serverURL != sourcegraphDotComURL {
-			_ = l.dotcomClient.LogEvent(eventName, l.uid, l.argument, l.publicArgument)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.queue = append(l.queue, loggedEvent{name: eventName, argument: argument})
+	if len(l.queue) > 1 {
+		// The batch is already scheduled
+		return
+	}
+
+	l.pending.Add(1)
+	l.tasks.Go("log events", func(ctx context.Context) {
+		defer l.pending.Done()
+		select {
+		case <-time.After(eventBatchDelay):
+		case <-l.flushing:
+		case <-ctx.Done():
 		}
+
+		l.mu.Lock()
+		batch := l.queue
+		l.queue = nil
+		l.mu.Unlock()
+
+		l.send(ctx, l.serverClient, batch)
+		if l.telemetry != TelemetryInstanceOnly && l.serverURL != sourcegraphDotComURL {
+			l.send(ctx, l.dotcomClient, batch)
+		}
+	})
+}
+
+// send sends a batch of events to an instance, in a single request if it
+// supports the Telemetry V2 API and one by one with the deprecated logEvent
+// mutation otherwise.
+func (l *eventLogger) send(ctx context.Context, client *embeddings.Client, batch []loggedEvent) {
+	if !l.supportsV2(ctx, client) {
+		for _, event := range batch {
+			_ = client.LogEvent(ctx, event.name, l.uid, event.argument, l.publicArgument)
+		}
+		return
+	}
+
+	events := make([]embeddings.TelemetryEvent, 0, len(batch))
+	for _, event := range batch {
+		feature, action := telemetryFeature(event.name)
+		events = append(events, embeddings.TelemetryEvent{
+			Feature: feature,
+			Action:  action,
+			Source: embeddings.TelemetryEventSource{
+				Client:        "llmsp",
+				ClientVersion: clientVersion,
+			},
+			Parameters: embeddings.TelemetryEventParameters{
+				Version:         1,
+				PrivateMetadata: json.RawMessage(event.argument),
+			},
+		})
+	}
+	_ = client.RecordEvents(ctx, events)
+}
+
+// supportsV2 reports whether the instance of client supports the Telemetry
+// V2 API. The version of the instance is looked up once.
+func (l *eventLogger) supportsV2(ctx context.Context, client *embeddings.Client) bool {
+	l.mu.Lock()
+	supported, ok := l.v2[client]
+	l.mu.Unlock()
+	if ok {
+		return supported
+	}
+
+	version, err := client.GetVersion(ctx)
+	if err != nil {
+		// Try again with the next batch
+		return false
+	}
+	supported = versionAtLeast(version, telemetryV2Version)
+	l.mu.Lock()
+	l.v2[client] = supported
+	l.mu.Unlock()
+	return supported
+}
+
+// telemetryFeature maps the name of a V1 event to the feature and action of
+// the Telemetry V2 taxonomy, e.g.
+// "CodyNeovimExtension:codeAction:cody.chat:executed" to
+// "cody.codeAction.chat" and "executed".
+func telemetryFeature(eventName string) (feature, action string) {
+	if eventName == "CodyInstalled" {
+		return "cody.extension", "installed"
+	}
+
+	parts := strings.Split(strings.TrimPrefix(eventName, "CodyNeovimExtension:"), ":")
+	action = parts[len(parts)-1]
+	feature = "cody"
+	for _, part := range parts[:len(parts)-1] {
+		feature += "." + strings.TrimPrefix(part, "cody.")
+	}
+	return feature, action
+}
+
+// Flush sends the events that are waiting to be sent and waits for them, or
+// for ctx to be done.
+func (l *eventLogger) Flush(ctx context.Context) {
+	select {
+	case l.flushing <- struct{}{}:
+	default:
+	}
+
+	done := make(chan struct{})
+	go func() {
+		l.pending.Wait()
+		close(done)
 	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+// Flush waits for pending telemetry events to be sent, or for ctx to be done.
+func (l *SourcegraphLLM) Flush(ctx context.Context) {
+	if l.EventLogger != nil {
+		l.EventLogger.Flush(ctx)
+	}
 }
@@ -0,0 +1,149 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pjlast/llmsp/sourcegraph/embeddings"
+)
+
+func TestParseTelemetry(t *testing.T) {
+	for setting, want := range map[string]string{
+		"":              TelemetryAll,
+		"all":           TelemetryAll,
+		"instance-only": TelemetryInstanceOnly,
+		"off":           TelemetryOff,
+		"sometimes":     TelemetryOff,
+	} {
+		if got := parseTelemetry(setting); got != want {
+			t.Errorf("parseTelemetry(%q) == %q, want %q", setting, got, want)
+		}
+	}
+}
+
+// telemetryServer is a Sourcegraph instance recording the events it
+// receives.
+type telemetryServer struct {
+	*httptest.Server
+	version string
+
+	mu sync.Mutex
+	// v1 and v2 are the names of the events received with each API
+	v1, v2 []string
+	// requests counts the requests sending events
+	requests int
+}
+
+func newTelemetryServer(t *testing.T, version string) *telemetryServer {
+	s := &telemetryServer{version: version}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Query     string
+			Variables struct {
+				Event  string
+				Events []embeddings.TelemetryEvent
+			}
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Error(err)
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		switch {
+		case strings.Contains(request.Query, "productVersion"):
+			fmt.Fprintf(w, `{"data": {"site": {"productVersion": %q}}}`, s.version)
+			return
+		case strings.Contains(request.Query, "recordEvents"):
+			s.requests++
+			for _, event := range request.Variables.Events {
+				s.v2 = append(s.v2, event.Feature+"/"+event.Action)
+			}
+		case strings.Contains(request.Query, "logEvent"):
+			s.requests++
+			s.v1 = append(s.v1, request.Variables.Event)
+		}
+		w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *telemetryServer) client() *embeddings.Client {
+	return embeddings.NewClient(s.URL, "", s.Client())
+}
+
+func TestEventLoggerTelemetry(t *testing.T) {
+	for _, test := range []struct {
+		telemetry              string
+		wantServer, wantDotcom int
+	}{
+		{TelemetryOff, 0, 0},
+		{TelemetryInstanceOnly, 2, 0},
+		{TelemetryAll, 2, 2},
+	} {
+		server := newTelemetryServer(t, "5.2.0")
+		dotcom := newTelemetryServer(t, "5.2.0")
+		uidFile := filepath.Join(t.TempDir(), "uid")
+
+		l := NewEventLogger(server.client(), dotcom.client(), server.URL, uidFile, test.telemetry, nil)
+		l.Log("CodyNeovimExtension:hover:executed")
+		l.Flush(context.Background())
+
+		// The first event is CodyInstalled
+		if len(server.v2) != test.wantServer || len(dotcom.v2) != test.wantDotcom {
+			t.Errorf("%s: got %d events on the instance and %d on sourcegraph.com, want %d and %d",
+				test.telemetry, len(server.v2), len(dotcom.v2), test.wantServer, test.wantDotcom)
+		}
+		_, err := os.Stat(uidFile)
+		if created := err == nil; created != (test.telemetry != TelemetryOff) {
+			t.Errorf("%s: UID file created: %v", test.telemetry, created)
+		}
+	}
+}
+
+func TestEventLoggerBatches(t *testing.T) {
+	server := newTelemetryServer(t, "5.2.1")
+	l := NewEventLogger(server.client(), nil, server.URL, filepath.Join(t.TempDir(), "uid"), TelemetryInstanceOnly, nil)
+	l.Log("CodyNeovimExtension:codeAction:cody.chat:executed")
+	l.LogWithArgument("CodyNeovimExtension:completion:accepted", map[string]int{"lines": 2})
+	l.Flush(context.Background())
+
+	want := []string{"cody.extension/installed", "cody.codeAction.chat/executed", "cody.completion/accepted"}
+	if strings.Join(server.v2, " ") != strings.Join(want, " ") {
+		t.Errorf("got events %q, want %q", server.v2, want)
+	}
+	if server.requests != 1 {
+		t.Errorf("got %d requests, want the events in a single one", server.requests)
+	}
+}
+
+func TestEventLoggerV1Fallback(t *testing.T) {
+	server := newTelemetryServer(t, "5.1.9")
+	l := NewEventLogger(server.client(), nil, server.URL, filepath.Join(t.TempDir(), "uid"), TelemetryInstanceOnly, nil)
+	l.Log("CodyNeovimExtension:hover:executed")
+	l.Flush(context.Background())
+
+	want := []string{"CodyInstalled", "CodyNeovimExtension:hover:executed"}
+	if len(server.v2) != 0 || strings.Join(server.v1, " ") != strings.Join(want, " ") {
+		t.Errorf("got V1 events %q and V2 events %q, want V1 events %q", server.v1, server.v2, want)
+	}
+}
+
+func TestEventLoggerUnwritableUIDFile(t *testing.T) {
+	server := newTelemetryServer(t, "5.2.0")
+	uidFile := filepath.Join(t.TempDir(), "missing", "uid")
+	l := NewEventLogger(server.client(), nil, server.URL, uidFile, TelemetryInstanceOnly, nil)
+	l.Flush(context.Background())
+	if l.uid == "" {
+		t.Error("expected a UID for the session")
+	}
+}
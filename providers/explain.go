@@ -0,0 +1,132 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/pjlast/llmsp/claude"
+	"github.com/pjlast/llmsp/internal/prompts"
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/go-lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// explainSelection explains lines startLine through endLine of the document.
+// The explanation is streamed in cody/chat notifications, leaving the
+// document untouched, unless inBuffer is set, in which case it is written as
+// comments above the lines.
+func (l *SourcegraphLLM) explainSelection(ctx context.Context, conn *jsonrpc2.Conn, filename lsp.DocumentURI, startLine, endLine int, inBuffer bool) (*json.RawMessage, error) {
+	l.EventLogger.Log("CodyNeovimExtension:codeAction:cody.explainSelection:executed")
+	text := l.Documents.Text(filename)
+	snippet, err := l.documentLines(filename, startLine, endLine)
+	if err != nil {
+		return nil, err
+	}
+	humanMessage, err := l.prompt(prompts.Explain, prompts.Data{
+		Filename: string(filename),
+		Language: l.documentLanguage(filename),
+		Code:     snippet,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !inBuffer {
+		result, err := l.streamExplanation(ctx, conn, filename, humanMessage, false)
+		if err != nil {
+			return nil, err
+		}
+		return marshalResult(result)
+	}
+
+	params := l.explanationParameters(ctx, filename, humanMessage, "")
+	explanation, err := l.ClaudeClient.GetCompletion(ctx, params, false)
+	if err != nil {
+		return nil, err
+	}
+	prefix := commentPrefix(l.documentLanguage(filename))
+	comment := docStyle{open: prefix, line: prefix + " "}
+	newText := comment.insert(snippet, trimBlankLines(strings.Split(explanation, "\n")))
+
+	return l.applyEdit(ctx, conn, "cody.explainSelection", *lineRangeEdit(filename, text, startLine, endLine, newText))
+}
+
+// explanationParameters returns the parameters of a completion answering
+// humanMessage about the document, with the interaction memory and the
+// embeddings found for the message as context. The answer starts with
+// assistantText.
+func (l *SourcegraphLLM) explanationParameters(ctx context.Context, filename lsp.DocumentURI, humanMessage, assistantText string) *claude.CompletionParameters {
+	embeddings, _ := l.searchEmbeddings(ctx, string(filename), humanMessage, 8, 2)
+	params := l.completionParameters(chatModel, l.getMessages("", humanMessage, embeddings))
+	params.Messages = append(params.Messages, codyDoPreamble(string(filename), l.Documents.Text(filename))...)
+	params.Messages = append(params.Messages, l.memorySnapshot()...)
+	params.Messages = append(params.Messages,
+		claude.Message{
+			Speaker: claude.Human,
+			Text:    humanMessage,
+		},
+		claude.Message{
+			Speaker: claude.Assistant,
+			Text:    assistantText,
+		})
+	return params
+}
+
+// streamExplanation streams the answer to humanMessage in cody/chat
+// notifications and adds the exchange to the interaction memory. If codeOnly
+// is set, the answer is a code block and the stream stops where it ends. It
+// returns the answer along with the embeddings results it is based on.
+func (l *SourcegraphLLM) streamExplanation(ctx context.Context, conn *jsonrpc2.Conn, filename lsp.DocumentURI, humanMessage string, codeOnly bool) (*types.ChatResult, error) {
+	language := strings.ToLower(determineLanguage(string(filename)))
+	var assistantText string
+	if codeOnly {
+		assistantText = fmt.Sprintf("```%s\n", language)
+	}
+
+	params := l.explanationParameters(ctx, filename, humanMessage, assistantText)
+	stream, err := l.streamCompletion(ctx, params, false)
+	if err != nil {
+		if aborted(ctx) {
+			return &types.ChatResult{ContextFiles: contextFiles(params.Messages), Aborted: true}, nil
+		}
+		return nil, err
+	}
+	// Stops the stream if the code block ends before the completion
+	defer stream.Close()
+	chat := &chatStream{conn: conn, deltas: l.StreamDeltas}
+	var finalMessage string
+	for resp := range stream.C {
+		ended := false
+		if codeOnly {
+			if endCodeIndex := strings.Index(resp, "\n```"); endCodeIndex != -1 {
+				resp = resp[:endCodeIndex]
+				ended = true
+			}
+		}
+		finalMessage = resp
+		chat.send(ctx, resp)
+		if ended {
+			break
+		}
+	}
+	stream.Close()
+	// Aborted explanations end where they were stopped
+	if ctx.Err() != nil && !aborted(ctx) {
+		return nil, ctx.Err()
+	}
+	// The stream is canceled if the code block ended early
+	if err := stream.Err(); err != nil && !errors.Is(err, context.Canceled) {
+		return nil, err
+	}
+	chat.finish(ctx, finalMessage)
+	if codeOnly {
+		finalMessage = fmt.Sprintf("```%s\n%s\n```", language, finalMessage)
+	}
+	l.appendMemory(claude.Message{Speaker: claude.Human, Text: humanMessage}, claude.Message{
+		Speaker: claude.Assistant,
+		Text:    finalMessage,
+	})
+	return &types.ChatResult{Message: finalMessage, ContextFiles: contextFiles(params.Messages), Aborted: aborted(ctx)}, nil
+}
@@ -0,0 +1,140 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pjlast/llmsp/claude"
+	"github.com/pjlast/llmsp/internal/i18n"
+)
+
+// feature is a capability of the Sourcegraph instance that isn't supported by
+// every version.
+type feature int
+
+const (
+	// featureEmbeddings is embeddings search.
+	featureEmbeddings feature = iota
+	// featureStreaming is the streaming completions endpoint.
+	featureStreaming
+	// featureModels is choosing the model of completions.
+	featureModels
+)
+
+// featureVersions are the first versions of Sourcegraph supporting the
+// features.
+var featureVersions = map[feature][3]int{
+	featureEmbeddings: {5, 0, 0},
+	featureStreaming:  {5, 0, 0},
+	featureModels:     {5, 1, 0},
+}
+
+// featureMessages explain what happens instead of using the features.
+var featureMessages = map[feature]i18n.Key{
+	featureEmbeddings: i18n.EmbeddingsUnsupported,
+	featureStreaming:  i18n.StreamingUnsupported,
+	featureModels:     i18n.ModelsUnsupported,
+}
+
+// instanceFeatures records the features the Sourcegraph instance supports.
+// The zero value supports every feature.
+type instanceFeatures struct {
+	// version is the product version of the instance, empty if unknown
+	version     string
+	unsupported map[feature]bool
+}
+
+// featuresOf returns the features supported by a version of Sourcegraph.
+func featuresOf(version string) instanceFeatures {
+	features := instanceFeatures{version: version, unsupported: make(map[feature]bool)}
+	for f, min := range featureVersions {
+		if !versionAtLeast(version, min) {
+			features.unsupported[f] = true
+		}
+	}
+	return features
+}
+
+// supports reports whether the instance supports the feature.
+func (f instanceFeatures) supports(feature feature) bool {
+	return !f.unsupported[feature]
+}
+
+// detectFeatures looks up the version of the Sourcegraph instance and the
+// features it supports. If the version can't be looked up, every feature is
+// assumed to be supported.
+func (l *SourcegraphLLM) detectFeatures(ctx context.Context) {
+	version, err := l.EmbeddingsClient.GetVersion(ctx)
+	if err != nil {
+		l.features = instanceFeatures{}
+		return
+	}
+	l.features = featuresOf(version)
+}
+
+// UnsupportedFeatures returns messages explaining which features the
+// Sourcegraph instance doesn't support, and what is done instead. Choosing
+// models is only reported if a model is configured.
+func (l *SourcegraphLLM) UnsupportedFeatures() []string {
+	var messages []string
+	for f := featureEmbeddings; f <= featureModels; f++ {
+		if l.features.supports(f) {
+			continue
+		}
+		if f == featureModels && l.ChatModel == "" && l.CompletionModel == "" && l.EditModel == "" {
+			continue
+		}
+		min := featureVersions[f]
+		messages = append(messages, l.Messages.T(featureMessages[f], fmt.Sprintf("%d.%d.%d", min[0], min[1], min[2]), l.features.version))
+	}
+	return messages
+}
+
+// streamCompletion streams a completion if the instance supports it, and
+// otherwise sends the whole completion when it is complete. The stream must
+// be closed.
+func (l *SourcegraphLLM) streamCompletion(ctx context.Context, params *claude.CompletionParameters, includePromptText bool) (*claude.Stream, error) {
+	if l.features.supports(featureStreaming) {
+		return l.ClaudeClient.StreamCompletion(ctx, params, includePromptText)
+	}
+
+	completion, err := l.ClaudeClient.GetCompletion(ctx, params, includePromptText)
+	if err != nil {
+		return nil, err
+	}
+	return claude.CompletedStream(strings.TrimSuffix(completion, "\n```")), nil
+}
+
+// versionAtLeast reports whether a Sourcegraph version is at least min.
+// Development and insiders builds, whose versions aren't releases, are
+// assumed to be recent.
+func versionAtLeast(version string, min [3]int) bool {
+	version = strings.TrimPrefix(version, "v")
+	if i := strings.IndexAny(version, "-+"); i >= 0 {
+		version = version[:i]
+	}
+	parts := strings.Split(version, ".")
+	if len(parts) != 3 {
+		return true
+	}
+	var release [3]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return true
+		}
+		release[i] = n
+	}
+	if release == [3]int{} {
+		// 0.0.0+dev
+		return true
+	}
+	for i := range release {
+		if release[i] != min[i] {
+			return release[i] > min[i]
+		}
+	}
+	return true
+}
@@ -0,0 +1,87 @@
+package providers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pjlast/llmsp/claude"
+)
+
+func TestVersionAtLeast(t *testing.T) {
+	for version, want := range map[string]bool{
+		"5.2.0":                          true,
+		"5.10.1":                         true,
+		"6.0.0":                          true,
+		"5.1.9":                          false,
+		"4.5.1":                          false,
+		"v5.2.3-rc.1":                    true,
+		"0.0.0+dev":                      true,
+		"235906_2023-10-10_5.2-d1d2b0ab": true,
+	} {
+		if got := versionAtLeast(version, telemetryV2Version); got != want {
+			t.Errorf("versionAtLeast(%q) == %v, want %v", version, got, want)
+		}
+	}
+}
+
+func TestFeaturesOf(t *testing.T) {
+	features := featuresOf("5.0.6")
+	if !features.supports(featureEmbeddings) || !features.supports(featureStreaming) {
+		t.Error("expected 5.0.6 to support embeddings and streaming")
+	}
+	if features.supports(featureModels) {
+		t.Error("expected 5.0.6 not to support choosing models")
+	}
+	if features := featuresOf("4.5.1"); features.supports(featureEmbeddings) || features.supports(featureStreaming) {
+		t.Error("expected 4.5.1 not to support embeddings and streaming")
+	}
+	if !(instanceFeatures{}).supports(featureModels) {
+		t.Error("expected an unknown version to support every feature")
+	}
+}
+
+func TestUnsupportedFeatures(t *testing.T) {
+	l := &SourcegraphLLM{features: featuresOf("5.0.6")}
+	if messages := l.UnsupportedFeatures(); len(messages) != 0 {
+		t.Errorf("got %q, want no messages without a configured model", messages)
+	}
+
+	l.ChatModel = "anthropic/claude-2"
+	messages := l.UnsupportedFeatures()
+	if len(messages) != 1 || !strings.Contains(messages[0], "5.1.0") || !strings.Contains(messages[0], "5.0.6") {
+		t.Errorf("got %q, want a message about choosing models", messages)
+	}
+	if l.model(chatModel) != "" {
+		t.Errorf("got model %q, want the default model of the instance", l.model(chatModel))
+	}
+}
+
+func TestStreamCompletionUnsupported(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.api/graphql" {
+			t.Errorf("got request to %s, want the GraphQL API", r.URL.Path)
+		}
+		w.Write([]byte(`{"data": {"completions": "Hello!\n` + "```" + `"}}`))
+	}))
+	defer server.Close()
+
+	l := &SourcegraphLLM{
+		ClaudeClient: claude.NewClient(server.URL, "", server.Client()),
+		features:     featuresOf("4.5.1"),
+	}
+	stream, err := l.streamCompletion(context.Background(), claude.DefaultCompletionParameters([]claude.Message{{Speaker: claude.Human, Text: "Hi"}}), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var completions []string
+	defer stream.Close()
+	for completion := range stream.C {
+		completions = append(completions, completion)
+	}
+	if len(completions) != 1 || completions[0] != "Hello!" {
+		t.Errorf("got %q, want the whole completion at once", completions)
+	}
+}
@@ -0,0 +1,178 @@
+package providers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pjlast/llmsp/claude"
+)
+
+// maxInteractions is the number of interactions feedback can be given on.
+const maxInteractions = 50
+
+// interaction is a request answered by the LLM.
+type interaction struct {
+	ID      string    `json:"id"`
+	Feature string    `json:"feature"`
+	Time    time.Time `json:"time"`
+	// promptHash is the hash of the last prompt sent for the interaction
+	promptHash string
+}
+
+// interactionLog keeps track of recent interactions, so that feedback sent
+// afterwards can be attributed to the feature that produced the answer.
+type interactionLog struct {
+	mu      sync.Mutex
+	entries []interaction
+	// pending maps the IDs of the interactions in progress to the hash of
+	// the last prompt sent for them, which is empty until a prompt is sent
+	pending map[string]string
+}
+
+// interactionKey is the context key of the ID of the interaction a request
+// belongs to.
+type interactionKey struct{}
+
+// Start starts an interaction and returns its ID along with a context
+// carrying it. The prompts sent with the context are attributed to the
+// interaction. It must be ended with Record or Discard.
+func (log *interactionLog) Start(ctx context.Context) (context.Context, string) {
+	id := uuid.New().String()
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	if log.pending == nil {
+		log.pending = make(map[string]string)
+	}
+	log.pending[id] = ""
+	return context.WithValue(ctx, interactionKey{}, id), id
+}
+
+// Prompt records that a prompt was sent for the interaction of ctx, if any.
+func (log *interactionLog) Prompt(ctx context.Context, messages []claude.Message) {
+	id, _ := ctx.Value(interactionKey{}).(string)
+	if id == "" {
+		return
+	}
+	hash := sha256.New()
+	for _, message := range messages {
+		fmt.Fprintf(hash, "%s:%s\n", message.Speaker, message.Text)
+	}
+
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	if _, ok := log.pending[id]; ok {
+		log.pending[id] = hex.EncodeToString(hash.Sum(nil))
+	}
+}
+
+// Record ends the interaction and records it for the feature if a prompt
+// was sent for it. Requests that didn't involve the LLM aren't recorded.
+// It reports whether the interaction was recorded.
+func (log *interactionLog) Record(id, feature string) bool {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	promptHash, ok := log.pending[id]
+	delete(log.pending, id)
+	if !ok || promptHash == "" {
+		return false
+	}
+
+	log.entries = append(log.entries, interaction{
+		ID:         id,
+		Feature:    feature,
+		Time:       time.Now(),
+		promptHash: promptHash,
+	})
+	if len(log.entries) > maxInteractions {
+		log.entries = log.entries[len(log.entries)-maxInteractions:]
+	}
+	return true
+}
+
+// Discard ends the interaction without recording it.
+func (log *interactionLog) Discard(id string) {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	delete(log.pending, id)
+}
+
+// Find returns the interaction with the given ID, or the last interaction if
+// id is empty.
+func (log *interactionLog) Find(id string) (interaction, error) {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	if len(log.entries) == 0 {
+		return interaction{}, errors.New("there is no interaction to give feedback on")
+	}
+	if id == "" {
+		return log.entries[len(log.entries)-1], nil
+	}
+	for _, entry := range log.entries {
+		if entry.ID == id {
+			return entry, nil
+		}
+	}
+	return interaction{}, fmt.Errorf("unknown interaction %q", id)
+}
+
+// feedbackArgument is the argument of the feedback event.
+type feedbackArgument struct {
+	InteractionID string `json:"interactionID"`
+	Feature       string `json:"feature"`
+	Rating        string `json:"rating"`
+	Comment       string `json:"comment,omitempty"`
+	PromptHash    string `json:"promptHash,omitempty"`
+}
+
+// sendFeedback logs feedback on an interaction. rating is either "up" or
+// "down". The prompt hash is only included if the user opted in to sharing
+// it.
+func (l *SourcegraphLLM) sendFeedback(interactionID, rating, comment string) (interaction, error) {
+	if rating != "up" && rating != "down" {
+		return interaction{}, fmt.Errorf("rating must be %q or %q, got %q", "up", "down", rating)
+	}
+	it, err := l.interactions.Find(interactionID)
+	if err != nil {
+		return interaction{}, err
+	}
+
+	argument := feedbackArgument{
+		InteractionID: it.ID,
+		Feature:       it.Feature,
+		Rating:        rating,
+		Comment:       comment,
+	}
+	if l.SharePromptHash {
+		argument.PromptHash = it.promptHash
+	}
+	l.EventLogger.LogWithArgument("CodyNeovimExtension:feedback:submitted", argument)
+
+	return it, nil
+}
+
+// withInteractionID adds the ID of the interaction that produced the result
+// of a command to it, so that feedback can be given on it. Results that
+// aren't objects are returned as is.
+func withInteractionID(result *json.RawMessage, id string) *json.RawMessage {
+	fields := make(map[string]json.RawMessage)
+	if result != nil && string(*result) != "null" {
+		if err := json.Unmarshal(*result, &fields); err != nil {
+			return result
+		}
+	}
+	fields["interactionID"], _ = json.Marshal(id)
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return result
+	}
+	res := json.RawMessage(data)
+	return &res
+}
@@ -0,0 +1,94 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/pjlast/llmsp/claude"
+)
+
+func TestInteractionLog(t *testing.T) {
+	var log interactionLog
+
+	// Requests that don't build a prompt aren't interactions
+	_, id := log.Start(context.Background())
+	if log.Record(id, "cody.chat/list") {
+		t.Error("recorded an interaction without a prompt")
+	}
+	if _, err := log.Find(""); err == nil {
+		t.Fatal("expected no interactions")
+	}
+
+	// Concurrent interactions are told apart by their context
+	explainCtx, explainID := log.Start(context.Background())
+	fixCtx, fixID := log.Start(context.Background())
+	log.Prompt(fixCtx, []claude.Message{{Speaker: claude.Human, Text: "Fix this"}})
+	log.Prompt(explainCtx, []claude.Message{{Speaker: claude.Human, Text: "Explain this"}})
+	log.Prompt(context.Background(), []claude.Message{{Speaker: claude.Human, Text: "Unrelated"}})
+	if !log.Record(explainID, "cody.explain") || !log.Record(fixID, "cody.fix") {
+		t.Fatal("interactions with a prompt weren't recorded")
+	}
+
+	last, err := log.Find("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last.ID != fixID || last.Feature != "cody.fix" || last.promptHash == "" {
+		t.Errorf("got last interaction %+v, want cody.fix with a prompt hash", last)
+	}
+
+	first, err := log.Find(explainID)
+	if err != nil || first.Feature != "cody.explain" {
+		t.Errorf("Find(%q) == %+v, %v, want cody.explain", explainID, first, err)
+	}
+	if first.promptHash == last.promptHash {
+		t.Error("different prompts have the same hash")
+	}
+	if _, err := log.Find("unknown"); err == nil {
+		t.Error("expected an error for an unknown interaction")
+	}
+
+	ctx, id := log.Start(context.Background())
+	log.Prompt(ctx, []claude.Message{{Speaker: claude.Human, Text: "Fail"}})
+	log.Discard(id)
+	if log.Record(id, "cody.fix") || len(log.pending) != 0 {
+		t.Error("recorded a discarded interaction")
+	}
+}
+
+func TestWithInteractionID(t *testing.T) {
+	object := json.RawMessage(`{"message":"Done"}`)
+	array := json.RawMessage(`["a"]`)
+	tests := []struct {
+		result *json.RawMessage
+		want   string
+	}{
+		{nil, `{"interactionID":"42"}`},
+		{&object, `{"interactionID":"42","message":"Done"}`},
+		{&array, `["a"]`},
+	}
+	for _, test := range tests {
+		if got := withInteractionID(test.result, "42"); string(*got) != test.want {
+			t.Errorf("withInteractionID() == %s, want %s", *got, test.want)
+		}
+	}
+}
+
+func TestSendFeedback(t *testing.T) {
+	l := &SourcegraphLLM{EventLogger: &eventLogger{}}
+	ctx, id := l.interactions.Start(context.Background())
+	l.interactions.Prompt(ctx, []claude.Message{{Speaker: claude.Human, Text: "Hi"}})
+	l.interactions.Record(id, "cody.chat/message")
+
+	if _, err := l.sendFeedback("", "sideways", ""); err == nil {
+		t.Error("expected an error for an invalid rating")
+	}
+	it, err := l.sendFeedback("", "up", "Great answer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if it.Feature != "cody.chat/message" {
+		t.Errorf("got feedback on %q, want cody.chat/message", it.Feature)
+	}
+}
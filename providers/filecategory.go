@@ -0,0 +1,129 @@
+package providers
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/pjlast/llmsp/claude"
+	"github.com/sourcegraph/go-lsp"
+)
+
+// fileCategory is the broad category of a file, which determines how the
+// LLM is instructed to work with it.
+type fileCategory int
+
+const (
+	sourceFile fileCategory = iota
+	testFile
+	configFile
+	docsFile
+)
+
+var configExtensions = map[string]bool{
+	".yaml": true, ".yml": true, ".json": true, ".toml": true, ".ini": true,
+	".cfg": true, ".conf": true, ".env": true, ".properties": true, ".xml": true,
+}
+
+var configFileNames = map[string]bool{
+	"Dockerfile": true, "Makefile": true, "go.mod": true, ".gitignore": true,
+	".editorconfig": true, "docker-compose.yml": true,
+}
+
+var docsExtensions = map[string]bool{
+	".md": true, ".markdown": true, ".rst": true, ".txt": true, ".adoc": true,
+}
+
+// classifyFile returns the category of the file, based on its name.
+func classifyFile(filename string) fileCategory {
+	filename = strings.TrimPrefix(filename, "file://")
+	base := path.Base(filename)
+	ext := path.Ext(base)
+	name := strings.TrimSuffix(base, ext)
+
+	switch {
+	case docsExtensions[strings.ToLower(ext)]:
+		return docsFile
+	case configFileNames[base] || configExtensions[strings.ToLower(ext)]:
+		return configFile
+	}
+
+	if strings.HasSuffix(name, "_test") || strings.HasSuffix(name, ".test") ||
+		strings.HasSuffix(name, ".spec") || strings.HasSuffix(name, "_spec") ||
+		strings.HasPrefix(name, "test_") || strings.HasSuffix(name, "Test") ||
+		strings.HasSuffix(name, "Tests") {
+		return testFile
+	}
+	for _, dir := range strings.Split(path.Dir(filename), "/") {
+		if dir == "__tests__" {
+			return testFile
+		}
+	}
+
+	return sourceFile
+}
+
+// categoryInstructions returns the instructions for working with files of the
+// category of filename, or an empty string for regular source files.
+func categoryInstructions(filename string) string {
+	language := determineLanguage(filename)
+	switch classifyFile(filename) {
+	case testFile:
+		_, framework := testFileFor(lsp.DocumentURI(filename))
+		instructions := fmt.Sprintf("This is a %s test file. Write tests using %s and match the style of the existing tests.", language, framework)
+		if language == "Go" {
+			instructions += " Prefer table-driven tests and use t.Errorf over t.Fatalf unless the test can't continue."
+		}
+		return instructions
+
+	case configFile:
+		instructions := "This is a configuration file. Only change what is asked for, keep the file syntactically valid and preserve existing comments, ordering and indentation."
+		switch strings.ToLower(path.Ext(filename)) {
+		case ".yaml", ".yml":
+			instructions += " Indent with spaces, never tabs, and quote values that YAML would otherwise misinterpret, such as `yes`, `no`, `on` and version numbers."
+		case ".json":
+			instructions += " Don't add comments or trailing commas."
+		}
+		return instructions
+
+	case docsFile:
+		return "This is a documentation file. Write clear, concise prose for the reader and keep the existing formatting conventions."
+	}
+
+	return ""
+}
+
+// categoryMessages returns the messages instructing the LLM how to work with
+// files of the category of filename.
+func categoryMessages(filename string) []claude.Message {
+	instructions := categoryInstructions(filename)
+	if instructions == "" {
+		return nil
+	}
+
+	return []claude.Message{
+		{
+			Speaker: claude.Human,
+			Text:    instructions,
+		},
+		{
+			Speaker: claude.Assistant,
+			Text:    "Ok.",
+		},
+	}
+}
+
+// completionInstruction returns the instruction for completing code in
+// filename.
+func completionInstruction(filename string) string {
+	switch classifyFile(filename) {
+	case testFile:
+		return fmt.Sprintf("Suggest a %s test snippet to complete the following code, following the style of the existing tests. Continue from where I left off:", determineLanguage(filename))
+	case configFile:
+		return "Suggest how to complete the following configuration, keeping it syntactically valid. Continue from where I left off:"
+	case docsFile:
+		return "Suggest how to complete the following documentation. Continue from where I left off:"
+	}
+
+	return fmt.Sprintf("Suggest a %s code snippet to complete the following code. Continue from where I left off:", determineLanguage(filename))
+}
@@ -0,0 +1,38 @@
+package providers
+
+import "testing"
+
+func TestClassifyFile(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     fileCategory
+	}{
+		{"file:///src/main.go", sourceFile},
+		{"file:///src/main_test.go", testFile},
+		{"file:///src/test_main.py", testFile},
+		{"file:///src/App.test.tsx", testFile},
+		{"file:///src/FooTest.java", testFile},
+		{"file:///src/__tests__/app.js", testFile},
+		{"file:///deploy/values.yaml", configFile},
+		{"file:///package.json", configFile},
+		{"file:///Dockerfile", configFile},
+		{"file:///go.mod", configFile},
+		{"file:///README.md", docsFile},
+		{"file:///docs/guide.rst", docsFile},
+	}
+
+	for _, test := range tests {
+		if got := classifyFile(test.filename); got != test.want {
+			t.Errorf("classifyFile(%q) == %d, want %d", test.filename, got, test.want)
+		}
+	}
+}
+
+func TestCategoryMessages(t *testing.T) {
+	if messages := categoryMessages("file:///src/main.go"); messages != nil {
+		t.Errorf("expected no messages for a source file, got %v", messages)
+	}
+	if messages := categoryMessages("file:///src/main_test.go"); len(messages) != 2 {
+		t.Errorf("expected instructions for a test file, got %v", messages)
+	}
+}
@@ -0,0 +1,71 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pjlast/llmsp/claude"
+	"github.com/sourcegraph/go-lsp"
+)
+
+// maxGitDiffTokens is the maximum length of the diff of the current file in
+// chat prompts.
+const maxGitDiffTokens = 2000
+
+// changeMention matches chat messages asking about the current changes.
+// Messages can also mention @diff explicitly.
+var changeMention = regexp.MustCompile(`(?i)\b(this|these|my) changes?\b`)
+
+// mentionsChange reports whether a chat message asks about the uncommitted
+// changes.
+func mentionsChange(message string) bool {
+	return changeMention.MatchString(message)
+}
+
+// gitContextMessages returns messages with the uncommitted changes to the
+// file, from git diff HEAD, and the last commits of its repository, from
+// git log -3 --oneline. It returns nil if the file isn't in a git
+// repository.
+func gitContextMessages(ctx context.Context, filename lsp.DocumentURI) []claude.Message {
+	path := strings.TrimPrefix(string(filename), "file://")
+	dir, name := filepath.Dir(path), filepath.Base(path)
+
+	log, err := runGit(ctx, dir, "log", "-3", "--oneline")
+	if err != nil {
+		return nil
+	}
+	text := fmt.Sprintf("Here are the last commits of the repository:\n%s", log)
+	if diff, err := runGit(ctx, dir, "diff", "HEAD", "--", name); err == nil && diff != "" {
+		diff, _ = truncateText(diff, maxGitDiffTokens)
+		text = fmt.Sprintf("Here are the uncommitted changes to `%s`:\n```diff\n%s\n```\n\n%s", path, diff, text)
+	} else {
+		text = fmt.Sprintf("There are no uncommitted changes to `%s`.\n\n%s", path, text)
+	}
+
+	return []claude.Message{
+		{
+			Speaker: claude.Human,
+			Text:    text,
+			Source:  &claude.Source{Kind: "git", File: path},
+		},
+		{
+			Speaker: claude.Assistant,
+			Text:    "Ok.",
+		},
+	}
+}
+
+// runGit runs git in dir and returns its trimmed output.
+func runGit(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
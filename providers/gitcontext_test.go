@@ -0,0 +1,60 @@
+package providers
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sourcegraph/go-lsp"
+)
+
+func TestMentionsChange(t *testing.T) {
+	for message, want := range map[string]bool{
+		"Does this change break anything?":   true,
+		"Can you review these changes":       true,
+		"Is my change correct?":              true,
+		"How do I change the timeout?":       false,
+		"Explain what this function returns": false,
+	} {
+		if got := mentionsChange(message); got != want {
+			t.Errorf("mentionsChange(%q) == %v, want %v", message, got, want)
+		}
+	}
+}
+
+func TestGitContextMessages(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed")
+	}
+	dir := t.TempDir()
+	file := filepath.Join(dir, "main.go")
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+	if messages := gitContextMessages(context.Background(), lsp.DocumentURI("file://"+file)); messages != nil {
+		t.Errorf("gitContextMessages() outside of a repository == %+v, want nil", messages)
+	}
+
+	git("init", "-q")
+	os.WriteFile(file, []byte("package main\n"), 0o644)
+	git("add", "main.go")
+	git("commit", "-q", "-m", "Add main")
+	os.WriteFile(file, []byte("package main\n\nfunc main() {}\n"), 0o644)
+
+	messages := gitContextMessages(context.Background(), lsp.DocumentURI("file://"+file))
+	if len(messages) != 2 {
+		t.Fatalf("gitContextMessages() == %+v, want a message and its answer", messages)
+	}
+	for _, want := range []string{"+func main() {}", "Add main"} {
+		if !strings.Contains(messages[0].Text, want) {
+			t.Errorf("git context %q doesn't contain %q", messages[0].Text, want)
+		}
+	}
+}
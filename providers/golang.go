@@ -0,0 +1,183 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pjlast/llmsp/claude"
+	"github.com/pjlast/llmsp/internal/position"
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/go-lsp"
+)
+
+const (
+	// goContextTTL is how long the output of go list and go doc is cached.
+	goContextTTL = 30 * time.Second
+	// maxGoContextTokens is the maximum length of the Go package context.
+	maxGoContextTokens = 1000
+)
+
+// goListFormat is the go list template used to describe a package.
+const goListFormat = `Package {{.ImportPath}} ({{.Name}})
+Files: {{join .GoFiles " "}}
+Test files: {{join .TestGoFiles " "}} {{join .XTestGoFiles " "}}
+Excluded by build constraints: {{join .IgnoredGoFiles " "}}
+Imports: {{join .Imports " "}}`
+
+// goContext caches the package context of Go directories.
+type goContext struct {
+	mu      sync.Mutex
+	entries map[string]goContextEntry
+}
+
+type goContextEntry struct {
+	text    string
+	fetched time.Time
+}
+
+// packageContext returns a description of the Go package in dir, built from
+// the output of go list and go doc. The go command runs without holding the
+// lock, so that looking up one directory doesn't hold up the others. Failures,
+// e.g. because the request was cancelled, aren't cached.
+func (c *goContext) packageContext(ctx context.Context, dir string) string {
+	c.mu.Lock()
+	entry, ok := c.entries[dir]
+	c.mu.Unlock()
+	if ok && time.Since(entry.fetched) < goContextTTL {
+		return entry.text
+	}
+
+	list, err := runGo(ctx, dir, "list", "-f", goListFormat, ".")
+	if err != nil {
+		return ""
+	}
+	parts := []string{list}
+	if doc, err := runGo(ctx, dir, "doc", "-short", "."); err == nil && doc != "" {
+		parts = append(parts, "Package API:\n"+doc)
+	}
+	text, _ := truncateText(strings.Join(parts, "\n\n"), maxGoContextTokens)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]goContextEntry)
+	}
+	c.entries[dir] = goContextEntry{text: text, fetched: time.Now()}
+	return text
+}
+
+// clear drops the cached package contexts.
+func (c *goContext) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = nil
+}
+
+// runGo runs the go command in dir and returns its trimmed output.
+func runGo(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// buildConstraint returns the //go:build constraint of the Go file, if any.
+func buildConstraint(contents string) string {
+	for _, line := range strings.Split(contents, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "//go:build ") {
+			return strings.TrimPrefix(line, "//go:build ")
+		}
+		if strings.HasPrefix(line, "package ") {
+			break
+		}
+	}
+	return ""
+}
+
+// goContextMessages returns the messages describing the Go package that
+// filename belongs to. It returns nil unless the enhanced Go integration is
+// enabled and filename is a Go file on disk.
+func (l *SourcegraphLLM) goContextMessages(ctx context.Context, filename, contents string) []claude.Message {
+	if !l.GoEnhanced || determineLanguage(filename) != "Go" || !strings.HasPrefix(filename, "file://") {
+		return nil
+	}
+
+	text := l.goContext.packageContext(ctx, filepath.Dir(strings.TrimPrefix(filename, "file://")))
+	if constraint := buildConstraint(contents); constraint != "" {
+		text += fmt.Sprintf("\n\nThe current file is only built when the constraint `%s` is satisfied.", constraint)
+	}
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+
+	return []claude.Message{
+		{
+			Speaker: claude.Human,
+			Text:    fmt.Sprintf("Here is information about the Go package of the file we are in:\n%s", text),
+			Source:  &claude.Source{Kind: "goPackage", File: filepath.Dir(strings.TrimPrefix(filename, "file://"))},
+		},
+		{
+			Speaker: claude.Assistant,
+			Text:    "Ok.",
+		},
+	}
+}
+
+// validateGoEdit applies the edit to the Go files it touches and checks that
+// the results still parse. Edits to other files are not checked.
+func (l *SourcegraphLLM) validateGoEdit(edit *types.WorkspaceEdit) error {
+	if !l.GoEnhanced {
+		return nil
+	}
+
+	for _, change := range edit.DocumentChanges {
+		docEdit, ok := change.(types.TextDocumentEdit)
+		if !ok || determineLanguage(string(docEdit.TextDocument.URI)) != "Go" {
+			continue
+		}
+
+		contents := applyTextEdits(l.Documents.Text(docEdit.TextDocument.URI), docEdit.Edits)
+		if _, err := parser.ParseFile(token.NewFileSet(), filepath.Base(string(docEdit.TextDocument.URI)), contents, parser.AllErrors); err != nil {
+			return fmt.Errorf("generated code for %s does not parse: %w", docEdit.TextDocument.URI, err)
+		}
+	}
+
+	return nil
+}
+
+// applyTextEdits applies non-overlapping text edits to contents.
+func applyTextEdits(contents string, edits []lsp.TextEdit) string {
+	sorted := append([]lsp.TextEdit(nil), edits...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i].Range.Start, sorted[j].Range.Start
+		return a.Line > b.Line || (a.Line == b.Line && a.Character > b.Character)
+	})
+
+	for _, edit := range sorted {
+		start := position.Offset(contents, edit.Range.Start)
+		end := position.Offset(contents, edit.Range.End)
+		if end < start {
+			end = start
+		}
+		var buf bytes.Buffer
+		buf.WriteString(contents[:start])
+		buf.WriteString(edit.NewText)
+		buf.WriteString(contents[end:])
+		contents = buf.String()
+	}
+
+	return contents
+}
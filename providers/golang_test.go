@@ -0,0 +1,90 @@
+package providers
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/pjlast/llmsp/internal/documents"
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/go-lsp"
+)
+
+func TestBuildConstraint(t *testing.T) {
+	tests := []struct {
+		contents string
+		want     string
+	}{
+		{"//go:build linux && amd64\n\npackage foo\n", "linux && amd64"},
+		{"package foo\n\n//go:build linux\n", ""},
+		{"package foo\n", ""},
+	}
+
+	for _, test := range tests {
+		if got := buildConstraint(test.contents); got != test.want {
+			t.Errorf("buildConstraint(%q) == %q, want %q", test.contents, got, test.want)
+		}
+	}
+}
+
+func TestApplyTextEdits(t *testing.T) {
+	contents := "package foo\n\nfunc a() {}\n\nfunc b() {}"
+	edits := []lsp.TextEdit{
+		{
+			Range:   lsp.Range{Start: lsp.Position{Line: 2}, End: lsp.Position{Line: 2, Character: 11}},
+			NewText: "func a() int { return 1 }",
+		},
+		{
+			Range:   lsp.Range{Start: lsp.Position{Line: 4, Character: 5}, End: lsp.Position{Line: 4, Character: 6}},
+			NewText: "c",
+		},
+	}
+
+	want := "package foo\n\nfunc a() int { return 1 }\n\nfunc c() {}"
+	if got := applyTextEdits(contents, edits); got != want {
+		t.Errorf("applyTextEdits() == %q, want %q", got, want)
+	}
+}
+
+func TestValidateGoEdit(t *testing.T) {
+	uri := lsp.DocumentURI("file:///src/foo.go")
+	l := &SourcegraphLLM{
+		GoEnhanced: true,
+		Documents:  documents.FromMap(types.MemoryFileMap{uri: "package foo\n\nfunc a() {}"}),
+	}
+
+	if err := l.validateGoEdit(lineRangeEdit(uri, l.Documents.Text(uri), 2, 2, "func a() int { return 1 }")); err != nil {
+		t.Errorf("unexpected error for valid code: %v", err)
+	}
+	if err := l.validateGoEdit(lineRangeEdit(uri, l.Documents.Text(uri), 2, 2, "func a() {")); err == nil {
+		t.Error("expected an error for code that doesn't parse")
+	}
+
+	l.GoEnhanced = false
+	if err := l.validateGoEdit(lineRangeEdit(uri, l.Documents.Text(uri), 2, 2, "func a() {")); err != nil {
+		t.Errorf("expected no validation when disabled, got %v", err)
+	}
+}
+
+func TestApplyEditValidatesGo(t *testing.T) {
+	uri := lsp.DocumentURI("file:///src/foo.go")
+	l := &SourcegraphLLM{
+		GoEnhanced: true,
+		Documents:  documents.FromMap(types.MemoryFileMap{uri: "package foo\n\nfunc a() {}"}),
+	}
+
+	// The edit is rejected before it is sent to the client
+	if _, err := l.applyEdit(context.Background(), nil, "cody.edit", *lineRangeEdit(uri, l.Documents.Text(uri), 2, 2, "func a() {")); err == nil {
+		t.Error("applyEdit() of code that doesn't parse succeeded, want an error")
+	}
+}
+
+func TestPackageContextDoesNotCacheFailures(t *testing.T) {
+	var c goContext
+	if text := c.packageContext(context.Background(), filepath.Join(t.TempDir(), "missing")); text != "" {
+		t.Errorf("packageContext() of a missing directory == %q, want nothing", text)
+	}
+	if len(c.entries) != 0 {
+		t.Errorf("packageContext() cached %d failed lookups, want none", len(c.entries))
+	}
+}
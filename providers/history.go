@@ -0,0 +1,166 @@
+package providers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pjlast/llmsp/claude"
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/go-lsp"
+)
+
+const (
+	// historyScheme is the URI scheme of the read-only history documents.
+	historyScheme = "llmsp-history"
+	// completionHistoryURI is the URI of the document listing past completions.
+	completionHistoryURI = historyScheme + "://completions"
+	// maxCompletionHistory is the number of completions kept in the history.
+	maxCompletionHistory = 100
+	// maxHistoryMatches is the number of matching lines returned per document
+	// when searching the history.
+	maxHistoryMatches = 5
+)
+
+// CompletionRecord is a completion returned to the editor.
+type CompletionRecord struct {
+	Time       time.Time       `json:"time"`
+	URI        lsp.DocumentURI `json:"uri"`
+	Line       int             `json:"line"`
+	Completion string          `json:"completion"`
+}
+
+// recordCompletion adds a completion to the completion history, dropping the
+// oldest entry if the history is full.
+func (l *SourcegraphLLM) recordCompletion(uri lsp.DocumentURI, line int, completion string) {
+	l.Mu.Lock()
+	defer l.Mu.Unlock()
+
+	l.CompletionHistory = append(l.CompletionHistory, CompletionRecord{
+		Time:       time.Now(),
+		URI:        uri,
+		Line:       line,
+		Completion: completion,
+	})
+	if len(l.CompletionHistory) > maxCompletionHistory {
+		l.CompletionHistory = l.CompletionHistory[len(l.CompletionHistory)-maxCompletionHistory:]
+	}
+}
+
+func sessionHistoryURI(id string) string {
+	return fmt.Sprintf("%s://sessions/%s", historyScheme, id)
+}
+
+// sessionMarkdown renders a chat session as a Markdown document.
+func sessionMarkdown(session *ChatSession) string {
+	title := session.Title
+	if title == "" {
+		title = "Untitled conversation"
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# %s\n\n_Started %s_\n", title, session.CreatedAt.Format(time.RFC1123))
+	for _, message := range session.InteractionMemory {
+		speaker := "Cody"
+		if message.Speaker == claude.Human {
+			speaker = "You"
+		}
+		fmt.Fprintf(&sb, "\n## %s\n\n%s\n", speaker, strings.TrimSpace(message.Text))
+	}
+
+	return sb.String()
+}
+
+// completionHistoryMarkdown renders the completion history as a Markdown
+// document, most recent first.
+func (l *SourcegraphLLM) completionHistoryMarkdown() string {
+	var sb strings.Builder
+	sb.WriteString("# Completions\n")
+	for i := len(l.CompletionHistory) - 1; i >= 0; i-- {
+		record := l.CompletionHistory[i]
+		fmt.Fprintf(&sb, "\n## %s:%d\n\n_%s_\n\n```%s\n%s\n```\n",
+			strings.TrimPrefix(string(record.URI), "file://"), record.Line+1,
+			record.Time.Format(time.RFC1123),
+			strings.ToLower(determineLanguage(string(record.URI))), record.Completion)
+	}
+
+	return sb.String()
+}
+
+// historyDocuments returns all history documents. The caller must hold l.Mu.
+func (l *SourcegraphLLM) historyDocuments() []types.HistoryDocument {
+	l.syncSession()
+
+	sessions := make([]*ChatSession, 0, len(l.Sessions))
+	for _, session := range l.Sessions {
+		sessions = append(sessions, session)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.After(sessions[j].CreatedAt)
+	})
+
+	var documents []types.HistoryDocument
+	for _, session := range sessions {
+		title := session.Title
+		if title == "" {
+			title = "Untitled conversation"
+		}
+		documents = append(documents, types.HistoryDocument{
+			URI:     lsp.DocumentURI(sessionHistoryURI(session.ID)),
+			Title:   title,
+			Content: sessionMarkdown(session),
+		})
+	}
+	documents = append(documents, types.HistoryDocument{
+		URI:     completionHistoryURI,
+		Title:   "Completions",
+		Content: l.completionHistoryMarkdown(),
+	})
+
+	return documents
+}
+
+// ListHistory returns the history documents, without their contents. If query
+// is not empty, only documents containing query are returned, along with the
+// matching lines.
+func (l *SourcegraphLLM) ListHistory(query string) []types.HistoryDocument {
+	l.Mu.Lock()
+	defer l.Mu.Unlock()
+
+	query = strings.ToLower(query)
+	documents := []types.HistoryDocument{}
+	for _, document := range l.historyDocuments() {
+		if query != "" {
+			for _, line := range strings.Split(document.Content, "\n") {
+				if len(document.Matches) == maxHistoryMatches {
+					break
+				}
+				if strings.Contains(strings.ToLower(line), query) {
+					document.Matches = append(document.Matches, strings.TrimSpace(line))
+				}
+			}
+			if len(document.Matches) == 0 {
+				continue
+			}
+		}
+		document.Content = ""
+		documents = append(documents, document)
+	}
+
+	return documents
+}
+
+// GetHistoryDocument returns the history document with the given URI.
+func (l *SourcegraphLLM) GetHistoryDocument(uri lsp.DocumentURI) (*types.HistoryDocument, error) {
+	l.Mu.Lock()
+	defer l.Mu.Unlock()
+
+	for _, document := range l.historyDocuments() {
+		if document.URI == uri {
+			return &document, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown history document %q", uri)
+}
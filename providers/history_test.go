@@ -0,0 +1,41 @@
+package providers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pjlast/llmsp/claude"
+)
+
+func TestHistory(t *testing.T) {
+	l := &SourcegraphLLM{}
+	session := l.NewSession("")
+	l.InteractionMemory = append(l.InteractionMemory,
+		claude.Message{Speaker: claude.Human, Text: "What does the router do?"},
+		claude.Message{Speaker: claude.Assistant, Text: "It dispatches JSON-RPC requests."})
+	l.NewSession("")
+	l.recordCompletion("file:///tmp/main.go", 3, "fmt.Println()")
+
+	documents := l.ListHistory("dispatches")
+	if len(documents) != 1 {
+		t.Fatalf("got %d documents, want 1", len(documents))
+	}
+	if want := sessionHistoryURI(session.ID); string(documents[0].URI) != want {
+		t.Errorf("URI == %q, want %q", documents[0].URI, want)
+	}
+	if len(documents[0].Matches) != 1 || documents[0].Content != "" {
+		t.Errorf("unexpected document %+v", documents[0])
+	}
+
+	if documents := l.ListHistory(""); len(documents) != 3 {
+		t.Errorf("got %d documents, want 3", len(documents))
+	}
+
+	document, err := l.GetHistoryDocument(completionHistoryURI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(document.Content, "```go\nfmt.Println()\n```") {
+		t.Errorf("completion missing from history document:\n%s", document.Content)
+	}
+}
@@ -0,0 +1,49 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pjlast/llmsp/claude"
+	"github.com/sourcegraph/go-lsp"
+)
+
+// Hover returns a Markdown explanation of the symbol under the cursor. If
+// there is no symbol under the cursor, the line is explained instead.
+func (l *SourcegraphLLM) Hover(ctx context.Context, uri lsp.DocumentURI, symbol, line string) (string, error) {
+	ctx, cancel := l.withTimeout(ctx, "hover")
+	defer cancel()
+	l.EventLogger.Log("CodyNeovimExtension:hover:executed")
+
+	language := determineLanguage(string(uri))
+	var instruction string
+	if symbol != "" {
+		instruction = fmt.Sprintf("Briefly explain what `%s` is and does in the following line of %s code:", symbol, language)
+	} else {
+		instruction = fmt.Sprintf("Briefly explain what the following line of %s code does:", language)
+	}
+
+	input := []claude.Message{
+		{
+			Speaker: claude.Human,
+			Text: fmt.Sprintf(`%s
+`+"```%s"+`
+%s
+`+"```"+`
+
+Reply with a short explanation in Markdown, suitable for a tooltip in a code editor.`, instruction, strings.ToLower(language), line),
+		},
+		{
+			Speaker: claude.Assistant,
+			Text:    "",
+		},
+	}
+	params := l.completionParameters(chatModel, l.AddContext(ctx, chatModel, input, string(uri), l.Documents.Text(uri)))
+	explanation, err := l.ClaudeClient.GetCompletion(ctx, params, true)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(explanation), nil
+}
@@ -0,0 +1,106 @@
+package providers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pjlast/llmsp/claude"
+	"github.com/pjlast/llmsp/internal/ignore"
+	"github.com/pjlast/llmsp/sourcegraph/embeddings"
+)
+
+// loadIgnoreRules compiles the ignore patterns of the settings and of the
+// .codyignore files at the root of the workspace folders. The patterns of a
+// folder's file apply to the files of all folders.
+func (l *SourcegraphLLM) loadIgnoreRules() {
+	patterns := append([]string(nil), l.ContextIgnore...)
+	for _, root := range l.workspaceFolderPaths() {
+		data, err := os.ReadFile(filepath.Join(root, ignore.FileName))
+		if err != nil {
+			continue
+		}
+		patterns = append(patterns, ignore.Parse(string(data))...)
+	}
+	l.ignoreRules.Store(ignore.New(patterns))
+}
+
+// ignored reports whether the file, a path or URI, must be kept out of
+// prompts.
+func (l *SourcegraphLLM) ignored(filename string) bool {
+	return l.ignoredPath(filename, false)
+}
+
+// ignoredPath reports whether the file or directory must be kept out of
+// prompts. Absolute paths are matched relative to the workspace folder
+// containing them, other paths, like the file names of embeddings results,
+// and files outside the workspace folders are matched as they are.
+func (l *SourcegraphLLM) ignoredPath(path string, isDir bool) bool {
+	rules := l.ignoreRules.Load()
+	if rules == nil {
+		return false
+	}
+
+	path = strings.TrimPrefix(path, "file://")
+	if filepath.IsAbs(path) {
+		relative := path
+		for _, root := range l.workspaceFolderPaths() {
+			// Prefer the innermost folder, for nested folders
+			if rel, err := filepath.Rel(root, path); err == nil && !strings.HasPrefix(rel, "..") && len(rel) < len(relative) {
+				relative = rel
+			}
+		}
+		path = relative
+	}
+	return rules.Match(filepath.ToSlash(path), isDir)
+}
+
+// withoutIgnored returns the embeddings results, leaving out those of
+// ignored files.
+func (l *SourcegraphLLM) withoutIgnored(results []embeddings.EmbeddingsResult) []embeddings.EmbeddingsResult {
+	var kept []embeddings.EmbeddingsResult
+	for _, result := range results {
+		if !l.ignored(result.FileName) {
+			kept = append(kept, result)
+		}
+	}
+	return kept
+}
+
+// ignoredSource reports whether the context of a message comes from an
+// ignored file. Mentioned symbols and repositories aren't files.
+func (l *SourcegraphLLM) ignoredSource(source *claude.Source) bool {
+	if source == nil || source.File == "" {
+		return false
+	}
+	switch source.Kind {
+	case "symbol", "repo":
+		return false
+	case "goPackage":
+		return l.ignoredPath(source.File, true)
+	}
+	return l.ignored(source.File)
+}
+
+// preparePrompt drops the context of ignored files from a prompt before it
+// is sent, and reports the context that is left. It catches context that
+// slipped through the filters of the individual context sources, such as
+// files mentioned in chat. The prompt is attributed to the interaction of ctx.
+func (l *SourcegraphLLM) preparePrompt(ctx context.Context, params *claude.CompletionParameters) {
+	messages := make([]claude.Message, 0, len(params.Messages))
+	for i := 0; i < len(params.Messages); i++ {
+		message := params.Messages[i]
+		if message.Speaker == claude.Human && l.ignoredSource(message.Source) {
+			// Drop the acknowledgment of the context too
+			if next := i + 1; next < len(params.Messages) && params.Messages[next].Speaker == claude.Assistant && params.Messages[next].Text == "Ok." {
+				i++
+			}
+			continue
+		}
+		messages = append(messages, message)
+	}
+	params.Messages = messages
+	l.reportContext(params)
+	l.interactions.Prompt(ctx, params.Messages)
+}
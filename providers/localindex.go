@@ -0,0 +1,98 @@
+package providers
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+
+	"github.com/pjlast/llmsp/internal/ignore"
+	"github.com/pjlast/llmsp/internal/index"
+	"github.com/pjlast/llmsp/sourcegraph/embeddings"
+	"github.com/sourcegraph/go-lsp"
+)
+
+// buildLocalIndex indexes the workspace folders in the background, so there
+// is context to search when Sourcegraph has no embeddings for the workspace.
+func (l *SourcegraphLLM) buildLocalIndex() {
+	roots := l.workspaceFolderPaths()
+	l.Tasks.Go("build local index", func(context.Context) {
+		ix := index.Build(roots, l.ignoredPath)
+
+		l.Mu.Lock()
+		defer l.Mu.Unlock()
+		l.localIndex = ix
+	})
+}
+
+// DocumentSaved re-indexes a saved document, if the local index is in use.
+func (l *SourcegraphLLM) DocumentSaved(uri lsp.DocumentURI) {
+	doc, ok := l.Documents.Get(uri)
+	if !ok || !doc.Saved {
+		return
+	}
+	if filepath.Base(string(uri)) == ignore.FileName {
+		// Files that are no longer ignored need to be indexed, and newly
+		// ignored files dropped
+		l.loadIgnoreRules()
+		l.buildLocalIndex()
+		return
+	}
+	if l.ignored(string(uri)) {
+		return
+	}
+	l.Mu.Lock()
+	ix := l.localIndex
+	l.Mu.Unlock()
+	if ix == nil {
+		return
+	}
+
+	path := strings.TrimPrefix(string(uri), "file://")
+	for _, root := range l.workspaceFolderPaths() {
+		// Files are indexed by their path relative to their workspace folder
+		name, err := filepath.Rel(root, path)
+		if err != nil || strings.HasPrefix(name, "..") {
+			continue
+		}
+		ix.Add(filepath.ToSlash(name), doc.Text)
+		return
+	}
+}
+
+// searchLocalIndex searches the local index the same way embeddings are
+// searched. Chunks of documentation files are returned as text results, all
+// others as code results. It returns nil if the index hasn't been built yet,
+// or is being rebuilt after it was dropped while idle.
+func (l *SourcegraphLLM) searchLocalIndex(query string, codeResults, textResults int) *embeddings.EmbeddingsSearchResult {
+	l.Mu.Lock()
+	ix := l.localIndex
+	rebuild := l.localIndexDropped
+	l.localIndexDropped = false
+	l.Mu.Unlock()
+	if rebuild {
+		l.buildLocalIndex()
+	}
+	if ix == nil {
+		return nil
+	}
+
+	var results embeddings.EmbeddingsSearchResult
+	// Search for more chunks than needed, as they still need to be split up
+	// into code and text results
+	for _, chunk := range ix.Search(query, 2*(codeResults+textResults)) {
+		result := embeddings.EmbeddingsResult{
+			FileName:  chunk.FileName,
+			StartLine: chunk.StartLine,
+			EndLine:   chunk.EndLine,
+			Content:   chunk.Content,
+		}
+		if classifyFile(chunk.FileName) == docsFile {
+			if len(results.TextResults) < textResults {
+				results.TextResults = append(results.TextResults, result)
+			}
+		} else if len(results.CodeResults) < codeResults {
+			results.CodeResults = append(results.CodeResults, result)
+		}
+	}
+	return &results
+}
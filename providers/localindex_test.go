@@ -0,0 +1,40 @@
+package providers
+
+import (
+	"testing"
+
+	"github.com/pjlast/llmsp/internal/documents"
+	"github.com/pjlast/llmsp/internal/index"
+	"github.com/sourcegraph/go-lsp"
+)
+
+func TestSearchLocalIndex(t *testing.T) {
+	l := &SourcegraphLLM{}
+	if got := l.searchLocalIndex("retry", 8, 2); got != nil {
+		t.Errorf("searchLocalIndex() == %+v before the index was built, want nil", got)
+	}
+
+	l.localIndex = index.New()
+	l.localIndex.Add("client/retry.go", "package client\n\nfunc retry() {}")
+	l.localIndex.Add("docs/retry.md", "# Retries\n\nFailed requests retry three times.")
+
+	got := l.searchLocalIndex("retry", 8, 2)
+	if len(got.CodeResults) != 1 || got.CodeResults[0].FileName != "client/retry.go" {
+		t.Errorf("got code results %+v, want client/retry.go", got.CodeResults)
+	}
+	if len(got.TextResults) != 1 || got.TextResults[0].FileName != "docs/retry.md" {
+		t.Errorf("got text results %+v, want docs/retry.md", got.TextResults)
+	}
+}
+
+func TestDocumentSaved(t *testing.T) {
+	uri := lsp.DocumentURI("file:///work/client/retry.go")
+	l := &SourcegraphLLM{Documents: documents.NewStore(), WorkspaceFolders: []lsp.DocumentURI{"file:///work"}}
+	l.localIndex = index.New()
+	l.Documents.Open(uri, "package client\n\nfunc backoff() {}", 1)
+
+	l.DocumentSaved(uri)
+	if got := l.localIndex.Search("backoff", 1); len(got) != 1 || got[0].FileName != "client/retry.go" {
+		t.Errorf("Search() == %+v after saving, want client/retry.go", got)
+	}
+}
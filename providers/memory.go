@@ -0,0 +1,143 @@
+package providers
+
+import (
+	"fmt"
+
+	"github.com/pjlast/llmsp/claude"
+	"github.com/pjlast/llmsp/internal/promptbuilder"
+)
+
+// memoryMessage describes a message of the interaction memory to the
+// client.
+type memoryMessage struct {
+	Index   int    `json:"index"`
+	Speaker string `json:"speaker"`
+	Text    string `json:"text"`
+	Tokens  int    `json:"tokens"`
+	Pinned  bool   `json:"pinned"`
+}
+
+// ListMemory returns the messages of the interaction memory, oldest first.
+func (l *SourcegraphLLM) ListMemory() []memoryMessage {
+	l.Mu.Lock()
+	defer l.Mu.Unlock()
+	messages := make([]memoryMessage, len(l.InteractionMemory))
+	for i, message := range l.InteractionMemory {
+		messages[i] = memoryMessage{
+			Index:   i,
+			Speaker: string(message.Speaker),
+			Text:    message.Text,
+			Tokens:  getTokenLength(message.Text),
+			Pinned:  message.Pinned,
+		}
+	}
+	return messages
+}
+
+// exchange returns the bounds of the exchange containing the message at
+// index in the interaction memory: the message of the human and the answer
+// of the assistant, or the message alone if it isn't part of one. l.Mu must
+// be held.
+func (l *SourcegraphLLM) exchange(index int) (start, end int, err error) {
+	memory := l.InteractionMemory
+	if index < 0 || index >= len(memory) {
+		return 0, 0, fmt.Errorf("no message at index %d, the memory has %d messages", index, len(memory))
+	}
+	switch {
+	case memory[index].Speaker == claude.Human && index+1 < len(memory) && memory[index+1].Speaker == claude.Assistant:
+		return index, index + 2, nil
+	case memory[index].Speaker == claude.Assistant && index > 0 && memory[index-1].Speaker == claude.Human:
+		return index - 1, index + 1, nil
+	}
+	return index, index + 1, nil
+}
+
+// DeleteMemory deletes the exchange containing the message at index from the
+// interaction memory, so that messages keep alternating between the human
+// and the assistant.
+func (l *SourcegraphLLM) DeleteMemory(index int) error {
+	l.Mu.Lock()
+	defer l.Mu.Unlock()
+	start, end, err := l.exchange(index)
+	if err != nil {
+		return err
+	}
+	memory := append([]claude.Message(nil), l.InteractionMemory[:start]...)
+	l.InteractionMemory = append(memory, l.InteractionMemory[end:]...)
+	return nil
+}
+
+// PinMemory pins or unpins the exchange containing the message at index.
+// Pinned exchanges are kept in prompts when the rest of the interaction
+// memory is trimmed to fit.
+func (l *SourcegraphLLM) PinMemory(index int, pinned bool) error {
+	l.Mu.Lock()
+	defer l.Mu.Unlock()
+	start, end, err := l.exchange(index)
+	if err != nil {
+		return err
+	}
+	for i := start; i < end; i++ {
+		l.InteractionMemory[i].Pinned = pinned
+	}
+	return nil
+}
+
+// memorySnapshot returns a copy of the interaction memory, which prompts are
+// built from while the memory may change.
+func (l *SourcegraphLLM) memorySnapshot() []claude.Message {
+	l.Mu.Lock()
+	defer l.Mu.Unlock()
+	memory := make([]claude.Message, len(l.InteractionMemory))
+	copy(memory, l.InteractionMemory)
+	return memory
+}
+
+// appendMemory appends an exchange to the interaction memory.
+func (l *SourcegraphLLM) appendMemory(messages ...claude.Message) {
+	l.Mu.Lock()
+	defer l.Mu.Unlock()
+	l.InteractionMemory = append(l.InteractionMemory, messages...)
+}
+
+// historySections returns the sections of prompts holding the messages of
+// the interaction memory. Pinned messages come first, and are only trimmed
+// after the other context but the preamble, while the rest of the history
+// gets what's left.
+func historySections(memory []claude.Message) []promptbuilder.Section {
+	var pinned, history []claude.Message
+	for _, message := range memory {
+		if message.Pinned {
+			pinned = append(pinned, message)
+		} else {
+			history = append(history, message)
+		}
+	}
+	return []promptbuilder.Section{
+		{Name: "pinned", Messages: pinned, Priority: 3},
+		{Name: "history", Messages: history},
+	}
+}
+
+// pinnedIndices returns the indices of the pinned messages, which are
+// stored along with chat sessions.
+func pinnedIndices(messages []claude.Message) []int {
+	var indices []int
+	for i, message := range messages {
+		if message.Pinned {
+			indices = append(indices, i)
+		}
+	}
+	return indices
+}
+
+// memory returns the interaction memory of the session with its pinned
+// messages.
+func (s *ChatSession) memory() []claude.Message {
+	for _, i := range s.Pinned {
+		if i >= 0 && i < len(s.InteractionMemory) {
+			s.InteractionMemory[i].Pinned = true
+		}
+	}
+	return s.InteractionMemory
+}
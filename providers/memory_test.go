@@ -0,0 +1,113 @@
+package providers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pjlast/llmsp/claude"
+	"github.com/pjlast/llmsp/internal/promptbuilder"
+)
+
+func testMemory() []claude.Message {
+	return []claude.Message{
+		{Speaker: claude.Human, Text: "Here is a snippet from the file \"main.go\""},
+		{Speaker: claude.Assistant, Text: "Ok."},
+		{Speaker: claude.Human, Text: "What does it do?"},
+		{Speaker: claude.Assistant, Text: "It prints hello."},
+	}
+}
+
+func TestListMemory(t *testing.T) {
+	l := &SourcegraphLLM{InteractionMemory: testMemory()}
+	l.InteractionMemory[1].Pinned = true
+
+	messages := l.ListMemory()
+	if len(messages) != 4 {
+		t.Fatalf("got %d messages, want 4", len(messages))
+	}
+	want := memoryMessage{Index: 1, Speaker: string(claude.Assistant), Text: "Ok.", Tokens: getTokenLength("Ok."), Pinned: true}
+	if messages[1] != want {
+		t.Errorf("messages[1] == %+v, want %+v", messages[1], want)
+	}
+}
+
+func TestDeleteMemory(t *testing.T) {
+	tests := []struct {
+		name  string
+		index int
+		want  []string
+	}{
+		{"human", 0, []string{"What does it do?", "It prints hello."}},
+		{"assistant", 3, []string{"Here is a snippet from the file \"main.go\"", "Ok."}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := &SourcegraphLLM{InteractionMemory: testMemory()}
+			if err := l.DeleteMemory(test.index); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, message := range l.InteractionMemory {
+				got = append(got, message.Text)
+			}
+			if strings.Join(got, "|") != strings.Join(test.want, "|") {
+				t.Errorf("memory == %q, want %q", got, test.want)
+			}
+		})
+	}
+
+	l := &SourcegraphLLM{InteractionMemory: testMemory()}
+	if err := l.DeleteMemory(4); err == nil {
+		t.Error("deleting a message out of range succeeded")
+	}
+}
+
+func TestPinMemory(t *testing.T) {
+	l := &SourcegraphLLM{InteractionMemory: testMemory()}
+	if err := l.PinMemory(1, true); err != nil {
+		t.Fatal(err)
+	}
+	if !l.InteractionMemory[0].Pinned || !l.InteractionMemory[1].Pinned || l.InteractionMemory[2].Pinned {
+		t.Errorf("pinning message 1 pinned %+v, want the first exchange", l.InteractionMemory)
+	}
+
+	// Pinned messages survive a budget that only fits them
+	budget := getTokenLength(l.InteractionMemory[0].Text) + getTokenLength(l.InteractionMemory[1].Text)
+	prompt := promptbuilder.New(promptbuilder.NewBudget(budget))
+	for _, section := range historySections(l.InteractionMemory) {
+		prompt.Add(section)
+	}
+	messages := prompt.Build()
+	if len(messages) != 2 || messages[0].Text != l.InteractionMemory[0].Text {
+		t.Errorf("prompt == %+v, want the pinned exchange", messages)
+	}
+
+	if err := l.PinMemory(0, false); err != nil {
+		t.Fatal(err)
+	}
+	if pinned := pinnedIndices(l.InteractionMemory); len(pinned) != 0 {
+		t.Errorf("pinned == %v after unpinning, want none", pinned)
+	}
+}
+
+func TestPinnedMemoryPersistence(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+
+	l := &SourcegraphLLM{WorkspaceRoot: "file:///home/user/project"}
+	l.NewSession("Pinned")
+	l.InteractionMemory = testMemory()
+	if err := l.PinMemory(2, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.saveHistory(); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := &SourcegraphLLM{WorkspaceRoot: "file:///home/user/project"}
+	if err := restored.loadHistory(); err != nil {
+		t.Fatal(err)
+	}
+	if pinned := pinnedIndices(restored.InteractionMemory); len(pinned) != 2 || pinned[0] != 2 || pinned[1] != 3 {
+		t.Errorf("pinned == %v, want [2 3]", pinned)
+	}
+}
@@ -0,0 +1,188 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pjlast/llmsp/claude"
+	"github.com/sourcegraph/go-lsp"
+)
+
+const (
+	// maxMentionTokens is the maximum length of the context added for every
+	// mention.
+	maxMentionTokens = 2000
+	// maxMentionResults is the number of symbols and embeddings results
+	// added for a mention.
+	maxMentionResults = 3
+)
+
+// mentionPattern matches the @file:path, @symbol:Name, @repo:name and @diff
+// mentions of chat messages.
+var mentionPattern = regexp.MustCompile(`(^|\s)@(?:(file|symbol|repo):(\S+)|(diff)\b)`)
+
+// mention is a reference to context in a chat message.
+type mention struct {
+	// kind is "file", "symbol", "repo" or "diff"
+	kind string
+	// value is the path, name or repository mentioned, it is empty for
+	// @diff
+	value string
+}
+
+// parseMentions returns the mentions of a chat message, and the message
+// with the mention syntax stripped: @file:main.go becomes main.go, and
+// @diff the uncommitted changes.
+func parseMentions(message string) (string, []mention) {
+	var mentions []mention
+	stripped := mentionPattern.ReplaceAllStringFunc(message, func(match string) string {
+		groups := mentionPattern.FindStringSubmatch(match)
+		if groups[4] == "diff" {
+			mentions = append(mentions, mention{kind: "diff"})
+			return groups[1] + "the uncommitted changes"
+		}
+		// Punctuation ending the sentence isn't part of the value
+		value := strings.TrimRight(groups[3], ".,;:!?)'\"`")
+		trailing := groups[3][len(value):]
+		mentions = append(mentions, mention{kind: groups[2], value: value})
+		return groups[1] + value + trailing
+	})
+	return stripped, mentions
+}
+
+// hasMention reports whether the mentions contain a mention of the kind.
+func hasMention(mentions []mention, kind string) bool {
+	for _, m := range mentions {
+		if m.kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// mentionMessages resolves the mentions of a chat message about the file to
+// context messages: the contents of mentioned files, the definitions of
+// mentioned symbols, the embeddings results of mentioned repositories for
+// the question, and the changes for @diff. Mentions that can't be resolved
+// are skipped.
+func (l *SourcegraphLLM) mentionMessages(ctx context.Context, filename lsp.DocumentURI, question string, mentions []mention) []claude.Message {
+	var messages []claude.Message
+	for _, m := range mentions {
+		var text string
+		source := &claude.Source{Kind: m.kind, File: m.value}
+		switch m.kind {
+		case "file":
+			text, source = l.mentionedFile(m.value)
+		case "symbol":
+			text = l.mentionedSymbol(ctx, filename, m.value)
+		case "repo":
+			text = l.mentionedRepo(ctx, m.value, question)
+		case "diff":
+			messages = append(messages, gitContextMessages(ctx, filename)...)
+		}
+		if text == "" {
+			continue
+		}
+		text, _ = truncateText(text, maxMentionTokens)
+		messages = append(messages, claude.Message{
+			Speaker: claude.Human,
+			Text:    text,
+			Source:  source,
+		}, claude.Message{
+			Speaker: claude.Assistant,
+			Text:    "Ok.",
+		})
+	}
+	return messages
+}
+
+// mentionedFile returns the contents of a file mentioned by its path,
+// relative to the workspace root, or its URI, and the lines that fit in the
+// context. Open documents are read from the editor.
+func (l *SourcegraphLLM) mentionedFile(path string) (string, *claude.Source) {
+	path = strings.TrimPrefix(path, "file://")
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(l.workspaceRoot(), path)
+	}
+
+	text, ok := "", false
+	if doc, open := l.Documents.Get(lsp.DocumentURI("file://" + path)); open {
+		text, ok = doc.Text, true
+	} else if data, err := os.ReadFile(path); err == nil {
+		text, ok = string(data), true
+	}
+	if !ok {
+		return "", nil
+	}
+	text, _ = truncateText(text, maxMentionTokens)
+	return fmt.Sprintf("Here are the contents of the file `%s`:\n```%s\n%s\n```", path, strings.ToLower(determineLanguage(path)), text),
+		fileSource("file", path, text, 0)
+}
+
+// mentionedSymbol returns the definitions of a symbol mentioned by its
+// name. Definitions in the open documents are preferred over those found by
+// searching the repository of the file on Sourcegraph.
+func (l *SourcegraphLLM) mentionedSymbol(ctx context.Context, filename lsp.DocumentURI, name string) string {
+	var definitions []string
+	for _, doc := range l.Documents.All() {
+		f := parseDocument(doc)
+		if f == nil || l.ignored(string(doc.URI)) {
+			continue
+		}
+		for _, symbol := range f.Lookup(name) {
+			definitions = append(definitions, fmt.Sprintf("From `%s`:\n%s", strings.TrimPrefix(string(doc.URI), "file://"), getFileSnippet(doc.Text, symbol.StartLine, symbol.EndLine)))
+		}
+	}
+
+	if repo := l.repoFor(string(filename)); len(definitions) == 0 && repo.Name != "" && l.EmbeddingsClient != nil {
+		ctx, cancel := l.withTimeout(ctx, "search")
+		defer cancel()
+		results, err := l.EmbeddingsClient.SearchSymbols(ctx, repo.Name, []string{name}, maxMentionResults)
+		if err != nil {
+			l.Logger.Debug("symbol search failed", "symbol", name, "err", err)
+		}
+		for _, result := range results {
+			if l.ignored(result.FileName) {
+				continue
+			}
+			definitions = append(definitions, fmt.Sprintf("From `%s` in %s:\n%s", result.FileName, result.RepoName, result.Content))
+		}
+	}
+	if len(definitions) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Here are the definitions of `%s`:\n%s", name, strings.Join(definitions, "\n\n"))
+}
+
+// mentionedRepo returns the embeddings results of a repository mentioned by
+// its name for the question.
+func (l *SourcegraphLLM) mentionedRepo(ctx context.Context, name, question string) string {
+	if l.EmbeddingsClient == nil || !l.features.supports(featureEmbeddings) {
+		return ""
+	}
+	ctx, cancel := l.withTimeout(ctx, "embeddings")
+	defer cancel()
+	repoID, err := l.EmbeddingsClient.GetRepoID(ctx, name)
+	if err != nil {
+		l.Logger.Debug("mentioned repository not found", "repo", name, "err", err)
+		return ""
+	}
+	results, err := l.EmbeddingsClient.GetEmbeddings(ctx, repoID, question, maxMentionResults, maxMentionResults)
+	if err != nil {
+		l.reportEmbeddingsError(err)
+		return ""
+	}
+
+	var snippets []string
+	for _, result := range l.withoutIgnored(append(results.CodeResults, results.TextResults...)) {
+		snippets = append(snippets, fmt.Sprintf("From `%s`:\n%s", result.FileName, result.Content))
+	}
+	if len(snippets) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Here is code from the repository %s:\n%s", name, strings.Join(snippets, "\n\n"))
+}
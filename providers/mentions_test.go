@@ -0,0 +1,70 @@
+package providers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pjlast/llmsp/internal/documents"
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/go-lsp"
+)
+
+func TestParseMentions(t *testing.T) {
+	tests := []struct {
+		message  string
+		want     string
+		mentions []mention
+	}{
+		{"How does this work?", "How does this work?", nil},
+		{
+			"What does @file:cmd/main.go do?",
+			"What does cmd/main.go do?",
+			[]mention{{kind: "file", value: "cmd/main.go"}},
+		},
+		{
+			"@symbol:NewServer vs @repo:github.com/a/b.",
+			"NewServer vs github.com/a/b.",
+			[]mention{{kind: "symbol", value: "NewServer"}, {kind: "repo", value: "github.com/a/b"}},
+		},
+		{"Review @diff please", "Review the uncommitted changes please", []mention{{kind: "diff"}}},
+		{"mail someone@file:x", "mail someone@file:x", nil},
+	}
+	for _, test := range tests {
+		got, mentions := parseMentions(test.message)
+		if got != test.want || !reflect.DeepEqual(mentions, test.mentions) {
+			t.Errorf("parseMentions(%q) == (%q, %+v), want (%q, %+v)", test.message, got, mentions, test.want, test.mentions)
+		}
+	}
+}
+
+func TestMentionMessages(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "notes.md"), []byte("# Notes"), 0o644)
+	uri := lsp.DocumentURI("file://" + filepath.Join(root, "main.go"))
+	l := &SourcegraphLLM{
+		WorkspaceRoot: "file://" + root,
+		Documents: documents.FromMap(types.MemoryFileMap{
+			uri: "package main\n\n// Run runs.\nfunc Run() {\n\tprintln()\n}\n",
+		}),
+	}
+
+	messages := l.mentionMessages(context.Background(), uri, "question", []mention{
+		{kind: "file", value: "notes.md"},
+		{kind: "file", value: "missing.go"},
+		{kind: "symbol", value: "Run"},
+		{kind: "symbol", value: "Missing"},
+	})
+	if len(messages) != 4 {
+		t.Fatalf("mentionMessages() == %+v, want messages for the existing file and symbol", messages)
+	}
+	if !strings.Contains(messages[0].Text, "# Notes") {
+		t.Errorf("file context %q doesn't contain the file", messages[0].Text)
+	}
+	if !strings.Contains(messages[2].Text, "// Run runs.\nfunc Run() {\n\tprintln()\n}") {
+		t.Errorf("symbol context %q doesn't contain the definition", messages[2].Text)
+	}
+}
@@ -0,0 +1,51 @@
+package providers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/pjlast/llmsp/claude"
+	"github.com/pjlast/llmsp/internal/metrics"
+	"github.com/pjlast/llmsp/internal/tokenizer"
+)
+
+// recordLLMRequest records the latency, the tokens and the outcome of a
+// completion request, see claude.Client.Trace. Requests are labeled by
+// model, "default" for the instance's default model.
+func (l *SourcegraphLLM) recordLLMRequest(trace claude.Trace) {
+	model := trace.Params.Model
+	if model == "" {
+		model = "default"
+	}
+	l.Metrics.Counter("llmsp_llm_requests_total", "LLM requests by model.", "model").Inc(model)
+	if trace.Err != nil {
+		l.Metrics.Counter("llmsp_llm_errors_total", "Failed LLM requests by model and kind of error.", "model", "error").Inc(model, errorLabel(trace.Err))
+		return
+	}
+	l.Metrics.Histogram("llmsp_llm_request_duration_seconds", "Latency of LLM requests by model, until the response is complete.", metrics.DefaultBuckets, "model").
+		Observe(trace.Duration.Seconds(), model)
+	var sent int
+	for _, message := range trace.Params.Messages {
+		sent += tokenizer.Count(message.Text)
+	}
+	l.Metrics.Counter("llmsp_llm_tokens_sent_total", "Tokens of the prompts of LLM requests by model.", "model").Add(float64(sent), model)
+	l.Metrics.Counter("llmsp_llm_tokens_received_total", "Tokens of the responses to LLM requests by model.", "model").Add(float64(tokenizer.Count(trace.Completion)), model)
+}
+
+// errorLabel returns the kind of an error of an LLM request, as a label
+// value.
+func errorLabel(err error) string {
+	switch {
+	case errors.Is(err, claude.ErrRateLimited):
+		return "rate_limited"
+	case errors.Is(err, claude.ErrUnauthorized):
+		return "unauthorized"
+	case errors.Is(err, claude.ErrContextTooLong):
+		return "context_too_long"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	}
+	return "other"
+}
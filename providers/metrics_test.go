@@ -0,0 +1,51 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pjlast/llmsp/claude"
+	"github.com/pjlast/llmsp/internal/metrics"
+)
+
+func TestRecordLLMRequest(t *testing.T) {
+	registry := metrics.NewRegistry()
+	l := &SourcegraphLLM{Metrics: registry}
+	params := claude.DefaultCompletionParameters([]claude.Message{{Speaker: claude.Human, Text: "Write a function"}})
+
+	l.recordLLMRequest(claude.Trace{Params: params, Completion: "func f() {}", Duration: 300 * time.Millisecond})
+	params.Model = "anthropic/claude-2"
+	l.recordLLMRequest(claude.Trace{Params: params, Err: fmt.Errorf("completion: %w", claude.ErrRateLimited)})
+	l.recordLLMRequest(claude.Trace{Params: params, Err: context.DeadlineExceeded})
+
+	if got := registry.Counter("llmsp_llm_requests_total", "", "model").Value("anthropic/claude-2"); got != 2 {
+		t.Errorf("got %v requests to claude-2, want 2", got)
+	}
+	errorsTotal := registry.Counter("llmsp_llm_errors_total", "", "model", "error")
+	if got := errorsTotal.Value("anthropic/claude-2", "rate_limited"); got != 1 {
+		t.Errorf("got %v rate limited requests, want 1", got)
+	}
+	if got := errorsTotal.Value("anthropic/claude-2", "timeout"); got != 1 {
+		t.Errorf("got %v timeouts, want 1", got)
+	}
+	// Failed requests have no latency
+	latency := registry.Histogram("llmsp_llm_request_duration_seconds", "", nil, "model")
+	if latency.Count("default") != 1 || latency.Count("anthropic/claude-2") != 0 {
+		t.Errorf("got %d and %d latencies, want only the successful request", latency.Count("default"), latency.Count("anthropic/claude-2"))
+	}
+	if got := registry.Counter("llmsp_llm_tokens_sent_total", "", "model").Value("default"); got == 0 {
+		t.Error("no tokens sent were counted")
+	}
+	if got := registry.Counter("llmsp_llm_tokens_received_total", "", "model").Value("default"); got == 0 {
+		t.Error("no tokens received were counted")
+	}
+}
+
+func TestRecordLLMRequestWithoutMetrics(t *testing.T) {
+	l := &SourcegraphLLM{}
+	params := claude.DefaultCompletionParameters(nil)
+	l.recordLLMRequest(claude.Trace{Params: params, Err: errors.New("failed")})
+}
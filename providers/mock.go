@@ -0,0 +1,176 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/go-lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// MockLLM is a provider answering with canned responses instead of asking an
+// LLM, so that the server's handlers can be tested without a Sourcegraph
+// instance. It records the methods called on it.
+type MockLLM struct {
+	// Completions are returned for every completion request
+	Completions []types.CompletionItem
+	// CodeActions are returned for every range
+	CodeActions []types.CodeAction
+	// CodeLenses are returned for every document
+	CodeLenses []types.CodeLens
+	// HoverText is the explanation of every symbol
+	HoverText string
+	// CommandResults are the results of commands by name, other commands
+	// return null
+	CommandResults map[string]any
+	// History are the history documents
+	History []types.HistoryDocument
+	// Err, if set, is returned by every method that can fail
+	Err error
+
+	mu    sync.Mutex
+	calls []string
+}
+
+// record records a call of the method.
+func (m *MockLLM) record(method string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, method)
+}
+
+// Calls returns the methods called, in order. Commands are recorded as
+// ExecuteCommand:<command>.
+func (m *MockLLM) Calls() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.calls...)
+}
+
+// Initialize returns Err.
+func (m *MockLLM) Initialize(context.Context, types.LLMSPSettings) error {
+	m.record("Initialize")
+	return m.Err
+}
+
+// GetCompletions returns Completions.
+func (m *MockLLM) GetCompletions(context.Context, types.CompletionParams) ([]types.CompletionItem, error) {
+	m.record("GetCompletions")
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	return m.Completions, nil
+}
+
+// GetCodeActions returns CodeActions.
+func (m *MockLLM) GetCodeActions(lsp.DocumentURI, lsp.Range) []types.CodeAction {
+	m.record("GetCodeActions")
+	return append([]types.CodeAction(nil), m.CodeActions...)
+}
+
+// ResolveCodeAction returns the code action unchanged.
+func (m *MockLLM) ResolveCodeAction(_ context.Context, action types.CodeAction) (types.CodeAction, error) {
+	m.record("ResolveCodeAction")
+	return action, m.Err
+}
+
+// GetCodeLenses returns CodeLenses.
+func (m *MockLLM) GetCodeLenses(lsp.DocumentURI) []types.CodeLens {
+	m.record("GetCodeLenses")
+	return m.CodeLenses
+}
+
+// ResolveCodeLens returns the code lens unchanged.
+func (m *MockLLM) ResolveCodeLens(lens types.CodeLens) (types.CodeLens, error) {
+	m.record("ResolveCodeLens")
+	return lens, m.Err
+}
+
+// ResolveCompletion returns the completion item unchanged.
+func (m *MockLLM) ResolveCompletion(_ context.Context, item types.CompletionItem) (types.CompletionItem, error) {
+	m.record("ResolveCompletion")
+	return item, m.Err
+}
+
+// Hover returns HoverText.
+func (m *MockLLM) Hover(context.Context, lsp.DocumentURI, string, string) (string, error) {
+	m.record("Hover")
+	if m.Err != nil {
+		return "", m.Err
+	}
+	return m.HoverText, nil
+}
+
+// ExecuteCommand returns the result of the command in CommandResults.
+func (m *MockLLM) ExecuteCommand(_ context.Context, params types.ExecuteCommandParams, _ *jsonrpc2.Conn) (*json.RawMessage, error) {
+	m.record("ExecuteCommand:" + params.Command)
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	result, err := json.Marshal(m.CommandResults[params.Command])
+	if err != nil {
+		return nil, err
+	}
+	raw := json.RawMessage(result)
+	return &raw, nil
+}
+
+// SetWorkspaceFolders does nothing.
+func (m *MockLLM) SetWorkspaceFolders(context.Context, []lsp.DocumentURI) {
+	m.record("SetWorkspaceFolders")
+}
+
+// ListHistory returns the history documents whose title or content contain
+// the query.
+func (m *MockLLM) ListHistory(query string) []types.HistoryDocument {
+	m.record("ListHistory")
+	var documents []types.HistoryDocument
+	for _, document := range m.History {
+		if strings.Contains(document.Title, query) || strings.Contains(document.Content, query) {
+			documents = append(documents, document)
+		}
+	}
+	return documents
+}
+
+// GetHistoryDocument returns the history document with the URI.
+func (m *MockLLM) GetHistoryDocument(uri lsp.DocumentURI) (*types.HistoryDocument, error) {
+	m.record("GetHistoryDocument")
+	for _, document := range m.History {
+		if document.URI == uri {
+			return &document, nil
+		}
+	}
+	return nil, fmt.Errorf("no history document %s", uri)
+}
+
+// DocumentSaved does nothing.
+func (m *MockLLM) DocumentSaved(lsp.DocumentURI) {
+	m.record("DocumentSaved")
+}
+
+// SetPrompts accepts any prompt templates.
+func (m *MockLLM) SetPrompts(*types.PromptSettings) error {
+	m.record("SetPrompts")
+	return nil
+}
+
+// SetSampling accepts any sampling settings.
+func (m *MockLLM) SetSampling(map[string]types.SamplingSettings) error {
+	m.record("SetSampling")
+	return nil
+}
+
+// Quiesce does nothing.
+func (m *MockLLM) Quiesce() {
+	m.record("Quiesce")
+}
+
+// Flush does nothing.
+func (m *MockLLM) Flush(context.Context) {
+	m.record("Flush")
+}
@@ -0,0 +1,97 @@
+package providers
+
+import "github.com/pjlast/llmsp/claude"
+
+// modelKind is the kind of request a model is used for.
+type modelKind int
+
+const (
+	// chatModel is used for chat messages and explanations.
+	chatModel modelKind = iota
+	// completionModel is used for autocompletion.
+	completionModel
+	// editModel is used for requests that edit code.
+	editModel
+)
+
+// model returns the model configured for the kind of request. An empty
+// string leaves the choice of model to the Sourcegraph instance, which is
+// always the case if the instance doesn't support choosing models.
+func (l *SourcegraphLLM) model(kind modelKind) string {
+	if !l.features.supports(featureModels) {
+		return ""
+	}
+	switch kind {
+	case completionModel:
+		return l.CompletionModel
+	case editModel:
+		return l.EditModel
+	default:
+		return l.ChatModel
+	}
+}
+
+// defaultMaxTokens are the maximum lengths of responses, in tokens, for each
+// kind of request. Completions are short, and edits may rewrite whole
+// functions.
+var defaultMaxTokens = map[modelKind]int{
+	chatModel:       1000,
+	completionModel: 256,
+	editModel:       2000,
+}
+
+// maxTokens returns the maximum length of responses to the kind of request,
+// as configured or its default. The sampling settings take precedence over
+// the maximum lengths of the Sourcegraph settings.
+func (l *SourcegraphLLM) maxTokens(kind modelKind) int {
+	if n := l.sampling.get(kind).MaxTokensToSample; n != nil {
+		return *n
+	}
+	var configured int
+	switch kind {
+	case completionModel:
+		configured = l.CompletionMaxTokens
+	case editModel:
+		configured = l.EditMaxTokens
+	default:
+		configured = l.ChatMaxTokens
+	}
+	if configured > 0 {
+		return configured
+	}
+	return defaultMaxTokens[kind]
+}
+
+// completionParameters returns the default completion parameters for
+// messages, using the model and sampling parameters configured for the kind
+// of request.
+func (l *SourcegraphLLM) completionParameters(kind modelKind, messages []claude.Message) *claude.CompletionParameters {
+	params := claude.DefaultCompletionParameters(messages)
+	params.Model = l.model(kind)
+	params.MaxTokensToSample = l.maxTokens(kind)
+	l.sampling.apply(kind, params)
+	return params
+}
+
+// defaultContextWindow is the context window assumed for unknown models.
+const defaultContextWindow = 8000
+
+// contextWindows are the context window sizes, in tokens, of known models.
+var contextWindows = map[string]int{
+	"anthropic/claude-instant-v1": 9000,
+	"anthropic/claude-v1":         9000,
+	"anthropic/claude-instant-1":  100000,
+	"anthropic/claude-2":          100000,
+	"openai/gpt-3.5-turbo":        4096,
+	"openai/gpt-4":                8192,
+}
+
+// maxPromptTokens returns the maximum length of the prompt for the model
+// used for the kind of request, leaving room for the response.
+func (l *SourcegraphLLM) maxPromptTokens(kind modelKind) int {
+	window, ok := contextWindows[l.model(kind)]
+	if !ok {
+		window = defaultContextWindow
+	}
+	return window - l.maxTokens(kind)
+}
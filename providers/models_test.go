@@ -0,0 +1,42 @@
+package providers
+
+import "testing"
+
+func TestCompletionParameters(t *testing.T) {
+	l := &SourcegraphLLM{
+		ChatModel:       "anthropic/claude-2",
+		CompletionModel: "anthropic/claude-instant-1",
+	}
+
+	tests := []struct {
+		kind modelKind
+		want string
+	}{
+		{chatModel, "anthropic/claude-2"},
+		{completionModel, "anthropic/claude-instant-1"},
+		{editModel, ""},
+	}
+	for _, test := range tests {
+		if got := l.completionParameters(test.kind, nil).Model; got != test.want {
+			t.Errorf("completionParameters(%d).Model == %q, want %q", test.kind, got, test.want)
+		}
+	}
+}
+
+func TestMaxTokens(t *testing.T) {
+	l := &SourcegraphLLM{CompletionMaxTokens: 128}
+
+	tests := []struct {
+		kind modelKind
+		want int
+	}{
+		{chatModel, 1000},
+		{completionModel, 128},
+		{editModel, 2000},
+	}
+	for _, test := range tests {
+		if got := l.completionParameters(test.kind, nil).MaxTokensToSample; got != test.want {
+			t.Errorf("completionParameters(%d).MaxTokensToSample == %d, want %d", test.kind, got, test.want)
+		}
+	}
+}
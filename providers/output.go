@@ -0,0 +1,224 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pjlast/llmsp/claude"
+	"github.com/sourcegraph/go-lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+const (
+	outputKindPanic      = "panic"
+	outputKindTest       = "test failure"
+	outputKindBuild      = "build error"
+	outputKindLint       = "linter output"
+	outputKindStackTrace = "stack trace"
+	outputKindGeneric    = "generic"
+
+	// maxOutputTokens is the maximum amount of terminal output sent to the LLM.
+	maxOutputTokens = 2000
+	// maxOutputReferences is the maximum number of referenced locations
+	// included as context.
+	maxOutputReferences = 5
+)
+
+// outputLocationRegexp matches file locations such as main.go:12 or
+// ./pkg/foo.go:12:4.
+var outputLocationRegexp = regexp.MustCompile(`((?:[A-Za-z]:)?[\w./\\-]*\w\.\w+):(\d+)(?::(\d+))?`)
+
+// outputReference is a location in an open document referenced by terminal
+// output.
+type outputReference struct {
+	URI     lsp.DocumentURI `json:"uri"`
+	Line    int             `json:"line"`
+	Column  int             `json:"column"`
+	Message string          `json:"message"`
+}
+
+// outputExplanation is the result of the cody.explainOutput command.
+type outputExplanation struct {
+	Kind        string            `json:"kind"`
+	Explanation string            `json:"explanation"`
+	NextSteps   []string          `json:"nextSteps"`
+	References  []outputReference `json:"references"`
+}
+
+// classifyOutput makes a best guess at what kind of terminal output it is
+// given.
+func classifyOutput(output string) string {
+	switch {
+	case strings.Contains(output, "panic: ") || strings.Contains(output, "fatal error: "):
+		return outputKindPanic
+	case strings.Contains(output, "--- FAIL") || strings.Contains(output, "FAILED") || strings.Contains(output, "AssertionError"):
+		return outputKindTest
+	case strings.Contains(output, "Traceback (most recent call last)") || strings.Contains(output, "\tat ") || strings.Contains(output, "    at "):
+		return outputKindStackTrace
+	case strings.Contains(output, "error:") || strings.Contains(output, "undefined:") || strings.Contains(output, "cannot use"):
+		return outputKindBuild
+	case strings.Contains(output, "warning:") || strings.Contains(output, "(lint)") || strings.Contains(output, "golangci"):
+		return outputKindLint
+	case outputLocationRegexp.MatchString(output):
+		return outputKindBuild
+	default:
+		return outputKindGeneric
+	}
+}
+
+// findOutputReferences returns the locations in open documents that are
+// referenced by the output. Lines and columns are zero-based.
+func (l *SourcegraphLLM) findOutputReferences(output string) []outputReference {
+	var references []outputReference
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(output, "\n") {
+		for _, match := range outputLocationRegexp.FindAllStringSubmatch(line, -1) {
+			uri, ok := l.findOpenDocument(match[1])
+			if !ok {
+				continue
+			}
+			lineNumber, err := strconv.Atoi(match[2])
+			if err != nil || lineNumber < 1 {
+				continue
+			}
+			var column int
+			if c, err := strconv.Atoi(match[3]); err == nil && c > 0 {
+				column = c - 1
+			}
+
+			key := fmt.Sprintf("%s:%d", uri, lineNumber)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			references = append(references, outputReference{
+				URI:     uri,
+				Line:    lineNumber - 1,
+				Column:  column,
+				Message: strings.TrimSpace(line),
+			})
+		}
+	}
+
+	return references
+}
+
+// findOpenDocument returns the URI of the open document matching path.
+func (l *SourcegraphLLM) findOpenDocument(path string) (lsp.DocumentURI, bool) {
+	path = strings.TrimPrefix(strings.ReplaceAll(path, "\\", "/"), "./")
+	for _, doc := range l.Documents.All() {
+		filename := strings.TrimPrefix(string(doc.URI), "file://")
+		if filename == path || strings.HasSuffix(filename, "/"+path) {
+			return doc.URI, true
+		}
+	}
+
+	return "", false
+}
+
+// parseOutputExplanation splits the LLM response into the explanation and the
+// list of next steps.
+func parseOutputExplanation(text string) (string, []string) {
+	explanation, steps, _ := strings.Cut(text, "Next steps:")
+	explanation = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(explanation), "Explanation:"))
+
+	var nextSteps []string
+	for _, line := range strings.Split(steps, "\n") {
+		line = strings.TrimSpace(line)
+		if m := planStepRegexp.FindStringSubmatch(line); m != nil {
+			line = m[1]
+		}
+		line = strings.TrimSpace(strings.TrimLeft(line, "-*"))
+		if line != "" {
+			nextSteps = append(nextSteps, line)
+		}
+	}
+
+	return explanation, nextSteps
+}
+
+// explainOutput explains a block of terminal output. If annotate is set, the
+// referenced lines in open documents are annotated with diagnostics.
+func (l *SourcegraphLLM) explainOutput(ctx context.Context, conn *jsonrpc2.Conn, output string, annotate bool) (*outputExplanation, error) {
+	result := &outputExplanation{
+		Kind:       classifyOutput(output),
+		References: l.findOutputReferences(output),
+	}
+
+	truncatedOutput, _ := truncateText(output, maxOutputTokens)
+	var contextMessages []claude.Message
+	for i, reference := range result.References {
+		if i == maxOutputReferences {
+			break
+		}
+		lines := strings.Split(l.Documents.Text(reference.URI), "\n")
+		if reference.Line >= len(lines) {
+			continue
+		}
+		start, end := reference.Line-5, reference.Line+5
+		if start < 0 {
+			start = 0
+		}
+		if end > len(lines)-1 {
+			end = len(lines) - 1
+		}
+		contextMessages = append(contextMessages, claude.Message{
+			Speaker: claude.Human,
+			Text: fmt.Sprintf("The output references line %d of `%s`:\n%s", reference.Line+1, strings.TrimPrefix(string(reference.URI), "file://"),
+				numberLines(strings.Join(lines[start:end+1], "\n"), start+1)),
+			Source: fileSource("output", string(reference.URI), strings.Join(lines[start:end+1], "\n"), start),
+		}, claude.Message{
+			Speaker: claude.Assistant,
+			Text:    "Ok.",
+		})
+	}
+
+	messages := append(l.getPreamble(), contextMessages...)
+	messages = append(messages, claude.Message{
+		Speaker: claude.Human,
+		Text: fmt.Sprintf(`Here is some terminal output. It looks like %s:
+`+"```"+`
+%s
+`+"```"+`
+
+Explain what went wrong and suggest what to do next. Use the format:
+Explanation: {explanation}
+Next steps:
+1. {step}`, result.Kind, truncatedOutput),
+	}, claude.Message{
+		Speaker: claude.Assistant,
+		Text:    "Explanation:",
+	})
+
+	completion, err := l.ClaudeClient.GetCompletion(ctx, l.completionParameters(chatModel, messages), true)
+	if err != nil {
+		return nil, err
+	}
+	result.Explanation, result.NextSteps = parseOutputExplanation(completion)
+
+	if annotate {
+		diagnostics := make(map[lsp.DocumentURI][]lsp.Diagnostic)
+		for _, reference := range result.References {
+			diagnostics[reference.URI] = append(diagnostics[reference.URI], lsp.Diagnostic{
+				Range: lsp.Range{
+					Start: lsp.Position{Line: reference.Line, Character: reference.Column},
+					End:   lsp.Position{Line: reference.Line, Character: reference.Column},
+				},
+				Severity: lsp.Information,
+				Source:   "cody",
+				Message:  reference.Message,
+			})
+		}
+		for uri, diags := range diagnostics {
+			if err := l.Diagnostics.Publish(ctx, conn, uri, "cody.explainOutput", diags); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return result, nil
+}
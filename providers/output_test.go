@@ -0,0 +1,50 @@
+package providers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pjlast/llmsp/internal/documents"
+	"github.com/pjlast/llmsp/types"
+)
+
+func TestClassifyOutput(t *testing.T) {
+	tests := []struct {
+		output string
+		want   string
+	}{
+		{"panic: runtime error: index out of range [3] with length 3\n\ngoroutine 1 [running]:", outputKindPanic},
+		{"--- FAIL: TestFoo (0.00s)\n    foo_test.go:12: got 1, want 2", outputKindTest},
+		{"./main.go:12:2: undefined: foo", outputKindBuild},
+		{"Traceback (most recent call last):\n  File \"main.py\", line 1", outputKindStackTrace},
+		{"everything is fine", outputKindGeneric},
+	}
+
+	for _, test := range tests {
+		if got := classifyOutput(test.output); got != test.want {
+			t.Errorf("classifyOutput(%q) == %q, want %q", test.output, got, test.want)
+		}
+	}
+}
+
+func TestFindOutputReferences(t *testing.T) {
+	l := &SourcegraphLLM{
+		Documents: documents.FromMap(types.MemoryFileMap{
+			"file:///home/user/project/main.go":        "package main",
+			"file:///home/user/project/pkg/foo/foo.go": "package foo",
+		}),
+	}
+
+	output := `# example.com/project
+./main.go:12:2: undefined: bar
+pkg/foo/foo.go:3:10: missing return
+other.go:1:1: not open`
+
+	want := []outputReference{
+		{URI: "file:///home/user/project/main.go", Line: 11, Column: 1, Message: "./main.go:12:2: undefined: bar"},
+		{URI: "file:///home/user/project/pkg/foo/foo.go", Line: 2, Column: 9, Message: "pkg/foo/foo.go:3:10: missing return"},
+	}
+	if got := l.findOutputReferences(output); !reflect.DeepEqual(got, want) {
+		t.Errorf("findOutputReferences() == %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,197 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"strings"
+
+	"github.com/pjlast/llmsp/claude"
+	"github.com/pjlast/llmsp/internal/i18n"
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+const maxPlanSteps = 6
+
+// planResult is returned to the client after a cody.plan command has finished.
+type planResult struct {
+	Plan     []string `json:"plan"`
+	Code     string   `json:"code"`
+	Verified bool     `json:"verified"`
+	Errors   []string `json:"errors,omitempty"`
+}
+
+var planStepRegexp = regexp.MustCompile(`^\s*\d+[.)]\s+(.+)$`)
+
+// parsePlan extracts the numbered steps from a plan produced by the LLM.
+func parsePlan(text string) []string {
+	var steps []string
+	for _, line := range strings.Split(text, "\n") {
+		if m := planStepRegexp.FindStringSubmatch(line); m != nil {
+			steps = append(steps, strings.TrimSpace(m[1]))
+		}
+		if len(steps) == maxPlanSteps {
+			break
+		}
+	}
+
+	return steps
+}
+
+// extractCode strips the surrounding markdown code fence from an LLM response.
+func extractCode(text string) string {
+	if start := strings.Index(text, "```"); start != -1 {
+		text = text[start+3:]
+		// Drop the language identifier following the opening fence
+		if nl := strings.Index(text, "\n"); nl != -1 {
+			text = text[nl+1:]
+		}
+	}
+	if end := strings.Index(text, "```"); end != -1 {
+		text = text[:end]
+	}
+
+	return strings.TrimRight(text, "\n")
+}
+
+// verifyCode performs a syntax check of code. Only Go is currently supported;
+// for other languages the code is assumed to be valid.
+func verifyCode(language, code string) error {
+	if language != "Go" {
+		return nil
+	}
+
+	fset := token.NewFileSet()
+	_, err := parser.ParseFile(fset, "", code, parser.AllErrors)
+	if err == nil {
+		return nil
+	}
+	// Snippets rarely contain a package clause, so retry as top-level
+	// declarations and as function body statements.
+	if _, declErr := parser.ParseFile(fset, "", "package p\n"+code, parser.AllErrors); declErr == nil {
+		return nil
+	}
+	if _, stmtErr := parser.ParseFile(fset, "", "package p\nfunc _() {\n"+code+"\n}", parser.AllErrors); stmtErr == nil {
+		return nil
+	}
+
+	return err
+}
+
+// reportProgress sends a work done progress report for the given token. It is
+// a no-op if token is empty.
+func reportProgress(ctx context.Context, conn *jsonrpc2.Conn, token, message string, percentage int) {
+	if token == "" {
+		return
+	}
+
+	conn.Notify(ctx, "$/progress", types.ProgressParams[types.WorkDoneProgressReport]{
+		Token: token,
+		Value: types.WorkDoneProgressReport{
+			Kind:       "report",
+			Message:    message,
+			Percentage: percentage,
+		},
+	})
+}
+
+// plan runs the plan → generate → verify pipeline for the given instruction
+// against the code snippet. The model first produces a short plan, after which
+// each step is applied to the code in turn. If verify is set, the resulting
+// code is syntax checked and the model is given one chance to fix any errors.
+func (l *SourcegraphLLM) plan(ctx context.Context, conn *jsonrpc2.Conn, progressToken, filename, filecontents, snippet, instruction string, verify bool) (*planResult, error) {
+	language := determineLanguage(filename)
+	codeFence := fmt.Sprintf("```%s\n", strings.ToLower(language))
+
+	reportProgress(ctx, conn, progressToken, l.Messages.T(i18n.Planning), 0)
+	input := []claude.Message{
+		{
+			Speaker: claude.Human,
+			Text: fmt.Sprintf(`I want to change the following %s code:
+%s%s
+`+"```"+`
+
+Instruction: %s
+
+Produce a short plan of at most %d steps as a numbered list. Only describe the steps, don't write any code.`, language, codeFence, snippet, instruction, maxPlanSteps),
+		},
+		{
+			Speaker: claude.Assistant,
+			Text:    "1.",
+		},
+	}
+	params := l.completionParameters(editModel, l.AddContext(ctx, editModel, input, filename, filecontents))
+	planText, err := l.ClaudeClient.GetCompletion(ctx, params, true)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &planResult{Plan: parsePlan(planText)}
+	if len(result.Plan) == 0 {
+		return nil, fmt.Errorf("the model did not produce a plan")
+	}
+
+	code := snippet
+	for i, step := range result.Plan {
+		reportProgress(ctx, conn, progressToken, l.Messages.T(i18n.PlanStep, i+1, len(result.Plan), step), (i+1)*100/(len(result.Plan)+2))
+		params := l.completionParameters(editModel, append(codyDoPreamble(filename, filecontents),
+			claude.Message{
+				Speaker: claude.Human,
+				Text: fmt.Sprintf(`Here is the code:
+%s%s
+`+"```"+`
+
+The overall goal is: %s
+Apply only this step: %s
+
+Return the complete updated code and nothing else.`, codeFence, code, instruction, step),
+			},
+			claude.Message{
+				Speaker: claude.Assistant,
+				Text:    codeFence,
+			}))
+		stepCode, err := l.ClaudeClient.GetCompletion(ctx, params, true)
+		if err != nil {
+			return nil, err
+		}
+		code = extractCode(stepCode)
+	}
+
+	result.Code = code
+	if verify {
+		reportProgress(ctx, conn, progressToken, l.Messages.T(i18n.Verifying), 100*(len(result.Plan)+1)/(len(result.Plan)+2))
+		if verifyErr := verifyCode(language, code); verifyErr != nil {
+			params := l.completionParameters(editModel, append(codyDoPreamble(filename, filecontents),
+				claude.Message{
+					Speaker: claude.Human,
+					Text: fmt.Sprintf(`The following code does not compile:
+%s%s
+`+"```"+`
+
+The errors are:
+%s
+
+Fix the errors. Return the complete fixed code and nothing else.`, codeFence, code, verifyErr),
+				},
+				claude.Message{
+					Speaker: claude.Assistant,
+					Text:    codeFence,
+				}))
+			fixed, err := l.ClaudeClient.GetCompletion(ctx, params, true)
+			if err != nil {
+				return nil, err
+			}
+			result.Code = extractCode(fixed)
+		}
+		if verifyErr := verifyCode(language, result.Code); verifyErr != nil {
+			result.Errors = strings.Split(verifyErr.Error(), "\n")
+		} else {
+			result.Verified = true
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,84 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/pjlast/llmsp/claude"
+	"github.com/pjlast/llmsp/internal/documents"
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/go-lsp"
+)
+
+func TestParsePlan(t *testing.T) {
+	plan := `1. Add a context parameter
+2) Propagate the context to the HTTP request
+
+Some closing remark.
+3. Update the callers`
+	want := []string{
+		"Add a context parameter",
+		"Propagate the context to the HTTP request",
+		"Update the callers",
+	}
+	if got := parsePlan(plan); !reflect.DeepEqual(got, want) {
+		t.Errorf("parsePlan() == %q, want %q", got, want)
+	}
+}
+
+func TestVerifyCode(t *testing.T) {
+	tests := []struct {
+		code    string
+		wantErr bool
+	}{
+		{"package main\n\nfunc main() {}", false},
+		{"func foo() int { return 1 }", false},
+		{"x := 1\nfmt.Println(x)", false},
+		{"func foo() int { return 1", true},
+	}
+
+	for _, test := range tests {
+		err := verifyCode("Go", test.code)
+		if (err != nil) != test.wantErr {
+			t.Errorf("verifyCode(%q) error == %v, wantErr %v", test.code, err, test.wantErr)
+		}
+	}
+}
+
+func TestPlanUnverified(t *testing.T) {
+	// Every answer, including the fix, is code that doesn't compile
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data": {"completions": " Add a function\n2. Break it\nfunc add(a, b int) int {"}}`))
+	}))
+	defer server.Close()
+
+	uri := lsp.DocumentURI("file:///src/add.go")
+	contents := "package add\n\nfunc add(a, b int) int {\n}\n"
+	l := &SourcegraphLLM{
+		ClaudeClient: claude.NewClient(server.URL, "", server.Client()),
+		EventLogger:  &eventLogger{},
+		Documents:    documents.FromMap(types.MemoryFileMap{uri: contents}),
+	}
+	res, err := l.ExecuteCommand(context.Background(), types.ExecuteCommandParams{
+		Command:   "cody.plan",
+		Arguments: []any{string(uri), 2, 3, "Implement add", true},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result planResult
+	if err := json.Unmarshal(*res, &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Verified || len(result.Errors) == 0 {
+		t.Errorf("got result %+v, want the verification errors", result)
+	}
+	if got := l.Documents.Text(uri); got != contents {
+		t.Errorf("document == %q, want it unchanged", got)
+	}
+}
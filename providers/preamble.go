@@ -0,0 +1,57 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pjlast/llmsp/claude"
+)
+
+// workspacePreambleFile is the file of instructions added to the preamble of
+// prompts, relative to the root of the workspace.
+var workspacePreambleFile = filepath.Join(".llmsp", "preamble.md")
+
+// workspacePreamble returns the instructions added to the preamble of
+// prompts: those of the settings followed by those of the workspace's
+// .llmsp/preamble.md file. The file is read for every prompt, so that edits
+// apply right away.
+func (l *SourcegraphLLM) workspacePreamble() string {
+	l.Mu.Lock()
+	instructions := []string{strings.TrimSpace(l.preamble)}
+	l.Mu.Unlock()
+
+	path := filepath.Join(l.workspaceRoot(), workspacePreambleFile)
+	content, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		l.Logger.Warn("reading the workspace preamble", "path", path, "err", err)
+	}
+	instructions = append(instructions, strings.TrimSpace(string(content)))
+
+	var nonEmpty []string
+	for _, text := range instructions {
+		if text != "" {
+			nonEmpty = append(nonEmpty, text)
+		}
+	}
+	return strings.Join(nonEmpty, "\n\n")
+}
+
+// workspacePreambleMessages returns the messages giving the instructions of
+// the workspace preamble, if there are any.
+func (l *SourcegraphLLM) workspacePreambleMessages() []claude.Message {
+	instructions := l.workspacePreamble()
+	if instructions == "" {
+		return nil
+	}
+	return []claude.Message{{
+		Speaker: claude.Human,
+		Text:    fmt.Sprintf("Follow these instructions about this workspace in all of your answers:\n%s", instructions),
+	}, {
+		Speaker: claude.Assistant,
+		Text:    "Ok, I will follow them.",
+	}}
+}
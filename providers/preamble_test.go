@@ -0,0 +1,56 @@
+package providers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pjlast/llmsp/claude"
+	"github.com/pjlast/llmsp/types"
+)
+
+func TestWorkspacePreamble(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings string
+		file     string
+		want     string
+	}{
+		{"none", "", "", ""},
+		{"settings", "We use Go 1.22.", "", "We use Go 1.22."},
+		{"file", "", "Prefer table-driven tests.\n", "Prefer table-driven tests."},
+		{"both", "We use Go 1.22.", "Prefer table-driven tests.", "We use Go 1.22.\n\nPrefer table-driven tests."},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root := t.TempDir()
+			if test.file != "" {
+				if err := os.MkdirAll(filepath.Join(root, ".llmsp"), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(root, workspacePreambleFile), []byte(test.file), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			l := &SourcegraphLLM{WorkspaceRoot: "file://" + root}
+			if err := l.SetPrompts(&types.PromptSettings{Preamble: test.settings}); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := l.workspacePreamble(); got != test.want {
+				t.Errorf("workspacePreamble() == %q, want %q", got, test.want)
+			}
+			preamble := l.getPreamble()
+			if test.want == "" {
+				if len(preamble) != 1 {
+					t.Errorf("getPreamble() == %+v, want only the introduction", preamble)
+				}
+				return
+			}
+			if len(preamble) != 3 || preamble[1].Speaker != claude.Human || !strings.HasSuffix(preamble[1].Text, test.want) {
+				t.Errorf("getPreamble() == %+v, want the instructions after the introduction", preamble)
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/go-lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// maxProposals is the number of edit proposals kept for accepting them.
+const maxProposals = 20
+
+// diffContext is the number of unchanged lines shown around changes in
+// unified diffs.
+const diffContext = 3
+
+// proposalStore keeps the edit proposals that have been neither accepted nor
+// rejected yet.
+type proposalStore struct {
+	mu        sync.Mutex
+	proposals []types.EditProposalParams
+}
+
+// Add stores a proposal, dropping the oldest proposal if there are too many.
+func (s *proposalStore) Add(proposal types.EditProposalParams) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.proposals = append(s.proposals, proposal)
+	if len(s.proposals) > maxProposals {
+		s.proposals = s.proposals[len(s.proposals)-maxProposals:]
+	}
+}
+
+// Take removes and returns the proposal with the given ID.
+func (s *proposalStore) Take(id string) (types.EditProposalParams, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, proposal := range s.proposals {
+		if proposal.ID == id {
+			s.proposals = append(s.proposals[:i], s.proposals[i+1:]...)
+			return proposal, nil
+		}
+	}
+	return types.EditProposalParams{}, fmt.Errorf("unknown edit proposal %q", id)
+}
+
+// applyEdit applies an edit made by the command, after checking that the
+// documents it changes weren't edited in the meantime, and that the Go files
+// it changes still parse. If edits are
+// previewed, the edit is proposed to the client in a cody/editProposal
+// notification instead, and the proposal is returned as the result of the
+// command.
+func (l *SourcegraphLLM) applyEdit(ctx context.Context, conn *jsonrpc2.Conn, command string, edit types.WorkspaceEdit) (*json.RawMessage, error) {
+	if err := l.checkResourceOperations(edit); err != nil {
+		return nil, err
+	}
+	edit, err := l.versionEdit(edit, snapshotVersions(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if err := l.validateGoEdit(&edit); err != nil {
+		return nil, err
+	}
+
+	if !l.PreviewEdits {
+		var res json.RawMessage
+		conn.Call(ctx, "workspace/applyEdit", types.ApplyWorkspaceEditParams{Edit: edit}, &res)
+		return nil, nil
+	}
+
+	proposal := l.proposeEdit(command, edit)
+	l.proposals.Add(proposal)
+	conn.Notify(ctx, "cody/editProposal", proposal)
+
+	data, err := json.Marshal(proposal)
+	if err != nil {
+		return nil, err
+	}
+	res := json.RawMessage(data)
+	return &res, nil
+}
+
+// acceptEdit applies a proposed edit.
+func (l *SourcegraphLLM) acceptEdit(ctx context.Context, conn *jsonrpc2.Conn, id string) error {
+	proposal, err := l.proposals.Take(id)
+	if err != nil {
+		return err
+	}
+
+	// The proposal is based on the versions it was made for
+	edit, err := l.versionEdit(proposal.Edit, editVersions(proposal.Edit))
+	if err != nil {
+		return err
+	}
+
+	var res json.RawMessage
+	return conn.Call(ctx, "workspace/applyEdit", types.ApplyWorkspaceEditParams{Edit: edit}, &res)
+}
+
+// rejectEdit discards a proposed edit.
+func (l *SourcegraphLLM) rejectEdit(id string) error {
+	_, err := l.proposals.Take(id)
+	return err
+}
+
+// proposeEdit computes the new text and a diff of every document changed by
+// the edit. Renamed and deleted documents are proposed without text.
+func (l *SourcegraphLLM) proposeEdit(command string, edit types.WorkspaceEdit) types.EditProposalParams {
+	var order []lsp.DocumentURI
+	before := make(map[lsp.DocumentURI]string)
+	after := make(map[lsp.DocumentURI]string)
+	track := func(uri lsp.DocumentURI, contents string) {
+		if _, ok := before[uri]; !ok {
+			order = append(order, uri)
+			before[uri] = contents
+			after[uri] = contents
+		}
+	}
+
+	for _, change := range edit.DocumentChanges {
+		switch change := change.(type) {
+		case types.CreateFile:
+			track(change.URI, "")
+		case types.RenameFile:
+			track(change.OldURI, l.Documents.Text(change.OldURI))
+			track(change.NewURI, "")
+			after[change.NewURI] = after[change.OldURI]
+			after[change.OldURI] = ""
+		case types.DeleteFile:
+			track(change.URI, l.Documents.Text(change.URI))
+			after[change.URI] = ""
+		case types.TextDocumentEdit:
+			uri := change.TextDocument.URI
+			track(uri, l.Documents.Text(uri))
+			after[uri] = applyTextEdits(after[uri], change.Edits)
+		}
+	}
+
+	proposal := types.EditProposalParams{
+		ID:        uuid.New().String(),
+		Command:   command,
+		Documents: []types.ProposedDocument{},
+		Edit:      edit,
+	}
+	for _, uri := range order {
+		name := strings.TrimPrefix(string(uri), "file://")
+		proposal.Documents = append(proposal.Documents, types.ProposedDocument{
+			URI:     uri,
+			NewText: after[uri],
+			Diff:    unifiedDiff(name, before[uri], after[uri]),
+		})
+	}
+
+	return proposal
+}
+
+// unifiedDiff returns a unified diff between two versions of the named file.
+func unifiedDiff(name, before, after string) string {
+	a, b := splitLinesAfter(before), splitLinesAfter(after)
+	changes := diffLines(a, b)
+	if len(changes) == 0 {
+		return ""
+	}
+
+	var diff strings.Builder
+	fmt.Fprintf(&diff, "--- a/%s\n+++ b/%s\n", strings.TrimPrefix(name, "/"), strings.TrimPrefix(name, "/"))
+	writeLine := func(prefix, line string) {
+		diff.WriteString(prefix)
+		diff.WriteString(line)
+		if !strings.HasSuffix(line, "\n") {
+			diff.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+
+	for len(changes) > 0 {
+		// Changes whose context overlaps are put in the same hunk
+		n := 1
+		for n < len(changes) && changes[n].From-changes[n-1].To <= 2*diffContext {
+			n++
+		}
+		hunk := changes[:n]
+		changes = changes[n:]
+
+		first, last := hunk[0], hunk[len(hunk)-1]
+		from := first.From - diffContext
+		if from < 0 {
+			from = 0
+		}
+		to := last.To + diffContext
+		if to > len(a) {
+			to = len(a)
+		}
+		bFrom := first.BFrom - (first.From - from)
+		bTo := last.BTo + (to - last.To)
+		fmt.Fprintf(&diff, "@@ -%s +%s @@\n", hunkRange(from, to), hunkRange(bFrom, bTo))
+
+		i := from
+		for _, change := range hunk {
+			for ; i < change.From; i++ {
+				writeLine(" ", a[i])
+			}
+			for _, line := range a[change.From:change.To] {
+				writeLine("-", line)
+			}
+			for _, line := range b[change.BFrom:change.BTo] {
+				writeLine("+", line)
+			}
+			i = change.To
+		}
+		for ; i < to; i++ {
+			writeLine(" ", a[i])
+		}
+	}
+
+	return diff.String()
+}
+
+// hunkRange formats the lines [from, to) as a unified diff range.
+func hunkRange(from, to int) string {
+	if from == to {
+		// Empty ranges refer to the line before them
+		return fmt.Sprintf("%d,0", from)
+	}
+	return fmt.Sprintf("%d,%d", from+1, to-from)
+}
@@ -0,0 +1,116 @@
+package providers
+
+import (
+	"testing"
+
+	"github.com/pjlast/llmsp/internal/documents"
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/go-lsp"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		before, after, want string
+	}{
+		{"a\n", "a\n", ""},
+		{
+			"a\nb\nc\n",
+			"a\nB\nc\n",
+			"--- a/f.go\n+++ b/f.go\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+		{
+			"",
+			"new\n",
+			"--- a/f.go\n+++ b/f.go\n@@ -0,0 +1,1 @@\n+new\n",
+		},
+		{
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			"one\n2\n3\n4\n5\n6\n7\n8\n9\nten\n",
+			"--- a/f.go\n+++ b/f.go\n@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n@@ -7,4 +7,4 @@\n 7\n 8\n 9\n-10\n+ten\n",
+		},
+		{
+			"a\nb",
+			"a\nc",
+			"--- a/f.go\n+++ b/f.go\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n",
+		},
+	}
+
+	for _, test := range tests {
+		if got := unifiedDiff("/f.go", test.before, test.after); got != test.want {
+			t.Errorf("unifiedDiff(%q, %q) == %q, want %q", test.before, test.after, got, test.want)
+		}
+	}
+}
+
+func TestProposeEdit(t *testing.T) {
+	uri := lsp.DocumentURI("file:///main.go")
+	created := lsp.DocumentURI("file:///main_test.go")
+	l := &SourcegraphLLM{Documents: documents.FromMap(types.MemoryFileMap{uri: "package main\n\nfunc main() {}\n"})}
+
+	edit := types.WorkspaceEdit{
+		DocumentChanges: []any{
+			types.TextDocumentEdit{
+				TextDocument: lsp.VersionedTextDocumentIdentifier{TextDocumentIdentifier: lsp.TextDocumentIdentifier{URI: uri}},
+				Edits: []lsp.TextEdit{{
+					Range:   lsp.Range{Start: lsp.Position{Line: 2, Character: 13}, End: lsp.Position{Line: 2, Character: 13}},
+					NewText: " println() ",
+				}},
+			},
+			types.CreateFile{Kind: "create", URI: created},
+			types.TextDocumentEdit{
+				TextDocument: lsp.VersionedTextDocumentIdentifier{TextDocumentIdentifier: lsp.TextDocumentIdentifier{URI: created}},
+				Edits:        []lsp.TextEdit{{NewText: "package main\n"}},
+			},
+		},
+	}
+
+	proposal := l.proposeEdit("cody.edit", edit)
+	if proposal.ID == "" || proposal.Command != "cody.edit" {
+		t.Errorf("proposeEdit() == %+v, want an ID and the command", proposal)
+	}
+	if len(proposal.Documents) != 2 {
+		t.Fatalf("proposeEdit() proposed %d documents, want 2", len(proposal.Documents))
+	}
+	if got, want := proposal.Documents[0].NewText, "package main\n\nfunc main() { println() }\n"; got != want {
+		t.Errorf("new text of %s == %q, want %q", uri, got, want)
+	}
+	if got, want := proposal.Documents[1].Diff, "--- a/main_test.go\n+++ b/main_test.go\n@@ -0,0 +1,1 @@\n+package main\n"; got != want {
+		t.Errorf("diff of %s == %q, want %q", created, got, want)
+	}
+
+	l.proposals.Add(proposal)
+	if err := l.rejectEdit(proposal.ID); err != nil {
+		t.Errorf("rejectEdit() == %v, want nil", err)
+	}
+	if err := l.rejectEdit(proposal.ID); err == nil {
+		t.Error("rejecting a proposal twice succeeded, want an error")
+	}
+}
+
+func TestProposeResourceOperations(t *testing.T) {
+	old := lsp.DocumentURI("file:///old.go")
+	renamed := lsp.DocumentURI("file:///new.go")
+	deleted := lsp.DocumentURI("file:///unused.go")
+	l := &SourcegraphLLM{Documents: documents.FromMap(types.MemoryFileMap{
+		old:     "package main\n",
+		deleted: "package unused\n",
+	})}
+
+	edit := types.WorkspaceEdit{
+		DocumentChanges: []any{
+			types.RenameFile{Kind: "rename", OldURI: old, NewURI: renamed},
+			types.DeleteFile{Kind: "delete", URI: deleted},
+		},
+	}
+
+	proposal := l.proposeEdit("cody.edit", edit)
+	want := map[lsp.DocumentURI]string{old: "", renamed: "package main\n", deleted: ""}
+	if len(proposal.Documents) != len(want) {
+		t.Fatalf("proposeEdit() proposed %d documents, want %d", len(proposal.Documents), len(want))
+	}
+	for _, doc := range proposal.Documents {
+		if doc.NewText != want[doc.URI] {
+			t.Errorf("new text of %s == %q, want %q", doc.URI, doc.NewText, want[doc.URI])
+		}
+	}
+}
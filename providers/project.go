@@ -0,0 +1,128 @@
+package providers
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sourcegraph/go-lsp"
+)
+
+// projectMarkers are the files that mark the root of a (sub)project.
+var projectMarkers = []string{
+	"go.mod", "package.json", "BUILD", "BUILD.bazel", "Cargo.toml",
+	"pyproject.toml", "setup.py", "pom.xml", "build.gradle", "Gemfile",
+	"composer.json",
+}
+
+const (
+	// maxExampleTestFiles is the number of files checked while looking for an
+	// example test file in a project.
+	maxExampleTestFiles = 2000
+	// maxExampleTestTokens is the maximum length of an example test file.
+	maxExampleTestTokens = 1000
+)
+
+// findUp returns the closest directory containing one of names, starting at
+// dir and walking up to stop. It returns an empty string if there is none.
+func findUp(dir, stop string, names ...string) string {
+	for {
+		for _, name := range names {
+			if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+				return dir
+			}
+		}
+		parent := filepath.Dir(dir)
+		if dir == stop || parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// projectRoot returns the root directory of the subproject containing the
+// document, or an empty string if it isn't part of one.
+func (l *SourcegraphLLM) projectRoot(uri lsp.DocumentURI) string {
+	filename := strings.TrimPrefix(string(uri), "file://")
+	if !filepath.IsAbs(filename) {
+		return ""
+	}
+	return findUp(filepath.Dir(filename), l.workspaceRoot(), projectMarkers...)
+}
+
+// inProject reports whether the document is part of the project rooted at
+// root. All documents are part of the empty project.
+func inProject(root string, uri lsp.DocumentURI) bool {
+	if root == "" {
+		return true
+	}
+	filename := strings.TrimPrefix(string(uri), "file://")
+	return filename == root || strings.HasPrefix(filename, root+string(filepath.Separator))
+}
+
+// repoRelativeProject returns the path of the project rooted at root relative
+// to the root of its git repository, as used by embeddings search results. It
+// returns an empty string for the repository root itself.
+func repoRelativeProject(root string) string {
+	if root == "" {
+		return ""
+	}
+	repoRoot := findUp(root, "/", ".git")
+	if repoRoot == "" {
+		return ""
+	}
+	rel, err := filepath.Rel(repoRoot, root)
+	if err != nil || rel == "." {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
+
+// inRepoProject reports whether a repository relative path is part of the
+// project at the repository relative path project.
+func inRepoProject(project, path string) bool {
+	return project == "" || path == project || strings.HasPrefix(path, project+"/")
+}
+
+// exampleTestFile returns the name and contents of an existing test file for
+// the language in the project, so generated tests can follow the project's
+// conventions.
+func exampleTestFile(root, language string) (string, string, bool) {
+	if root == "" {
+		return "", "", false
+	}
+
+	var example string
+	checked := 0
+	_ = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != root && (strings.HasPrefix(d.Name(), ".") || d.Name() == "node_modules" || d.Name() == "vendor") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		checked++
+		if checked > maxExampleTestFiles {
+			return filepath.SkipAll
+		}
+		if classifyFile(path) == testFile && determineLanguage(path) == language {
+			example = path
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	if example == "" {
+		return "", "", false
+	}
+
+	data, err := os.ReadFile(example)
+	if err != nil {
+		return "", "", false
+	}
+	contents, _ := truncateText(string(data), maxExampleTestTokens)
+	return example, contents, true
+}
@@ -0,0 +1,101 @@
+package providers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pjlast/llmsp/sourcegraph/embeddings"
+	"github.com/sourcegraph/go-lsp"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, contents := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestProjectRoot(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		".git/HEAD":                  "",
+		"services/api/go.mod":        "module api",
+		"services/api/internal/a.go": "package internal",
+		"web/package.json":           "{}",
+		"web/src/app.ts":             "",
+		"scripts/run.sh":             "",
+	})
+	l := &SourcegraphLLM{WorkspaceRoot: "file://" + root}
+
+	tests := []struct {
+		file        string
+		wantRoot    string
+		wantProject string
+	}{
+		{"services/api/internal/a.go", filepath.Join(root, "services/api"), "services/api"},
+		{"web/src/app.ts", filepath.Join(root, "web"), "web"},
+		{"scripts/run.sh", "", ""},
+	}
+	for _, test := range tests {
+		uri := lsp.DocumentURI("file://" + filepath.Join(root, test.file))
+		got := l.projectRoot(uri)
+		if got != test.wantRoot {
+			t.Errorf("projectRoot(%q) == %q, want %q", test.file, got, test.wantRoot)
+		}
+		if project := repoRelativeProject(got); project != test.wantProject {
+			t.Errorf("repoRelativeProject(%q) == %q, want %q", got, project, test.wantProject)
+		}
+	}
+
+	if !inProject(filepath.Join(root, "web"), lsp.DocumentURI("file://"+filepath.Join(root, "web/src/app.ts"))) {
+		t.Error("expected web/src/app.ts to be in the web project")
+	}
+	if inProject(filepath.Join(root, "web"), lsp.DocumentURI("file://"+filepath.Join(root, "webapp/main.ts"))) {
+		t.Error("expected webapp/main.ts not to be in the web project")
+	}
+}
+
+func TestProjectEmbeddings(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		".git/HEAD":    "",
+		"api/go.mod":   "module api",
+		"api/main.go":  "package main",
+		"web/index.js": "",
+	})
+	l := &SourcegraphLLM{WorkspaceRoot: "file://" + root}
+	results := []embeddings.EmbeddingsResult{{FileName: "api/handler.go"}, {FileName: "web/index.js"}}
+
+	got := l.projectEmbeddings("file://"+filepath.Join(root, "api/main.go"), results)
+	if len(got) != 1 || got[0].FileName != "api/handler.go" {
+		t.Errorf("projectEmbeddings() == %v, want only api/handler.go", got)
+	}
+}
+
+func TestExampleTestFile(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"a.go":                "package a",
+		"node_modules/x.js":   "",
+		"pkg/b/b_test.go":     "package b\n\nfunc TestB(t *testing.T) {}",
+		"pkg/b/b.py":          "",
+		"pkg/b/test_b.py":     "def test_b(): pass",
+		".hidden/c_test.go":   "package c",
+		"pkg/b/testdata/x.go": "",
+	})
+
+	name, contents, ok := exampleTestFile(root, "Go")
+	if !ok || filepath.Base(name) != "b_test.go" || contents == "" {
+		t.Errorf("exampleTestFile() == %q, %q, %v, want b_test.go", name, contents, ok)
+	}
+	if _, _, ok := exampleTestFile(root, "Ruby"); ok {
+		t.Error("expected no example test file for Ruby")
+	}
+}
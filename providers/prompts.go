@@ -0,0 +1,45 @@
+package providers
+
+import (
+	"github.com/pjlast/llmsp/internal/prompts"
+	"github.com/pjlast/llmsp/types"
+)
+
+// SetPrompts overrides the prompt templates with the given settings. Templates
+// that aren't overridden are reset to their defaults. If the settings are
+// invalid, the templates in use are kept and an error is returned. The
+// preamble instructions of the settings are set either way.
+func (l *SourcegraphLLM) SetPrompts(settings *types.PromptSettings) error {
+	overrides := make(map[string]string)
+	if settings != nil && settings.File != "" {
+		fromFile, err := prompts.LoadFile(settings.File)
+		if err != nil {
+			return err
+		}
+		overrides = fromFile
+	}
+	if settings != nil {
+		for name, text := range settings.Templates {
+			overrides[name] = text
+		}
+	}
+
+	l.Mu.Lock()
+	l.preamble = ""
+	if settings != nil {
+		l.preamble = settings.Preamble
+	}
+	if l.Prompts == nil {
+		l.Prompts = prompts.New()
+	}
+	registry := l.Prompts
+	l.Mu.Unlock()
+	return registry.Override(overrides)
+}
+
+// prompt renders the named prompt template with the repository of the
+// workspace filled in.
+func (l *SourcegraphLLM) prompt(name string, data prompts.Data) (string, error) {
+	data.RepoName = l.RepoName
+	return l.Prompts.Render(name, data)
+}
@@ -0,0 +1,21 @@
+package providers
+
+// Quiesce drops the caches of the provider and closes idle HTTP connections.
+// The local index is rebuilt the next time it is searched.
+func (l *SourcegraphLLM) Quiesce() {
+	l.goContext.clear()
+
+	l.Mu.Lock()
+	if l.localIndex != nil {
+		l.localIndex = nil
+		l.localIndexDropped = true
+	}
+	l.Mu.Unlock()
+
+	if l.ClaudeClient != nil {
+		l.ClaudeClient.CloseIdleConnections()
+	}
+	if l.EmbeddingsClient != nil {
+		l.EmbeddingsClient.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,74 @@
+package providers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pjlast/llmsp/claude"
+	"github.com/pjlast/llmsp/internal/documents"
+)
+
+const (
+	// maxRecentEditTokens is the maximum length of the recent changes in
+	// prompts.
+	maxRecentEditTokens = 500
+	// maxRecentEditLines is the number of removed and added lines shown for
+	// every edit.
+	maxRecentEditLines = 10
+)
+
+// recentEditsMessages returns messages describing the recent edits of the
+// open documents, which tell what the user is in the middle of, e.g. during
+// a refactor. The most recent edits that fit in maxRecentEditTokens are
+// described, oldest first.
+func (l *SourcegraphLLM) recentEditsMessages() []claude.Message {
+	edits := l.Documents.RecentEdits()
+
+	var described []string
+	tokens := 0
+	for i := len(edits) - 1; i >= 0; i-- {
+		if l.ignored(string(edits[i].URI)) {
+			continue
+		}
+		text := describeEdit(edits[i])
+		if tokens += getTokenLength(text); tokens > maxRecentEditTokens {
+			break
+		}
+		described = append(described, text)
+	}
+	if len(described) == 0 {
+		return nil
+	}
+	reverseSlice(described)
+
+	return []claude.Message{
+		{
+			Speaker: claude.Human,
+			Text:    "Here are the changes I made recently, the most recent last:\n" + strings.Join(described, "\n"),
+			Source:  &claude.Source{Kind: "recentEdits"},
+		},
+		{
+			Speaker: claude.Assistant,
+			Text:    "Ok.",
+		},
+	}
+}
+
+// describeEdit returns a compact diff of the edit, with its removed lines
+// prefixed with - and its added lines with +.
+func describeEdit(edit documents.Edit) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "`%s` line %d:\n", strings.TrimPrefix(string(edit.URI), "file://"), edit.Line+1)
+	writeLines := func(prefix string, lines []string) {
+		for i, line := range lines {
+			if i == maxRecentEditLines {
+				fmt.Fprintf(&sb, "%s... (%d more lines)\n", prefix, len(lines)-i)
+				return
+			}
+			sb.WriteString(prefix + line + "\n")
+		}
+	}
+	writeLines("-", edit.Removed)
+	writeLines("+", edit.Added)
+	return sb.String()
+}
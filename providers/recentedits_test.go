@@ -0,0 +1,37 @@
+package providers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pjlast/llmsp/internal/documents"
+	"github.com/sourcegraph/go-lsp"
+)
+
+func TestDescribeEdit(t *testing.T) {
+	edit := documents.Edit{URI: "file:///src/a.go", Line: 2, Removed: []string{"func A() {}"}, Added: []string{"func A() int {", "\treturn 1", "}"}}
+	want := "`/src/a.go` line 3:\n-func A() {}\n+func A() int {\n+\treturn 1\n+}\n"
+	if got := describeEdit(edit); got != want {
+		t.Errorf("describeEdit() == %q, want %q", got, want)
+	}
+
+	long := documents.Edit{URI: "file:///a.go", Added: strings.Split(strings.Repeat("x\n", maxRecentEditLines+5), "\n")}
+	if got := describeEdit(long); !strings.HasSuffix(got, "+... (6 more lines)\n") {
+		t.Errorf("describeEdit() of a long edit == %q, want the lines past %d elided", got, maxRecentEditLines)
+	}
+}
+
+func TestRecentEditsMessages(t *testing.T) {
+	uri := lsp.DocumentURI("file:///a.go")
+	l := &SourcegraphLLM{Documents: documents.NewStore()}
+	l.Documents.Open(uri, "package a\n", 1)
+	if messages := l.recentEditsMessages(); messages != nil {
+		t.Errorf("recentEditsMessages() without edits == %+v, want none", messages)
+	}
+
+	l.Documents.Change(uri, 2, func(string) (string, error) { return "package b\n", nil })
+	messages := l.recentEditsMessages()
+	if len(messages) != 2 || !strings.Contains(messages[0].Text, "-package a\n+package b\n") {
+		t.Errorf("recentEditsMessages() == %+v, want the change of the package clause", messages)
+	}
+}
@@ -0,0 +1,222 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pjlast/llmsp/claude"
+	"github.com/pjlast/llmsp/internal/promptbuilder"
+	"github.com/pjlast/llmsp/internal/prompts"
+	"github.com/pjlast/llmsp/sourcegraph/embeddings"
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+const (
+	// repoCodeResults and repoTextResults are the number of embeddings
+	// results retrieved for questions about the repositories.
+	repoCodeResults = 12
+	repoTextResults = 3
+	// repoSearchResults is the number of search results retrieved for
+	// questions about the repositories.
+	repoSearchResults = 8
+	// maxQuestionKeywords is the number of words of a question searched
+	// for.
+	maxQuestionKeywords = 5
+)
+
+// questionWords are the words of questions that aren't worth searching for.
+var questionWords = map[string]bool{
+	"about": true, "are": true, "does": true, "done": true, "how": true, "implemented": true,
+	"the": true, "there": true, "this": true, "what": true, "when": true, "where": true,
+	"which": true, "who": true, "why": true, "code": true, "handled": true, "used": true,
+	"defined": true, "and": true, "can": true, "should": true, "that": true, "repo": true,
+}
+
+// citationMarker matches the citations of snippets in answers, such as [2].
+var citationMarker = regexp.MustCompile(`\[(\d+)\]`)
+
+// askRepo answers a question about the repository of the workspace and the
+// configured embeddings repositories, without a current file. Context is
+// retrieved by searching embeddings and Sourcegraph for the question, and
+// the answer cites the snippets it is based on.
+func (l *SourcegraphLLM) askRepo(ctx context.Context, conn *jsonrpc2.Conn, progressToken, question string) (*types.RepoAnswer, error) {
+	snippets := l.repoSnippets(ctx, question)
+
+	// Snippets are numbered from the most relevant, and added from the
+	// least relevant so that they are the ones dropped if the prompt is too
+	// long
+	var snippetMessages []claude.Message
+	for i := len(snippets) - 1; i >= 0; i-- {
+		snippet := snippets[i]
+		snippetMessages = append(snippetMessages, claude.Message{
+			Speaker: claude.Human,
+			Text:    fmt.Sprintf("Snippet [%d], from `%s`:\n```\n%s\n```", i+1, snippetFile(snippet), snippet.Content),
+			Source:  fileSource(snippet.kind, snippet.FileName, snippet.Content, snippet.StartLine),
+		}, claude.Message{Speaker: claude.Assistant, Text: "Ok."})
+	}
+
+	instruction, err := l.prompt(prompts.Ask, prompts.Data{RepoName: l.RepoName, Question: question})
+	if err != nil {
+		return nil, err
+	}
+	input := []claude.Message{
+		{Speaker: claude.Human, Text: instruction},
+		{Speaker: claude.Assistant, Text: ""},
+	}
+	prompt := promptbuilder.New(promptbuilder.NewBudget(l.maxPromptTokens(chatModel)))
+	prompt.Add(promptbuilder.Section{Name: "preamble", Messages: l.getPreamble(), Priority: 3, Trim: promptbuilder.KeepFirst})
+	prompt.Add(promptbuilder.Section{Name: "snippets", Messages: snippetMessages, Priority: 1})
+	prompt.Add(promptbuilder.Section{Name: "input", Messages: input, Priority: 4})
+
+	answer, err := l.streamChat(ctx, conn, progressToken, prompt.Build())
+	if err != nil {
+		return nil, err
+	}
+	answer = strings.TrimSpace(answer)
+
+	l.appendMemory(
+		claude.Message{Speaker: claude.Human, Text: question},
+		claude.Message{Speaker: claude.Assistant, Text: answer})
+
+	return &types.RepoAnswer{Answer: answer, Citations: citations(answer, snippets)}, nil
+}
+
+// repoSnippet is a result retrieved for a question about the repositories.
+type repoSnippet struct {
+	embeddings.EmbeddingsResult
+	// kind is the kind of context of the result, embeddings or search
+	kind string
+}
+
+// repoSnippets returns the embeddings and search results for a question
+// about the repositories, the most relevant first, without duplicates.
+func (l *SourcegraphLLM) repoSnippets(ctx context.Context, question string) []repoSnippet {
+	var snippets []repoSnippet
+	embs, err := l.searchEmbeddings(ctx, l.WorkspaceRoot, question, repoCodeResults, repoTextResults)
+	if err == nil && embs != nil {
+		for _, result := range append(embs.CodeResults, embs.TextResults...) {
+			snippets = append(snippets, repoSnippet{result, "embeddings"})
+		}
+	}
+	for _, result := range l.searchQuestion(ctx, question) {
+		snippets = append(snippets, repoSnippet{result, "search"})
+	}
+
+	type location struct {
+		repo, file string
+		line       int
+	}
+	seen := make(map[location]bool)
+	var unique []repoSnippet
+	for _, snippet := range snippets {
+		loc := location{snippet.RepoName, snippet.FileName, snippet.StartLine}
+		if seen[loc] || strings.TrimSpace(snippet.Content) == "" {
+			continue
+		}
+		seen[loc] = true
+		unique = append(unique, snippet)
+	}
+	return unique
+}
+
+// searchQuestion searches the repository of the workspace on Sourcegraph
+// for the definitions of the identifiers of the question, and for the lines
+// containing its other words. It returns nil if the repository isn't known
+// or the search fails.
+func (l *SourcegraphLLM) searchQuestion(ctx context.Context, question string) []embeddings.EmbeddingsResult {
+	results := l.withoutIgnored(l.searchDefinitions(ctx, l.WorkspaceRoot, question, repoSearchResults))
+	repo := l.repoFor(l.WorkspaceRoot)
+	keywords := questionKeywords(question)
+	if l.EmbeddingsClient == nil || repo.Name == "" || len(keywords) == 0 || len(results) >= repoSearchResults {
+		return results
+	}
+
+	ctx, cancel := l.withTimeout(ctx, "search")
+	defer cancel()
+	found, err := l.EmbeddingsClient.SearchKeywords(ctx, repo.Name, keywords, repoSearchResults-len(results))
+	if err != nil {
+		l.Logger.Debug("keyword search failed", "err", err)
+		return results
+	}
+	for _, result := range found {
+		if l.ignored(result.FileName) {
+			continue
+		}
+		results = append(results, embeddings.EmbeddingsResult{
+			RepoName:  result.RepoName,
+			FileName:  result.FileName,
+			StartLine: result.StartLine,
+			EndLine:   result.EndLine,
+			Content:   result.Content,
+		})
+	}
+	return results
+}
+
+// questionKeywords returns the words of a question worth searching for,
+// skipping identifiers, which are searched as definitions, and the words
+// of every question.
+func questionKeywords(question string) []string {
+	identifiers := make(map[string]bool)
+	for _, name := range identifiersNear(question, maxSearchIdentifiers) {
+		identifiers[name] = true
+	}
+	var keywords []string
+	seen := make(map[string]bool)
+	for _, word := range identifier.FindAllString(question, -1) {
+		lower := strings.ToLower(word)
+		if identifiers[word] || seen[lower] || questionWords[lower] || commonWords[word] {
+			continue
+		}
+		seen[lower] = true
+		keywords = append(keywords, word)
+		if len(keywords) == maxQuestionKeywords {
+			break
+		}
+	}
+	return keywords
+}
+
+// snippetFile returns the file of a snippet, prefixed by its repository if
+// it is known.
+func snippetFile(snippet repoSnippet) string {
+	if snippet.RepoName == "" {
+		return snippet.FileName
+	}
+	return snippet.RepoName + "/" + snippet.FileName
+}
+
+// citations returns the snippets cited in the answer, in the order of their
+// numbers. Numbers that aren't those of a snippet are ignored.
+func citations(answer string, snippets []repoSnippet) []types.Citation {
+	cited := make(map[int]bool)
+	for _, match := range citationMarker.FindAllStringSubmatch(answer, -1) {
+		if n, err := strconv.Atoi(match[1]); err == nil && n >= 1 && n <= len(snippets) {
+			cited[n] = true
+		}
+	}
+	numbers := make([]int, 0, len(cited))
+	for n := range cited {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+
+	result := make([]types.Citation, 0, len(numbers))
+	for _, n := range numbers {
+		snippet := snippets[n-1]
+		source := fileSource("", snippet.FileName, snippet.Content, snippet.StartLine)
+		result = append(result, types.Citation{
+			Index:     n,
+			Repo:      snippet.RepoName,
+			File:      snippet.FileName,
+			StartLine: source.StartLine,
+			EndLine:   source.EndLine,
+		})
+	}
+	return result
+}
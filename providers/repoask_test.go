@@ -0,0 +1,109 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pjlast/llmsp/claude"
+	"github.com/pjlast/llmsp/sourcegraph/embeddings"
+	"github.com/pjlast/llmsp/types"
+)
+
+func TestQuestionKeywords(t *testing.T) {
+	tests := []struct {
+		question string
+		want     []string
+	}{
+		{"Where is auth handled?", []string{"auth"}},
+		{"How does the session middleware refresh tokens?", []string{"session", "middleware", "refresh", "tokens"}},
+		// Identifiers are searched as definitions
+		{"What calls NewServer and where are routes registered?", []string{"calls", "routes", "registered"}},
+		{"Why?", nil},
+	}
+	for _, test := range tests {
+		if got := questionKeywords(test.question); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("questionKeywords(%q) == %q, want %q", test.question, got, test.want)
+		}
+	}
+}
+
+func TestCitations(t *testing.T) {
+	snippets := []repoSnippet{
+		{EmbeddingsResult: embeddings.EmbeddingsResult{RepoName: "github.com/a/app", FileName: "auth/middleware.go", StartLine: 9, Content: "func Middleware() {\n}"}},
+		{EmbeddingsResult: embeddings.EmbeddingsResult{FileName: "README.md", StartLine: 0, Content: "# App"}},
+	}
+	answer := "Requests are authenticated by the middleware [1][1], as documented in [2]. See also [7]."
+	want := []types.Citation{
+		{Index: 1, Repo: "github.com/a/app", File: "auth/middleware.go", StartLine: 10, EndLine: 11},
+		{Index: 2, File: "README.md", StartLine: 1, EndLine: 1},
+	}
+	if got := citations(answer, snippets); !reflect.DeepEqual(got, want) {
+		t.Errorf("citations() == %+v, want %+v", got, want)
+	}
+	if got := citations("No idea.", snippets); len(got) != 0 {
+		t.Errorf("citations() without citations == %+v, want none", got)
+	}
+}
+
+func TestAskRepo(t *testing.T) {
+	var prompt string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Query     string
+			Variables struct {
+				Query    string
+				Messages []claude.Message
+			}
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Error(err)
+		}
+		switch {
+		case strings.Contains(request.Query, "GetCompletions"):
+			for _, message := range request.Variables.Messages {
+				prompt += message.Text + "\n"
+			}
+			w.Write([]byte(`{"data": {"completions": "Tokens are checked by the auth middleware [1]."}}`))
+		case strings.Contains(request.Variables.Query, "type:file"):
+			w.Write([]byte(`{"data": {"search": {"results": {"results": [{"__typename": "FileMatch",
+				"repository": {"name": "github.com/a/app"},
+				"file": {"path": "auth/middleware.go"},
+				"lineMatches": [{"preview": "func authMiddleware(next http.Handler) http.Handler {", "lineNumber": 12}]}]}}}}`))
+		default:
+			w.Write([]byte(`{"data": {"search": {"results": {"results": []}}}}`))
+		}
+	}))
+	defer server.Close()
+
+	l := &SourcegraphLLM{
+		ClaudeClient:     claude.NewClient(server.URL, "", server.Client()),
+		EmbeddingsClient: embeddings.NewClient(server.URL, "", server.Client()),
+		WorkspaceRoot:    "file:///src/app",
+		Repositories:     []Repository{{Root: "/src/app", Name: "github.com/a/app"}},
+		// Without streaming or embeddings
+		features: featuresOf("4.5.1"),
+	}
+	answer, err := l.askRepo(context.Background(), nil, "", "Where is auth handled?")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(prompt, "Snippet [1], from `github.com/a/app/auth/middleware.go`:\n```\nfunc authMiddleware") {
+		t.Errorf("prompt %q doesn't contain the search result", prompt)
+	}
+	want := &types.RepoAnswer{
+		Answer:    "Tokens are checked by the auth middleware [1].",
+		Citations: []types.Citation{{Index: 1, Repo: "github.com/a/app", File: "auth/middleware.go", StartLine: 13, EndLine: 13}},
+	}
+	if !reflect.DeepEqual(answer, want) {
+		t.Errorf("askRepo() == %+v, want %+v", answer, want)
+	}
+	if len(l.InteractionMemory) != 2 || l.InteractionMemory[0].Text != "Where is auth handled?" {
+		t.Errorf("interaction memory == %+v, want the question and the answer", l.InteractionMemory)
+	}
+}
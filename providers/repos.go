@@ -0,0 +1,283 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pjlast/llmsp/sourcegraph/embeddings"
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/go-lsp"
+)
+
+// Repository is a Sourcegraph repository checked out in the workspace.
+type Repository struct {
+	// Root is the directory the repository is checked out in
+	Root string
+	// Name is the name of the repository on Sourcegraph
+	Name string
+	// ID is the GraphQL ID of the repository on Sourcegraph
+	ID string
+	// Weight is how strongly embeddings results from the repository are
+	// preferred over results from other repositories
+	Weight float64
+}
+
+// gitRemoteURL returns the URL of the origin remote of the git repository
+// containing dir.
+func gitRemoteURL(dir string) string {
+	cmd := exec.Command("git", "remote", "get-url", "origin")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// workspaceFolderPaths returns the paths of the workspace folders, falling
+// back to the workspace root if the client didn't send any folders.
+func (l *SourcegraphLLM) workspaceFolderPaths() []string {
+	l.Mu.Lock()
+	folders := l.WorkspaceFolders
+	l.Mu.Unlock()
+	if len(folders) == 0 {
+		return []string{l.workspaceRoot()}
+	}
+
+	paths := make([]string, len(folders))
+	for i, folder := range folders {
+		paths[i] = strings.TrimPrefix(string(folder), "file://")
+	}
+	return paths
+}
+
+// detectRepositories looks up the Sourcegraph repositories checked out in
+// the workspace folders. The repository of the first folder becomes the
+// default repository.
+func (l *SourcegraphLLM) detectRepositories(ctx context.Context) {
+	var repos []Repository
+	seen := make(map[string]bool)
+	for _, dir := range l.workspaceFolderPaths() {
+		root := findUp(dir, "/", ".git")
+		if root == "" || seen[root] {
+			continue
+		}
+		seen[root] = true
+
+		gitURL := gitRemoteURL(root)
+		if gitURL == "" {
+			continue
+		}
+		repoName := getRepoName(gitURL)
+		repoID, err := l.EmbeddingsClient.GetRepoID(ctx, repoName)
+		// Repositories that aren't known to Sourcegraph are skipped
+		if err != nil {
+			l.Logger.Debug("skipping repository", "name", repoName, "err", err)
+			continue
+		}
+		repos = append(repos, Repository{Root: root, Name: repoName, ID: repoID})
+	}
+
+	l.Mu.Lock()
+	defer l.Mu.Unlock()
+	l.Repositories = repos
+	l.RepoID, l.RepoName = "", ""
+	if len(repos) > 0 {
+		l.RepoID, l.RepoName = repos[0].ID, repos[0].Name
+	}
+}
+
+// SetWorkspaceFolders updates the workspace folders and re-detects the
+// repositories checked out in them.
+func (l *SourcegraphLLM) SetWorkspaceFolders(ctx context.Context, folders []lsp.DocumentURI) {
+	l.Mu.Lock()
+	l.WorkspaceFolders = folders
+	l.Mu.Unlock()
+
+	l.detectRepositories(ctx)
+	l.loadIgnoreRules()
+	l.buildLocalIndex()
+}
+
+// repoIDFor returns the ID of the repository containing the file, falling
+// back to the default repository.
+func (l *SourcegraphLLM) repoIDFor(filename string) string {
+	return l.repoFor(filename).ID
+}
+
+// repoFor returns the repository containing the file, falling back to the
+// default repository.
+func (l *SourcegraphLLM) repoFor(filename string) Repository {
+	l.Mu.Lock()
+	defer l.Mu.Unlock()
+
+	path := strings.TrimPrefix(filename, "file://")
+	best := Repository{ID: l.RepoID, Name: l.RepoName}
+	for _, repo := range l.Repositories {
+		// Prefer the innermost repository, for nested checkouts
+		if (path == repo.Root || strings.HasPrefix(path, repo.Root+string(filepath.Separator))) && len(repo.Root) > len(best.Root) {
+			best = repo
+		}
+	}
+	return best
+}
+
+// resolveEmbeddingsRepos looks up the IDs of the configured embeddings
+// repositories. Repositories that aren't known to Sourcegraph are skipped.
+func (l *SourcegraphLLM) resolveEmbeddingsRepos(ctx context.Context, configured []types.EmbeddingsRepo) {
+	var repos []Repository
+	for _, repo := range configured {
+		repoID, err := l.EmbeddingsClient.GetRepoID(ctx, repo.Name)
+		if err != nil {
+			l.Logger.Warn("skipping embeddings repository", "name", repo.Name, "err", err)
+			continue
+		}
+		weight := repo.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		repos = append(repos, Repository{Name: repo.Name, ID: repoID, Weight: weight})
+	}
+
+	l.Mu.Lock()
+	defer l.Mu.Unlock()
+	l.EmbeddingsRepos = repos
+}
+
+// searchEmbeddings searches the embeddings of the repository containing the
+// file along with those of the configured embeddings repositories. If there
+// are no repositories with embeddings, or the search fails, e.g. because it
+// is rate limited or takes longer than the embeddings timeout, context is
+// taken from the definitions of the identifiers near the end of the query,
+// found by searching Sourcegraph, and from the local index instead.
+func (l *SourcegraphLLM) searchEmbeddings(ctx context.Context, filename, query string, codeResults, textResults int) (*embeddings.EmbeddingsSearchResult, error) {
+	// The query may be taken from the file
+	if l.ignored(filename) {
+		return nil, nil
+	}
+	embeddingsCtx, cancel := l.withTimeout(ctx, "embeddings")
+	defer cancel()
+	results, err := l.searchRepoEmbeddings(embeddingsCtx, filename, query, codeResults, textResults)
+	if err != nil {
+		l.reportEmbeddingsError(err)
+	}
+	if err != nil || results == nil {
+		definitions := l.withoutIgnored(l.searchDefinitions(ctx, filename, query, codeResults))
+		local := l.searchLocalIndex(query, codeResults, textResults)
+		if definitions != nil || local != nil {
+			return fallbackResults(definitions, local, codeResults), nil
+		}
+	}
+	if results != nil {
+		results.CodeResults = l.withoutIgnored(results.CodeResults)
+		results.TextResults = l.withoutIgnored(results.TextResults)
+	}
+	return results, err
+}
+
+// fallbackResults combines the definitions found by searching Sourcegraph
+// with the results of the local index, definitions first, keeping up to
+// codeResults code results.
+func fallbackResults(definitions []embeddings.EmbeddingsResult, local *embeddings.EmbeddingsSearchResult, codeResults int) *embeddings.EmbeddingsSearchResult {
+	results := &embeddings.EmbeddingsSearchResult{CodeResults: definitions}
+	if local != nil {
+		results.CodeResults = append(results.CodeResults, local.CodeResults...)
+		results.TextResults = local.TextResults
+	}
+	if len(results.CodeResults) > codeResults {
+		results.CodeResults = results.CodeResults[:codeResults]
+	}
+	return results
+}
+
+// reportEmbeddingsError logs why embeddings couldn't be searched. Disabled
+// embeddings and unknown repositories are only reported once, as they don't
+// go away by themselves.
+func (l *SourcegraphLLM) reportEmbeddingsError(err error) {
+	if errors.Is(err, embeddings.ErrEmbeddingsNotEnabled) || errors.Is(err, embeddings.ErrRepoNotFound) {
+		l.embeddingsUnavailable.Do(func() {
+			l.Logger.Warn("embeddings are unavailable, context is taken from the local index instead", "err", err)
+		})
+		return
+	}
+	l.Logger.Debug("embeddings search failed", "err", err)
+}
+
+// searchRepoEmbeddings searches the Sourcegraph embeddings of the repository
+// containing the file and of the configured embeddings repositories. It
+// returns nil if there are no repositories to search or if the instance
+// doesn't support embeddings search.
+func (l *SourcegraphLLM) searchRepoEmbeddings(ctx context.Context, filename, query string, codeResults, textResults int) (*embeddings.EmbeddingsSearchResult, error) {
+	if !l.features.supports(featureEmbeddings) {
+		return nil, nil
+	}
+
+	var repos []Repository
+	if repo := l.repoFor(filename); repo.ID != "" {
+		repo.Weight = 1
+		repos = append(repos, repo)
+	}
+	l.Mu.Lock()
+	for _, repo := range l.EmbeddingsRepos {
+		if len(repos) == 0 || repo.ID != repos[0].ID {
+			repos = append(repos, repo)
+		}
+	}
+	l.Mu.Unlock()
+
+	switch len(repos) {
+	case 0:
+		return nil, nil
+	case 1:
+		return l.EmbeddingsClient.GetEmbeddings(ctx, repos[0].ID, query, codeResults, textResults)
+	}
+
+	ids := make([]string, len(repos))
+	weights := make(map[string]float64, len(repos))
+	for i, repo := range repos {
+		ids[i] = repo.ID
+		weights[repo.Name] = repo.Weight
+	}
+	results, err := l.EmbeddingsClient.GetMultiEmbeddings(ctx, ids, query, codeResults, textResults)
+	if err != nil {
+		return nil, err
+	}
+	results.CodeResults = weightEmbeddings(results.CodeResults, weights)
+	results.TextResults = weightEmbeddings(results.TextResults, weights)
+	return results, nil
+}
+
+// weightEmbeddings reorders multi-repository search results by the weight of
+// their repository. Each result is scored by its repository's weight divided
+// by its rank among the results of that repository, so results from heavier
+// repositories move up without burying the best results of the others.
+func weightEmbeddings(results []embeddings.EmbeddingsResult, weights map[string]float64) []embeddings.EmbeddingsResult {
+	scores := make([]float64, len(results))
+	ranks := make(map[string]int)
+	for i, result := range results {
+		weight, ok := weights[result.RepoName]
+		if !ok {
+			weight = 1
+		}
+		ranks[result.RepoName]++
+		scores[i] = weight / float64(ranks[result.RepoName])
+	}
+
+	indexes := make([]int, len(results))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sort.SliceStable(indexes, func(i, j int) bool {
+		return scores[indexes[i]] > scores[indexes[j]]
+	})
+
+	weighted := make([]embeddings.EmbeddingsResult, len(results))
+	for i, index := range indexes {
+		weighted[i] = results[index]
+	}
+	return weighted
+}
@@ -0,0 +1,74 @@
+package providers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pjlast/llmsp/sourcegraph/embeddings"
+	"github.com/sourcegraph/go-lsp"
+)
+
+func TestRepoIDFor(t *testing.T) {
+	l := &SourcegraphLLM{
+		RepoID: "default",
+		Repositories: []Repository{
+			{Root: "/src/app", ID: "app"},
+			{Root: "/src/app/third_party/lib", ID: "lib"},
+			{Root: "/src/tools", ID: "tools"},
+		},
+	}
+
+	tests := []struct {
+		filename string
+		want     string
+	}{
+		{"file:///src/app/main.go", "app"},
+		{"file:///src/app/third_party/lib/lib.go", "lib"},
+		{"file:///src/tools/gen.go", "tools"},
+		{"file:///src/toolsx/gen.go", "default"},
+		{"file:///tmp/scratch.go", "default"},
+	}
+	for _, test := range tests {
+		if got := l.repoIDFor(test.filename); got != test.want {
+			t.Errorf("repoIDFor(%q) == %q, want %q", test.filename, got, test.want)
+		}
+	}
+}
+
+func TestWorkspaceFolderPaths(t *testing.T) {
+	l := &SourcegraphLLM{WorkspaceRoot: "file:///src/app"}
+	if got, want := l.workspaceFolderPaths(), []string{"/src/app"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("workspaceFolderPaths() == %v, want %v", got, want)
+	}
+
+	l.WorkspaceFolders = []lsp.DocumentURI{"file:///src/app", "file:///src/tools"}
+	if got, want := l.workspaceFolderPaths(), []string{"/src/app", "/src/tools"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("workspaceFolderPaths() == %v, want %v", got, want)
+	}
+}
+
+func TestWeightEmbeddings(t *testing.T) {
+	results := []embeddings.EmbeddingsResult{
+		{RepoName: "app", FileName: "a1"},
+		{RepoName: "app", FileName: "a2"},
+		{RepoName: "lib", FileName: "l1"},
+		{RepoName: "app", FileName: "a3"},
+		{RepoName: "lib", FileName: "l2"},
+	}
+
+	var got []string
+	for _, result := range weightEmbeddings(results, map[string]float64{"app": 1, "lib": 3}) {
+		got = append(got, result.FileName)
+	}
+	if want := []string{"l1", "l2", "a1", "a2", "a3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("weightEmbeddings() == %v, want %v", got, want)
+	}
+
+	got = nil
+	for _, result := range weightEmbeddings(results, map[string]float64{}) {
+		got = append(got, result.FileName)
+	}
+	if want := []string{"a1", "l1", "a2", "l2", "a3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("weightEmbeddings() == %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,83 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/pjlast/llmsp/claude"
+	"github.com/pjlast/llmsp/internal/promptbuilder"
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/go-lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// retryTemperatureStep is how much the temperature is raised to regenerate
+// an answer, so that it differs from the previous one.
+const retryTemperatureStep = 0.3
+
+// errNothingToRetry is returned when the interaction memory doesn't end with
+// an answer.
+var errNothingToRetry = errors.New("there is no answer to regenerate")
+
+// retryTemperature returns the temperature to regenerate an answer generated
+// at temperature t, at most 1.
+func retryTemperature(t float32) float32 {
+	t += retryTemperatureStep
+	if t > 1 {
+		return 1
+	}
+	return t
+}
+
+// retryAnswer replaces the last answer of the interaction memory with a new
+// answer to the same message, generated with a higher temperature and
+// streamed as $/progress notifications on progressToken. If filename isn't
+// empty, the prompt includes the context of the document. The previous
+// answer is kept, and returned, if no new answer is generated. The memory is
+// left alone while the answer is generated, and the answer is only swapped
+// in if the exchange is still the last one.
+func (l *SourcegraphLLM) retryAnswer(ctx context.Context, conn *jsonrpc2.Conn, progressToken string, filename lsp.DocumentURI) (*types.ChatResult, error) {
+	memory := l.memorySnapshot()
+	n := len(memory)
+	if n < 2 || memory[n-1].Speaker != claude.Assistant || memory[n-2].Speaker != claude.Human {
+		return nil, errNothingToRetry
+	}
+	previous := memory[n-2:]
+
+	input := []claude.Message{
+		{Speaker: claude.Human, Text: previous[0].Text},
+		{Speaker: claude.Assistant, Text: ""},
+	}
+	var prompt []claude.Message
+	if filename != "" {
+		prompt = l.AddContext(ctx, chatModel, input, string(filename), l.Documents.Text(filename))
+	} else {
+		builder := promptbuilder.New(promptbuilder.NewBudget(l.maxPromptTokens(chatModel)))
+		builder.Add(promptbuilder.Section{Name: "preamble", Messages: l.getPreamble(), Priority: 3, Trim: promptbuilder.KeepFirst})
+		for _, section := range historySections(memory[:n-2]) {
+			builder.Add(section)
+		}
+		builder.Add(promptbuilder.Section{Name: "input", Messages: input, Priority: 4})
+		prompt = builder.Build()
+	}
+	params := l.completionParameters(chatModel, prompt)
+	params.Temperature = retryTemperature(params.Temperature)
+
+	answer, err := l.streamChatParameters(ctx, conn, progressToken, params)
+	if err != nil {
+		return nil, err
+	}
+	answer = strings.TrimSpace(answer)
+	// Nothing may be generated before the retry is aborted
+	if answer == "" {
+		return &types.ChatResult{Message: previous[1].Text, ContextFiles: []types.ContextFile{}, Aborted: aborted(ctx)}, nil
+	}
+
+	l.Mu.Lock()
+	if n := len(l.InteractionMemory); n >= 2 && l.InteractionMemory[n-2] == previous[0] && l.InteractionMemory[n-1] == previous[1] {
+		l.InteractionMemory[n-1] = claude.Message{Speaker: claude.Assistant, Text: answer, Pinned: previous[1].Pinned}
+	}
+	l.Mu.Unlock()
+	return &types.ChatResult{Message: answer, ContextFiles: contextFiles(prompt), Aborted: aborted(ctx)}, nil
+}
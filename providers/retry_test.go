@@ -0,0 +1,126 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/pjlast/llmsp/claude"
+	"github.com/pjlast/llmsp/types"
+)
+
+func TestRetryTemperature(t *testing.T) {
+	tests := []struct{ t, want float32 }{{0.2, 0.5}, {0, 0.3}, {0.8, 1}, {1, 1}}
+	for _, test := range tests {
+		if got := retryTemperature(test.t); math.Abs(float64(got-test.want)) > 1e-6 {
+			t.Errorf("retryTemperature(%v) == %v, want %v", test.t, got, test.want)
+		}
+	}
+}
+
+func TestRetryAnswer(t *testing.T) {
+	var temperature float64
+	var prompt []claude.Message
+	fail := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Variables struct {
+				Temperature float64
+				Messages    []claude.Message
+			}
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Error(err)
+		}
+		temperature, prompt = request.Variables.Temperature, request.Variables.Messages
+		if fail {
+			w.Write([]byte(`{"errors": [{"message": "rate limit exceeded"}]}`))
+			return
+		}
+		w.Write([]byte(`{"data": {"completions": "Use sort.Slice with a less function."}}`))
+	}))
+	defer server.Close()
+
+	l := &SourcegraphLLM{
+		ClaudeClient: claude.NewClient(server.URL, "", server.Client()),
+		features:     featuresOf("4.5.1"),
+	}
+	if _, err := l.retryAnswer(context.Background(), nil, "", ""); !errors.Is(err, errNothingToRetry) {
+		t.Errorf("retrying without an answer returned %v, want errNothingToRetry", err)
+	}
+
+	question := claude.Message{Speaker: claude.Human, Text: "How do I sort a slice of structs?"}
+	l.InteractionMemory = []claude.Message{question, {Speaker: claude.Assistant, Text: "Use sort.Sort, and then"}}
+	result, err := l.retryAnswer(context.Background(), nil, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Message != "Use sort.Slice with a less function." || result.Aborted {
+		t.Errorf("retryAnswer() == %+v, want the new answer", result)
+	}
+	if math.Abs(temperature-0.5) > 1e-6 {
+		t.Errorf("temperature == %v, want 0.5, above the default of 0.2", temperature)
+	}
+	// The previous answer isn't part of the prompt
+	if n := len(prompt); n < 2 || prompt[n-2].Text != question.Text || prompt[n-1].Text != "" {
+		t.Errorf("prompt == %+v, want it to end with the question", prompt)
+	}
+	want := []claude.Message{question, {Speaker: claude.Assistant, Text: "Use sort.Slice with a less function."}}
+	if len(l.InteractionMemory) != 2 || l.InteractionMemory[1] != want[1] {
+		t.Errorf("interaction memory == %+v, want %+v", l.InteractionMemory, want)
+	}
+
+	// The configured temperature is raised, up to 1
+	chat := float32(0.9)
+	if err := l.SetSampling(map[string]types.SamplingSettings{"chat": {Temperature: &chat}}); err != nil {
+		t.Fatal(err)
+	}
+	fail = true
+	if _, err := l.retryAnswer(context.Background(), nil, "", ""); err == nil {
+		t.Error("a failed retry succeeded")
+	}
+	if temperature != 1 {
+		t.Errorf("temperature == %v, want 1", temperature)
+	}
+	if len(l.InteractionMemory) != 2 || l.InteractionMemory[1] != want[1] {
+		t.Errorf("interaction memory after a failed retry == %+v, want the previous answer kept", l.InteractionMemory)
+	}
+}
+
+func TestRetryAnswerConcurrentMessage(t *testing.T) {
+	question := claude.Message{Speaker: claude.Human, Text: "How do I sort a slice of structs?"}
+	answer := claude.Message{Speaker: claude.Assistant, Text: "Use sort.Sort, and then"}
+	other := []claude.Message{{Speaker: claude.Human, Text: "And maps?"}, {Speaker: claude.Assistant, Text: "Sort their keys."}}
+	var l *SourcegraphLLM
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The memory isn't truncated while the answer is generated, and
+		// another message is answered in the meantime
+		l.Mu.Lock()
+		if len(l.InteractionMemory) != 2 {
+			t.Errorf("interaction memory during the retry == %+v, want it untouched", l.InteractionMemory)
+		}
+		l.InteractionMemory = append(l.InteractionMemory, other...)
+		l.Mu.Unlock()
+		w.Write([]byte(`{"data": {"completions": "Use sort.Slice with a less function."}}`))
+	}))
+	defer server.Close()
+
+	l = &SourcegraphLLM{
+		ClaudeClient:      claude.NewClient(server.URL, "", server.Client()),
+		features:          featuresOf("4.5.1"),
+		InteractionMemory: []claude.Message{question, answer},
+	}
+	if _, err := l.retryAnswer(context.Background(), nil, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	// The retried exchange is no longer the last one, so the memory is kept
+	want := append([]claude.Message{question, answer}, other...)
+	if !reflect.DeepEqual(l.InteractionMemory, want) {
+		t.Errorf("interaction memory == %+v, want %+v", l.InteractionMemory, want)
+	}
+}
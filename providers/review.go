@@ -0,0 +1,57 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/pjlast/llmsp/claude"
+)
+
+// maxDiffTokens is the maximum size of the diff sent to the LLM for review.
+const maxDiffTokens = 4000
+
+// getDiff returns the staged changes in the workspace, falling back to the
+// unstaged changes if nothing is staged.
+func (l *SourcegraphLLM) getDiff() (string, error) {
+	for _, args := range [][]string{{"diff", "--cached"}, {"diff"}} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = l.workspaceRoot()
+		out, err := cmd.Output()
+		if err != nil {
+			return "", err
+		}
+		if diff := strings.TrimSpace(string(out)); diff != "" {
+			return diff, nil
+		}
+	}
+
+	return "", fmt.Errorf("no changes to review")
+}
+
+// reviewDiff asks the LLM to review the current changes in the workspace.
+func (l *SourcegraphLLM) reviewDiff(ctx context.Context) (string, error) {
+	diff, err := l.getDiff()
+	if err != nil {
+		return "", err
+	}
+	diff, _ = truncateText(diff, maxDiffTokens)
+
+	messages := append(l.getPreamble(), claude.Message{
+		Speaker: claude.Human,
+		Text: fmt.Sprintf(`Review the following changes before they are committed. Point out bugs, risky changes and leftover debugging code. Be brief, and say so if the changes look good.
+`+"```diff"+`
+%s
+`+"```", diff),
+	}, claude.Message{
+		Speaker: claude.Assistant,
+		Text:    "",
+	})
+	review, err := l.ClaudeClient.GetCompletion(ctx, l.completionParameters(chatModel, messages), false)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(review), nil
+}
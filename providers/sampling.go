@@ -0,0 +1,84 @@
+package providers
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/pjlast/llmsp/claude"
+	"github.com/pjlast/llmsp/types"
+)
+
+// modelKinds maps the names of the kinds of requests in the settings to
+// their kind.
+var modelKinds = map[string]modelKind{
+	"chat":       chatModel,
+	"completion": completionModel,
+	"edit":       editModel,
+}
+
+// samplingSettings are the sampling parameters configured for each kind of
+// request.
+type samplingSettings struct {
+	mu     sync.Mutex
+	byKind map[modelKind]types.SamplingSettings
+}
+
+// get returns the parameters of the kind of request.
+func (s *samplingSettings) get(kind modelKind) types.SamplingSettings {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.byKind[kind]
+}
+
+// apply overrides the parameters configured for the kind of request, except
+// for the maximum length of responses, see SourcegraphLLM.maxTokens.
+func (s *samplingSettings) apply(kind modelKind, params *claude.CompletionParameters) {
+	sampling := s.get(kind)
+	if sampling.Temperature != nil {
+		params.Temperature = *sampling.Temperature
+	}
+	if sampling.TopK != nil {
+		params.TopK = *sampling.TopK
+	}
+	if sampling.TopP != nil {
+		params.TopP = *sampling.TopP
+	}
+}
+
+// validateSampling returns an error if the parameters are out of range.
+func validateSampling(sampling types.SamplingSettings) error {
+	if t := sampling.Temperature; t != nil && (*t < 0 || *t > 1) {
+		return fmt.Errorf("temperature %v is not between 0 and 1", *t)
+	}
+	if k := sampling.TopK; k != nil && (*k == 0 || *k < -1) {
+		return fmt.Errorf("topK %d is neither positive nor -1", *k)
+	}
+	if p := sampling.TopP; p != nil && (*p < -1 || *p > 1) {
+		return fmt.Errorf("topP %d is not between 0 and 1, nor -1", *p)
+	}
+	if n := sampling.MaxTokensToSample; n != nil && *n <= 0 {
+		return fmt.Errorf("maxTokensToSample %d is not positive", *n)
+	}
+	return nil
+}
+
+// SetSampling sets the sampling parameters of the kinds of requests. Invalid
+// settings are rejected, keeping the parameters in use.
+func (l *SourcegraphLLM) SetSampling(settings map[string]types.SamplingSettings) error {
+	byKind := make(map[modelKind]types.SamplingSettings)
+	for name, sampling := range settings {
+		kind, ok := modelKinds[name]
+		if !ok {
+			return fmt.Errorf("unknown kind of request %q, want chat, completion or edit", name)
+		}
+		if err := validateSampling(sampling); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		byKind[kind] = sampling
+	}
+
+	l.sampling.mu.Lock()
+	defer l.sampling.mu.Unlock()
+	l.sampling.byKind = byKind
+	return nil
+}
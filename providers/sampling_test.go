@@ -0,0 +1,57 @@
+package providers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pjlast/llmsp/types"
+)
+
+func TestSetSampling(t *testing.T) {
+	temperature, topK, maxTokens := float32(0.8), 40, 500
+	l := &SourcegraphLLM{}
+	err := l.SetSampling(map[string]types.SamplingSettings{
+		"chat": {Temperature: &temperature, TopK: &topK, MaxTokensToSample: &maxTokens},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params := l.completionParameters(chatModel, nil)
+	if params.Temperature != temperature || params.TopK != topK || params.TopP != -1 || params.MaxTokensToSample != maxTokens {
+		t.Errorf("chat parameters == %+v, want the sampling settings and the default topP", params)
+	}
+	if params := l.completionParameters(editModel, nil); params.Temperature != 0.2 || params.MaxTokensToSample != 2000 {
+		t.Errorf("edit parameters == %+v, want the defaults", params)
+	}
+}
+
+func TestSetSamplingInvalid(t *testing.T) {
+	temperature, topK, topP, maxTokens := float32(1.5), 0, 2, 0
+	tests := []struct {
+		settings map[string]types.SamplingSettings
+		want     string
+	}{
+		{map[string]types.SamplingSettings{"hover": {}}, `unknown kind of request "hover"`},
+		{map[string]types.SamplingSettings{"chat": {Temperature: &temperature}}, "chat: temperature 1.5"},
+		{map[string]types.SamplingSettings{"edit": {TopK: &topK}}, "edit: topK 0"},
+		{map[string]types.SamplingSettings{"edit": {TopP: &topP}}, "edit: topP 2"},
+		{map[string]types.SamplingSettings{"completion": {MaxTokensToSample: &maxTokens}}, "completion: maxTokensToSample 0"},
+	}
+
+	valid := float32(0.5)
+	l := &SourcegraphLLM{}
+	if err := l.SetSampling(map[string]types.SamplingSettings{"chat": {Temperature: &valid}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		err := l.SetSampling(test.settings)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("SetSampling(%v) returned %v, want an error containing %q", test.settings, err, test.want)
+		}
+	}
+	// The settings in use are kept
+	if got := l.completionParameters(chatModel, nil).Temperature; got != valid {
+		t.Errorf("chat temperature == %v after invalid settings, want %v", got, valid)
+	}
+}
@@ -0,0 +1,87 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/pjlast/llmsp/claude"
+)
+
+// shellSuggestion is a suggested shell command returned by cody.shell. The
+// command is only ever suggested; it is up to the user to run it.
+type shellSuggestion struct {
+	Command     string `json:"command"`
+	Explanation string `json:"explanation"`
+	OS          string `json:"os"`
+	Shell       string `json:"shell"`
+}
+
+// detectShell returns the name of the user's shell, based on the environment.
+func detectShell() string {
+	if shell := os.Getenv("SHELL"); shell != "" {
+		return filepath.Base(shell)
+	}
+	if runtime.GOOS == "windows" {
+		if os.Getenv("PSModulePath") != "" {
+			return "powershell"
+		}
+		return "cmd"
+	}
+	return "sh"
+}
+
+// parseShellSuggestion splits an LLM response into the suggested command,
+// which is expected in a code block, and the explanation that follows it.
+func parseShellSuggestion(text string) (string, string) {
+	start := strings.Index(text, "```")
+	if start == -1 {
+		return "", strings.TrimSpace(text)
+	}
+	end := strings.Index(text[start+3:], "```")
+	if end == -1 {
+		return extractCode(text), ""
+	}
+	end += start + 3
+
+	explanation := strings.TrimSpace(text[:start] + "\n" + text[end+3:])
+	return strings.TrimSpace(extractCode(text[start : end+3])), explanation
+}
+
+// suggestShellCommand turns a natural language request into a shell command
+// for the current OS and shell. The command is never executed.
+func (l *SourcegraphLLM) suggestShellCommand(ctx context.Context, request string) (*shellSuggestion, error) {
+	suggestion := &shellSuggestion{
+		OS:    runtime.GOOS,
+		Shell: detectShell(),
+	}
+
+	input := []claude.Message{
+		{
+			Speaker: claude.Human,
+			Text: fmt.Sprintf(`I am using the %s shell on %s. Suggest a single shell command that does the following:
+%s
+
+Reply with the command in a code block, followed by a short explanation of what it does. Mention it if the command is destructive.`, suggestion.Shell, suggestion.OS, request),
+		},
+		{
+			Speaker: claude.Assistant,
+			Text:    "```" + suggestion.Shell + "\n",
+		},
+	}
+	params := l.completionParameters(chatModel, append(l.getPreamble(), input...))
+	completion, err := l.ClaudeClient.GetCompletion(ctx, params, true)
+	if err != nil {
+		return nil, err
+	}
+
+	suggestion.Command, suggestion.Explanation = parseShellSuggestion(completion)
+	if suggestion.Command == "" {
+		return nil, fmt.Errorf("the model did not suggest a command")
+	}
+
+	return suggestion, nil
+}
@@ -0,0 +1,13 @@
+package providers
+
+import "testing"
+
+func TestParseShellSuggestion(t *testing.T) {
+	command, explanation := parseShellSuggestion("```bash\nfind . -name '*.go' | xargs wc -l\n```\n\nCounts the lines in all Go files.")
+	if want := "find . -name '*.go' | xargs wc -l"; command != want {
+		t.Errorf("command == %q, want %q", command, want)
+	}
+	if want := "Counts the lines in all Go files."; explanation != want {
+		t.Errorf("explanation == %q, want %q", explanation, want)
+	}
+}
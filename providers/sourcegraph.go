@@ -4,14 +4,28 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"os/exec"
+	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pjlast/llmsp/claude"
+	"github.com/pjlast/llmsp/internal/diagnostics"
+	"github.com/pjlast/llmsp/internal/documents"
+	"github.com/pjlast/llmsp/internal/i18n"
+	"github.com/pjlast/llmsp/internal/ignore"
+	"github.com/pjlast/llmsp/internal/index"
+	"github.com/pjlast/llmsp/internal/language"
+	"github.com/pjlast/llmsp/internal/logging"
+	"github.com/pjlast/llmsp/internal/metrics"
+	"github.com/pjlast/llmsp/internal/position"
+	"github.com/pjlast/llmsp/internal/promptbuilder"
+	"github.com/pjlast/llmsp/internal/prompts"
+	"github.com/pjlast/llmsp/internal/secrets"
+	"github.com/pjlast/llmsp/internal/tasks"
+	"github.com/pjlast/llmsp/internal/tokenizer"
 	"github.com/pjlast/llmsp/sourcegraph/embeddings"
 	"github.com/pjlast/llmsp/types"
 	"github.com/sourcegraph/go-lsp"
@@ -19,14 +33,14 @@ import (
 )
 
 const (
-	charsPerToken        = 4
-	maxPromptTokenLength = 7000
 	maxCurrentFileTokens = 1000
 )
 
 type SourcegraphLLM struct {
 	AnonymousUIDPath  string
-	FileMap           types.MemoryFileMap
+	WorkspaceRoot     string
+	WorkspaceFolders  []lsp.DocumentURI
+	Documents         *documents.Store
 	EventLogger       *eventLogger
 	EmbeddingsClient  *embeddings.Client
 	ClaudeClient      *claude.Client
@@ -34,141 +48,227 @@ type SourcegraphLLM struct {
 	AccessToken       string
 	RepoID            string
 	RepoName          string
+	Repositories      []Repository
+	EmbeddingsRepos   []Repository
 	InteractionMemory []claude.Message
+	Sessions          map[string]*ChatSession
+	ActiveSession     string
+	CompletionHistory []CompletionRecord
+	// historyReadOnly is set if the stored chat history must not be
+	// overwritten
+	historyReadOnly bool
+	// historyWrite serializes the writes of the chat history, so that an
+	// older history can't overwrite a newer one
+	historyWrite    sync.Mutex
+	Tools           bool
+	Timeouts        map[string]time.Duration
+	ChatModel       string
+	CompletionModel string
+	EditModel       string
+	// ChatMaxTokens, CompletionMaxTokens and EditMaxTokens override the
+	// default maximum lengths of responses when they are positive
+	ChatMaxTokens       int
+	CompletionMaxTokens int
+	EditMaxTokens       int
+	// sampling are the sampling parameters of the settings, see SetSampling
+	sampling   samplingSettings
+	GoEnhanced bool
+	// Messages translates user-facing messages into the client's locale
+	Messages i18n.Localizer
+	// Tasks runs the provider's background goroutines
+	Tasks *tasks.Group
+	// Logger logs the provider's activity, it may be nil
+	Logger *logging.Logger
+	// Metrics counts the LLM requests of the provider and its cache lookups,
+	// it may be nil
+	Metrics *metrics.Registry
+	// Diagnostics tracks the diagnostics published for suggestions and
+	// annotations, so that they can be cleared
+	Diagnostics *diagnostics.Manager
+	// SharePromptHash includes a hash of the prompt in feedback events
+	SharePromptHash bool
+	// ResourceOperations are the file operations, "create", "rename" and
+	// "delete", the client supports in workspace edits. Edits aren't checked
+	// if it is nil.
+	ResourceOperations []string
+	// ContextUpdated, if set, is called with the context of every prompt
+	// before it is sent
+	ContextUpdated func(types.ContextReport)
+	// PreviewEdits proposes edits to the client instead of applying them
+	PreviewEdits bool
+	// StreamDeltas streams responses as deltas instead of resending the
+	// whole response
+	StreamDeltas bool
+	// ContextTokens is the token budget for open files in prompts, the
+	// default is used if it is 0
+	ContextTokens int
+	// LinesAbove and LinesBelow are the number of lines around the cursor
+	// included in the context of completions, the defaults are used if they
+	// are 0
+	LinesAbove int
+	LinesBelow int
+	// ContextIgnore are the patterns of files kept out of prompts, in
+	// addition to those of the .codyignore files
+	ContextIgnore []string
+	// Prompts holds the templates of prompts, the defaults are used if it is
+	// nil
+	Prompts *prompts.Registry
+	// preamble are the instructions of the settings added to the preamble,
+	// see SetPrompts
+	preamble string
+	// proposals are the edits proposed to the client
+	proposals proposalStore
+	// interactions are the recent interactions feedback can be given on
+	interactions interactionLog
+	// completionStats tracks which completions are accepted
+	completionStats completionStats
+	goContext       goContext
+	// searchCache caches the definitions found by searching Sourcegraph
+	searchCache searchCache
+	// lastContext is the context of the most recent prompt
+	lastContext atomic.Pointer[types.ContextReport]
+	// generations are the answers being generated, which cody.chat/abort
+	// stops
+	generations generations
+	// ignoreRules match the files kept out of prompts
+	ignoreRules atomic.Pointer[ignore.Rules]
+	// features are the features supported by the Sourcegraph instance
+	features instanceFeatures
+	// embeddingsUnavailable reports once that embeddings can't be searched
+	embeddingsUnavailable sync.Once
+	// localIndex is searched for context when there are no embeddings
+	localIndex *index.Index
+	// localIndexDropped is set if the local index was dropped while idle
+	localIndexDropped bool
 	Mu                sync.Mutex
-	Context           *struct {
-		context.Context
-		CancelFunc context.CancelFunc
-	}
-}
-
-// truncateTextStarts trims the beginning of the text, leaving only the last `maxTokens`.
-func truncateTextStart(text string, maxTokens int) (string, int) {
-	maxLength := maxTokens * charsPerToken
-	if len(text) > maxLength {
-		text = text[len(text)-maxLength:]
-	}
-
-	return text, getTokenLength(text)
 }
 
 // truncateText trims the end of the text, leaving only the first `maxTokens`.
 func truncateText(text string, maxTokens int) (string, int) {
-	maxLength := maxTokens * charsPerToken
-	if len(text) > maxLength {
-		text = text[:maxLength]
-	}
-
-	return text, getTokenLength(text)
+	return tokenizer.Truncate(text, maxTokens)
 }
 
 func getTokenLength(text string) int {
-	return (len(text) + charsPerToken - 1) / charsPerToken
+	return tokenizer.Count(text)
 }
 
-func getGitURL() string {
-	out, err := exec.Command("git", "remote", "get-url", "origin").Output()
-	if err != nil {
-		return ""
-	}
-	return strings.TrimSpace(string(out))
+// commentPrefix returns the string starting a comment in the language.
+func commentPrefix(lang string) string {
+	return language.CommentStyle(lang).Prefix()
 }
 
-func commentPrefix(language string) string {
-	switch language {
-	case "Go":
-		return "//"
-	case "Python":
-		return "#"
-	case "JavaScript":
-		return "//"
-	case "TypeScript":
-		return "//"
-	case "TypeScript React":
-		return "//"
-	case "Java":
-		return "//"
-	case "C":
-		return "//"
-	case "C++":
-		return "//"
-	case "Lua":
-		return "--"
-	case "Ruby":
-		return "#"
-	case "PHP":
-		return "#"
-	case "C#":
-		return "//"
-	default:
-		return ""
+// determineLanguage returns the language of a file from its name. Unknown
+// files are named after their extension.
+func determineLanguage(filename string) string {
+	if lang := language.ByFilename(filename); lang != "" {
+		return lang
 	}
+	return strings.TrimPrefix(filepath.Ext(filename), ".")
 }
 
-func determineLanguage(filename string) string {
-	ext := filepath.Ext(filename)
-	switch ext {
-	case ".go":
-		return "Go"
-	case ".py":
-		return "Python"
-	case ".js":
-		return "JavaScript"
-	case ".ts":
-		return "TypeScript"
-	case ".tsx":
-		return "TypeScript React"
-	case ".java":
-		return "Java"
-	case ".c":
-		return "C"
-	case ".cpp":
-		return "C++"
-	case ".lua":
-		return "Lua"
-	case ".rb":
-		return "Ruby"
-	case ".php":
-		return "PHP"
-	case ".cs":
-		return "C#"
-	default:
-		return strings.TrimPrefix(ext, ".")
+// documentLanguage is like determineLanguage, but also detects the language
+// of open documents from their shebang line.
+func (l *SourcegraphLLM) documentLanguage(uri lsp.DocumentURI) string {
+	if lang := language.Detect(string(uri), l.Documents.Text(uri)); lang != "" {
+		return lang
 	}
+	return determineLanguage(string(uri))
 }
 
-func (l *SourcegraphLLM) Initialize(settings types.LLMSPSettings) error {
+func (l *SourcegraphLLM) Initialize(ctx context.Context, settings types.LLMSPSettings) error {
 	if settings.Sourcegraph == nil {
 		return fmt.Errorf("Sourcegraph settings not present")
 	}
 
-	serverClient := embeddings.NewClient(l.URL, l.AccessToken, nil)
-	dotcomClient := embeddings.NewClient(sourcegraphDotComURL, "", nil)
-
 	if settings.Sourcegraph.URL == "" {
 		l.URL = "https://sourcegraph.com"
 	} else {
 		l.URL = settings.Sourcegraph.URL
 	}
-	l.AccessToken = settings.Sourcegraph.AccessToken
+	token, err := secrets.Lookup(ctx, tokenSource(l.URL, settings.Sourcegraph))
+	if err != nil {
+		return err
+	}
+	// Without a token in the settings, the one passed on the command line is
+	// kept
+	if token != "" {
+		l.AccessToken = token
+	}
+
+	l.Timeouts = make(map[string]time.Duration)
+	for feature, timeout := range settings.Sourcegraph.Timeouts {
+		l.Timeouts[feature] = time.Duration(timeout) * time.Millisecond
+	}
+
+	httpClient, err := newHTTPClient(settings.Sourcegraph)
+	if err != nil {
+		return err
+	}
+	serverClient := embeddings.NewClient(l.URL, l.AccessToken, httpClient)
+	dotcomClient := embeddings.NewClient(sourcegraphDotComURL, "", httpClient)
+	serverClient.Timeout = l.timeout("request")
+	dotcomClient.Timeout = l.timeout("request")
 	l.EmbeddingsClient = serverClient
-	l.ClaudeClient = claude.NewClient(l.URL, l.AccessToken, nil)
-	l.InteractionMemory = make([]claude.Message, 0)
+	l.ClaudeClient = claude.NewClient(l.URL, l.AccessToken, httpClient)
+	l.ClaudeClient.Timeout = l.timeout("request")
+	serverClient.Trace = l.traceGraphQL
+	dotcomClient.Trace = l.traceGraphQL
+	l.ClaudeClient.GraphQL.Trace = l.traceGraphQL
+	l.ClaudeClient.OnPrompt = l.preparePrompt
+	l.ClaudeClient.Trace = l.recordLLMRequest
+	if err := l.checkConnection(ctx); err != nil {
+		return err
+	}
+	if err := l.loadHistory(); err != nil {
+		l.NewSession("")
+		l.Mu.Lock()
+		l.InteractionMemory = make([]claude.Message, 0)
+		l.Mu.Unlock()
+	}
 	l.AnonymousUIDPath = settings.Sourcegraph.AnonymousUIDFile
-	l.EventLogger = NewEventLogger(serverClient, dotcomClient, l.URL, l.AnonymousUIDPath)
+	l.Tools = settings.Sourcegraph.Tools
+	l.SharePromptHash = settings.Sourcegraph.SharePromptHash
+	l.PreviewEdits = settings.Sourcegraph.PreviewEdits
+	l.StreamDeltas = settings.Sourcegraph.StreamDeltas
+	l.ContextTokens = settings.Sourcegraph.ContextTokens
+	l.LinesAbove = settings.Sourcegraph.ContextLinesAbove
+	l.LinesBelow = settings.Sourcegraph.ContextLinesBelow
+	l.ContextIgnore = settings.Sourcegraph.ContextIgnore
+	l.GoEnhanced = settings.Go != nil && settings.Go.Enhanced
+	l.ChatModel = settings.Sourcegraph.ChatModel
+	l.CompletionModel = settings.Sourcegraph.CompletionModel
+	l.EditModel = settings.Sourcegraph.EditModel
+	l.ChatMaxTokens = settings.Sourcegraph.ChatMaxTokens
+	l.CompletionMaxTokens = settings.Sourcegraph.CompletionMaxTokens
+	l.EditMaxTokens = settings.Sourcegraph.EditMaxTokens
+	l.EventLogger = NewEventLogger(serverClient, dotcomClient, l.URL, l.AnonymousUIDPath, parseTelemetry(settings.Sourcegraph.Telemetry), l.Tasks)
+
+	l.detectFeatures(ctx)
+	l.detectRepositories(ctx)
+	l.resolveEmbeddingsRepos(ctx, settings.Sourcegraph.RepoEmbeddings)
+	l.loadIgnoreRules()
+	l.buildLocalIndex()
 
-	gitURL := getGitURL()
-	if gitURL != "" {
-		repoName := getRepoName(gitURL)
-		repoID, err := l.EmbeddingsClient.GetRepoID(repoName)
-		// If we had no problem fetching the repo ID, we set the Repo ID and Name
-		if err == nil {
-			l.RepoID = repoID
-			l.RepoName = repoName
+	return nil
+}
+
+// tokenSource returns where the access token of the settings is looked up.
+func tokenSource(url string, settings *types.SourcegraphSettings) secrets.Source {
+	source := secrets.Source{
+		Token:   settings.AccessToken,
+		Command: settings.TokenCommand,
+	}
+	if settings.Keychain != nil {
+		source.KeychainService = settings.Keychain.Service
+		if source.KeychainService == "" {
+			source.KeychainService = secrets.DefaultKeychainService
+		}
+		source.KeychainAccount = settings.Keychain.Account
+		if source.KeychainAccount == "" {
+			source.KeychainAccount = url
 		}
 	}
-
-	return nil
+	return source
 }
 
 func getRepoName(gitURL string) string {
@@ -201,144 +301,197 @@ func getRepoName(gitURL string) string {
 }
 
 func (l *SourcegraphLLM) GetCompletions(ctx context.Context, params types.CompletionParams) ([]types.CompletionItem, error) {
-	currentLine := strings.Split(l.FileMap[params.TextDocument.URI], "\n")[params.Position.Line]
-	indentation := currentLine[:len(currentLine)-len(strings.TrimLeft(currentLine, " \t"))]
-	l.Mu.Lock()
-	if l.Context != nil {
-		l.Context.CancelFunc()
+	// Completing a file would send its contents
+	if l.ignored(string(params.TextDocument.URI)) {
+		return nil, nil
 	}
-	ctx, cancel := context.WithCancel(ctx)
-
-	l.Context = &struct {
-		context.Context
-		CancelFunc context.CancelFunc
-	}{ctx, cancel}
-	l.Mu.Unlock()
-	time.Sleep(100 * time.Millisecond) // To not spam the server when rapidly typing
-	if ctx.Err() != nil {
-		return nil, fmt.Errorf("context canceled")
+	ctx, cancel := l.withTimeout(ctx, "completion")
+	defer cancel()
+
+	ctx, interactionID := l.interactions.Start(ctx)
+	doc, _ := l.Documents.Get(params.TextDocument.URI)
+	multiline := completesBlock(doc.Line(params.Position.Line), params.Position)
+	completion, err := l.completeCode(ctx, params.TextDocument.URI, params.Position.Line, multiline)
+	if err != nil {
+		l.interactions.Discard(interactionID)
+		return nil, err
 	}
+	l.interactions.Record(interactionID, "completion")
 
-	// startLine := params.Position.Line - 20
-	// if params.Position.Line < 20 {
-	// 	startLine = 0
-	// }
-	snippet := getFileSnippet(l.FileMap[params.TextDocument.URI], params.Position.Line, params.Position.Line)
+	textEdit, label := completionEdit(doc.Line(params.Position.Line), params.Position, completion)
+	l.recordCompletion(params.TextDocument.URI, params.Position.Line, textEdit.NewText)
+	return []types.CompletionItem{l.completionItem(params.TextDocument.URI, params.Position.Line, label, &textEdit)}, nil
+}
 
-	var embeddings *embeddings.EmbeddingsSearchResult = nil
-	var err error
-	if l.RepoID != "" {
-		embeddings, _ = l.EmbeddingsClient.GetEmbeddings(l.RepoID, snippet, 8, 0)
+// completeCode asks the LLM to continue the code on the given line of the
+// document, over several lines if multiline is set. The completion may
+// repeat the code typed on the line, see completionEdit.
+func (l *SourcegraphLLM) completeCode(ctx context.Context, uri lsp.DocumentURI, line int, multiline bool) (string, error) {
+	doc, _ := l.Documents.Get(uri)
+
+	above, below := l.linesAround()
+	window := windowAround(doc, line, above, below)
+	snippet := window.Before
+	if window.Header != "" {
+		snippet = window.Header + "\n...\n" + snippet
 	}
-	claudeParams := claude.DefaultCompletionParameters(l.getMessages(string(params.TextDocument.URI), embeddings))
-	truncText, _ := truncateText(l.FileMap[params.TextDocument.URI], maxCurrentFileTokens)
+
+	embeddings, _ := l.searchEmbeddings(ctx, string(uri), window.Before, 8, 0)
+	claudeParams := l.completionParameters(completionModel, l.getMessages(string(uri), window.Before, embeddings))
+	truncText, _ := truncateText(doc.Text, maxCurrentFileTokens)
 	claudeParams.Messages = append(claudeParams.Messages,
 		claude.Message{
 			Speaker: claude.Human,
 			Text: fmt.Sprintf(`Here are the contents of the file you are working in:
 %s`, truncText),
+			Source: fileSource("file", string(uri), truncText, 0),
 		},
 		claude.Message{
 			Speaker: claude.Assistant,
 			Text:    "Ok.",
-		},
+		})
+	claudeParams.Messages = append(claudeParams.Messages, l.symbolMessages(uri, line-above, line+below)...)
+	if window.After != "" {
+		claudeParams.Messages = append(claudeParams.Messages,
+			claude.Message{
+				Speaker: claude.Human,
+				Text: fmt.Sprintf(`Here is the code following the code to complete:
+%s`, window.After),
+			},
+			claude.Message{
+				Speaker: claude.Assistant,
+				Text:    "Ok.",
+			})
+	}
+	claudeParams.Messages = append(claudeParams.Messages,
 		claude.Message{
 			Speaker: claude.Human,
-			Text: fmt.Sprintf(`Suggest a %s code snippet to complete the following code. Continue from where I left off:
-%s`, determineLanguage(string(params.TextDocument.URI)), snippet),
+			Text: fmt.Sprintf(`%s
+%s`, completionInstruction(string(uri)), snippet),
 		},
 		claude.Message{
 			Speaker: claude.Assistant,
-			Text:    "```go\n",
+			Text:    fmt.Sprintf("```%s\n", strings.ToLower(l.documentLanguage(uri))),
 		})
+	// The code ends with the code block, or with the line unless the
+	// completion spans several lines
+	claudeParams.StopSequences = []string{"\n```"}
+	if !multiline {
+		claudeParams.StopSequences = append(claudeParams.StopSequences, "\n")
+		if claudeParams.MaxTokensToSample > singleLineMaxTokens {
+			claudeParams.MaxTokensToSample = singleLineMaxTokens
+		}
+	}
 	completion, err := l.ClaudeClient.GetCompletion(ctx, claudeParams, false)
 	if err != nil {
-		return nil, err
-	}
-	completion = completion[:strings.Index(completion, "\n```")]
-	completionLines := strings.Split(completion, "\n")
-	for i, line := range completionLines {
-		completionLines[i] = indentation + line
-	}
-	textCompletion := strings.Join(completionLines, "\n")
-
-	textEdit := &lsp.TextEdit{
-		Range: lsp.Range{
-			Start: lsp.Position{
-				Line: params.Position.Line,
-			},
-			End: params.Position,
-		},
-		NewText: textCompletion,
+		return "", err
 	}
-	return []types.CompletionItem{
-		{
-			Label:    completion,
-			Kind:     lsp.CIKSnippet,
-			TextEdit: textEdit,
-			Detail:   completion,
-		},
-	}, nil
+	// The completion is inserted before the code following the cursor, which
+	// it often repeats
+	return trimCompletion(completion, strings.Split(window.After, "\n")), nil
 }
 
-func (l *SourcegraphLLM) GetCodeActions(doc lsp.DocumentURI, selection lsp.Range) []lsp.Command {
-	cp := commentPrefix(determineLanguage(string(doc)))
-	commands := []lsp.Command{
-		{
-			Title:     "Provide suggestions",
-			Command:   "suggest",
-			Arguments: []interface{}{doc, selection.Start.Line, selection.End.Line},
-		},
-		{
-			Title:     "Generate docstring",
-			Command:   "docstring",
-			Arguments: []interface{}{doc, selection.Start.Line, selection.End.Line},
-		},
-		{
-			Title:     "Cody: Remember this",
-			Command:   "cody.remember",
-			Arguments: []interface{}{doc, selection.Start.Line, selection.End.Line},
-		},
-	}
-	if len(l.InteractionMemory) > 0 {
-		commands = append(commands, lsp.Command{
-			Title:   "Cody: Forget",
-			Command: "cody.forget",
-		})
+func (l *SourcegraphLLM) ExecuteCommand(ctx context.Context, params types.ExecuteCommandParams, conn *jsonrpc2.Conn) (*json.RawMessage, error) {
+	arguments, err := validateArguments(params.Command, params.Arguments)
+	if err != nil {
+		return nil, err
 	}
-	if strings.Contains(strings.Join(strings.Split(l.FileMap[doc], "\n")[selection.Start.Line:selection.End.Line+1], "\n"), fmt.Sprintf("%s TODO", cp)) {
-		commands = append(commands, lsp.Command{
-			Title:     "Implement TODOs",
-			Command:   "todos",
-			Arguments: []interface{}{doc, selection.Start.Line, selection.End.Line},
-		})
+	params.Arguments = arguments
+
+	ctx, interactionID := l.interactions.Start(ctx)
+	res, err := l.executeCommand(l.withSnapshot(ctx), params, conn)
+	if err != nil {
+		l.interactions.Discard(interactionID)
+		return nil, err
 	}
-	if strings.Contains(strings.Join(strings.Split(l.FileMap[doc], "\n")[selection.Start.Line:selection.End.Line+1], "\n"), fmt.Sprintf("%s ASK", cp)) {
-		commands = append(commands, lsp.Command{
-			Title:     "Answer question",
-			Command:   "answer",
-			Arguments: []interface{}{doc, selection.Start.Line, selection.End.Line},
-		})
+	if l.interactions.Record(interactionID, params.Command) {
+		return withInteractionID(res, interactionID), nil
 	}
-	return commands
+	return res, nil
 }
 
-func (l *SourcegraphLLM) ExecuteCommand(ctx context.Context, params types.ExecuteCommandParams, conn *jsonrpc2.Conn) (*json.RawMessage, error) {
+func (l *SourcegraphLLM) executeCommand(ctx context.Context, params types.ExecuteCommandParams, conn *jsonrpc2.Conn) (*json.RawMessage, error) {
+	// Persisting the history is best effort, a failure shouldn't fail the command.
+	defer func() { _ = l.saveHistory() }()
+	ctx, cancel := l.withTimeout(ctx, params.Command)
+	defer cancel()
+
 	switch params.Command {
 	case "suggest":
 		filename := lsp.DocumentURI(params.Arguments[0].(string))
 		startLine := params.Arguments[1].(float64)
 		endLine := params.Arguments[2].(float64)
-		snippet := getFileSnippet(l.FileMap[filename], int(startLine), int(endLine))
+		snippet, err := l.documentLines(filename, int(startLine), int(endLine))
+		if err != nil {
+			return nil, err
+		}
 		snippet = numberLines(snippet, int(startLine))
 		return nil, l.sendDiagnostics(ctx, conn, string(filename), snippet)
 
-	case "docstring":
+	case "docstring", "todos", "answer", "cody.fix", "cody.test":
+		if params.Command == "cody.fix" || params.Command == "cody.test" {
+			l.EventLogger.Log(fmt.Sprintf("CodyNeovimExtension:codeAction:%s:executed", params.Command))
+		}
+
+		edit, err := l.commandEdit(ctx, params.Command, params.Arguments)
+		if err != nil {
+			return nil, err
+		}
+
+		return l.applyEdit(ctx, conn, params.Command, *edit)
+
+	case "cody.completeLine", "cody.completeFunction":
+		l.EventLogger.Log(fmt.Sprintf("CodyNeovimExtension:codeAction:%s:executed", params.Command))
+		filename := lsp.DocumentURI(params.Arguments[0].(string))
+		line := int(params.Arguments[1].(float64))
+
+		var edit *types.WorkspaceEdit
+		var err error
+		if params.Command == "cody.completeLine" {
+			var doc documents.Document
+			doc, err = l.Documents.Lookup(filename)
+			if err != nil {
+				return nil, err
+			}
+			if line < 0 || line >= doc.LineCount() {
+				return nil, fmt.Errorf("%w: line %d of %s, which has %d lines", documents.ErrLineOutOfRange, line+1, filename, doc.LineCount())
+			}
+			// Complete from the end of the line unless a character is given
+			character := position.Len(doc.Line(line))
+			if len(params.Arguments) >= 3 {
+				character = int(params.Arguments[2].(float64))
+			}
+			edit, err = l.completeLine(ctx, filename, lsp.Position{Line: line, Character: character})
+		} else {
+			edit, err = l.completeFunction(ctx, filename, line)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return l.applyEdit(ctx, conn, params.Command, *edit)
+
+	case "cody":
 		filename := lsp.DocumentURI(params.Arguments[0].(string))
 		startLine := int(params.Arguments[1].(float64))
 		endLine := int(params.Arguments[2].(float64))
-		funcSnippet := getFileSnippet(l.FileMap[filename], int(startLine), int(endLine))
-		docstring := l.getDocString(string(filename), funcSnippet)
+		instruction := params.Arguments[3].(string)
+		overwrite := params.Arguments[4].(bool)
+		codeOnly := params.Arguments[5].(bool)
+
+		funcSnippet, err := l.documentLines(filename, startLine, endLine)
+		if err != nil {
+			return nil, err
+		}
+		contents := l.snapshotText(ctx, filename)
+		implemented, err := l.codyDo(ctx, string(filename), contents, funcSnippet, instruction, codeOnly)
+		if err != nil {
+			return nil, err
+		}
+
+		if !overwrite {
+			implemented += funcSnippet
+		}
 
 		edits := []lsp.TextEdit{
 			{
@@ -347,19 +500,16 @@ func (l *SourcegraphLLM) ExecuteCommand(ctx context.Context, params types.Execut
 						Line:      startLine,
 						Character: 0,
 					},
-					End: lsp.Position{
-						Line:      endLine,
-						Character: len(strings.Split(l.FileMap[filename], "\n")[endLine]),
-					},
+					End: position.LineEnd(contents, endLine),
 				},
-				NewText: docstring + "\n" + funcSnippet,
+				NewText: implemented,
 			},
 		}
 
 		editParams := types.ApplyWorkspaceEditParams{
 			Edit: types.WorkspaceEdit{
-				DocumentChanges: []types.TextDocumentEdit{
-					{
+				DocumentChanges: []any{
+					types.TextDocumentEdit{
 						TextDocument: lsp.VersionedTextDocumentIdentifier{
 							TextDocumentIdentifier: lsp.TextDocumentIdentifier{
 								URI: filename,
@@ -372,37 +522,29 @@ func (l *SourcegraphLLM) ExecuteCommand(ctx context.Context, params types.Execut
 			},
 		}
 
-		var res json.RawMessage
-		go func() { conn.Call(ctx, "workspace/applyEdit", editParams, &res) }()
-		return nil, nil
+		return l.applyEdit(ctx, conn, params.Command, editParams.Edit)
 
-	case "todos":
+	case "cody.edit":
+		l.EventLogger.Log("CodyNeovimExtension:codeAction:cody.edit:executed")
 		filename := lsp.DocumentURI(params.Arguments[0].(string))
-		startLine := int(params.Arguments[1].(float64))
-		endLine := int(params.Arguments[2].(float64))
-		funcSnippet := getFileSnippet(l.FileMap[filename], int(startLine), int(endLine))
-		implemented := l.implementTODOs(string(filename), l.FileMap[filename], funcSnippet)
+		rng, err := rangeArgument(params.Arguments[1])
+		if err != nil {
+			return nil, err
+		}
+		instruction := params.Arguments[2].(string)
 
-		edits := []lsp.TextEdit{
-			{
-				Range: lsp.Range{
-					Start: lsp.Position{
-						Line:      startLine,
-						Character: 0,
-					},
-					End: lsp.Position{
-						Line:      endLine,
-						Character: len(strings.Split(l.FileMap[filename], "\n")[endLine]),
-					},
-				},
-				NewText: implemented,
-			},
+		edits, err := l.editSelection(ctx, filename, rng, instruction)
+		if err != nil {
+			return nil, err
+		}
+		if len(edits) == 0 {
+			return nil, nil
 		}
 
 		editParams := types.ApplyWorkspaceEditParams{
 			Edit: types.WorkspaceEdit{
-				DocumentChanges: []types.TextDocumentEdit{
-					{
+				DocumentChanges: []any{
+					types.TextDocumentEdit{
 						TextDocument: lsp.VersionedTextDocumentIdentifier{
 							TextDocumentIdentifier: lsp.TextDocumentIdentifier{
 								URI: filename,
@@ -415,22 +557,38 @@ func (l *SourcegraphLLM) ExecuteCommand(ctx context.Context, params types.Execut
 			},
 		}
 
-		var res json.RawMessage
-		conn.Call(ctx, "workspace/applyEdit", editParams, &res)
+		return l.applyEdit(ctx, conn, params.Command, editParams.Edit)
 
-	case "cody":
+	case "cody.edit/accept":
+		return nil, l.acceptEdit(ctx, conn, params.Arguments[0].(string))
+
+	case "cody.edit/reject":
+		return nil, l.rejectEdit(params.Arguments[0].(string))
+
+	case "cody.plan":
 		filename := lsp.DocumentURI(params.Arguments[0].(string))
 		startLine := int(params.Arguments[1].(float64))
 		endLine := int(params.Arguments[2].(float64))
 		instruction := params.Arguments[3].(string)
-		overwrite := params.Arguments[4].(bool)
-		codeOnly := params.Arguments[5].(bool)
-
-		funcSnippet := getFileSnippet(l.FileMap[filename], int(startLine), int(endLine))
-		implemented := l.codyDo(string(filename), l.FileMap[filename], funcSnippet, instruction, codeOnly)
+		var verify bool
+		if len(params.Arguments) >= 5 {
+			verify = params.Arguments[4].(bool)
+		}
+		l.EventLogger.Log("CodyNeovimExtension:codeAction:cody.plan:executed")
 
-		if !overwrite {
-			implemented += funcSnippet
+		funcSnippet, err := l.documentLines(filename, startLine, endLine)
+		if err != nil {
+			return nil, err
+		}
+		contents := l.snapshotText(ctx, filename)
+		result, err := l.plan(ctx, conn, params.WorkDoneToken, string(filename), contents, funcSnippet, instruction, verify)
+		if err != nil {
+			return nil, err
+		}
+		// Code that failed verification is returned with its errors instead
+		// of being applied
+		if verify && !result.Verified {
+			return marshalResult(result)
 		}
 
 		edits := []lsp.TextEdit{
@@ -440,19 +598,16 @@ func (l *SourcegraphLLM) ExecuteCommand(ctx context.Context, params types.Execut
 						Line:      startLine,
 						Character: 0,
 					},
-					End: lsp.Position{
-						Line:      endLine,
-						Character: len(strings.Split(l.FileMap[filename], "\n")[endLine]),
-					},
+					End: position.LineEnd(contents, endLine),
 				},
-				NewText: implemented,
+				NewText: result.Code,
 			},
 		}
 
 		editParams := types.ApplyWorkspaceEditParams{
 			Edit: types.WorkspaceEdit{
-				DocumentChanges: []types.TextDocumentEdit{
-					{
+				DocumentChanges: []any{
+					types.TextDocumentEdit{
 						TextDocument: lsp.VersionedTextDocumentIdentifier{
 							TextDocumentIdentifier: lsp.TextDocumentIdentifier{
 								URI: filename,
@@ -465,8 +620,11 @@ func (l *SourcegraphLLM) ExecuteCommand(ctx context.Context, params types.Execut
 			},
 		}
 
-		var res json.RawMessage
-		conn.Call(ctx, "workspace/applyEdit", editParams, &res)
+		if _, err := l.applyEdit(ctx, conn, params.Command, editParams.Edit); err != nil {
+			return nil, err
+		}
+
+		return marshalResult(result)
 
 	case "cody.explain":
 		filename := lsp.DocumentURI(params.Arguments[0].(string))
@@ -483,72 +641,71 @@ func (l *SourcegraphLLM) ExecuteCommand(ctx context.Context, params types.Execut
 			l.EventLogger.Log("CodyNeovimExtension:codeAction:cody.diff:executed")
 		}
 
-		funcSnippet := getFileSnippet(l.FileMap[filename], int(startLine), int(endLine))
+		funcSnippet, err := l.documentLines(filename, int(startLine), int(endLine))
+		if err != nil {
+			return nil, err
+		}
+		ctx, done := l.generations.start(ctx, params.WorkDoneToken, l.ActiveSession)
+		defer done()
 		humanMessage := fmt.Sprintf(`%s
 `+"```%s"+`
 %s
 `+"```", instruction, strings.ToLower(determineLanguage(string(filename))), funcSnippet)
 
-		var embeddings *embeddings.EmbeddingsSearchResult
-		if l.RepoID != "" {
-			embeddings, _ = l.EmbeddingsClient.GetEmbeddings(l.RepoID, humanMessage, 8, 2)
+		result, err := l.streamExplanation(ctx, conn, filename, humanMessage, codeOnly)
+		if err != nil {
+			return nil, err
 		}
-		params := claude.DefaultCompletionParameters(l.getMessages("", embeddings))
-		var assistantText string
-		if codeOnly {
-			assistantText = fmt.Sprintf("```%s\n", strings.ToLower(determineLanguage(string(filename))))
+		return marshalResult(result)
+
+	case "cody.translate":
+		l.EventLogger.Log("CodyNeovimExtension:codeAction:cody.translate:executed")
+		filename := lsp.DocumentURI(params.Arguments[0].(string))
+		startLine := int(params.Arguments[1].(float64))
+		endLine := int(params.Arguments[2].(float64))
+		target := params.Arguments[3].(string)
+
+		edit, err := l.translate(ctx, filename, startLine, endLine, target)
+		if err != nil {
+			return nil, err
 		}
 
-		params.Messages = append(params.Messages, codyDoPreamble(string(filename), l.FileMap[filename])...)
-		params.Messages = append(params.Messages, l.InteractionMemory...)
-		params.Messages = append(params.Messages,
-			claude.Message{
-				Speaker: claude.Human,
-				Text:    humanMessage,
-			},
-			claude.Message{
-				Speaker: claude.Assistant,
-				Text:    assistantText,
-			})
-		retChan, _ := l.ClaudeClient.StreamCompletion(ctx, params, false)
-		var finalMessage string
-		for resp := range retChan {
-			if codeOnly {
-				if endCodeIndex := strings.Index(resp, "\n```"); endCodeIndex != -1 {
-					resp = resp[:endCodeIndex]
-				}
-			}
-			finalMessage = resp
-			lines := strings.Split(strings.TrimSpace(resp), "\n")
-			var splitLines []string
-			for _, line := range lines {
-				line = strings.TrimRight(line, " ")
-				splitLines = append(splitLines, strings.TrimRight(line, " "))
-			}
+		return l.applyEdit(ctx, conn, params.Command, *edit)
 
-			jsonResponse := struct {
-				Message []string `json:"message"`
-			}{
-				Message: splitLines,
-			}
-			mars, _ := json.Marshal(jsonResponse)
-			msJson := json.RawMessage(mars)
-			conn.Notify(ctx, "cody/chat", msJson)
-			if codeOnly {
-				if endCodeIndex := strings.Index(resp, "\n```"); endCodeIndex != -1 {
-					break
-				}
-			}
+	case "cody.todos/workspace":
+		// Without arguments, the TODOs are listed for the client to choose
+		// from
+		if len(params.Arguments) == 0 {
+			return marshalResult(l.workspaceTODOs())
 		}
-		if codeOnly {
-			finalMessage = fmt.Sprintf("```%s\n%s\n```", strings.ToLower(determineLanguage(string(filename))), finalMessage)
+		l.EventLogger.Log("CodyNeovimExtension:codeAction:cody.todos/workspace:executed")
+		edit, err := l.implementWorkspaceTODOs(ctx, params.Arguments)
+		if err != nil {
+			return nil, err
+		}
+
+		return l.applyEdit(ctx, conn, params.Command, *edit)
+
+	case "cody.suggestions/clear":
+		if len(params.Arguments) > 0 {
+			uri := lsp.DocumentURI(params.Arguments[0].(string))
+			return nil, l.Diagnostics.Publish(ctx, conn, uri, "suggest", nil)
+		}
+		return nil, l.Diagnostics.ClearOwner(ctx, conn, "suggest")
+
+	case "cody.context/last":
+		return marshalResult(l.LastContext())
+
+	case "cody.explainSelection":
+		filename := lsp.DocumentURI(params.Arguments[0].(string))
+		startLine := int(params.Arguments[1].(float64))
+		endLine := int(params.Arguments[2].(float64))
+		var inBuffer bool
+		if len(params.Arguments) >= 4 {
+			inBuffer = params.Arguments[3].(bool)
 		}
-		l.InteractionMemory = append(l.InteractionMemory, claude.Message{Speaker: claude.Human, Text: humanMessage}, claude.Message{
-			Speaker: claude.Assistant,
-			Text:    finalMessage,
-		},
-		)
-		return nil, nil
+
+		return l.explainSelection(ctx, conn, filename, startLine, endLine, inBuffer)
 
 	case "cody.remember":
 		filename := lsp.DocumentURI(params.Arguments[0].(string))
@@ -556,9 +713,12 @@ func (l *SourcegraphLLM) ExecuteCommand(ctx context.Context, params types.Execut
 		endLine := int(params.Arguments[2].(float64))
 		l.EventLogger.Log("CodyNeovimExtension:codeAction:cody.remember:executed")
 
-		funcSnippet := getFileSnippet(l.FileMap[filename], int(startLine), int(endLine))
+		funcSnippet, err := l.documentLines(filename, int(startLine), int(endLine))
+		if err != nil {
+			return nil, err
+		}
 
-		l.InteractionMemory = append(l.InteractionMemory, claude.Message{
+		l.appendMemory(claude.Message{
 			Speaker: claude.Human,
 			Text: fmt.Sprintf(`Here is a snippet from the file "%s":
 `+"```%s"+`
@@ -572,21 +732,119 @@ func (l *SourcegraphLLM) ExecuteCommand(ctx context.Context, params types.Execut
 		return nil, nil
 
 	case "cody.chat/history":
-		mars, _ := json.Marshal(l.InteractionMemory)
+		mars, _ := json.Marshal(l.memorySnapshot())
 		msJson := json.RawMessage(mars)
 
 		return &msJson, nil
 
+	case "cody.memory/list":
+		return marshalResult(l.ListMemory())
+
+	case "cody.memory/delete":
+		if err := l.DeleteMemory(int(params.Arguments[0].(float64))); err != nil {
+			return nil, err
+		}
+		return marshalResult(l.ListMemory())
+
+	case "cody.memory/pin":
+		pinned := true
+		if len(params.Arguments) >= 2 {
+			pinned = params.Arguments[1].(bool)
+		}
+		if err := l.PinMemory(int(params.Arguments[0].(float64)), pinned); err != nil {
+			return nil, err
+		}
+		return marshalResult(l.ListMemory())
+
 	case "cody.forget":
 		l.EventLogger.Log("CodyNeovimExtension:codeAction:cody.forget:executed")
+		l.Mu.Lock()
 		l.InteractionMemory = nil
+		l.Mu.Unlock()
 
 		return nil, nil
 
+	case "cody.chat/new":
+		var title string
+		if len(params.Arguments) >= 1 {
+			title = params.Arguments[0].(string)
+		}
+		return marshalResult(l.NewSession(title))
+
+	case "cody.chat/retry":
+		l.EventLogger.Log("CodyNeovimExtension:codeAction:cody.chat/retry:executed")
+		var filename lsp.DocumentURI
+		if len(params.Arguments) >= 1 {
+			filename = lsp.DocumentURI(params.Arguments[0].(string))
+		}
+		ctx, done := l.generations.start(ctx, params.WorkDoneToken, l.ActiveSession)
+		defer done()
+		result, err := l.retryAnswer(ctx, conn, params.WorkDoneToken, filename)
+		if err != nil {
+			return nil, err
+		}
+		return marshalResult(result)
+
+	case "cody.chat/abort":
+		var id string
+		if len(params.Arguments) >= 1 {
+			id = params.Arguments[0].(string)
+		}
+		return marshalResult(struct {
+			Aborted int `json:"aborted"`
+		}{
+			Aborted: l.generations.abort(id),
+		})
+
+	case "cody.chat/list":
+		return marshalResult(l.ListSessions())
+
+	case "cody.chat/switch":
+		summary, err := l.SwitchSession(params.Arguments[0].(string))
+		if err != nil {
+			return nil, err
+		}
+		return marshalResult(summary)
+
+	case "cody.chat/delete":
+		if err := l.DeleteSession(params.Arguments[0].(string)); err != nil {
+			return nil, err
+		}
+		return marshalResult(l.ListSessions())
+
+	case "cody.chat/export":
+		var id, path string
+		if len(params.Arguments) >= 1 {
+			id = params.Arguments[0].(string)
+		}
+		if len(params.Arguments) >= 2 {
+			path = params.Arguments[1].(string)
+		}
+
+		markdown, err := l.ExportSession(id)
+		if err != nil {
+			return nil, err
+		}
+		if path != "" {
+			if path, err = l.exportPath(path); err != nil {
+				return nil, err
+			}
+			if err := os.WriteFile(path, []byte(markdown), 0o600); err != nil {
+				return nil, err
+			}
+		}
+		return marshalResult(struct {
+			Markdown string `json:"markdown"`
+			Path     string `json:"path,omitempty"`
+		}{
+			Markdown: markdown,
+			Path:     path,
+		})
+
 	case "cody.chat/message":
 		l.EventLogger.Log("CodyNeovimExtension:codeAction:cody.chat:executed")
 		filename := lsp.DocumentURI(params.Arguments[0].(string))
-		message := params.Arguments[1].(string)
+		message, mentions := parseMentions(params.Arguments[1].(string))
 
 		input := []claude.Message{
 			{
@@ -598,22 +856,37 @@ func (l *SourcegraphLLM) ExecuteCommand(ctx context.Context, params types.Execut
 				Text:    "",
 			},
 		}
-
-		params := claude.DefaultCompletionParameters(l.AddContext(input, string(filename), l.FileMap[filename]))
-		codyResponse, err := l.ClaudeClient.GetCompletion(ctx, params, false)
+		// Review-style questions need the changes they are about
+		if mentionsChange(message) && !hasMention(mentions, "diff") {
+			mentions = append(mentions, mention{kind: "diff"})
+		}
+		input = append(l.mentionMessages(ctx, filename, message, mentions), input...)
+
+		ctx, done := l.generations.start(ctx, params.WorkDoneToken, l.ActiveSession)
+		defer done()
+		var prompt []claude.Message
+		var codyResponse string
+		var err error
+		if l.Tools {
+			prompt = l.AddContext(ctx, chatModel, withToolInstructions(input), string(filename), l.Documents.Text(filename))
+			codyResponse, err = l.completeWithTools(ctx, prompt)
+		} else {
+			prompt = l.AddContext(ctx, chatModel, input, string(filename), l.Documents.Text(filename))
+			codyResponse, err = l.streamChat(ctx, conn, params.WorkDoneToken, prompt)
+		}
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
 		codyResponse = strings.TrimSpace(codyResponse)
 
-		resp := struct {
-			Message string `json:"message"`
-		}{
-			Message: codyResponse,
+		resp := types.ChatResult{
+			Message:      codyResponse,
+			ContextFiles: contextFiles(prompt),
+			Aborted:      aborted(ctx),
 		}
 		mars, _ := json.Marshal(resp)
 		msJson := json.RawMessage(mars)
-		l.InteractionMemory = append(l.InteractionMemory, claude.Message{
+		l.appendMemory(claude.Message{
 			Speaker: claude.Human,
 			Text:    message,
 		}, claude.Message{
@@ -623,6 +896,70 @@ func (l *SourcegraphLLM) ExecuteCommand(ctx context.Context, params types.Execut
 		l.EventLogger.Log("CodyNeovimExtension:codeAction:cody.chat:executed")
 		return &msJson, nil
 
+	case "cody.repo/ask":
+		l.EventLogger.Log("CodyNeovimExtension:codeAction:cody.repo/ask:executed")
+		answer, err := l.askRepo(ctx, conn, params.WorkDoneToken, params.Arguments[0].(string))
+		if err != nil {
+			return nil, err
+		}
+		return marshalResult(answer)
+
+	case "cody.shell":
+		l.EventLogger.Log("CodyNeovimExtension:codeAction:cody.shell:executed")
+		request := params.Arguments[0].(string)
+
+		suggestion, err := l.suggestShellCommand(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+
+		return marshalResult(suggestion)
+
+	case "cody.explainOutput":
+		l.EventLogger.Log("CodyNeovimExtension:codeAction:cody.explainOutput:executed")
+		output := params.Arguments[0].(string)
+		var annotate bool
+		if len(params.Arguments) >= 2 {
+			annotate = params.Arguments[1].(bool)
+		}
+
+		result, err := l.explainOutput(ctx, conn, output, annotate)
+		if err != nil {
+			return nil, err
+		}
+		return marshalResult(result)
+
+	case acceptCompletionCommand:
+		return nil, l.acceptCompletion(params.Arguments[0].(string))
+
+	case "cody.feedback":
+		rating := params.Arguments[0].(string)
+		var comment, interactionID string
+		if len(params.Arguments) >= 2 {
+			comment = params.Arguments[1].(string)
+		}
+		if len(params.Arguments) >= 3 {
+			interactionID = params.Arguments[2].(string)
+		}
+
+		it, err := l.sendFeedback(interactionID, rating, comment)
+		if err != nil {
+			return nil, err
+		}
+		return marshalResult(it)
+
+	case "cody.reviewDiff":
+		l.EventLogger.Log("CodyNeovimExtension:codeAction:cody.reviewDiff:executed")
+		review, err := l.reviewDiff(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return marshalResult(struct {
+			Review string `json:"review"`
+		}{
+			Review: review,
+		})
+
 	case "cody.explainErrors":
 		lspErr := params.Arguments[0].(string)
 		message := []claude.Message{{
@@ -632,7 +969,7 @@ func (l *SourcegraphLLM) ExecuteCommand(ctx context.Context, params types.Execut
 			Speaker: claude.Assistant,
 			Text:    "",
 		}}
-		params := claude.DefaultCompletionParameters(message)
+		params := l.completionParameters(chatModel, message)
 		completion, err := l.ClaudeClient.GetCompletion(ctx, params, false)
 		if err != nil {
 			conn.Notify(ctx, "window/logMessage", lsp.LogMessageParams{Type: lsp.MTError, Message: fmt.Sprintf("%v", err)})
@@ -654,48 +991,6 @@ func (l *SourcegraphLLM) ExecuteCommand(ctx context.Context, params types.Execut
 
 		return &msJson, nil
 
-	case "answer":
-		filename := lsp.DocumentURI(params.Arguments[0].(string))
-		startLine := int(params.Arguments[1].(float64))
-		endLine := int(params.Arguments[2].(float64))
-		funcSnippet := getFileSnippet(l.FileMap[filename], int(startLine), int(endLine))
-		implemented := l.answerQuestions(string(filename), l.FileMap[filename], funcSnippet)
-
-		edits := []lsp.TextEdit{
-			{
-				Range: lsp.Range{
-					Start: lsp.Position{
-						Line:      startLine,
-						Character: 0,
-					},
-					End: lsp.Position{
-						Line:      endLine,
-						Character: len(strings.Split(l.FileMap[filename], "\n")[endLine]),
-					},
-				},
-				NewText: implemented,
-			},
-		}
-
-		editParams := types.ApplyWorkspaceEditParams{
-			Edit: types.WorkspaceEdit{
-				DocumentChanges: []types.TextDocumentEdit{
-					{
-						TextDocument: lsp.VersionedTextDocumentIdentifier{
-							TextDocumentIdentifier: lsp.TextDocumentIdentifier{
-								URI: filename,
-							},
-							Version: 0,
-						},
-						Edits: edits,
-					},
-				},
-			},
-		}
-
-		var res json.RawMessage
-		conn.Call(ctx, "workspace/applyEdit", editParams, &res)
-
 	case "testCommand":
 		if params.WorkDoneToken != "" {
 			for i := 0; i < 5; i++ {
@@ -720,11 +1015,12 @@ func (l *SourcegraphLLM) ExecuteCommand(ctx context.Context, params types.Execut
 }
 
 func codyDoPreamble(filename, filecontents string) []claude.Message {
-	return []claude.Message{
+	return append([]claude.Message{
 		{
 			Speaker: claude.Human,
 			Text: fmt.Sprintf(`Here are the contents of the file you are working in:
 %s`, filecontents),
+			Source: fileSource("file", filename, filecontents, 0),
 		},
 		{
 			Speaker: claude.Assistant,
@@ -738,7 +1034,7 @@ func codyDoPreamble(filename, filecontents string) []claude.Message {
 			Speaker: claude.Assistant,
 			Text:    "Ok.",
 		},
-	}
+	}, categoryMessages(filename)...)
 }
 
 // reverseSlice reverses a slice in place
@@ -748,108 +1044,59 @@ func reverseSlice[S ~[]E, E any](s S) {
 	}
 }
 
-// trimMessages makes sure that msgs don't exceed maxTokens. It assumes
-// that the most important messages are at the end of the slice.
-// It returns the trimmed slice, as well as the number of tokens used.
-func trimMessages(msgs []claude.Message, maxTokens int) ([]claude.Message, int) {
-	if len(msgs) == 0 {
-		return nil, 0
-	}
-	var trimmedMessages []claude.Message
-	tokens := 0
-	for i := len(msgs) - 1; i >= 0 && tokens < maxTokens; i-- {
-		text, ts := truncateTextStart(msgs[i].Text, maxTokens-tokens)
-		tokens += ts
-		trimmedMessages = append(trimmedMessages, claude.Message{
-			Speaker: msgs[i].Speaker,
-			Text:    text,
-		})
-	}
-	reverseSlice(trimmedMessages)
-	// The messages _must_ start with a Human speaker
-	if trimmedMessages[0].Speaker != claude.Human {
-		tokens -= getTokenLength(trimmedMessages[0].Text)
-		trimmedMessages = trimmedMessages[1:]
-	}
-	return trimmedMessages, tokens
-}
-
-func (l *SourcegraphLLM) AddContext(input []claude.Message, currentFile string, currentFileContents string) []claude.Message {
-	tokens := maxPromptTokenLength
-	messages := l.getPreamble()
-
-	// First make sure we have space for the preamble
-	for _, message := range messages {
-		tokens -= getTokenLength(message.Text)
-	}
+// AddContext returns the input preceded by the context of a prompt about the
+// current file: the preamble, embeddings results, the current file and the
+// interaction history, fit into the prompt length of the model.
+func (l *SourcegraphLLM) AddContext(ctx context.Context, kind modelKind, input []claude.Message, currentFile string, currentFileContents string) []claude.Message {
+	preamble := append(l.getPreamble(), categoryMessages(currentFile)...)
+	preamble = append(preamble, l.goContextMessages(ctx, currentFile, currentFileContents)...)
+	preamble = append(preamble, l.recentEditsMessages()...)
 
-	truncedContents, _ := truncateText(currentFileContents, maxCurrentFileTokens-10)
-	// Also reserve some space for some of the contents of the current open file.
+	header := fmt.Sprintf("Here are the contents of the file, `%s`, we are in right now:\n", currentFile)
+	truncedContents, _ := truncateText(currentFileContents, maxCurrentFileTokens-getTokenLength(header)-getTokenLength("Ok."))
 	currentFileMessages := []claude.Message{
 		{
 			Speaker: claude.Human,
-			Text:    fmt.Sprintf("Here are the contents of the file, `%s`, we are in right now:\n%s", currentFile, truncedContents),
+			Text:    header + truncedContents,
+			Source:  fileSource("file", currentFile, truncedContents, 0),
 		},
 		{
 			Speaker: claude.Assistant,
 			Text:    "Ok.",
 		},
 	}
-	currentFileMessages, tokensUsed := trimMessages(currentFileMessages, maxCurrentFileTokens)
-	tokens -= tokensUsed
 
-	// Next make sure we have space for the actual prompt
-	for _, message := range input {
-		tokens -= getTokenLength(message.Text)
-	}
-
-	// Next we need to determine whether or not embeddings search is being used.
-	// If it is, we split the remaining tokens between the interaction history
-	// and the embedding results.
-	maxEmbeddingsTokens := tokens / 2
-	embeddingsMessages := []claude.Message{}
-	if l.RepoID != "" {
-		embs, err := l.EmbeddingsClient.GetEmbeddings(l.RepoID, input[len(input)-1].Text, 12, 3)
-		// If embeddings fail for some reason, we don't want to end the interaction
-		if err == nil && embs != nil {
-			embeddingsResults := append(embs.CodeResults, embs.TextResults...)
-			reverseSlice(embeddingsResults) // Reverse results so that they appear in ascending order of importance (least -> most)
-			for _, embedding := range embeddingsResults {
-				embeddingsMessages = append(embeddingsMessages, claude.Message{
-					Speaker: claude.Human,
-					Text:    fmt.Sprintf("Use the following text from file `%s`:\n%s", embedding.FileName, embedding.Content),
-				}, claude.Message{Speaker: claude.Assistant, Text: "Ok."})
-			}
+	var embeddingsMessages []claude.Message
+	embs, err := l.searchEmbeddings(ctx, currentFile, input[len(input)-1].Text, 12, 3)
+	// If embeddings fail for some reason, we don't want to end the interaction
+	if err == nil && embs != nil {
+		repo := l.repoFor(currentFile).Name
+		embeddingsResults := l.projectEmbeddings(currentFile, append(embs.CodeResults, embs.TextResults...))
+		reverseSlice(embeddingsResults) // Reverse results so that they appear in ascending order of importance (least -> most)
+		for _, embedding := range embeddingsResults {
+			embeddingsMessages = append(embeddingsMessages, claude.Message{
+				Speaker: claude.Human,
+				Text:    fmt.Sprintf("Use the following text from file `%s`:\n%s", embedding.FileName, embedding.Content),
+				Source:  embeddingsSource(embedding, repo),
+			}, claude.Message{Speaker: claude.Assistant, Text: "Ok."})
 		}
 	}
-	embeddingsMessages, tokensUsed = trimMessages(embeddingsMessages, maxEmbeddingsTokens)
-	tokens -= tokensUsed
-
-	messages = append(messages, embeddingsMessages...)
-	messages = append(messages, currentFileMessages...)
-
-	// Finally, the rest of the tokens can be used for interaction
-	// history, starting from the last interaction.
-	var reversedInteractionHistory []claude.Message
-	for i := len(l.InteractionMemory) - 1; i >= 0 && tokens > 0; i-- {
-		text, tokensUsed := truncateTextStart(l.InteractionMemory[i].Text, tokens)
-		tokens -= tokensUsed
-		reversedInteractionHistory = append(reversedInteractionHistory, claude.Message{
-			Speaker: l.InteractionMemory[i].Speaker,
-			Text:    text,
-		})
-	}
-	// Then interaction history, but append in the correct order
-	reverseSlice(reversedInteractionHistory)
-	messages = append(messages, reversedInteractionHistory...)
 
-	// And finally the actual input
-	messages = append(messages, input...)
-
-	return messages
+	// The budget goes to the input first, then the preamble, the pinned
+	// messages and the current file. Embeddings get half of what's left and
+	// the interaction history the rest, starting from the last interaction.
+	prompt := promptbuilder.New(promptbuilder.NewBudget(l.maxPromptTokens(kind)))
+	prompt.Add(promptbuilder.Section{Name: "preamble", Messages: preamble, Priority: 3, Trim: promptbuilder.KeepFirst})
+	prompt.Add(promptbuilder.Section{Name: "embeddings", Messages: embeddingsMessages, Priority: 1, Share: 0.5})
+	prompt.Add(promptbuilder.Section{Name: "currentFile", Messages: currentFileMessages, Priority: 2, Max: maxCurrentFileTokens})
+	for _, section := range historySections(l.memorySnapshot()) {
+		prompt.Add(section)
+	}
+	prompt.Add(promptbuilder.Section{Name: "input", Messages: input, Priority: 4})
+	return prompt.Build()
 }
 
-func (l *SourcegraphLLM) codyDo(filename, filecontents, function, instruction string, codeOnly bool) string {
+func (l *SourcegraphLLM) codyDo(ctx context.Context, filename, filecontents, function, instruction string, codeOnly bool) (string, error) {
 	var assistantText string
 	if codeOnly {
 		assistantText = fmt.Sprintf("```%s\n", strings.ToLower(determineLanguage(filename)))
@@ -865,10 +1112,10 @@ func (l *SourcegraphLLM) codyDo(filename, filecontents, function, instruction st
 			Text:    assistantText,
 		},
 	}
-	params := claude.DefaultCompletionParameters(l.AddContext(input, filename, filecontents))
-	implemented, err := l.ClaudeClient.GetCompletion(context.Background(), params, true)
+	params := l.completionParameters(editModel, l.AddContext(ctx, editModel, input, filename, filecontents))
+	implemented, err := l.ClaudeClient.GetCompletion(ctx, params, true)
 	if err != nil {
-		return ""
+		return "", err
 	}
 	if codeOnly {
 		if index := strings.Index(implemented, "\n```"); index != -1 {
@@ -877,7 +1124,7 @@ func (l *SourcegraphLLM) codyDo(filename, filecontents, function, instruction st
 		implemented = strings.TrimPrefix(implemented, fmt.Sprintf("```%s\n", strings.ToLower(determineLanguage(filename))))
 	}
 
-	l.InteractionMemory = append(l.InteractionMemory,
+	l.appendMemory(
 		claude.Message{
 			Speaker: claude.Human,
 			Text: fmt.Sprintf(`%s
@@ -888,16 +1135,25 @@ func (l *SourcegraphLLM) codyDo(filename, filecontents, function, instruction st
 			Text:    implemented,
 		})
 
-	return implemented
+	return implemented, nil
 }
 
-func (l *SourcegraphLLM) implementTODOs(filename, filecontents, function string) string {
-	params := claude.DefaultCompletionParameters(l.getMessages(filename, nil))
+func (l *SourcegraphLLM) implementTODOs(ctx context.Context, filename, filecontents, function string) (string, error) {
+	instruction, err := l.prompt(prompts.TODOs, prompts.Data{
+		Filename: filename,
+		Language: determineLanguage(filename),
+		Code:     function,
+	})
+	if err != nil {
+		return "", err
+	}
+	params := l.completionParameters(editModel, l.getMessages(filename, function, nil))
 	params.Messages = append(params.Messages,
 		claude.Message{
 			Speaker: claude.Human,
 			Text: fmt.Sprintf(`Here are the contents of the file you are working in:
 %s`, filecontents),
+			Source: fileSource("file", filename, filecontents, 0),
 		},
 		claude.Message{
 			Speaker: claude.Assistant,
@@ -905,35 +1161,40 @@ func (l *SourcegraphLLM) implementTODOs(filename, filecontents, function string)
 		},
 		claude.Message{
 			Speaker: claude.Human,
-			Text: fmt.Sprintf(`The following %s code contains TODO instructions. Produce code that will implement the TODO. Don't say anything else.
-Here is the code snippet:
-%s`, determineLanguage(filename), function),
+			Text:    instruction,
 		},
 		claude.Message{
 			Speaker: claude.Assistant,
 			Text:    fmt.Sprintf("```%s", strings.ToLower(determineLanguage(filename))),
 		})
-	implemented, err := l.ClaudeClient.GetCompletion(context.Background(), params, true)
+	implemented, err := l.ClaudeClient.GetCompletion(ctx, params, true)
 	if err != nil {
-		return ""
+		return "", err
 	}
-	return strings.TrimSuffix(strings.TrimPrefix(implemented, fmt.Sprintf("```%s\n", strings.ToLower(determineLanguage(filename)))), "\n```")
+	return strings.TrimSuffix(strings.TrimPrefix(implemented, fmt.Sprintf("```%s\n", strings.ToLower(determineLanguage(filename)))), "\n```"), nil
 }
 
-func (l *SourcegraphLLM) answerQuestions(filename, filecontents, question string) string {
-	cp := commentPrefix(determineLanguage(filename))
+func (l *SourcegraphLLM) answerQuestions(ctx context.Context, filename, filecontents, question string) (string, error) {
+	cp := commentPrefix(l.documentLanguage(lsp.DocumentURI(filename)))
 	question = strings.TrimPrefix(strings.TrimSpace(question), fmt.Sprintf("%s ASK: ", cp))
-	var embeddings *embeddings.EmbeddingsSearchResult = nil
-	var err error
-	if l.RepoID != "" {
-		embeddings, _ = l.EmbeddingsClient.GetEmbeddings(l.RepoID, question, 8, 2)
+	instruction, err := l.prompt(prompts.Answer, prompts.Data{
+		Filename:      filename,
+		Language:      l.documentLanguage(lsp.DocumentURI(filename)),
+		Question:      question,
+		CommentPrefix: cp,
+	})
+	if err != nil {
+		return "", err
 	}
-	params := claude.DefaultCompletionParameters(l.getMessages(filename, embeddings))
+	var embeddings *embeddings.EmbeddingsSearchResult = nil
+	embeddings, _ = l.searchEmbeddings(ctx, filename, question, 8, 2)
+	params := l.completionParameters(chatModel, l.getMessages(filename, question, embeddings))
 	params.Messages = append(params.Messages,
 		claude.Message{
 			Speaker: claude.Human,
 			Text: fmt.Sprintf(`Here are the contents of the file you are working in:
 %s`, filecontents),
+			Source: fileSource("file", filename, filecontents, 0),
 		},
 		claude.Message{
 			Speaker: claude.Assistant,
@@ -941,118 +1202,171 @@ func (l *SourcegraphLLM) answerQuestions(filename, filecontents, question string
 		},
 		claude.Message{
 			Speaker: claude.Human,
-			Text: fmt.Sprintf(`Answer this question. Prepend each line with `+fmt.Sprintf("`%s`", cp)+` since you are in a code editor.
-
-%s`, question),
+			Text:    instruction,
 		},
 		claude.Message{
 			Speaker: claude.Assistant,
 			Text:    cp + " ANSWER: ",
 		})
-	answer, err := l.ClaudeClient.GetCompletion(context.Background(), params, true)
+	answer, err := l.ClaudeClient.GetCompletion(ctx, params, true)
 	if err != nil {
-		return ""
+		return "", err
 	}
-	return cp + " ASK: " + question + "\n" + answer
+	return cp + " ASK: " + question + "\n" + answer, nil
 }
 
 // sendDiagnostics sends the provided diagnostics back over the provided connection.
 func (l *SourcegraphLLM) sendDiagnostics(ctx context.Context, conn jsonrpc2.JSONRPC2, filename, snippet string) error {
-	repoID, err := l.EmbeddingsClient.GetRepoID("github.com/sourcegraph/sourcegraph")
+	// Suggestions are made without context if there are no embeddings
+	embeddingResults, _ := l.searchEmbeddings(ctx, filename, snippet, 8, 0)
+
+	suggestionMessages, err := l.getSuggestionMessages(strings.TrimPrefix(filename, "file://"), snippet)
 	if err != nil {
 		return err
 	}
-	var embeddingResults *embeddings.EmbeddingsSearchResult = nil
-	if l.RepoID != "" {
-		embeddingResults, _ = l.EmbeddingsClient.GetEmbeddings(repoID, snippet, 8, 0)
+	params := l.completionParameters(chatModel, l.getMessages(filename, snippet, embeddingResults))
+	params.Messages = append(params.Messages, suggestionMessages...)
+
+	stream, err := l.streamCompletion(ctx, params, true)
+	if err != nil {
+		return err
 	}
+	defer stream.Close()
+
+	uri := lsp.DocumentURI(filename)
+	lineCount := len(strings.Split(l.Documents.Text(uri), "\n"))
+	var suggestions string
+	for completionResp := range stream.C {
+		suggestions = completionResp
+		if err := l.Diagnostics.Publish(ctx, conn, uri, "suggest", parseSuggestions(suggestions, lineCount, false)); err != nil {
+			return err
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return err
+	}
+	return l.Diagnostics.Publish(ctx, conn, uri, "suggest", parseSuggestions(suggestions, lineCount, true))
+}
 
-	params := claude.DefaultCompletionParameters(l.getMessages(filename, embeddingResults))
-	params.Messages = append(params.Messages, getSuggestionMessages(strings.TrimPrefix(filename, "file://"), snippet)...)
+// diagnosticContextLines is the number of lines around a diagnostic included
+// when asking for a fix.
+const diagnosticContextLines = 10
 
-	retChan, err := l.ClaudeClient.StreamCompletion(ctx, params, true)
+// fixDiagnostic asks the LLM to fix the diagnostic reported for lines
+// startLine through endLine, and returns the replacement for those lines.
+func (l *SourcegraphLLM) fixDiagnostic(ctx context.Context, filename, filecontents string, startLine, endLine int, diagnostic string) (string, error) {
+	lines := strings.Split(filecontents, "\n")
+	if startLine < 0 || endLine < startLine || endLine >= len(lines) {
+		return "", fmt.Errorf("%w: lines %d-%d of %s, which has %d lines", documents.ErrLineOutOfRange, startLine+1, endLine+1, filename, len(lines))
+	}
+	contextStart := startLine - diagnosticContextLines
+	if contextStart < 0 {
+		contextStart = 0
+	}
+	contextEnd := endLine + diagnosticContextLines
+	if contextEnd > len(lines)-1 {
+		contextEnd = len(lines) - 1
+	}
+	language := strings.ToLower(determineLanguage(filename))
 
-	for completionResp := range retChan {
-		diagnostics := []lsp.Diagnostic{}
-		for _, line := range strings.Split(completionResp, "\n") {
-			parts := strings.Split(line, ": ")
-			if len(parts) < 2 {
-				continue
-			}
-			lineNumberRange := parts[0][5:]
-			var lineStart, lineEnd int
-			if strings.Contains(lineNumberRange, "-") {
-				sp := strings.Split(lineNumberRange, "-")
-				lineStart, err = strconv.Atoi(sp[0])
-				if err != nil {
-					continue
-				}
-				lineEnd, err = strconv.Atoi(sp[1])
-				if err != nil {
-					continue
-				}
-			} else {
-				lineStart, err = strconv.Atoi(parts[0][5:])
-				if err != nil {
-					continue
-				}
-				lineEnd = lineStart
-			}
+	input := []claude.Message{
+		{
+			Speaker: claude.Human,
+			Text: fmt.Sprintf(`Here is some code surrounding an error:
+`+"```%s"+`
+%s
+`+"```"+`
 
-			diagnostics = append(diagnostics, lsp.Diagnostic{
-				Range: lsp.Range{
-					Start: lsp.Position{
-						Line:      lineStart,
-						Character: 0,
-					},
-					End: lsp.Position{
-						Line:      lineEnd,
-						Character: 0,
-					},
-				},
-				Severity: lsp.Log,
-				Message:  parts[1],
-			})
-		}
+Lines %d-%d have the following error: %s
 
-		params := lsp.PublishDiagnosticsParams{
-			URI:         lsp.DocumentURI(filename),
-			Diagnostics: diagnostics,
-		}
-		if err := conn.Notify(ctx, "textDocument/publishDiagnostics", params); err != nil {
-			return err
-		}
+Fix the error. Return only the fixed version of lines %d-%d, without line numbers, and nothing else.
+`+"```%s"+`
+%s
+`+"```", language, numberLines(strings.Join(lines[contextStart:contextEnd+1], "\n"), contextStart), startLine, endLine, diagnostic,
+				startLine, endLine, language, strings.Join(lines[startLine:endLine+1], "\n")),
+		},
+		{
+			Speaker: claude.Assistant,
+			Text:    fmt.Sprintf("```%s\n", language),
+		},
+	}
+	params := l.completionParameters(editModel, l.AddContext(ctx, editModel, input, filename, filecontents))
+	fixed, err := l.ClaudeClient.GetCompletion(ctx, params, true)
+	if err != nil {
+		return "", err
 	}
 
-	return nil
+	return extractCode(fixed), nil
 }
 
-func (l *SourcegraphLLM) getDocString(filename, function string) string {
-	cp := commentPrefix(determineLanguage(filename))
-	params := claude.DefaultCompletionParameters(l.getMessages(filename, nil))
+// getDocString asks for the doc comment of the function, and returns the
+// answer starting with open, the start of the doc comment.
+func (l *SourcegraphLLM) getDocString(ctx context.Context, filename, function, open string, startLine, endLine int) (string, error) {
+	cp := commentPrefix(l.documentLanguage(lsp.DocumentURI(filename)))
+	instruction, err := l.prompt(prompts.Docstring, prompts.Data{
+		Filename:      filename,
+		Language:      determineLanguage(filename),
+		Code:          function,
+		CommentPrefix: cp,
+	})
+	if err != nil {
+		return "", err
+	}
+	params := l.completionParameters(editModel, l.getMessages(filename, function, nil))
+	params.Messages = append(params.Messages, l.symbolMessages(lsp.DocumentURI(filename), startLine, endLine)...)
 	params.Messages = append(params.Messages, claude.Message{
 		Speaker: claude.Human,
-		Text: fmt.Sprintf(`Generate a doc string explaining the use of the following %s function:
-%s
-
-Don't include the function in your output.`, determineLanguage(filename), function),
+		Text:    instruction,
 	},
 		claude.Message{
 			Speaker: claude.Assistant,
-			Text:    cp,
+			Text:    open,
 		})
-	docstring, err := l.ClaudeClient.GetCompletion(context.Background(), params, true)
+	docstring, err := l.ClaudeClient.GetCompletion(ctx, params, true)
 	if err != nil {
-		return ""
+		return "", err
 	}
-	return docstring
+	return docstring, nil
 }
 
+// marshalResult marshals v into a command result.
+func marshalResult(v any) (*json.RawMessage, error) {
+	mars, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	msJson := json.RawMessage(mars)
+
+	return &msJson, nil
+}
+
+// getFileSnippet returns lines startLine through endLine of fileContent,
+// clamped to the lines of the content.
 func getFileSnippet(fileContent string, startLine, endLine int) string {
 	fileLines := strings.Split(fileContent, "\n")
+	if startLine < 0 {
+		startLine = 0
+	}
+	if endLine >= len(fileLines) {
+		endLine = len(fileLines) - 1
+	}
+	if startLine > endLine {
+		return ""
+	}
 	return strings.Join(fileLines[startLine:endLine+1], "\n")
 }
 
+// documentLines returns lines startLine through endLine of an open document.
+// It returns an error if the document isn't open or the lines aren't in it,
+// e.g. if a command was sent for an outdated version of the document.
+func (l *SourcegraphLLM) documentLines(uri lsp.DocumentURI, startLine, endLine int) (string, error) {
+	doc, err := l.Documents.Lookup(uri)
+	if err != nil {
+		return "", err
+	}
+	return doc.Lines(startLine, endLine)
+}
+
 func numberLines(content string, startLine int) string {
 	lines := strings.Split(content, "\n")
 	for i, line := range lines {
@@ -1061,70 +1375,92 @@ func numberLines(content string, startLine int) string {
 	return strings.Join(lines, "\n")
 }
 
-func getSuggestionMessages(filename, content string) []claude.Message {
+func (l *SourcegraphLLM) getSuggestionMessages(filename, content string) ([]claude.Message, error) {
+	instruction, err := l.prompt(prompts.Suggest, prompts.Data{
+		Filename: filename,
+		Language: determineLanguage(filename),
+		Code:     content,
+	})
+	if err != nil {
+		return nil, err
+	}
+	// The answer isn't prefilled, so that templates can ask for any format
+	// parseSuggestions understands
 	return []claude.Message{
 		{
 			Speaker: claude.Human,
-			Text: fmt.Sprintf(`Suggest improvements to following lines of code in the file '%s':
-%s
-
-Suggest improvements in the format:
-Line {number}: {suggestion}`, filename, content),
+			Text:    instruction,
 		}, {
 			Speaker: claude.Assistant,
-			Text:    "Line",
+			Text:    "",
 		},
-	}
+	}, nil
 }
 
+// getPreamble returns the message introducing the assistant, followed by the
+// instructions of the workspace preamble. A broken preamble template falls
+// back to the default one.
 func (l *SourcegraphLLM) getPreamble() []claude.Message {
-	codyMessage := fmt.Sprintf(`I am Cody, an AI-powered coding assistant developed by Sourcegraph. I operate inside a Language Server Protocol implementation. My task is to help programmers with programming tasks in all programming languages.
-I have access to your currently open files in the editor.
-I will generate suggestions as concisely and clearly as possible.
-I only suggest something if I am certain about my answer.`)
-	if l.RepoName != "" {
-		codyMessage += fmt.Sprintf("\nI have knowledge about the %s repository and can answer questions about it.", l.RepoName)
-	}
+	codyMessage, _ := l.prompt(prompts.Preamble, prompts.Data{})
 	messages := []claude.Message{{
 		Speaker: claude.Assistant,
 		Text:    codyMessage,
 	}}
 
-	return messages
+	return append(messages, l.workspacePreambleMessages()...)
 }
 
-func (l *SourcegraphLLM) getMessages(filename string, embeddingResults *embeddings.EmbeddingsSearchResult) []claude.Message {
-	codyMessage := fmt.Sprintf(`I am Cody, an AI-powered coding assistant developed by Sourcegraph. I operate inside a Language Server Protocol implementation. My task is to help programmers with programming tasks in all programming languages.
-I have access to your currently open files in the editor.
-I will generate suggestions as concisely and clearly as possible.
-I only suggest something if I am certain about my answer.`)
-	if l.RepoName != "" {
-		codyMessage += fmt.Sprintf("\nI have knowledge about the %s repository and can answer questions about it.", l.RepoName)
-	}
-	messages := []claude.Message{{
-		Speaker: claude.Assistant,
-		Text:    codyMessage,
-	}}
-	for k, v := range l.FileMap {
+// getMessages returns the preamble of prompts about query in filename: the
+// most relevant open files, the recent edits and the embeddings results.
+func (l *SourcegraphLLM) getMessages(filename, query string, embeddingResults *embeddings.EmbeddingsSearchResult) []claude.Message {
+	messages := l.getPreamble()
+	messages = append(messages, categoryMessages(filename)...)
+	for _, doc := range l.openFilesContext(filename, query) {
 		messages = append(messages, claude.Message{
 			Speaker: claude.Human,
 			Text: fmt.Sprintf(`Here are the contents of the file '%s':
-%s`, k, v),
+%s`, doc.URI, doc.Text),
+			Source: fileSource("file", string(doc.URI), doc.Text, 0),
 		},
 			claude.Message{
 				Speaker: claude.Assistant,
 				Text:    "Ok.",
 			})
 	}
+	messages = append(messages, l.recentEditsMessages()...)
 	if embeddingResults != nil {
-		for _, embedding := range embeddingResults.CodeResults {
+		repo := l.repoFor(filename).Name
+		for _, embedding := range l.projectEmbeddings(filename, embeddingResults.CodeResults) {
 			messages = append(messages, claude.Message{
 				Speaker: claude.Human,
 				Text: fmt.Sprintf(`Here are the contents of the file '%s':
 %s`, embedding.FileName, embedding.Content),
+				Source: embeddingsSource(embedding, repo),
 			}, claude.Message{Speaker: claude.Assistant, Text: "Ok."})
 		}
 	}
 
 	return messages
 }
+
+// projectEmbeddings returns the embeddings results that are part of the
+// subproject of filename. If none are, all results are returned. Results from
+// other repositories than the one of filename are always kept.
+func (l *SourcegraphLLM) projectEmbeddings(filename string, results []embeddings.EmbeddingsResult) []embeddings.EmbeddingsResult {
+	project := repoRelativeProject(l.projectRoot(lsp.DocumentURI(filename)))
+	if project == "" {
+		return results
+	}
+
+	repoName := l.repoFor(filename).Name
+	var filtered []embeddings.EmbeddingsResult
+	for _, result := range results {
+		if result.RepoName != "" && result.RepoName != repoName || inRepoProject(project, result.FileName) {
+			filtered = append(filtered, result)
+		}
+	}
+	if len(filtered) == 0 {
+		return results
+	}
+	return filtered
+}
@@ -1,6 +1,17 @@
 package providers
 
-import "testing"
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/pjlast/llmsp/claude"
+	"github.com/pjlast/llmsp/internal/documents"
+	"github.com/pjlast/llmsp/internal/golden"
+	"github.com/pjlast/llmsp/sourcegraph/embeddings"
+	"github.com/pjlast/llmsp/types"
+)
 
 func TestGetRepoName(t *testing.T) {
 	want := "github.com/sourcegraph/sourcegraph"
@@ -19,6 +30,25 @@ func TestGetRepoName(t *testing.T) {
 	}
 }
 
+func TestGetFileSnippet(t *testing.T) {
+	content := "a\nb\nc"
+	tests := []struct {
+		start, end int
+		want       string
+	}{
+		{0, 1, "a\nb"},
+		{1, 2, "b\nc"},
+		{1, 10, "b\nc"},
+		{-1, 0, "a"},
+		{5, 10, ""},
+	}
+	for _, test := range tests {
+		if got := getFileSnippet(content, test.start, test.end); got != test.want {
+			t.Errorf("getFileSnippet(%d, %d) == %q, want %q", test.start, test.end, got, test.want)
+		}
+	}
+}
+
 func TestDetermineLanguage(t *testing.T) {
 	tests := []struct {
 		filename string
@@ -36,10 +66,18 @@ func TestDetermineLanguage(t *testing.T) {
 		{"./plugh.rb", "Ruby"},
 		{"./xyzzy.php", "PHP"},
 		{"./thud.cs", "C#"},
+		{"./main.rs", "Rust"},
+		{"./App.kt", "Kotlin"},
+		{"./View.swift", "Swift"},
+		{"./Main.hs", "Haskell"},
+		{"./schema.sql", "SQL"},
+		{"./deploy.yaml", "YAML"},
+		{"./install.sh", "Shell"},
+		{"./Makefile", "Makefile"},
 		{"./foo.bar", "bar"},
 		{"./foo.baz", "baz"},
-		{"./foo.txt", "txt"},
-		{"./foo.md", "md"},
+		{"./foo.txt", "Text"},
+		{"./foo.md", "Markdown"},
 	}
 
 	for _, test := range tests {
@@ -50,3 +88,78 @@ func TestDetermineLanguage(t *testing.T) {
 		}
 	}
 }
+
+func TestAddContextFitsModel(t *testing.T) {
+	l := &SourcegraphLLM{
+		EditModel: "openai/gpt-3.5-turbo",
+		Documents: documents.FromMap(types.MemoryFileMap{}),
+	}
+	// An interaction history much longer than the context window
+	for i := 0; i < 100; i++ {
+		l.InteractionMemory = append(l.InteractionMemory,
+			claude.Message{Speaker: claude.Human, Text: fmt.Sprintf("Explain Handler%d", i)},
+			claude.Message{Speaker: claude.Assistant, Text: strings.Repeat("It handles requests. ", 50)})
+	}
+	contents := strings.Repeat("func handler() {}\n", 1000)
+	input := []claude.Message{{Speaker: claude.Human, Text: "Add logging to handler"}, {Speaker: claude.Assistant}}
+
+	messages := l.AddContext(context.Background(), editModel, input, "file:///src/handlers.go", contents)
+	tokens := 0
+	for _, message := range messages {
+		tokens += getTokenLength(message.Text)
+	}
+	if max := l.maxPromptTokens(editModel); tokens > max {
+		t.Errorf("the prompt has %d tokens, more than the %d of the model", tokens, max)
+	}
+	if last := messages[len(messages)-2]; last.Text != "Add logging to handler" {
+		t.Errorf("the prompt ends with %q, want the input", last.Text)
+	}
+	if history := messages[len(messages)-4]; history.Text != l.InteractionMemory[len(l.InteractionMemory)-2].Text {
+		t.Errorf("got %q before the last answer, want the most recent question", history.Text)
+	}
+}
+
+// formatPrompt renders the messages of a prompt for golden files, with the
+// context each message includes.
+func formatPrompt(messages []claude.Message) string {
+	var sb strings.Builder
+	for _, message := range messages {
+		fmt.Fprintf(&sb, "--- %s", message.Speaker)
+		if source := message.Source; source != nil {
+			fmt.Fprintf(&sb, " [%s %s:%d-%d]", source.Kind, source.File, source.StartLine, source.EndLine)
+		}
+		fmt.Fprintf(&sb, "\n%s\n", message.Text)
+	}
+	return sb.String()
+}
+
+func TestAddContextGolden(t *testing.T) {
+	l := &SourcegraphLLM{
+		Documents: documents.FromMap(types.MemoryFileMap{}),
+		InteractionMemory: []claude.Message{
+			{Speaker: claude.Human, Text: "What does handler do?"},
+			{Speaker: claude.Assistant, Text: "It answers requests."},
+		},
+	}
+	input := []claude.Message{{Speaker: claude.Human, Text: "Add logging to handler"}, {Speaker: claude.Assistant, Text: "```go\n"}}
+	contents := "package server\n\nfunc handler(w http.ResponseWriter, r *http.Request) {\n\tw.Write([]byte(\"ok\"))\n}\n"
+
+	messages := l.AddContext(context.Background(), editModel, input, "file:///src/server/handler.go", contents)
+	golden.Assert(t, "addcontext", formatPrompt(messages))
+}
+
+func TestGetMessagesGolden(t *testing.T) {
+	l := &SourcegraphLLM{
+		Documents: documents.FromMap(types.MemoryFileMap{
+			"file:///src/server/handler.go": "package server\n\nfunc handler() {}\n",
+		}),
+	}
+	results := &embeddings.EmbeddingsSearchResult{
+		CodeResults: []embeddings.EmbeddingsResult{
+			{FileName: "server/routes.go", StartLine: 10, EndLine: 12, Content: "func routes() {\n\thandle(\"/\", handler)\n}"},
+		},
+	}
+
+	messages := l.getMessages("file:///src/server/handler.go", "Where is handler used?", results)
+	golden.Assert(t, "getmessages", formatPrompt(messages))
+}
@@ -0,0 +1,136 @@
+package providers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pjlast/llmsp/internal/state"
+)
+
+// historyVersion is the version of the on-disk chat history format.
+const historyVersion = 1
+
+// historyMigrations upgrade chat history files written by older versions of
+// llmsp. A migration must be added here whenever historyVersion is bumped.
+var historyMigrations = []state.Migration{}
+
+// storedHistory is the on-disk representation of a workspace's chat history.
+type storedHistory struct {
+	Version       int            `json:"version"`
+	Workspace     string         `json:"workspace"`
+	ActiveSession string         `json:"activeSession"`
+	Sessions      []*ChatSession `json:"sessions"`
+}
+
+// dataDir returns the directory llmsp stores its data in, following the XDG
+// base directory specification.
+func dataDir() (string, error) {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "llmsp"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share", "llmsp"), nil
+}
+
+// workspaceRoot returns the root directory of the workspace, falling back to
+// the working directory if the client didn't provide one.
+func (l *SourcegraphLLM) workspaceRoot() string {
+	if l.WorkspaceRoot != "" {
+		return strings.TrimPrefix(l.WorkspaceRoot, "file://")
+	}
+	wd, _ := os.Getwd()
+	return wd
+}
+
+// historyPath returns the path of the chat history file for the workspace.
+func (l *SourcegraphLLM) historyPath() (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(l.workspaceRoot()))
+	return filepath.Join(dir, "history", hex.EncodeToString(sum[:8])+".json"), nil
+}
+
+// loadHistory restores the chat sessions of the workspace from disk.
+func (l *SourcegraphLLM) loadHistory() error {
+	path, err := l.historyPath()
+	if err != nil {
+		return err
+	}
+	var history storedHistory
+	if err := state.Load(path, historyVersion, historyMigrations, &history); err != nil {
+		l.historyReadOnly = errors.Is(err, state.ErrNewerVersion)
+		return err
+	}
+	if len(history.Sessions) == 0 {
+		return errors.New("no chat sessions stored")
+	}
+
+	l.Mu.Lock()
+	defer l.Mu.Unlock()
+
+	l.Sessions = make(map[string]*ChatSession, len(history.Sessions))
+	for _, session := range history.Sessions {
+		l.Sessions[session.ID] = session
+	}
+	active, ok := l.Sessions[history.ActiveSession]
+	if !ok {
+		active = history.Sessions[len(history.Sessions)-1]
+	}
+	l.ActiveSession = active.ID
+	l.InteractionMemory = active.memory()
+
+	return nil
+}
+
+// saveHistory writes the chat sessions of the workspace to disk. The
+// history is encoded under l.Mu, but written after unlocking it.
+func (l *SourcegraphLLM) saveHistory() error {
+	path, err := l.historyPath()
+	if err != nil {
+		return err
+	}
+
+	l.historyWrite.Lock()
+	defer l.historyWrite.Unlock()
+	data, err := l.encodeHistory()
+	if data == nil || err != nil {
+		return err
+	}
+	return state.Write(path, data)
+}
+
+// encodeHistory encodes the chat sessions of the workspace, or returns nil if
+// the stored history must not be overwritten.
+func (l *SourcegraphLLM) encodeHistory() ([]byte, error) {
+	l.Mu.Lock()
+	defer l.Mu.Unlock()
+	// Don't overwrite the stored history if it was never loaded, or if it was
+	// written by a newer version of llmsp
+	if len(l.Sessions) == 0 || l.historyReadOnly {
+		return nil, nil
+	}
+	l.syncSession()
+	history := storedHistory{
+		Version:       historyVersion,
+		Workspace:     l.workspaceRoot(),
+		ActiveSession: l.ActiveSession,
+	}
+	for _, session := range l.Sessions {
+		history.Sessions = append(history.Sessions, session)
+	}
+	sort.Slice(history.Sessions, func(i, j int) bool {
+		return history.Sessions[i].CreatedAt.Before(history.Sessions[j].CreatedAt)
+	})
+
+	return state.Marshal(history)
+}
@@ -0,0 +1,39 @@
+package providers
+
+import (
+	"testing"
+
+	"github.com/pjlast/llmsp/claude"
+)
+
+func TestHistoryPersistence(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+
+	l := &SourcegraphLLM{WorkspaceRoot: "file:///home/user/project"}
+	l.NewSession("First")
+	l.InteractionMemory = append(l.InteractionMemory, claude.Message{Speaker: claude.Human, Text: "Hello"})
+	second := l.NewSession("Second")
+	l.InteractionMemory = append(l.InteractionMemory, claude.Message{Speaker: claude.Human, Text: "World"})
+	if err := l.saveHistory(); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := &SourcegraphLLM{WorkspaceRoot: "file:///home/user/project"}
+	if err := restored.loadHistory(); err != nil {
+		t.Fatal(err)
+	}
+	if len(restored.Sessions) != 2 {
+		t.Errorf("got %d sessions, want 2", len(restored.Sessions))
+	}
+	if restored.ActiveSession != second.ID {
+		t.Errorf("active session == %q, want %q", restored.ActiveSession, second.ID)
+	}
+	if len(restored.InteractionMemory) != 1 || restored.InteractionMemory[0].Text != "World" {
+		t.Errorf("unexpected interaction memory %+v", restored.InteractionMemory)
+	}
+
+	other := &SourcegraphLLM{WorkspaceRoot: "file:///home/user/other"}
+	if err := other.loadHistory(); err == nil {
+		t.Error("expected no history for a different workspace")
+	}
+}
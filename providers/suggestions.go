@@ -0,0 +1,149 @@
+package providers
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/sourcegraph/go-lsp"
+)
+
+// suggestionLine matches a suggestion for a line or range of lines in the
+// format "Line {number}: {suggestion}", for templates that don't ask for
+// JSON. Variations models often make are accepted too, like "Lines 3-5:", "- **Line 3**:", "line 3 -"
+// and "Line 3 to 5:".
+var suggestionLine = regexp.MustCompile(`(?i)^[\s*\-•>#]*(?:\d+\.\s+)?[*_]*lines?\s+(\d+)(?:\s*(?:-|–|to)\s*(\d+))?[*_]*\s*(?::|-|–)\s*(.+)$`)
+
+// suggestion is a suggestion of the model, in the JSON format the suggest
+// prompt asks for.
+type suggestion struct {
+	Line    int    `json:"line"`
+	EndLine int    `json:"endLine"`
+	Message string `json:"message"`
+	// Severity is "error", "warning", "info" or "hint"
+	Severity string `json:"severity"`
+	// Confidence is between 0 and 1, it is 0 if the model didn't say
+	Confidence float64 `json:"confidence"`
+}
+
+// minConfidence is the confidence below which suggestions are only hints.
+const minConfidence = 0.5
+
+// jsonSuggestions matches the start of a JSON array of suggestions.
+var jsonSuggestions = regexp.MustCompile(`\[\s*\{`)
+
+// parseSuggestions parses the suggestions of the model into diagnostics for
+// a document with lineCount lines. Suggestions are expected as a JSON array,
+// and parsed line by line with suggestionLine otherwise. While the answer is
+// streamed, and done isn't set, only complete suggestions are returned.
+// Suggestions for lines outside of the document are dropped.
+func parseSuggestions(text string, lineCount int, done bool) []lsp.Diagnostic {
+	var suggestions []suggestion
+	if loc := jsonSuggestions.FindStringIndex(text); loc != nil {
+		suggestions = decodeSuggestions(text[loc[0]:])
+	} else {
+		if !done {
+			// The last line may still be incomplete
+			text = text[:strings.LastIndex(text, "\n")+1]
+		}
+		suggestions = matchSuggestions(text)
+	}
+
+	var diagnostics []lsp.Diagnostic
+	for _, s := range suggestions {
+		if s.EndLine == 0 {
+			s.EndLine = s.Line
+		}
+		if s.EndLine < s.Line {
+			s.Line, s.EndLine = s.EndLine, s.Line
+		}
+		if s.Line < 0 || s.Line >= lineCount || strings.TrimSpace(s.Message) == "" {
+			continue
+		}
+		if s.EndLine >= lineCount {
+			s.EndLine = lineCount - 1
+		}
+
+		diagnostics = append(diagnostics, lsp.Diagnostic{
+			Range: lsp.Range{
+				Start: lsp.Position{
+					Line:      s.Line,
+					Character: 0,
+				},
+				End: lsp.Position{
+					Line:      s.EndLine,
+					Character: 0,
+				},
+			},
+			Severity: s.severity(),
+			Source:   "cody",
+			Message:  strings.TrimSpace(s.Message),
+		})
+	}
+	return diagnostics
+}
+
+// severity maps the severity of the suggestion to an LSP severity.
+// Suggestions the model isn't confident about, and suggestions without a
+// severity, are hints.
+func (s suggestion) severity() lsp.DiagnosticSeverity {
+	if s.Confidence != 0 && s.Confidence < minConfidence {
+		return lsp.Log
+	}
+	switch strings.ToLower(s.Severity) {
+	case "error":
+		return lsp.Error
+	case "warning":
+		return lsp.Warning
+	case "info", "information":
+		return lsp.Information
+	}
+	return lsp.Log
+}
+
+// decodeSuggestions decodes the suggestions of a JSON array, up to the first
+// one that is incomplete or invalid.
+func decodeSuggestions(text string) []suggestion {
+	dec := json.NewDecoder(strings.NewReader(text))
+	if _, err := dec.Token(); err != nil {
+		return nil
+	}
+	var suggestions []suggestion
+	for dec.More() {
+		var s suggestion
+		if err := dec.Decode(&s); err != nil {
+			break
+		}
+		suggestions = append(suggestions, s)
+	}
+	return suggestions
+}
+
+// matchSuggestions parses suggestions in the format "Line {number}:
+// {suggestion}". Lines that aren't suggestions are skipped.
+func matchSuggestions(text string) []suggestion {
+	var suggestions []suggestion
+	for _, line := range strings.Split(text, "\n") {
+		match := suggestionLine.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			continue
+		}
+		start, err := strconv.Atoi(match[1])
+		if err != nil {
+			continue
+		}
+		end := start
+		if match[2] != "" {
+			if end, err = strconv.Atoi(match[2]); err != nil {
+				continue
+			}
+		}
+		suggestions = append(suggestions, suggestion{
+			Line:    start,
+			EndLine: end,
+			Message: strings.Trim(match[3], "*_ "),
+		})
+	}
+	return suggestions
+}
@@ -0,0 +1,91 @@
+package providers
+
+import (
+	"testing"
+
+	"github.com/sourcegraph/go-lsp"
+)
+
+func TestParseSuggestions(t *testing.T) {
+	tests := []struct {
+		line               string
+		wantStart, wantEnd int
+		wantMessage        string
+	}{
+		{"Line 3: Use a constant", 3, 3, "Use a constant"},
+		{"Line 5-7: Extract a function", 5, 7, "Extract a function"},
+		{"Lines 5 - 7: Extract a function", 5, 7, "Extract a function"},
+		{"- **Line 12**: Check the error", 12, 12, "Check the error"},
+		{"1. Line 4 to 6: Simplify the loop", 4, 6, "Simplify the loop"},
+		{"line 8 - Rename x", 8, 8, "Rename x"},
+		{"Line 9–8: Swap the arguments", 8, 9, "Swap the arguments"},
+		{"Here are my suggestions:", -1, -1, ""},
+		{"Line x: Not a line", -1, -1, ""},
+		{"Line 9", -1, -1, ""},
+		{"Online 3: not a suggestion", -1, -1, ""},
+	}
+	for _, test := range tests {
+		diagnostics := parseSuggestions(test.line, 100, true)
+		if test.wantStart < 0 {
+			if len(diagnostics) != 0 {
+				t.Errorf("parseSuggestions(%q) == %+v, want no suggestions", test.line, diagnostics)
+			}
+			continue
+		}
+		if len(diagnostics) != 1 {
+			t.Errorf("parseSuggestions(%q) == %+v, want one suggestion", test.line, diagnostics)
+			continue
+		}
+		d := diagnostics[0]
+		if d.Range.Start.Line != test.wantStart || d.Range.End.Line != test.wantEnd || d.Message != test.wantMessage {
+			t.Errorf("parseSuggestions(%q) == lines %d-%d %q, want lines %d-%d %q", test.line,
+				d.Range.Start.Line, d.Range.End.Line, d.Message, test.wantStart, test.wantEnd, test.wantMessage)
+		}
+	}
+}
+
+func TestParseJSONSuggestions(t *testing.T) {
+	answer := `Here are my suggestions:
+[
+  {"line": 3, "endLine": 5, "severity": "error", "confidence": 0.9, "message": "The error is ignored"},
+  {"line": 7, "severity": "warning", "confidence": 0.2, "message": "Maybe rename x"},
+  {"line": 8, "endLine": 40, "severity": "info", "message": "Extract a function"},
+  {"line": 12, "severity": "error", "message": "Beyond the end of the file"},
+  {"line": 9, "severity": "hint", "message": "Use a constant"}
+]`
+	diagnostics := parseSuggestions(answer, 10, true)
+	want := []struct {
+		start, end int
+		severity   lsp.DiagnosticSeverity
+	}{
+		{3, 5, lsp.Error},
+		{7, 7, lsp.Log},
+		{8, 9, lsp.Information},
+		{9, 9, lsp.Log},
+	}
+	if len(diagnostics) != len(want) {
+		t.Fatalf("got %d diagnostics, want %d: %+v", len(diagnostics), len(want), diagnostics)
+	}
+	for i, w := range want {
+		d := diagnostics[i]
+		if d.Range.Start.Line != w.start || d.Range.End.Line != w.end || d.Severity != w.severity {
+			t.Errorf("got lines %d-%d with severity %d, want lines %d-%d with severity %d",
+				d.Range.Start.Line, d.Range.End.Line, d.Severity, w.start, w.end, w.severity)
+		}
+	}
+}
+
+func TestParseStreamedSuggestions(t *testing.T) {
+	partial := `[{"line": 1, "message": "First"}, {"line": 2, "mess`
+	if diagnostics := parseSuggestions(partial, 10, false); len(diagnostics) != 1 || diagnostics[0].Message != "First" {
+		t.Errorf("got %+v, want the complete suggestion only", diagnostics)
+	}
+
+	partial = "Line 1: First\nLine 2: Sec"
+	if diagnostics := parseSuggestions(partial, 10, false); len(diagnostics) != 1 || diagnostics[0].Message != "First" {
+		t.Errorf("got %+v, want the complete line only", diagnostics)
+	}
+	if diagnostics := parseSuggestions(partial, 10, true); len(diagnostics) != 2 {
+		t.Errorf("got %+v, want both lines once done", diagnostics)
+	}
+}
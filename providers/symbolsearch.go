@@ -0,0 +1,169 @@
+package providers
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pjlast/llmsp/internal/metrics"
+	"github.com/pjlast/llmsp/sourcegraph/embeddings"
+)
+
+const (
+	// maxSearchIdentifiers is the number of identifiers near the cursor
+	// whose definitions are searched.
+	maxSearchIdentifiers = 5
+	// maxSearchLines is the number of lines at the end of the query that
+	// identifiers are taken from.
+	maxSearchLines = 10
+	// searchContextTTL is how long search results are cached.
+	searchContextTTL = time.Minute
+)
+
+// identifier matches identifiers of at least three characters.
+var identifier = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]{2,}`)
+
+// definedBefore matches the keywords introducing definitions, whose names
+// are defined in the document rather than elsewhere.
+var definedBefore = regexp.MustCompile(`\b(func|def|function|fn|class|type)\s+$`)
+
+// commonWords are keywords and names of builtins that aren't worth
+// searching for.
+var commonWords = map[string]bool{
+	"break": true, "case": true, "catch": true, "class": true, "const": true, "continue": true,
+	"def": true, "default": true, "defer": true, "delete": true, "elif": true, "else": true,
+	"enum": true, "error": true, "export": true, "extends": true, "false": true, "final": true,
+	"for": true, "from": true, "func": true, "function": true, "impl": true, "import": true,
+	"int": true, "interface": true, "len": true, "let": true, "make": true, "nil": true,
+	"new": true, "None": true, "null": true, "package": true, "print": true, "private": true,
+	"pub": true, "public": true, "range": true, "return": true, "self": true, "static": true,
+	"string": true, "struct": true, "super": true, "switch": true, "this": true, "throw": true,
+	"True": true, "False": true, "true": true, "try": true, "type": true, "undefined": true,
+	"var": true, "void": true, "while": true, "with": true, "yield": true,
+}
+
+// identifiersNear returns the identifiers in the last lines of text that
+// likely refer to definitions elsewhere, the closest to the end first:
+// those containing an upper case letter or an underscore, and those that
+// are called. Names being defined in the text are skipped.
+func identifiersNear(text string, n int) []string {
+	lines := strings.Split(text, "\n")
+	if len(lines) > maxSearchLines {
+		lines = lines[len(lines)-maxSearchLines:]
+	}
+	text = strings.Join(lines, "\n")
+
+	var names []string
+	seen := make(map[string]bool)
+	matches := identifier.FindAllStringIndex(text, -1)
+	for i := len(matches) - 1; i >= 0 && len(names) < n; i-- {
+		start, end := matches[i][0], matches[i][1]
+		name := text[start:end]
+		if seen[name] || commonWords[name] || definedBefore.MatchString(text[:start]) {
+			continue
+		}
+		called := end < len(text) && text[end] == '('
+		if !called && strings.ToLower(name) == name && !strings.Contains(name, "_") {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names
+}
+
+// searchCache caches the definitions found by searches.
+type searchCache struct {
+	mu      sync.Mutex
+	entries map[string]searchCacheEntry
+}
+
+type searchCacheEntry struct {
+	results []embeddings.EmbeddingsResult
+	fetched time.Time
+}
+
+// get returns the cached results of a search.
+func (c *searchCache) get(key string) ([]embeddings.EmbeddingsResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || time.Since(entry.fetched) >= searchContextTTL {
+		return nil, false
+	}
+	return entry.results, true
+}
+
+// put caches the results of a search, dropping expired results.
+func (c *searchCache) put(key string, results []embeddings.EmbeddingsResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]searchCacheEntry)
+	}
+	for k, entry := range c.entries {
+		if time.Since(entry.fetched) >= searchContextTTL {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = searchCacheEntry{results: results, fetched: time.Now()}
+}
+
+// searchDefinitions searches the repository of the file on Sourcegraph for
+// the definitions of the identifiers near the end of the query, such as the
+// text before the cursor. Identifiers without symbol results are searched
+// for as keywords. It returns up to count results, and nil if the
+// repository isn't known or the search fails.
+func (l *SourcegraphLLM) searchDefinitions(ctx context.Context, filename, query string, count int) []embeddings.EmbeddingsResult {
+	repo := l.repoFor(filename)
+	names := identifiersNear(query, maxSearchIdentifiers)
+	if l.EmbeddingsClient == nil || repo.Name == "" || len(names) == 0 || count <= 0 {
+		return nil
+	}
+	key := repo.Name + "\x00" + strings.Join(names, " ")
+	cached, ok := l.searchCache.get(key)
+	metrics.CacheLookups(l.Metrics).Inc("search", metrics.HitOrMiss(ok))
+	if ok {
+		return cached
+	}
+
+	ctx, cancel := l.withTimeout(ctx, "search")
+	defer cancel()
+	found, err := l.EmbeddingsClient.SearchSymbols(ctx, repo.Name, names, count)
+	if err != nil {
+		l.Logger.Debug("symbol search failed", "err", err)
+		return nil
+	}
+	defined := make(map[string]bool)
+	for _, result := range found {
+		defined[result.Symbol] = true
+	}
+	var undefined []string
+	for _, name := range names {
+		if !defined[name] {
+			undefined = append(undefined, name)
+		}
+	}
+	if len(undefined) > 0 && len(found) < count {
+		keywords, err := l.EmbeddingsClient.SearchKeywords(ctx, repo.Name, undefined, count-len(found))
+		if err != nil {
+			l.Logger.Debug("keyword search failed", "err", err)
+		}
+		found = append(found, keywords...)
+	}
+
+	results := make([]embeddings.EmbeddingsResult, len(found))
+	for i, result := range found {
+		results[i] = embeddings.EmbeddingsResult{
+			RepoName:  result.RepoName,
+			FileName:  result.FileName,
+			StartLine: result.StartLine,
+			EndLine:   result.EndLine,
+			Content:   result.Content,
+		}
+	}
+	l.searchCache.put(key, results)
+	return results
+}
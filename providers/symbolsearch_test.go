@@ -0,0 +1,76 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pjlast/llmsp/sourcegraph/embeddings"
+)
+
+func TestIdentifiersNear(t *testing.T) {
+	text := "package main\n\nfunc main() {\n\tcfg := config.Load()\n\tserver := NewServer(cfg, max_conns)\n\tfor i := range server.routes {"
+	want := []string{"max_conns", "NewServer", "Load"}
+	if got := identifiersNear(text, 5); !reflect.DeepEqual(got, want) {
+		t.Errorf("identifiersNear() == %q, want %q", got, want)
+	}
+	if got := identifiersNear(text, 1); !reflect.DeepEqual(got, want[:1]) {
+		t.Errorf("identifiersNear() with a limit of 1 == %q, want %q", got, want[:1])
+	}
+}
+
+func TestSearchDefinitions(t *testing.T) {
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Variables struct{ Query string }
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Error(err)
+		}
+		queries = append(queries, request.Variables.Query)
+		if strings.Contains(request.Variables.Query, "type:symbol") {
+			w.Write([]byte(`{"data": {"search": {"results": {"results": [{"__typename": "FileMatch",
+				"repository": {"name": "github.com/a/app"},
+				"file": {"path": "server.go", "content": "func NewServer() *Server {\n\treturn &Server{}\n}\n"},
+				"symbols": [{"name": "NewServer", "location": {"range": {"start": {"line": 0}}}}]}]}}}}`))
+			return
+		}
+		w.Write([]byte(`{"data": {"search": {"results": {"results": [{"__typename": "FileMatch",
+			"repository": {"name": "github.com/a/app"},
+			"file": {"path": "limits.go"},
+			"lineMatches": [{"preview": "const max_conns = 10", "lineNumber": 4}]}]}}}}`))
+	}))
+	defer server.Close()
+
+	l := &SourcegraphLLM{
+		EmbeddingsClient: embeddings.NewClient(server.URL, "token", server.Client()),
+		Repositories:     []Repository{{Root: "/src/app", Name: "github.com/a/app"}},
+	}
+	query := "server := NewServer(max_conns)"
+	want := []embeddings.EmbeddingsResult{
+		{RepoName: "github.com/a/app", FileName: "server.go", StartLine: 0, EndLine: 2, Content: "func NewServer() *Server {\n\treturn &Server{}\n}"},
+		{RepoName: "github.com/a/app", FileName: "limits.go", StartLine: 4, EndLine: 4, Content: "const max_conns = 10"},
+	}
+	if got := l.searchDefinitions(context.Background(), "file:///src/app/main.go", query, 5); !reflect.DeepEqual(got, want) {
+		t.Errorf("searchDefinitions() == %+v, want %+v", got, want)
+	}
+	if len(queries) != 2 || !strings.Contains(queries[1], `\b(max_conns)\b`) {
+		t.Errorf("searched %q, want a symbol search and a keyword search for max_conns", queries)
+	}
+
+	// Results are cached
+	l.searchDefinitions(context.Background(), "file:///src/app/main.go", query, 5)
+	if len(queries) != 2 {
+		t.Errorf("searched %d times, want the results of the second search cached", len(queries))
+	}
+
+	// Files outside of known repositories aren't searched
+	if got := l.searchDefinitions(context.Background(), "file:///tmp/main.go", query, 5); got != nil {
+		t.Errorf("searchDefinitions() outside of repositories == %+v, want nil", got)
+	}
+}
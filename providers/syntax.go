@@ -0,0 +1,109 @@
+package providers
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/pjlast/llmsp/claude"
+	"github.com/pjlast/llmsp/internal/documents"
+	"github.com/pjlast/llmsp/internal/syntax"
+	"github.com/sourcegraph/go-lsp"
+)
+
+// maxSymbolTokens is the maximum length of the signatures of referenced
+// symbols added to prompts.
+const maxSymbolTokens = 1000
+
+// parseDocument parses a Go document. It returns nil for documents in other
+// languages and documents that can't be parsed.
+func parseDocument(doc documents.Document) *syntax.File {
+	if determineLanguage(string(doc.URI)) != "Go" {
+		return nil
+	}
+	f, err := syntax.ParseGo(doc.Text)
+	if err != nil {
+		return nil
+	}
+	return f
+}
+
+// symbolRange returns the lines of the declaration containing the lines from
+// startLine to endLine of the document, if the syntax of the document is
+// known. Otherwise, the lines are returned unchanged.
+func (l *SourcegraphLLM) symbolRange(uri lsp.DocumentURI, startLine, endLine int) (int, int) {
+	doc, _ := l.Documents.Get(uri)
+	return declarationRange(doc, startLine, endLine)
+}
+
+// declarationRange is like symbolRange, for a given version of the document.
+func declarationRange(doc documents.Document, startLine, endLine int) (int, int) {
+	f := parseDocument(doc)
+	if f == nil {
+		return startLine, endLine
+	}
+	start, ok := f.Enclosing(startLine)
+	if !ok {
+		return startLine, endLine
+	}
+	if end, ok := f.Enclosing(endLine); !ok || end.Name != start.Name {
+		return startLine, endLine
+	}
+	return start.Line, start.EndLine
+}
+
+// symbolMessages returns messages with the signatures of the symbols used
+// between startLine and endLine of the document, which are declared in the
+// document itself or in the other open documents of its package. It returns
+// nil if the syntax of the document isn't known.
+func (l *SourcegraphLLM) symbolMessages(uri lsp.DocumentURI, startLine, endLine int) []claude.Message {
+	doc, _ := l.Documents.Get(uri)
+	f := parseDocument(doc)
+	if f == nil {
+		return nil
+	}
+
+	files := []*syntax.File{f}
+	for _, other := range l.Documents.All() {
+		if other.URI != uri && path.Dir(string(other.URI)) == path.Dir(string(uri)) {
+			if parsed := parseDocument(other); parsed != nil {
+				files = append(files, parsed)
+			}
+		}
+	}
+
+	// The code itself doesn't need to be described
+	enclosing, _ := f.Enclosing(startLine)
+	seen := map[string]bool{enclosing.Name: true}
+	var signatures []string
+	tokens := 0
+	for _, name := range f.References(startLine, endLine) {
+		for _, file := range files {
+			for _, symbol := range file.Lookup(name) {
+				if seen[symbol.Name] {
+					continue
+				}
+				seen[symbol.Name] = true
+				if tokens += getTokenLength(symbol.Signature); tokens > maxSymbolTokens {
+					break
+				}
+				signatures = append(signatures, symbol.Signature)
+			}
+		}
+	}
+	if len(signatures) == 0 {
+		return nil
+	}
+
+	return []claude.Message{
+		{
+			Speaker: claude.Human,
+			Text:    fmt.Sprintf("Here are the declarations of the symbols used in the code:\n```go\n%s\n```", strings.Join(signatures, "\n\n")),
+			Source:  &claude.Source{Kind: "symbols", File: strings.TrimPrefix(string(uri), "file://")},
+		},
+		{
+			Speaker: claude.Assistant,
+			Text:    "Ok.",
+		},
+	}
+}
@@ -0,0 +1,56 @@
+package providers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pjlast/llmsp/internal/documents"
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/go-lsp"
+)
+
+func TestSymbolContext(t *testing.T) {
+	uri := lsp.DocumentURI("file:///store/store.go")
+	l := &SourcegraphLLM{Documents: documents.FromMap(types.MemoryFileMap{
+		uri: `package store
+
+func Get(name string) User {
+	return lookup(name)
+}
+`,
+		"file:///store/user.go": `package store
+
+// User is a user.
+type User struct{ Name string }
+
+func lookup(name string) User { return User{Name: name} }
+`,
+		"file:///other/user.go":   "package other\n\ntype User struct{}\n",
+		"file:///store/notes.txt": "User",
+	})}
+
+	if start, end := l.symbolRange(uri, 3, 3); start != 2 || end != 4 {
+		t.Errorf("symbolRange(3, 3) == (%d, %d), want (2, 4)", start, end)
+	}
+	if start, end := l.symbolRange(uri, 0, 3); start != 0 || end != 3 {
+		t.Errorf("symbolRange(0, 3) == (%d, %d), want the lines unchanged", start, end)
+	}
+
+	messages := l.symbolMessages(uri, 2, 4)
+	if len(messages) != 2 {
+		t.Fatalf("symbolMessages() returned %d messages, want 2", len(messages))
+	}
+	text := messages[0].Text
+	for _, want := range []string{"// User is a user.\ntype User struct{ Name string }", "func lookup(name string) User"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("symbolMessages() == %q, want it to contain %q", text, want)
+		}
+	}
+	if strings.Contains(text, "func Get") || strings.Contains(text, "type User struct{}") {
+		t.Errorf("symbolMessages() == %q, want neither the code itself nor other packages", text)
+	}
+
+	if messages := l.symbolMessages("file:///store/notes.txt", 0, 0); messages != nil {
+		t.Errorf("symbolMessages() for a text file == %+v, want nil", messages)
+	}
+}
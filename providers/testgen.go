@@ -0,0 +1,161 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pjlast/llmsp/claude"
+	"github.com/pjlast/llmsp/internal/position"
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/go-lsp"
+)
+
+// testConvention describes where a language keeps its tests and how they are
+// written.
+type testConvention struct {
+	// FileName returns the name of the test file for the given base name and
+	// extension.
+	FileName func(base, ext string) string
+	// Framework describes the test framework and style to use.
+	Framework string
+}
+
+var testConventions = map[string]testConvention{
+	"Go": {
+		FileName:  func(base, ext string) string { return base + "_test" + ext },
+		Framework: "the standard library testing package, using table-driven tests where appropriate",
+	},
+	"Python": {
+		FileName:  func(base, ext string) string { return "test_" + base + ext },
+		Framework: "pytest",
+	},
+	"JavaScript": {
+		FileName:  func(base, ext string) string { return base + ".test" + ext },
+		Framework: "Jest",
+	},
+	"TypeScript": {
+		FileName:  func(base, ext string) string { return base + ".test" + ext },
+		Framework: "Jest",
+	},
+	"TypeScript React": {
+		FileName:  func(base, ext string) string { return base + ".test" + ext },
+		Framework: "Jest and React Testing Library",
+	},
+	"Java": {
+		FileName:  func(base, ext string) string { return base + "Test" + ext },
+		Framework: "JUnit 5",
+	},
+	"Ruby": {
+		FileName:  func(base, ext string) string { return base + "_spec" + ext },
+		Framework: "RSpec",
+	},
+	"PHP": {
+		FileName:  func(base, ext string) string { return base + "Test" + ext },
+		Framework: "PHPUnit",
+	},
+	"C#": {
+		FileName:  func(base, ext string) string { return base + "Tests" + ext },
+		Framework: "xUnit",
+	},
+	"Lua": {
+		FileName:  func(base, ext string) string { return base + "_spec" + ext },
+		Framework: "busted",
+	},
+}
+
+// testFileFor returns the URI of the test file for the given document, along
+// with a description of the test framework to use.
+func testFileFor(uri lsp.DocumentURI) (lsp.DocumentURI, string) {
+	dir, file := path.Split(string(uri))
+	ext := path.Ext(file)
+	base := strings.TrimSuffix(file, ext)
+
+	convention, ok := testConventions[determineLanguage(string(uri))]
+	if !ok {
+		return lsp.DocumentURI(dir + base + "_test" + ext), "the most common test framework for the language"
+	}
+	return lsp.DocumentURI(dir + convention.FileName(base, ext)), convention.Framework
+}
+
+// generateTests generates unit tests for function, found from startLine to
+// endLine of the document, and returns the workspace edit that writes them to
+// the test file, creating it if necessary.
+func (l *SourcegraphLLM) generateTests(ctx context.Context, filename lsp.DocumentURI, function string, startLine, endLine int) (*types.WorkspaceEdit, error) {
+	testURI, framework := testFileFor(filename)
+	language := determineLanguage(string(filename))
+	codeFence := fmt.Sprintf("```%s\n", strings.ToLower(language))
+
+	doc, exists := l.Documents.Get(testURI)
+	existing := doc.Text
+	if !exists {
+		if data, err := os.ReadFile(strings.TrimPrefix(string(testURI), "file://")); err == nil {
+			existing, exists = string(data), true
+		}
+	}
+
+	instruction := fmt.Sprintf(`Write unit tests for the following %s code using %s:
+%s%s
+`+"```"+`
+
+The tests go in the file `+"`%s`"+`. Return the complete contents of the test file and nothing else.`,
+		language, framework, codeFence, function, path.Base(string(testURI)))
+	if !exists {
+		if example, contents, ok := exampleTestFile(l.projectRoot(filename), language); ok {
+			instruction += fmt.Sprintf(`
+Follow the conventions of the existing tests in the project, like those in `+"`%s`"+`:
+%s%s
+`+"```", path.Base(example), codeFence, contents)
+		}
+	}
+	if exists {
+		instruction += fmt.Sprintf(`
+The test file already exists. Keep the existing tests and match their style. Here are its current contents:
+%s%s
+`+"```", codeFence, existing)
+	}
+
+	input := append(l.symbolMessages(filename, startLine, endLine),
+		claude.Message{
+			Speaker: claude.Human,
+			Text:    instruction,
+		},
+		claude.Message{
+			Speaker: claude.Assistant,
+			Text:    codeFence,
+		},
+	)
+	params := l.completionParameters(editModel, l.AddContext(ctx, editModel, input, string(filename), l.Documents.Text(filename)))
+	completion, err := l.ClaudeClient.GetCompletion(ctx, params, true)
+	if err != nil {
+		return nil, err
+	}
+	tests := extractCode(completion) + "\n"
+
+	if !exists {
+		return &types.WorkspaceEdit{
+			DocumentChanges: createFileChanges(testURI, tests, &types.CreateFileOptions{IgnoreIfExists: true}),
+		}, nil
+	}
+
+	end := position.End(existing)
+	return &types.WorkspaceEdit{
+		DocumentChanges: []any{
+			types.TextDocumentEdit{
+				TextDocument: lsp.VersionedTextDocumentIdentifier{
+					TextDocumentIdentifier: lsp.TextDocumentIdentifier{
+						URI: testURI,
+					},
+				},
+				Edits: []lsp.TextEdit{
+					{
+						Range:   lsp.Range{End: end},
+						NewText: tests,
+					},
+				},
+			},
+		},
+	}, nil
+}
@@ -0,0 +1,27 @@
+package providers
+
+import (
+	"testing"
+
+	"github.com/sourcegraph/go-lsp"
+)
+
+func TestTestFileFor(t *testing.T) {
+	tests := []struct {
+		uri  lsp.DocumentURI
+		want lsp.DocumentURI
+	}{
+		{"file:///src/foo.go", "file:///src/foo_test.go"},
+		{"file:///src/foo.py", "file:///src/test_foo.py"},
+		{"file:///src/foo.ts", "file:///src/foo.test.ts"},
+		{"file:///src/Foo.java", "file:///src/FooTest.java"},
+		{"file:///src/foo.rb", "file:///src/foo_spec.rb"},
+		{"file:///src/foo.zig", "file:///src/foo_test.zig"},
+	}
+
+	for _, test := range tests {
+		if got, _ := testFileFor(test.uri); got != test.want {
+			t.Errorf("testFileFor(%q) == %q, want %q", test.uri, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package providers
+
+import (
+	"context"
+	"time"
+)
+
+// defaultTimeouts are the timeouts used unless the settings configure them.
+var defaultTimeouts = map[string]time.Duration{
+	// embeddings bounds embeddings searches, so that a slow search leaves
+	// time for the completion that needs the context
+	"embeddings": 5 * time.Second,
+	// search bounds the searches for definitions used as context when
+	// embeddings can't be searched
+	"search": 5 * time.Second,
+	// request bounds every request to Sourcegraph, up to the start of the
+	// response for streamed completions
+	"request": 30 * time.Second,
+}
+
+// timeout returns the timeout configured for the feature, falling back to
+// its default. Zero means no timeout.
+func (l *SourcegraphLLM) timeout(feature string) time.Duration {
+	if timeout, ok := l.Timeouts[feature]; ok {
+		return timeout
+	}
+	return defaultTimeouts[feature]
+}
+
+// withTimeout returns a context that is canceled once the timeout configured
+// for the feature has passed. Features without a timeout are only canceled
+// when ctx is.
+func (l *SourcegraphLLM) withTimeout(ctx context.Context, feature string) (context.Context, context.CancelFunc) {
+	if timeout := l.timeout(feature); timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
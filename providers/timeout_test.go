@@ -0,0 +1,45 @@
+package providers
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWithTimeout(t *testing.T) {
+	l := &SourcegraphLLM{
+		Timeouts: map[string]time.Duration{"docstring": time.Millisecond},
+	}
+
+	ctx, cancel := l.withTimeout(context.Background(), "docstring")
+	defer cancel()
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("expected the context to time out")
+	}
+
+	ctx, cancel = l.withTimeout(context.Background(), "todos")
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("expected no deadline for a feature without a timeout")
+	}
+	cancel()
+	if ctx.Err() == nil {
+		t.Error("expected the context to be canceled")
+	}
+}
+
+func TestDefaultTimeouts(t *testing.T) {
+	l := &SourcegraphLLM{
+		Timeouts: map[string]time.Duration{"request": 0},
+	}
+
+	if got := l.timeout("embeddings"); got != defaultTimeouts["embeddings"] {
+		t.Errorf("got embeddings timeout %v, want the default %v", got, defaultTimeouts["embeddings"])
+	}
+	ctx, cancel := l.withTimeout(context.Background(), "request")
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("expected no deadline for a timeout disabled by the settings")
+	}
+}
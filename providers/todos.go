@@ -0,0 +1,133 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/pjlast/llmsp/internal/documents"
+	"github.com/pjlast/llmsp/internal/position"
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/go-lsp"
+)
+
+// workspaceTODOs returns the TODO comments of the open documents, ordered by
+// document and line.
+func (l *SourcegraphLLM) workspaceTODOs() []types.TODOItem {
+	docs := l.Documents.All()
+	sort.Slice(docs, func(i, j int) bool { return docs[i].URI < docs[j].URI })
+
+	items := []types.TODOItem{}
+	for _, doc := range docs {
+		marker := commentPrefix(l.documentLanguage(doc.URI)) + " TODO"
+		for i := 0; i < doc.LineCount(); i++ {
+			line := doc.Line(i)
+			if index := strings.Index(line, marker); index != -1 {
+				items = append(items, types.TODOItem{
+					URI:  doc.URI,
+					Line: i,
+					Text: strings.TrimSpace(line[index+len(marker)-len("TODO"):]),
+				})
+			}
+		}
+	}
+	return items
+}
+
+// todoRange is a range of lines of a document whose TODOs are implemented
+// together.
+type todoRange struct {
+	uri        lsp.DocumentURI
+	start, end int
+}
+
+// implementWorkspaceTODOs implements the chosen TODOs, and returns an edit of
+// all the documents they are in. TODOs are implemented with the whole function
+// they are in, and TODOs of the same function are implemented at once.
+func (l *SourcegraphLLM) implementWorkspaceTODOs(ctx context.Context, arguments []any) (*types.WorkspaceEdit, error) {
+	data, err := json.Marshal(arguments)
+	if err != nil {
+		return nil, err
+	}
+	var chosen []types.TODOItem
+	if err := json.Unmarshal(data, &chosen); err != nil {
+		return nil, err
+	}
+
+	var ranges []todoRange
+	for _, item := range chosen {
+		doc, ok := l.snapshotDocument(ctx, item.URI)
+		if !ok || item.Line >= doc.LineCount() {
+			continue
+		}
+		r := l.todoRange(doc, item.Line)
+		if !merge(ranges, r) {
+			ranges = append(ranges, r)
+		}
+	}
+
+	edits := make(map[lsp.DocumentURI][]lsp.TextEdit)
+	var uris []lsp.DocumentURI
+	for _, r := range ranges {
+		text := l.snapshotText(ctx, r.uri)
+		implemented, err := l.implementTODOs(ctx, string(r.uri), text, getFileSnippet(text, r.start, r.end))
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := edits[r.uri]; !ok {
+			uris = append(uris, r.uri)
+		}
+		edits[r.uri] = append(edits[r.uri], lsp.TextEdit{
+			Range: lsp.Range{
+				Start: lsp.Position{Line: r.start},
+				End:   position.LineEnd(text, r.end),
+			},
+			NewText: implemented,
+		})
+	}
+
+	edit := &types.WorkspaceEdit{DocumentChanges: []any{}}
+	for _, uri := range uris {
+		edit.DocumentChanges = append(edit.DocumentChanges, types.TextDocumentEdit{
+			TextDocument: lsp.VersionedTextDocumentIdentifier{
+				TextDocumentIdentifier: lsp.TextDocumentIdentifier{
+					URI: uri,
+				},
+			},
+			Edits: edits[uri],
+		})
+	}
+	return edit, nil
+}
+
+// todoRange returns the lines of the function containing the TODO on the
+// given line, or just the line if it isn't in a function.
+func (l *SourcegraphLLM) todoRange(doc documents.Document, line int) todoRange {
+	if parseDocument(doc) != nil {
+		start, end := declarationRange(doc, line, line)
+		return todoRange{uri: doc.URI, start: start, end: end}
+	}
+	if header, ok := enclosingFunction(doc, line); ok {
+		if end := functionEnd(doc, header); end >= line {
+			return todoRange{uri: doc.URI, start: header, end: end}
+		}
+	}
+	return todoRange{uri: doc.URI, start: line, end: line}
+}
+
+// merge extends the range of ranges that overlaps r, if any, to include r.
+func merge(ranges []todoRange, r todoRange) bool {
+	for i, other := range ranges {
+		if other.uri == r.uri && other.start <= r.end && r.start <= other.end {
+			if r.start < other.start {
+				ranges[i].start = r.start
+			}
+			if r.end > other.end {
+				ranges[i].end = r.end
+			}
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package providers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pjlast/llmsp/claude"
+	"github.com/pjlast/llmsp/internal/documents"
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/go-lsp"
+)
+
+func TestWorkspaceTODOs(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write([]byte(`{"data": {"completions": "\nimplemented\n` + "```" + `"}}`))
+	}))
+	defer server.Close()
+
+	l := &SourcegraphLLM{
+		ClaudeClient: claude.NewClient(server.URL, "", server.Client()),
+		Documents: documents.FromMap(types.MemoryFileMap{
+			"file:///src/a.go": "package a\n\nfunc A() int {\n\t// TODO: compute\n\t// TODO(me): return it\n\treturn 0\n}\n",
+			"file:///src/b.py": "def b():\n    # TODO: implement\n    pass\n",
+			"file:///src/c.go": "package c\n",
+		}),
+	}
+
+	items := l.workspaceTODOs()
+	want := []types.TODOItem{
+		{URI: "file:///src/a.go", Line: 3, Text: "TODO: compute"},
+		{URI: "file:///src/a.go", Line: 4, Text: "TODO(me): return it"},
+		{URI: "file:///src/b.py", Line: 1, Text: "TODO: implement"},
+	}
+	if !reflect.DeepEqual(items, want) {
+		t.Fatalf("got TODOs %+v, want %+v", items, want)
+	}
+
+	// Arguments are sent back by the client as JSON objects
+	arguments := []any{
+		map[string]any{"uri": "file:///src/a.go", "line": 3.0},
+		map[string]any{"uri": "file:///src/a.go", "line": 4.0},
+		map[string]any{"uri": "file:///src/b.py", "line": 1.0},
+	}
+	edit, err := l.implementWorkspaceTODOs(context.Background(), arguments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requests.Load() != 2 {
+		t.Errorf("got %d requests, want the TODOs of a function implemented at once", requests.Load())
+	}
+	if len(edit.DocumentChanges) != 2 {
+		t.Fatalf("got %d document changes, want 2", len(edit.DocumentChanges))
+	}
+	wantRanges := map[lsp.DocumentURI]lsp.Range{
+		"file:///src/a.go": {Start: lsp.Position{Line: 2}, End: lsp.Position{Line: 6, Character: 1}},
+		"file:///src/b.py": {Start: lsp.Position{Line: 0}, End: lsp.Position{Line: 2, Character: 8}},
+	}
+	for _, change := range edit.DocumentChanges {
+		textEdit := change.(types.TextDocumentEdit)
+		if len(textEdit.Edits) != 1 || textEdit.Edits[0].Range != wantRanges[textEdit.TextDocument.URI] || textEdit.Edits[0].NewText != "implemented" {
+			t.Errorf("got edits %+v of %s, want the function replaced", textEdit.Edits, textEdit.TextDocument.URI)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pjlast/llmsp/claude"
+)
+
+const (
+	// maxToolIterations is the number of tool requests the LLM may make before
+	// it is forced to answer.
+	maxToolIterations = 3
+	// maxToolReadLines is the maximum number of lines returned by read_file.
+	maxToolReadLines = 200
+	// maxToolSearchResults is the maximum number of results returned by search.
+	maxToolSearchResults = 20
+
+	toolPrefix = "TOOL:"
+)
+
+const toolInstructions = `Before answering, you may request more information using tools. To use a tool, reply with a single line in the format:
+TOOL: {"tool": "read_file", "path": "path/to/file", "startLine": 1, "endLine": 50}
+or
+TOOL: {"tool": "search", "query": "what to search for"}
+
+read_file returns the given lines of a file in the repository. search returns code from the repository related to the query.
+Only request a tool if you need it to answer accurately. When you have enough information, answer normally without a TOOL line.`
+
+// toolRequest is a structured tool invocation emitted by the LLM.
+type toolRequest struct {
+	Tool      string `json:"tool"`
+	Path      string `json:"path,omitempty"`
+	StartLine int    `json:"startLine,omitempty"`
+	EndLine   int    `json:"endLine,omitempty"`
+	Query     string `json:"query,omitempty"`
+}
+
+// parseToolRequest looks for a tool request in an LLM response. It returns the
+// request along with the response text up to and including the request line.
+func parseToolRequest(text string) (*toolRequest, string, bool) {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, toolPrefix) {
+			continue
+		}
+
+		var req toolRequest
+		if err := json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(line, toolPrefix))), &req); err != nil {
+			continue
+		}
+		return &req, strings.Join(lines[:i+1], "\n"), true
+	}
+
+	return nil, "", false
+}
+
+// withToolInstructions inserts the tool usage instructions in front of input.
+func withToolInstructions(input []claude.Message) []claude.Message {
+	return append([]claude.Message{
+		{
+			Speaker: claude.Human,
+			Text:    toolInstructions,
+		},
+		{
+			Speaker: claude.Assistant,
+			Text:    "Ok.",
+		},
+	}, input...)
+}
+
+// completeWithTools runs a completion, fulfilling any tool requests made by
+// the LLM before returning its final answer. messages must end with an empty
+// Assistant message.
+func (l *SourcegraphLLM) completeWithTools(ctx context.Context, messages []claude.Message) (string, error) {
+	for i := 0; i < maxToolIterations; i++ {
+		completion, err := l.ClaudeClient.GetCompletion(ctx, l.completionParameters(chatModel, messages), false)
+		if err != nil {
+			return "", err
+		}
+
+		req, request, ok := parseToolRequest(completion)
+		if !ok {
+			return completion, nil
+		}
+
+		result, source := l.runTool(ctx, req)
+		if i == maxToolIterations-1 {
+			result += "\n\nYou can't use any more tools. Answer with the information you have."
+		}
+		messages = append(messages[:len(messages)-1],
+			claude.Message{
+				Speaker: claude.Assistant,
+				Text:    request,
+			},
+			claude.Message{
+				Speaker: claude.Human,
+				Text:    fmt.Sprintf("Tool result:\n%s", result),
+				Source:  source,
+			},
+			claude.Message{
+				Speaker: claude.Assistant,
+				Text:    "",
+			})
+	}
+
+	return l.ClaudeClient.GetCompletion(ctx, l.completionParameters(chatModel, messages), false)
+}
+
+// runTool fulfills a single tool request and returns the result as text,
+// along with the source of the file read, if any.
+func (l *SourcegraphLLM) runTool(ctx context.Context, req *toolRequest) (string, *claude.Source) {
+	switch req.Tool {
+	case "read_file":
+		filename, content, err := l.readFile(req.Path)
+		if err != nil {
+			return fmt.Sprintf("Error: %v", err), nil
+		}
+		lines := strings.Split(content, "\n")
+		start, end := req.StartLine, req.EndLine
+		if start < 1 {
+			start = 1
+		}
+		if end < start || end > len(lines) {
+			end = len(lines)
+		}
+		if start > len(lines) {
+			return fmt.Sprintf("Error: %s only has %d lines", req.Path, len(lines)), nil
+		}
+		if end-start+1 > maxToolReadLines {
+			end = start + maxToolReadLines - 1
+		}
+		source := &claude.Source{Kind: "file", File: filename, StartLine: start, EndLine: end}
+		return fmt.Sprintf("Lines %d-%d of `%s`:\n%s", start, end, req.Path, numberLines(strings.Join(lines[start-1:end], "\n"), start)), source
+
+	case "search":
+		if req.Query == "" {
+			return "Error: empty search query", nil
+		}
+		return l.search(ctx, req.Query), nil
+
+	default:
+		return fmt.Sprintf("Error: unknown tool %q", req.Tool), nil
+	}
+}
+
+// readFile returns the name and contents of the file at path. Open documents
+// are read from the document store; other files are read from disk, as long
+// as they are within a workspace folder once symbolic links are resolved.
+// Relative paths are resolved against the workspace folder containing the
+// file. Ignored files can't be read.
+func (l *SourcegraphLLM) readFile(path string) (string, string, error) {
+	path = strings.TrimPrefix(path, "file://")
+	if uri, ok := l.findOpenDocument(path); ok {
+		if l.ignored(string(uri)) {
+			return "", "", fmt.Errorf("%s is ignored", path)
+		}
+		return string(uri), l.Documents.Text(uri), nil
+	}
+
+	roots := l.workspaceFolderPaths()
+	if !filepath.IsAbs(path) {
+		resolved := filepath.Join(roots[0], path)
+		for _, root := range roots {
+			if _, err := os.Stat(filepath.Join(root, path)); err == nil {
+				resolved = filepath.Join(root, path)
+				break
+			}
+		}
+		path = resolved
+	}
+	path = filepath.Clean(path)
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", "", err
+	}
+	if !withinAny(roots, target) {
+		return "", "", fmt.Errorf("%s is outside of the workspace", path)
+	}
+	if l.ignored(path) || l.ignored(target) {
+		return "", "", fmt.Errorf("%s is ignored", path)
+	}
+
+	data, err := os.ReadFile(target)
+	if err != nil {
+		return "", "", err
+	}
+	return path, string(data), nil
+}
+
+// withinAny reports whether path is within one of the directories, once
+// their symbolic links are resolved.
+func withinAny(dirs []string, path string) bool {
+	for _, dir := range dirs {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			dir = resolved
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// search looks up code related to query using embeddings search if available,
+// and falls back to a plain text search of the open documents otherwise.
+func (l *SourcegraphLLM) search(ctx context.Context, query string) string {
+	var results []string
+	embs, err := l.searchEmbeddings(ctx, "", query, 5, 0)
+	if err == nil && embs != nil {
+		for _, embedding := range embs.CodeResults {
+			results = append(results, fmt.Sprintf("`%s` (lines %d-%d):\n%s", embedding.FileName, embedding.StartLine, embedding.EndLine, embedding.Content))
+		}
+	}
+
+	if len(results) == 0 {
+		lowerQuery := strings.ToLower(query)
+		for _, doc := range l.Documents.All() {
+			if l.ignored(string(doc.URI)) {
+				continue
+			}
+			for i, line := range strings.Split(doc.Text, "\n") {
+				if len(results) == maxToolSearchResults {
+					break
+				}
+				if strings.Contains(strings.ToLower(line), lowerQuery) {
+					results = append(results, fmt.Sprintf("%s:%d: %s", strings.TrimPrefix(string(doc.URI), "file://"), i+1, strings.TrimSpace(line)))
+				}
+			}
+		}
+	}
+
+	if len(results) == 0 {
+		return "No results."
+	}
+	return strings.Join(results, "\n")
+}
@@ -0,0 +1,87 @@
+package providers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pjlast/llmsp/internal/documents"
+	"github.com/sourcegraph/go-lsp"
+)
+
+func TestParseToolRequest(t *testing.T) {
+	text := `I need to look at the handler first.
+TOOL: {"tool": "read_file", "path": "lsp/lsp.go", "startLine": 10, "endLine": 20}
+Some trailing text.`
+
+	req, request, ok := parseToolRequest(text)
+	if !ok {
+		t.Fatal("expected a tool request")
+	}
+	if req.Tool != "read_file" || req.Path != "lsp/lsp.go" || req.StartLine != 10 || req.EndLine != 20 {
+		t.Errorf("unexpected tool request %+v", req)
+	}
+	if want := "I need to look at the handler first.\nTOOL: {\"tool\": \"read_file\", \"path\": \"lsp/lsp.go\", \"startLine\": 10, \"endLine\": 20}"; request != want {
+		t.Errorf("request == %q, want %q", request, want)
+	}
+
+	if _, _, ok := parseToolRequest("The answer is 42."); ok {
+		t.Error("expected no tool request")
+	}
+}
+
+func TestRunToolReadFileIgnored(t *testing.T) {
+	l := &SourcegraphLLM{
+		Documents:     documents.NewStore(),
+		ContextIgnore: []string{".env", "tools.go"},
+	}
+	l.loadIgnoreRules()
+	l.Documents.Open("file:///src/.env", "TOKEN=secret", 1)
+	l.Documents.Open("file:///src/main.go", "package main", 1)
+
+	for _, path := range []string{".env", "tools.go"} {
+		result, source := l.runTool(context.Background(), &toolRequest{Tool: "read_file", Path: path})
+		if !strings.HasPrefix(result, "Error:") || source != nil {
+			t.Errorf("read_file %s == %q, want an error", path, result)
+		}
+	}
+
+	result, source := l.runTool(context.Background(), &toolRequest{Tool: "read_file", Path: "main.go"})
+	if !strings.Contains(result, "package main") {
+		t.Errorf("read_file main.go == %q, want its contents", result)
+	}
+	if source == nil || source.Kind != "file" || source.File != "file:///src/main.go" || source.StartLine != 1 {
+		t.Errorf("read_file main.go source == %+v, want the file", source)
+	}
+}
+
+func TestReadFileWorkspaceFolders(t *testing.T) {
+	first, second, outside := t.TempDir(), t.TempDir(), t.TempDir()
+	write := func(path, text string) {
+		if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(second, "server.go"), "package server")
+	write(filepath.Join(outside, "secret.txt"), "secret")
+	if err := os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(first, "link.txt")); err != nil {
+		t.Skip("symbolic links aren't supported:", err)
+	}
+
+	l := &SourcegraphLLM{
+		Documents:        documents.NewStore(),
+		WorkspaceFolders: []lsp.DocumentURI{lsp.DocumentURI("file://" + first), lsp.DocumentURI("file://" + second)},
+	}
+	l.loadIgnoreRules()
+
+	if filename, text, err := l.readFile("server.go"); err != nil || text != "package server" || filename != filepath.Join(second, "server.go") {
+		t.Errorf("readFile(server.go) == %q, %q, %v, want the file of the second folder", filename, text, err)
+	}
+	for _, path := range []string{"link.txt", filepath.Join(outside, "secret.txt"), "../" + filepath.Base(outside) + "/secret.txt"} {
+		if _, text, err := l.readFile(path); err == nil {
+			t.Errorf("readFile(%s) == %q, want an error", path, text)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/pjlast/llmsp/claude"
+	"github.com/pjlast/llmsp/internal/language"
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/go-lsp"
+)
+
+// translate rewrites lines startLine through endLine of the document in the
+// target language, which is a language name or extension. The translation is
+// returned as an edit creating a new untitled document, the document itself
+// is left untouched.
+func (l *SourcegraphLLM) translate(ctx context.Context, filename lsp.DocumentURI, startLine, endLine int, target string) (*types.WorkspaceEdit, error) {
+	targetLanguage := language.ByName(target)
+	if targetLanguage == "" {
+		// Let the LLM make sense of languages we don't know
+		targetLanguage = strings.TrimSpace(target)
+	}
+	if targetLanguage == "" {
+		return nil, fmt.Errorf("expected a target language")
+	}
+	snippet, err := l.documentLines(filename, startLine, endLine)
+	if err != nil {
+		return nil, err
+	}
+	sourceLanguage := l.documentLanguage(filename)
+	codeFence := fmt.Sprintf("```%s\n", strings.ToLower(targetLanguage))
+
+	input := append(l.symbolMessages(filename, startLine, endLine),
+		claude.Message{
+			Speaker: claude.Human,
+			Text: fmt.Sprintf(`Translate the following %s code to %s:
+`+"```%s"+`
+%s
+`+"```"+`
+
+Keep its behavior and names, but write idiomatic %s using its standard library. Return only the %s code.`,
+				sourceLanguage, targetLanguage, strings.ToLower(sourceLanguage), snippet, targetLanguage, targetLanguage),
+		},
+		claude.Message{
+			Speaker: claude.Assistant,
+			Text:    codeFence,
+		},
+	)
+	params := l.completionParameters(editModel, l.AddContext(ctx, editModel, input, string(filename), l.Documents.Text(filename)))
+	completion, err := l.ClaudeClient.GetCompletion(ctx, params, true)
+	if err != nil {
+		return nil, err
+	}
+
+	uri := translationURI(filename, targetLanguage)
+	return &types.WorkspaceEdit{
+		DocumentChanges: createFileChanges(uri, extractCode(completion)+"\n", nil),
+	}, nil
+}
+
+// translationURI returns the URI of the untitled document holding the
+// translation of a document, named after the document with the extension of
+// the target language, e.g. untitled:main.py for main.go.
+func translationURI(filename lsp.DocumentURI, targetLanguage string) lsp.DocumentURI {
+	base := path.Base(string(filename))
+	return lsp.DocumentURI("untitled:" + strings.TrimSuffix(base, path.Ext(base)) + language.Extension(targetLanguage))
+}
@@ -0,0 +1,94 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pjlast/llmsp/claude"
+	"github.com/pjlast/llmsp/internal/documents"
+	"github.com/pjlast/llmsp/internal/replay"
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/go-lsp"
+)
+
+func TestTranslate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data": {"completions": "def add(a, b):\n    return a + b\n` + "```" + `\nThis is the translation."}}`))
+	}))
+	defer server.Close()
+
+	source := lsp.DocumentURI("file:///src/add.go")
+	l := &SourcegraphLLM{
+		ClaudeClient: claude.NewClient(server.URL, "", server.Client()),
+		Documents: documents.FromMap(types.MemoryFileMap{
+			source: "package add\n\nfunc add(a, b int) int {\n\treturn a + b\n}\n",
+		}),
+	}
+	edit, err := l.translate(context.Background(), source, 2, 4, "python")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(edit.DocumentChanges) != 2 {
+		t.Fatalf("got %d document changes, want a new document and its text", len(edit.DocumentChanges))
+	}
+	create, ok := edit.DocumentChanges[0].(types.CreateFile)
+	if !ok || create.URI != "untitled:add.py" {
+		t.Errorf("got %+v, want to create untitled:add.py", edit.DocumentChanges[0])
+	}
+	textEdit, ok := edit.DocumentChanges[1].(types.TextDocumentEdit)
+	if !ok || textEdit.TextDocument.URI != "untitled:add.py" {
+		t.Fatalf("got %+v, want an edit of untitled:add.py", edit.DocumentChanges[1])
+	}
+	if got := textEdit.Edits[0].NewText; got != "def add(a, b):\n    return a + b\n" {
+		t.Errorf("got translation %q", got)
+	}
+}
+
+func TestTranslateReplay(t *testing.T) {
+	url, token, client := replay.Client(t, "translate")
+	source := lsp.DocumentURI("file:///src/add.go")
+	l := &SourcegraphLLM{
+		ClaudeClient: claude.NewClient(url, token, client),
+		Documents: documents.FromMap(types.MemoryFileMap{
+			source: "package add\n\nfunc add(a, b int) int {\n\treturn a + b\n}\n",
+		}),
+	}
+	edit, err := l.translate(context.Background(), source, 2, 4, "python")
+	if err != nil {
+		t.Fatal(err)
+	}
+	textEdit, ok := edit.DocumentChanges[1].(types.TextDocumentEdit)
+	if !ok || textEdit.Edits[0].NewText != "def add(a, b):\n    return a + b\n" {
+		t.Errorf("got %+v, want the recorded translation", edit.DocumentChanges[1])
+	}
+}
+
+func TestTranslateOutOfRange(t *testing.T) {
+	source := lsp.DocumentURI("file:///src/add.go")
+	l := &SourcegraphLLM{
+		Documents: documents.FromMap(types.MemoryFileMap{source: "package add\n"}),
+	}
+	// Lines past the end of the document, e.g. of an outdated version, and
+	// documents that aren't open are errors, not panics
+	if _, err := l.translate(context.Background(), source, 5, 9, "python"); !errors.Is(err, documents.ErrLineOutOfRange) {
+		t.Errorf("translating lines past the end returned %v, want %v", err, documents.ErrLineOutOfRange)
+	}
+	if _, err := l.translate(context.Background(), "file:///src/closed.go", 0, 1, "python"); !errors.Is(err, documents.ErrNotOpen) {
+		t.Errorf("translating a closed document returned %v, want %v", err, documents.ErrNotOpen)
+	}
+}
+
+func TestTranslationURI(t *testing.T) {
+	for target, want := range map[string]lsp.DocumentURI{
+		"TypeScript": "untitled:add.ts",
+		"Klingon":    "untitled:add",
+	} {
+		if got := translationURI("file:///src/add.go", target); got != want {
+			t.Errorf("translationURI(%q) == %q, want %q", target, got, want)
+		}
+	}
+}
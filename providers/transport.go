@@ -0,0 +1,51 @@
+package providers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/pjlast/llmsp/types"
+)
+
+// newHTTPClient returns the HTTP client shared by the clients of the
+// Sourcegraph instance and sourcegraph.com. It uses the configured proxy, or
+// the one of the environment (HTTPS_PROXY and so on), and trusts the extra CA
+// certificates in addition to the ones of the system.
+func newHTTPClient(settings *types.SourcegraphSettings) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if settings.Proxy != "" {
+		proxyURL, err := url.Parse(settings.Proxy)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", settings.Proxy)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if len(settings.CACertificates) > 0 || settings.InsecureSkipVerify {
+		tlsConfig := &tls.Config{InsecureSkipVerify: settings.InsecureSkipVerify}
+		if len(settings.CACertificates) > 0 {
+			pool, err := x509.SystemCertPool()
+			if err != nil {
+				pool = x509.NewCertPool()
+			}
+			for _, path := range settings.CACertificates {
+				pem, err := os.ReadFile(path)
+				if err != nil {
+					return nil, fmt.Errorf("reading CA certificates: %w", err)
+				}
+				if !pool.AppendCertsFromPEM(pem) {
+					return nil, fmt.Errorf("no PEM certificates found in %s", path)
+				}
+			}
+			tlsConfig.RootCAs = pool
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
@@ -0,0 +1,85 @@
+package providers
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pjlast/llmsp/types"
+)
+
+func TestHTTPClientTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	certFile := filepath.Join(t.TempDir(), "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(certFile, cert, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		settings types.SourcegraphSettings
+		wantErr  bool
+	}{
+		{"untrusted", types.SourcegraphSettings{}, true},
+		{"CA certificates", types.SourcegraphSettings{CACertificates: []string{certFile}}, false},
+		{"insecure", types.SourcegraphSettings{InsecureSkipVerify: true}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, err := newHTTPClient(&test.settings)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := client.Get(server.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if (err != nil) != test.wantErr {
+				t.Errorf("got error %v, want error: %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestHTTPClientProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+	}))
+	defer proxy.Close()
+
+	client, err := newHTTPClient(&types.SourcegraphSettings{Proxy: proxy.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get("http://sourcegraph.example.com/.api/graphql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if proxied != "http://sourcegraph.example.com/.api/graphql" {
+		t.Errorf("got proxied request %q", proxied)
+	}
+}
+
+func TestHTTPClientInvalidSettings(t *testing.T) {
+	notPEM := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, settings := range []types.SourcegraphSettings{
+		{Proxy: "proxy:3128"},
+		{CACertificates: []string{filepath.Join(t.TempDir(), "missing.pem")}},
+		{CACertificates: []string{notPEM}},
+	} {
+		if _, err := newHTTPClient(&settings); err == nil {
+			t.Errorf("expected an error for %+v", settings)
+		}
+	}
+}
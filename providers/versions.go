@@ -0,0 +1,143 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/pjlast/llmsp/internal/documents"
+	"github.com/pjlast/llmsp/internal/position"
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/go-lsp"
+)
+
+// errStaleEdit is returned when a document changed in the range of an edit
+// while the edit was being computed.
+var errStaleEdit = errors.New("the document changed while the edit was being computed")
+
+type snapshotKey struct{}
+
+// withSnapshot returns a context recording the current versions of the open
+// documents. Edits computed under the context are based on these versions.
+func (l *SourcegraphLLM) withSnapshot(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(snapshotKey{}).(map[lsp.DocumentURI]int); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, snapshotKey{}, l.Documents.Versions())
+}
+
+// snapshotVersions returns the document versions recorded by withSnapshot.
+func snapshotVersions(ctx context.Context) map[lsp.DocumentURI]int {
+	versions, _ := ctx.Value(snapshotKey{}).(map[lsp.DocumentURI]int)
+	return versions
+}
+
+// snapshotText returns the text of the document at the version recorded by
+// withSnapshot, which the ranges of edits computed under ctx must be based
+// on. It returns the current text if no version was recorded, or if the
+// version is no longer known, in which case versionEdit rejects the edit.
+func (l *SourcegraphLLM) snapshotText(ctx context.Context, uri lsp.DocumentURI) string {
+	doc, _ := l.snapshotDocument(ctx, uri)
+	return doc.Text
+}
+
+// snapshotDocument is like snapshotText, but returns the document. It
+// reports whether the document is open.
+func (l *SourcegraphLLM) snapshotDocument(ctx context.Context, uri lsp.DocumentURI) (documents.Document, bool) {
+	if version, ok := snapshotVersions(ctx)[uri]; ok {
+		if doc, ok := l.Documents.Snapshot(uri, version); ok {
+			return doc, true
+		}
+	}
+	return l.Documents.Get(uri)
+}
+
+// editVersions returns the document versions of the text document edits of
+// an edit.
+func editVersions(edit types.WorkspaceEdit) map[lsp.DocumentURI]int {
+	versions := make(map[lsp.DocumentURI]int)
+	for _, change := range edit.DocumentChanges {
+		if change, ok := change.(types.TextDocumentEdit); ok {
+			versions[change.TextDocument.URI] = change.TextDocument.Version
+		}
+	}
+	return versions
+}
+
+// versionEdit returns a copy of the edit sent with the current versions of
+// the documents it changes, so that clients can refuse to apply it to a
+// different version. Edits are computed from the snapshot versions in based:
+// if a document changed since then, the ranges are moved along with the
+// changes as long as none of them overlaps or touches the changed text, and
+// errStaleEdit is returned otherwise. Documents that aren't open keep the
+// version the edit was built with.
+func (l *SourcegraphLLM) versionEdit(edit types.WorkspaceEdit, based map[lsp.DocumentURI]int) (types.WorkspaceEdit, error) {
+	changes := make([]any, len(edit.DocumentChanges))
+	for i, change := range edit.DocumentChanges {
+		changes[i] = change
+		textEdit, ok := change.(types.TextDocumentEdit)
+		if !ok {
+			continue
+		}
+
+		uri := textEdit.TextDocument.URI
+		current, ok := l.Documents.Get(uri)
+		if !ok {
+			continue
+		}
+		if version, ok := based[uri]; ok && version != current.Version {
+			snapshot, ok := l.Documents.Snapshot(uri, version)
+			if !ok {
+				return edit, fmt.Errorf("%s: %w", uri, errStaleEdit)
+			}
+			edits, ok := mapEdits(snapshot.Text, current.Text, textEdit.Edits)
+			if !ok {
+				return edit, fmt.Errorf("%s: %w", uri, errStaleEdit)
+			}
+			textEdit.Edits = edits
+		}
+
+		textEdit.TextDocument.Version = current.Version
+		changes[i] = textEdit
+	}
+
+	edit.DocumentChanges = changes
+	return edit, nil
+}
+
+// mapEdits maps the ranges of edits based on the snapshot text onto the
+// current text. The texts are compared to find the text that changed in
+// between: edits before it keep their offsets and edits after it are moved
+// by the change in length. It returns false if an edit overlaps the changed
+// text, or inserts at its boundary, as it may then be based on stale text.
+func mapEdits(snapshot, current string, edits []lsp.TextEdit) ([]lsp.TextEdit, bool) {
+	if snapshot == current {
+		return edits, true
+	}
+	prefix := 0
+	for prefix < len(snapshot) && prefix < len(current) && snapshot[prefix] == current[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(snapshot)-prefix && suffix < len(current)-prefix && snapshot[len(snapshot)-1-suffix] == current[len(current)-1-suffix] {
+		suffix++
+	}
+	changedEnd := len(snapshot) - suffix
+	delta := len(current) - len(snapshot)
+
+	mapped := make([]lsp.TextEdit, len(edits))
+	for i, e := range edits {
+		start, end := position.Offset(snapshot, e.Range.Start), position.Offset(snapshot, e.Range.End)
+		switch {
+		case end < prefix || start < end && end <= prefix:
+			// Before the changed text
+		case start > changedEnd || start < end && start >= changedEnd:
+			start, end = start+delta, end+delta
+		default:
+			return nil, false
+		}
+		e.Range = lsp.Range{Start: position.Of(current, start), End: position.Of(current, end)}
+		mapped[i] = e
+	}
+	return mapped, true
+}
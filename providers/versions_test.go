@@ -0,0 +1,100 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/pjlast/llmsp/internal/documents"
+	"github.com/pjlast/llmsp/types"
+	"github.com/sourcegraph/go-lsp"
+)
+
+func TestVersionEdit(t *testing.T) {
+	uri := lsp.DocumentURI("file:///main.go")
+	l := &SourcegraphLLM{Documents: documents.NewStore()}
+	l.Documents.Open(uri, "package main\n\nfunc main() {}\n", 1)
+	ctx := l.withSnapshot(context.Background())
+
+	// Replaces the body of main
+	edit := *textEdit(uri, lsp.Range{Start: lsp.Position{Line: 2, Character: 12}, End: lsp.Position{Line: 2, Character: 14}}, "{ run() }")
+	change := func(version int, text string) {
+		_ = l.Documents.Change(uri, version, func(string) (string, error) { return text, nil })
+	}
+
+	tests := []struct {
+		name    string
+		version int
+		text    string
+		stale   bool
+		// line is the line of the edit in the changed text
+		line int
+	}{
+		{"unchanged", 1, "package main\n\nfunc main() {}\n", false, 2},
+		{"changed after the range", 2, "package main\n\nfunc main() {}\n\nfunc run() {}\n", false, 2},
+		{"changed in the range", 3, "package main\n\nfunc main() { os.Exit(1) }\n", true, 0},
+		{"changed before the range", 4, "// Command main\npackage main\n\nfunc main() {}\n", false, 3},
+	}
+	for _, test := range tests {
+		change(test.version, test.text)
+		versioned, err := l.versionEdit(edit, snapshotVersions(ctx))
+		if test.stale {
+			if !errors.Is(err, errStaleEdit) {
+				t.Errorf("%s: versionEdit() error == %v, want %v", test.name, err, errStaleEdit)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: versionEdit() error == %v, want nil", test.name, err)
+			continue
+		}
+		versionedEdit := versioned.DocumentChanges[0].(types.TextDocumentEdit)
+		if got := versionedEdit.TextDocument.Version; got != test.version {
+			t.Errorf("%s: edit version == %d, want %d", test.name, got, test.version)
+		}
+		if got := versionedEdit.Edits[0].Range; got.Start.Line != test.line || got.End.Line != test.line || got.Start.Character != 12 || got.End.Character != 14 {
+			t.Errorf("%s: edit range == %+v, want characters 12 to 14 of line %d", test.name, got, test.line)
+		}
+	}
+
+	if got := edit.DocumentChanges[0].(types.TextDocumentEdit).TextDocument.Version; got != 0 {
+		t.Errorf("versionEdit() changed the original edit to version %d", got)
+	}
+}
+
+func TestMapEdits(t *testing.T) {
+	insert := func(line, character int) []lsp.TextEdit {
+		at := lsp.Position{Line: line, Character: character}
+		return []lsp.TextEdit{{Range: lsp.Range{Start: at, End: at}, NewText: "// Run runs.\n"}}
+	}
+	snapshot := "package main\n\nfunc run() {}\n"
+
+	tests := []struct {
+		name    string
+		current string
+		edits   []lsp.TextEdit
+		want    *lsp.Position
+	}{
+		{"insertion before the change", snapshot + "\nfunc main() {}\n", insert(2, 0), &lsp.Position{Line: 2}},
+		{"insertion after the change", "// Command main runs.\n" + snapshot, insert(2, 0), &lsp.Position{Line: 3}},
+		// The declaration the comment was written for was replaced
+		{"insertion at the change", "package main\n\nfunc exit() {}\n", insert(2, 5), nil},
+		{"insertion in the change", "package main\n\nvar x int\n", insert(2, 0), nil},
+	}
+	for _, test := range tests {
+		mapped, ok := mapEdits(snapshot, test.current, test.edits)
+		if test.want == nil {
+			if ok {
+				t.Errorf("%s: mapEdits() == %+v, want it rejected", test.name, mapped)
+			}
+			continue
+		}
+		if !ok {
+			t.Errorf("%s: mapEdits() rejected the edit", test.name)
+			continue
+		}
+		if got := mapped[0].Range; got.Start != *test.want || got.End != *test.want {
+			t.Errorf("%s: mapped range == %+v, want an insertion at %+v", test.name, got, *test.want)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package providers
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pjlast/llmsp/internal/documents"
+)
+
+// Default number of lines above and below the cursor included in the context
+// of completions.
+const (
+	defaultLinesAbove = 40
+	defaultLinesBelow = 10
+)
+
+// maxEnclosingLines is the number of lines the window is extended by to start
+// at the enclosing function. If the function starts further up, only its
+// header is included.
+const maxEnclosingLines = 100
+
+// functionHeader matches the first line of function declarations in common
+// languages.
+var functionHeader = regexp.MustCompile(`^\s*((export\s+)?(async\s+)?function\b|func\b|def\b|(pub\s+)?fn\b|fun\b|sub\b)|^\s*(public|private|protected|static|async|\w[\w<>\[\], ]*\s)\s*\w+\s*\([^;]*$`)
+
+// statement matches lines starting with a statement keyword, which look like
+// C style function declarations otherwise.
+var statement = regexp.MustCompile(`^\s*(return|if|else|for|while|switch|case|throw|await|new)\b`)
+
+// cursorWindow is the part of a document around the cursor.
+type cursorWindow struct {
+	// Header is the header of the enclosing function, if the function starts
+	// too far above the window to include all of it
+	Header string
+	// Before contains the lines above the cursor and the line of the cursor
+	Before string
+	// After contains the lines below the cursor
+	After string
+}
+
+// linesAround returns the number of lines above and below the cursor
+// included in the context of completions.
+func (l *SourcegraphLLM) linesAround() (int, int) {
+	above, below := l.LinesAbove, l.LinesBelow
+	if above <= 0 {
+		above = defaultLinesAbove
+	}
+	if below <= 0 {
+		below = defaultLinesBelow
+	}
+	return above, below
+}
+
+// windowAround returns the lines around the given line of the document. The
+// window is extended upwards to the start of the enclosing function, if it
+// starts close enough.
+func windowAround(doc documents.Document, line, above, below int) cursorWindow {
+	if line < 0 {
+		line = 0
+	}
+	if last := doc.LineCount() - 1; line > last {
+		line = last
+	}
+	start := line - above
+	if start < 0 {
+		start = 0
+	}
+	end := line + below
+	if end > doc.LineCount()-1 {
+		end = doc.LineCount() - 1
+	}
+
+	var window cursorWindow
+	if header, ok := enclosingFunction(doc, line); ok && header < start {
+		if start-header <= maxEnclosingLines {
+			start = header
+		} else {
+			window.Header = doc.Line(header)
+		}
+	}
+
+	before := make([]string, 0, line-start+1)
+	for i := start; i <= line; i++ {
+		before = append(before, doc.Line(i))
+	}
+	after := make([]string, 0, end-line)
+	for i := line + 1; i <= end; i++ {
+		after = append(after, doc.Line(i))
+	}
+	window.Before = strings.Join(before, "\n")
+	window.After = strings.Join(after, "\n")
+	return window
+}
+
+// enclosingFunction returns the line of the header of the function enclosing
+// the given line. Unless the syntax of the document is known, functions are
+// recognized by their header being indented less than the line.
+func enclosingFunction(doc documents.Document, line int) (int, bool) {
+	if f := parseDocument(doc); f != nil {
+		symbol, ok := f.Enclosing(line)
+		return symbol.Line, ok
+	}
+
+	indentation := -1
+	for i := line; i >= 0 && indentation == -1; i-- {
+		if text := doc.Line(i); strings.TrimSpace(text) != "" {
+			indentation = indentOf(text)
+		}
+	}
+
+	for i := line; i >= 0; i-- {
+		text := doc.Line(i)
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		if indent := indentOf(text); indent < indentation || i == line {
+			if functionHeader.MatchString(text) && !statement.MatchString(text) {
+				return i, true
+			}
+			if indent < indentation {
+				indentation = indent
+			}
+		}
+		if indentation == 0 && i < line {
+			// Top level code that isn't a function
+			return 0, false
+		}
+	}
+	return 0, false
+}
+
+// indentOf returns the width of the indentation of the line, counting tabs
+// as a single column.
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
@@ -0,0 +1,76 @@
+package providers
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/pjlast/llmsp/internal/documents"
+)
+
+// testDocument returns a document with the given text.
+func testDocument(text string) documents.Document {
+	store := documents.NewStore()
+	store.Open("file:///test", text, 0)
+	doc, _ := store.Get("file:///test")
+	return doc
+}
+
+func TestEnclosingFunction(t *testing.T) {
+	goFile := testDocument("package main\n\nfunc main() {\n\tif ok {\n\t\trun()\n\t}\n}\n\nvar x = 1\n")
+	pyFile := testDocument("class A:\n    def run(self):\n        return 1\n")
+	tests := []struct {
+		name   string
+		doc    documents.Document
+		line   int
+		header int
+		ok     bool
+	}{
+		{"nested block", goFile, 4, 2, true},
+		{"function body", goFile, 3, 2, true},
+		{"function header", goFile, 2, 2, true},
+		{"top level", goFile, 8, 0, false},
+		{"method", pyFile, 2, 1, true},
+		{"class", pyFile, 0, 0, false},
+	}
+	for _, test := range tests {
+		header, ok := enclosingFunction(test.doc, test.line)
+		if header != test.header || ok != test.ok {
+			t.Errorf("%s: enclosingFunction(%d) == (%d, %v), want (%d, %v)", test.name, test.line, header, ok, test.header, test.ok)
+		}
+	}
+}
+
+func TestWindowAround(t *testing.T) {
+	var lines []string
+	lines = append(lines, "func long() {")
+	for i := 1; i < 200; i++ {
+		lines = append(lines, fmt.Sprintf("\tstep(%d)", i))
+	}
+	lines = append(lines, "}")
+	doc := testDocument(strings.Join(lines, "\n"))
+
+	tests := []struct {
+		name                 string
+		line, above, below   int
+		header, first, after string
+		beforeLen            int
+	}{
+		{"extended to the function", 20, 5, 2, "", "func long() {", "\tstep(21)\n\tstep(22)", 21},
+		{"function too far up", 150, 5, 2, "func long() {", "\tstep(145)", "\tstep(151)\n\tstep(152)", 6},
+		{"closing brace", 200, 1, 5, "", "\tstep(199)", "", 2},
+	}
+	for _, test := range tests {
+		window := windowAround(doc, test.line, test.above, test.below)
+		before := strings.Split(window.Before, "\n")
+		if window.Header != test.header {
+			t.Errorf("%s: header == %q, want %q", test.name, window.Header, test.header)
+		}
+		if before[0] != test.first || len(before) != test.beforeLen {
+			t.Errorf("%s: window starts with %q and has %d lines before the cursor, want %q and %d", test.name, before[0], len(before), test.first, test.beforeLen)
+		}
+		if window.After != test.after {
+			t.Errorf("%s: after == %q, want %q", test.name, window.After, test.after)
+		}
+	}
+}
@@ -1,13 +1,16 @@
 package embeddings
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
-	"strings"
+
+	"github.com/pjlast/llmsp/sourcegraph/graphql"
 )
 
 type EmbeddingsResult struct {
+	// RepoName is only set for results of a multi-repository search
+	RepoName  string
 	FileName  string
 	StartLine int
 	EndLine   int
@@ -19,53 +22,15 @@ type EmbeddingsSearchResult struct {
 	TextResults []EmbeddingsResult
 }
 
-type EmbeddingsResponse struct {
-	Data struct {
-		EmbeddingsSearch EmbeddingsSearchResult
-	}
-}
-
-type RepoIDResponse struct {
-	Data struct {
-		Repository struct {
-			ID string
-		}
-	}
-}
-
+// Client queries the GraphQL API of a Sourcegraph instance for embeddings,
+// search results, repositories and the instance itself, and sends telemetry
+// events.
 type Client struct {
-	URL         string
-	httpClient  *http.Client
-	accessToken string
+	*graphql.Client
 }
 
 func NewClient(sgURL string, accessToken string, httpClient *http.Client) *Client {
-	if httpClient == nil {
-		httpClient = http.DefaultClient
-	}
-
-	sgURL = strings.TrimSuffix(sgURL, "/") + "/.api/graphql"
-
-	return &Client{
-		URL:         sgURL,
-		httpClient:  httpClient,
-		accessToken: accessToken,
-	}
-}
-
-type searchEmbeddingsQuery struct {
-	Query     string              `json:"query"`
-	Variables embeddingsVariables `json:"variables"`
-}
-
-type getRepoIDQuery struct {
-	Query     string            `json:"query"`
-	Variables repoNameVariables `json:"variables"`
-}
-
-type logEventQuery struct {
-	Query     string            `json:"query"`
-	Variables logEventVariables `json:"variables"`
+	return &Client{Client: graphql.NewClient(sgURL, accessToken, httpClient)}
 }
 
 type logEventVariables struct {
@@ -88,9 +53,8 @@ type embeddingsVariables struct {
 	TextResultsCount int    `json:"textResultsCount"`
 }
 
-func (c *Client) GetEmbeddings(repoID string, query string, codeResults int, textResults int) (*EmbeddingsSearchResult, error) {
-	q := searchEmbeddingsQuery{
-		Query: `query EmbeddingsSearch($repo: ID!, $query: String!, $codeResultsCount: Int!, $textResultsCount: Int!) {
+func (c *Client) GetEmbeddings(ctx context.Context, repoID string, query string, codeResults int, textResults int) (*EmbeddingsSearchResult, error) {
+	data, err := graphql.Do[struct{ EmbeddingsSearch EmbeddingsSearchResult }](ctx, c.Client, `query EmbeddingsSearch($repo: ID!, $query: String!, $codeResultsCount: Int!, $textResultsCount: Int!) {
   embeddingsSearch(repo: $repo, query: $query, codeResultsCount: $codeResultsCount, textResultsCount: $textResultsCount) {
     codeResults {
       fileName
@@ -105,95 +69,177 @@ func (c *Client) GetEmbeddings(repoID string, query string, codeResults int, tex
       content
     }
   }
-}`,
-		Variables: embeddingsVariables{
-			Repo:             repoID,
-			Query:            query,
-			CodeResultsCount: codeResults,
-			TextResultsCount: textResults,
-		},
+}`, embeddingsVariables{
+		Repo:             repoID,
+		Query:            query,
+		CodeResultsCount: codeResults,
+		TextResultsCount: textResults,
+	})
+	if err != nil {
+		return nil, classify(err)
 	}
 
-	var embeddings EmbeddingsResponse
-	if err := c.sendGraphQLRequest(q, &embeddings); err != nil {
-		return nil, err
-	}
+	return &data.EmbeddingsSearch, nil
+}
 
-	return &embeddings.Data.EmbeddingsSearch, nil
+type multiEmbeddingsVariables struct {
+	Repos            []string `json:"repos"`
+	Query            string   `json:"query"`
+	CodeResultsCount int      `json:"codeResultsCount"`
+	TextResultsCount int      `json:"textResultsCount"`
 }
 
-func (c *Client) GetRepoID(repoName string) (string, error) {
-	q := getRepoIDQuery{
-		Query: `query RepoID($name: String!) {
-      repository(name: $name) {
-        id
-      }
-    }`,
-		Variables: repoNameVariables{
-			Name: repoName,
-		},
+// GetMultiEmbeddings searches the embeddings of several repositories at once.
+// The results are annotated with the name of the repository they belong to.
+func (c *Client) GetMultiEmbeddings(ctx context.Context, repoIDs []string, query string, codeResults int, textResults int) (*EmbeddingsSearchResult, error) {
+	data, err := graphql.Do[struct{ EmbeddingsMultiSearch EmbeddingsSearchResult }](ctx, c.Client, `query EmbeddingsMultiSearch($repos: [ID!]!, $query: String!, $codeResultsCount: Int!, $textResultsCount: Int!) {
+  embeddingsMultiSearch(repos: $repos, query: $query, codeResultsCount: $codeResultsCount, textResultsCount: $textResultsCount) {
+    codeResults {
+      repoName
+      fileName
+      startLine
+      endLine
+      content
+    }
+    textResults {
+      repoName
+      fileName
+      startLine
+      endLine
+      content
+    }
+  }
+}`, multiEmbeddingsVariables{
+		Repos:            repoIDs,
+		Query:            query,
+		CodeResultsCount: codeResults,
+		TextResultsCount: textResults,
+	})
+	if err != nil {
+		return nil, classify(err)
 	}
 
-	var repoIDResponse RepoIDResponse
-	if err := c.sendGraphQLRequest(q, &repoIDResponse); err != nil {
-		return "", err
-	}
+	return &data.EmbeddingsMultiSearch, nil
+}
 
-	return repoIDResponse.Data.Repository.ID, nil
-}
-
-func (c *Client) LogEvent(eventName string, uid string, argument string, publicArgument string) error {
-	q := logEventQuery{
-		Query: `mutation LogEventMutation($event: String!, $userCookieID: String!, $url: String!, $source: EventSource!, $argument: String, $publicArgument: String) {
-    logEvent(
-		event: $event
-		userCookieID: $userCookieID
-		url: $url
-		source: $source
-		argument: $argument
-		publicArgument: $publicArgument
-    ) {
-		alwaysNil
+// GetRepoID returns the GraphQL ID of a repository, or ErrRepoNotFound if
+// the instance doesn't know the repository.
+func (c *Client) GetRepoID(ctx context.Context, repoName string) (string, error) {
+	data, err := graphql.Do[struct{ Repository *struct{ ID string } }](ctx, c.Client, `query RepoID($name: String!) {
+  repository(name: $name) {
+    id
+  }
+}`, repoNameVariables{
+		Name: repoName,
+	})
+	if err != nil {
+		return "", classify(err)
 	}
-}`,
-		Variables: logEventVariables{
-			Event:          eventName,
-			UserCookieID:   uid,
-			Url:            "",
-			Source:         "IDEEXTENSION",
-			PublicArgument: publicArgument,
-			Argument:       argument,
-		},
+	if data.Repository == nil || data.Repository.ID == "" {
+		return "", ErrRepoNotFound
 	}
 
-	return c.sendGraphQLRequest(q, nil)
+	return data.Repository.ID, nil
 }
 
-// sendGraphQLRequest sends a GraphQL request and parses the response.
-func (c *Client) sendGraphQLRequest(request interface{}, response interface{}) error {
-	reqBody, err := json.Marshal(request)
-	if err != nil {
-		return err
-	}
-
-	req, err := http.NewRequest("POST", c.URL, bytes.NewBuffer(reqBody))
+func (c *Client) LogEvent(ctx context.Context, eventName string, uid string, argument string, publicArgument string) error {
+	_, err := graphql.Do[json.RawMessage](ctx, c.Client, `mutation LogEventMutation($event: String!, $userCookieID: String!, $url: String!, $source: EventSource!, $argument: String, $publicArgument: String) {
+  logEvent(
+    event: $event
+    userCookieID: $userCookieID
+    url: $url
+    source: $source
+    argument: $argument
+    publicArgument: $publicArgument
+  ) {
+    alwaysNil
+  }
+}`, logEventVariables{
+		Event:          eventName,
+		UserCookieID:   uid,
+		Url:            "",
+		Source:         "IDEEXTENSION",
+		PublicArgument: publicArgument,
+		Argument:       argument,
+	})
+	return err
+}
+
+// CurrentUser returns the username of the user the access token belongs
+// to. It returns ErrUnauthorized if the token is invalid or if there is no
+// token.
+func (c *Client) CurrentUser(ctx context.Context) (string, error) {
+	data, err := graphql.Do[struct{ CurrentUser *struct{ Username string } }](ctx, c.Client, `query CurrentUser {
+  currentUser {
+    username
+  }
+}`, struct{}{})
 	if err != nil {
-		return err
+		return "", err
 	}
-	req.Header.Add("Content-Type", "application/json")
-	if c.accessToken != "" {
-		req.Header.Add("Authorization", "token "+c.accessToken)
+	if data.CurrentUser == nil {
+		return "", ErrUnauthorized
 	}
 
-	resp, err := c.httpClient.Do(req)
+	return data.CurrentUser.Username, nil
+}
+
+// GetVersion returns the product version of the Sourcegraph instance, e.g.
+// "5.2.0", or a build identifier for development and insiders builds.
+func (c *Client) GetVersion(ctx context.Context) (string, error) {
+	data, err := graphql.Do[struct {
+		Site struct{ ProductVersion string }
+	}](ctx, c.Client, `query SiteProductVersion {
+  site {
+    productVersion
+  }
+}`, struct{}{})
 	if err != nil {
-		return err
+		return "", err
 	}
-	defer resp.Body.Close()
 
-	if response != nil {
-		return json.NewDecoder(resp.Body).Decode(response)
-	}
+	return data.Site.ProductVersion, nil
+}
+
+// TelemetryEvent is an event of the Telemetry V2 API, identified by the
+// feature it belongs to and the action that was taken, e.g.
+// "cody.completion" and "accepted".
+type TelemetryEvent struct {
+	Feature    string                   `json:"feature"`
+	Action     string                   `json:"action"`
+	Source     TelemetryEventSource     `json:"source"`
+	Parameters TelemetryEventParameters `json:"parameters"`
+}
 
-	return nil
+// TelemetryEventSource describes the client that recorded an event.
+type TelemetryEventSource struct {
+	Client        string `json:"client"`
+	ClientVersion string `json:"clientVersion,omitempty"`
+}
+
+// TelemetryEventParameters holds the details of an event. Private metadata
+// is arbitrary JSON that isn't exported from the instance.
+type TelemetryEventParameters struct {
+	Version         int             `json:"version"`
+	PrivateMetadata json.RawMessage `json:"privateMetadata,omitempty"`
+}
+
+type recordEventsVariables struct {
+	Events []TelemetryEvent `json:"events"`
+}
+
+// RecordEvents sends events with the Telemetry V2 API, which replaces
+// LogEvent on Sourcegraph 5.2.0 and later. All events are sent in a single
+// request.
+func (c *Client) RecordEvents(ctx context.Context, events []TelemetryEvent) error {
+	_, err := graphql.Do[json.RawMessage](ctx, c.Client, `mutation RecordTelemetryEvents($events: [TelemetryEventInput!]!) {
+  telemetry {
+    recordEvents(events: $events) {
+      alwaysNil
+    }
+  }
+}`, recordEventsVariables{
+		Events: events,
+	})
+	return err
 }
@@ -0,0 +1,51 @@
+package embeddings
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pjlast/llmsp/sourcegraph/graphql"
+)
+
+var (
+	// ErrUnauthorized is returned when the access token is invalid.
+	ErrUnauthorized = graphql.ErrUnauthorized
+	// ErrRepoNotFound is returned when a repository doesn't exist on the
+	// Sourcegraph instance.
+	ErrRepoNotFound = errors.New("repository not found")
+	// ErrEmbeddingsNotEnabled is returned when embeddings are disabled on
+	// the instance, or a repository has no embeddings.
+	ErrEmbeddingsNotEnabled = errors.New("embeddings are not enabled")
+	// ErrRateLimited is returned when the instance rejects requests because
+	// of its rate limits.
+	ErrRateLimited = errors.New("rate limit exceeded")
+)
+
+// classify wraps the errors of a GraphQL response with ErrRepoNotFound,
+// ErrEmbeddingsNotEnabled or ErrRateLimited, depending on their messages, and
+// responses with the status 429 Too Many Requests with ErrRateLimited. Other
+// errors are returned as they are.
+func classify(err error) error {
+	var statusErr *graphql.StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusTooManyRequests {
+		return fmt.Errorf("%w: %w", ErrRateLimited, err)
+	}
+	var graphQLErr *graphql.GraphQLError
+	if !errors.As(err, &graphQLErr) {
+		return err
+	}
+	for _, message := range graphQLErr.Messages {
+		lower := strings.ToLower(message)
+		switch {
+		case strings.Contains(lower, "repository not found") || strings.Contains(lower, "repo not found"):
+			return fmt.Errorf("%w: %w", ErrRepoNotFound, err)
+		case strings.Contains(lower, "embeddings") && (strings.Contains(lower, "not enabled") || strings.Contains(lower, "disabled") || strings.Contains(lower, "not found") || strings.Contains(lower, "no embeddings")):
+			return fmt.Errorf("%w: %w", ErrEmbeddingsNotEnabled, err)
+		case strings.Contains(lower, "rate limit"):
+			return fmt.Errorf("%w: %w", ErrRateLimited, err)
+		}
+	}
+	return err
+}
@@ -0,0 +1,70 @@
+package embeddings
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pjlast/llmsp/sourcegraph/graphql"
+)
+
+func TestGraphQLErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   error
+	}{
+		{"unauthorized", http.StatusUnauthorized, "Invalid access token.", ErrUnauthorized},
+		{"repository not found", http.StatusOK, `{"data": {"repository": null}}`, ErrRepoNotFound},
+		{"embeddings disabled", http.StatusOK, `{"data": null, "errors": [{"message": "embeddings are not enabled"}]}`, ErrEmbeddingsNotEnabled},
+		{"no embeddings", http.StatusOK, `{"data": null, "errors": [{"message": "embeddings for repository \"github.com/a/b\" not found"}]}`, ErrEmbeddingsNotEnabled},
+		{"rate limited", http.StatusTooManyRequests, "Too many requests.", ErrRateLimited},
+		{"rate limit message", http.StatusOK, `{"data": null, "errors": [{"message": "rate limit exceeded, try again later"}]}`, ErrRateLimited},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(test.status)
+				w.Write([]byte(test.body))
+			}))
+			defer server.Close()
+			client := NewClient(server.URL, "token", server.Client())
+
+			_, err := client.GetRepoID(context.Background(), "github.com/a/b")
+			if !errors.Is(err, test.want) {
+				t.Errorf("got error %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestGraphQLErrorMessages(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"errors": [{"message": "syntax error"}, {"message": "unknown field"}]}`))
+	}))
+	defer server.Close()
+	client := NewClient(server.URL, "token", server.Client())
+
+	_, err := client.GetEmbeddings(context.Background(), "repo", "query", 1, 1)
+	var graphQLErr *graphql.GraphQLError
+	if !errors.As(err, &graphQLErr) {
+		t.Fatalf("got error %v, want a GraphQL error", err)
+	}
+	if len(graphQLErr.Messages) != 2 || errors.Is(err, ErrEmbeddingsNotEnabled) {
+		t.Errorf("got %+v, want two messages of no particular kind", graphQLErr)
+	}
+
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	client.Retries = 0
+	_, err = client.GetEmbeddings(context.Background(), "repo", "query", 1, 1)
+	var statusErr *graphql.StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadGateway {
+		t.Errorf("got error %v, want a status error", err)
+	}
+}
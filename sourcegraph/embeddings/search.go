@@ -0,0 +1,210 @@
+package embeddings
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pjlast/llmsp/sourcegraph/graphql"
+)
+
+// maxDefinitionLines is the maximum number of lines of a definition found by
+// a symbol search.
+const maxDefinitionLines = 20
+
+// SearchResult is a snippet of a file found by a search.
+type SearchResult struct {
+	RepoName  string
+	FileName  string
+	StartLine int
+	EndLine   int
+	Content   string
+	// Symbol is the name of the symbol defined by the snippet, it is empty
+	// for keyword search results
+	Symbol string
+}
+
+type searchVariables struct {
+	Query string `json:"query"`
+}
+
+type fileMatch struct {
+	Typename   string `json:"__typename"`
+	Repository struct{ Name string }
+	File       struct {
+		Path    string
+		Content string
+	}
+	Symbols []struct {
+		Name     string
+		Location struct {
+			Range struct {
+				Start struct{ Line int }
+			}
+		}
+	}
+	LineMatches []struct {
+		Preview    string
+		LineNumber int
+	}
+}
+
+// search runs a search query and returns its file matches.
+func (c *Client) search(ctx context.Context, query string) ([]fileMatch, error) {
+	data, err := graphql.Do[struct {
+		Search *struct {
+			Results struct{ Results []fileMatch }
+		}
+	}](ctx, c.Client, `query Search($query: String!) {
+  search(query: $query, version: V3) {
+    results {
+      results {
+        __typename
+        ... on FileMatch {
+          repository {
+            name
+          }
+          file {
+            path
+            content
+          }
+          symbols {
+            name
+            location {
+              range {
+                start {
+                  line
+                }
+              }
+            }
+          }
+          lineMatches {
+            preview
+            lineNumber
+          }
+        }
+      }
+    }
+  }
+}`, searchVariables{
+		Query: query,
+	})
+	if err != nil {
+		return nil, classify(err)
+	}
+	if data.Search == nil {
+		return nil, nil
+	}
+
+	var matches []fileMatch
+	for _, match := range data.Search.Results.Results {
+		if match.Typename == "FileMatch" {
+			matches = append(matches, match)
+		}
+	}
+	return matches, nil
+}
+
+// SearchSymbols searches the repository for the definitions of the symbols
+// with the given names, and returns up to count definitions.
+func (c *Client) SearchSymbols(ctx context.Context, repoName string, names []string, count int) ([]SearchResult, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = regexp.QuoteMeta(name)
+	}
+	matches, err := c.search(ctx, fmt.Sprintf("repo:^%s$ type:symbol patternType:regexp count:%d ^(%s)$",
+		regexp.QuoteMeta(repoName), count, strings.Join(quoted, "|")))
+	if err != nil {
+		return nil, err
+	}
+
+	var results []SearchResult
+	for _, match := range matches {
+		lines := strings.Split(match.File.Content, "\n")
+		for _, symbol := range match.Symbols {
+			start := symbol.Location.Range.Start.Line
+			if start < 0 || start >= len(lines) {
+				continue
+			}
+			end := definitionEnd(lines, start)
+			results = append(results, SearchResult{
+				RepoName:  match.Repository.Name,
+				FileName:  match.File.Path,
+				StartLine: start,
+				EndLine:   end,
+				Content:   strings.Join(lines[start:end+1], "\n"),
+				Symbol:    symbol.Name,
+			})
+			if len(results) == count {
+				return results, nil
+			}
+		}
+	}
+	return results, nil
+}
+
+// SearchKeywords searches the repository for lines containing any of the
+// keywords, and returns up to count lines.
+func (c *Client) SearchKeywords(ctx context.Context, repoName string, keywords []string, count int) ([]SearchResult, error) {
+	if len(keywords) == 0 {
+		return nil, nil
+	}
+	quoted := make([]string, len(keywords))
+	for i, keyword := range keywords {
+		quoted[i] = regexp.QuoteMeta(keyword)
+	}
+	matches, err := c.search(ctx, fmt.Sprintf("repo:^%s$ type:file patternType:regexp count:%d \\b(%s)\\b",
+		regexp.QuoteMeta(repoName), count, strings.Join(quoted, "|")))
+	if err != nil {
+		return nil, err
+	}
+
+	var results []SearchResult
+	for _, match := range matches {
+		for _, line := range match.LineMatches {
+			results = append(results, SearchResult{
+				RepoName:  match.Repository.Name,
+				FileName:  match.File.Path,
+				StartLine: line.LineNumber,
+				EndLine:   line.LineNumber,
+				Content:   line.Preview,
+			})
+			if len(results) == count {
+				return results, nil
+			}
+		}
+	}
+	return results, nil
+}
+
+// definitionEnd returns the last line of the definition starting on line
+// start: the line closing its block, or the last line indented more than
+// its first line. Definitions are cut after maxDefinitionLines lines.
+func definitionEnd(lines []string, start int) int {
+	indent := indentation(lines[start])
+	end := start
+	for i := start + 1; i < len(lines) && i < start+maxDefinitionLines; i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed == "" {
+			continue
+		}
+		if indentation(lines[i]) > indent {
+			end = i
+			continue
+		}
+		if strings.HasPrefix(trimmed, "}") || strings.HasPrefix(trimmed, ")") || strings.HasPrefix(trimmed, "]") || trimmed == "end" {
+			end = i
+		}
+		break
+	}
+	return end
+}
+
+// indentation returns the width of the leading whitespace of the line.
+func indentation(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
@@ -0,0 +1,70 @@
+package embeddings
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestDefinitionEnd(t *testing.T) {
+	lines := []string{
+		"type A int",
+		"",
+		"func B() {",
+		"\treturn",
+		"",
+		"\tb()",
+		"}",
+		"def c():",
+		"    pass",
+		"d = 1",
+	}
+	for start, want := range map[int]int{0: 0, 2: 6, 7: 8, 9: 9} {
+		if got := definitionEnd(lines, start); got != want {
+			t.Errorf("definitionEnd(%d) == %d, want %d", start, got, want)
+		}
+	}
+}
+
+func TestSearchSymbols(t *testing.T) {
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Variables searchVariables
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Error(err)
+		}
+		query = request.Variables.Query
+		w.Write([]byte(`{"data": {"search": {"results": {"results": [
+			{"__typename": "Repository"},
+			{"__typename": "FileMatch", "repository": {"name": "github.com/a/b"},
+			 "file": {"path": "b.go", "content": "package b\n\nfunc B() {\n\treturn\n}\n"},
+			 "symbols": [{"name": "B", "location": {"range": {"start": {"line": 2}}}}]}
+		]}}}}`))
+	}))
+	defer server.Close()
+	client := NewClient(server.URL, "token", server.Client())
+
+	results, err := client.SearchSymbols(context.Background(), "github.com/a/b", []string{"B", "C"}, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `repo:^github\.com/a/b$ type:symbol patternType:regexp count:5 ^(B|C)$`; query != want {
+		t.Errorf("searched %q, want %q", query, want)
+	}
+	want := []SearchResult{{
+		RepoName:  "github.com/a/b",
+		FileName:  "b.go",
+		StartLine: 2,
+		EndLine:   4,
+		Content:   "func B() {\n\treturn\n}",
+		Symbol:    "B",
+	}}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("SearchSymbols() == %+v, want %+v", results, want)
+	}
+}
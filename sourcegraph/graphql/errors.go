@@ -0,0 +1,54 @@
+package graphql
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ErrUnauthorized is returned when the access token is invalid.
+var ErrUnauthorized = errors.New("unauthorized")
+
+// maxErrorBodySize is the maximum size of an error response body that is
+// read.
+const maxErrorBodySize = 64 * 1024
+
+// StatusError is returned when the GraphQL API responds with a status other
+// than 200 OK.
+type StatusError struct {
+	StatusCode int
+	Status     string
+	// Body is the beginning of the body of the response
+	Body   []byte
+	Header http.Header
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("GraphQL API: unexpected response status %s", e.Status)
+}
+
+// Unwrap returns ErrUnauthorized if the access token was rejected.
+func (e *StatusError) Unwrap() error {
+	switch e.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrUnauthorized
+	}
+	return nil
+}
+
+// newStatusError returns the error of a response that isn't 200 OK.
+func newStatusError(resp *http.Response) *StatusError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	return &StatusError{StatusCode: resp.StatusCode, Status: resp.Status, Body: body, Header: resp.Header}
+}
+
+// GraphQLError is returned when the response of a request contains errors.
+type GraphQLError struct {
+	Messages []string
+}
+
+func (e *GraphQLError) Error() string {
+	return "GraphQL API: " + strings.Join(e.Messages, "; ")
+}
@@ -0,0 +1,213 @@
+// Package graphql sends requests to the GraphQL API of a Sourcegraph
+// instance.
+//
+// A Client holds what requests have in common: the endpoint, the access
+// token, timeouts, retries and a tracing hook. Requests are sent with Do,
+// which decodes the data of the response into a value of the given type:
+//
+//	data, err := graphql.Do[struct{ Site struct{ ProductVersion string } }](ctx, client, query, nil)
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultRetries is the number of times a request is retried by default.
+const DefaultRetries = 2
+
+// retryDelay is the delay before the first retry, it doubles with every
+// retry.
+var retryDelay = 200 * time.Millisecond
+
+// Client sends requests to the GraphQL API of a Sourcegraph instance.
+type Client struct {
+	// URL is the URL of the GraphQL endpoint
+	URL string
+	// Timeout bounds each attempt at a request, there is no timeout if it
+	// is 0
+	Timeout time.Duration
+	// Retries is how many times requests failing with a network error or a
+	// 502, 503 or 504 status are retried
+	Retries int
+	// Trace is called after every attempt at a request, if it is set
+	Trace func(Trace)
+
+	accessToken string
+	httpClient  *http.Client
+}
+
+// Trace describes an attempt at a request.
+type Trace struct {
+	// Operation is the name of the operation, e.g. "RepoID"
+	Operation string
+	// Attempt is 1 for the first attempt, 2 for the first retry and so on
+	Attempt    int
+	StatusCode int
+	Duration   time.Duration
+	Err        error
+}
+
+// NewClient returns a client for the Sourcegraph instance at sgURL. If
+// httpClient is nil, http.DefaultClient is used.
+func NewClient(sgURL string, accessToken string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &Client{
+		URL:         strings.TrimSuffix(sgURL, "/") + "/.api/graphql",
+		Retries:     DefaultRetries,
+		accessToken: accessToken,
+		httpClient:  httpClient,
+	}
+}
+
+// HTTPClient returns the HTTP client requests are sent with.
+func (c *Client) HTTPClient() *http.Client {
+	return c.httpClient
+}
+
+// Authorize adds the access token to a request, for the endpoints of the
+// instance that aren't part of the GraphQL API.
+func (c *Client) Authorize(req *http.Request) {
+	if c.accessToken != "" {
+		req.Header.Set("Authorization", "token "+c.accessToken)
+	}
+}
+
+// CloseIdleConnections closes the idle connections of the HTTP client.
+func (c *Client) CloseIdleConnections() {
+	c.httpClient.CloseIdleConnections()
+}
+
+// request is the body of a GraphQL request.
+type request[V any] struct {
+	Query     string `json:"query"`
+	Variables V      `json:"variables"`
+}
+
+// response is the body of a GraphQL response.
+type response[R any] struct {
+	Data   R
+	Errors []struct {
+		Message string
+	}
+}
+
+// Do sends a query, or a mutation, with its variables and returns the data
+// of the response. Requests that fail with a network error or a temporary
+// server error are retried. A response with errors returns a *GraphQLError,
+// and a response with a status other than 200 OK a *StatusError, or
+// ErrUnauthorized if the access token was rejected.
+func Do[R, V any](ctx context.Context, c *Client, query string, variables V) (R, error) {
+	var data R
+	body, err := json.Marshal(request[V]{Query: query, Variables: variables})
+	if err != nil {
+		return data, err
+	}
+
+	operation := operationName(query)
+	delay := retryDelay
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		statusCode, respBody, err := c.send(ctx, body)
+		if c.Trace != nil {
+			c.Trace(Trace{Operation: operation, Attempt: attempt, StatusCode: statusCode, Duration: time.Since(start), Err: err})
+		}
+		if err == nil {
+			return decode[R](respBody)
+		}
+		if attempt > c.Retries || !temporary(ctx, err) {
+			return data, err
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return data, ctx.Err()
+		}
+		delay *= 2
+	}
+}
+
+// send sends a single attempt at a request and returns the body of the
+// response.
+func (c *Client) send(ctx context.Context, body []byte) (int, []byte, error) {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	c.Authorize(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, nil, newStatusError(resp)
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	return resp.StatusCode, respBody, err
+}
+
+// decode returns the data of a response, or its errors.
+func decode[R any](body []byte) (R, error) {
+	var resp response[R]
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return resp.Data, err
+	}
+	if len(resp.Errors) > 0 {
+		messages := make([]string, len(resp.Errors))
+		for i, e := range resp.Errors {
+			messages[i] = e.Message
+		}
+		return resp.Data, &GraphQLError{Messages: messages}
+	}
+	return resp.Data, nil
+}
+
+// temporary reports whether a failed request may succeed when retried.
+func temporary(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	// Errors that aren't returned by the API are network errors, or
+	// timeouts of single attempts
+	return true
+}
+
+// operationName returns the name of the operation of a query, e.g. "RepoID"
+// for "query RepoID($name: String!) {...}".
+func operationName(query string) string {
+	header, _, _ := strings.Cut(query, "{")
+	fields := strings.FieldsFunc(header, func(r rune) bool {
+		return r == ' ' || r == '\n' || r == '\t' || r == '('
+	})
+	if len(fields) < 2 || (fields[0] != "query" && fields[0] != "mutation") {
+		return ""
+	}
+	return fields[1]
+}
@@ -0,0 +1,120 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOperationName(t *testing.T) {
+	for query, want := range map[string]string{
+		"query RepoID($name: String!) { repository(name: $name) { id } }": "RepoID",
+		"\nmutation LogEvent(\n\t$event: String!\n) {}":                   "LogEvent",
+		"query{ currentUser { username } }":                               "",
+		"{ site { productVersion } }":                                     "",
+	} {
+		if got := operationName(query); got != want {
+			t.Errorf("operationName(%q) == %q, want %q", query, got, want)
+		}
+	}
+}
+
+func TestDo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.api/graphql" || r.Header.Get("Authorization") != "token secret" {
+			t.Errorf("unexpected request to %s with %q", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		w.Write([]byte(`{"data": {"site": {"productVersion": "5.2.0"}}}`))
+	}))
+	defer server.Close()
+	client := NewClient(server.URL+"/", "secret", server.Client())
+
+	data, err := Do[struct {
+		Site struct{ ProductVersion string }
+	}](context.Background(), client, "query Version { site { productVersion } }", struct{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Site.ProductVersion != "5.2.0" {
+		t.Errorf("got version %q, want 5.2.0", data.Site.ProductVersion)
+	}
+}
+
+func TestDoErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		check  func(error) bool
+	}{
+		{"unauthorized", http.StatusUnauthorized, "Invalid access token.", func(err error) bool {
+			return errors.Is(err, ErrUnauthorized)
+		}},
+		{"status", http.StatusInternalServerError, "boom", func(err error) bool {
+			var statusErr *StatusError
+			return errors.As(err, &statusErr) && string(statusErr.Body) == "boom"
+		}},
+		{"graphql", http.StatusOK, `{"errors": [{"message": "a"}, {"message": "b"}]}`, func(err error) bool {
+			var graphQLErr *GraphQLError
+			return errors.As(err, &graphQLErr) && len(graphQLErr.Messages) == 2
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				w.WriteHeader(test.status)
+				w.Write([]byte(test.body))
+			}))
+			defer server.Close()
+			client := NewClient(server.URL, "token", server.Client())
+
+			_, err := Do[struct{}](context.Background(), client, "query Q {}", struct{}{})
+			if !test.check(err) {
+				t.Errorf("unexpected error %v", err)
+			}
+			if requests != 1 {
+				t.Errorf("got %d requests, want no retries", requests)
+			}
+		})
+	}
+}
+
+func TestDoRetries(t *testing.T) {
+	defer func(delay time.Duration) { retryDelay = delay }(retryDelay)
+	retryDelay = time.Millisecond
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"data": {}}`))
+	}))
+	defer server.Close()
+	client := NewClient(server.URL, "token", server.Client())
+	var traces []Trace
+	client.Trace = func(trace Trace) { traces = append(traces, trace) }
+
+	if _, err := Do[struct{}](context.Background(), client, "query Q {}", struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(traces) != 3 || traces[2].Attempt != 3 || traces[2].Operation != "Q" || traces[0].StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("got traces %+v, want three attempts at Q", traces)
+	}
+
+	requests = 0
+	client.Retries = 1
+	_, err := Do[struct{}](context.Background(), client, "query Q {}", struct{}{})
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || requests != 2 {
+		t.Errorf("got error %v after %d requests, want a status error after 2", err, requests)
+	}
+}
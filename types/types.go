@@ -1,19 +1,203 @@
 package types
 
-import "github.com/sourcegraph/go-lsp"
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/sourcegraph/go-lsp"
+)
 
 type MemoryFileMap map[lsp.DocumentURI]string
 
 type LLMSPSettings struct {
 	Sourcegraph *SourcegraphSettings `json:"sourcegraph"`
+	Hooks       []Hook               `json:"hooks"`
+	Go          *GoSettings          `json:"go"`
+	Log         *LogSettings         `json:"log"`
+	Prompts     *PromptSettings      `json:"prompts"`
+	// Sampling maps kinds of requests, "chat", "completion" or "edit", to
+	// their sampling parameters.
+	Sampling map[string]SamplingSettings `json:"sampling"`
+	// TrustedWorkspaces are the root directories of the workspaces whose
+	// .llmsp.json file may set any setting. Other workspace config files
+	// can only set prompts, sampling, models, timeouts and context settings.
+	// It is ignored in workspace config files.
+	TrustedWorkspaces []string `json:"trustedWorkspaces"`
+}
+
+// SamplingSettings overrides the sampling parameters of requests to the LLM.
+// Unset parameters keep their defaults.
+type SamplingSettings struct {
+	// Temperature, between 0 and 1, makes responses more varied as it
+	// increases.
+	Temperature *float32 `json:"temperature"`
+	// TopK only samples from the K most likely tokens, -1 turns it off.
+	TopK *int `json:"topK"`
+	// TopP only samples from the most likely tokens making up that share of
+	// the probability mass, -1 turns it off. The Sourcegraph API only takes
+	// integers.
+	TopP *int `json:"topP"`
+	// MaxTokensToSample is the maximum length of responses, in tokens.
+	MaxTokensToSample *int `json:"maxTokensToSample"`
+}
+
+// PromptSettings overrides the templates of the prompts sent to the LLM, see
+// the prompts package for the names of the templates and their data.
+type PromptSettings struct {
+	// File is the path of a JSON file mapping template names to templates.
+	File string `json:"file"`
+	// Templates maps template names to templates. They take precedence over
+	// the templates of File.
+	Templates map[string]string `json:"templates"`
+	// Preamble are instructions added to the preamble of every prompt, such
+	// as the conventions of the workspace, before those of the
+	// .llmsp/preamble.md file of the workspace.
+	Preamble string `json:"preamble"`
+}
+
+// LogSettings configures logging.
+type LogSettings struct {
+	// Level is the minimum level of logged entries: "debug", "info", "warn"
+	// or "error".
+	Level string `json:"level"`
+	// File is the path of the log file.
+	File string `json:"file"`
+	// WindowLogMessage mirrors log entries to the client as
+	// window/logMessage notifications.
+	WindowLogMessage bool `json:"windowLogMessage"`
+}
+
+// GoSettings configures the Go specific integration.
+type GoSettings struct {
+	// Enhanced adds go list and go doc output to the context of Go files and
+	// checks that generated Go code parses before it is applied.
+	Enhanced bool `json:"enhanced"`
+}
+
+// Hook runs a command when a workspace event occurs.
+type Hook struct {
+	// Event is the name of the event, e.g. "didOpen", "didSave",
+	// "didCreateFiles" or a custom event sent with a cody/event notification.
+	Event string `json:"event"`
+	// Pattern optionally restricts the hook to files matching the glob.
+	Pattern string `json:"pattern,omitempty"`
+	// Command is the command to execute.
+	Command string `json:"command"`
+	// Arguments are the command arguments. The placeholders ${uri},
+	// ${firstLine} and ${lastLine} are replaced with the file the event
+	// occurred for.
+	Arguments []any `json:"arguments,omitempty"`
 }
 
 type SourcegraphSettings struct {
-	URL              string   `json:"url"`
-	AccessToken      string   `json:"accessToken"`
-	AutoComplete     string   `json:"autoComplete"`
-	RepoEmbeddings   []string `json:"repos"`
-	AnonymousUIDFile string   `json:"uidFile"`
+	URL         string `json:"url"`
+	AccessToken string `json:"accessToken"`
+	// TokenCommand is a shell command printing the access token, e.g.
+	// "pass show sourcegraph". It is used if AccessToken is empty.
+	TokenCommand string `json:"tokenCommand"`
+	// Keychain reads the access token from the keychain of the OS if neither
+	// AccessToken nor TokenCommand are set.
+	Keychain     *KeychainSettings `json:"keychain"`
+	AutoComplete string            `json:"autoComplete"`
+	// RepoEmbeddings are additional repositories whose embeddings are
+	// searched for context.
+	RepoEmbeddings   []EmbeddingsRepo `json:"repos"`
+	AnonymousUIDFile string           `json:"uidFile"`
+	// Telemetry controls where usage events are sent: "off", "instance-only"
+	// or "all", the default.
+	Telemetry string `json:"telemetry"`
+	Tools     bool   `json:"tools"`
+	// SharePromptHash opts in to sending a hash of the prompt along with
+	// feedback, so that feedback on identical prompts can be grouped.
+	SharePromptHash bool `json:"sharePromptHash"`
+	// PreviewEdits makes commands propose their edits to the client instead
+	// of applying them, see cody.edit/accept and cody.edit/reject.
+	PreviewEdits bool `json:"previewEdits"`
+	// StreamDeltas makes streamed cody/chat notifications carry only the
+	// text generated since the previous notification, see ChatDelta.
+	StreamDeltas bool `json:"streamDeltas"`
+	QuietPeriod  int  `json:"quietPeriod"`
+	// CompletionDelay is how long, in milliseconds, completion requests wait
+	// for newer requests before they are computed.
+	CompletionDelay int `json:"completionDelay"`
+	// CompletionTrigger is when completion requests are answered: "typing",
+	// the default, answers all of them, and "manual" only the ones invoked
+	// explicitly or right after one of the CompletionTriggerCharacters.
+	CompletionTrigger string `json:"completionTrigger"`
+	// CompletionTriggerCharacters are the characters that trigger
+	// completions, "." and "(" by default.
+	CompletionTriggerCharacters []string `json:"completionTriggerCharacters"`
+	// CompletionSkip lists where automatic completions aren't requested:
+	// "comments" and "strings" skip the cursor being in a comment or a
+	// string literal of the language of the document.
+	CompletionSkip []string `json:"completionSkip"`
+	// Timeouts maps features, either "completion" or a command name, to
+	// their timeout in milliseconds. "embeddings" bounds embeddings searches
+	// and "request" every request to Sourcegraph.
+	Timeouts map[string]int `json:"timeouts"`
+	// Proxy is the URL of the proxy requests are sent through. By default,
+	// the proxy of the environment is used, see HTTPS_PROXY.
+	Proxy string `json:"proxy"`
+	// CACertificates are paths to PEM files of CA certificates trusted in
+	// addition to the ones of the system, e.g. for self-signed instances.
+	CACertificates []string `json:"caCertificates"`
+	// InsecureSkipVerify turns off the verification of TLS certificates.
+	InsecureSkipVerify bool `json:"insecureSkipVerify"`
+	// ChatModel, CompletionModel and EditModel are the models used for chat,
+	// autocompletion and code edits respectively.
+	ChatModel       string `json:"chatModel"`
+	CompletionModel string `json:"completionModel"`
+	EditModel       string `json:"editModel"`
+	// ChatMaxTokens, CompletionMaxTokens and EditMaxTokens are the maximum
+	// lengths, in tokens, of the responses to chat, autocompletion and code
+	// edit requests. They default to 1000, 256 and 2000 tokens.
+	ChatMaxTokens       int `json:"chatMaxTokens"`
+	CompletionMaxTokens int `json:"completionMaxTokens"`
+	EditMaxTokens       int `json:"editMaxTokens"`
+	// ContextTokens is the number of tokens of open files included in
+	// prompts.
+	ContextTokens int `json:"contextTokens"`
+	// ContextLinesAbove and ContextLinesBelow are the number of lines above
+	// and below the cursor included in the context of completions.
+	ContextLinesAbove int `json:"contextLinesAbove"`
+	ContextLinesBelow int `json:"contextLinesBelow"`
+	// ContextIgnore are patterns, written like those of .gitignore files,
+	// of files that are never included in prompts. They add to the patterns
+	// of the .codyignore files of the workspace folders.
+	ContextIgnore []string `json:"contextIgnore"`
+}
+
+// KeychainSettings names the keychain item holding the access token.
+type KeychainSettings struct {
+	// Service is the service of the item, "llmsp" by default.
+	Service string `json:"service"`
+	// Account is the account of the item, the Sourcegraph URL by default.
+	Account string `json:"account"`
+}
+
+// EmbeddingsRepo is a repository whose embeddings are searched in addition to
+// the repository of the current file.
+type EmbeddingsRepo struct {
+	// Name is the name of the repository on Sourcegraph
+	Name string `json:"name"`
+	// Weight is how strongly results from the repository are preferred over
+	// results from other repositories. It defaults to 1.
+	Weight float64 `json:"weight"`
+}
+
+// UnmarshalJSON accepts either a repository name or an object with a name and
+// a weight.
+func (r *EmbeddingsRepo) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*r = EmbeddingsRepo{Name: name}
+		return nil
+	}
+
+	type embeddingsRepo EmbeddingsRepo
+	return json.Unmarshal(data, (*embeddingsRepo)(r))
 }
 
 type LLMSPConfig struct {
@@ -29,8 +213,86 @@ type TextDocumentEdit struct {
 	Edits        []lsp.TextEdit                      `json:"edits"`
 }
 
+type CreateFileOptions struct {
+	Overwrite      bool `json:"overwrite,omitempty"`
+	IgnoreIfExists bool `json:"ignoreIfExists,omitempty"`
+}
+
+type CreateFile struct {
+	Kind    string             `json:"kind"`
+	URI     lsp.DocumentURI    `json:"uri"`
+	Options *CreateFileOptions `json:"options,omitempty"`
+}
+
+type RenameFileOptions struct {
+	Overwrite      bool `json:"overwrite,omitempty"`
+	IgnoreIfExists bool `json:"ignoreIfExists,omitempty"`
+}
+
+type RenameFile struct {
+	Kind    string             `json:"kind"`
+	OldURI  lsp.DocumentURI    `json:"oldUri"`
+	NewURI  lsp.DocumentURI    `json:"newUri"`
+	Options *RenameFileOptions `json:"options,omitempty"`
+}
+
+type DeleteFileOptions struct {
+	Recursive         bool `json:"recursive,omitempty"`
+	IgnoreIfNotExists bool `json:"ignoreIfNotExists,omitempty"`
+}
+
+type DeleteFile struct {
+	Kind    string             `json:"kind"`
+	URI     lsp.DocumentURI    `json:"uri"`
+	Options *DeleteFileOptions `json:"options,omitempty"`
+}
+
 type WorkspaceEdit struct {
-	DocumentChanges []TextDocumentEdit `json:"documentChanges"`
+	// DocumentChanges contains TextDocumentEdit, CreateFile, RenameFile and
+	// DeleteFile operations, which are applied in order and may change any
+	// number of documents
+	DocumentChanges []any `json:"documentChanges"`
+}
+
+// UnmarshalJSON decodes the document changes into TextDocumentEdit,
+// CreateFile, RenameFile and DeleteFile values according to their kind.
+func (e *WorkspaceEdit) UnmarshalJSON(data []byte) error {
+	var edit struct {
+		DocumentChanges []json.RawMessage `json:"documentChanges"`
+	}
+	if err := json.Unmarshal(data, &edit); err != nil {
+		return err
+	}
+
+	e.DocumentChanges = make([]any, 0, len(edit.DocumentChanges))
+	for _, raw := range edit.DocumentChanges {
+		var kind struct {
+			Kind string `json:"kind"`
+		}
+		if err := json.Unmarshal(raw, &kind); err != nil {
+			return err
+		}
+		var change any
+		switch kind.Kind {
+		case "create":
+			change = &CreateFile{}
+		case "rename":
+			change = &RenameFile{}
+		case "delete":
+			change = &DeleteFile{}
+		case "":
+			change = &TextDocumentEdit{}
+		default:
+			return fmt.Errorf("unknown document change kind %q", kind.Kind)
+		}
+		if err := json.Unmarshal(raw, change); err != nil {
+			return err
+		}
+		// Changes are stored as values, like the ones created by llmsp
+		change = reflect.ValueOf(change).Elem().Interface()
+		e.DocumentChanges = append(e.DocumentChanges, change)
+	}
+	return nil
 }
 
 type ApplyWorkspaceEditParams struct {
@@ -52,6 +314,7 @@ type CompletionItem struct {
 	InsertTextFormat lsp.InsertTextFormat   `json:"insertTextFormat,omitempty"`
 	InsertTextMode   int                    `json:"insertTextMode,omitempty"`
 	TextEdit         *lsp.TextEdit          `json:"textEdit,omitempty"`
+	Command          *lsp.Command           `json:"command,omitempty"`
 	Data             interface{}            `json:"data,omitempty"`
 }
 
@@ -80,10 +343,42 @@ type ProgressParams[T any] struct {
 
 type InitializeResult struct {
 	Capabilities ServerCapabilities `json:"capabilities,omitempty"`
+	// SessionToken can be sent back in the initializationOptions by a client
+	// reconnecting to the server in socket mode to resume its session.
+	SessionToken string `json:"sessionToken,omitempty"`
 }
 
 type CodeActionOptions struct {
-	ResolveProvider bool `json:"resolveProvider"`
+	CodeActionKinds []lsp.CodeActionKind `json:"codeActionKinds,omitempty"`
+	ResolveProvider bool                 `json:"resolveProvider"`
+}
+
+// CodeActionClientCapabilities contains the parts of the client's code action
+// capabilities that go-lsp doesn't know about.
+type CodeActionClientCapabilities struct {
+	Capabilities struct {
+		TextDocument struct {
+			CodeAction struct {
+				ResolveSupport *struct {
+					Properties []string `json:"properties"`
+				} `json:"resolveSupport,omitempty"`
+			} `json:"codeAction"`
+		} `json:"textDocument"`
+	} `json:"capabilities"`
+}
+
+// WorkspaceEditClientCapabilities contains the parts of the client's
+// workspace edit capabilities that go-lsp doesn't know about.
+type WorkspaceEditClientCapabilities struct {
+	Capabilities struct {
+		Workspace struct {
+			WorkspaceEdit *struct {
+				// ResourceOperations are the kinds of resource operations
+				// the client supports: "create", "rename" and "delete"
+				ResourceOperations []string `json:"resourceOperations"`
+			} `json:"workspaceEdit,omitempty"`
+		} `json:"workspace"`
+	} `json:"capabilities"`
 }
 
 type ServerCapabilities struct {
@@ -98,7 +393,7 @@ type ServerCapabilities struct {
 	DocumentSymbolProvider           bool                                 `json:"documentSymbolProvider,omitempty"`
 	WorkspaceSymbolProvider          bool                                 `json:"workspaceSymbolProvider,omitempty"`
 	ImplementationProvider           bool                                 `json:"implementationProvider,omitempty"`
-	CodeActionProvider               bool                                 `json:"codeActionProvider,omitempty"`
+	CodeActionProvider               any                                  `json:"codeActionProvider,omitempty"`
 	CodeLensProvider                 *lsp.CodeLensOptions                 `json:"codeLensProvider,omitempty"`
 	DocumentFormattingProvider       bool                                 `json:"documentFormattingProvider,omitempty"`
 	DocumentRangeFormattingProvider  bool                                 `json:"documentRangeFormattingProvider,omitempty"`
@@ -120,17 +415,258 @@ type ServerCapabilities struct {
 	// is a Sourcegraph extension.
 	XWorkspaceSymbolByProperties bool `json:"xworkspaceSymbolByProperties,omitempty"`
 
+	Workspace *WorkspaceServerCapabilities `json:"workspace,omitempty"`
+
 	Experimental interface{} `json:"experimental,omitempty"`
 }
 
+type WorkspaceServerCapabilities struct {
+	WorkspaceFolders *WorkspaceFoldersServerCapabilities `json:"workspaceFolders,omitempty"`
+	FileOperations   *FileOperationsServerCapabilities   `json:"fileOperations,omitempty"`
+}
+
+type WorkspaceFoldersServerCapabilities struct {
+	Supported           bool `json:"supported"`
+	ChangeNotifications bool `json:"changeNotifications"`
+}
+
+type WorkspaceFolder struct {
+	URI  lsp.DocumentURI `json:"uri"`
+	Name string          `json:"name"`
+}
+
+// InitializeWorkspaceFolders contains the workspace folders sent in the
+// initialize request, which go-lsp doesn't know about.
+type InitializeWorkspaceFolders struct {
+	WorkspaceFolders []WorkspaceFolder `json:"workspaceFolders"`
+}
+
+// InitializeLocale contains the locale sent in the initialize request, which
+// go-lsp doesn't know about.
+type InitializeLocale struct {
+	Locale string `json:"locale"`
+}
+
+// InitializeSessionParams contains the session token sent in the
+// initializationOptions of the initialize request by a reconnecting client.
+type InitializeSessionParams struct {
+	InitializationOptions struct {
+		SessionToken string `json:"sessionToken"`
+	} `json:"initializationOptions"`
+}
+
+type WorkspaceFoldersChangeEvent struct {
+	Added   []WorkspaceFolder `json:"added"`
+	Removed []WorkspaceFolder `json:"removed"`
+}
+
+type DidChangeWorkspaceFoldersParams struct {
+	Event WorkspaceFoldersChangeEvent `json:"event"`
+}
+
+type FileOperationsServerCapabilities struct {
+	DidCreate *FileOperationRegistrationOptions `json:"didCreate,omitempty"`
+}
+
+type FileOperationRegistrationOptions struct {
+	Filters []FileOperationFilter `json:"filters"`
+}
+
+type FileOperationFilter struct {
+	Scheme  string               `json:"scheme,omitempty"`
+	Pattern FileOperationPattern `json:"pattern"`
+}
+
+type FileOperationPattern struct {
+	Glob string `json:"glob"`
+}
+
+type FileCreate struct {
+	URI lsp.DocumentURI `json:"uri"`
+}
+
+type CreateFilesParams struct {
+	Files []FileCreate `json:"files"`
+}
+
+type WorkspaceEventParams struct {
+	Event string          `json:"event"`
+	URI   lsp.DocumentURI `json:"uri,omitempty"`
+}
+
+type HookResultParams struct {
+	Event   string           `json:"event"`
+	Command string           `json:"command"`
+	URI     lsp.DocumentURI  `json:"uri,omitempty"`
+	Result  *json.RawMessage `json:"result,omitempty"`
+	Error   string           `json:"error,omitempty"`
+}
+
+// ChatMessage is sent in cody/chat notifications with the lines of the
+// response so far.
+type ChatMessage struct {
+	Message []string `json:"message"`
+}
+
+// ChatDelta is sent in cody/chat notifications instead of ChatMessage when
+// deltas are streamed. Notifications are numbered from 1 by Seq.
+type ChatDelta struct {
+	Seq int `json:"seq"`
+	// Delta is the text generated since the previous notification
+	Delta string `json:"delta,omitempty"`
+	// Replace is set if Delta replaces the text received so far instead of
+	// being appended to it
+	Replace bool `json:"replace,omitempty"`
+	// Done is set on the last notification, whose Message holds the lines of
+	// the whole response
+	Done    bool     `json:"done,omitempty"`
+	Message []string `json:"message,omitempty"`
+}
+
+// EditProposalParams are sent in cody/editProposal notifications, and as the
+// result of commands, when edits are previewed instead of being applied.
+type EditProposalParams struct {
+	// ID identifies the proposal in cody.edit/accept and cody.edit/reject
+	ID        string             `json:"id"`
+	Command   string             `json:"command"`
+	Documents []ProposedDocument `json:"documents"`
+	Edit      WorkspaceEdit      `json:"edit"`
+}
+
+// ProposedDocument is a document changed by an edit proposal.
+type ProposedDocument struct {
+	URI lsp.DocumentURI `json:"uri"`
+	// NewText is the full text of the document once the edit is applied
+	NewText string `json:"newText"`
+	// Diff is a unified diff of the changes
+	Diff string `json:"diff"`
+}
+
+// ContextReport lists the context included in a prompt. It is sent in
+// cody/contextUpdated notifications, and is the result of cody.context/last.
+type ContextReport struct {
+	Model string    `json:"model,omitempty"`
+	Time  time.Time `json:"time"`
+	// Items are the pieces of context, in the order of the prompt
+	Items []ContextItem `json:"items"`
+	// Tokens is the length of the whole prompt, including the instructions
+	// and the question
+	Tokens int `json:"tokens"`
+}
+
+// ContextItem is a piece of context included in a prompt, such as the
+// contents of a file or an embeddings result.
+type ContextItem struct {
+	Kind string `json:"kind"`
+	File string `json:"file,omitempty"`
+	// StartLine and EndLine are the lines of the file that were included,
+	// starting at 1. They are omitted if the item isn't a range of the file.
+	StartLine int `json:"startLine,omitempty"`
+	EndLine   int `json:"endLine,omitempty"`
+	Tokens    int `json:"tokens"`
+}
+
+// ContextFile is a range of a file from embeddings results that was
+// included in the prompt of an answer, for clients to link to.
+type ContextFile struct {
+	// Repo is the repository of the file, if known
+	Repo string `json:"repo,omitempty"`
+	File string `json:"file"`
+	// StartLine and EndLine are the lines of the range, starting at 1
+	StartLine int `json:"startLine"`
+	EndLine   int `json:"endLine"`
+}
+
+// ChatResult is the result of the cody.chat/message, cody.explain and
+// cody.explainSelection commands.
+type ChatResult struct {
+	Message      string        `json:"message"`
+	ContextFiles []ContextFile `json:"contextFiles"`
+	// Aborted is set if the answer was stopped by cody.chat/abort, Message
+	// is what was generated until then
+	Aborted bool `json:"aborted,omitempty"`
+}
+
+// Citation is a range of a file an answer is based on.
+type Citation struct {
+	// Index is the number the answer cites the range by, as in [1]
+	Index int `json:"index"`
+	// Repo is the repository of the file, if known
+	Repo string `json:"repo,omitempty"`
+	File string `json:"file"`
+	// StartLine and EndLine are the lines of the range, starting at 1
+	StartLine int `json:"startLine"`
+	EndLine   int `json:"endLine"`
+}
+
+// RepoAnswer is the result of the cody.repo/ask command.
+type RepoAnswer struct {
+	Answer    string     `json:"answer"`
+	Citations []Citation `json:"citations"`
+}
+
+// States of the server in llmsp/status notifications.
+const (
+	StatusIdle               = "idle"
+	StatusFetchingCompletion = "fetching-completion"
+	StatusFetchingHover      = "fetching-hover"
+	StatusStreamingChat      = "streaming-chat"
+	StatusRunningCommand     = "running-command"
+	StatusRateLimited        = "rate-limited"
+	StatusError              = "error"
+)
+
+// StatusParams are sent in llmsp/status notifications whenever the state of
+// the server changes, for status lines.
+type StatusParams struct {
+	State string `json:"state"`
+	// Message describes the error of the error and rate-limited states
+	Message string `json:"message,omitempty"`
+	// Active is the number of operations in progress
+	Active int `json:"active"`
+}
+
 type CodeAction struct {
-	Title          string             `json:"title"`
-	Kind           lsp.CodeActionKind `json:"kind,omitempty"`
-	Diagnostics    []Diagnostic       `json:"diagnostics,omitempty"`
-	IsPrePreferred bool               `json:"isPreferred,omitempty"`
-	Edit           WorkspaceEdit      `json:"edit,omitempty"`
-	Command        lsp.Command        `json:"command,omitempty"`
-	Data           []any              `json:"data,omitempty"`
+	Title       string             `json:"title"`
+	Kind        lsp.CodeActionKind `json:"kind,omitempty"`
+	Diagnostics []Diagnostic       `json:"diagnostics,omitempty"`
+	IsPreferred bool               `json:"isPreferred,omitempty"`
+	Edit        *WorkspaceEdit     `json:"edit,omitempty"`
+	Command     *lsp.Command       `json:"command,omitempty"`
+	Data        *CodeActionData    `json:"data,omitempty"`
+}
+
+// CodeActionData is attached to code actions whose edit can be computed with
+// codeAction/resolve.
+type CodeActionData struct {
+	Command   string `json:"command"`
+	Arguments []any  `json:"arguments"`
+}
+
+// TODOItem is a TODO comment in an open document, as listed by
+// cody.todos/workspace.
+type TODOItem struct {
+	URI lsp.DocumentURI `json:"uri"`
+	// Line is the line of the comment
+	Line int `json:"line"`
+	// Text is the comment, without the comment prefix
+	Text string `json:"text"`
+}
+
+// CodeLens is like lsp.CodeLens, but without a command until it is resolved.
+type CodeLens struct {
+	Range   lsp.Range     `json:"range"`
+	Command *lsp.Command  `json:"command,omitempty"`
+	Data    *CodeLensData `json:"data,omitempty"`
+}
+
+// CodeLensData is attached to code lenses whose command is constructed with
+// codeLens/resolve.
+type CodeLensData struct {
+	Command string          `json:"command"`
+	URI     lsp.DocumentURI `json:"uri"`
+	// Line is the line of the function header
+	Line int `json:"line"`
 }
 
 type WorkDoneProgressBegin struct {
@@ -139,6 +675,12 @@ type WorkDoneProgressBegin struct {
 	Message string `json:"message"`
 }
 
+type WorkDoneProgressReport struct {
+	Kind       string `json:"kind"`
+	Message    string `json:"message,omitempty"`
+	Percentage int    `json:"percentage,omitempty"`
+}
+
 type WorkDoneProgressEnd struct {
 	Kind    string `json:"kind"`
 	Message string `json:"message"`
@@ -182,6 +724,20 @@ type Diagnostic struct {
 	Message string `json:"message"`
 }
 
+// MarkupContent is a string value with a content kind, either "plaintext"
+// or "markdown".
+type MarkupContent struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+// Hover is the result of a hover request. Unlike lsp.Hover its contents can
+// be Markdown.
+type Hover struct {
+	Contents MarkupContent `json:"contents"`
+	Range    *lsp.Range    `json:"range,omitempty"`
+}
+
 type CodeActionContext struct {
 	Diagnostics []Diagnostic `json:"diagnostics"`
 	Only        []string     `json:"only,omitempty"`
@@ -198,3 +754,18 @@ type ExecuteCommandParams struct {
 	Arguments     []interface{} `json:"arguments,omitempty"`
 	WorkDoneToken string        `json:"workDoneToken"`
 }
+
+type HistoryListParams struct {
+	Query string `json:"query,omitempty"`
+}
+
+type HistoryDocumentParams struct {
+	URI lsp.DocumentURI `json:"uri"`
+}
+
+type HistoryDocument struct {
+	URI     lsp.DocumentURI `json:"uri"`
+	Title   string          `json:"title"`
+	Content string          `json:"content,omitempty"`
+	Matches []string        `json:"matches,omitempty"`
+}